@@ -0,0 +1,184 @@
+package app
+
+import (
+	"backend/instance"
+	"backend/trips"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func (surmai *SurmaiApp) BindCommands() {
+	surmai.Pb.RootCmd.AddCommand(surmai.repairCommand())
+	surmai.Pb.RootCmd.AddCommand(surmai.migrateInstanceCommand())
+	surmai.Pb.RootCmd.AddCommand(surmai.anonymizeCommand())
+	surmai.Pb.RootCmd.AddCommand(surmai.migrateTimesCommand())
+	surmai.Pb.RootCmd.AddCommand(surmai.encryptCommand())
+}
+
+func printJson(value interface{}) error {
+	output, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(output))
+	return nil
+}
+
+func (surmai *SurmaiApp) repairCommand() *cobra.Command {
+
+	var fix bool
+
+	command := &cobra.Command{
+		Use:   "repair [tripId]",
+		Short: "Scans trips for orphaned records, invalid dates and malformed data",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tripId := ""
+			if len(args) > 0 {
+				tripId = args[0]
+			}
+
+			report, err := trips.RepairTrips(surmai.Pb, tripId, !fix)
+			if err != nil {
+				return err
+			}
+
+			return printJson(report)
+		},
+	}
+
+	command.Flags().BoolVar(&fix, "fix", false, "apply the fixes instead of only reporting them")
+	return command
+}
+
+func (surmai *SurmaiApp) migrateTimesCommand() *cobra.Command {
+
+	var dryRun bool
+
+	command := &cobra.Command{
+		Use:   "migrate-times",
+		Short: "Stores the UTC instant and timezone of itinerary times saved as local wall clock time",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := trips.MigrateInstants(surmai.Pb, surmai.TimezoneFinder, dryRun)
+			if err != nil {
+				return err
+			}
+
+			return printJson(report)
+		},
+	}
+
+	command.Flags().BoolVar(&dryRun, "dry-run", false, "only report the records that would change")
+	return command
+}
+
+func (surmai *SurmaiApp) encryptCommand() *cobra.Command {
+
+	var dryRun bool
+
+	command := &cobra.Command{
+		Use:   "encrypt",
+		Short: "Encrypts the confirmation codes and vault documents saved before the instance had an encryption key",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := trips.EncryptStoredSecrets(surmai.Pb, dryRun)
+			if err != nil {
+				return err
+			}
+
+			return printJson(report)
+		},
+	}
+
+	command.Flags().BoolVar(&dryRun, "dry-run", false, "only count what would be encrypted")
+	return command
+}
+
+func (surmai *SurmaiApp) anonymizeCommand() *cobra.Command {
+
+	var ownerId string
+	var shiftDays int
+
+	command := &cobra.Command{
+		Use:   "anonymize <tripId>",
+		Short: "Clones a trip into an anonymized demo copy with fake personal details and shifted dates",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			trip, err := surmai.Pb.FindRecordById("trips", args[0])
+			if err != nil {
+				return err
+			}
+
+			if ownerId == "" {
+				ownerId = trip.GetString("ownerId")
+			}
+
+			cloneId, err := trips.CloneAnonymizedTrip(surmai.Pb, trip, ownerId, shiftDays)
+			if err != nil {
+				return err
+			}
+
+			return printJson(map[string]string{"tripId": cloneId})
+		},
+	}
+
+	command.Flags().StringVar(&ownerId, "owner", "", "user id that owns the copy (defaults to the trip owner)")
+	command.Flags().IntVar(&shiftDays, "shift-days", 0, "days to move the dates by (defaults to starting 30 days from today)")
+	return command
+}
+
+func (surmai *SurmaiApp) migrateInstanceCommand() *cobra.Command {
+
+	remote := &instance.RemoteInstance{}
+	var tripIds []string
+	var userEmails []string
+	var passwordStdin bool
+
+	command := &cobra.Command{
+		Use:   "migrate-instance",
+		Short: "Copies users and trips from another Surmai instance into this one",
+		Long: "Copies users and trips from another Surmai instance into this one. The superuser password of the " +
+			"source instance is read from SURMAI_REMOTE_PASSWORD, or from stdin with --password-stdin, so it " +
+			"does not show up in the process list.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			remote.Password = os.Getenv("SURMAI_REMOTE_PASSWORD")
+			if passwordStdin {
+				password, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+				if err != nil && !errors.Is(err, io.EOF) {
+					return err
+				}
+				remote.Password = strings.TrimRight(password, "\r\n")
+			}
+
+			if remote.Url == "" || remote.Email == "" || remote.Password == "" {
+				return errors.New("--url, --email and a password (SURMAI_REMOTE_PASSWORD or --password-stdin) are required")
+			}
+
+			if err := remote.Authenticate(); err != nil {
+				return err
+			}
+
+			results, err := remote.Migrate(surmai.Pb, tripIds, userEmails)
+			if err != nil {
+				return err
+			}
+
+			return printJson(results)
+		},
+	}
+
+	command.Flags().StringVar(&remote.Url, "url", "", "base url of the source instance")
+	command.Flags().StringVar(&remote.Email, "email", "", "superuser email on the source instance")
+	command.Flags().BoolVar(&passwordStdin, "password-stdin", false, "read the superuser password of the source instance from stdin")
+	command.Flags().StringSliceVar(&tripIds, "trip", nil, "id of a trip to copy (repeatable)")
+	command.Flags().StringSliceVar(&userEmails, "user", nil, "copy all trips owned by this user email (repeatable)")
+	return command
+}
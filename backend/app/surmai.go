@@ -1,11 +1,18 @@
 package app
 
 import (
+	"backend/datasets"
+	"backend/flights"
+	"backend/flights/aerodatabox"
+	"backend/flights/flightaware"
 	"backend/hooks"
 	"backend/jobs"
 	"backend/middleware"
 	R "backend/routes"
+	"backend/trips"
 	"backend/types"
+	"backend/validation"
+	"backend/weather/openmeteo"
 	"os"
 
 	"github.com/pocketbase/pocketbase"
@@ -35,6 +42,25 @@ func (surmai *SurmaiApp) BindRoutes() {
 		adminRoutes.POST("/datasets", func(e *core.RequestEvent) error {
 			return R.LoadDataset(e, surmai.TimezoneFinder)
 		})
+		adminRoutes.POST("/repair", R.RepairTrips)
+		adminRoutes.POST("/timezones", func(e *core.RequestEvent) error {
+			return R.FixTripTimezones(e, surmai.TimezoneFinder)
+		})
+		adminRoutes.POST("/anonymize", R.AnonymizeTrip)
+		adminRoutes.GET("/ai-config", R.ExportAIConfig)
+		adminRoutes.POST("/ai-config", R.ImportAIConfig)
+		adminRoutes.GET("/travel-advisories", R.GetTravelAdvisories)
+		adminRoutes.POST("/travel-advisories", R.UpdateTravelAdvisories)
+		adminRoutes.GET("/entry-requirements", R.GetEntryRequirements)
+		adminRoutes.POST("/entry-requirements", R.UpdateEntryRequirements)
+		adminRoutes.GET("/caches", R.GetCaches)
+		adminRoutes.DELETE("/caches", R.FlushCaches)
+		adminRoutes.GET("/telemetry", func(e *core.RequestEvent) error {
+			return R.TelemetryStatus(e, surmai.Version)
+		})
+		adminRoutes.POST("/telemetry", func(e *core.RequestEvent) error {
+			return R.UpdateTelemetry(e, surmai.Version)
+		})
 
 		// These routes are handled by React Router to load the appropriate component
 		// It's possible that these routes are bookmarked and are loaded directly
@@ -44,23 +70,149 @@ func (surmai *SurmaiApp) BindRoutes() {
 		se.Router.GET("/settings", R.ShowIndexPage).Bind()
 		se.Router.GET("/profile", R.ShowIndexPage).Bind()
 		se.Router.GET("/invitations", R.ShowIndexPage).Bind()
+		se.Router.GET("/invitations/accept", R.ShowIndexPage).Bind()
 		se.Router.GET("/register", R.ShowIndexPage).Bind()
 
+		// Accept a trip invitation from the link in its email
+		se.Router.POST("/api/surmai/invitations/accept", R.AcceptTripInvitation).Bind(apis.RequireAuth())
+
+		// Notifications of the signed in user
+		se.Router.GET("/api/surmai/notifications", R.ListNotifications).Bind(apis.RequireAuth())
+		se.Router.POST("/api/surmai/notifications/read", R.MarkNotificationsRead).Bind(apis.RequireAuth())
+		se.Router.GET("/api/surmai/notifications/preferences", R.NotificationPreferences).Bind(apis.RequireAuth())
+		se.Router.PUT("/api/surmai/notifications/preferences", R.UpdateNotificationPreferences).Bind(apis.RequireAuth())
+		se.Router.GET("/api/surmai/push/config", R.PushConfig).Bind(apis.RequireAuth())
+		se.Router.GET("/api/surmai/push/subscriptions", R.ListPushSubscriptions).Bind(apis.RequireAuth())
+		se.Router.POST("/api/surmai/push/subscriptions", R.CreatePushSubscription).Bind(apis.RequireAuth())
+		se.Router.DELETE("/api/surmai/push/subscriptions/{subscriptionId}", R.DeletePushSubscription).Bind(apis.RequireAuth())
+		se.Router.POST("/api/surmai/push/subscriptions/{subscriptionId}/test", R.TestPushSubscription).Bind(apis.RequireAuth())
+
 		// Create invited user
 		se.Router.POST("/api/surmai/create-user", R.CreateInvitedUser).Bind()
 
 		// Import a new trip
 		se.Router.POST("/api/surmai/trip/import", R.ImportTrip).Bind(apis.RequireAuth())
+		se.Router.POST("/api/surmai/trip/import/external", func(e *core.RequestEvent) error {
+			return R.ImportExternalTrip(e, surmai.TimezoneFinder)
+		}).Bind(apis.RequireAuth())
+		se.Router.POST("/api/surmai/trips/from-template/{templateId}", R.CreateTripFromTemplate).Bind(apis.RequireAuth())
+
+		// Templates shared with other instances through the community gallery
+		se.Router.GET("/api/surmai/gallery", R.BrowseGallery).Bind(apis.RequireAuth())
+		se.Router.GET("/api/surmai/gallery/{listingId}", R.GetGalleryTemplate).Bind(apis.RequireAuth())
+		se.Router.POST("/api/surmai/gallery/{listingId}/import", R.ImportGalleryTemplate).Bind(apis.RequireAuth())
+
+		// Booking confirmations forwarded by email, posted by the mail provider
+		se.Router.POST("/api/surmai/inbound-email", R.InboundEmail)
+
+		// The assistant in Telegram groups and Discord channels, the platforms
+		// sign what they post
+		R.SetupChatBots(se.App)
+		se.Router.POST("/api/surmai/bots/telegram", R.TelegramWebhook)
+		se.Router.POST("/api/surmai/bots/discord", R.DiscordInteractions)
+
+		se.Router.POST("/api/surmai/share-target", func(e *core.RequestEvent) error {
+			return R.ShareTarget(e, surmai.TimezoneFinder)
+		}).Bind(apis.RequireAuth())
+
+		se.Router.GET("/api/surmai/timezones", func(e *core.RequestEvent) error {
+			return R.LookupTimezone(e, surmai.TimezoneFinder)
+		}).Bind(apis.RequireAuth())
 
 		// Ops on existing trips
 		tripRoutes := se.Router.Group("/api/surmai/trip/{tripId}")
 		tripRoutes.Bind(apis.RequireAuth(), middleware.RequireTripAccess())
 		tripRoutes.GET("/collaborators", R.GetTripCollaborators)
+		tripRoutes.GET("/invitations", R.ListTripInvitations).Bind(middleware.RequireTripRole(trips.RoleEditor))
+		tripRoutes.POST("/invitations", R.CreateTripInvitation).Bind(middleware.RequireTripRole(trips.RoleEditor))
+		tripRoutes.DELETE("/invitations/{invitationId}", R.RevokeTripInvitation).Bind(middleware.RequireTripRole(trips.RoleEditor))
 		tripRoutes.POST("/export", R.ExportTrip)
+		tripRoutes.POST("/debug-bundle", func(e *core.RequestEvent) error {
+			return R.DebugBundle(e, surmai.Version)
+		})
 		tripRoutes.POST("/calendar", R.GenerateIcsData)
+		tripRoutes.GET("/shares", R.ListTripShares).Bind(middleware.RequireTripRole(trips.RoleEditor))
+		tripRoutes.POST("/shares", R.CreateTripShare).Bind(middleware.RequireTripRole(trips.RoleEditor))
+		tripRoutes.DELETE("/shares/{shareId}", R.RevokeTripShare).Bind(middleware.RequireTripRole(trips.RoleEditor))
+		tripRoutes.GET("/comments", R.ListTripComments)
+		tripRoutes.POST("/comments", R.CreateTripComment)
+		tripRoutes.PATCH("/comments/{commentId}", R.UpdateTripComment)
+		tripRoutes.DELETE("/comments/{commentId}", R.DeleteTripComment)
+		tripRoutes.GET("/polls", R.ListTripPolls)
+		tripRoutes.POST("/polls", R.CreateTripPoll).Bind(middleware.RequireTripRole(trips.RoleEditor))
+		tripRoutes.POST("/polls/{pollId}/vote", R.VoteTripPoll)
+		tripRoutes.POST("/polls/{pollId}/schedule", R.ScheduleTripPoll).Bind(middleware.RequireTripRole(trips.RoleEditor))
+		tripRoutes.POST("/polls/{pollId}/close", R.CloseTripPoll).Bind(middleware.RequireTripRole(trips.RoleEditor))
+		tripRoutes.DELETE("/polls/{pollId}", R.DeleteTripPoll)
+		tripRoutes.GET("/bots", R.ListTripChats)
+		tripRoutes.POST("/bots/link", R.CreateChatLinkCode)
+		tripRoutes.DELETE("/bots/{chatId}", R.UnlinkTripChat).Bind(middleware.RequireTripRole(trips.RoleEditor))
+		tripRoutes.GET("/export/ics", R.ExportTripCalendar)
+		tripRoutes.GET("/export/csv/{kind}", R.ExportTripCSV)
+		tripRoutes.POST("/import/places", func(e *core.RequestEvent) error {
+			return R.ImportTripPlaces(e, surmai.TimezoneFinder)
+		})
+		tripRoutes.POST("/import/ics", func(e *core.RequestEvent) error {
+			return R.ImportTripCalendar(e, surmai.TimezoneFinder)
+		})
+		tripRoutes.POST("/import/confirmation", func(e *core.RequestEvent) error {
+			return R.ImportConfirmation(e, surmai.TimezoneFinder)
+		})
+		tripRoutes.GET("/report", R.TripReport)
+		tripRoutes.GET("/itinerary", R.TripItinerary)
+		tripRoutes.GET("/tags", R.ListTripTags)
+		tripRoutes.PATCH("/tags/{tag}", R.RenameTripTag).Bind(middleware.RequireTripRole(trips.RoleEditor))
+		tripRoutes.DELETE("/tags/{tag}", R.DeleteTripTag).Bind(middleware.RequireTripRole(trips.RoleEditor))
+		tripRoutes.GET("/feed", R.TripFeed)
+		tripRoutes.GET("/activity", R.TripActivity)
+		tripRoutes.POST("/presence", R.TripPresenceHeartbeat)
+		tripRoutes.DELETE("/presence/{sessionId}", R.LeaveTripPresence)
+		tripRoutes.GET("/presence/stream", R.TripPresenceStream)
+		tripRoutes.POST("/template", R.SaveTripTemplate)
+		tripRoutes.POST("/gallery", R.PublishTripToGallery)
+		tripRoutes.POST("/report", R.RegenerateTripReport)
+		tripRoutes.GET("/report/pdf", R.ExportTripReportPDF)
+		tripRoutes.GET("/emergency-sheet", R.TripEmergencySheet)
+		tripRoutes.GET("/lodging-shares", R.LodgingShares)
+		tripRoutes.GET("/rentals/conflicts", R.RentalConflicts)
+		tripRoutes.POST("/transportations/{transportationId}/boarding-pass", R.UploadBoardingPass)
+		for _, collection := range []string{"activities", "lodgings", "transportations"} {
+			tripRoutes.GET("/"+collection, func(e *core.RequestEvent) error {
+				return R.ListTripItems(e, collection)
+			})
+			tripRoutes.POST("/"+collection+"/{recordId}/attachments", func(e *core.RequestEvent) error {
+				return R.UploadItemAttachments(e, collection)
+			})
+			tripRoutes.DELETE("/"+collection+"/{recordId}/attachments/{attachmentId}", func(e *core.RequestEvent) error {
+				return R.DetachItemAttachment(e, collection)
+			})
+		}
+		tripRoutes.GET("/tickets/{ticketId}/qr", R.TicketQRCode)
+		tripRoutes.POST("/insurance-claim", R.ExportInsuranceClaim).Bind(middleware.RequireTripRole(trips.RoleEditor))
 		tripRoutes.POST("/assistant", R.TripAssistant)
 		tripRoutes.POST("/assistant/stream", R.TripAssistantStream)
 		tripRoutes.POST("/assistant/proposals/{proposalId}/decision", R.AssistantProposalDecision)
+		tripRoutes.GET("/assistant/turns/{turnId}/sources", R.AssistantTurnSources)
+		tripRoutes.GET("/assistant/proposals", R.PendingAssistantProposals)
+		tripRoutes.GET("/assistant/actions", R.AssistantActions)
+		tripRoutes.GET("/assistant/import-reviews", R.ImportReviews)
+		tripRoutes.DELETE("/assistant/import-reviews/{reviewId}", R.DismissImportReview)
+		tripRoutes.GET("/readiness", R.TripReadiness)
+		tripRoutes.GET("/weather", R.TripWeather)
+		tripRoutes.GET("/places/search", R.SearchTripPlaces)
+		tripRoutes.GET("/lodging/search", R.SearchTripLodging)
+		tripRoutes.GET("/travel-times", R.TripTravelTimes)
+		tripRoutes.GET("/entry-requirements", R.TripEntryRequirements)
+		tripRoutes.GET("/risks", R.TripRisks)
+		tripRoutes.POST("/expenses/rates", R.RerateTripExpenses)
+		tripRoutes.GET("/expenses/balances", R.ExpenseBalances).Bind(middleware.RequireTripRole(trips.RoleEditor))
+		tripRoutes.GET("/expenses/settle-up", R.ExpenseSettleUp).Bind(middleware.RequireTripRole(trips.RoleEditor))
+		tripRoutes.GET("/budget/revaluation", R.TripBudgetRevaluation)
+		tripRoutes.GET("/budget/categories", R.TripBudgetCategories)
+		tripRoutes.GET("/budget/daily", R.TripDailySpend)
+		tripRoutes.POST("/expenses/{expenseId}/rate", R.RerateExpense)
+		tripRoutes.POST("/expenses/receipt", R.ScanExpenseReceipt)
+		tripRoutes.POST("/expenses/{expenseId}/receipt", R.ScanExpenseReceipt)
 
 		// General Utility Routes
 		se.Router.GET("/api/surmai/flight-route/{flightNumber}",
@@ -68,14 +220,34 @@ func (surmai *SurmaiApp) BindRoutes() {
 				return R.GetFlightRoute(e, surmai.TimezoneFinder)
 			},
 		).Bind(apis.RequireAuth())
+		se.Router.GET("/api/surmai/airports", R.SearchAirports).Bind(apis.RequireAuth())
+		se.Router.GET("/api/surmai/airports/{code}", R.GetAirport).Bind(apis.RequireAuth())
+		se.Router.GET("/api/surmai/airlines", R.SearchAirlines).Bind(apis.RequireAuth())
+		se.Router.GET("/api/surmai/airlines/{code}", R.GetAirline).Bind(apis.RequireAuth())
+		se.Router.GET("/api/surmai/geocode", R.Geocode).Bind(apis.RequireAuth())
+		se.Router.GET("/api/surmai/geocode/reverse", R.ReverseGeocode).Bind(apis.RequireAuth())
+		// Cover photos and attached images in the size the screen needs
+		se.Router.GET("/api/surmai/images/{collection}/{recordId}/{filename}", R.ServeImageThumbnail)
+
+		// Autocomplete from the user's own travel history
+		se.Router.GET("/api/surmai/autocomplete/routes", R.AutocompleteRoutes).Bind(apis.RequireAuth())
+		se.Router.GET("/api/surmai/autocomplete/lodgings", R.AutocompleteLodgings).Bind(apis.RequireAuth())
+		// Where the user was, for the travel map
+		se.Router.GET("/api/surmai/history/locations", R.TravelLocations).Bind(apis.RequireAuth())
 
 		// Public routes
 		se.Router.GET("/site-settings.json", func(e *core.RequestEvent) error {
 			return R.SiteSettings(e, surmai.DemoMode, surmai.Version)
 		}).Bind()
+		// Read-only itinerary of a trip shared by link, no account needed
+		se.Router.GET("/share/{token}", R.ViewTripShare)
 
 		// serves static files from the provided public dir (if exists)
 		se.Router.GET("/{path...}", apis.Static(os.DirFS("./pb_public"), false))
+
+		// proposals are kept in memory, bring back the ones pending before
+		// the restart
+		R.RestorePendingProposals(se.App)
 		return se.Next()
 	})
 }
@@ -97,6 +269,8 @@ func (surmai *SurmaiApp) BuildTimezoneFinder() {
 		panic(err)
 	}
 	surmai.TimezoneFinder = finder
+	datasets.InitLookups(surmai.Pb, finder)
+	R.SetupGeocoding(finder)
 
 }
 
@@ -109,15 +283,81 @@ func (surmai *SurmaiApp) BindEventHooks() {
 		return hooks.AddTimezoneToDestinations(e, surmai.TimezoneFinder)
 	})
 
+	surmai.Pb.OnRecordCreate(trips.InstantCollections...).BindFunc(func(e *core.RecordEvent) error {
+		return hooks.StoreUtcInstants(e, surmai.TimezoneFinder)
+	})
+	surmai.Pb.OnRecordUpdate(trips.InstantCollections...).BindFunc(func(e *core.RecordEvent) error {
+		return hooks.StoreUtcInstants(e, surmai.TimezoneFinder)
+	})
+
+	surmai.Pb.OnRecordUpdateRequest("trips").BindFunc(hooks.ProtectCollaboratorRoles)
+	surmai.Pb.OnRecordUpdate("trips").BindFunc(hooks.NotifyTripMembersAdded)
+	surmai.Pb.OnRecordAfterCreateSuccess("assistant_actions").BindFunc(hooks.NotifyPendingProposal)
+	surmai.Pb.OnRecordAfterCreateSuccess("polls").BindFunc(hooks.NotifyPollCreated)
+
+	viewerProtectedCollections := append([]string{"trips", "trip_attachments"}, trips.PrivacyCollections...)
+	surmai.Pb.OnRecordCreateRequest(viewerProtectedCollections...).BindFunc(hooks.ProtectTripFromViewers)
+	surmai.Pb.OnRecordUpdateRequest(viewerProtectedCollections...).BindFunc(hooks.ProtectTripFromViewers)
+	surmai.Pb.OnRecordDeleteRequest(viewerProtectedCollections...).BindFunc(hooks.ProtectTripFromViewers)
+
 	surmai.Pb.OnRecordCreateRequest("invitations").BindFunc(hooks.CreateTripCollaborationInvitation)
 	surmai.Pb.OnRecordUpdateRequest("invitations").BindFunc(hooks.UpdateTripCollaborationInvitation)
+
+	surmai.Pb.OnRecordValidate("transportations", "lodgings", "activities", "trip_expenses", "equipment_rentals", "car_rentals", "dining", "tickets").BindFunc(validation.ValidateItineraryRecord)
+	surmai.Pb.OnRecordValidate("lodgings").BindFunc(hooks.ValidateLodgingRooms)
+	surmai.Pb.OnRecordValidate(trips.SplitCollections...).BindFunc(hooks.ValidateExpenseSplits)
+	surmai.Pb.OnRecordValidate("trips").BindFunc(hooks.ValidateBudgetCategories)
+	surmai.Pb.OnRecordValidate("documents").BindFunc(hooks.ValidateTripDocument)
+	surmai.Pb.OnRecordValidate(trips.TaggedCollections...).BindFunc(hooks.ValidateTags)
+	surmai.Pb.OnRecordCreateExecute("documents").BindFunc(hooks.EncryptDocumentFiles)
+	surmai.Pb.OnRecordUpdateExecute("documents").BindFunc(hooks.EncryptDocumentFiles)
+	surmai.Pb.OnFileDownloadRequest("documents").BindFunc(hooks.ServeDocumentFile)
+	surmai.Pb.OnRecordCreateExecute(trips.ConfirmationCodeCollections...).BindFunc(hooks.EncryptConfirmationCode)
+	surmai.Pb.OnRecordUpdateExecute(trips.ConfirmationCodeCollections...).BindFunc(hooks.EncryptConfirmationCode)
+	surmai.Pb.OnRecordEnrich(trips.ConfirmationCodeCollections...).BindFunc(hooks.RevealConfirmationCode)
+	surmai.Pb.OnRecordValidate("transportations").BindFunc(hooks.ValidateTransportationSeats)
+	surmai.Pb.OnRecordCreate(trips.CostCollections...).BindFunc(hooks.LockExchangeRate)
+	surmai.Pb.OnRecordUpdate(trips.CostCollections...).BindFunc(hooks.LockExchangeRate)
+
+	surmai.Pb.OnRecordValidate(trips.PrivacyCollections...).BindFunc(hooks.ValidateItemPrivacy)
+	surmai.Pb.OnRecordCreateRequest(trips.PrivacyCollections...).BindFunc(hooks.ProtectItemPrivacy)
+	surmai.Pb.OnRecordUpdateRequest(trips.PrivacyCollections...).BindFunc(hooks.ProtectItemPrivacy)
+	surmai.Pb.OnRecordEnrich(trips.PrivacyCollections...).BindFunc(hooks.RedactPrivateFields)
+
+	// after ProtectItemPrivacy, which puts back the private fields editors cannot change
+	surmai.Pb.OnRecordUpdateRequest(trips.VersionedCollections...).BindFunc(hooks.CheckRecordVersion)
+	surmai.Pb.OnRecordViewRequest(trips.VersionedCollections...).BindFunc(hooks.SetRecordETag)
+
+	surmai.Pb.OnRecordAfterDeleteSuccess(trips.CommentCollections...).BindFunc(hooks.DeleteItemComments)
+
+	surmai.Pb.OnRecordCreateRequest(trips.EventCollections...).BindFunc(hooks.TrackTripEventActor)
+	surmai.Pb.OnRecordUpdateRequest(trips.EventCollections...).BindFunc(hooks.TrackTripEventActor)
+	surmai.Pb.OnRecordDeleteRequest(trips.EventCollections...).BindFunc(hooks.TrackTripEventActor)
+	surmai.Pb.OnRecordCreate(trips.EventCollections...).BindFunc(hooks.RecordTripEvent)
+	surmai.Pb.OnRecordUpdate(trips.EventCollections...).BindFunc(hooks.RecordTripEvent)
+	surmai.Pb.OnRecordDelete(trips.EventCollections...).BindFunc(hooks.RecordTripEvent)
+	surmai.Pb.OnRecordAfterDeleteSuccess("trips").BindFunc(hooks.DeleteTripEvents)
+
+	surmai.Pb.OnRecordAfterCreateSuccess("trips", "trip_attachments").BindFunc(hooks.GenerateThumbnails)
+	surmai.Pb.OnRecordAfterUpdateSuccess("trips", "trip_attachments").BindFunc(hooks.GenerateThumbnails)
+
+	tripCollections := []string{"trips", "transportations", "lodgings", "activities", "trip_expenses", "equipment_rentals", "car_rentals", "dining", "tickets", "trip_attachments"}
+	surmai.Pb.OnRecordAfterCreateSuccess(tripCollections...).BindFunc(hooks.InvalidateTripCaches)
+	surmai.Pb.OnRecordAfterUpdateSuccess(tripCollections...).BindFunc(hooks.InvalidateTripCaches)
+	surmai.Pb.OnRecordAfterDeleteSuccess(tripCollections...).BindFunc(hooks.InvalidateTripCaches)
 }
 
 func (surmai *SurmaiApp) StartJobs() {
 	surmai.startInvitationCleanupJob()
 	surmai.startDemoModeSetupJob()
 	surmai.startSyncCurrencyConversionRatesJob()
-
+	surmai.startWeatherReshuffleJob()
+	surmai.startFlightStatusJob()
+	surmai.startTripReportJob()
+	surmai.startPreTripCheckInJob()
+	surmai.startTripStartingJob()
+	surmai.startDocumentExpiryJob()
+	surmai.startTelemetryJob()
 }
 
 func (surmai *SurmaiApp) startSyncCurrencyConversionRatesJob() {
@@ -132,6 +372,102 @@ func (surmai *SurmaiApp) startSyncCurrencyConversionRatesJob() {
 	})
 }
 
+func (surmai *SurmaiApp) startWeatherReshuffleJob() {
+
+	if os.Getenv("SURMAI_WEATHER_PROVIDER") == "none" {
+		return
+	}
+
+	job := &jobs.WeatherReshuffleJob{
+		Pb:       surmai.Pb,
+		Provider: openmeteo.OpenMeteo{},
+	}
+
+	surmai.Pb.Cron().MustAdd("WeatherReshuffleJob", "30 * * * *", func() {
+		job.Execute()
+	})
+}
+
+func (surmai *SurmaiApp) startFlightStatusJob() {
+
+	job := &jobs.FlightStatusJob{
+		Pb: surmai.Pb,
+		Providers: map[string]flights.StatusProvider{
+			"flightaware": flightaware.FlightAware{},
+			"aerodatabox": aerodatabox.AeroDataBox{},
+		},
+	}
+
+	// the job reads the provider settings itself and paces each flight
+	surmai.Pb.Cron().MustAdd("FlightStatusJob", "*/5 * * * *", func() {
+		job.Execute()
+	})
+}
+
+func (surmai *SurmaiApp) startTripReportJob() {
+
+	job := &jobs.TripReportJob{
+		Pb: surmai.Pb,
+	}
+
+	// run job every day
+	surmai.Pb.Cron().MustAdd("TripReportJob", "15 3 * * *", func() {
+		job.Execute()
+	})
+}
+
+func (surmai *SurmaiApp) startPreTripCheckInJob() {
+
+	job := &jobs.PreTripCheckInJob{
+		Pb: surmai.Pb,
+		CheckIn: func(app core.App, trip *core.Record) error {
+			return R.PreTripCheckIn(app, trip, surmai.TimezoneFinder)
+		},
+	}
+
+	// run job every day
+	surmai.Pb.Cron().MustAdd("PreTripCheckInJob", "0 8 * * *", func() {
+		job.Execute()
+	})
+}
+
+func (surmai *SurmaiApp) startTripStartingJob() {
+
+	job := &jobs.TripStartingJob{
+		Pb: surmai.Pb,
+	}
+
+	// run job every hour, each trip is announced once
+	surmai.Pb.Cron().MustAdd("TripStartingJob", "45 * * * *", func() {
+		job.Execute()
+	})
+}
+
+func (surmai *SurmaiApp) startDocumentExpiryJob() {
+
+	job := &jobs.DocumentExpiryJob{
+		Pb: surmai.Pb,
+	}
+
+	// run job every day
+	surmai.Pb.Cron().MustAdd("DocumentExpiryJob", "30 8 * * *", func() {
+		job.Execute()
+	})
+}
+
+func (surmai *SurmaiApp) startTelemetryJob() {
+
+	job := &jobs.TelemetryJob{
+		Pb:      surmai.Pb,
+		Version: surmai.Version,
+	}
+
+	// the job checks the opt-in itself so it can be toggled without a restart
+	surmai.Pb.Cron().MustAdd("TelemetryJob", "45 4 * * *", func() {
+		job.Execute()
+	})
+}
+
 func (surmai *SurmaiApp) startInvitationCleanupJob() {
 
 	job := &jobs.CleanupInvitationsJob{
@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Namespace is a group of cache entries made by one feature, recognized by
+// the prefix of their keys. Entries of stateful namespaces hold pending work
+// rather than copies of data kept elsewhere, flushing them loses it.
+type Namespace struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Stateful    bool   `json:"stateful"`
+}
+
+// NamespaceStats is what an administrator sees of a namespace
+type NamespaceStats struct {
+	Namespace
+	Entries     int        `json:"entries"`
+	Hits        int64      `json:"hits"`
+	Misses      int64      `json:"misses"`
+	HitRate     float64    `json:"hitRate"`
+	LastFlushed *time.Time `json:"lastFlushed,omitempty"`
+}
+
+const otherNamespace = "other"
+
+var namespaces = []Namespace{
+	{Name: "assistant-context", Description: "Trip contexts built for the assistant"},
+	{Name: "assistant-replies", Description: "Assistant replies to repeated questions"},
+	{Name: "geocoding", Description: "Addresses and places looked up"},
+	{Name: "weather", Description: "Weather forecasts"},
+	{Name: "places", Description: "Places found near destinations"},
+	{Name: "hotels", Description: "Hotel offers and prices looked up"},
+	{Name: "routing", Description: "Travel times between places"},
+	{Name: "entry-requirements", Description: "Visa and entry requirements looked up"},
+	{Name: "gallery", Description: "Community gallery templates browsed"},
+	{Name: "flights", Description: "Flight routes looked up by number"},
+	{Name: "travel-history", Description: "Frequent routes and lodgings of each traveler"},
+	{Name: "import-reviews", Description: "Import reviews waiting for the travelers", Stateful: true},
+	{Name: "job-markers", Description: "Notifications and proposals the jobs already sent", Stateful: true},
+	{Name: "chat-bots", Description: "Chat link codes and conversations of the chat bots", Stateful: true},
+	{Name: otherNamespace, Description: "Entries of no known feature"},
+}
+
+// keyPrefixes maps the key prefixes to their namespace, longest first so
+// "flight-status-" is not taken for "flight-"
+var keyPrefixes = []struct {
+	prefix    string
+	namespace string
+}{
+	{"flight-status-", "job-markers"},
+	{"entry-requirements-", "entry-requirements"},
+	{"travel-history-", "travel-history"},
+	{"import-reviews-", "import-reviews"},
+	{"openrouteservice-", "routing"},
+	{"opentripmap-", "places"},
+	{"overpass-", "places"},
+	{"amadeus-", "hotels"},
+	{"booking-", "hotels"},
+	{"geocode-", "geocoding"},
+	{"gallery-", "gallery"},
+	{"chatbot-", "chat-bots"},
+	{"weather-", "weather"},
+	{"flight-", "flights"},
+	{"osrm-", "routing"},
+}
+
+var stats = struct {
+	sync.Mutex
+	hits    map[string]int64
+	misses  map[string]int64
+	flushed map[string]time.Time
+}{
+	hits:    map[string]int64{},
+	misses:  map[string]int64{},
+	flushed: map[string]time.Time{},
+}
+
+// namespaceOf finds the namespace of a key. Trip keys are
+// trip-<id>-<feature>-..., see TripKey.
+func namespaceOf(key string) string {
+	if rest, ok := strings.CutPrefix(key, "trip-"); ok {
+		if _, feature, found := strings.Cut(rest, "-"); found {
+			switch {
+			case strings.HasPrefix(feature, "assistant-context"):
+				return "assistant-context"
+			case strings.HasPrefix(feature, "assistant"):
+				return "assistant-replies"
+			}
+		}
+		return otherNamespace
+	}
+	for _, p := range keyPrefixes {
+		if strings.HasPrefix(key, p.prefix) {
+			return p.namespace
+		}
+	}
+	return otherNamespace
+}
+
+func record(key string, hit bool) {
+	namespace := namespaceOf(key)
+	stats.Lock()
+	defer stats.Unlock()
+	if hit {
+		stats.hits[namespace]++
+	} else {
+		stats.misses[namespace]++
+	}
+}
+
+// IsNamespace reports whether the name is a known namespace
+func IsNamespace(name string) bool {
+	for _, namespace := range namespaces {
+		if namespace.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats counts the entries of each namespace and how often they were found
+// since the server started
+func Stats() []NamespaceStats {
+	entries := map[string]int{}
+	for key := range localCache.Items() {
+		entries[namespaceOf(key)]++
+	}
+
+	stats.Lock()
+	defer stats.Unlock()
+
+	result := make([]NamespaceStats, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		s := NamespaceStats{
+			Namespace: namespace,
+			Entries:   entries[namespace.Name],
+			Hits:      stats.hits[namespace.Name],
+			Misses:    stats.misses[namespace.Name],
+		}
+		if lookups := s.Hits + s.Misses; lookups > 0 {
+			s.HitRate = float64(s.Hits) / float64(lookups)
+		}
+		if flushed, ok := stats.flushed[namespace.Name]; ok {
+			s.LastFlushed = &flushed
+		}
+		result = append(result, s)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Entries > result[j].Entries
+	})
+	return result
+}
+
+// Flush drops the entries of the namespaces and returns how many were
+// dropped. Without names every namespace but the stateful ones is flushed.
+func Flush(names ...string) int {
+	flushing := map[string]bool{}
+	if len(names) == 0 {
+		for _, namespace := range namespaces {
+			flushing[namespace.Name] = !namespace.Stateful
+		}
+	}
+	for _, name := range names {
+		flushing[name] = true
+	}
+
+	dropped := 0
+	for key := range localCache.Items() {
+		if flushing[namespaceOf(key)] {
+			localCache.Delete(key)
+			dropped++
+		}
+	}
+
+	now := time.Now().UTC()
+	stats.Lock()
+	defer stats.Unlock()
+	for name, flushed := range flushing {
+		if flushed {
+			stats.flushed[name] = now
+		}
+	}
+	return dropped
+}
@@ -1,7 +1,9 @@
 package cache
 
 import (
+	"fmt"
 	"github.com/patrickmn/go-cache"
+	"strings"
 	"time"
 )
 
@@ -16,5 +18,29 @@ func Set(key string, value interface{}, expiration time.Duration) {
 }
 
 func Get(key string) (interface{}, bool) {
-	return localCache.Get(key)
+	value, found := localCache.Get(key)
+	record(key, found)
+	return value, found
+}
+
+func Delete(key string) {
+	localCache.Delete(key)
+}
+
+func DeletePrefix(prefix string) {
+	for key := range localCache.Items() {
+		if strings.HasPrefix(key, prefix) {
+			localCache.Delete(key)
+		}
+	}
+}
+
+// TripKey builds a key scoped to a trip so that all entries derived from
+// the trip data can be dropped together with InvalidateTrip
+func TripKey(tripId string, parts ...string) string {
+	return fmt.Sprintf("trip-%s-%s", tripId, strings.Join(parts, "-"))
+}
+
+func InvalidateTrip(tripId string) {
+	DeletePrefix(fmt.Sprintf("trip-%s-", tripId))
 }
@@ -0,0 +1,89 @@
+package chatbots
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	PlatformTelegram = "telegram"
+	PlatformDiscord  = "discord"
+)
+
+// ErrUnauthorized is returned for requests that do not come from the
+// platform
+var ErrUnauthorized = errors.New("the request is not signed by the platform")
+
+const sendTimeout = 10 * time.Second
+
+var client = &http.Client{Timeout: sendTimeout}
+
+// Update is a message sent to the bot or a button pressed under one of its
+// messages, the same for every platform
+type Update struct {
+	ChatId    string
+	ChatTitle string
+	// Private is a conversation of one person with the bot
+	Private bool
+	// Mentioned is set when the message is addressed to the bot in a group,
+	// by a mention or a reply to it
+	Mentioned  bool
+	SenderId   string
+	SenderName string
+	Text       string
+
+	// set when a button was pressed, Data is what the button carries
+	CallbackId string
+	Data       string
+	MessageId  string
+
+	// token of a Discord interaction, replies are sent with it
+	InteractionToken string
+}
+
+// Command splits a message like "/link ABC" into the command, without the
+// @name of the bot Telegram adds in groups, and its argument
+func (u *Update) Command() (string, string) {
+	text := strings.TrimSpace(u.Text)
+	if !strings.HasPrefix(text, "/") {
+		return "", text
+	}
+	command, argument, _ := strings.Cut(text, " ")
+	command, _, _ = strings.Cut(command, "@")
+	return strings.ToLower(strings.TrimPrefix(command, "/")), strings.TrimSpace(argument)
+}
+
+// Button is shown under a reply, pressing it sends its data back
+type Button struct {
+	Label string
+	Data  string
+	// Danger styles the button as destructive where the platform can
+	Danger bool
+}
+
+// Reply is what the bot posts, the buttons are laid out in rows
+type Reply struct {
+	Text    string
+	Buttons [][]Button
+}
+
+// Platform is where the bot chats
+type Platform interface {
+	Name() string
+	// Reply posts the reply to the chat of the update
+	Reply(update *Update, reply Reply) error
+	// Acknowledge answers a pressed button. Clearing removes the buttons of
+	// its message, so a decision is only made once.
+	Acknowledge(update *Update, clear bool) error
+}
+
+// truncate keeps the text within the length a platform accepts
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
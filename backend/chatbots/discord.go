@@ -0,0 +1,251 @@
+package chatbots
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Discord talks to Discord through interactions: slash commands and button
+// presses are posted to the interactions endpoint, signed with the public
+// key of the application, and answered through the interaction token.
+type Discord struct {
+	ApplicationId string
+	PublicKey     ed25519.PublicKey
+	BotToken      string
+	// BaseURL of the API, https://discord.com/api/v10 by default
+	BaseURL string
+}
+
+const discordMaxText = 2000
+
+const (
+	discordPing             = 1
+	discordApplicationCmd   = 2
+	discordMessageComponent = 3
+)
+
+// DiscordFromEnv configures the bot from SURMAI_DISCORD_APPLICATION_ID,
+// SURMAI_DISCORD_PUBLIC_KEY and SURMAI_DISCORD_BOT_TOKEN, it is nil when one
+// of them is missing
+func DiscordFromEnv() (*Discord, error) {
+	applicationId := strings.TrimSpace(os.Getenv("SURMAI_DISCORD_APPLICATION_ID"))
+	publicKey := strings.TrimSpace(os.Getenv("SURMAI_DISCORD_PUBLIC_KEY"))
+	botToken := strings.TrimSpace(os.Getenv("SURMAI_DISCORD_BOT_TOKEN"))
+	if applicationId == "" || publicKey == "" || botToken == "" {
+		return nil, nil
+	}
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("SURMAI_DISCORD_PUBLIC_KEY is not a hex encoded ed25519 key")
+	}
+	return &Discord{
+		ApplicationId: applicationId,
+		PublicKey:     key,
+		BotToken:      botToken,
+		BaseURL:       "https://discord.com/api/v10",
+	}, nil
+}
+
+func (d *Discord) Name() string {
+	return PlatformDiscord
+}
+
+type discordUser struct {
+	Id         string `json:"id"`
+	Username   string `json:"username"`
+	GlobalName string `json:"global_name"`
+}
+
+type discordInteraction struct {
+	Type      int    `json:"type"`
+	Token     string `json:"token"`
+	ChannelId string `json:"channel_id"`
+	GuildId   string `json:"guild_id"`
+	Channel   *struct {
+		Name string `json:"name"`
+	} `json:"channel"`
+	Member *struct {
+		User discordUser `json:"user"`
+	} `json:"member"`
+	User *discordUser `json:"user"`
+	Data struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string          `json:"name"`
+			Value json.RawMessage `json:"value"`
+		} `json:"options"`
+		CustomId string `json:"custom_id"`
+	} `json:"data"`
+	Message *struct {
+		Id string `json:"id"`
+	} `json:"message"`
+}
+
+// ParseInteraction verifies and reads an interaction. It returns the update
+// to handle, nil for a ping, and the response Discord expects right away:
+// later replies go out as follow ups.
+func (d *Discord) ParseInteraction(r *http.Request) (*Update, map[string]interface{}, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+	signature, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return nil, nil, ErrUnauthorized
+	}
+	message := append([]byte(r.Header.Get("X-Signature-Timestamp")), body...)
+	if !ed25519.Verify(d.PublicKey, message, signature) {
+		return nil, nil, ErrUnauthorized
+	}
+
+	var raw discordInteraction
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, nil, err
+	}
+
+	if raw.Type == discordPing {
+		return nil, map[string]interface{}{"type": 1}, nil
+	}
+
+	update := &Update{
+		ChatId:           raw.ChannelId,
+		Private:          raw.GuildId == "",
+		InteractionToken: raw.Token,
+	}
+	if raw.Channel != nil {
+		update.ChatTitle = raw.Channel.Name
+	}
+	sender := raw.User
+	if raw.Member != nil {
+		sender = &raw.Member.User
+	}
+	if sender == nil {
+		return nil, nil, fmt.Errorf("interaction without a user")
+	}
+	update.SenderId = sender.Id
+	update.SenderName = sender.GlobalName
+	if update.SenderName == "" {
+		update.SenderName = sender.Username
+	}
+
+	switch raw.Type {
+	case discordApplicationCmd:
+		// slash commands become the same text a Telegram command is
+		text := "/" + raw.Data.Name
+		for _, option := range raw.Data.Options {
+			var value string
+			if err := json.Unmarshal(option.Value, &value); err == nil {
+				text += " " + value
+			}
+		}
+		update.Text = text
+		update.Mentioned = true
+		// answered with "thinking…" until the follow up is posted
+		return update, map[string]interface{}{"type": 5}, nil
+	case discordMessageComponent:
+		update.CallbackId = raw.Token
+		update.Data = raw.Data.CustomId
+		if raw.Message != nil {
+			update.MessageId = raw.Message.Id
+		}
+		return update, map[string]interface{}{"type": 6}, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported interaction type %d", raw.Type)
+}
+
+func (d *Discord) Reply(update *Update, reply Reply) error {
+	payload := map[string]interface{}{
+		"content":          truncate(reply.Text, discordMaxText),
+		"allowed_mentions": map[string]interface{}{"parse": []string{}},
+	}
+	if len(reply.Buttons) > 0 {
+		rows := make([]map[string]interface{}, 0, len(reply.Buttons))
+		for _, row := range reply.Buttons {
+			buttons := make([]map[string]interface{}, 0, len(row))
+			for _, button := range row {
+				style := 1
+				if button.Danger {
+					style = 4
+				}
+				buttons = append(buttons, map[string]interface{}{
+					"type":      2,
+					"style":     style,
+					"label":     button.Label,
+					"custom_id": button.Data,
+				})
+			}
+			rows = append(rows, map[string]interface{}{"type": 1, "components": buttons})
+		}
+		payload["components"] = rows
+	}
+	return d.call(http.MethodPost, fmt.Sprintf("/webhooks/%s/%s", d.ApplicationId, update.InteractionToken), payload)
+}
+
+// Acknowledge only clears the buttons, the press was answered when the
+// interaction arrived
+func (d *Discord) Acknowledge(update *Update, clear bool) error {
+	if !clear {
+		return nil
+	}
+	return d.call(http.MethodPatch, fmt.Sprintf("/webhooks/%s/%s/messages/@original", d.ApplicationId, update.CallbackId),
+		map[string]interface{}{"components": []interface{}{}})
+}
+
+// Setup registers the slash commands of the bot
+func (d *Discord) Setup() error {
+	commands := []map[string]interface{}{
+		{"name": "link", "description": "Link this channel to a trip", "options": []map[string]interface{}{
+			{"type": 3, "name": "code", "description": "The code the trip shows", "required": true},
+		}},
+		{"name": "ask", "description": "Ask the trip assistant", "options": []map[string]interface{}{
+			{"type": 3, "name": "question", "description": "What to ask", "required": true},
+		}},
+		{"name": "pending", "description": "List the changes awaiting approval"},
+		{"name": "unlink", "description": "Unlink this channel from its trip"},
+	}
+	body, err := json.Marshal(commands)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/applications/%s/commands", strings.TrimSuffix(d.BaseURL, "/"), d.ApplicationId), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bot "+d.BotToken)
+	return d.do(req)
+}
+
+func (d *Discord) call(method string, path string, payload map[string]interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(d.BaseURL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return d.do(req)
+}
+
+func (d *Discord) do(req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		// the URL holds the interaction token, keep it out of the logs
+		return fmt.Errorf("discord %s failed", req.Method)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 500))
+		return fmt.Errorf("discord answered %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
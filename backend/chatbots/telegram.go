@@ -0,0 +1,217 @@
+package chatbots
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Telegram talks to the Telegram Bot API. Updates arrive on a webhook that
+// Telegram signs with the secret token given when the webhook was set.
+type Telegram struct {
+	Token string
+	// Secret is sent by Telegram with every update
+	Secret string
+	// Username of the bot, mentions of it address the bot in groups
+	Username string
+	// BaseURL of the Bot API, https://api.telegram.org by default
+	BaseURL string
+}
+
+const telegramMaxText = 4096
+
+// TelegramFromEnv configures the bot from SURMAI_TELEGRAM_BOT_TOKEN, it is
+// nil when no token is set. SURMAI_TELEGRAM_WEBHOOK_SECRET sets the secret
+// of the webhook, one derived from the token is used otherwise.
+func TelegramFromEnv() *Telegram {
+	token := strings.TrimSpace(os.Getenv("SURMAI_TELEGRAM_BOT_TOKEN"))
+	if token == "" {
+		return nil
+	}
+	secret := strings.TrimSpace(os.Getenv("SURMAI_TELEGRAM_WEBHOOK_SECRET"))
+	if secret == "" {
+		mac := hmac.New(sha256.New, []byte(token))
+		mac.Write([]byte("surmai-telegram-webhook"))
+		secret = hex.EncodeToString(mac.Sum(nil))
+	}
+	return &Telegram{Token: token, Secret: secret, BaseURL: "https://api.telegram.org"}
+}
+
+func (t *Telegram) Name() string {
+	return PlatformTelegram
+}
+
+type telegramUser struct {
+	Id        int64  `json:"id"`
+	IsBot     bool   `json:"is_bot"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username"`
+}
+
+func (u telegramUser) name() string {
+	if name := strings.TrimSpace(u.FirstName + " " + u.LastName); name != "" {
+		return name
+	}
+	return u.Username
+}
+
+type telegramChat struct {
+	Id    int64  `json:"id"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+}
+
+type telegramMessage struct {
+	MessageId      int64            `json:"message_id"`
+	From           *telegramUser    `json:"from"`
+	Chat           telegramChat     `json:"chat"`
+	Text           string           `json:"text"`
+	ReplyToMessage *telegramMessage `json:"reply_to_message"`
+}
+
+type telegramUpdate struct {
+	Message       *telegramMessage `json:"message"`
+	CallbackQuery *struct {
+		Id      string           `json:"id"`
+		From    telegramUser     `json:"from"`
+		Message *telegramMessage `json:"message"`
+		Data    string           `json:"data"`
+	} `json:"callback_query"`
+}
+
+// ParseUpdate reads an update posted to the webhook. Updates the bot does
+// not handle, like edits or members joining, give nil.
+func (t *Telegram) ParseUpdate(r *http.Request) (*Update, error) {
+	provided := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(t.Secret)) != 1 {
+		return nil, ErrUnauthorized
+	}
+
+	var raw telegramUpdate
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	if callback := raw.CallbackQuery; callback != nil && callback.Message != nil {
+		return &Update{
+			ChatId:     strconv.FormatInt(callback.Message.Chat.Id, 10),
+			ChatTitle:  callback.Message.Chat.Title,
+			Private:    callback.Message.Chat.Type == "private",
+			SenderId:   strconv.FormatInt(callback.From.Id, 10),
+			SenderName: callback.From.name(),
+			CallbackId: callback.Id,
+			Data:       callback.Data,
+			MessageId:  strconv.FormatInt(callback.Message.MessageId, 10),
+		}, nil
+	}
+
+	message := raw.Message
+	if message == nil || message.From == nil || message.Text == "" {
+		return nil, nil
+	}
+	update := &Update{
+		ChatId:     strconv.FormatInt(message.Chat.Id, 10),
+		ChatTitle:  message.Chat.Title,
+		Private:    message.Chat.Type == "private",
+		SenderId:   strconv.FormatInt(message.From.Id, 10),
+		SenderName: message.From.name(),
+		Text:       message.Text,
+		MessageId:  strconv.FormatInt(message.MessageId, 10),
+	}
+	if t.Username != "" {
+		mention := "@" + t.Username
+		if strings.Contains(strings.ToLower(update.Text), strings.ToLower(mention)) && !strings.HasPrefix(update.Text, "/") {
+			update.Mentioned = true
+			update.Text = strings.TrimSpace(strings.ReplaceAll(update.Text, mention, ""))
+		}
+		if reply := message.ReplyToMessage; reply != nil && reply.From != nil && reply.From.IsBot && strings.EqualFold(reply.From.Username, t.Username) {
+			update.Mentioned = true
+		}
+	}
+	return update, nil
+}
+
+func (t *Telegram) Reply(update *Update, reply Reply) error {
+	payload := map[string]interface{}{
+		"chat_id": update.ChatId,
+		"text":    truncate(reply.Text, telegramMaxText),
+	}
+	if len(reply.Buttons) > 0 {
+		keyboard := make([][]map[string]string, 0, len(reply.Buttons))
+		for _, row := range reply.Buttons {
+			buttons := make([]map[string]string, 0, len(row))
+			for _, button := range row {
+				buttons = append(buttons, map[string]string{"text": button.Label, "callback_data": button.Data})
+			}
+			keyboard = append(keyboard, buttons)
+		}
+		payload["reply_markup"] = map[string]interface{}{"inline_keyboard": keyboard}
+	}
+	return t.call("sendMessage", payload, nil)
+}
+
+func (t *Telegram) Acknowledge(update *Update, clear bool) error {
+	if err := t.call("answerCallbackQuery", map[string]interface{}{"callback_query_id": update.CallbackId}, nil); err != nil || !clear {
+		return err
+	}
+	return t.call("editMessageReplyMarkup", map[string]interface{}{
+		"chat_id":      update.ChatId,
+		"message_id":   update.MessageId,
+		"reply_markup": map[string]interface{}{"inline_keyboard": [][]interface{}{}},
+	}, nil)
+}
+
+// Setup reads the username of the bot and points its webhook at the URL
+func (t *Telegram) Setup(webhookURL string) error {
+	var me telegramUser
+	if err := t.call("getMe", map[string]interface{}{}, &me); err != nil {
+		return err
+	}
+	t.Username = me.Username
+
+	return t.call("setWebhook", map[string]interface{}{
+		"url":             webhookURL,
+		"secret_token":    t.Secret,
+		"allowed_updates": []string{"message", "callback_query"},
+	}, nil)
+}
+
+// call posts to a method of the Bot API and reads its result into result
+func (t *Telegram) call(method string, payload map[string]interface{}, result interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/bot%s/%s", strings.TrimSuffix(t.BaseURL, "/"), t.Token, method)
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// the URL holds the token, keep it out of the logs
+		return fmt.Errorf("telegram %s failed", method)
+	}
+	defer resp.Body.Close()
+
+	var answer struct {
+		Ok          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return fmt.Errorf("telegram %s answered %s", method, resp.Status)
+	}
+	if !answer.Ok {
+		return fmt.Errorf("telegram %s: %s", method, answer.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(answer.Result, result)
+	}
+	return nil
+}
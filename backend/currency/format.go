@@ -0,0 +1,132 @@
+package currency
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// style is how amounts of a currency are usually written
+type style struct {
+	Symbol      string
+	Decimals    int
+	SymbolFirst bool
+	Space       bool
+	Thousands   string
+	Decimal     string
+}
+
+// currencies without an entry are written as "1,234.50 XYZ"
+var styles = map[string]style{
+	"USD": {Symbol: "$", Decimals: 2, SymbolFirst: true, Thousands: ",", Decimal: "."},
+	"CAD": {Symbol: "CA$", Decimals: 2, SymbolFirst: true, Thousands: ",", Decimal: "."},
+	"AUD": {Symbol: "A$", Decimals: 2, SymbolFirst: true, Thousands: ",", Decimal: "."},
+	"NZD": {Symbol: "NZ$", Decimals: 2, SymbolFirst: true, Thousands: ",", Decimal: "."},
+	"SGD": {Symbol: "S$", Decimals: 2, SymbolFirst: true, Thousands: ",", Decimal: "."},
+	"HKD": {Symbol: "HK$", Decimals: 2, SymbolFirst: true, Thousands: ",", Decimal: "."},
+	"MXN": {Symbol: "MX$", Decimals: 2, SymbolFirst: true, Thousands: ",", Decimal: "."},
+	"GBP": {Symbol: "£", Decimals: 2, SymbolFirst: true, Thousands: ",", Decimal: "."},
+	"INR": {Symbol: "₹", Decimals: 2, SymbolFirst: true, Thousands: ",", Decimal: "."},
+	"CNY": {Symbol: "CN¥", Decimals: 2, SymbolFirst: true, Thousands: ",", Decimal: "."},
+	"THB": {Symbol: "฿", Decimals: 2, SymbolFirst: true, Thousands: ",", Decimal: "."},
+	"ILS": {Symbol: "₪", Decimals: 2, SymbolFirst: true, Thousands: ",", Decimal: "."},
+	"PHP": {Symbol: "₱", Decimals: 2, SymbolFirst: true, Thousands: ",", Decimal: "."},
+	"JPY": {Symbol: "¥", Decimals: 0, SymbolFirst: true, Thousands: ",", Decimal: "."},
+	"KRW": {Symbol: "₩", Decimals: 0, SymbolFirst: true, Thousands: ",", Decimal: "."},
+	"TWD": {Symbol: "NT$", Decimals: 0, SymbolFirst: true, Thousands: ",", Decimal: "."},
+	"CHF": {Symbol: "CHF", Decimals: 2, SymbolFirst: true, Space: true, Thousands: "'", Decimal: "."},
+	"EUR": {Symbol: "€", Decimals: 2, Space: true, Thousands: ".", Decimal: ","},
+	"BRL": {Symbol: "R$", Decimals: 2, SymbolFirst: true, Space: true, Thousands: ".", Decimal: ","},
+	"TRY": {Symbol: "₺", Decimals: 2, SymbolFirst: true, Thousands: ".", Decimal: ","},
+	"IDR": {Symbol: "Rp", Decimals: 0, SymbolFirst: true, Space: true, Thousands: ".", Decimal: ","},
+	"VND": {Symbol: "₫", Decimals: 0, Space: true, Thousands: ".", Decimal: ","},
+	"CLP": {Symbol: "CLP$", Decimals: 0, SymbolFirst: true, Thousands: ".", Decimal: ","},
+	"COP": {Symbol: "COL$", Decimals: 0, SymbolFirst: true, Thousands: ".", Decimal: ","},
+	"SEK": {Symbol: "kr", Decimals: 2, Space: true, Thousands: " ", Decimal: ","},
+	"NOK": {Symbol: "kr", Decimals: 2, Space: true, Thousands: " ", Decimal: ","},
+	"DKK": {Symbol: "kr.", Decimals: 2, Space: true, Thousands: ".", Decimal: ","},
+	"ISK": {Symbol: "kr", Decimals: 0, Space: true, Thousands: ".", Decimal: ","},
+	"PLN": {Symbol: "zł", Decimals: 2, Space: true, Thousands: " ", Decimal: ","},
+	"CZK": {Symbol: "Kč", Decimals: 2, Space: true, Thousands: " ", Decimal: ","},
+	"HUF": {Symbol: "Ft", Decimals: 0, Space: true, Thousands: " ", Decimal: ","},
+	"ZAR": {Symbol: "R", Decimals: 2, SymbolFirst: true, Thousands: " ", Decimal: ","},
+	"KWD": {Symbol: "KWD", Decimals: 3, SymbolFirst: true, Space: true, Thousands: ",", Decimal: "."},
+	"BHD": {Symbol: "BHD", Decimals: 3, SymbolFirst: true, Space: true, Thousands: ",", Decimal: "."},
+	"OMR": {Symbol: "OMR", Decimals: 3, SymbolFirst: true, Space: true, Thousands: ",", Decimal: "."},
+	"JOD": {Symbol: "JOD", Decimals: 3, SymbolFirst: true, Space: true, Thousands: ",", Decimal: "."},
+}
+
+func styleOf(code string) style {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if s, ok := styles[code]; ok {
+		return s
+	}
+	return style{Symbol: code, Decimals: 2, Space: code != "", Thousands: ",", Decimal: "."}
+}
+
+// Decimals is the number of minor unit digits of the currency, 0 for yen
+// and 3 for the Gulf dinars
+func Decimals(code string) int {
+	return styleOf(code).Decimals
+}
+
+// Round rounds an amount to the minor unit of its currency
+func Round(value float64, code string) float64 {
+	scale := math.Pow10(Decimals(code))
+	return math.Round(value*scale) / scale
+}
+
+// Format writes an amount the way it is usually written in its currency,
+// e.g. $1,234.50, 1.234,50 €, ¥1,235 or 1,234.50 XYZ for unknown codes
+func Format(value float64, code string) string {
+	s := styleOf(code)
+	sign, amount := formatNumber(value, code, s)
+
+	separator := ""
+	if s.Space {
+		separator = " "
+	}
+	if s.Symbol == "" {
+		return sign + amount
+	}
+	if s.SymbolFirst {
+		return sign + s.Symbol + separator + amount
+	}
+	return sign + amount + separator + s.Symbol
+}
+
+// FormatCode writes the amount like Format but always with the ISO code
+// after it, for output that cannot show every currency symbol
+func FormatCode(value float64, code string) string {
+	sign, amount := formatNumber(value, code, styleOf(code))
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return sign + amount
+	}
+	return sign + amount + " " + code
+}
+
+func formatNumber(value float64, code string, s style) (string, string) {
+	sign := ""
+	rounded := Round(value, code)
+	if rounded < 0 {
+		sign = "-"
+		rounded = -rounded
+	}
+
+	digits := strconv.FormatFloat(rounded, 'f', s.Decimals, 64)
+	whole, fraction, _ := strings.Cut(digits, ".")
+
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteString(s.Thousands)
+		}
+		grouped.WriteRune(digit)
+	}
+	amount := grouped.String()
+	if fraction != "" {
+		amount += s.Decimal + fraction
+	}
+	return sign, amount
+}
@@ -0,0 +1,44 @@
+package currency
+
+import (
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// SaveHistory keeps the rates of the day, once per day, so that amounts can
+// later be converted at the rate of the day they were paid
+func SaveHistory(app core.App, rates map[string]float64, day time.Time) error {
+	date := day.UTC().Format(time.DateOnly)
+	record, err := app.FindFirstRecordByData("currency_rate_history", "date", date)
+	if err != nil {
+		collection, err := app.FindCollectionByNameOrId("currency_rate_history")
+		if err != nil {
+			return err
+		}
+		record = core.NewRecord(collection)
+		record.Set("date", date)
+	}
+	record.Set("rates", rates)
+	return app.Save(record)
+}
+
+// RatesOn returns the rates of the given day and the date they are from: the
+// last snapshot on or before the day, the first one kept for days before
+// the history starts and the current rates when there is no history yet
+func RatesOn(app core.App, day time.Time) (map[string]float64, string) {
+	date := day.UTC().Format(time.DateOnly)
+
+	records, err := app.FindRecordsByFilter("currency_rate_history", "date <= {:date}", "-date", 1, 0, dbx.Params{"date": date})
+	if err != nil || len(records) == 0 {
+		records, err = app.FindRecordsByFilter("currency_rate_history", "", "date", 1, 0)
+	}
+	if err == nil && len(records) > 0 {
+		rates := map[string]float64{}
+		if err := records[0].UnmarshalJSONField("rates", &rates); err == nil && len(rates) > 0 {
+			return rates, records[0].GetString("date")
+		}
+	}
+	return LoadRates(app), time.Now().UTC().Format(time.DateOnly)
+}
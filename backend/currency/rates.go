@@ -0,0 +1,30 @@
+package currency
+
+import "github.com/pocketbase/pocketbase/core"
+
+// LoadRates returns the conversion rates kept up to date by
+// SyncCurrencyDataJob, as units of each currency per USD
+func LoadRates(app core.App) map[string]float64 {
+	rates := map[string]float64{}
+	records, err := app.FindAllRecords("currency_conversions")
+	if err != nil {
+		return rates
+	}
+	for _, record := range records {
+		rates[record.GetString("currencyCode")] = record.GetFloat("conversionRate")
+	}
+	return rates
+}
+
+// Convert changes an amount from one currency to another through USD
+func Convert(value float64, from string, to string, rates map[string]float64) (float64, bool) {
+	if from == to {
+		return value, true
+	}
+	fromRate, fromOk := rates[from]
+	toRate, toOk := rates[to]
+	if !fromOk || !toOk || fromRate == 0 {
+		return 0, false
+	}
+	return value / fromRate * toRate, true
+}
@@ -0,0 +1,243 @@
+package datasets
+
+import (
+	bt "backend/types"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/ringsaturn/tzf"
+)
+
+// The airport and airline lookups read the bundled datasets once, on first
+// use, and keep them in memory. They do not need the datasets to be loaded
+// into the airports and airlines collections.
+
+var lookups struct {
+	app      core.App
+	finder   tzf.F
+	once     sync.Once
+	airports []*bt.AirportDetails
+	// folded name and municipality of each airport, see lookupKey
+	airportKeys [][2]string
+	byCode      map[string]*bt.AirportDetails
+	airlines    []*bt.AirlineDetails
+}
+
+// airport sizes, larger airports come first among equal matches
+var airportSizes = map[string]string{
+	"large_airport":  "large",
+	"medium_airport": "medium",
+	"seaplane_base":  "seaplane",
+}
+
+var airportSizeRank = map[string]int{"large": 0, "medium": 1, "seaplane": 2}
+
+type airportLookupEntry struct {
+	AirportDatasetEntry
+	Type         string `json:"type"`
+	Ident        string `json:"ident"`
+	GpsCode      string `json:"gps_code"`
+	Municipality string `json:"municipality"`
+}
+
+type airlineLookupEntry struct {
+	AirlineDatasetEntry
+	LowCost string `json:"lcc"`
+}
+
+// InitLookups sets the finder used for the timezones of airports and the app
+// whose logger reports datasets that could not be read
+func InitLookups(app core.App, finder tzf.F) {
+	lookups.app = app
+	lookups.finder = finder
+}
+
+func loadLookups() {
+	lookups.once.Do(func() {
+		lookups.byCode = map[string]*bt.AirportDetails{}
+
+		l := slog.Default()
+		if lookups.app != nil {
+			l = lookups.app.Logger()
+		}
+		l = l.WithGroup("Lookups")
+
+		var airports []airportLookupEntry
+		if content, err := os.ReadFile("./datasets/airports.json"); err != nil {
+			l.Error("Could not read the airports dataset", "error", err)
+		} else if err := json.Unmarshal(content, &airports); err != nil {
+			l.Error("Could not parse the airports dataset", "error", err)
+		}
+
+		for _, entry := range airports {
+			airport := &bt.AirportDetails{
+				Name:         entry.Name,
+				IataCode:     strings.ToUpper(entry.IataCode),
+				IcaoCode:     icaoCode(entry.GpsCode, entry.Ident),
+				Municipality: entry.Municipality,
+				IsoCountry:   entry.IsoCountry,
+				Size:         airportSizes[entry.Type],
+			}
+			if airport.IataCode == "" && airport.IcaoCode == "" {
+				continue
+			}
+			airport.Latitude, _ = strconv.ParseFloat(entry.Latitude, 64)
+			airport.Longitude, _ = strconv.ParseFloat(entry.Longitude, 64)
+			if lookups.finder != nil && (airport.Latitude != 0 || airport.Longitude != 0) {
+				airport.Timezone = lookups.finder.GetTimezoneName(airport.Longitude, airport.Latitude)
+			}
+
+			lookups.airports = append(lookups.airports, airport)
+			lookups.airportKeys = append(lookups.airportKeys, [2]string{lookupKey(airport.Name), lookupKey(airport.Municipality)})
+			for _, code := range []string{airport.IataCode, airport.IcaoCode} {
+				if existing, found := lookups.byCode[code]; code != "" && (!found || airportSizeRank[airport.Size] < airportSizeRank[existing.Size]) {
+					lookups.byCode[code] = airport
+				}
+			}
+		}
+
+		var airlines []airlineLookupEntry
+		if content, err := os.ReadFile("./datasets/airlines.json"); err != nil {
+			l.Error("Could not read the airlines dataset", "error", err)
+		} else if err := json.Unmarshal(content, &airlines); err != nil {
+			l.Error("Could not parse the airlines dataset", "error", err)
+		}
+		for _, entry := range airlines {
+			lookups.airlines = append(lookups.airlines, &bt.AirlineDetails{
+				Code:    entry.Id,
+				Name:    entry.Name,
+				Logo:    entry.Logo,
+				LowCost: entry.LowCost == "1",
+			})
+		}
+	})
+}
+
+// icaoCode is the four letter code of an airport, the GPS code when it is
+// one, otherwise the identifier
+func icaoCode(codes ...string) string {
+	for _, code := range codes {
+		if len(code) == 4 && strings.IndexFunc(code, func(r rune) bool { return r < 'A' || r > 'Z' }) < 0 {
+			return code
+		}
+	}
+	return ""
+}
+
+// FindAirport returns the airport with the IATA or ICAO code
+func FindAirport(code string) (*bt.AirportDetails, bool) {
+	loadLookups()
+	airport, found := lookups.byCode[strings.ToUpper(strings.TrimSpace(code))]
+	return airport, found
+}
+
+// SearchAirports matches the query against the codes, names and cities of
+// the airports. Exact codes come first, then names and cities that start
+// with the query, then the ones that contain it.
+func SearchAirports(query string, limit int) []*bt.AirportDetails {
+	loadLookups()
+	query = lookupKey(query)
+	if query == "" {
+		return []*bt.AirportDetails{}
+	}
+
+	type match struct {
+		airport *bt.AirportDetails
+		score   int
+	}
+	matches := make([]match, 0)
+	for i, airport := range lookups.airports {
+		name, city := lookups.airportKeys[i][0], lookups.airportKeys[i][1]
+		score := 0
+		switch {
+		case strings.EqualFold(airport.IataCode, query):
+			score = 4
+		case strings.EqualFold(airport.IcaoCode, query):
+			score = 3
+		case strings.HasPrefix(name, query) || strings.HasPrefix(city, query):
+			score = 2
+		case strings.Contains(name, query) || strings.Contains(city, query):
+			score = 1
+		}
+		if score > 0 {
+			matches = append(matches, match{airport: airport, score: score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return airportSizeRank[matches[i].airport.Size] < airportSizeRank[matches[j].airport.Size]
+	})
+
+	results := make([]*bt.AirportDetails, 0, min(limit, len(matches)))
+	for _, m := range matches[:min(limit, len(matches))] {
+		results = append(results, m.airport)
+	}
+	return results
+}
+
+// FindAirline returns the airline with the code
+func FindAirline(code string) (*bt.AirlineDetails, bool) {
+	loadLookups()
+	code = strings.ToUpper(strings.TrimSpace(code))
+	for _, airline := range lookups.airlines {
+		if airline.Code == code {
+			return airline, true
+		}
+	}
+	return nil, false
+}
+
+// SearchAirlines matches the query against the codes and names of the
+// airlines, exact codes first
+func SearchAirlines(query string, limit int) []*bt.AirlineDetails {
+	loadLookups()
+	query = lookupKey(query)
+	if query == "" {
+		return []*bt.AirlineDetails{}
+	}
+
+	type match struct {
+		airline *bt.AirlineDetails
+		score   int
+	}
+	matches := make([]match, 0)
+	for _, airline := range lookups.airlines {
+		name := lookupKey(airline.Name)
+		score := 0
+		switch {
+		case strings.EqualFold(airline.Code, query):
+			score = 3
+		case strings.HasPrefix(name, query):
+			score = 2
+		case strings.Contains(name, query):
+			score = 1
+		}
+		if score > 0 {
+			matches = append(matches, match{airline: airline, score: score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	results := make([]*bt.AirlineDetails, 0, min(limit, len(matches)))
+	for _, m := range matches[:min(limit, len(matches))] {
+		results = append(results, m.airline)
+	}
+	return results
+}
+
+// lookupKey folds case and accents, "Zürich" is found as "zurich"
+func lookupKey(value string) string {
+	return strings.ToLower(AsciiName(strings.TrimSpace(value)))
+}
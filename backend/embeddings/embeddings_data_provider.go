@@ -0,0 +1,113 @@
+package embeddings
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// DataProvider turns texts into vectors whose closeness follows their
+// meaning. Model names the model the vectors come from, vectors of two
+// models cannot be compared.
+type DataProvider interface {
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+const (
+	// ChunkChars is the length a text is cut into, long enough for a
+	// snippet to make sense on its own
+	ChunkChars = 800
+	// chunkOverlap is repeated at the start of the next chunk, so that what
+	// was cut in the middle is found in one of them
+	chunkOverlap = 120
+)
+
+// Chunk cuts a text into the snippets that are embedded, at the end of a
+// paragraph, a sentence or a word when there is one near the cut
+func Chunk(text string) []string {
+	runes := []rune(strings.TrimSpace(text))
+	chunks := make([]string, 0, len(runes)/ChunkChars+1)
+	for start := 0; start < len(runes); {
+		end := min(start+ChunkChars, len(runes))
+		if end < len(runes) {
+			end = chunkEnd(runes, start, end)
+		}
+		if chunk := strings.TrimSpace(string(runes[start:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if end == len(runes) {
+			break
+		}
+		start = max(end-chunkOverlap, start+1)
+		// the overlap starts on a word
+		for start < end && !unicode.IsSpace(runes[start-1]) {
+			start++
+		}
+	}
+	return chunks
+}
+
+// chunkEnd moves the end of a chunk back to the last break in its second half
+func chunkEnd(runes []rune, start int, end int) int {
+	half := start + (end-start)/2
+	for _, isBreak := range []func(i int) bool{
+		func(i int) bool { return runes[i] == '\n' },
+		func(i int) bool { return strings.ContainsRune(".!?", runes[i-1]) && unicode.IsSpace(runes[i]) },
+		func(i int) bool { return unicode.IsSpace(runes[i]) },
+	} {
+		for i := end - 1; i > half; i-- {
+			if isBreak(i) {
+				return i
+			}
+		}
+	}
+	return end
+}
+
+// Cosine is the similarity of two vectors, from -1 to 1
+func Cosine(a []float32, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// Encode writes a vector as base64 of its little endian float32 values, a
+// quarter of the size of the JSON
+func Encode(vector []float32) string {
+	data := make([]byte, 4*len(vector))
+	for i, value := range vector {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(value))
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// Decode reads a vector written by Encode
+func Decode(value string) ([]float32, error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%4 != 0 {
+		return nil, errors.New("the vector is truncated")
+	}
+	vector := make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return vector, nil
+}
@@ -0,0 +1,108 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultURL   = "https://api.openai.com/v1/embeddings"
+	DefaultModel = "text-embedding-3-small"
+	// inputs sent in one request, well below the limits of the API
+	maxBatch = 64
+)
+
+// OpenAI embeds texts with the embeddings API of OpenAI, or of any server
+// that speaks it, such as Ollama or llama.cpp running a model next to the
+// instance. Local servers usually need no key.
+type OpenAI struct {
+	URL       string
+	APIKey    string
+	ModelName string
+}
+
+type embeddingsResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (o OpenAI) Model() string {
+	if o.ModelName == "" {
+		return DefaultModel
+	}
+	return o.ModelName
+}
+
+func (o OpenAI) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += maxBatch {
+		batch, err := o.embedBatch(ctx, texts[start:min(start+maxBatch, len(texts))])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+func (o OpenAI) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model": o.Model(),
+		"input": texts,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("the embeddings API returned %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	var response embeddingsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	if len(response.Data) != len(texts) {
+		return nil, fmt.Errorf("the embeddings API returned %d vectors for %d texts", len(response.Data), len(texts))
+	}
+	sort.Slice(response.Data, func(i, j int) bool {
+		return response.Data[i].Index < response.Data[j].Index
+	})
+	vectors := make([][]float32, 0, len(texts))
+	for _, item := range response.Data {
+		vectors = append(vectors, item.Embedding)
+	}
+	return vectors, nil
+}
+
+func (o OpenAI) url() string {
+	if o.URL == "" {
+		return DefaultURL
+	}
+	return o.URL
+}
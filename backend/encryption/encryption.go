@@ -0,0 +1,199 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// KeyFileEnv names the file holding the key of the instance. Without it
+// nothing is encrypted, what was encrypted before cannot be read.
+const KeyFileEnv = "SURMAI_ENCRYPTION_KEY_FILE"
+
+// sealed files start with the magic and the version, sealed strings with
+// the prefix, the nonce comes next in both
+var (
+	fileMagic    = []byte("SURMAIENC\x01")
+	stringPrefix = "enc:v1:"
+)
+
+var (
+	ErrNoKey  = errors.New("the data is encrypted and no encryption key is configured")
+	ErrBadKey = errors.New("the encryption key must be 32 bytes, raw, hex or base64 encoded")
+)
+
+var (
+	mu   sync.RWMutex
+	aead cipher.AEAD
+)
+
+// LoadKey reads the key of the instance from the file named by
+// SURMAI_ENCRYPTION_KEY_FILE. Files and codes saved from then on are
+// encrypted with AES-256-GCM.
+func LoadKey() error {
+	path := strings.TrimSpace(os.Getenv(KeyFileEnv))
+	if path == "" {
+		SetKey(nil)
+		return nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read the encryption key: %w", err)
+	}
+	key, err := parseKey(raw)
+	if err != nil {
+		return err
+	}
+	return SetKey(key)
+}
+
+// SetKey sets the key of the instance, nil turns encryption off
+func SetKey(key []byte) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if key == nil {
+		aead = nil
+		return nil
+	}
+	if len(key) != 32 {
+		return ErrBadKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	aead = gcm
+	return nil
+}
+
+// parseKey takes the 32 bytes of the key as they are, or hex or base64
+// encoded, as openssl rand writes them
+func parseKey(raw []byte) ([]byte, error) {
+	if len(raw) == 32 {
+		return raw, nil
+	}
+	text := strings.TrimSpace(string(raw))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, ErrBadKey
+}
+
+// Enabled reports whether the instance has a key
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return aead != nil
+}
+
+func current() cipher.AEAD {
+	mu.RLock()
+	defer mu.RUnlock()
+	return aead
+}
+
+// IsSealed tells the files encrypted by Seal from the others
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, fileMagic)
+}
+
+// Seal encrypts the content of a file. Without a key, or when it is
+// encrypted already, the content is returned as it is.
+func Seal(data []byte) ([]byte, error) {
+	gcm := current()
+	if gcm == nil || IsSealed(data) {
+		return data, nil
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := append(bytes.Clone(fileMagic), nonce...)
+	return gcm.Seal(sealed, nonce, data, fileMagic), nil
+}
+
+// Open decrypts the content of a file sealed by Seal, files saved before the
+// instance had a key are returned as they are
+func Open(data []byte) ([]byte, error) {
+	if !IsSealed(data) {
+		return data, nil
+	}
+	gcm := current()
+	if gcm == nil {
+		return nil, ErrNoKey
+	}
+	rest := data[len(fileMagic):]
+	if len(rest) < gcm.NonceSize() {
+		return nil, errors.New("the encrypted file is truncated")
+	}
+	return gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], fileMagic)
+}
+
+// IsSealedString tells the values encrypted by SealString from the others
+func IsSealedString(value string) bool {
+	return strings.HasPrefix(value, stringPrefix)
+}
+
+// SealString encrypts a short value such as a confirmation code. Empty
+// values stay empty so that a missing code still reads as missing.
+func SealString(value string) (string, error) {
+	gcm := current()
+	if gcm == nil || value == "" || IsSealedString(value) {
+		return value, nil
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), []byte(stringPrefix))
+	return stringPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenString decrypts a value sealed by SealString, values saved before the
+// instance had a key are returned as they are
+func OpenString(value string) (string, error) {
+	if !IsSealedString(value) {
+		return value, nil
+	}
+	gcm := current()
+	if gcm == nil {
+		return "", ErrNoKey
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(value[len(stringPrefix):])
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("the encrypted value is truncated")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(stringPrefix))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// RevealString is OpenString for showing a value: one that cannot be
+// decrypted reads as empty rather than as the cipher text
+func RevealString(value string) string {
+	plain, err := OpenString(value)
+	if err != nil {
+		return ""
+	}
+	return plain
+}
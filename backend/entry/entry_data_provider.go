@@ -0,0 +1,157 @@
+package entry
+
+import (
+	"sort"
+	"strings"
+)
+
+// Visa requirements, from the least to the most work for the traveler
+const (
+	VisaNotRequired = "not_required"
+	VisaOnArrival   = "on_arrival"
+	VisaElectronic  = "electronic"
+	VisaRequired    = "required"
+)
+
+var VisaKinds = []string{VisaNotRequired, VisaOnArrival, VisaElectronic, VisaRequired}
+
+// Country is a nationality or a destination, by ISO code and name as far as
+// they are known
+type Country struct {
+	Code string `json:"code,omitempty"`
+	Name string `json:"name"`
+}
+
+// Matches reports whether the value is the code or the name of the country
+func (c Country) Matches(value string) bool {
+	value = strings.TrimSpace(value)
+	return value != "" && (strings.EqualFold(value, c.Code) || strings.EqualFold(value, c.Name))
+}
+
+func (c Country) Same(other Country) bool {
+	if c.Code != "" && other.Code != "" {
+		return strings.EqualFold(c.Code, other.Code)
+	}
+	return c.Matches(other.Name)
+}
+
+// Requirement is what a traveler of a nationality needs to enter a country.
+// Nationality and destination are ISO codes or country names, a nationality
+// of * applies to every traveler without a more specific rule.
+type Requirement struct {
+	Nationality            string   `json:"nationality"`
+	Destination            string   `json:"destination"`
+	Visa                   string   `json:"visa"`
+	MaxStayDays            int      `json:"maxStayDays,omitempty"`
+	PassportValidityMonths int      `json:"passportValidityMonths,omitempty"`
+	Vaccinations           []string `json:"vaccinations,omitempty"`
+	Notes                  string   `json:"notes,omitempty"`
+	Source                 string   `json:"source,omitempty"`
+}
+
+type DataProvider interface {
+	// Requirement returns what travelers of the nationality need to enter
+	// the destination, nil when the source does not know
+	Requirement(nationality Country, destination Country) (*Requirement, error)
+}
+
+// Traveler is a participant of the trip with their nationality
+type Traveler struct {
+	Name        string
+	Nationality Country
+}
+
+// Summary is the requirement of a destination for the travelers of one
+// nationality. Requirement is nil when the source does not know it.
+type Summary struct {
+	Destination Country      `json:"destination"`
+	Nationality Country      `json:"nationality"`
+	Travelers   []string     `json:"travelers"`
+	Requirement *Requirement `json:"requirement"`
+}
+
+// ForTrip looks up the requirements of each destination for each
+// nationality of the travelers. Citizens need nothing to enter their own
+// country.
+func ForTrip(provider DataProvider, travelers []Traveler, destinations []Country) ([]Summary, error) {
+	nationalities := make([]Country, 0)
+	names := map[string][]string{}
+	for _, traveler := range travelers {
+		key := countryKey(traveler.Nationality)
+		if _, seen := names[key]; !seen {
+			nationalities = append(nationalities, traveler.Nationality)
+		}
+		names[key] = append(names[key], traveler.Name)
+	}
+
+	summaries := make([]Summary, 0)
+	seen := map[string]bool{}
+	for _, destination := range destinations {
+		if seen[countryKey(destination)] {
+			continue
+		}
+		seen[countryKey(destination)] = true
+
+		for _, nationality := range nationalities {
+			summary := Summary{Destination: destination, Nationality: nationality, Travelers: names[countryKey(nationality)]}
+			if nationality.Same(destination) {
+				summary.Requirement = &Requirement{
+					Nationality: firstNonEmpty(nationality.Code, nationality.Name),
+					Destination: firstNonEmpty(destination.Code, destination.Name),
+					Visa:        VisaNotRequired,
+					Notes:       "Citizens enter with their passport or national identity card.",
+					Source:      "citizenship",
+				}
+			} else {
+				requirement, err := provider.Requirement(nationality, destination)
+				if err != nil {
+					return nil, err
+				}
+				summary.Requirement = requirement
+			}
+			summaries = append(summaries, summary)
+		}
+	}
+
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return visaRank(summaries[i].Requirement) > visaRank(summaries[j].Requirement)
+	})
+	return summaries, nil
+}
+
+// visaRank puts the requirements needing the most work first, unknown ones
+// with them since they need checking
+func visaRank(requirement *Requirement) int {
+	if requirement == nil {
+		return len(VisaKinds)
+	}
+	for i, kind := range VisaKinds {
+		if kind == requirement.Visa {
+			return i
+		}
+	}
+	return len(VisaKinds)
+}
+
+// IsVisaKind reports whether the value is a known visa requirement
+func IsVisaKind(value string) bool {
+	for _, kind := range VisaKinds {
+		if kind == value {
+			return true
+		}
+	}
+	return false
+}
+
+func countryKey(c Country) string {
+	return strings.ToLower(firstNonEmpty(c.Code, c.Name))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
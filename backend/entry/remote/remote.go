@@ -0,0 +1,82 @@
+package remote
+
+import (
+	"backend/cache"
+	"backend/entry"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Remote asks a service for the requirements, with
+// GET <URL>?nationality=<code or name>&destination=<code or name>. It
+// answers a requirement as JSON, or 404 when it does not know.
+type Remote struct {
+	URL    string
+	ApiKey string
+}
+
+func (r Remote) Requirement(nationality entry.Country, destination entry.Country) (*entry.Requirement, error) {
+	params := url.Values{}
+	params.Set("nationality", countryParam(nationality))
+	params.Set("destination", countryParam(destination))
+
+	cacheKey := "entry-requirements-" + params.Encode()
+	if val, found := cache.Get(cacheKey); found {
+		return val.(*entry.Requirement), nil
+	}
+
+	separator := "?"
+	if strings.Contains(r.URL, "?") {
+		separator = "&"
+	}
+	req, err := http.NewRequest(http.MethodGet, r.URL+separator+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.ApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.ApiKey)
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var requirement *entry.Requirement
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+	case http.StatusOK:
+		requirement = &entry.Requirement{}
+		if err := json.NewDecoder(resp.Body).Decode(requirement); err != nil {
+			return nil, err
+		}
+		if requirement.Nationality == "" {
+			requirement.Nationality = params.Get("nationality")
+		}
+		if requirement.Destination == "" {
+			requirement.Destination = params.Get("destination")
+		}
+		if requirement.Source == "" {
+			requirement.Source = req.URL.Host
+		}
+	default:
+		return nil, fmt.Errorf("the entry requirements service returned %s", resp.Status)
+	}
+
+	cache.Set(cacheKey, requirement, 24*time.Hour)
+	return requirement, nil
+}
+
+func countryParam(c entry.Country) string {
+	if c.Code != "" {
+		return c.Code
+	}
+	return c.Name
+}
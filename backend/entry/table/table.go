@@ -0,0 +1,39 @@
+package table
+
+import (
+	"backend/entry"
+)
+
+// Table is a list of requirements kept by the administrator, in the
+// entry_requirements setting
+type Table struct {
+	Rules []entry.Requirement
+}
+
+// Requirement prefers a rule for the nationality over one for every
+// nationality
+func (t Table) Requirement(nationality entry.Country, destination entry.Country) (*entry.Requirement, error) {
+	var fallback *entry.Requirement
+	for i := range t.Rules {
+		rule := t.Rules[i]
+		if !destination.Matches(rule.Destination) {
+			continue
+		}
+		if nationality.Matches(rule.Nationality) {
+			rule.Source = firstSource(rule.Source)
+			return &rule, nil
+		}
+		if rule.Nationality == "*" && fallback == nil {
+			rule.Source = firstSource(rule.Source)
+			fallback = &rule
+		}
+	}
+	return fallback, nil
+}
+
+func firstSource(source string) string {
+	if source != "" {
+		return source
+	}
+	return "settings"
+}
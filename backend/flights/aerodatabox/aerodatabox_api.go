@@ -0,0 +1,202 @@
+package aerodatabox
+
+import (
+	"backend/flights"
+	"backend/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ringsaturn/tzf"
+)
+
+const apiHost = "aerodatabox.p.rapidapi.com"
+
+// delays shorter than this are reported as on time
+const delayThreshold = 15 * time.Minute
+
+// FlightResponse is one flight of the AeroDataBox flight status API
+type FlightResponse struct {
+	Number    string       `json:"number"`
+	Status    string       `json:"status"`
+	Departure MovementInfo `json:"departure"`
+	Arrival   MovementInfo `json:"arrival"`
+	Airline   AirlineInfo  `json:"airline"`
+}
+
+type MovementInfo struct {
+	Airport       AirportInfo `json:"airport"`
+	ScheduledTime *TimeInfo   `json:"scheduledTime"`
+	RevisedTime   *TimeInfo   `json:"revisedTime"`
+	RunwayTime    *TimeInfo   `json:"runwayTime"`
+	Terminal      string      `json:"terminal"`
+	Gate          string      `json:"gate"`
+}
+
+type TimeInfo struct {
+	Utc   string `json:"utc"`
+	Local string `json:"local"`
+}
+
+type AirportInfo struct {
+	Icao        string   `json:"icao"`
+	Iata        string   `json:"iata"`
+	Name        string   `json:"name"`
+	CountryCode string   `json:"countryCode"`
+	TimeZone    string   `json:"timeZone"`
+	Location    Location `json:"location"`
+}
+
+type Location struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type AirlineInfo struct {
+	Name string `json:"name"`
+	Iata string `json:"iata"`
+	Icao string `json:"icao"`
+}
+
+type AeroDataBox struct{}
+
+func (adb AeroDataBox) GetFlightRoute(flightNumber string, config flights.FlightInfoProviderConfig, tzf tzf.F) (*flights.FlightRoute, error) {
+	flight, err := getFlight(flightNumber, time.Now().UTC(), config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &flights.FlightRoute{
+		Origin:        airport(flight.Departure.Airport),
+		Destination:   airport(flight.Arrival.Airport),
+		Airline:       types.Airline{Name: flight.Airline.Name},
+		DepartureTime: parseTime(flight.Departure.ScheduledTime),
+		ArrivalTime:   parseTime(flight.Arrival.ScheduledTime),
+	}, nil
+}
+
+func (adb AeroDataBox) GetFlightStatus(flightNumber string, date time.Time, config flights.FlightInfoProviderConfig) (*flights.FlightStatus, error) {
+	flight, err := getFlight(flightNumber, date, config)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &flights.FlightStatus{
+		FlightNumber:        flightNumber,
+		ScheduledDeparture:  parseTime(flight.Departure.ScheduledTime),
+		Departure:           bestTime(flight.Departure),
+		ScheduledArrival:    parseTime(flight.Arrival.ScheduledTime),
+		Arrival:             bestTime(flight.Arrival),
+		DepartureGate:       flight.Departure.Gate,
+		DepartureTerminal:   flight.Departure.Terminal,
+		ArrivalGate:         flight.Arrival.Gate,
+		ArrivalTerminal:     flight.Arrival.Terminal,
+		DestinationIataCode: flight.Arrival.Airport.Iata,
+	}
+	if !status.ScheduledDeparture.IsZero() && !status.Departure.IsZero() {
+		status.DepartureDelay = int(status.Departure.Sub(status.ScheduledDeparture).Minutes())
+	}
+	if !status.ScheduledArrival.IsZero() && !status.Arrival.IsZero() {
+		status.ArrivalDelay = int(status.Arrival.Sub(status.ScheduledArrival).Minutes())
+	}
+
+	switch strings.ToLower(flight.Status) {
+	case "canceled", "canceleduncertain":
+		status.Status = flights.StatusCancelled
+	case "diverted":
+		status.Status = flights.StatusDiverted
+	case "arrived":
+		status.Status = flights.StatusLanded
+	case "departed", "enroute", "approaching":
+		status.Status = flights.StatusDeparted
+	default:
+		status.Status = flights.StatusScheduled
+		if time.Duration(status.DepartureDelay)*time.Minute >= delayThreshold || strings.EqualFold(flight.Status, "delayed") {
+			status.Status = flights.StatusDelayed
+		}
+	}
+	return status, nil
+}
+
+// getFlight reads the flight of the local departure day from the API
+func getFlight(flightNumber string, date time.Time, config flights.FlightInfoProviderConfig) (*FlightResponse, error) {
+	requestUrl := fmt.Sprintf("https://%s/flights/number/%s/%s?withAircraftImage=false&withLocation=false",
+		apiHost, url.PathEscape(flightNumber), date.Format(time.DateOnly))
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	req, err := http.NewRequest("GET", requestUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Add("X-RapidAPI-Key", config.ApiKey)
+	req.Header.Add("X-RapidAPI-Host", apiHost)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to AeroDataBox API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from AeroDataBox API: %v", err)
+	}
+	// no content is how the API says it does not know the flight
+	if resp.StatusCode == http.StatusNoContent || len(body) == 0 {
+		return nil, errors.New("no flights found for the given flight number")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("AeroDataBox API returned error: %s (status code: %d)", string(body), resp.StatusCode)
+	}
+
+	var result []FlightResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse AeroDataBox API response: %v", err)
+	}
+	if len(result) == 0 {
+		return nil, errors.New("no flights found for the given flight number")
+	}
+	return &result[0], nil
+}
+
+func airport(info AirportInfo) types.Airport {
+	return types.Airport{
+		Name:       info.Name,
+		Latitude:   fmt.Sprintf("%f", info.Location.Lat),
+		Longitude:  fmt.Sprintf("%f", info.Location.Lon),
+		Timezone:   info.TimeZone,
+		IataCode:   info.Iata,
+		IsoCountry: info.CountryCode,
+	}
+}
+
+// bestTime is the actual time of a movement once it happened, otherwise the
+// revised or the scheduled time
+func bestTime(movement MovementInfo) time.Time {
+	for _, value := range []*TimeInfo{movement.RunwayTime, movement.RevisedTime, movement.ScheduledTime} {
+		if t := parseTime(value); !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseTime reads the local time, "2025-05-01 12:05+02:00", which keeps the
+// offset of the airport
+func parseTime(value *TimeInfo) time.Time {
+	if value == nil {
+		return time.Time{}
+	}
+	if t, err := time.Parse("2006-01-02 15:04Z07:00", value.Local); err == nil {
+		return t
+	}
+	if t, err := time.Parse("2006-01-02 15:04Z07:00", value.Utc); err == nil {
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,118 @@
+package flightaware
+
+import (
+	"backend/flights"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// delays shorter than this are reported as on time
+const delayThreshold = 15 * time.Minute
+
+func (fa FlightAware) GetFlightStatus(flightNumber string, date time.Time, config flights.FlightInfoProviderConfig) (*flights.FlightStatus, error) {
+	// flights are searched a day around the date, its UTC day may differ
+	// from the local one
+	query := url.Values{}
+	query.Set("ident_type", "designator")
+	query.Set("start", date.AddDate(0, 0, -1).Format(time.DateOnly))
+	query.Set("end", date.AddDate(0, 0, 2).Format(time.DateOnly))
+	requestUrl := fmt.Sprintf("https://aeroapi.flightaware.com/aeroapi/flights/%s?%s", url.PathEscape(flightNumber), query.Encode())
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	req, err := http.NewRequest("GET", requestUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Add("x-apikey", config.ApiKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to FlightAware API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from FlightAware API: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("FlightAware API returned error: %s (status code: %d)", string(body), resp.StatusCode)
+	}
+
+	var result FlightAwareResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse FlightAware API response: %v", err)
+	}
+
+	day := date.Format(time.DateOnly)
+	for _, flight := range result.Flights {
+		departure := parseAirportTime(flight.ScheduledOut, flight.Origin.Timezone)
+		if departure.IsZero() || departure.Format(time.DateOnly) != day {
+			continue
+		}
+		return flightStatus(flightNumber, flight), nil
+	}
+	return nil, errors.New("no flights found for the given flight number and date")
+}
+
+func flightStatus(flightNumber string, flight Flight) *flights.FlightStatus {
+	status := &flights.FlightStatus{
+		FlightNumber:        flightNumber,
+		ScheduledDeparture:  parseAirportTime(flight.ScheduledOut, flight.Origin.Timezone),
+		Departure:           parseAirportTime(firstTime(flight.ActualOut, flight.EstimatedOut, flight.ScheduledOut), flight.Origin.Timezone),
+		ScheduledArrival:    parseAirportTime(flight.ScheduledIn, flight.Destination.Timezone),
+		Arrival:             parseAirportTime(firstTime(flight.ActualIn, flight.EstimatedIn, flight.ScheduledIn), flight.Destination.Timezone),
+		DepartureDelay:      flight.DepartureDelay / 60,
+		ArrivalDelay:        flight.ArrivalDelay / 60,
+		DepartureGate:       flight.GateOrigin,
+		DepartureTerminal:   flight.TerminalOrigin,
+		ArrivalGate:         flight.GateDestination,
+		ArrivalTerminal:     flight.TerminalDestination,
+		DestinationIataCode: flight.Destination.CodeIata,
+	}
+
+	switch {
+	case flight.Cancelled:
+		status.Status = flights.StatusCancelled
+	case flight.Diverted:
+		status.Status = flights.StatusDiverted
+	case flight.ActualIn != "" || flight.ActualOn != "":
+		status.Status = flights.StatusLanded
+	case flight.ActualOut != "" || flight.ActualOff != "":
+		status.Status = flights.StatusDeparted
+	case time.Duration(flight.DepartureDelay)*time.Second >= delayThreshold:
+		status.Status = flights.StatusDelayed
+	default:
+		status.Status = flights.StatusScheduled
+	}
+	return status
+}
+
+func firstTime(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// parseAirportTime reads a UTC time of the API in the timezone of the airport
+func parseAirportTime(value string, timezone string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+	if location, err := time.LoadLocation(timezone); err == nil && timezone != "" {
+		return t.In(location)
+	}
+	return t
+}
@@ -2,6 +2,8 @@ package flights
 
 import (
 	"backend/types"
+	"encoding/json"
+	"github.com/pocketbase/pocketbase/core"
 	"github.com/ringsaturn/tzf"
 	"time"
 )
@@ -23,3 +25,51 @@ type FlightInfoProviderConfig struct {
 	Provider string `json:"provider"`
 	ApiKey   string `json:"apiKey"`
 }
+
+const (
+	StatusScheduled = "scheduled"
+	StatusDelayed   = "delayed"
+	StatusDeparted  = "departed"
+	StatusLanded    = "landed"
+	StatusCancelled = "cancelled"
+	StatusDiverted  = "diverted"
+)
+
+// FlightStatus is what a provider knows about one flight on one day. The
+// times are the best known estimate, actual times once they happened, in
+// the timezone of the airport they belong to. Delays are in minutes.
+type FlightStatus struct {
+	FlightNumber        string    `json:"flightNumber"`
+	Status              string    `json:"status"`
+	ScheduledDeparture  time.Time `json:"scheduledDeparture"`
+	Departure           time.Time `json:"departure"`
+	ScheduledArrival    time.Time `json:"scheduledArrival"`
+	Arrival             time.Time `json:"arrival"`
+	DepartureDelay      int       `json:"departureDelay"`
+	ArrivalDelay        int       `json:"arrivalDelay"`
+	DepartureGate       string    `json:"departureGate,omitempty"`
+	DepartureTerminal   string    `json:"departureTerminal,omitempty"`
+	ArrivalGate         string    `json:"arrivalGate,omitempty"`
+	ArrivalTerminal     string    `json:"arrivalTerminal,omitempty"`
+	DestinationIataCode string    `json:"destinationIataCode,omitempty"`
+}
+
+// StatusProvider is implemented by the providers that track flights, date
+// is the local departure day
+type StatusProvider interface {
+	GetFlightStatus(flightNumber string, date time.Time, config FlightInfoProviderConfig) (*FlightStatus, error)
+}
+
+// LoadProviderConfig reads the flight info provider settings, ok is false
+// when they are missing or the provider is turned off
+func LoadProviderConfig(app core.App) (FlightInfoProviderConfig, bool) {
+	var config FlightInfoProviderConfig
+	record, err := app.FindRecordById("surmai_settings", "flight_info_provider")
+	if err != nil {
+		return config, false
+	}
+	if err := json.Unmarshal([]byte(record.GetString("value")), &config); err != nil {
+		return config, false
+	}
+	return config, config.Enabled
+}
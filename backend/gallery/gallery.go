@@ -0,0 +1,150 @@
+package gallery
+
+import (
+	"backend/cache"
+	bt "backend/types"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A community gallery is a service other instances publish trip templates
+// to and browse them from. It answers
+//
+//	GET  <URL>/templates?q=&page=  {"items": [Listing]}
+//	GET  <URL>/templates/<id>      Entry
+//	POST <URL>/templates           Submission, answered with the Listing
+//
+// Only templates leave the instance, see trips.CommunityTemplate.
+
+var ErrNotFound = errors.New("the template is not in the gallery")
+
+// Listing describes a template of the gallery without its plans
+type Listing struct {
+	Id              string   `json:"id"`
+	Name            string   `json:"name"`
+	Description     string   `json:"description"`
+	Days            int      `json:"days"`
+	Destinations    []string `json:"destinations"`
+	Tags            []string `json:"tags"`
+	Transportations int      `json:"transportations"`
+	Lodgings        int      `json:"lodgings"`
+	Activities      int      `json:"activities"`
+	PublishedAt     string   `json:"publishedAt,omitempty"`
+}
+
+// Entry is a template of the gallery with its plans
+type Entry struct {
+	Listing
+	Template *bt.TripTemplate `json:"template"`
+}
+
+// Submission is a template sent to the gallery
+type Submission struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Tags        []string         `json:"tags"`
+	Template    *bt.TripTemplate `json:"template"`
+}
+
+type Gallery struct {
+	URL    string
+	ApiKey string
+}
+
+func (g Gallery) Browse(query string, page int) ([]Listing, error) {
+	params := url.Values{}
+	if query = strings.TrimSpace(query); query != "" {
+		params.Set("q", query)
+	}
+	params.Set("page", strconv.Itoa(max(page, 1)))
+
+	cacheKey := "gallery-browse-" + params.Encode()
+	if val, found := cache.Get(cacheKey); found {
+		return val.([]Listing), nil
+	}
+
+	var body struct {
+		Items []Listing `json:"items"`
+	}
+	if err := g.do(http.MethodGet, "/templates?"+params.Encode(), nil, &body); err != nil {
+		return nil, err
+	}
+	if body.Items == nil {
+		body.Items = []Listing{}
+	}
+
+	cache.Set(cacheKey, body.Items, 10*time.Minute)
+	return body.Items, nil
+}
+
+func (g Gallery) Fetch(id string) (*Entry, error) {
+	cacheKey := "gallery-template-" + id
+	if val, found := cache.Get(cacheKey); found {
+		return val.(*Entry), nil
+	}
+
+	entry := &Entry{}
+	if err := g.do(http.MethodGet, "/templates/"+url.PathEscape(id), nil, entry); err != nil {
+		return nil, err
+	}
+	if entry.Template == nil {
+		return nil, fmt.Errorf("the gallery returned template %s without its plans", id)
+	}
+
+	cache.Set(cacheKey, entry, time.Hour)
+	return entry, nil
+}
+
+func (g Gallery) Publish(submission *Submission) (*Listing, error) {
+	listing := &Listing{}
+	if err := g.do(http.MethodPost, "/templates", submission, listing); err != nil {
+		return nil, err
+	}
+	return listing, nil
+}
+
+func (g Gallery) do(method string, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(g.URL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if g.ApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+g.ApiKey)
+	}
+
+	client := &http.Client{Timeout: 20 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the gallery returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
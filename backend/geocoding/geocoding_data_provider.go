@@ -0,0 +1,120 @@
+package geocoding
+
+import (
+	"backend/cache"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ringsaturn/tzf"
+)
+
+// Place is an address or named place found by a geocoding provider
+type Place struct {
+	Name        string  `json:"name"`
+	Address     string  `json:"address"`
+	City        string  `json:"city,omitempty"`
+	State       string  `json:"state,omitempty"`
+	Country     string  `json:"country,omitempty"`
+	CountryCode string  `json:"countryCode,omitempty"`
+	Category    string  `json:"category,omitempty"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Timezone    string  `json:"timezone,omitempty"`
+}
+
+type DataProvider interface {
+	Search(query string, limit int, language string) ([]Place, error)
+	Reverse(latitude float64, longitude float64, language string) (*Place, error)
+}
+
+var ErrRateLimited = errors.New("too many geocoding requests, try again shortly")
+
+// Limiter spaces the requests sent to a provider. Public Nominatim and Photon
+// servers allow about one request per second for the whole instance.
+type Limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func NewLimiter(interval time.Duration) *Limiter {
+	return &Limiter{interval: interval}
+}
+
+// Wait blocks until the next request may be sent. Rather than queue for
+// longer than maxWait it returns ErrRateLimited.
+func (l *Limiter) Wait(maxWait time.Duration) error {
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	if slot.Sub(now) > maxWait {
+		l.mu.Unlock()
+		return ErrRateLimited
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	time.Sleep(time.Until(slot))
+	return nil
+}
+
+// Geocoder resolves addresses with a provider, adds the timezone of each place
+// and caches the answers, since addresses are looked up again and again while
+// a trip is planned
+type Geocoder struct {
+	Provider DataProvider
+	Finder   tzf.F
+}
+
+const cacheDuration = 24 * time.Hour
+
+func (g *Geocoder) Search(query string, limit int, language string) ([]Place, error) {
+	query = strings.Join(strings.Fields(query), " ")
+	cacheKey := fmt.Sprintf("geocode-search-%s-%d-%s", strings.ToLower(query), limit, language)
+	if val, found := cache.Get(cacheKey); found {
+		return val.([]Place), nil
+	}
+
+	places, err := g.Provider.Search(query, limit, language)
+	if err != nil {
+		return nil, err
+	}
+	for i := range places {
+		places[i].Timezone = g.timezone(places[i])
+	}
+
+	cache.Set(cacheKey, places, cacheDuration)
+	return places, nil
+}
+
+func (g *Geocoder) Reverse(latitude float64, longitude float64, language string) (*Place, error) {
+	// about 10 meters apart is the same place
+	cacheKey := fmt.Sprintf("geocode-reverse-%.4f-%.4f-%s", latitude, longitude, language)
+	if val, found := cache.Get(cacheKey); found {
+		return val.(*Place), nil
+	}
+
+	place, err := g.Provider.Reverse(latitude, longitude, language)
+	if err != nil {
+		return nil, err
+	}
+	if place != nil {
+		place.Timezone = g.timezone(*place)
+	}
+
+	cache.Set(cacheKey, place, cacheDuration)
+	return place, nil
+}
+
+func (g *Geocoder) timezone(place Place) string {
+	if g.Finder == nil {
+		return ""
+	}
+	return g.Finder.GetTimezoneName(place.Longitude, place.Latitude)
+}
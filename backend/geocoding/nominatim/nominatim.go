@@ -0,0 +1,135 @@
+package nominatim
+
+import (
+	"backend/geocoding"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultURL = "https://nominatim.openstreetmap.org"
+
+// requests to the public server wait at most this long for their turn
+const maxWait = 5 * time.Second
+
+type result struct {
+	Lat         string            `json:"lat"`
+	Lon         string            `json:"lon"`
+	Name        string            `json:"name"`
+	DisplayName string            `json:"display_name"`
+	Category    string            `json:"category"`
+	Type        string            `json:"type"`
+	Address     map[string]string `json:"address"`
+}
+
+// Nominatim uses the OpenStreetMap search api, which needs no api key but
+// asks for an identifying user agent and at most one request per second
+type Nominatim struct {
+	URL     string
+	Limiter *geocoding.Limiter
+}
+
+func (n Nominatim) Search(query string, limit int, language string) ([]geocoding.Place, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("format", "jsonv2")
+	params.Set("addressdetails", "1")
+	params.Set("limit", strconv.Itoa(limit))
+
+	var results []result
+	if err := n.get("/search", params, language, &results); err != nil {
+		return nil, err
+	}
+
+	places := make([]geocoding.Place, 0, len(results))
+	for _, r := range results {
+		if place, ok := r.place(); ok {
+			places = append(places, place)
+		}
+	}
+	return places, nil
+}
+
+func (n Nominatim) Reverse(latitude float64, longitude float64, language string) (*geocoding.Place, error) {
+	params := url.Values{}
+	params.Set("lat", strconv.FormatFloat(latitude, 'f', 6, 64))
+	params.Set("lon", strconv.FormatFloat(longitude, 'f', 6, 64))
+	params.Set("format", "jsonv2")
+	params.Set("addressdetails", "1")
+
+	var r result
+	if err := n.get("/reverse", params, language, &r); err != nil {
+		return nil, err
+	}
+	if place, ok := r.place(); ok {
+		return &place, nil
+	}
+	return nil, nil
+}
+
+func (n Nominatim) get(path string, params url.Values, language string, target interface{}) error {
+	if n.Limiter != nil {
+		if err := n.Limiter.Wait(maxWait); err != nil {
+			return err
+		}
+	}
+
+	base := strings.TrimRight(n.URL, "/")
+	if base == "" {
+		base = DefaultURL
+	}
+	req, err := http.NewRequest(http.MethodGet, base+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "surmai")
+	if language != "" {
+		req.Header.Set("Accept-Language", language)
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("nominatim returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+func (r result) place() (geocoding.Place, bool) {
+	lat, latErr := strconv.ParseFloat(r.Lat, 64)
+	lng, lngErr := strconv.ParseFloat(r.Lon, 64)
+	if latErr != nil || lngErr != nil {
+		return geocoding.Place{}, false
+	}
+
+	city := ""
+	for _, key := range []string{"city", "town", "village", "municipality", "hamlet"} {
+		if city = r.Address[key]; city != "" {
+			break
+		}
+	}
+	name := r.Name
+	if name == "" {
+		name = strings.TrimSpace(strings.Split(r.DisplayName, ",")[0])
+	}
+	return geocoding.Place{
+		Name:        name,
+		Address:     r.DisplayName,
+		City:        city,
+		State:       r.Address["state"],
+		Country:     r.Address["country"],
+		CountryCode: strings.ToUpper(r.Address["country_code"]),
+		Category:    strings.Trim(r.Category+"/"+r.Type, "/"),
+		Latitude:    lat,
+		Longitude:   lng,
+	}, true
+}
@@ -0,0 +1,152 @@
+package photon
+
+import (
+	"backend/geocoding"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultURL = "https://photon.komoot.io"
+
+// requests wait at most this long for their turn
+const maxWait = 5 * time.Second
+
+type featureCollection struct {
+	Features []feature `json:"features"`
+}
+
+type feature struct {
+	Geometry struct {
+		Coordinates []float64 `json:"coordinates"`
+	} `json:"geometry"`
+	Properties struct {
+		Name        string `json:"name"`
+		Street      string `json:"street"`
+		HouseNumber string `json:"housenumber"`
+		Postcode    string `json:"postcode"`
+		City        string `json:"city"`
+		State       string `json:"state"`
+		Country     string `json:"country"`
+		CountryCode string `json:"countrycode"`
+		OsmKey      string `json:"osm_key"`
+		OsmValue    string `json:"osm_value"`
+	} `json:"properties"`
+}
+
+// Photon is the OpenStreetMap search engine by komoot, built for search as
+// you type. It can be self-hosted, the public server is fair use.
+type Photon struct {
+	URL     string
+	Limiter *geocoding.Limiter
+}
+
+func (p Photon) Search(query string, limit int, language string) ([]geocoding.Place, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("limit", strconv.Itoa(limit))
+
+	var data featureCollection
+	if err := p.get("/api", params, language, &data); err != nil {
+		return nil, err
+	}
+
+	places := make([]geocoding.Place, 0, len(data.Features))
+	for _, f := range data.Features {
+		if place, ok := f.place(); ok {
+			places = append(places, place)
+		}
+	}
+	return places, nil
+}
+
+func (p Photon) Reverse(latitude float64, longitude float64, language string) (*geocoding.Place, error) {
+	params := url.Values{}
+	params.Set("lat", strconv.FormatFloat(latitude, 'f', 6, 64))
+	params.Set("lon", strconv.FormatFloat(longitude, 'f', 6, 64))
+
+	var data featureCollection
+	if err := p.get("/reverse", params, language, &data); err != nil {
+		return nil, err
+	}
+	for _, f := range data.Features {
+		if place, ok := f.place(); ok {
+			return &place, nil
+		}
+	}
+	return nil, nil
+}
+
+func (p Photon) get(path string, params url.Values, language string, target interface{}) error {
+	if p.Limiter != nil {
+		if err := p.Limiter.Wait(maxWait); err != nil {
+			return err
+		}
+	}
+
+	// photon only knows a few languages and rejects the others
+	switch language = strings.ToLower(strings.SplitN(language, "-", 2)[0]); language {
+	case "en", "de", "fr":
+		params.Set("lang", language)
+	}
+
+	base := strings.TrimRight(p.URL, "/")
+	if base == "" {
+		base = DefaultURL
+	}
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(base + path + "?" + params.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("photon returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+func (f feature) place() (geocoding.Place, bool) {
+	if len(f.Geometry.Coordinates) != 2 {
+		return geocoding.Place{}, false
+	}
+	props := f.Properties
+
+	street := strings.TrimSpace(props.Street + " " + props.HouseNumber)
+	parts := make([]string, 0, 6)
+	for _, part := range []string{props.Name, street, strings.TrimSpace(props.Postcode + " " + props.City), props.State, props.Country} {
+		if part != "" && (len(parts) == 0 || parts[len(parts)-1] != part) {
+			parts = append(parts, part)
+		}
+	}
+	name := props.Name
+	if name == "" {
+		name = firstNonEmpty(street, props.City)
+	}
+
+	return geocoding.Place{
+		Name:        name,
+		Address:     strings.Join(parts, ", "),
+		City:        props.City,
+		State:       props.State,
+		Country:     props.Country,
+		CountryCode: strings.ToUpper(props.CountryCode),
+		Category:    strings.Trim(props.OsmKey+"/"+props.OsmValue, "/"),
+		Latitude:    f.Geometry.Coordinates[1],
+		Longitude:   f.Geometry.Coordinates[0],
+	}, true
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
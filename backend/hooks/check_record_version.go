@@ -0,0 +1,54 @@
+package hooks
+
+import (
+	"backend/trips"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// CheckRecordVersion refuses an update sent with an If-Match header when
+// the record changed after the version it names, so saving a form cannot
+// silently overwrite a collaborator's edit. The 409 lists the changes made
+// since next to the refused ones, with the fields that do not conflict
+// merged for the client to send again. Updates without If-Match are saved
+// as before.
+func CheckRecordVersion(e *core.RecordRequestEvent) error {
+	header := e.Request.Header.Get("If-Match")
+	if header == "" {
+		return e.Next()
+	}
+
+	stored := e.Record.Original()
+	if trips.MatchesETag(header, stored) {
+		return e.Next()
+	}
+
+	since, ok := trips.ETagVersion(header)
+	if !ok {
+		return e.BadRequestError("If-Match must be the ETag of the record or its updated time", nil)
+	}
+
+	role := ""
+	if trip, err := e.App.FindRecordById("trips", stored.GetString("trip")); err == nil && e.Auth != nil {
+		role = trips.TripRole(trip, e.Auth.Id)
+	}
+	if e.HasSuperuserAuth() {
+		role = trips.RoleOwner
+	}
+
+	conflict := trips.RecordConflict(e.App, stored, e.Record, since, role)
+	e.Response.Header().Set("ETag", conflict.ETag)
+	return e.JSON(http.StatusConflict, map[string]interface{}{
+		"error":    "the record changed after the version this update was made from",
+		"code":     "version_conflict",
+		"conflict": conflict,
+	})
+}
+
+// SetRecordETag sends the version of a record with it, for updates to name
+// in If-Match
+func SetRecordETag(e *core.RecordRequestEvent) error {
+	e.Response.Header().Set("ETag", trips.ETag(e.Record))
+	return e.Next()
+}
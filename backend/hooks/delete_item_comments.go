@@ -0,0 +1,25 @@
+package hooks
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// DeleteItemComments removes the discussion of an item with the item, the
+// comments only point at it by id
+func DeleteItemComments(e *core.RecordEvent) error {
+	comments, err := e.App.FindAllRecords("comments", dbx.HashExp{
+		"trip":       e.Record.GetString("trip"),
+		"collection": e.Record.Collection().Name,
+		"recordId":   e.Record.Id,
+	})
+	if err != nil {
+		return err
+	}
+	for _, comment := range comments {
+		if err := e.App.Delete(comment); err != nil {
+			e.App.Logger().Warn("Could not delete the comment of a deleted item", "error", err, "commentId", comment.Id)
+		}
+	}
+	return e.Next()
+}
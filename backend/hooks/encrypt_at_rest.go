@@ -0,0 +1,115 @@
+package hooks
+
+import (
+	"backend/encryption"
+	"backend/trips"
+	"bytes"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// inlineDocumentTypes are the document files shown in the browser, others
+// are downloaded
+var inlineDocumentTypes = []string{"application/pdf", "image/png", "image/jpeg", "image/gif", "image/webp"}
+
+// EncryptConfirmationCode stores the confirmation code of an item encrypted
+// when the instance has a key. The saved record keeps the code in the clear
+// for the hooks that follow.
+func EncryptConfirmationCode(e *core.RecordEvent) error {
+	code := e.Record.GetString("confirmationCode")
+	sealed, err := encryption.SealString(code)
+	if err != nil {
+		return err
+	}
+	if sealed == code {
+		return e.Next()
+	}
+
+	e.Record.Set("confirmationCode", sealed)
+	err = e.Next()
+	e.Record.Set("confirmationCode", code)
+	return err
+}
+
+// RevealConfirmationCode decrypts the confirmation code of an item before it
+// is sent, codes that cannot be decrypted are sent empty
+func RevealConfirmationCode(e *core.RecordEnrichEvent) error {
+	e.Record.Set("confirmationCode", trips.ConfirmationCode(e.Record))
+	return e.Next()
+}
+
+// EncryptDocumentFiles encrypts the files uploaded to the document vault when
+// the instance has a key. It runs after the files were checked, on what they
+// hold.
+func EncryptDocumentFiles(e *core.RecordEvent) error {
+	if !encryption.Enabled() {
+		return e.Next()
+	}
+	for _, file := range e.Record.GetUnsavedFiles("file") {
+		r, err := file.Reader.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		sealed, err := encryption.Seal(data)
+		if err != nil {
+			return err
+		}
+		file.Reader = &filesystem.BytesReader{Bytes: sealed}
+		file.Size = int64(len(sealed))
+	}
+	return e.Next()
+}
+
+// ServeDocumentFile decrypts an encrypted file of the document vault as it
+// is downloaded. Files saved without encryption are served by the file API.
+func ServeDocumentFile(e *core.FileDownloadRequestEvent) error {
+	fsys, err := e.App.NewFilesystem()
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+
+	r, err := fsys.GetReader(e.ServedPath)
+	if err != nil {
+		return e.NotFoundError("", err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+	if !encryption.IsSealed(data) {
+		return e.Next()
+	}
+	plain, err := encryption.Open(data)
+	if err != nil {
+		return e.InternalServerError("The file could not be decrypted.", err)
+	}
+
+	detected := mimetype.Detect(plain)
+	disposition := "attachment"
+	if download, _ := strconv.ParseBool(e.Request.URL.Query().Get("download")); !download && slices.ContainsFunc(inlineDocumentTypes, detected.Is) {
+		disposition = "inline"
+	}
+	header := e.Response.Header()
+	header.Set("Content-Type", detected.String())
+	header.Set("Content-Disposition", disposition+"; filename="+e.ServedName)
+	header.Set("Content-Security-Policy", "default-src 'none'; media-src 'self'; style-src 'unsafe-inline'; sandbox")
+	// decrypted copies are not kept by the browser or anything in between
+	header.Set("Cache-Control", "private, no-store")
+	header.Del("X-Frame-Options")
+	http.ServeContent(e.Response, e.Request, e.ServedName, time.Time{}, bytes.NewReader(plain))
+	return nil
+}
@@ -0,0 +1,21 @@
+package hooks
+
+import (
+	"backend/images"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/routine"
+)
+
+// GenerateThumbnails makes the thumbnails of the images of a saved record
+// ahead of the first time they are shown, in the background so the save
+// does not wait for them. Thumbnails already there are kept.
+func GenerateThumbnails(e *core.RecordEvent) error {
+	app, record := e.App, e.Record
+	routine.FireAndForget(func() {
+		if err := images.GenerateRecord(app, record); err != nil {
+			app.Logger().Warn("Could not generate the thumbnails", "error", err, "collection", record.Collection().Name, "recordId", record.Id)
+		}
+	})
+	return e.Next()
+}
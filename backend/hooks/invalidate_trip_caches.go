@@ -0,0 +1,22 @@
+package hooks
+
+import (
+	"backend/cache"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// InvalidateTripCaches drops every cached entry derived from a trip whenever
+// the trip or one of its child records changes
+func InvalidateTripCaches(e *core.RecordEvent) error {
+
+	tripId := e.Record.GetString("trip")
+	if e.Record.Collection().Name == "trips" {
+		tripId = e.Record.Id
+	}
+
+	if tripId != "" {
+		cache.InvalidateTrip(tripId)
+	}
+
+	return e.Next()
+}
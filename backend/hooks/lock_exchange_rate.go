@@ -0,0 +1,40 @@
+package hooks
+
+import (
+	"backend/currency"
+	"backend/trips"
+	bt "backend/types"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// LockExchangeRate locks the exchange rate of a trip item with a cost when
+// it is booked or an expense is logged, and again when its currency, or the
+// day an expense was paid, changes. A rate corrected by hand is kept as long
+// as the currency stays the same. The converted cost follows the amount at
+// the locked rate.
+func LockExchangeRate(e *core.RecordEvent) error {
+	if !e.Record.IsNew() {
+		original := e.Record.Original()
+		var before, after bt.Cost
+		_ = original.UnmarshalJSONField("cost", &before)
+		_ = e.Record.UnmarshalJSONField("cost", &after)
+		var locked *bt.ExchangeRate
+		_ = e.Record.UnmarshalJSONField("exchangeRate", &locked)
+
+		changed := before.Currency != after.Currency ||
+			e.Record.Collection().Name == "trip_expenses" && !original.GetDateTime("occurredOn").Equal(e.Record.GetDateTime("occurredOn"))
+		if locked != nil && (locked.Manual && locked.From == after.Currency || !changed) {
+			if converted := currency.Round(after.Value*locked.Rate, locked.To); converted != locked.Converted {
+				locked.Converted = converted
+				e.Record.Set("exchangeRate", locked)
+			}
+			return e.Next()
+		}
+	}
+
+	if err := trips.LockExchangeRate(e.App, e.Record); err != nil {
+		e.App.Logger().Warn("Could not lock the exchange rate", "error", err, "collection", e.Record.Collection().Name, "recordId", e.Record.Id)
+	}
+	return e.Next()
+}
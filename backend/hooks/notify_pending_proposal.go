@@ -0,0 +1,51 @@
+package hooks
+
+import (
+	"backend/notifications"
+	"backend/trips"
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// NotifyPendingProposal tells the members who may approve it about a change
+// the assistant proposed on its own, from a job rather than a conversation
+// where the proposal is already in front of someone
+func NotifyPendingProposal(e *core.RecordEvent) error {
+	if e.Record.GetString("requestedBy") != "" {
+		return e.Next()
+	}
+
+	trip, err := e.App.FindRecordById("trips", e.Record.GetString("trip"))
+	if err != nil {
+		e.App.Logger().Warn("Could not find the trip of the proposal", "error", err, "proposalId", e.Record.GetString("proposalId"))
+		return e.Next()
+	}
+	members, err := trips.TripMembers(e.App, trip)
+	if err != nil {
+		e.App.Logger().Warn("Could not load the members of the trip", "error", err, "tripId", trip.Id)
+		return e.Next()
+	}
+
+	batch := make([]notifications.Notification, 0, len(members))
+	for _, member := range members {
+		if !trips.CanEdit(trips.TripRole(trip, member.Id)) {
+			continue
+		}
+		batch = append(batch, notifications.Notification{
+			UserId:  member.Id,
+			TripId:  trip.Id,
+			Kind:    notifications.KindProposalPending,
+			Title:   fmt.Sprintf("A change to %s awaits your approval", trip.GetString("name")),
+			Message: e.Record.GetString("summary"),
+			Link:    "/trips/" + trip.Id,
+			Data: map[string]any{
+				"tripName":   trip.GetString("name"),
+				"proposalId": e.Record.GetString("proposalId"),
+				"tool":       e.Record.GetString("tool"),
+			},
+		})
+	}
+	notifications.SendAll(e.App, batch)
+	return e.Next()
+}
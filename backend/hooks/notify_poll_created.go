@@ -0,0 +1,45 @@
+package hooks
+
+import (
+	"backend/notifications"
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// NotifyPollCreated asks the members of the trip to vote on a new poll. It
+// runs once the poll is saved for good, a poll created while previewing an
+// assistant proposal is rolled back and nobody hears about it.
+func NotifyPollCreated(e *core.RecordEvent) error {
+	trip, err := e.App.FindRecordById("trips", e.Record.GetString("trip"))
+	if err != nil {
+		e.App.Logger().Warn("Could not find the trip of the poll", "error", err, "pollId", e.Record.Id)
+		return e.Next()
+	}
+
+	askedBy := "The assistant"
+	authorId := e.Record.GetString("createdBy")
+	if authorId != "" {
+		if author, err := e.App.FindRecordById("users", authorId); err == nil {
+			askedBy = author.GetString("name")
+		}
+	}
+
+	members := append([]string{trip.GetString("ownerId")}, trip.GetStringSlice("collaborators")...)
+	batch := make([]notifications.Notification, 0, len(members))
+	for _, member := range members {
+		if member == authorId {
+			continue
+		}
+		batch = append(batch, notifications.Notification{
+			UserId: member,
+			TripId: trip.Id,
+			Kind:   notifications.KindPollCreated,
+			Title:  fmt.Sprintf("%s asks: %s", askedBy, e.Record.GetString("question")),
+			Link:   fmt.Sprintf("/trips/%s", trip.Id),
+			Data:   map[string]any{"pollId": e.Record.Id},
+		})
+	}
+	notifications.SendAll(e.App, batch)
+	return e.Next()
+}
@@ -0,0 +1,51 @@
+package hooks
+
+import (
+	"backend/notifications"
+	"backend/trips"
+	"fmt"
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// NotifyTripMembersAdded tells the users who became collaborators or the
+// owner of a trip with the update. The notification goes out once the
+// update is saved.
+func NotifyTripMembersAdded(e *core.RecordEvent) error {
+	// the original of a record saved before is not always refreshed, the
+	// stored trip is what the members were
+	stored, err := e.App.FindRecordById("trips", e.Record.Id)
+	if err != nil {
+		return err
+	}
+	previous := append([]string{stored.GetString("ownerId")}, stored.GetStringSlice("collaborators")...)
+
+	if err := e.Next(); err != nil {
+		return err
+	}
+
+	trip := e.Record
+	members := append([]string{trip.GetString("ownerId")}, trip.GetStringSlice("collaborators")...)
+	batch := make([]notifications.Notification, 0)
+	for _, member := range members {
+		if member == "" || slices.Contains(previous, member) {
+			continue
+		}
+		role := trips.TripRole(trip, member)
+		batch = append(batch, notifications.Notification{
+			UserId:  member,
+			TripId:  trip.Id,
+			Kind:    notifications.KindTripJoined,
+			Title:   fmt.Sprintf("You were added to %s", trip.GetString("name")),
+			Message: fmt.Sprintf("You were added to %s as %s.", trip.GetString("name"), role),
+			Link:    "/trips/" + trip.Id,
+			Data: map[string]any{
+				"tripName": trip.GetString("name"),
+				"role":     role,
+			},
+		})
+	}
+	notifications.SendAll(e.App, batch)
+	return nil
+}
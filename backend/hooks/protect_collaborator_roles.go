@@ -0,0 +1,43 @@
+package hooks
+
+import (
+	"backend/trips"
+	"encoding/json"
+	"errors"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ProtectCollaboratorRoles only lets the owner of a trip change the roles of
+// its collaborators, otherwise a viewer could make themselves an editor
+func ProtectCollaboratorRoles(e *core.RecordRequestEvent) error {
+
+	if e.HasSuperuserAuth() {
+		return e.Next()
+	}
+
+	original := e.Record.Original()
+	before, _ := json.Marshal(original.Get("collaboratorRoles"))
+	after, _ := json.Marshal(e.Record.Get("collaboratorRoles"))
+	if string(before) == string(after) {
+		return e.Next()
+	}
+
+	if e.Auth == nil || original.GetString("ownerId") != e.Auth.Id {
+		return errors.New("only the trip owner can change collaborator roles")
+	}
+
+	for _, role := range collaboratorRoles(e.Record) {
+		if role != trips.RoleEditor && role != trips.RoleViewer {
+			return errors.New("collaborator roles must be editor or viewer")
+		}
+	}
+
+	return e.Next()
+}
+
+func collaboratorRoles(record *core.Record) map[string]string {
+	roles := map[string]string{}
+	_ = record.UnmarshalJSONField("collaboratorRoles", &roles)
+	return roles
+}
@@ -0,0 +1,40 @@
+package hooks
+
+import (
+	"backend/trips"
+	"encoding/json"
+	"errors"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ProtectItemPrivacy only lets the trip owner mark items or fields private,
+// otherwise a collaborator could hide plans from everyone else. Updates from
+// collaborators leave the private fields as they were.
+func ProtectItemPrivacy(e *core.RecordRequestEvent) error {
+
+	if e.HasSuperuserAuth() {
+		return e.Next()
+	}
+
+	trip, err := e.App.FindRecordById("trips", e.Record.GetString("trip"))
+	if err != nil {
+		return err
+	}
+	if e.Auth != nil && trip.GetString("ownerId") == e.Auth.Id {
+		return e.Next()
+	}
+
+	original := e.Record.Original()
+	before, _ := json.Marshal(original.Get("privacy"))
+	after, _ := json.Marshal(e.Record.Get("privacy"))
+	if string(before) != string(after) {
+		return errors.New("only the trip owner can change what is private")
+	}
+
+	if !e.Record.IsNew() {
+		trips.KeepPrivateFields(e.Record, original)
+	}
+
+	return e.Next()
+}
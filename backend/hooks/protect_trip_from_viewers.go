@@ -0,0 +1,39 @@
+package hooks
+
+import (
+	"backend/trips"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ProtectTripFromViewers keeps viewers from changing the trip or its items
+// through the collection API, the collection rules let every member write.
+// Items moved between trips are checked against both.
+func ProtectTripFromViewers(e *core.RecordRequestEvent) error {
+
+	if e.HasSuperuserAuth() || e.Auth == nil {
+		return e.Next()
+	}
+
+	if e.Record.Collection().Name == "trips" {
+		if trips.TripRole(e.Record.Original(), e.Auth.Id) == trips.RoleViewer {
+			return e.ForbiddenError("Viewers cannot change this trip", nil)
+		}
+		return e.Next()
+	}
+
+	for _, tripId := range []string{e.Record.Original().GetString("trip"), e.Record.GetString("trip")} {
+		if tripId == "" {
+			continue
+		}
+		trip, err := e.App.FindRecordById("trips", tripId)
+		if err != nil {
+			return err
+		}
+		if trips.TripRole(trip, e.Auth.Id) == trips.RoleViewer {
+			return e.ForbiddenError("Viewers cannot change this trip", nil)
+		}
+	}
+
+	return e.Next()
+}
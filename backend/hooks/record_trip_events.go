@@ -0,0 +1,114 @@
+package hooks
+
+import (
+	"backend/trips"
+	"slices"
+	"sync"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// requestActors remembers who sent the request a record is saved for, the
+// model hooks that log the change do not see the request
+var requestActors sync.Map
+
+// TrackTripEventActor notes the user behind a create, update or delete
+// request of a trip or one of its items
+func TrackTripEventActor(e *core.RecordRequestEvent) error {
+	if e.Auth == nil || e.Auth.Collection().Name != "users" {
+		return e.Next()
+	}
+	requestActors.Store(e.Record, e.Auth.Id)
+	defer requestActors.Delete(e.Record)
+	return e.Next()
+}
+
+// RecordTripEvent adds the change to the trip_events log once it is saved.
+// Changes the server makes on its own, outside a request, have no actor.
+func RecordTripEvent(e *core.RecordEvent) error {
+	collection := e.Record.Collection().Name
+	tripId := e.Record.GetString("trip")
+	if collection == "trips" {
+		// the log of a trip goes with it
+		if e.Type == core.ModelEventTypeDelete {
+			return e.Next()
+		}
+		tripId = e.Record.Id
+	}
+
+	// the original of a record saved before is not always refreshed, the
+	// stored record is what changed
+	var stored *core.Record
+	action := trips.EventCreated
+	switch e.Type {
+	case core.ModelEventTypeUpdate:
+		action = trips.EventUpdated
+		stored, _ = e.App.FindRecordById(e.Record.Collection(), e.Record.Id)
+	case core.ModelEventTypeDelete:
+		action = trips.EventDeleted
+		stored = e.Record
+	}
+
+	if err := e.Next(); err != nil {
+		return err
+	}
+
+	record := e.Record
+	if action == trips.EventDeleted {
+		record = nil
+	}
+	changes := trips.RecordChanges(stored, record)
+	if action == trips.EventUpdated && len(changes) == 0 {
+		return nil
+	}
+
+	events, err := e.App.FindCollectionByNameOrId("trip_events")
+	if err != nil {
+		return nil
+	}
+	event := core.NewRecord(events)
+	event.Set("trip", tripId)
+	if actor, ok := requestActors.Load(e.Record); ok {
+		event.Set("actor", actor)
+	}
+	event.Set("action", action)
+	event.Set("collection", collection)
+	event.Set("recordId", e.Record.Id)
+	event.Set("label", trips.ItemLabel(e.Record))
+	if action != trips.EventDeleted {
+		event.Set("version", trips.RecordVersion(e.Record))
+	}
+	event.Set("changes", changes)
+
+	privacy := trips.ItemPrivacy(e.Record)
+	private, privateFields := privacy.Item, privacy.Fields
+	if stored != nil {
+		storedPrivacy := trips.ItemPrivacy(stored)
+		private = private || storedPrivacy.Item
+		privateFields = append(privateFields, storedPrivacy.Fields...)
+	}
+	event.Set("private", private)
+	event.Set("privateFields", slices.Compact(slices.Sorted(slices.Values(privateFields))))
+
+	// the change is saved already, a missing log entry must not undo it
+	if err := e.App.Save(event); err != nil {
+		e.App.Logger().Warn("Could not log the change of a trip", "error", err, "collection", collection, "recordId", e.Record.Id)
+	}
+	return nil
+}
+
+// DeleteTripEvents removes what was logged while the items of a deleted trip
+// were removed with it
+func DeleteTripEvents(e *core.RecordEvent) error {
+	events, err := e.App.FindAllRecords("trip_events", dbx.HashExp{"trip": e.Record.Id})
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := e.App.Delete(event); err != nil {
+			e.App.Logger().Warn("Could not delete the log of a deleted trip", "error", err, "eventId", event.Id)
+		}
+	}
+	return e.Next()
+}
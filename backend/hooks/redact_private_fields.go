@@ -0,0 +1,31 @@
+package hooks
+
+import (
+	"backend/trips"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// RedactPrivateFields clears the fields the trip owner keeps private before a
+// trip item is sent to anyone else. Items private as a whole never get here,
+// the API rules of the collections already leave them out.
+func RedactPrivateFields(e *core.RecordEnrichEvent) error {
+
+	if e.RequestInfo == nil || e.RequestInfo.HasSuperuserAuth() {
+		return e.Next()
+	}
+	if len(trips.ItemPrivacy(e.Record).Fields) == 0 {
+		return e.Next()
+	}
+
+	userId := ""
+	if e.RequestInfo.Auth != nil {
+		userId = e.RequestInfo.Auth.Id
+	}
+	trip, err := e.App.FindRecordById("trips", e.Record.GetString("trip"))
+	if err != nil || !trips.SeesPrivate(trips.TripRole(trip, userId)) {
+		trips.RedactRecord(e.Record)
+	}
+
+	return e.Next()
+}
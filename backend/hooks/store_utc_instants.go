@@ -0,0 +1,15 @@
+package hooks
+
+import (
+	"backend/trips"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/ringsaturn/tzf"
+)
+
+// StoreUtcInstants keeps the UTC instant and timezone of each wall clock
+// time of an itinerary record up to date as it is saved
+func StoreUtcInstants(e *core.RecordEvent, finder tzf.F) error {
+	trips.StoreInstants(e.App, finder, e.Record)
+	return e.Next()
+}
@@ -1,7 +1,10 @@
 package hooks
 
 import (
+	"backend/trips"
+	bt "backend/types"
 	"errors"
+
 	"github.com/pocketbase/pocketbase/core"
 )
 
@@ -13,49 +16,42 @@ func UpdateTripCollaborationInvitation(e *core.RecordRequestEvent) error {
 	}
 
 	record := e.Record
-	recipientEmail := record.GetString("recipientEmail")
-	tripId := record.GetString("trip")
-	authUserEmail := info.Auth.GetString("email")
-
-	if recipientEmail != authUserEmail {
+	original := record.Original()
+	if info.Auth == nil || original.GetString("recipientEmail") != info.Auth.GetString("email") {
 		return errors.New("cannot update invitation")
 	}
 
-	err = e.Next()
-	if err != nil {
-		return err
+	// the recipient answers the invitation, everything else stays as sent
+	for _, field := range []string{"trip", "from", "recipientEmail", "role", "expiresOn", "tokenKey", "message"} {
+		if record.GetString(field) != original.GetString(field) {
+			return errors.New("cannot update invitation")
+		}
 	}
 
-	if record.GetString("status") != "accepted" {
-		return nil
+	status := record.GetString("status")
+	if status == original.GetString("status") {
+		return e.Next()
 	}
-
-	return addUserAsCollaborator(e, tripId, info)
-
-}
-
-func addUserAsCollaborator(e *core.RecordRequestEvent, tripId string, info *core.RequestInfo) error {
-
-	trip, err := e.App.FindRecordById("trips", tripId)
-	if err != nil {
+	if status != bt.Accepted.String() && status != bt.Rejected.String() {
+		return errors.New("an invitation can only be accepted or rejected")
+	}
+	if err := trips.CheckInvitationOpen(e.App, original); err != nil {
 		return err
 	}
 
-	collaborators := trip.GetStringSlice("collaborators")
-	updatedCollaborators := make([]string, 0)
-	if collaborators != nil && len(collaborators) > 0 {
-		for _, collaborator := range collaborators {
-			if collaborator != info.Auth.Id {
-				updatedCollaborators = append(updatedCollaborators, collaborator)
-			}
-		}
+	if status == bt.Rejected.String() {
+		return e.Next()
 	}
 
-	updatedCollaborators = append(updatedCollaborators, info.Auth.Id)
-	trip.Set("collaborators", updatedCollaborators)
-	err = e.App.Save(trip)
-	if err != nil {
-		return err
-	}
-	return nil
+	return e.App.RunInTransaction(func(txApp core.App) error {
+		trip, err := txApp.FindRecordById("trips", record.GetString("trip"))
+		if err != nil {
+			return err
+		}
+		if err := trips.JoinTrip(txApp, trip, info.Auth.Id, trips.InvitationRole(record), record.GetString("from")); err != nil {
+			return err
+		}
+		e.App = txApp
+		return e.Next()
+	})
 }
@@ -0,0 +1,29 @@
+package hooks
+
+import (
+	"backend/trips"
+	"strings"
+
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ValidateBudgetCategories rejects category budgets that are not one of the
+// categories or are negative
+func ValidateBudgetCategories(e *core.RecordEvent) error {
+
+	raw := e.Record.GetString("budgetCategories")
+	if raw == "" || raw == "null" {
+		return e.Next()
+	}
+
+	var categories map[string]float64
+	if err := e.Record.UnmarshalJSONField("budgetCategories", &categories); err != nil {
+		return v.Errors{"budgetCategories": v.NewError("validation_invalid_budget_categories", "budgetCategories must map categories to amounts")}
+	}
+	if problems := trips.BudgetCategoryErrors(categories); len(problems) > 0 {
+		return v.Errors{"budgetCategories": v.NewError("validation_invalid_budget_categories", strings.Join(problems, "; "))}
+	}
+
+	return e.Next()
+}
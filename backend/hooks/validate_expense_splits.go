@@ -0,0 +1,46 @@
+package hooks
+
+import (
+	"backend/trips"
+	bt "backend/types"
+	"encoding/json"
+	"strings"
+
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ValidateExpenseSplits rejects a payer or a split of an expense or an
+// itinerary item that does not match the participants of the trip, and
+// stores the names as the trip writes them
+func ValidateExpenseSplits(e *core.RecordEvent) error {
+
+	paidBy := e.Record.GetString("paidBy")
+	var splits []bt.ExpenseSplit
+	if raw := e.Record.GetString("splitAmong"); raw != "" && raw != "null" && json.Unmarshal([]byte(raw), &splits) != nil {
+		return v.Errors{"splitAmong": v.NewError("validation_invalid_split", "splitAmong must be a list of parts")}
+	}
+	if paidBy == "" && len(splits) == 0 {
+		return e.Next()
+	}
+
+	trip, err := e.App.FindRecordById("trips", e.Record.GetString("trip"))
+	if err != nil {
+		return e.Next()
+	}
+
+	var participants []bt.Participant
+	_ = trip.UnmarshalJSONField("participants", &participants)
+	var cost *bt.Cost
+	_ = e.Record.UnmarshalJSONField("cost", &cost)
+
+	if problems := trips.SplitErrors(&paidBy, cost, splits, participants); len(problems) > 0 {
+		return v.Errors{"splitAmong": v.NewError("validation_invalid_split", strings.Join(problems, "; "))}
+	}
+
+	e.Record.Set("paidBy", paidBy)
+	if len(splits) > 0 {
+		e.Record.Set("splitAmong", splits)
+	}
+	return e.Next()
+}
@@ -0,0 +1,20 @@
+package hooks
+
+import (
+	"backend/trips"
+	"strings"
+
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ValidateItemPrivacy rejects private fields other than cost,
+// confirmationCode and notes
+func ValidateItemPrivacy(e *core.RecordEvent) error {
+
+	if problems := trips.PrivacyErrors(trips.ItemPrivacy(e.Record)); len(problems) > 0 {
+		return v.Errors{"privacy": v.NewError("validation_invalid_privacy", strings.Join(problems, "; "))}
+	}
+
+	return e.Next()
+}
@@ -0,0 +1,47 @@
+package hooks
+
+import (
+	"backend/trips"
+	bt "backend/types"
+	"backend/validation"
+	"strings"
+
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ValidateLodgingRooms rejects room assignments that do not match the trip,
+// for the lodging forms and for changes made by the assistant alike
+func ValidateLodgingRooms(e *core.RecordEvent) error {
+
+	var rooms []bt.Room
+	if err := e.Record.UnmarshalJSONField("rooms", &rooms); err != nil || len(rooms) == 0 {
+		return e.Next()
+	}
+
+	trip, err := e.App.FindRecordById("trips", e.Record.GetString("trip"))
+	if err != nil {
+		return e.Next()
+	}
+
+	var participants []bt.Participant
+	_ = trip.UnmarshalJSONField("participants", &participants)
+
+	problems := trips.RoomErrors(rooms, participants)
+	for i, room := range rooms {
+		if room.Cost == nil {
+			continue
+		}
+		currency, err := validation.NormalizeCost(room.Cost.Value, room.Cost.Currency)
+		if err != nil {
+			problems = append(problems, room.Name+": "+err.Error())
+		}
+		rooms[i].Cost.Currency = currency
+	}
+	if len(problems) > 0 {
+		return v.Errors{"rooms": v.NewError("validation_invalid_rooms", strings.Join(problems, "; "))}
+	}
+
+	e.Record.Set("rooms", rooms)
+	return e.Next()
+}
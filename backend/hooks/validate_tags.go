@@ -0,0 +1,30 @@
+package hooks
+
+import (
+	"backend/trips"
+	"strings"
+
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ValidateTags tidies the tags of a trip or a trip item, so that the same
+// tag written twice reads the same
+func ValidateTags(e *core.RecordEvent) error {
+	raw := e.Record.GetString("tags")
+	if raw == "" || raw == "null" {
+		return e.Next()
+	}
+
+	var tags []string
+	if err := e.Record.UnmarshalJSONField("tags", &tags); err != nil {
+		return v.Errors{"tags": v.NewError("validation_invalid_tags", "tags must be a list of words")}
+	}
+	cleaned, problems := trips.CleanTags(tags)
+	if len(problems) > 0 {
+		return v.Errors{"tags": v.NewError("validation_invalid_tags", strings.Join(problems, "; "))}
+	}
+	e.Record.Set("tags", cleaned)
+
+	return e.Next()
+}
@@ -0,0 +1,34 @@
+package hooks
+
+import (
+	"backend/trips"
+	bt "backend/types"
+	"strings"
+
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ValidateTransportationSeats rejects seat assignments that do not match the
+// participants of the trip
+func ValidateTransportationSeats(e *core.RecordEvent) error {
+
+	var seats []bt.SeatAssignment
+	if err := e.Record.UnmarshalJSONField("seats", &seats); err != nil || len(seats) == 0 {
+		return e.Next()
+	}
+
+	trip, err := e.App.FindRecordById("trips", e.Record.GetString("trip"))
+	if err != nil {
+		return e.Next()
+	}
+
+	var participants []bt.Participant
+	_ = trip.UnmarshalJSONField("participants", &participants)
+
+	if problems := trips.SeatErrors(seats, participants); len(problems) > 0 {
+		return v.Errors{"seats": v.NewError("validation_invalid_seats", strings.Join(problems, "; "))}
+	}
+
+	return e.Next()
+}
@@ -0,0 +1,47 @@
+package hooks
+
+import (
+	"backend/trips"
+	"strings"
+
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ValidateTripDocument tidies the tags of a vault document and checks that
+// it is only shared with members of its trip and expires after it is issued
+func ValidateTripDocument(e *core.RecordEvent) error {
+
+	var tags []string
+	if raw := e.Record.GetString("tags"); raw != "" && raw != "null" {
+		if err := e.Record.UnmarshalJSONField("tags", &tags); err != nil {
+			return v.Errors{"tags": v.NewError("validation_invalid_tags", "tags must be a list of words")}
+		}
+		cleaned, problems := trips.CleanTags(tags)
+		if len(problems) > 0 {
+			return v.Errors{"tags": v.NewError("validation_invalid_tags", strings.Join(problems, "; "))}
+		}
+		e.Record.Set("tags", cleaned)
+	}
+
+	issued, expires := e.Record.GetDateTime("issuedOn"), e.Record.GetDateTime("expiresOn")
+	if !issued.IsZero() && !expires.IsZero() && expires.Before(issued) {
+		return v.Errors{"expiresOn": v.NewError("validation_invalid_expiry", "the document cannot expire before it is issued")}
+	}
+
+	trip, err := e.App.FindRecordById("trips", e.Record.GetString("trip"))
+	if err != nil {
+		return e.Next()
+	}
+	if trips.TripRole(trip, e.Record.GetString("owner")) == "" {
+		return v.Errors{"owner": v.NewError("validation_not_a_member", "the owner of the document must be a member of the trip")}
+	}
+	// the owner alone in visibleTo keeps the document to themselves
+	for _, userId := range e.Record.GetStringSlice("visibleTo") {
+		if trips.TripRole(trip, userId) == "" {
+			return v.Errors{"visibleTo": v.NewError("validation_not_a_member", "documents can only be shared with members of the trip")}
+		}
+	}
+
+	return e.Next()
+}
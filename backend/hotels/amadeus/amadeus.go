@@ -0,0 +1,255 @@
+package amadeus
+
+import (
+	"backend/cache"
+	"backend/hotels"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultURL is the test environment every new key starts in, production
+// keys use https://api.amadeus.com
+const DefaultURL = "https://test.api.amadeus.com"
+
+// hotels asked for offers at once, the offers endpoint takes a short list
+const maxHotels = 40
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type hotelList struct {
+	Data []struct {
+		HotelId string `json:"hotelId"`
+		Name    string `json:"name"`
+		Rating  int    `json:"rating"`
+		GeoCode struct {
+			Latitude  float64 `json:"latitude"`
+			Longitude float64 `json:"longitude"`
+		} `json:"geoCode"`
+		Address struct {
+			Lines       []string `json:"lines"`
+			CityName    string   `json:"cityName"`
+			CountryCode string   `json:"countryCode"`
+		} `json:"address"`
+	} `json:"data"`
+}
+
+type offersResponse struct {
+	Data []struct {
+		Available bool `json:"available"`
+		Hotel     struct {
+			HotelId   string  `json:"hotelId"`
+			Name      string  `json:"name"`
+			Latitude  float64 `json:"latitude"`
+			Longitude float64 `json:"longitude"`
+		} `json:"hotel"`
+		Offers []struct {
+			Id           string `json:"id"`
+			CheckInDate  string `json:"checkInDate"`
+			CheckOutDate string `json:"checkOutDate"`
+			Room         struct {
+				TypeEstimated struct {
+					Category string `json:"category"`
+				} `json:"typeEstimated"`
+			} `json:"room"`
+			Price struct {
+				Currency string `json:"currency"`
+				Total    string `json:"total"`
+			} `json:"price"`
+			Policies struct {
+				Refundable struct {
+					CancellationRefund string `json:"cancellationRefund"`
+				} `json:"refundable"`
+			} `json:"policies"`
+		} `json:"offers"`
+	} `json:"data"`
+}
+
+// Amadeus is the Self-Service hotel search, it needs the client id and
+// secret of an app. Hotels near the point are listed first, then their
+// offers for the stay are asked for.
+type Amadeus struct {
+	URL          string
+	ClientId     string
+	ClientSecret string
+}
+
+func (a Amadeus) Search(search hotels.Search) ([]hotels.Offer, error) {
+	if a.ClientId == "" || a.ClientSecret == "" {
+		return nil, errors.New("the Amadeus client id and secret are not configured")
+	}
+
+	radiusKm := max((search.RadiusMeters+999)/1000, 1)
+	cacheKey := fmt.Sprintf("amadeus-%.3f-%.3f-%d-%s-%s-%d-%d-%s", search.Latitude, search.Longitude, radiusKm,
+		search.CheckIn.Format(time.DateOnly), search.CheckOut.Format(time.DateOnly), search.Adults, search.Rooms, search.Currency)
+	if val, found := cache.Get(cacheKey); found {
+		return val.([]hotels.Offer), nil
+	}
+
+	token, err := a.token()
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("latitude", strconv.FormatFloat(search.Latitude, 'f', 6, 64))
+	params.Set("longitude", strconv.FormatFloat(search.Longitude, 'f', 6, 64))
+	params.Set("radius", strconv.Itoa(radiusKm))
+	params.Set("radiusUnit", "KM")
+	var list hotelList
+	if err := a.get(token, "/v1/reference-data/locations/hotels/by-geocode", params, &list); err != nil {
+		return nil, err
+	}
+	if len(list.Data) == 0 {
+		cache.Set(cacheKey, []hotels.Offer{}, 15*time.Minute)
+		return []hotels.Offer{}, nil
+	}
+
+	type listed struct {
+		address string
+		stars   int
+	}
+	known := map[string]listed{}
+	ids := make([]string, 0, maxHotels)
+	for _, hotel := range list.Data {
+		if len(ids) == maxHotels {
+			break
+		}
+		address := append(append([]string{}, hotel.Address.Lines...), hotel.Address.CityName)
+		known[hotel.HotelId] = listed{address: strings.Join(nonEmpty(address), ", "), stars: hotel.Rating}
+		ids = append(ids, hotel.HotelId)
+	}
+
+	params = url.Values{}
+	params.Set("hotelIds", strings.Join(ids, ","))
+	params.Set("checkInDate", search.CheckIn.Format(time.DateOnly))
+	params.Set("checkOutDate", search.CheckOut.Format(time.DateOnly))
+	params.Set("adults", strconv.Itoa(max(search.Adults, 1)))
+	params.Set("roomQuantity", strconv.Itoa(max(search.Rooms, 1)))
+	params.Set("bestRateOnly", "true")
+	if search.Currency != "" {
+		params.Set("currency", search.Currency)
+	}
+	var data offersResponse
+	if err := a.get(token, "/v3/shopping/hotel-offers", params, &data); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	offers := make([]hotels.Offer, 0)
+	for _, hotel := range data.Data {
+		if !hotel.Available {
+			continue
+		}
+		for _, o := range hotel.Offers {
+			total, err := strconv.ParseFloat(o.Price.Total, 64)
+			if err != nil {
+				continue
+			}
+			offers = append(offers, hotels.Offer{
+				Id:          "amadeus:" + o.Id,
+				HotelId:     hotel.Hotel.HotelId,
+				Name:        hotel.Hotel.Name,
+				Address:     known[hotel.Hotel.HotelId].address,
+				Latitude:    hotel.Hotel.Latitude,
+				Longitude:   hotel.Hotel.Longitude,
+				Stars:       known[hotel.Hotel.HotelId].stars,
+				CheckIn:     o.CheckInDate,
+				CheckOut:    o.CheckOutDate,
+				RoomType:    strings.ToLower(strings.ReplaceAll(o.Room.TypeEstimated.Category, "_", " ")),
+				Price:       hotels.Price{Total: total, Currency: o.Price.Currency},
+				Refundable:  o.Policies.Refundable.CancellationRefund == "REFUNDABLE_UP_TO_DEADLINE",
+				Source:      "amadeus",
+				RetrievedAt: now,
+			})
+		}
+	}
+
+	offers = hotels.Cheapest(offers, search.Latitude, search.Longitude, search.Nights(), 0)
+	// prices move quickly, a short cache only spares repeated searches
+	cache.Set(cacheKey, offers, 15*time.Minute)
+	return offers, nil
+}
+
+// token gets an access token with the client credentials, it is kept until
+// shortly before it expires
+func (a Amadeus) token() (string, error) {
+	cacheKey := "amadeus-token-" + a.ClientId
+	if val, found := cache.Get(cacheKey); found {
+		return val.(string), nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", a.ClientId)
+	form.Set("client_secret", a.ClientSecret)
+
+	client := &http.Client{Timeout: 20 * time.Second}
+	resp, err := client.PostForm(a.baseURL()+"/v1/security/oauth2/token", form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("amadeus refused the client credentials: %s", resp.Status)
+	}
+
+	var data tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", err
+	}
+	if data.AccessToken == "" {
+		return "", errors.New("amadeus returned no access token")
+	}
+
+	if lifetime := time.Duration(data.ExpiresIn)*time.Second - time.Minute; lifetime > 0 {
+		cache.Set(cacheKey, data.AccessToken, lifetime)
+	}
+	return data.AccessToken, nil
+}
+
+func (a Amadeus) get(token string, path string, params url.Values, result interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, a.baseURL()+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("amadeus returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (a Amadeus) baseURL() string {
+	if a.URL == "" {
+		return DefaultURL
+	}
+	return strings.TrimRight(a.URL, "/")
+}
+
+func nonEmpty(values []string) []string {
+	kept := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,243 @@
+package booking
+
+import (
+	"backend/cache"
+	"backend/hotels"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultURL = "https://demandapi.booking.com/3.1"
+
+type searchRequest struct {
+	Booker struct {
+		Country  string `json:"country"`
+		Platform string `json:"platform"`
+	} `json:"booker"`
+	Checkin     string `json:"checkin"`
+	Checkout    string `json:"checkout"`
+	Coordinates struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+		Radius    float64 `json:"radius"`
+	} `json:"coordinates"`
+	Guests struct {
+		NumberOfAdults int `json:"number_of_adults"`
+		NumberOfRooms  int `json:"number_of_rooms"`
+	} `json:"guests"`
+	Currency string   `json:"currency,omitempty"`
+	Extras   []string `json:"extras"`
+	Rows     int      `json:"rows"`
+}
+
+type searchResponse struct {
+	Data []struct {
+		Id       int64  `json:"id"`
+		Currency string `json:"currency"`
+		Price    struct {
+			Book  float64 `json:"book"`
+			Total float64 `json:"total"`
+		} `json:"price"`
+		Url      string `json:"url"`
+		Products []struct {
+			Id       string `json:"id"`
+			Policies struct {
+				Cancellation struct {
+					Type string `json:"type"`
+				} `json:"cancellation"`
+			} `json:"policies"`
+		} `json:"products"`
+	} `json:"data"`
+}
+
+type detailsRequest struct {
+	Accommodations []int64  `json:"accommodations"`
+	Languages      []string `json:"languages"`
+}
+
+type detailsResponse struct {
+	Data []struct {
+		Id     int64             `json:"id"`
+		Name   map[string]string `json:"name"`
+		Rating struct {
+			Stars int `json:"stars"`
+		} `json:"rating"`
+		Location struct {
+			Address     map[string]string `json:"address"`
+			Coordinates struct {
+				Latitude  float64 `json:"latitude"`
+				Longitude float64 `json:"longitude"`
+			} `json:"coordinates"`
+		} `json:"location"`
+	} `json:"data"`
+}
+
+// Booking is the Booking.com Demand API for affiliate partners, it needs the
+// affiliate id and an api token. Prices come with a link that books the
+// room through the affiliate.
+type Booking struct {
+	URL         string
+	AffiliateId string
+	Token       string
+}
+
+func (b Booking) Search(search hotels.Search) ([]hotels.Offer, error) {
+	if b.AffiliateId == "" || b.Token == "" {
+		return nil, errors.New("the Booking.com affiliate id and api token are not configured")
+	}
+
+	language := strings.ToLower(strings.SplitN(search.Language, "-", 2)[0])
+	if language == "" {
+		language = "en"
+	}
+
+	var request searchRequest
+	request.Booker.Country = "us"
+	request.Booker.Platform = "desktop"
+	request.Checkin = search.CheckIn.Format(time.DateOnly)
+	request.Checkout = search.CheckOut.Format(time.DateOnly)
+	request.Coordinates.Latitude = search.Latitude
+	request.Coordinates.Longitude = search.Longitude
+	request.Coordinates.Radius = max(float64(search.RadiusMeters)/1000, 1)
+	request.Guests.NumberOfAdults = max(search.Adults, 1)
+	request.Guests.NumberOfRooms = max(search.Rooms, 1)
+	request.Currency = search.Currency
+	request.Extras = []string{"products"}
+	// more than asked for, the cheapest ones are picked afterwards
+	request.Rows = min(max(search.Limit*3, 30), 100)
+
+	cacheKey := fmt.Sprintf("booking-%.3f-%.3f-%.1f-%s-%s-%d-%d-%s-%s", search.Latitude, search.Longitude, request.Coordinates.Radius,
+		request.Checkin, request.Checkout, request.Guests.NumberOfAdults, request.Guests.NumberOfRooms, search.Currency, language)
+	if val, found := cache.Get(cacheKey); found {
+		return val.([]hotels.Offer), nil
+	}
+
+	var found searchResponse
+	if err := b.post("/accommodations/search", request, &found); err != nil {
+		return nil, err
+	}
+	if len(found.Data) == 0 {
+		cache.Set(cacheKey, []hotels.Offer{}, 15*time.Minute)
+		return []hotels.Offer{}, nil
+	}
+
+	// the search only has prices, the names and places are in the details
+	ids := make([]int64, 0, len(found.Data))
+	for _, accommodation := range found.Data {
+		ids = append(ids, accommodation.Id)
+	}
+	var details detailsResponse
+	if err := b.post("/accommodations/details", detailsRequest{Accommodations: ids, Languages: []string{language, "en-gb"}}, &details); err != nil {
+		return nil, err
+	}
+	type detail struct {
+		name      string
+		address   string
+		stars     int
+		latitude  float64
+		longitude float64
+	}
+	known := map[int64]detail{}
+	for _, d := range details.Data {
+		known[d.Id] = detail{
+			name:      localized(d.Name, language),
+			address:   localized(d.Location.Address, language),
+			stars:     d.Rating.Stars,
+			latitude:  d.Location.Coordinates.Latitude,
+			longitude: d.Location.Coordinates.Longitude,
+		}
+	}
+
+	now := time.Now().UTC()
+	offers := make([]hotels.Offer, 0, len(found.Data))
+	for _, accommodation := range found.Data {
+		d, ok := known[accommodation.Id]
+		if !ok {
+			continue
+		}
+		id := strconv.FormatInt(accommodation.Id, 10)
+		offer := hotels.Offer{
+			Id:          "booking:" + id,
+			HotelId:     id,
+			Name:        d.name,
+			Address:     d.address,
+			Latitude:    d.latitude,
+			Longitude:   d.longitude,
+			Stars:       d.stars,
+			CheckIn:     request.Checkin,
+			CheckOut:    request.Checkout,
+			Price:       hotels.Price{Total: accommodation.Price.Total, Currency: accommodation.Currency},
+			BookingURL:  accommodation.Url,
+			Source:      "booking",
+			RetrievedAt: now,
+		}
+		if len(accommodation.Products) > 0 {
+			offer.Id += ":" + accommodation.Products[0].Id
+			offer.Refundable = accommodation.Products[0].Policies.Cancellation.Type == "free_cancellation"
+		}
+		offers = append(offers, offer)
+	}
+
+	offers = hotels.Cheapest(offers, search.Latitude, search.Longitude, search.Nights(), 0)
+	cache.Set(cacheKey, offers, 15*time.Minute)
+	return offers, nil
+}
+
+func (b Booking) post(path string, body interface{}, result interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	endpoint := b.URL
+	if endpoint == "" {
+		endpoint = DefaultURL
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(endpoint, "/")+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+b.Token)
+	req.Header.Set("X-Affiliate-Id", b.AffiliateId)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("booking.com returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// localized picks the text in the language, British English or the first
+func localized(texts map[string]string, language string) string {
+	keys := make([]string, 0, len(texts))
+	for key := range texts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.HasPrefix(strings.ToLower(key), language) && texts[key] != "" {
+			return texts[key]
+		}
+	}
+	if text := texts["en-gb"]; text != "" {
+		return text
+	}
+	if len(keys) > 0 {
+		return texts[keys[0]]
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+package hotels
+
+import (
+	"backend/poi"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Offer is a room a hotel has free for the stay, at the price the provider
+// quoted when asked. Prices change by the minute, they are a guide until
+// the room is booked.
+type Offer struct {
+	Id          string    `json:"id"`
+	HotelId     string    `json:"hotelId"`
+	Name        string    `json:"name"`
+	Address     string    `json:"address,omitempty"`
+	Latitude    float64   `json:"latitude"`
+	Longitude   float64   `json:"longitude"`
+	DistanceKm  float64   `json:"distanceKm"`
+	Stars       int       `json:"stars,omitempty"`
+	CheckIn     string    `json:"checkIn"`
+	CheckOut    string    `json:"checkOut"`
+	RoomType    string    `json:"roomType,omitempty"`
+	Price       Price     `json:"price"`
+	Refundable  bool      `json:"refundable"`
+	BookingURL  string    `json:"bookingUrl,omitempty"`
+	Source      string    `json:"source"`
+	RetrievedAt time.Time `json:"retrievedAt"`
+}
+
+// Price is the total of the stay for all the rooms, taxes included when the
+// provider says so
+type Price struct {
+	Total    float64 `json:"total"`
+	Currency string  `json:"currency"`
+	PerNight float64 `json:"perNight,omitempty"`
+}
+
+// Search is a stay to find rooms for: around a point, from the check-in day
+// to the check-out day, for the guests in the rooms. Currency is the one
+// the prices are wanted in, the provider may not honor it.
+type Search struct {
+	Latitude     float64
+	Longitude    float64
+	RadiusMeters int
+	CheckIn      time.Time
+	CheckOut     time.Time
+	Adults       int
+	Rooms        int
+	Currency     string
+	Limit        int
+	Language     string
+}
+
+type DataProvider interface {
+	Search(search Search) ([]Offer, error)
+}
+
+// Nights is the length of the stay
+func (s Search) Nights() int {
+	return int(math.Round(s.CheckOut.Sub(s.CheckIn).Hours() / 24))
+}
+
+// Cheapest sets the distance of each offer from the point, keeps the
+// cheapest offer of each hotel and returns them cheapest first, nearest
+// first at the same price, at most limit of them
+func Cheapest(offers []Offer, latitude float64, longitude float64, nights int, limit int) []Offer {
+	best := map[string]int{}
+	kept := make([]Offer, 0, len(offers))
+	for _, offer := range offers {
+		if strings.TrimSpace(offer.Name) == "" || offer.Price.Total <= 0 {
+			continue
+		}
+		offer.DistanceKm = math.Round(poi.DistanceKm(latitude, longitude, offer.Latitude, offer.Longitude)*100) / 100
+		if nights > 0 {
+			offer.Price.PerNight = math.Round(offer.Price.Total/float64(nights)*100) / 100
+		}
+		key := offer.Source + ":" + offer.HotelId
+		if i, seen := best[key]; seen {
+			if offer.Price.Total < kept[i].Price.Total {
+				kept[i] = offer
+			}
+			continue
+		}
+		best[key] = len(kept)
+		kept = append(kept, offer)
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		if kept[i].Price.Total != kept[j].Price.Total {
+			return kept[i].Price.Total < kept[j].Price.Total
+		}
+		return kept[i].DistanceKm < kept[j].DistanceKm
+	})
+	if limit > 0 && len(kept) > limit {
+		kept = kept[:limit]
+	}
+	return kept
+}
@@ -0,0 +1,174 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"slices"
+	"strconv"
+
+	"github.com/disintegration/imaging"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	_ "golang.org/x/image/webp"
+)
+
+// jpegQuality keeps photos looking the same at a fraction of the size of the
+// quality the file API uses
+const jpegQuality = 78
+
+// maxThumbSide caps the sides of a thumbnail, larger ones save nothing over
+// the original
+const maxThumbSide = 1920
+
+// ThumbSizes can be asked for on any image field, besides the sizes of the
+// field itself
+var ThumbSizes = []string{"100x100", "300x0", "480x0", "960x0"}
+
+// Fields are the image fields of each collection that get thumbnails
+var Fields = map[string]string{
+	"trips":            "coverImage",
+	"trip_attachments": "file",
+}
+
+// the content types thumbnails can be made of, like the file API
+var imageContentTypes = []string{"image/png", "image/jpg", "image/jpeg", "image/gif", "image/webp"}
+
+var (
+	ErrNotImage = errors.New("the file is not an image")
+	ErrSize     = errors.New("the thumbnail size must be WxH with sides up to 1920")
+)
+
+// Sizes lists the thumbnail sizes of a file field
+func Sizes(field *core.FileField) []string {
+	sizes := slices.Clone(field.Thumbs)
+	for _, size := range ThumbSizes {
+		if !slices.Contains(sizes, size) {
+			sizes = append(sizes, size)
+		}
+	}
+	return sizes
+}
+
+// ThumbKey is where the file API looks for a thumbnail, a thumbnail made
+// ahead of time is served by it too and deleted along with the file
+func ThumbKey(record *core.Record, filename string, size string) string {
+	return record.BaseFilesPath() + "/thumbs_" + filename + "/" + size + "_" + filename
+}
+
+// Generate makes the thumbnail of an image of the record in the given size,
+// unless it is there already
+func Generate(fsys *filesystem.System, record *core.Record, filename string, size string) error {
+	key := ThumbKey(record, filename, size)
+	if exists, _ := fsys.Exists(key); exists {
+		return nil
+	}
+
+	original := record.BaseFilesPath() + "/" + filename
+	attrs, err := fsys.Attributes(original)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(imageContentTypes, attrs.ContentType) {
+		return ErrNotImage
+	}
+
+	r, err := fsys.GetReader(original)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// only the first frame of an animation, turned the way the camera held it
+	img, err := imaging.Decode(r, imaging.AutoOrientation(true))
+	if err != nil {
+		return err
+	}
+
+	thumb, err := Thumbnail(img, size)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, thumb); err != nil {
+		return err
+	}
+	return fsys.Upload(buf.Bytes(), key)
+}
+
+// GenerateRecord makes the thumbnails of the field sizes for the images of a
+// record, ahead of the first time they are shown
+func GenerateRecord(app core.App, record *core.Record) error {
+	name, ok := Fields[record.Collection().Name]
+	if !ok {
+		return nil
+	}
+	field, ok := record.Collection().Fields.GetByName(name).(*core.FileField)
+	if !ok || len(field.Thumbs) == 0 {
+		return nil
+	}
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+
+	var errs []error
+	for _, filename := range record.GetStringSlice(name) {
+		for _, size := range field.Thumbs {
+			err := Generate(fsys, record, filename, size)
+			if errors.Is(err, ErrNotImage) {
+				break
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s %s: %w", filename, size, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Thumbnail resizes an image the way the file API reads the size: 0 keeps
+// the aspect ratio, WxH crops from the center, t and b from the top and the
+// bottom and f fits the image inside. Resizing to a width or a height never
+// makes an image larger.
+func Thumbnail(img image.Image, size string) (image.Image, error) {
+	parts := filesystem.ThumbSizeRegex.FindStringSubmatch(size)
+	if len(parts) != 4 {
+		return nil, ErrSize
+	}
+	width, _ := strconv.Atoi(parts[1])
+	height, _ := strconv.Atoi(parts[2])
+	if width == 0 && height == 0 || width > maxThumbSide || height > maxThumbSide {
+		return nil, ErrSize
+	}
+
+	switch {
+	case width == 0 || height == 0:
+		bounds := img.Bounds()
+		return imaging.Resize(img, min(width, bounds.Dx()), min(height, bounds.Dy()), imaging.CatmullRom), nil
+	case parts[3] == "f":
+		return imaging.Fit(img, width, height, imaging.CatmullRom), nil
+	case parts[3] == "t":
+		return imaging.Fill(img, width, height, imaging.Top, imaging.CatmullRom), nil
+	case parts[3] == "b":
+		return imaging.Fill(img, width, height, imaging.Bottom, imaging.CatmullRom), nil
+	default:
+		return imaging.Fill(img, width, height, imaging.Center, imaging.CatmullRom), nil
+	}
+}
+
+// Encode writes a thumbnail as a JPEG, or as a PNG when it has transparent
+// parts. The Go image packages cannot write WebP, a JPEG at this quality
+// comes close to it in size for photos. Nothing of the metadata of the
+// original is kept, the location a photo was taken included.
+func Encode(buf *bytes.Buffer, img image.Image) error {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && !opaque.Opaque() {
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		return encoder.Encode(buf, img)
+	}
+	return jpeg.Encode(buf, img, &jpeg.Options{Quality: jpegQuality})
+}
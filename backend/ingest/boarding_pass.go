@@ -0,0 +1,301 @@
+package ingest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoBoardingPass = errors.New("no boarding pass could be read from the file")
+
+// BoardingPass is what a boarding pass says about one flight. Date is the
+// local departure day as 2006-01-02, BoardingTime and Departure are kept as
+// printed on the pass. Fields the pass does not have are left empty.
+type BoardingPass struct {
+	Passenger    string `json:"passenger"`
+	Carrier      string `json:"carrier"`
+	FlightNumber string `json:"flightNumber"`
+	Origin       string `json:"origin"`
+	Destination  string `json:"destination"`
+	Date         string `json:"date"`
+	Departure    string `json:"departure"`
+	BoardingTime string `json:"boardingTime"`
+	Seat         string `json:"seat"`
+	Gate         string `json:"gate"`
+	Terminal     string `json:"terminal"`
+	Class        string `json:"class"`
+	Confirmation string `json:"confirmation"`
+}
+
+// Flight is the carrier and number, e.g. UA123
+func (p *BoardingPass) Flight() string {
+	return p.Carrier + p.FlightNumber
+}
+
+// ParseBCBP reads the first leg of an IATA bar coded boarding pass, the
+// text in the PDF417 or Aztec code of nearly every boarding pass. The year is
+// not part of the code, the day closest to near is used.
+func ParseBCBP(code string, near time.Time) (*BoardingPass, bool) {
+	// M, number of legs, 20 name characters, e-ticket indicator, then the
+	// mandatory fields of the first leg, 60 characters in all
+	if len(code) < 58 || code[0] != 'M' {
+		return nil, false
+	}
+
+	pass := &BoardingPass{
+		Passenger:    PassengerName(code[2:22]),
+		Confirmation: strings.TrimSpace(code[23:30]),
+		Origin:       strings.TrimSpace(code[30:33]),
+		Destination:  strings.TrimSpace(code[33:36]),
+		Carrier:      strings.TrimSpace(code[36:39]),
+		FlightNumber: flightNumber(code[39:44]),
+		Class:        strings.TrimSpace(code[47:48]),
+		Seat:         seatNumber(code[48:52]),
+	}
+	if !iataCode.MatchString(pass.Origin) || !iataCode.MatchString(pass.Destination) || pass.FlightNumber == "" {
+		return nil, false
+	}
+
+	if day, err := strconv.Atoi(strings.TrimSpace(code[44:47])); err == nil && day >= 1 && day <= 366 {
+		pass.Date = julianDate(day, near).Format(time.DateOnly)
+	}
+	return pass, true
+}
+
+var (
+	iataCode    = regexp.MustCompile(`^[A-Z]{3}$`)
+	bcbpPattern = regexp.MustCompile(`M[1-4][A-Z/ .\-']{20}[E ][A-Z0-9 ]{7}[A-Z]{3}[A-Z]{3}[A-Z0-9 ]{3}[0-9 ]{4}[A-Z ][0-9]{3}[A-Z][0-9A-Z ]{4}`)
+)
+
+// FindBCBP finds a bar coded boarding pass in text, such as the text of a PDF
+func FindBCBP(text string) string {
+	return bcbpPattern.FindString(text)
+}
+
+// PassengerName turns "DOE/JOHN MR" into "John Doe"
+func PassengerName(raw string) string {
+	last, first, _ := strings.Cut(strings.TrimSpace(raw), "/")
+	words := strings.Fields(first)
+	if n := len(words); n > 1 {
+		switch words[n-1] {
+		case "MR", "MRS", "MS", "MISS", "MSTR", "DR":
+			words = words[:n-1]
+		}
+	}
+	words = append(words, strings.Fields(last)...)
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + strings.ToLower(word[1:])
+	}
+	return strings.Join(words, " ")
+}
+
+// flightNumber drops the padding of "0123 " or "0045A"
+func flightNumber(raw string) string {
+	raw = strings.TrimSpace(raw)
+	trimmed := strings.TrimLeft(raw, "0")
+	if trimmed == "" || (trimmed[0] < '0' || trimmed[0] > '9') {
+		return raw
+	}
+	return trimmed
+}
+
+// seatNumber turns "012A" into "12A", leaving codes such as INF or GATE
+func seatNumber(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if trimmed := strings.TrimLeft(raw, "0"); trimmed != "" && trimmed[0] >= '1' && trimmed[0] <= '9' {
+		return trimmed
+	}
+	return raw
+}
+
+func julianDate(day int, near time.Time) time.Time {
+	if near.IsZero() {
+		near = time.Now().UTC()
+	}
+	var best time.Time
+	for year := near.Year() - 1; year <= near.Year()+1; year++ {
+		candidate := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, day-1)
+		if best.IsZero() || candidate.Sub(near).Abs() < best.Sub(near).Abs() {
+			best = candidate
+		}
+	}
+	return best
+}
+
+type passField struct {
+	Key   string      `json:"key"`
+	Label string      `json:"label"`
+	Value interface{} `json:"value"`
+}
+
+type passBarcode struct {
+	Message string `json:"message"`
+	Format  string `json:"format"`
+}
+
+type passJSON struct {
+	OrganizationName string        `json:"organizationName"`
+	RelevantDate     string        `json:"relevantDate"`
+	Barcode          *passBarcode  `json:"barcode"`
+	Barcodes         []passBarcode `json:"barcodes"`
+	BoardingPass     *struct {
+		HeaderFields    []passField `json:"headerFields"`
+		PrimaryFields   []passField `json:"primaryFields"`
+		SecondaryFields []passField `json:"secondaryFields"`
+		AuxiliaryFields []passField `json:"auxiliaryFields"`
+		BackFields      []passField `json:"backFields"`
+	} `json:"boardingPass"`
+}
+
+// ParsePKPass reads an Apple Wallet boarding pass, a zip archive with the
+// pass.json. The barcode is read when it holds a BCBP and the fields of the
+// pass fill in what it does not have, such as the gate.
+func ParsePKPass(data []byte, near time.Time) (*BoardingPass, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrNoBoardingPass
+	}
+
+	var contents []byte
+	for _, file := range archive.File {
+		if file.Name != "pass.json" {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		contents, err = io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var pass passJSON
+	if err := json.Unmarshal(contents, &pass); err != nil || pass.BoardingPass == nil {
+		return nil, ErrNoBoardingPass
+	}
+
+	barcodes := pass.Barcodes
+	if pass.Barcode != nil {
+		barcodes = append(barcodes, *pass.Barcode)
+	}
+	result := &BoardingPass{}
+	for _, barcode := range barcodes {
+		if parsed, ok := ParseBCBP(barcode.Message, near); ok {
+			result = parsed
+			break
+		}
+	}
+
+	fields := make([]passField, 0)
+	for _, group := range [][]passField{pass.BoardingPass.PrimaryFields, pass.BoardingPass.HeaderFields,
+		pass.BoardingPass.SecondaryFields, pass.BoardingPass.AuxiliaryFields, pass.BoardingPass.BackFields} {
+		fields = append(fields, group...)
+	}
+	applyPassFields(result, fields)
+
+	if len(pass.BoardingPass.PrimaryFields) >= 2 {
+		result.Origin = firstNonEmpty(result.Origin, airportCode(text(pass.BoardingPass.PrimaryFields[0].Value)))
+		result.Destination = firstNonEmpty(result.Destination, airportCode(text(pass.BoardingPass.PrimaryFields[1].Value)))
+	}
+	// Wallet dates may leave out the seconds, 2027-01-02T10:05-08:00
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00"} {
+		if relevant, err := time.Parse(layout, pass.RelevantDate); err == nil && result.Date == "" {
+			result.Date = relevant.Format(time.DateOnly)
+		}
+	}
+
+	if result.FlightNumber == "" && result.Origin == "" {
+		return nil, ErrNoBoardingPass
+	}
+	return result, nil
+}
+
+var flightPattern = regexp.MustCompile(`^([A-Z0-9]{2})\s?(\d{1,4}[A-Z]?)$`)
+
+// applyPassFields reads the fields by their key or label, which airlines
+// name freely ("gate", "boardingGate", "Gate")
+func applyPassFields(pass *BoardingPass, fields []passField) {
+	for _, field := range fields {
+		name := strings.ToLower(field.Key + " " + field.Label)
+		value := text(field.Value)
+		if value == "" {
+			continue
+		}
+
+		switch {
+		case strings.Contains(name, "gate"):
+			pass.Gate = firstNonEmpty(pass.Gate, value)
+		case strings.Contains(name, "seat"):
+			pass.Seat = firstNonEmpty(pass.Seat, value)
+		case strings.Contains(name, "terminal"):
+			pass.Terminal = firstNonEmpty(pass.Terminal, value)
+		case strings.Contains(name, "boarding") && strings.Contains(name, "time"):
+			pass.BoardingTime = firstNonEmpty(pass.BoardingTime, value)
+		case strings.Contains(name, "depart") && strings.Contains(name, "time"):
+			pass.Departure = firstNonEmpty(pass.Departure, value)
+		case strings.Contains(name, "flight"):
+			if match := flightPattern.FindStringSubmatch(strings.ToUpper(value)); match != nil && pass.FlightNumber == "" {
+				pass.Carrier, pass.FlightNumber = match[1], match[2]
+			}
+		case strings.Contains(name, "passenger") || strings.Contains(name, "name"):
+			pass.Passenger = firstNonEmpty(pass.Passenger, value)
+		case strings.Contains(name, "confirmation") || strings.Contains(name, "pnr") ||
+			strings.Contains(name, "booking") || strings.Contains(name, "record locator"):
+			pass.Confirmation = firstNonEmpty(pass.Confirmation, value)
+		}
+	}
+}
+
+func airportCode(value string) string {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if iataCode.MatchString(value) {
+		return value
+	}
+	return ""
+}
+
+var (
+	pdfGatePattern     = regexp.MustCompile(`(?i)\bgate\s*:?\s*([A-Z]?\d{1,3}[A-Z]?)\b`)
+	pdfSeatPattern     = regexp.MustCompile(`(?i)\bseat\s*:?\s*(\d{1,2}[A-K])\b`)
+	pdfTerminalPattern = regexp.MustCompile(`(?i)\bterminal\s*:?\s*([A-Z0-9]{1,2})\b`)
+	pdfFlightPattern   = regexp.MustCompile(`(?i)\bflight\s*(?:no\.?|number)?\s*:?\s*([A-Z0-9]{2})\s?(\d{1,4})\b`)
+	pdfBookingPattern  = regexp.MustCompile(`(?i)\b(?:booking reference|confirmation(?: code| number)?|record locator|pnr)\s*:?\s*([A-Z0-9]{6})\b`)
+)
+
+// ParseBoardingPassText reads a boarding pass from the text of a PDF. The
+// barcode itself is an image, but some airlines print its text too; the
+// labelled fields fill in the rest.
+func ParseBoardingPassText(content string, near time.Time) (*BoardingPass, bool) {
+	pass := &BoardingPass{}
+	if code := FindBCBP(content); code != "" {
+		if parsed, ok := ParseBCBP(code, near); ok {
+			pass = parsed
+		}
+	}
+
+	if match := pdfFlightPattern.FindStringSubmatch(content); match != nil && pass.FlightNumber == "" {
+		pass.Carrier, pass.FlightNumber = strings.ToUpper(match[1]), match[2]
+	}
+	if match := pdfSeatPattern.FindStringSubmatch(content); match != nil && pass.Seat == "" {
+		pass.Seat = strings.ToUpper(match[1])
+	}
+	if match := pdfGatePattern.FindStringSubmatch(content); match != nil {
+		pass.Gate = strings.ToUpper(match[1])
+	}
+	if match := pdfTerminalPattern.FindStringSubmatch(content); match != nil {
+		pass.Terminal = strings.ToUpper(match[1])
+	}
+	if match := pdfBookingPattern.FindStringSubmatch(content); match != nil && pass.Confirmation == "" {
+		pass.Confirmation = strings.ToUpper(match[1])
+	}
+	return pass, pass.FlightNumber != ""
+}
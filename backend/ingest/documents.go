@@ -0,0 +1,132 @@
+package ingest
+
+import (
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const maxDocumentFieldValue = 80
+
+var (
+	// labelled values, one per line: "Door code: 4821", "Wi-Fi password - sunny"
+	documentFieldLine = regexp.MustCompile(`(?im)^[ \t*\-•]*(door code|access code|entry code|gate code|key ?box(?: code)?|lock ?box(?: code)?|key code|pin|wi-?fi(?: network| password| name)?|password|check-?in(?: time)?|check-?out(?: time)?|confirmation(?: number| code)?|booking (?:reference|number|code)|reservation(?: number| code)?|host|phone|address|passenger|flight|seat|gate|terminal|boarding time|expiry date|expiration date|date of expiry|expires(?: on)?|valid until|free cancellation until|cancel(?:lation)? (?:by|before|deadline))[ \t]*[:#\-–][ \t]*(\S[^\r\n]*)$`)
+	// codes written in a sentence: "the door code is 4821"
+	documentCodeSentence = regexp.MustCompile(`(?i)\b(door|access|entry|gate|key ?box|lock ?box|key|wi-?fi) (code|password) is:? ?([A-Za-z0-9#*\-]{3,20})\b`)
+	documentTagPattern   = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)>|<[^>]+>`)
+	documentSpaces       = regexp.MustCompile(`[ \t]+`)
+	documentBlankLines   = regexp.MustCompile(`\n{3,}`)
+)
+
+var documentKinds = map[string]string{
+	".pdf":    "pdf",
+	".pkpass": "pass",
+	".ics":    "calendar",
+	".eml":    "email",
+	".html":   "text",
+	".htm":    "text",
+	".txt":    "text",
+	".jpg":    "image",
+	".jpeg":   "image",
+	".png":    "image",
+	".webp":   "image",
+	".heic":   "image",
+	".gif":    "image",
+}
+
+// DocumentKind tells what an uploaded file is from its name: pdf, pass,
+// calendar, email, text, image or file
+func DocumentKind(name string) string {
+	if kind, ok := documentKinds[strings.ToLower(filepath.Ext(name))]; ok {
+		return kind
+	}
+	return "file"
+}
+
+// DocumentText returns the text that can be read from an uploaded file
+// without the assistant. Images and unknown files have none.
+func DocumentText(name string, data []byte) string {
+	switch DocumentKind(name) {
+	case "pdf":
+		return tidyDocumentText(PDFText(data))
+	case "pass":
+		pass, err := ParsePKPass(data, time.Now().UTC())
+		if err != nil {
+			return ""
+		}
+		return passText(pass)
+	case "email":
+		msg, err := ParseMIME(strings.NewReader(string(data)))
+		if err != nil {
+			return ""
+		}
+		return tidyDocumentText(msg.PlainText())
+	case "text", "calendar":
+		text := string(data)
+		if strings.Contains(text, "<") {
+			text = html.UnescapeString(documentTagPattern.ReplaceAllString(text, "\n"))
+		}
+		return tidyDocumentText(text)
+	default:
+		return ""
+	}
+}
+
+// DocumentFields picks the labelled values out of the text of a document,
+// such as a door code, a check-in time, a confirmation number or an expiry
+// date. Labels are lower case, the first value found for a label is kept.
+func DocumentFields(text string) map[string]string {
+	fields := map[string]string{}
+	keep := func(label string, value string) {
+		label = strings.ToLower(documentSpaces.ReplaceAllString(strings.TrimSpace(label), " "))
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return
+		}
+		if len(value) > maxDocumentFieldValue {
+			value = value[:maxDocumentFieldValue]
+		}
+		if _, found := fields[label]; !found {
+			fields[label] = value
+		}
+	}
+
+	for _, match := range documentFieldLine.FindAllStringSubmatch(text, -1) {
+		keep(match[1], match[2])
+	}
+	for _, match := range documentCodeSentence.FindAllStringSubmatch(text, -1) {
+		keep(match[1]+" "+match[2], match[3])
+	}
+	return fields
+}
+
+func passText(pass *BoardingPass) string {
+	lines := make([]string, 0)
+	add := func(label string, value string) {
+		if value != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", label, value))
+		}
+	}
+	add("Passenger", pass.Passenger)
+	add("Flight", pass.Flight())
+	add("From", pass.Origin)
+	add("To", pass.Destination)
+	add("Date", pass.Date)
+	add("Departure", pass.Departure)
+	add("Boarding time", pass.BoardingTime)
+	add("Seat", pass.Seat)
+	add("Gate", pass.Gate)
+	add("Terminal", pass.Terminal)
+	add("Class", pass.Class)
+	add("Confirmation", pass.Confirmation)
+	return strings.Join(lines, "\n")
+}
+
+func tidyDocumentText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = documentSpaces.ReplaceAllString(text, " ")
+	return strings.TrimSpace(documentBlankLines.ReplaceAllString(text, "\n\n"))
+}
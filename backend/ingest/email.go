@@ -0,0 +1,149 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+const maxEmailSize = 5 << 20
+
+// Message is a forwarded confirmation email, as sent by a mail provider
+// webhook or read from a raw MIME message
+type Message struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+
+var (
+	hiddenPattern     = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	tagPattern        = regexp.MustCompile(`(?s)<[^>]*>`)
+	whitespacePattern = regexp.MustCompile(`[ \t]+`)
+)
+
+// ParseMIME reads a raw RFC 5322 message and keeps its text and HTML parts
+func ParseMIME(r io.Reader) (*Message, error) {
+	parsed, err := mail.ReadMessage(io.LimitReader(r, maxEmailSize))
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		subject = parsed.Header.Get("Subject")
+	}
+
+	msg := &Message{
+		From:    parsed.Header.Get("From"),
+		To:      parsed.Header.Get("To"),
+		Subject: subject,
+	}
+	if err := readPart(msg, parsed.Header.Get("Content-Type"), parsed.Header.Get("Content-Transfer-Encoding"), parsed.Body); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func readPart(msg *Message, contentType string, encoding string, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := readPart(msg, part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, newlineStripper{body})
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	switch mediaType {
+	case "text/html":
+		if msg.HTML == "" {
+			msg.HTML = string(data)
+		}
+	case "text/plain":
+		if msg.Text == "" {
+			msg.Text = string(data)
+		}
+	}
+	return nil
+}
+
+// newlineStripper drops line breaks, which the base64 decoder rejects
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n newlineStripper) Read(p []byte) (int, error) {
+	count, err := n.r.Read(p)
+	kept := bytes.ReplaceAll(bytes.ReplaceAll(p[:count], []byte("\r"), nil), []byte("\n"), nil)
+	copy(p, kept)
+	return len(kept), err
+}
+
+// SenderAddress is the bare address of the From header
+func (m *Message) SenderAddress() string {
+	if address, err := mail.ParseAddress(m.From); err == nil {
+		return strings.ToLower(address.Address)
+	}
+	return strings.ToLower(strings.TrimSpace(m.From))
+}
+
+// TripTag returns the tag of a plus address like trips+abc123@example.com,
+// which lets travelers pick the trip the booking belongs to
+func (m *Message) TripTag() string {
+	addresses, err := mail.ParseAddressList(m.To)
+	if err != nil {
+		return ""
+	}
+	for _, address := range addresses {
+		local := strings.SplitN(address.Address, "@", 2)[0]
+		if _, tag, ok := strings.Cut(local, "+"); ok && tag != "" {
+			return tag
+		}
+	}
+	return ""
+}
+
+// PlainText is the text part, or the HTML without markup when there is none
+func (m *Message) PlainText() string {
+	if strings.TrimSpace(m.Text) != "" {
+		return m.Text
+	}
+	text := hiddenPattern.ReplaceAllString(m.HTML, " ")
+	text = html.UnescapeString(tagPattern.ReplaceAllString(text, " "))
+	return strings.TrimSpace(whitespacePattern.ReplaceAllString(text, " "))
+}
@@ -0,0 +1,99 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	maxPageSize      = 2 << 20
+	pageTimeout      = 10 * time.Second
+	maxPageRedirects = 5
+)
+
+var ErrPrivateAddress = errors.New("the page is not on a public address")
+
+// pageClient only connects to public addresses, so a shared link cannot make
+// the server read from its own network
+var pageClient = &http.Client{
+	Timeout: pageTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: pageTimeout,
+			Control: func(network string, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+					return ErrPrivateAddress
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxPageRedirects {
+			return errors.New("too many redirects")
+		}
+		return checkPageURL(req.URL)
+	},
+}
+
+// FetchPage reads the HTML of a web page shared by a traveler, such as a
+// booking confirmation or a restaurant page. Pages larger than 2MB are cut.
+func FetchPage(ctx context.Context, rawURL string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+	if err := checkPageURL(parsed); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	res, err := pageClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("the page answered %d", res.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return "", fmt.Errorf("the page is %s, not HTML", mediaType)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxPageSize))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func checkPageURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("only http and https pages can be read")
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("the link has no host")
+	}
+	return nil
+}
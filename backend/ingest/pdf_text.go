@@ -0,0 +1,47 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	pdfStreamPattern = regexp.MustCompile(`(?s)stream\r?\n(.*?)\r?\nendstream`)
+	pdfTextPattern   = regexp.MustCompile(`(?s)\((.*?[^\\])\)\s*(?:Tj|'|")|\[(.*?)\]\s*TJ`)
+	pdfArrayText     = regexp.MustCompile(`(?s)\((.*?[^\\])\)`)
+)
+
+// PDFText pulls the text shown by the content streams of a PDF, good enough
+// to find labelled fields on a boarding pass. Text drawn with embedded fonts
+// that remap characters comes out garbled and is best left to the assistant.
+func PDFText(data []byte) string {
+	var b strings.Builder
+	for _, match := range pdfStreamPattern.FindAllSubmatch(data, -1) {
+		content := match[1]
+		if reader, err := zlib.NewReader(bytes.NewReader(content)); err == nil {
+			if inflated, err := io.ReadAll(reader); err == nil {
+				content = inflated
+			}
+			reader.Close()
+		}
+
+		for _, shown := range pdfTextPattern.FindAllSubmatch(content, -1) {
+			if len(shown[1]) > 0 {
+				b.WriteString(unescapePDFString(string(shown[1])))
+			} else {
+				for _, part := range pdfArrayText.FindAllSubmatch(shown[2], -1) {
+					b.WriteString(unescapePDFString(string(part[1])))
+				}
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func unescapePDFString(value string) string {
+	return strings.NewReplacer(`\(`, "(", `\)`, ")", `\\`, `\`, `\n`, " ", `\r`, " ", `\t`, " ").Replace(value)
+}
@@ -0,0 +1,125 @@
+package ingest
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrNoReceipt = errors.New("no receipt could be read from the file")
+
+// Receipt is what a receipt says about a purchase. Date is the day of the
+// purchase as 2006-01-02 and Category one of the expense categories. Fields
+// the receipt does not have are left empty.
+type Receipt struct {
+	Merchant string  `json:"merchant"`
+	Total    float64 `json:"total"`
+	Currency string  `json:"currency"`
+	Date     string  `json:"date"`
+	Category string  `json:"category"`
+}
+
+var (
+	receiptTotalLine = regexp.MustCompile(`(?i)\b(grand total|total due|amount due|amount paid|total|gesamt|summe|totale|importe)\b`)
+	receiptSubtotal  = regexp.MustCompile(`(?i)sub-?\s?total|zwischensumme|\btax\b|\bvat\b|\btip\b`)
+	receiptAmount    = regexp.MustCompile(`\d{1,3}(?:[.,' ]\d{3})*(?:[.,]\d{1,3})?|\d+(?:[.,]\d{1,3})?`)
+	receiptCode      = regexp.MustCompile(`\b[A-Z]{3}\b`)
+	receiptISODate   = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`)
+	receiptDotDate   = regexp.MustCompile(`\b(\d{1,2})\.(\d{1,2})\.(\d{4})\b`)
+)
+
+// receiptSymbols are the currency signs receipts print most, the dollar is
+// taken to be the US dollar
+var receiptSymbols = []struct{ symbol, code string }{
+	{"€", "EUR"}, {"£", "GBP"}, {"¥", "JPY"}, {"₹", "INR"}, {"₩", "KRW"}, {"฿", "THB"}, {"₺", "TRY"}, {"$", "USD"},
+}
+
+// ParseReceiptText reads the total of a receipt from its text, such as the
+// text of a PDF receipt sent by email. The last line labelled as a total
+// wins, receipts print the subtotals and taxes before it.
+func ParseReceiptText(content string) (*Receipt, bool) {
+	lines := strings.Split(content, "\n")
+	receipt := &Receipt{}
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if receipt.Merchant == "" && strings.IndexFunc(line, unicode.IsLetter) >= 0 && !receiptTotalLine.MatchString(line) {
+			receipt.Merchant = line
+		}
+		if !receiptTotalLine.MatchString(line) || receiptSubtotal.MatchString(line) {
+			continue
+		}
+		amounts := receiptAmount.FindAllString(line, -1)
+		if len(amounts) == 0 {
+			continue
+		}
+		if total, ok := parseReceiptAmount(amounts[len(amounts)-1]); ok && total > 0 {
+			receipt.Total = total
+			if code := receiptCurrency(line); code != "" {
+				receipt.Currency = code
+			}
+		}
+	}
+	if receipt.Total == 0 {
+		return nil, false
+	}
+	if receipt.Currency == "" {
+		receipt.Currency = receiptCurrency(content)
+	}
+	receipt.Date = receiptDate(content)
+	return receipt, true
+}
+
+// parseReceiptAmount reads 1,234.50 and 1.234,50 alike: the last separator
+// followed by one to two digits is the decimal one
+func parseReceiptAmount(raw string) (float64, bool) {
+	raw = strings.NewReplacer(" ", "", "'", "").Replace(raw)
+	decimal := strings.LastIndexAny(raw, ".,")
+	if decimal >= 0 && len(raw)-decimal-1 <= 2 {
+		raw = strings.NewReplacer(".", "", ",", "").Replace(raw[:decimal]) + "." + raw[decimal+1:]
+	} else {
+		raw = strings.NewReplacer(".", "", ",", "").Replace(raw)
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	return value, err == nil
+}
+
+func receiptCurrency(text string) string {
+	for _, code := range receiptCode.FindAllString(text, -1) {
+		if receiptCodes[code] {
+			return code
+		}
+	}
+	for _, s := range receiptSymbols {
+		if strings.Contains(text, s.symbol) {
+			return s.code
+		}
+	}
+	return ""
+}
+
+// receiptCodes are the codes taken for a currency, three capital letters on
+// a receipt are as often a word or a tax label
+var receiptCodes = map[string]bool{
+	"USD": true, "EUR": true, "GBP": true, "JPY": true, "CHF": true, "CAD": true, "AUD": true, "NZD": true,
+	"SEK": true, "NOK": true, "DKK": true, "ISK": true, "PLN": true, "CZK": true, "HUF": true, "TRY": true,
+	"INR": true, "THB": true, "SGD": true, "HKD": true, "CNY": true, "KRW": true, "MXN": true, "BRL": true,
+	"ZAR": true, "IDR": true, "VND": true, "PHP": true, "ILS": true, "AED": true, "MAD": true,
+}
+
+func receiptDate(text string) string {
+	if m := receiptISODate.FindStringSubmatch(text); m != nil {
+		if day, err := time.Parse(time.DateOnly, m[0]); err == nil {
+			return day.Format(time.DateOnly)
+		}
+	}
+	if m := receiptDotDate.FindStringSubmatch(text); m != nil {
+		if day, err := time.Parse("2.1.2006", m[0]); err == nil {
+			return day.Format(time.DateOnly)
+		}
+	}
+	return ""
+}
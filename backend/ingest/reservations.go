@@ -0,0 +1,231 @@
+package ingest
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	KindTransportation = "transportation"
+	KindLodging        = "lodging"
+	KindActivity       = "activity"
+)
+
+// Reservation is a booking found in an email. Times are the local wall clock
+// time of the place in the form 2006-01-02T15:04:05, like the itinerary.
+type Reservation struct {
+	Kind         string  `json:"kind"`
+	Type         string  `json:"type"`
+	Name         string  `json:"name"`
+	Provider     string  `json:"provider"`
+	Origin       string  `json:"origin"`
+	Destination  string  `json:"destination"`
+	Address      string  `json:"address"`
+	Start        string  `json:"start"`
+	End          string  `json:"end"`
+	Confirmation string  `json:"confirmation"`
+	CostValue    float64 `json:"costValue"`
+	CostCurrency string  `json:"costCurrency"`
+	Notes        string  `json:"notes"`
+}
+
+var jsonLDPattern = regexp.MustCompile(`(?is)<script[^>]+type=["']?application/ld\+json["']?[^>]*>(.*?)</script>`)
+
+// ExtractReservations reads the schema.org markup that airlines, hotels and
+// booking sites embed in their confirmation emails
+func ExtractReservations(html string) []Reservation {
+	reservations := make([]Reservation, 0)
+	for _, match := range jsonLDPattern.FindAllStringSubmatch(html, -1) {
+		var data interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(match[1])), &data); err != nil {
+			continue
+		}
+		for _, item := range jsonLDItems(data) {
+			if reservation, ok := fromSchemaOrg(item); ok {
+				reservations = append(reservations, reservation)
+			}
+		}
+	}
+	return reservations
+}
+
+// jsonLDItems flattens lists and @graph containers
+func jsonLDItems(data interface{}) []map[string]interface{} {
+	switch v := data.(type) {
+	case []interface{}:
+		items := make([]map[string]interface{}, 0)
+		for _, entry := range v {
+			items = append(items, jsonLDItems(entry)...)
+		}
+		return items
+	case map[string]interface{}:
+		if graph, ok := v["@graph"]; ok {
+			return jsonLDItems(graph)
+		}
+		return []map[string]interface{}{v}
+	default:
+		return nil
+	}
+}
+
+func fromSchemaOrg(item map[string]interface{}) (Reservation, bool) {
+	target := object(item["reservationFor"])
+	reservation := Reservation{
+		Confirmation: text(item["reservationNumber"]),
+		CostCurrency: strings.ToUpper(text(item["priceCurrency"])),
+		CostValue:    number(firstValue(item["totalPrice"], item["price"])),
+	}
+
+	switch text(item["@type"]) {
+	case "FlightReservation":
+		reservation.Kind = KindTransportation
+		reservation.Type = "flight"
+		airline := object(target["airline"])
+		reservation.Provider = text(airline["name"])
+		reservation.Name = strings.TrimSpace(text(airline["iataCode"]) + text(target["flightNumber"]))
+		reservation.Origin = placeName(target["departureAirport"], "iataCode")
+		reservation.Destination = placeName(target["arrivalAirport"], "iataCode")
+		reservation.Start = wallClock(target["departureTime"])
+		reservation.End = wallClock(target["arrivalTime"])
+		if seat := text(item["airplaneSeat"]); seat != "" {
+			reservation.Notes = "Seat " + seat
+		}
+	case "TrainReservation", "BusReservation":
+		reservation.Kind = KindTransportation
+		reservation.Type = "train"
+		from, to := "departureStation", "arrivalStation"
+		if text(item["@type"]) == "BusReservation" {
+			reservation.Type = "bus"
+			from, to = "departureBusStop", "arrivalBusStop"
+		}
+		reservation.Provider = placeName(target["provider"], "")
+		reservation.Name = text(firstValue(target["trainNumber"], target["busNumber"]))
+		reservation.Origin = placeName(target[from], "")
+		reservation.Destination = placeName(target[to], "")
+		reservation.Start = wallClock(target["departureTime"])
+		reservation.End = wallClock(target["arrivalTime"])
+	case "RentalCarReservation":
+		reservation.Kind = KindTransportation
+		reservation.Type = "rental_car"
+		reservation.Provider = placeName(target["rentalCompany"], "")
+		reservation.Origin = placeName(item["pickupLocation"], "")
+		reservation.Destination = placeName(item["dropoffLocation"], "")
+		reservation.Start = wallClock(item["pickupTime"])
+		reservation.End = wallClock(item["dropoffTime"])
+	case "LodgingReservation":
+		reservation.Kind = KindLodging
+		reservation.Type = "hotel"
+		reservation.Name = text(target["name"])
+		reservation.Address = address(target["address"])
+		reservation.Start = wallClock(item["checkinDate"])
+		reservation.End = wallClock(item["checkoutDate"])
+	case "EventReservation", "FoodEstablishmentReservation":
+		reservation.Kind = KindActivity
+		reservation.Name = text(target["name"])
+		location := object(firstValue(target["location"], target))
+		reservation.Address = firstNonEmpty(address(location["address"]), text(location["name"]))
+		reservation.Start = wallClock(firstValue(item["startTime"], target["startDate"]))
+		reservation.End = wallClock(target["endDate"])
+	default:
+		return reservation, false
+	}
+
+	return reservation, reservation.Start != ""
+}
+
+func object(value interface{}) map[string]interface{} {
+	if m, ok := value.(map[string]interface{}); ok {
+		return m
+	}
+	return map[string]interface{}{}
+}
+
+func text(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+func number(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case string:
+		parsed, _ := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(v), ",", ""), 64)
+		return parsed
+	default:
+		return 0
+	}
+}
+
+func firstValue(values ...interface{}) interface{} {
+	for _, value := range values {
+		if value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+// placeName prefers a code such as the IATA code of an airport over the name
+func placeName(value interface{}, codeKey string) string {
+	if name := text(value); name != "" {
+		return name
+	}
+	place := object(value)
+	if codeKey != "" {
+		if code := text(place[codeKey]); code != "" {
+			return code
+		}
+	}
+	return text(place["name"])
+}
+
+func address(value interface{}) string {
+	if line := text(value); line != "" {
+		return line
+	}
+	parts := object(value)
+	kept := make([]string, 0)
+	for _, key := range []string{"streetAddress", "addressLocality", "addressRegion", "postalCode", "addressCountry"} {
+		part := text(parts[key])
+		if part == "" {
+			part = text(object(parts[key])["name"])
+		}
+		if part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, ", ")
+}
+
+// wallClock drops the UTC offset of a schema.org time, keeping the local time
+func wallClock(value interface{}) string {
+	raw := text(value)
+	switch {
+	case len(raw) >= 19:
+		return strings.Replace(raw[:19], " ", "T", 1)
+	case len(raw) >= 16:
+		return strings.Replace(raw[:16], " ", "T", 1) + ":00"
+	case len(raw) == 10:
+		return raw + "T00:00:00"
+	default:
+		return ""
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
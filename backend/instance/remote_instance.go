@@ -0,0 +1,326 @@
+package instance
+
+import (
+	_import "backend/trips/import"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// RemoteInstance copies users and trips from another Surmai instance using its
+// public API. Trips are transferred through the regular export archive so the
+// local import takes care of creating new ids and uploading files. The owner
+// and collaborators are mapped to local users by email and each copied trip
+// keeps its remote id in sourceTripId, so a second run skips it.
+type RemoteInstance struct {
+	Url      string
+	Email    string
+	Password string
+
+	token  string
+	client *http.Client
+}
+
+type MigrationResult struct {
+	RemoteTripId string `json:"remoteTripId"`
+	LocalTripId  string `json:"localTripId,omitempty"`
+	OwnerEmail   string `json:"ownerEmail"`
+	CreatedUser  bool   `json:"createdUser"`
+	// Skipped is set when the trip was copied by an earlier run
+	Skipped bool   `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type remoteRecordList struct {
+	Page       int                      `json:"page"`
+	TotalPages int                      `json:"totalPages"`
+	Items      []map[string]interface{} `json:"items"`
+}
+
+func (r *RemoteInstance) Authenticate() error {
+	r.client = &http.Client{Timeout: 5 * time.Minute}
+	r.Url = strings.TrimRight(r.Url, "/")
+
+	var auth struct {
+		Token string `json:"token"`
+	}
+	err := r.call(http.MethodPost, "/api/collections/_superusers/auth-with-password", map[string]string{
+		"identity": r.Email,
+		"password": r.Password,
+	}, &auth)
+	if err != nil {
+		return err
+	}
+	if auth.Token == "" {
+		return errors.New("remote instance did not return an auth token")
+	}
+	r.token = auth.Token
+	return nil
+}
+
+// Migrate copies the selected trips into the local app. When no trip ids are
+// given, every trip owned by the selected users (or all trips when no users
+// are selected either) is copied.
+func (r *RemoteInstance) Migrate(app core.App, tripIds []string, userEmails []string) ([]*MigrationResult, error) {
+
+	trips, err := r.selectTrips(tripIds, userEmails)
+	if err != nil {
+		return nil, err
+	}
+
+	// remote user id -> local user id
+	userMapping := map[string]string{}
+	results := make([]*MigrationResult, 0, len(trips))
+
+	for _, trip := range trips {
+		remoteTripId, _ := trip["id"].(string)
+		remoteOwnerId, _ := trip["ownerId"].(string)
+		result := &MigrationResult{RemoteTripId: remoteTripId}
+		results = append(results, result)
+
+		if existing, _ := app.FindFirstRecordByFilter("trips", "sourceTripId = {:id}", dbx.Params{"id": remoteTripId}); existing != nil {
+			result.LocalTripId = existing.Id
+			result.Skipped = true
+			continue
+		}
+
+		localOwnerId, created, userErr := r.mapUser(app, userMapping, remoteOwnerId)
+		if userErr != nil {
+			result.Error = userErr.Error()
+			continue
+		}
+		result.CreatedUser = created
+
+		if owner, userErr := app.FindRecordById("users", localOwnerId); userErr == nil {
+			result.OwnerEmail = owner.GetString("email")
+		}
+
+		archive, exportErr := r.exportTrip(remoteTripId)
+		if exportErr != nil {
+			result.Error = exportErr.Error()
+			continue
+		}
+
+		localTripId, importErr := _import.ImportBytes(app, archive, localOwnerId)
+		if importErr != nil {
+			result.Error = importErr.Error()
+			continue
+		}
+		result.LocalTripId = localTripId
+
+		if err := r.linkTrip(app, localTripId, trip, userMapping); err != nil {
+			result.Error = err.Error()
+		}
+	}
+
+	return results, nil
+}
+
+// mapUser returns the local user for the remote user id, looking it up or
+// creating it the first time the remote user is seen
+func (r *RemoteInstance) mapUser(app core.App, userMapping map[string]string, remoteUserId string) (string, bool, error) {
+	if localUserId, ok := userMapping[remoteUserId]; ok {
+		return localUserId, false, nil
+	}
+
+	user, created, err := r.ensureLocalUser(app, remoteUserId)
+	if err != nil {
+		return "", false, err
+	}
+	userMapping[remoteUserId] = user.Id
+	return user.Id, created, nil
+}
+
+// linkTrip records the remote id on the imported trip and adds the remote
+// collaborators, with their roles, as the matching local users. The export
+// archive leaves collaborators out since their ids only mean something on the
+// source instance.
+func (r *RemoteInstance) linkTrip(app core.App, localTripId string, remoteTrip map[string]interface{}, userMapping map[string]string) error {
+
+	trip, err := app.FindRecordById("trips", localTripId)
+	if err != nil {
+		return err
+	}
+
+	remoteRoles := map[string]string{}
+	if raw, ok := remoteTrip["collaboratorRoles"].(map[string]interface{}); ok {
+		for userId, role := range raw {
+			if role, ok := role.(string); ok {
+				remoteRoles[userId] = role
+			}
+		}
+	}
+
+	collaborators := make([]string, 0)
+	roles := map[string]string{}
+	var failed []string
+	remoteCollaborators, _ := remoteTrip["collaborators"].([]interface{})
+	for _, value := range remoteCollaborators {
+		remoteUserId, _ := value.(string)
+		if remoteUserId == "" {
+			continue
+		}
+		localUserId, _, userErr := r.mapUser(app, userMapping, remoteUserId)
+		if userErr != nil {
+			failed = append(failed, userErr.Error())
+			continue
+		}
+		if localUserId == trip.GetString("ownerId") {
+			continue
+		}
+		collaborators = append(collaborators, localUserId)
+		if role, ok := remoteRoles[remoteUserId]; ok {
+			roles[localUserId] = role
+		}
+	}
+
+	trip.Set("sourceTripId", remoteTrip["id"])
+	trip.Set("collaborators", collaborators)
+	trip.Set("collaboratorRoles", roles)
+	if err := app.Save(trip); err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("some collaborators were not copied: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (r *RemoteInstance) selectTrips(tripIds []string, userEmails []string) ([]map[string]interface{}, error) {
+
+	filters := make([]string, 0)
+	for _, id := range tripIds {
+		filters = append(filters, fmt.Sprintf("id='%s'", escapeFilterValue(id)))
+	}
+	if len(tripIds) == 0 {
+		for _, email := range userEmails {
+			filters = append(filters, fmt.Sprintf("ownerId.email='%s'", escapeFilterValue(email)))
+		}
+	}
+
+	return r.listRecords("trips", strings.Join(filters, " || "))
+}
+
+func (r *RemoteInstance) listRecords(collection string, filter string) ([]map[string]interface{}, error) {
+
+	items := make([]map[string]interface{}, 0)
+	for page := 1; ; page++ {
+		query := url.Values{}
+		query.Set("page", fmt.Sprintf("%d", page))
+		query.Set("perPage", "200")
+		if filter != "" {
+			query.Set("filter", filter)
+		}
+
+		var list remoteRecordList
+		if err := r.call(http.MethodGet, fmt.Sprintf("/api/collections/%s/records?%s", collection, query.Encode()), nil, &list); err != nil {
+			return nil, err
+		}
+		items = append(items, list.Items...)
+		if page >= list.TotalPages {
+			break
+		}
+	}
+	return items, nil
+}
+
+// ensureLocalUser finds the local account matching the remote user's email or
+// creates one. Password hashes cannot be read through the API, so new accounts
+// get a random password and have to go through the password reset flow.
+func (r *RemoteInstance) ensureLocalUser(app core.App, remoteUserId string) (*core.Record, bool, error) {
+
+	var remoteUser map[string]interface{}
+	if err := r.call(http.MethodGet, "/api/collections/users/records/"+url.PathEscape(remoteUserId), nil, &remoteUser); err != nil {
+		return nil, false, err
+	}
+
+	email, _ := remoteUser["email"].(string)
+	if email == "" {
+		return nil, false, fmt.Errorf("remote user %s has no visible email", remoteUserId)
+	}
+
+	if existing, err := app.FindAuthRecordByEmail("users", email); err == nil {
+		return existing, false, nil
+	}
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		return nil, false, err
+	}
+
+	record := core.NewRecord(users)
+	record.Set("email", email)
+	record.Set("emailVisibility", true)
+	record.Set("verified", true)
+	record.Set("password", security.RandomString(30))
+	for _, field := range []string{"name", "timezone", "currencyCode", "colorScheme", "mapsProvider"} {
+		if val, ok := remoteUser[field]; ok {
+			record.Set(field, val)
+		}
+	}
+
+	if err := app.Save(record); err != nil {
+		return nil, false, err
+	}
+	return record, true, nil
+}
+
+func (r *RemoteInstance) exportTrip(tripId string) ([]byte, error) {
+	var export struct {
+		Data string `json:"data"`
+	}
+	if err := r.call(http.MethodPost, fmt.Sprintf("/api/surmai/trip/%s/export", url.PathEscape(tripId)), nil, &export); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(export.Data)
+}
+
+func (r *RemoteInstance) call(method string, path string, body interface{}, out interface{}) error {
+
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, r.Url+path, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", r.token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s failed with %s: %s", method, path, resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func escapeFilterValue(value string) string {
+	return strings.ReplaceAll(value, "'", "\\'")
+}
@@ -0,0 +1,65 @@
+package jobs
+
+import (
+	"backend/notifications"
+	"backend/trips"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+)
+
+// DocumentExpiryJob reminds the owners of vault documents that expire before
+// or too soon after their trip. Each expiry date is reminded of once, a
+// renewed document with a new date is looked at again.
+type DocumentExpiryJob struct {
+	Pb *pocketbase.PocketBase
+}
+
+func (job *DocumentExpiryJob) Execute() {
+
+	app := job.Pb.App
+	l := app.Logger().WithGroup("DocumentExpiryJob")
+	now := time.Now().UTC()
+
+	documents, err := app.FindAllRecords("documents",
+		dbx.NewExp("expiresOn != '' and expiryReminded != expiresOn"))
+	if err != nil {
+		l.Error("Could not load the documents", "error", err)
+		return
+	}
+
+	for _, document := range documents {
+		trip, err := app.FindRecordById("trips", document.GetString("trip"))
+		if err != nil {
+			continue
+		}
+		message, due := trips.DocumentExpiry(document, trip, now)
+		if !due {
+			continue
+		}
+
+		err = notifications.Send(app, notifications.Notification{
+			UserId:  document.GetString("owner"),
+			TripId:  trip.Id,
+			Kind:    notifications.KindDocumentExpiring,
+			Title:   "A travel document needs renewing",
+			Message: message + ".",
+			Link:    "/trips/" + trip.Id,
+			Data: map[string]any{
+				"tripName":   trip.GetString("name"),
+				"documentId": document.Id,
+				"expiresOn":  document.GetDateTime("expiresOn").Time().Format(time.DateOnly),
+			},
+		})
+		if err != nil {
+			l.Error("Could not send the reminder", "error", err, "documentId", document.Id)
+			continue
+		}
+
+		document.Set("expiryReminded", document.GetDateTime("expiresOn"))
+		if err := app.Save(document); err != nil {
+			l.Error("Could not mark the document as reminded", "error", err, "documentId", document.Id)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package jobs
+
+import (
+	"backend/cache"
+	"backend/flights"
+	"backend/notifications"
+	"backend/trips"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// FlightStatusJob follows the flights of upcoming transportations that carry
+// a flight number. It moves their times to the latest estimate, keeps the
+// gates and terminals current, flags delays and records every change in
+// flight_updates, which clients can subscribe to.
+type FlightStatusJob struct {
+	Pb *pocketbase.PocketBase
+	// providers that track flights, by the name used in the settings
+	Providers map[string]flights.StatusProvider
+}
+
+const (
+	// departure times are local, the window is wide enough for any offset
+	flightStatusLookback  = 24 * time.Hour
+	flightStatusLookahead = 48 * time.Hour
+	// flights closer than this are checked on every run, others less often
+	flightStatusNearby        = 6 * time.Hour
+	flightStatusNearbyEvery   = 10 * time.Minute
+	flightStatusFarEvery      = 2 * time.Hour
+	flightStatusDelayed       = 15 * time.Minute
+	flightStatusWallClockTime = "2006-01-02 15:04"
+)
+
+// flightChange is one value the job changed on a transportation
+type flightChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+func (job *FlightStatusJob) Execute() {
+
+	app := job.Pb.App
+	l := app.Logger().WithGroup("FlightStatusJob")
+	now := time.Now().UTC()
+
+	config, enabled := flights.LoadProviderConfig(app)
+	provider := job.Providers[config.Provider]
+	if !enabled || provider == nil {
+		return
+	}
+
+	transportations, err := app.FindAllRecords("transportations",
+		dbx.NewExp("type = 'flight' and departureTime >= {:from} and departureTime < {:to}",
+			dbx.Params{"from": now.Add(-flightStatusLookback), "to": now.Add(flightStatusLookahead)}))
+	if err != nil {
+		l.Error("Could not load upcoming flights", "error", err)
+		return
+	}
+
+	for _, transportation := range transportations {
+		metadata := map[string]interface{}{}
+		_ = transportation.UnmarshalJSONField("metadata", &metadata)
+		if metadata == nil {
+			metadata = map[string]interface{}{}
+		}
+
+		flightNumber, _ := metadata["flightNumber"].(string)
+		flightNumber = strings.ToUpper(strings.ReplaceAll(flightNumber, " ", ""))
+		if flightNumber == "" {
+			continue
+		}
+		previous, _ := metadata["flightStatus"].(map[string]interface{})
+		if status, _ := previous["status"].(string); status == flights.StatusLanded || status == flights.StatusCancelled {
+			continue
+		}
+
+		markerKey := fmt.Sprintf("flight-status-%s", transportation.Id)
+		if _, found := cache.Get(markerKey); found {
+			continue
+		}
+		departure := transportation.GetDateTime("departureTime").Time()
+		every := flightStatusFarEvery
+		if departure.Sub(now).Abs() < flightStatusNearby {
+			every = flightStatusNearbyEvery
+		}
+		cache.Set(markerKey, true, every)
+
+		status, err := provider.GetFlightStatus(flightNumber, departure, config)
+		if err != nil {
+			l.Warn("Could not get flight status", "error", err, "flightNumber", flightNumber, "transportationId", transportation.Id)
+			continue
+		}
+
+		kinds, changes, changed := applyFlightStatus(transportation, metadata, status)
+		if !changed {
+			continue
+		}
+		if err := app.Save(transportation); err != nil {
+			l.Error("Could not update flight", "error", err, "transportationId", transportation.Id)
+			continue
+		}
+		if len(kinds) == 0 {
+			continue
+		}
+
+		if err := saveFlightUpdate(app, transportation, status, kinds, changes); err != nil {
+			l.Error("Could not record flight update", "error", err, "transportationId", transportation.Id)
+			continue
+		}
+		l.Info("Flight changed", "flightNumber", flightNumber, "status", status.Status, "tripId", transportation.GetString("trip"))
+
+		if err := notifyFlightChange(app, transportation, status, kinds, changes); err != nil {
+			l.Warn("Could not notify the travelers of the flight change", "error", err, "transportationId", transportation.Id)
+		}
+	}
+}
+
+// notifyFlightChange tells the members of the trip when the flight leaves or
+// lands at another time, or does not fly at all. Gates alone do not make a
+// notification, the flight updates carry them. Private flights are only
+// told to the owner.
+func notifyFlightChange(app core.App, transportation *core.Record, status *flights.FlightStatus, kinds []string, changes []flightChange) error {
+	if !slices.ContainsFunc(kinds, func(kind string) bool { return kind != "gate" }) {
+		return nil
+	}
+
+	trip, err := app.FindRecordById("trips", transportation.GetString("trip"))
+	if err != nil {
+		return err
+	}
+	members, err := trips.TripMembers(app, trip)
+	if err != nil {
+		return err
+	}
+
+	changed := make([]map[string]string, 0, len(changes))
+	for _, change := range changes {
+		if change.Field == "departureTime" || change.Field == "arrivalTime" || change.Field == "status" {
+			changed = append(changed, map[string]string{"field": change.Field, "from": change.From, "to": change.To})
+		}
+	}
+	private := trips.ItemPrivacy(transportation).Item
+	title := fmt.Sprintf("The time of %s changed", status.FlightNumber)
+	switch status.Status {
+	case flights.StatusCancelled, flights.StatusDiverted:
+		title = fmt.Sprintf("%s is %s", status.FlightNumber, status.Status)
+	}
+
+	batch := make([]notifications.Notification, 0, len(members))
+	for _, member := range members {
+		if private && !trips.SeesPrivate(trips.TripRole(trip, member.Id)) {
+			continue
+		}
+		batch = append(batch, notifications.Notification{
+			UserId:  member.Id,
+			TripId:  trip.Id,
+			Kind:    notifications.KindFlightChanged,
+			Title:   title,
+			Message: flightUpdateSummary(transportation, status, kinds),
+			Link:    "/trips/" + trip.Id,
+			Data: map[string]any{
+				"tripName":         trip.GetString("name"),
+				"transportationId": transportation.Id,
+				"flightNumber":     status.FlightNumber,
+				"status":           status.Status,
+				"changes":          changed,
+			},
+		})
+	}
+	notifications.SendAll(app, batch)
+	return nil
+}
+
+// applyFlightStatus copies the status onto the transportation and returns
+// the kinds of changes worth telling the travelers about along with every
+// changed value, and whether anything needs to be saved. The first check
+// keeps the booked times in the metadata.
+func applyFlightStatus(transportation *core.Record, metadata map[string]interface{}, status *flights.FlightStatus) ([]string, []flightChange, bool) {
+	kinds := make([]string, 0)
+	changes := make([]flightChange, 0)
+	addKind := func(kind string) {
+		if !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+
+	previous, _ := metadata["flightStatus"].(map[string]interface{})
+	previousStatus, _ := previous["status"].(string)
+	previousDelay, _ := previous["departureDelay"].(float64)
+	previousArrivalDelay, _ := previous["arrivalDelay"].(float64)
+
+	setTime := func(field string, value time.Time) {
+		if value.IsZero() {
+			return
+		}
+		wallClock := toWallClock(value)
+		current := transportation.GetDateTime(field)
+		if !current.IsZero() && current.Time().Equal(wallClock.Time()) {
+			return
+		}
+		changes = append(changes, flightChange{Field: field, From: formatWallClock(current), To: formatWallClock(wallClock)})
+		transportation.Set(field, wallClock)
+		addKind("time")
+	}
+	setTime("departureTime", status.Departure)
+	setTime("arrivalTime", status.Arrival)
+
+	setMetadata := func(key string, value string) {
+		current, _ := metadata[key].(string)
+		if value == "" || current == value {
+			return
+		}
+		changes = append(changes, flightChange{Field: key, From: current, To: value})
+		metadata[key] = value
+		// the first gate known is news as much as a change of gate
+		addKind("gate")
+	}
+	setMetadata("gate", status.DepartureGate)
+	setMetadata("terminal", status.DepartureTerminal)
+	setMetadata("arrivalGate", status.ArrivalGate)
+	setMetadata("arrivalTerminal", status.ArrivalTerminal)
+
+	delayed := time.Duration(status.DepartureDelay)*time.Minute >= flightStatusDelayed
+	if delayed && time.Duration(status.DepartureDelay-int(previousDelay))*time.Minute >= flightStatusDelayed {
+		addKind("delay")
+	}
+	if status.Status != previousStatus {
+		switch status.Status {
+		case flights.StatusCancelled, flights.StatusDiverted:
+			addKind(status.Status)
+		}
+		if previousStatus != "" || status.Status != flights.StatusScheduled {
+			changes = append(changes, flightChange{Field: "status", From: previousStatus, To: status.Status})
+		}
+	}
+
+	state := map[string]interface{}{
+		"status":         status.Status,
+		"delayed":        delayed,
+		"departureDelay": status.DepartureDelay,
+		"arrivalDelay":   status.ArrivalDelay,
+	}
+	for _, key := range []string{"scheduledDeparture", "scheduledArrival"} {
+		if value, ok := previous[key]; ok {
+			state[key] = value
+		}
+	}
+	if _, ok := state["scheduledDeparture"]; !ok && !status.ScheduledDeparture.IsZero() {
+		state["scheduledDeparture"] = formatWallClock(toWallClock(status.ScheduledDeparture))
+	}
+	if _, ok := state["scheduledArrival"]; !ok && !status.ScheduledArrival.IsZero() {
+		state["scheduledArrival"] = formatWallClock(toWallClock(status.ScheduledArrival))
+	}
+	metadata["flightStatus"] = state
+	transportation.Set("metadata", metadata)
+
+	changed := len(changes) > 0 || previous == nil ||
+		int(previousDelay) != status.DepartureDelay || int(previousArrivalDelay) != status.ArrivalDelay
+	return kinds, changes, changed
+}
+
+func saveFlightUpdate(app core.App, transportation *core.Record, status *flights.FlightStatus, kinds []string, changes []flightChange) error {
+	collection, err := app.FindCollectionByNameOrId("flight_updates")
+	if err != nil {
+		return err
+	}
+
+	update := core.NewRecord(collection)
+	update.Set("trip", transportation.GetString("trip"))
+	update.Set("transportation", transportation.Id)
+	update.Set("flightNumber", status.FlightNumber)
+	update.Set("status", status.Status)
+	update.Set("kinds", kinds)
+	update.Set("summary", flightUpdateSummary(transportation, status, kinds))
+	update.Set("changes", changes)
+	update.Set("private", trips.ItemPrivacy(transportation).Item)
+	return app.Save(update)
+}
+
+// flightUpdateSummary reads like "LH400 is delayed by 45 min, departs
+// 2025-05-01 12:45 from gate B12"
+func flightUpdateSummary(transportation *core.Record, status *flights.FlightStatus, kinds []string) string {
+	switch status.Status {
+	case flights.StatusCancelled:
+		return fmt.Sprintf("%s is cancelled", status.FlightNumber)
+	case flights.StatusDiverted:
+		if status.DestinationIataCode != "" {
+			return fmt.Sprintf("%s is diverted to %s", status.FlightNumber, status.DestinationIataCode)
+		}
+		return fmt.Sprintf("%s is diverted", status.FlightNumber)
+	}
+
+	parts := make([]string, 0, 3)
+	if time.Duration(status.DepartureDelay)*time.Minute >= flightStatusDelayed {
+		parts = append(parts, fmt.Sprintf("%s is delayed by %d min", status.FlightNumber, status.DepartureDelay))
+	} else {
+		parts = append(parts, fmt.Sprintf("%s has changed", status.FlightNumber))
+	}
+	for _, kind := range kinds {
+		switch kind {
+		case "time":
+			parts = append(parts, "departs "+formatWallClock(transportation.GetDateTime("departureTime")))
+		case "gate":
+			gate := strings.TrimSpace(strings.Join([]string{terminalLabel(status.DepartureTerminal), gateLabel(status.DepartureGate)}, " "))
+			if gate != "" {
+				parts = append(parts, "from "+gate)
+			}
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func terminalLabel(terminal string) string {
+	if terminal == "" {
+		return ""
+	}
+	return "terminal " + terminal
+}
+
+func gateLabel(gate string) string {
+	if gate == "" {
+		return ""
+	}
+	return "gate " + gate
+}
+
+// toWallClock stores a time of the provider as the local wall clock time of
+// its airport, which is how transportation times are kept
+func toWallClock(t time.Time) types.DateTime {
+	dt, _ := types.ParseDateTime(time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC))
+	return dt
+}
+
+func formatWallClock(dt types.DateTime) string {
+	if dt.IsZero() {
+		return ""
+	}
+	return dt.Time().Format(flightStatusWallClockTime)
+}
@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// PreTripCheckInJob has the assistant check in with the owners of trips that
+// start within a week and did not get a check-in yet. CheckIn writes and
+// sends the message, it needs the assistant which lives with the routes.
+type PreTripCheckInJob struct {
+	Pb      *pocketbase.PocketBase
+	CheckIn func(app core.App, trip *core.Record) error
+}
+
+const (
+	preTripCheckInLookahead = 7 * 24 * time.Hour
+	// trips this close to departure are past the point of a check-in
+	preTripCheckInLatest = 24 * time.Hour
+)
+
+func (job *PreTripCheckInJob) Execute() {
+
+	app := job.Pb.App
+	l := app.Logger().WithGroup("PreTripCheckInJob")
+	now := time.Now().UTC()
+
+	upcoming, err := app.FindAllRecords("trips",
+		dbx.NewExp("startDate >= {:from} and startDate < {:to} and id not in (select trip from assistant_messages where kind = 'check_in')",
+			dbx.Params{"from": now.Add(preTripCheckInLatest), "to": now.Add(preTripCheckInLookahead)}))
+	if err != nil {
+		l.Error("Could not load upcoming trips", "error", err)
+		return
+	}
+
+	for _, trip := range upcoming {
+		if err := job.CheckIn(app, trip); err != nil {
+			l.Error("Could not check in before the trip", "error", err, "tripId", trip.Id)
+		}
+	}
+}
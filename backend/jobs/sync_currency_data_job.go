@@ -1,6 +1,7 @@
 package jobs
 
 import (
+	"backend/currency"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -42,6 +43,9 @@ func (job *SyncCurrencyDataJob) Execute() {
 			}
 
 			job.updateDatabase(data)
+			if err := currency.SaveHistory(job.Pb.App, data.Rates, time.Now()); err != nil {
+				l.Error("Could not keep the rates of the day", "error", err)
+			}
 		}
 	}
 }
@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"backend/telemetry"
+	bt "backend/types"
+	"context"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+)
+
+// TelemetryJob sends the anonymous usage report once a day, but only after
+// an administrator opted in and an endpoint is configured
+type TelemetryJob struct {
+	Pb      *pocketbase.PocketBase
+	Version bt.VersionInfo
+}
+
+func (job *TelemetryJob) Execute() {
+
+	app := job.Pb.App
+	l := app.Logger().WithGroup("TelemetryJob")
+
+	endpoint := telemetry.Endpoint()
+	if endpoint == "" {
+		return
+	}
+
+	record, settings, err := telemetry.LoadSettings(app)
+	if err != nil || !settings.Enabled {
+		return
+	}
+
+	payload := telemetry.BuildPayload(app, settings, job.Version)
+	if err := telemetry.Send(context.Background(), endpoint, payload); err != nil {
+		l.Warn("Could not send telemetry", "error", err)
+		return
+	}
+
+	settings.LastSentAt = time.Now().UTC().Format(time.RFC3339)
+	if err := telemetry.SaveSettings(app, record, settings); err != nil {
+		l.Error("Could not save telemetry settings", "error", err)
+	}
+}
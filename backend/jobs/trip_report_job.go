@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"backend/trips"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+)
+
+// TripReportJob creates the post-trip report of trips that ended in the last
+// week and do not have one yet
+type TripReportJob struct {
+	Pb *pocketbase.PocketBase
+}
+
+const tripReportLookback = 7 * 24 * time.Hour
+
+func (job *TripReportJob) Execute() {
+
+	app := job.Pb.App
+	l := app.Logger().WithGroup("TripReportJob")
+	now := time.Now().UTC()
+
+	finished, err := app.FindAllRecords("trips",
+		dbx.NewExp("endDate < {:now} and endDate >= {:from} and (report is null or report = '' or report = 'null')",
+			dbx.Params{"now": now, "from": now.Add(-tripReportLookback)}))
+	if err != nil {
+		l.Error("Could not load finished trips", "error", err)
+		return
+	}
+
+	for _, trip := range finished {
+		report, err := trips.BuildTripReport(app, trip)
+		if err != nil {
+			l.Warn("Could not build trip report", "error", err, "tripId", trip.Id)
+			continue
+		}
+		if err := trips.SaveTripReport(app, trip, report); err != nil {
+			l.Error("Could not save trip report", "error", err, "tripId", trip.Id)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"backend/notifications"
+	"backend/trips"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+)
+
+// TripStartingJob reminds the members of a trip that it starts in a few
+// days. A trip is announced once, trips created closer to their start are
+// announced on the next run.
+type TripStartingJob struct {
+	Pb *pocketbase.PocketBase
+}
+
+const tripStartingLookahead = 3 * 24 * time.Hour
+
+func (job *TripStartingJob) Execute() {
+
+	app := job.Pb.App
+	l := app.Logger().WithGroup("TripStartingJob")
+	now := time.Now().UTC()
+
+	upcoming, err := app.FindAllRecords("trips",
+		dbx.NewExp("startDate >= {:from} and startDate < {:to} and id not in (select trip from notifications where kind = {:kind})",
+			dbx.Params{"from": now, "to": now.Add(tripStartingLookahead), "kind": notifications.KindTripStarting}))
+	if err != nil {
+		l.Error("Could not load upcoming trips", "error", err)
+		return
+	}
+
+	for _, trip := range upcoming {
+		members, err := trips.TripMembers(app, trip)
+		if err != nil {
+			l.Error("Could not load the members of the trip", "error", err, "tripId", trip.Id)
+			continue
+		}
+
+		startDate := trip.GetDateTime("startDate").Time()
+		when := fmt.Sprintf("in %d days", int(math.Ceil(startDate.Sub(now).Hours()/24)))
+		if startDate.Sub(now) <= 24*time.Hour {
+			when = "tomorrow"
+		}
+		title := fmt.Sprintf("%s starts %s", trip.GetString("name"), when)
+
+		batch := make([]notifications.Notification, 0, len(members))
+		for _, member := range members {
+			batch = append(batch, notifications.Notification{
+				UserId:  member.Id,
+				TripId:  trip.Id,
+				Kind:    notifications.KindTripStarting,
+				Title:   title,
+				Message: fmt.Sprintf("%s, on %s.", title, startDate.Format("Monday, January 2")),
+				Link:    "/trips/" + trip.Id,
+				Data: map[string]any{
+					"tripName":  trip.GetString("name"),
+					"startDate": startDate.Format("Monday, January 2"),
+				},
+			})
+		}
+		notifications.SendAll(app, batch)
+	}
+}
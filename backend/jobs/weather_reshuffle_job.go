@@ -0,0 +1,212 @@
+package jobs
+
+import (
+	"backend/planning"
+	"backend/proposals"
+	bt "backend/types"
+	"backend/weather"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// WeatherReshuffleJob looks at outdoor activities in the next 48 hours and,
+// when heavy rain is forecast, proposes swapping them with an indoor activity
+// planned on a drier day of the same trip
+type WeatherReshuffleJob struct {
+	Pb       *pocketbase.PocketBase
+	Provider weather.DataProvider
+}
+
+const weatherReshuffleWindow = 48 * time.Hour
+
+// a declined swap isn't proposed again for the activity for this long
+const weatherReshuffleDeclineWindow = 24 * time.Hour
+
+func (job *WeatherReshuffleJob) Execute() {
+
+	app := job.Pb.App
+	l := app.Logger().WithGroup("WeatherReshuffleJob")
+	now := time.Now().UTC()
+
+	activities, err := app.FindAllRecords("activities",
+		dbx.NewExp("startDate >= {:from} and startDate < {:to}",
+			dbx.Params{"from": now, "to": now.Add(weatherReshuffleWindow)}))
+	if err != nil {
+		l.Error("Could not load upcoming activities", "error", err)
+		return
+	}
+
+	for _, activity := range activities {
+		if swapPendingOrDeclined(app, activity.Id, now) {
+			continue
+		}
+
+		proposal, err := job.reshuffleProposal(app, activity)
+		if err != nil {
+			l.Warn("Could not check weather for activity", "error", err, "activityId", activity.Id)
+			continue
+		}
+		if proposal == nil {
+			continue
+		}
+
+		if _, created := proposals.StoreUnique(proposal); created {
+			proposals.RecordIssued(app, proposal, "")
+		}
+		l.Info("Proposed weather swap", "activityId", activity.Id, "tripId", proposal.TripID)
+	}
+}
+
+// swapPendingOrDeclined looks in the assistant_actions audit log for a swap of
+// the activity that is still waiting for a decision or was declined recently,
+// so neither is proposed again, also after a restart of the server
+func swapPendingOrDeclined(app core.App, activityId string, now time.Time) bool {
+	records, err := app.FindAllRecords("assistant_actions",
+		dbx.HashExp{"tool": proposals.ToolSwapActivities},
+		dbx.NewExp("json_extract([[arguments]], '$.first_record_id') = {:activityId}", dbx.Params{"activityId": activityId}),
+		dbx.Or(
+			dbx.NewExp("status = {:proposed} and expiresAt > {:now}",
+				dbx.Params{"proposed": proposals.StatusProposed, "now": now.Format("2006-01-02 15:04:05.000Z")}),
+			dbx.NewExp("status = {:declined} and updated > {:since}",
+				dbx.Params{"declined": proposals.StatusDeclined, "since": now.Add(-weatherReshuffleDeclineWindow).Format("2006-01-02 15:04:05.000Z")}),
+		))
+	return err == nil && len(records) > 0
+}
+
+func (job *WeatherReshuffleJob) reshuffleProposal(app core.App, activity *core.Record) (*proposals.Proposal, error) {
+
+	var metadata map[string]interface{}
+	_ = activity.UnmarshalJSONField("metadata", &metadata)
+	place, _ := metadata["place"].(map[string]interface{})
+	category, _ := place["category"].(string)
+
+	setting := planning.ClassifyActivity(activity.GetString("name"), activity.GetString("description"), category)
+	if setting != planning.Outdoor {
+		return nil, nil
+	}
+
+	trip, err := app.FindRecordById("trips", activity.GetString("trip"))
+	if err != nil {
+		return nil, err
+	}
+
+	latitude, longitude, ok := activityCoordinates(trip, activity, place)
+	if !ok {
+		return nil, nil
+	}
+
+	forecasts, err := job.Provider.GetDailyForecast(latitude, longitude)
+	if err != nil {
+		return nil, err
+	}
+
+	start := activity.GetDateTime("startDate").Time()
+	day := start.Format(time.DateOnly)
+	forecast, ok := weather.ForecastFor(forecasts, day)
+	if !ok || !planning.WeatherConflict(setting, forecast.PrecipitationProbability) {
+		return nil, nil
+	}
+
+	candidate := findIndoorSwap(app, activity, forecasts)
+	if candidate == nil {
+		return nil, nil
+	}
+
+	expiresAt := start
+	if expiresAt.Sub(time.Now().UTC()) < time.Hour {
+		expiresAt = time.Now().UTC().Add(time.Hour)
+	}
+
+	return &proposals.Proposal{
+		ID:     uuid.NewString(),
+		TripID: trip.Id,
+		Tool:   proposals.ToolSwapActivities,
+		Arguments: map[string]interface{}{
+			"first_record_id":  activity.Id,
+			"second_record_id": candidate.Id,
+			"reason":           fmt.Sprintf("%.0f%% chance of rain on %s", forecast.PrecipitationProbability, day),
+		},
+		Summary: fmt.Sprintf("Rain is likely (%.0f%%) on %s during \"%s\". Swap it with \"%s\" on %s?",
+			forecast.PrecipitationProbability, day, activity.GetString("name"),
+			candidate.GetString("name"), candidate.GetDateTime("startDate").Time().Format(time.DateOnly)),
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// findIndoorSwap picks the indoor activity, on another upcoming day of the same
+// trip, whose day has the lowest chance of rain at the outdoor activity's location
+func findIndoorSwap(app core.App, activity *core.Record, forecasts []weather.DailyForecast) *core.Record {
+
+	day := activity.GetDateTime("startDate").Time().Format(time.DateOnly)
+	others, err := app.FindAllRecords("activities",
+		dbx.NewExp("trip = {:tripId} and id != {:id} and startDate > {:now}",
+			dbx.Params{"tripId": activity.GetString("trip"), "id": activity.Id, "now": time.Now().UTC()}))
+	if err != nil {
+		return nil
+	}
+
+	var best *core.Record
+	bestRain := math.MaxFloat64
+	for _, other := range others {
+		otherDay := other.GetDateTime("startDate").Time().Format(time.DateOnly)
+		if otherDay == day {
+			continue
+		}
+		if planning.ClassifyActivity(other.GetString("name"), other.GetString("description")) != planning.Indoor {
+			continue
+		}
+
+		forecast, ok := weather.ForecastFor(forecasts, otherDay)
+		if !ok || forecast.PrecipitationProbability >= 50 {
+			continue
+		}
+		if forecast.PrecipitationProbability < bestRain {
+			best = other
+			bestRain = forecast.PrecipitationProbability
+		}
+	}
+	return best
+}
+
+func activityCoordinates(trip *core.Record, activity *core.Record, place map[string]interface{}) (float64, float64, bool) {
+
+	if latitude, longitude, ok := parseCoordinates(place["latitude"], place["longitude"]); ok {
+		return latitude, longitude, true
+	}
+
+	var destinations []bt.Destination
+	_ = json.Unmarshal([]byte(trip.GetString("destinations")), &destinations)
+
+	address := strings.ToLower(activity.GetString("address"))
+	for _, destination := range destinations {
+		if destination.Name != "" && strings.Contains(address, strings.ToLower(destination.Name)) {
+			if latitude, longitude, ok := parseCoordinates(destination.Latitude, destination.Longitude); ok {
+				return latitude, longitude, true
+			}
+		}
+	}
+
+	if len(destinations) == 1 {
+		return parseCoordinates(destinations[0].Latitude, destinations[0].Longitude)
+	}
+	return 0, 0, false
+}
+
+func parseCoordinates(lat interface{}, lng interface{}) (float64, float64, bool) {
+	latitude, latErr := strconv.ParseFloat(fmt.Sprintf("%v", lat), 64)
+	longitude, lngErr := strconv.ParseFloat(fmt.Sprintf("%v", lng), 64)
+	if latErr != nil || lngErr != nil {
+		return 0, 0, false
+	}
+	return latitude, longitude, true
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"backend/app"
 	"backend/cache"
+	"backend/encryption"
 	_ "backend/migrations"
 	"github.com/pocketbase/pocketbase"
 	"log"
@@ -26,8 +27,12 @@ func main() {
 	}
 
 	cache.InitCache()
+	if err := encryption.LoadKey(); err != nil {
+		log.Fatal(err)
+	}
 	surmai.BuildTimezoneFinder()
 	surmai.BindMigrations(isGoRun)
+	surmai.BindCommands()
 	surmai.BindRoutes()
 	surmai.BindEventHooks()
 	surmai.StartJobs()
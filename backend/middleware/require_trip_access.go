@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"backend/trips"
+
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/tools/hook"
 )
@@ -33,7 +35,14 @@ func requireTripAccess() func(*core.RequestEvent) error {
 			return e.UnauthorizedError("Cannot access this trip", nil)
 		}
 
+		// superusers reach trips through the view rule without being on them
+		role := trips.RoleOwner
+		if !e.HasSuperuserAuth() && e.Auth != nil {
+			role = trips.TripRole(trip, e.Auth.Id)
+		}
+
 		e.Set("trip", trip)
+		e.Set("tripRole", role)
 		return e.Next()
 	}
 }
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"backend/trips"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+)
+
+// RequireTripRole only lets members with at least the given role through,
+// it runs after RequireTripAccess which finds the role
+func RequireTripRole(minimum string) *hook.Handler[*core.RequestEvent] {
+	return &hook.Handler[*core.RequestEvent]{
+		Id:   "surmaiRequireTripRole",
+		Func: requireTripRole(minimum),
+	}
+}
+
+func requireTripRole(minimum string) func(*core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		role, _ := e.Get("tripRole").(string)
+		if !trips.HasRole(role, minimum) {
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "this needs the " + minimum + " role on the trip"})
+		}
+		return e.Next()
+	}
+}
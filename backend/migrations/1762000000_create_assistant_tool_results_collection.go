@@ -0,0 +1,70 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		existing, _ := app.FindCollectionByNameOrId("assistant_tool_results")
+		if existing != nil {
+			return nil
+		}
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+
+		results := core.NewBaseCollection("assistant_tool_results")
+		results.Fields.Add(
+			&core.RelationField{
+				Name:          "trip",
+				CollectionId:  trips.Id,
+				CascadeDelete: true,
+				Required:      true,
+			},
+			&core.TextField{
+				Name:     "turnId",
+				Required: true,
+			},
+			&core.TextField{
+				Name:     "tool",
+				Required: true,
+			},
+			&core.TextField{
+				Name: "query",
+			},
+			&core.JSONField{
+				Name:    "sources",
+				MaxSize: 200000,
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+
+		// written by the server only, readable by everyone on the trip
+		results.ListRule = types.Pointer("trip.ownerId = @request.auth.id || trip.collaborators.id ?= @request.auth.id")
+		results.ViewRule = types.Pointer("trip.ownerId = @request.auth.id || trip.collaborators.id ?= @request.auth.id")
+		results.AddIndex("idx_assistant_tool_results_turn", false, "trip, turnId", "")
+
+		return app.Save(results)
+	}, func(app core.App) error {
+		results, err := app.FindCollectionByNameOrId("assistant_tool_results")
+		if err != nil {
+			return err
+		}
+		return app.Delete(results)
+	})
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		existing, _ := app.FindRecordById("surmai_settings", "assistant_config")
+		if existing != nil {
+			return nil
+		}
+
+		// empty values fall back to the SURMAI_ASSISTANT_* environment variables
+		settingCollection, _ := app.FindCollectionByNameOrId("surmai_settings")
+		record := core.NewRecord(settingCollection)
+		record.Set("id", "assistant_config")
+		record.Set("value", map[string]interface{}{
+			"model":             "",
+			"proposalTtl":       "",
+			"requestTimeout":    "",
+			"heartbeatInterval": "",
+		})
+		return app.Save(record)
+	}, func(app core.App) error {
+		record, err := app.FindRecordById("surmai_settings", "assistant_config")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(record)
+	})
+}
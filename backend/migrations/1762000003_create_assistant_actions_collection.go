@@ -0,0 +1,98 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		existing, _ := app.FindCollectionByNameOrId("assistant_actions")
+		if existing != nil {
+			return nil
+		}
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		actions := core.NewBaseCollection("assistant_actions")
+		actions.Fields.Add(
+			&core.RelationField{
+				Name:          "trip",
+				CollectionId:  trips.Id,
+				CascadeDelete: true,
+				Required:      true,
+			},
+			&core.TextField{
+				Name:     "proposalId",
+				Required: true,
+			},
+			&core.TextField{
+				Name:     "tool",
+				Required: true,
+			},
+			&core.JSONField{
+				Name:    "arguments",
+				MaxSize: 100000,
+			},
+			&core.TextField{
+				Name: "summary",
+			},
+			&core.SelectField{
+				Name:      "status",
+				Required:  true,
+				MaxSelect: 1,
+				Values:    []string{"proposed", "approved", "declined", "timeout", "failed"},
+			},
+			&core.RelationField{
+				Name:         "requestedBy",
+				CollectionId: users.Id,
+				MaxSelect:    1,
+			},
+			&core.RelationField{
+				Name:         "decidedBy",
+				CollectionId: users.Id,
+				MaxSelect:    1,
+			},
+			&core.TextField{
+				Name: "resultRecordId",
+			},
+			&core.TextField{
+				Name: "message",
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+
+		// written by the server only, readable by everyone on the trip
+		actions.ListRule = types.Pointer("trip.ownerId = @request.auth.id || trip.collaborators.id ?= @request.auth.id")
+		actions.ViewRule = types.Pointer("trip.ownerId = @request.auth.id || trip.collaborators.id ?= @request.auth.id")
+		actions.AddIndex("idx_assistant_actions_proposal", true, "proposalId", "")
+		actions.AddIndex("idx_assistant_actions_trip", false, "trip, created", "")
+
+		return app.Save(actions)
+	}, func(app core.App) error {
+		actions, err := app.FindCollectionByNameOrId("assistant_actions")
+		if err != nil {
+			return err
+		}
+		return app.Delete(actions)
+	})
+}
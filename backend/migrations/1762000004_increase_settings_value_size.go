@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		settings, err := app.FindCollectionByNameOrId("surmai_settings")
+		if err != nil {
+			return err
+		}
+
+		// prompt overrides in assistant_config do not fit in the original 1000 bytes
+		value, ok := settings.Fields.GetByName("value").(*core.JSONField)
+		if !ok || value.MaxSize >= 20000 {
+			return nil
+		}
+		value.MaxSize = 20000
+		return app.Save(settings)
+
+	}, func(app core.App) error {
+		return nil
+	})
+}
@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// BCP 47 tag such as en-GB, empty means en-US
+		if users.Fields.GetByName("locale") == nil {
+			users.Fields.Add(
+				&core.TextField{
+					Name: "locale",
+					Max:  35,
+				})
+		}
+		// empty means the usual format of the locale
+		if users.Fields.GetByName("timeFormat") == nil {
+			users.Fields.Add(
+				&core.SelectField{
+					Name:      "timeFormat",
+					MaxSelect: 1,
+					Values:    []string{"12h", "24h"},
+				})
+		}
+
+		return app.Save(users)
+
+	}, func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		users.Fields.RemoveByName("locale")
+		users.Fields.RemoveByName("timeFormat")
+		return app.Save(users)
+	})
+}
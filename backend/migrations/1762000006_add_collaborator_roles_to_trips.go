@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+
+		// user id -> editor or viewer, collaborators without an entry are editors
+		if trips.Fields.GetByName("collaboratorRoles") == nil {
+			trips.Fields.Add(&core.JSONField{
+				Name:    "collaboratorRoles",
+				MaxSize: 10000,
+			})
+		}
+
+		return app.Save(trips)
+
+	}, func(app core.App) error {
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		trips.Fields.RemoveByName("collaboratorRoles")
+		return app.Save(trips)
+	})
+}
@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		if trips.Fields.GetByName("report") == nil {
+			trips.Fields.Add(&core.JSONField{
+				Name:    "report",
+				MaxSize: 100000,
+			})
+		}
+		if err := app.Save(trips); err != nil {
+			return err
+		}
+
+		// lets the post-trip report tell completed activities from skipped ones
+		activities, err := app.FindCollectionByNameOrId("activities")
+		if err != nil {
+			return err
+		}
+		if activities.Fields.GetByName("status") == nil {
+			activities.Fields.Add(&core.SelectField{
+				Name:      "status",
+				MaxSelect: 1,
+				Values:    []string{"planned", "completed", "skipped"},
+			})
+		}
+		return app.Save(activities)
+
+	}, func(app core.App) error {
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		trips.Fields.RemoveByName("report")
+		if err := app.Save(trips); err != nil {
+			return err
+		}
+
+		activities, err := app.FindCollectionByNameOrId("activities")
+		if err != nil {
+			return err
+		}
+		activities.Fields.RemoveByName("status")
+		return app.Save(activities)
+	})
+}
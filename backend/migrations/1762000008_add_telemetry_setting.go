@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"github.com/google/uuid"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		existing, _ := app.FindRecordById("surmai_settings", "telemetry")
+		if existing != nil {
+			return nil
+		}
+
+		// telemetry is off until an administrator turns it on, the instance id
+		// is random and only used to count each instance once
+		settingCollection, _ := app.FindCollectionByNameOrId("surmai_settings")
+		record := core.NewRecord(settingCollection)
+		record.Set("id", "telemetry")
+		record.Set("value", map[string]interface{}{
+			"enabled":    false,
+			"instanceId": uuid.NewString(),
+		})
+		return app.Save(record)
+	}, func(app core.App) error {
+		record, err := app.FindRecordById("surmai_settings", "telemetry")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(record)
+	})
+}
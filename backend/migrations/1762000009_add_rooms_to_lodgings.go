@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		lodgings, err := app.FindCollectionByNameOrId("lodgings")
+		if err != nil {
+			return err
+		}
+
+		// list of rooms with their occupants, see types.Room
+		if lodgings.Fields.GetByName("rooms") == nil {
+			lodgings.Fields.Add(
+				&core.JSONField{
+					Name:    "rooms",
+					MaxSize: 10000,
+				},
+			)
+		}
+
+		return app.Save(lodgings)
+	}, func(app core.App) error {
+		lodgings, err := app.FindCollectionByNameOrId("lodgings")
+		if err != nil {
+			return err
+		}
+		lodgings.Fields.RemoveByName("rooms")
+		return app.Save(lodgings)
+	})
+}
@@ -0,0 +1,91 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		existing, _ := app.FindCollectionByNameOrId("equipment_rentals")
+		if existing != nil {
+			return nil
+		}
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		activities, err := app.FindCollectionByNameOrId("activities")
+		if err != nil {
+			return err
+		}
+
+		rentals := core.NewBaseCollection("equipment_rentals")
+		rentals.Fields.Add(
+			&core.TextField{
+				Name:     "item",
+				Required: true,
+			},
+			&core.RelationField{
+				Name:          "trip",
+				CollectionId:  trips.Id,
+				CascadeDelete: true,
+			},
+			&core.RelationField{
+				Name:          "activity",
+				CollectionId:  activities.Id,
+				CascadeDelete: true,
+			},
+			&core.TextField{
+				Name: "shop",
+			},
+			&core.DateField{
+				Name: "pickupTime",
+			},
+			&core.DateField{
+				Name: "returnTime",
+			},
+			&core.JSONField{
+				Name:    "deposit",
+				MaxSize: 10000,
+			},
+			&core.JSONField{
+				Name:    "cost",
+				MaxSize: 10000,
+			},
+			&core.TextField{
+				Name: "notes",
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+
+		rentals.ListRule = types.Pointer("trip.ownerId = @request.auth.id || trip.collaborators.id ?= @request.auth.id")
+		rentals.ViewRule = types.Pointer("trip.ownerId = @request.auth.id || trip.collaborators.id ?= @request.auth.id")
+		rentals.UpdateRule = types.Pointer("trip.ownerId = @request.auth.id || trip.collaborators.id ?= @request.auth.id")
+		rentals.DeleteRule = types.Pointer("trip.ownerId = @request.auth.id || trip.collaborators.id ?= @request.auth.id")
+		rentals.CreateRule = types.Pointer("trip.ownerId = @request.auth.id || trip.collaborators.id ?= @request.auth.id")
+
+		rentals.AddIndex("idx_equipment_rentals_trip", false, "trip", "")
+		rentals.AddIndex("idx_equipment_rentals_activity", false, "activity", "")
+		rentals.AddIndex("idx_equipment_rentals_returnTime", false, "returnTime", "")
+
+		return app.Save(rentals)
+	}, func(app core.App) error {
+		rentals, err := app.FindCollectionByNameOrId("equipment_rentals")
+		if err != nil {
+			return err
+		}
+		return app.Delete(rentals)
+	})
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		transportations, err := app.FindCollectionByNameOrId("transportations")
+		if err != nil {
+			return err
+		}
+
+		// seat or berth of each participant, see types.SeatAssignment
+		if transportations.Fields.GetByName("seats") == nil {
+			transportations.Fields.Add(
+				&core.JSONField{
+					Name:    "seats",
+					MaxSize: 10000,
+				},
+			)
+		}
+
+		return app.Save(transportations)
+	}, func(app core.App) error {
+		transportations, err := app.FindCollectionByNameOrId("transportations")
+		if err != nil {
+			return err
+		}
+		transportations.Fields.RemoveByName("seats")
+		return app.Save(transportations)
+	})
+}
@@ -0,0 +1,59 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	collections := []string{"transportations", "lodgings", "activities", "trip_expenses", "equipment_rentals"}
+	memberRule := "trip.ownerId = @request.auth.id || trip.collaborators.id ?= @request.auth.id"
+	// items marked private as a whole are only visible to the trip owner
+	privateItemRule := "trip.ownerId = @request.auth.id || (trip.collaborators.id ?= @request.auth.id && privacy.item != true)"
+
+	m.Register(func(app core.App) error {
+		for _, name := range collections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+
+			// {"item": true} or {"fields": ["cost", "confirmationCode", "notes"]}, see types.Privacy
+			if collection.Fields.GetByName("privacy") == nil {
+				collection.Fields.Add(&core.JSONField{
+					Name:    "privacy",
+					MaxSize: 2000,
+				})
+			}
+
+			collection.ListRule = types.Pointer(privateItemRule)
+			collection.ViewRule = types.Pointer(privateItemRule)
+			collection.UpdateRule = types.Pointer(privateItemRule)
+			collection.DeleteRule = types.Pointer(privateItemRule)
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		for _, name := range collections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+
+			collection.Fields.RemoveByName("privacy")
+			collection.ListRule = types.Pointer(memberRule)
+			collection.ViewRule = types.Pointer(memberRule)
+			collection.UpdateRule = types.Pointer(memberRule)
+			collection.DeleteRule = types.Pointer(memberRule)
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
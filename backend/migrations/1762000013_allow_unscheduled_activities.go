@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Places imported from saved lists become activities without a date until
+// they are scheduled, and carry more metadata than a regular activity
+func init() {
+	m.Register(func(app core.App) error {
+
+		activities, err := app.FindCollectionByNameOrId("activities")
+		if err != nil {
+			return err
+		}
+
+		if startDate, ok := activities.Fields.GetByName("startDate").(*core.DateField); ok {
+			startDate.Required = false
+		}
+		if metadata, ok := activities.Fields.GetByName("metadata").(*core.JSONField); ok && metadata.MaxSize < 10000 {
+			metadata.MaxSize = 10000
+		}
+
+		return app.Save(activities)
+	}, func(app core.App) error {
+
+		activities, err := app.FindCollectionByNameOrId("activities")
+		if err != nil {
+			return err
+		}
+
+		if startDate, ok := activities.Fields.GetByName("startDate").(*core.DateField); ok {
+			startDate.Required = true
+		}
+
+		return app.Save(activities)
+	})
+}
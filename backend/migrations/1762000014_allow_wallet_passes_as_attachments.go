@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Apple Wallet passes are zip archives, uploaded boarding passes are kept
+// with the other trip attachments
+func init() {
+	passTypes := []string{"application/vnd.apple.pkpass", "application/zip"}
+
+	m.Register(func(app core.App) error {
+
+		attachments, err := app.FindCollectionByNameOrId("trip_attachments")
+		if err != nil {
+			return err
+		}
+
+		if file, ok := attachments.Fields.GetByName("file").(*core.FileField); ok {
+			for _, mimeType := range passTypes {
+				if !slices.Contains(file.MimeTypes, mimeType) {
+					file.MimeTypes = append(file.MimeTypes, mimeType)
+				}
+			}
+		}
+
+		return app.Save(attachments)
+	}, func(app core.App) error {
+
+		attachments, err := app.FindCollectionByNameOrId("trip_attachments")
+		if err != nil {
+			return err
+		}
+
+		if file, ok := attachments.Fields.GetByName("file").(*core.FileField); ok {
+			file.MimeTypes = slices.DeleteFunc(file.MimeTypes, func(mimeType string) bool {
+				return slices.Contains(passTypes, mimeType)
+			})
+		}
+
+		return app.Save(attachments)
+	})
+}
@@ -0,0 +1,69 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		existing, _ := app.FindCollectionByNameOrId("trip_templates")
+		if existing != nil {
+			return nil
+		}
+
+		templates := core.NewBaseCollection("trip_templates")
+		templates.Fields.Add(
+			&core.TextField{
+				Name:     "name",
+				Required: true,
+			},
+			&core.RelationField{
+				Name:          "ownerId",
+				CollectionId:  "_pb_users_auth_",
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			&core.TextField{
+				Name: "sourceTrip",
+			},
+			&core.NumberField{
+				Name:    "days",
+				OnlyInt: true,
+			},
+			&core.JSONField{
+				Name:    "template",
+				MaxSize: 5000000,
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+
+		// templates are made from a trip by the server, owners can rename
+		// and remove them
+		templates.ListRule = types.Pointer("ownerId = @request.auth.id")
+		templates.ViewRule = types.Pointer("ownerId = @request.auth.id")
+		templates.UpdateRule = types.Pointer("ownerId = @request.auth.id && @request.body.ownerId:isset = false && @request.body.template:isset = false")
+		templates.DeleteRule = types.Pointer("ownerId = @request.auth.id")
+
+		templates.AddIndex("idx_trip_templates_ownerId", false, "ownerId", "")
+
+		return app.Save(templates)
+	}, func(app core.App) error {
+		templates, err := app.FindCollectionByNameOrId("trip_templates")
+		if err != nil {
+			return err
+		}
+		return app.Delete(templates)
+	})
+}
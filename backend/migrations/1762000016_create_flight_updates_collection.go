@@ -0,0 +1,83 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		existing, _ := app.FindCollectionByNameOrId("flight_updates")
+		if existing != nil {
+			return nil
+		}
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		transportations, err := app.FindCollectionByNameOrId("transportations")
+		if err != nil {
+			return err
+		}
+
+		updates := core.NewBaseCollection("flight_updates")
+		updates.Fields.Add(
+			&core.RelationField{
+				Name:          "trip",
+				CollectionId:  trips.Id,
+				CascadeDelete: true,
+				Required:      true,
+			},
+			&core.RelationField{
+				Name:          "transportation",
+				CollectionId:  transportations.Id,
+				CascadeDelete: true,
+				Required:      true,
+			},
+			&core.TextField{
+				Name: "flightNumber",
+			},
+			&core.TextField{
+				Name: "status",
+			},
+			&core.SelectField{
+				Name:      "kinds",
+				MaxSelect: 5,
+				Values:    []string{"time", "delay", "gate", "cancelled", "diverted"},
+			},
+			&core.TextField{
+				Name: "summary",
+			},
+			&core.JSONField{
+				Name:    "changes",
+				MaxSize: 10000,
+			},
+			// copied from the transportation, collaborators do not see
+			// updates of flights the owner keeps private
+			&core.BoolField{
+				Name: "private",
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+		)
+
+		// written by the flight status job only
+		updates.ListRule = types.Pointer("trip.ownerId = @request.auth.id || (trip.collaborators.id ?= @request.auth.id && private = false)")
+		updates.ViewRule = types.Pointer("trip.ownerId = @request.auth.id || (trip.collaborators.id ?= @request.auth.id && private = false)")
+
+		updates.AddIndex("idx_flight_updates_trip", false, "trip, created", "")
+
+		return app.Save(updates)
+	}, func(app core.App) error {
+		updates, err := app.FindCollectionByNameOrId("flight_updates")
+		if err != nil {
+			return err
+		}
+		return app.Delete(updates)
+	})
+}
@@ -0,0 +1,83 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		existing, _ := app.FindCollectionByNameOrId("assistant_messages")
+		if existing != nil {
+			return nil
+		}
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		messages := core.NewBaseCollection("assistant_messages")
+		messages.Fields.Add(
+			&core.RelationField{
+				Name:          "trip",
+				CollectionId:  trips.Id,
+				CascadeDelete: true,
+				Required:      true,
+			},
+			// the traveler the assistant wrote to
+			&core.RelationField{
+				Name:          "user",
+				CollectionId:  users.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			&core.SelectField{
+				Name:      "kind",
+				Required:  true,
+				MaxSelect: 1,
+				Values:    []string{"check_in"},
+			},
+			&core.TextField{
+				Name: "message",
+			},
+			&core.JSONField{
+				Name:    "gaps",
+				MaxSize: 100000,
+			},
+			&core.JSONField{
+				Name:    "proposalIds",
+				MaxSize: 10000,
+			},
+			&core.BoolField{
+				Name: "dismissed",
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+		)
+
+		// written by the server, the traveler only marks them as read
+		messages.ListRule = types.Pointer("user = @request.auth.id")
+		messages.ViewRule = types.Pointer("user = @request.auth.id")
+		messages.UpdateRule = types.Pointer("user = @request.auth.id && @request.body.trip:isset = false && @request.body.user:isset = false && @request.body.kind:isset = false && @request.body.message:isset = false && @request.body.gaps:isset = false && @request.body.proposalIds:isset = false")
+
+		messages.AddIndex("idx_assistant_messages_trip", false, "trip, kind", "")
+
+		return app.Save(messages)
+	}, func(app core.App) error {
+		messages, err := app.FindCollectionByNameOrId("assistant_messages")
+		if err != nil {
+			return err
+		}
+		return app.Delete(messages)
+	})
+}
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// how the assistant reaches out on its own, empty means in the app only
+		if users.Fields.GetByName("notificationChannel") == nil {
+			users.Fields.Add(
+				&core.SelectField{
+					Name:      "notificationChannel",
+					MaxSelect: 1,
+					Values:    []string{"app", "email"},
+				})
+		}
+
+		return app.Save(users)
+
+	}, func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		users.Fields.RemoveByName("notificationChannel")
+		return app.Save(users)
+	})
+}
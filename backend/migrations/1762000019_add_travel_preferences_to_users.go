@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// {"likes": ["vegetarian", "quiet"], "avoid": ["chain"]}, used to rank
+		// the places the assistant suggests
+		if users.Fields.GetByName("travelPreferences") == nil {
+			users.Fields.Add(
+				&core.JSONField{
+					Name:    "travelPreferences",
+					MaxSize: 10000,
+				})
+		}
+
+		return app.Save(users)
+
+	}, func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		users.Fields.RemoveByName("travelPreferences")
+		return app.Save(users)
+	})
+}
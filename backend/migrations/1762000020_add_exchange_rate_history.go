@@ -0,0 +1,75 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// one snapshot of the rates per day, kept by SyncCurrencyDataJob so
+		// expenses can be converted at the rate of the day they were paid
+		if existing, _ := app.FindCollectionByNameOrId("currency_rate_history"); existing == nil {
+			history := core.NewBaseCollection("currency_rate_history")
+			history.Fields.Add(
+				&core.TextField{
+					Name:     "date",
+					Required: true,
+				},
+				&core.JSONField{
+					Name:    "rates",
+					MaxSize: 100000,
+				},
+				&core.AutodateField{
+					Name:     "created",
+					OnCreate: true,
+					OnUpdate: false,
+				},
+				&core.AutodateField{
+					Name:     "updated",
+					OnCreate: true,
+					OnUpdate: true,
+				},
+			)
+			history.ListRule = types.Pointer("")
+			history.ViewRule = types.Pointer("")
+			history.AddIndex("idx_currency_rate_history_date", true, "date", "")
+			if err := app.Save(history); err != nil {
+				return err
+			}
+		}
+
+		expenses, err := app.FindCollectionByNameOrId("trip_expenses")
+		if err != nil {
+			return err
+		}
+
+		// {"from": "EUR", "to": "USD", "rate": 1.08, "ratesDate": "2025-06-01", "manual": false}
+		if expenses.Fields.GetByName("exchangeRate") == nil {
+			expenses.Fields.Add(
+				&core.JSONField{
+					Name:    "exchangeRate",
+					MaxSize: 1000,
+				})
+		}
+
+		return app.Save(expenses)
+
+	}, func(app core.App) error {
+		expenses, err := app.FindCollectionByNameOrId("trip_expenses")
+		if err != nil {
+			return err
+		}
+		expenses.Fields.RemoveByName("exchangeRate")
+		if err := app.Save(expenses); err != nil {
+			return err
+		}
+
+		history, err := app.FindCollectionByNameOrId("currency_rate_history")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(history)
+	})
+}
@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		actions, err := app.FindCollectionByNameOrId("assistant_actions")
+		if err != nil {
+			return err
+		}
+
+		// entries recorded before proposals were versioned keep 0
+		if actions.Fields.GetByName("schemaVersion") == nil {
+			actions.Fields.Add(&core.NumberField{
+				Name:    "schemaVersion",
+				OnlyInt: true,
+			})
+		}
+		// what is needed to restore a pending proposal after a restart
+		if actions.Fields.GetByName("expiresAt") == nil {
+			actions.Fields.Add(&core.DateField{
+				Name: "expiresAt",
+			})
+		}
+		if actions.Fields.GetByName("contextAt") == nil {
+			actions.Fields.Add(&core.DateField{
+				Name: "contextAt",
+			})
+		}
+		if actions.Fields.GetByName("assumptions") == nil {
+			actions.Fields.Add(&core.JSONField{
+				Name:    "assumptions",
+				MaxSize: 10000,
+			})
+		}
+		actions.AddIndex("idx_assistant_actions_status", false, "status, expiresAt", "")
+
+		return app.Save(actions)
+	}, func(app core.App) error {
+		actions, err := app.FindCollectionByNameOrId("assistant_actions")
+		if err != nil {
+			return err
+		}
+		actions.RemoveIndex("idx_assistant_actions_status")
+		actions.Fields.RemoveByName("schemaVersion")
+		actions.Fields.RemoveByName("expiresAt")
+		actions.Fields.RemoveByName("contextAt")
+		actions.Fields.RemoveByName("assumptions")
+		return app.Save(actions)
+	})
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+
+		// participants with an email and a nationality do not fit a larger
+		// group in the original 1000 bytes
+		participants, ok := trips.Fields.GetByName("participants").(*core.JSONField)
+		if !ok || participants.MaxSize >= 10000 {
+			return nil
+		}
+		participants.MaxSize = 10000
+		return app.Save(trips)
+
+	}, func(app core.App) error {
+		return nil
+	})
+}
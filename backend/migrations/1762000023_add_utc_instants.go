@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// wallClockTimes are the itinerary times stored as local wall clock time
+var wallClockTimes = map[string][]string{
+	"transportations":   {"departureTime", "arrivalTime"},
+	"lodgings":          {"startDate", "endDate"},
+	"activities":        {"startDate", "endDate"},
+	"equipment_rentals": {"pickupTime", "returnTime"},
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+		// records saved before are filled in by the migrate-times command
+		for name, times := range wallClockTimes {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			for _, field := range times {
+				if collection.Fields.GetByName(field+"Utc") == nil {
+					collection.Fields.Add(&core.DateField{Name: field + "Utc"})
+				}
+				if collection.Fields.GetByName(field+"Timezone") == nil {
+					collection.Fields.Add(&core.TextField{Name: field + "Timezone", Max: 100})
+				}
+			}
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		for name, times := range wallClockTimes {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			for _, field := range times {
+				collection.Fields.RemoveByName(field + "Utc")
+				collection.Fields.RemoveByName(field + "Timezone")
+			}
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		templates, err := app.FindCollectionByNameOrId("trip_templates")
+		if err != nil {
+			return err
+		}
+
+		// the community gallery listing a template was imported from
+		if templates.Fields.GetByName("galleryId") == nil {
+			templates.Fields.Add(&core.TextField{
+				Name: "galleryId",
+			})
+		}
+		return app.Save(templates)
+	}, func(app core.App) error {
+		templates, err := app.FindCollectionByNameOrId("trip_templates")
+		if err != nil {
+			return err
+		}
+		templates.Fields.RemoveByName("galleryId")
+		return app.Save(templates)
+	})
+}
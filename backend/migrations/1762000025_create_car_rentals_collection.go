@@ -0,0 +1,114 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		existing, _ := app.FindCollectionByNameOrId("car_rentals")
+		if existing != nil {
+			return nil
+		}
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		attachments, err := app.FindCollectionByNameOrId("trip_attachments")
+		if err != nil {
+			return err
+		}
+
+		rentals := core.NewBaseCollection("car_rentals")
+		rentals.Fields.Add(
+			&core.RelationField{
+				Name:          "trip",
+				CollectionId:  trips.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			&core.TextField{
+				Name: "provider",
+			},
+			&core.TextField{
+				Name:     "pickupLocation",
+				Required: true,
+			},
+			&core.TextField{
+				Name: "dropoffLocation",
+			},
+			&core.DateField{
+				Name:     "pickupTime",
+				Required: true,
+			},
+			&core.DateField{
+				Name: "dropoffTime",
+			},
+			&core.TextField{
+				Name: "confirmationCode",
+			},
+			&core.TextField{
+				Name: "vehicleClass",
+			},
+			&core.JSONField{
+				Name:    "cost",
+				MaxSize: 10000,
+			},
+			&core.TextField{
+				Name: "notes",
+			},
+			// pickup and dropoff places with their coordinates and timezone,
+			// and what the provider sent with the booking
+			&core.JSONField{
+				Name:    "metadata",
+				MaxSize: 100000,
+			},
+			&core.RelationField{
+				Name:         "attachmentReferences",
+				CollectionId: attachments.Id,
+				MaxSelect:    100,
+			},
+			&core.JSONField{
+				Name:    "privacy",
+				MaxSize: 2000,
+			},
+			&core.DateField{Name: "pickupTimeUtc"},
+			&core.TextField{Name: "pickupTimeTimezone", Max: 100},
+			&core.DateField{Name: "dropoffTimeUtc"},
+			&core.TextField{Name: "dropoffTimeTimezone", Max: 100},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+
+		// items marked private as a whole are only visible to the trip owner
+		privateItemRule := "trip.ownerId = @request.auth.id || (trip.collaborators.id ?= @request.auth.id && privacy.item != true)"
+		rentals.ListRule = types.Pointer(privateItemRule)
+		rentals.ViewRule = types.Pointer(privateItemRule)
+		rentals.UpdateRule = types.Pointer(privateItemRule)
+		rentals.DeleteRule = types.Pointer(privateItemRule)
+		rentals.CreateRule = types.Pointer("trip.ownerId = @request.auth.id || trip.collaborators.id ?= @request.auth.id")
+
+		rentals.AddIndex("idx_car_rentals_trip", false, "trip", "")
+		rentals.AddIndex("idx_car_rentals_dropoffTime", false, "dropoffTime", "")
+
+		return app.Save(rentals)
+	}, func(app core.App) error {
+		rentals, err := app.FindCollectionByNameOrId("car_rentals")
+		if err != nil {
+			return err
+		}
+		return app.Delete(rentals)
+	})
+}
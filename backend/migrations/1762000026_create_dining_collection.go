@@ -0,0 +1,111 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		existing, _ := app.FindCollectionByNameOrId("dining")
+		if existing != nil {
+			return nil
+		}
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		attachments, err := app.FindCollectionByNameOrId("trip_attachments")
+		if err != nil {
+			return err
+		}
+
+		dining := core.NewBaseCollection("dining")
+		dining.Fields.Add(
+			&core.RelationField{
+				Name:          "trip",
+				CollectionId:  trips.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			&core.TextField{
+				Name:     "name",
+				Required: true,
+			},
+			&core.DateField{
+				Name:     "reservationTime",
+				Required: true,
+			},
+			&core.NumberField{
+				Name:    "partySize",
+				OnlyInt: true,
+				Min:     types.Pointer(0.0),
+			},
+			&core.TextField{
+				Name: "confirmationCode",
+			},
+			&core.TextField{
+				Name: "cuisine",
+			},
+			&core.TextField{
+				Name: "address",
+			},
+			&core.JSONField{
+				Name:    "cost",
+				MaxSize: 10000,
+			},
+			&core.TextField{
+				Name: "notes",
+			},
+			// the restaurant with its coordinates and timezone, like the
+			// place of an activity
+			&core.JSONField{
+				Name:    "metadata",
+				MaxSize: 100000,
+			},
+			&core.RelationField{
+				Name:         "attachmentReferences",
+				CollectionId: attachments.Id,
+				MaxSelect:    100,
+			},
+			&core.JSONField{
+				Name:    "privacy",
+				MaxSize: 2000,
+			},
+			&core.DateField{Name: "reservationTimeUtc"},
+			&core.TextField{Name: "reservationTimeTimezone", Max: 100},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+
+		// items marked private as a whole are only visible to the trip owner
+		privateItemRule := "trip.ownerId = @request.auth.id || (trip.collaborators.id ?= @request.auth.id && privacy.item != true)"
+		dining.ListRule = types.Pointer(privateItemRule)
+		dining.ViewRule = types.Pointer(privateItemRule)
+		dining.UpdateRule = types.Pointer(privateItemRule)
+		dining.DeleteRule = types.Pointer(privateItemRule)
+		dining.CreateRule = types.Pointer("trip.ownerId = @request.auth.id || trip.collaborators.id ?= @request.auth.id")
+
+		dining.AddIndex("idx_dining_trip", false, "trip", "")
+		dining.AddIndex("idx_dining_reservationTime", false, "reservationTime", "")
+
+		return app.Save(dining)
+	}, func(app core.App) error {
+		dining, err := app.FindCollectionByNameOrId("dining")
+		if err != nil {
+			return err
+		}
+		return app.Delete(dining)
+	})
+}
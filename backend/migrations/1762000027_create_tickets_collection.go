@@ -0,0 +1,125 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		existing, _ := app.FindCollectionByNameOrId("tickets")
+		if existing != nil {
+			return nil
+		}
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		activities, err := app.FindCollectionByNameOrId("activities")
+		if err != nil {
+			return err
+		}
+		attachments, err := app.FindCollectionByNameOrId("trip_attachments")
+		if err != nil {
+			return err
+		}
+
+		tickets := core.NewBaseCollection("tickets")
+		tickets.Fields.Add(
+			&core.RelationField{
+				Name:          "trip",
+				CollectionId:  trips.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			&core.RelationField{
+				Name:          "activity",
+				CollectionId:  activities.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			// the participant the ticket is for
+			&core.TextField{
+				Name: "holder",
+			},
+			// what the barcode of the ticket reads, as printed or scanned
+			&core.TextField{
+				Name: "barcode",
+				Max:  4000,
+			},
+			&core.SelectField{
+				Name:      "barcodeFormat",
+				MaxSelect: 1,
+				Values:    []string{"qr", "aztec", "pdf417", "code128", "other"},
+			},
+			&core.TextField{
+				Name: "section",
+			},
+			&core.TextField{
+				Name: "row",
+			},
+			&core.TextField{
+				Name: "seat",
+			},
+			&core.TextField{
+				Name: "gate",
+			},
+			// when the doors open and the last entry
+			&core.DateField{
+				Name: "entryStart",
+			},
+			&core.DateField{
+				Name: "entryEnd",
+			},
+			&core.TextField{
+				Name: "notes",
+			},
+			&core.RelationField{
+				Name:         "attachmentReferences",
+				CollectionId: attachments.Id,
+				MaxSelect:    100,
+			},
+			&core.JSONField{
+				Name:    "privacy",
+				MaxSize: 2000,
+			},
+			&core.DateField{Name: "entryStartUtc"},
+			&core.TextField{Name: "entryStartTimezone", Max: 100},
+			&core.DateField{Name: "entryEndUtc"},
+			&core.TextField{Name: "entryEndTimezone", Max: 100},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+
+		// items marked private as a whole are only visible to the trip owner
+		privateItemRule := "trip.ownerId = @request.auth.id || (trip.collaborators.id ?= @request.auth.id && privacy.item != true)"
+		tickets.ListRule = types.Pointer(privateItemRule)
+		tickets.ViewRule = types.Pointer(privateItemRule)
+		tickets.UpdateRule = types.Pointer(privateItemRule)
+		tickets.DeleteRule = types.Pointer(privateItemRule)
+		tickets.CreateRule = types.Pointer("trip.ownerId = @request.auth.id || trip.collaborators.id ?= @request.auth.id")
+
+		tickets.AddIndex("idx_tickets_trip", false, "trip", "")
+		tickets.AddIndex("idx_tickets_activity", false, "activity", "")
+
+		return app.Save(tickets)
+	}, func(app core.App) error {
+		tickets, err := app.FindCollectionByNameOrId("tickets")
+		if err != nil {
+			return err
+		}
+		return app.Delete(tickets)
+	})
+}
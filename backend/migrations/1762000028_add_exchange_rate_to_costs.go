@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// the trip items that, like expenses, keep the exchange rate of the day
+// they were booked
+var bookedCostCollections = []string{"transportations", "lodgings", "activities", "equipment_rentals", "car_rentals", "dining"}
+
+func init() {
+	m.Register(func(app core.App) error {
+		for _, name := range bookedCostCollections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+
+			// {"from": "EUR", "to": "USD", "rate": 1.08, "converted": 216, "ratesDate": "2025-06-01"}
+			if collection.Fields.GetByName("exchangeRate") == nil {
+				collection.Fields.Add(
+					&core.JSONField{
+						Name:    "exchangeRate",
+						MaxSize: 1000,
+					})
+			}
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		for _, name := range bookedCostCollections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue
+			}
+			collection.Fields.RemoveByName("exchangeRate")
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
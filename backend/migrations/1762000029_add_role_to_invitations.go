@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		invitations, err := app.FindCollectionByNameOrId("invitations")
+		if err != nil {
+			return err
+		}
+
+		// what the recipient joins the trip as, invitations sent before
+		// roles existed make editors
+		if invitations.Fields.GetByName("role") == nil {
+			invitations.Fields.Add(&core.SelectField{
+				Name:      "role",
+				Values:    []string{"owner", "editor", "viewer"},
+				MaxSelect: 1,
+			})
+		}
+
+		// signs the accept link, changing it revokes the links sent so far
+		if invitations.Fields.GetByName("tokenKey") == nil {
+			invitations.Fields.Add(&core.TextField{
+				Name:   "tokenKey",
+				Max:    100,
+				Hidden: true,
+			})
+		}
+
+		return app.Save(invitations)
+	}, func(app core.App) error {
+		invitations, err := app.FindCollectionByNameOrId("invitations")
+		if err != nil {
+			return err
+		}
+		invitations.Fields.RemoveByName("role")
+		invitations.Fields.RemoveByName("tokenKey")
+		return app.Save(invitations)
+	})
+}
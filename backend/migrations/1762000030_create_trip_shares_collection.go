@@ -0,0 +1,95 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		existing, _ := app.FindCollectionByNameOrId("trip_shares")
+		if existing != nil {
+			return nil
+		}
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// public read-only links to the itinerary of a trip, only reached
+		// through the share routes so the collection has no API rules
+		shares := core.NewBaseCollection("trip_shares")
+		shares.Fields.Add(
+			&core.RelationField{
+				Name:          "trip",
+				CollectionId:  trips.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			&core.RelationField{
+				Name:          "createdBy",
+				CollectionId:  users.Id,
+				CascadeDelete: true,
+				MaxSelect:     1,
+			},
+			// what the link is for, like "grandparents"
+			&core.TextField{
+				Name: "name",
+				Max:  200,
+			},
+			&core.TextField{
+				Name:     "token",
+				Required: true,
+				Max:      100,
+			},
+			// optional, asked for before the itinerary is shown
+			&core.PasswordField{
+				Name: "password",
+				Max:  71,
+			},
+			&core.BoolField{
+				Name: "hideCosts",
+			},
+			&core.BoolField{
+				Name: "hideConfirmationCodes",
+			},
+			&core.DateField{
+				Name: "expiresOn",
+			},
+			&core.NumberField{
+				Name:    "views",
+				OnlyInt: true,
+			},
+			&core.DateField{
+				Name: "lastViewedAt",
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+
+		shares.AddIndex("idx_trip_shares_token", true, "token", "")
+		shares.AddIndex("idx_trip_shares_trip", false, "trip", "")
+
+		return app.Save(shares)
+	}, func(app core.App) error {
+		shares, err := app.FindCollectionByNameOrId("trip_shares")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(shares)
+	})
+}
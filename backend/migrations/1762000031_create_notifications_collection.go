@@ -0,0 +1,93 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		existing, _ := app.FindCollectionByNameOrId("notifications")
+		if existing != nil {
+			return nil
+		}
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		notifications := core.NewBaseCollection("notifications")
+		notifications.Fields.Add(
+			&core.RelationField{
+				Name:          "user",
+				CollectionId:  users.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			&core.RelationField{
+				Name:          "trip",
+				CollectionId:  trips.Id,
+				CascadeDelete: true,
+				MaxSelect:     1,
+			},
+			// what happened, like comment_mention
+			&core.TextField{
+				Name:     "kind",
+				Required: true,
+				Max:      100,
+			},
+			&core.TextField{
+				Name: "title",
+				Max:  500,
+			},
+			&core.TextField{
+				Name: "message",
+				Max:  5000,
+			},
+			// where in the app the notification leads
+			&core.TextField{
+				Name: "link",
+				Max:  2000,
+			},
+			&core.JSONField{
+				Name:    "data",
+				MaxSize: 10000,
+			},
+			&core.DateField{
+				Name: "readAt",
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+
+		// users follow their own notifications, marking them read goes
+		// through the notification routes
+		notifications.ListRule = types.Pointer("user = @request.auth.id")
+		notifications.ViewRule = types.Pointer("user = @request.auth.id")
+
+		notifications.AddIndex("idx_notifications_user", false, "user, created", "")
+
+		return app.Save(notifications)
+	}, func(app core.App) error {
+		notifications, err := app.FindCollectionByNameOrId("notifications")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(notifications)
+	})
+}
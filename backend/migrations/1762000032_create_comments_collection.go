@@ -0,0 +1,90 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		existing, _ := app.FindCollectionByNameOrId("comments")
+		if existing != nil {
+			return nil
+		}
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// discussions on the items of a trip, they go through the comment
+		// routes which know who may see which item, so there are no API rules
+		comments := core.NewBaseCollection("comments")
+		comments.Fields.Add(
+			&core.RelationField{
+				Name:          "trip",
+				CollectionId:  trips.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			// the item the comment is on
+			&core.SelectField{
+				Name:      "collection",
+				Required:  true,
+				MaxSelect: 1,
+				Values:    []string{"activities", "lodgings", "transportations"},
+			},
+			&core.TextField{
+				Name:     "recordId",
+				Required: true,
+				Max:      50,
+			},
+			&core.RelationField{
+				Name:          "author",
+				CollectionId:  users.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			&core.TextField{
+				Name:     "body",
+				Required: true,
+				Max:      5000,
+			},
+			// the members @mentioned in the body
+			&core.RelationField{
+				Name:         "mentions",
+				CollectionId: users.Id,
+				MaxSelect:    100,
+			},
+			&core.DateField{
+				Name: "editedAt",
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+
+		comments.AddIndex("idx_comments_item", false, "trip, collection, recordId", "")
+
+		return app.Save(comments)
+	}, func(app core.App) error {
+		comments, err := app.FindCollectionByNameOrId("comments")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(comments)
+	})
+}
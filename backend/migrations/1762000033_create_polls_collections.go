@@ -0,0 +1,150 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		existing, _ := app.FindCollectionByNameOrId("polls")
+		if existing != nil {
+			return nil
+		}
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		activities, err := app.FindCollectionByNameOrId("activities")
+		if err != nil {
+			return err
+		}
+
+		// the members of a trip vote on what to do, polls and votes go
+		// through the poll routes so neither collection has API rules
+		polls := core.NewBaseCollection("polls")
+		polls.Fields.Add(
+			&core.RelationField{
+				Name:          "trip",
+				CollectionId:  trips.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			// empty for the polls the assistant proposed
+			&core.RelationField{
+				Name:         "createdBy",
+				CollectionId: users.Id,
+				MaxSelect:    1,
+			},
+			&core.TextField{
+				Name:     "question",
+				Required: true,
+				Max:      500,
+			},
+			// [{"id": "a1", "name": "Louvre", "startTime": "2025-06-02T10:00:00Z", ...}]
+			&core.JSONField{
+				Name:     "options",
+				Required: true,
+				MaxSize:  20000,
+			},
+			// votes needed before a winner is picked, 0 means a majority of
+			// the members
+			&core.NumberField{
+				Name:    "quorum",
+				OnlyInt: true,
+				Min:     types.Pointer(0.0),
+			},
+			// schedule the winning option as an activity on its own
+			&core.BoolField{
+				Name: "autoSchedule",
+			},
+			&core.SelectField{
+				Name:      "status",
+				Required:  true,
+				MaxSelect: 1,
+				Values:    []string{"open", "closed", "scheduled"},
+			},
+			&core.TextField{
+				Name: "winner",
+				Max:  50,
+			},
+			&core.RelationField{
+				Name:         "activity",
+				CollectionId: activities.Id,
+				MaxSelect:    1,
+			},
+			&core.DateField{
+				Name: "closesAt",
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+		polls.AddIndex("idx_polls_trip", false, "trip", "")
+		if err := app.Save(polls); err != nil {
+			return err
+		}
+
+		votes := core.NewBaseCollection("poll_votes")
+		votes.Fields.Add(
+			&core.RelationField{
+				Name:          "poll",
+				CollectionId:  polls.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			&core.RelationField{
+				Name:          "user",
+				CollectionId:  users.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			&core.TextField{
+				Name:     "option",
+				Required: true,
+				Max:      50,
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+		// one vote per member, voting again changes it
+		votes.AddIndex("idx_poll_votes_user", true, "poll, user", "")
+
+		return app.Save(votes)
+	}, func(app core.App) error {
+		for _, name := range []string{"poll_votes", "polls"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue
+			}
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// how each kind of notification reaches the user, kinds left out
+		// follow notificationChannel
+		if users.Fields.GetByName("notificationPreferences") == nil {
+			users.Fields.Add(&core.JSONField{
+				Name:    "notificationPreferences",
+				MaxSize: 10000,
+			})
+		}
+
+		return app.Save(users)
+	}, func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		users.Fields.RemoveByName("notificationPreferences")
+		return app.Save(users)
+	})
+}
@@ -0,0 +1,129 @@
+package migrations
+
+import (
+	"backend/push"
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// push joins app and email as a channel the notifications go out on
+		if channel, ok := users.Fields.GetByName("notificationChannel").(*core.SelectField); ok && !slices.Contains(channel.Values, "push") {
+			channel.Values = append(channel.Values, "push")
+			if err := app.Save(users); err != nil {
+				return err
+			}
+		}
+
+		// the keys web push services know the instance by, generated once
+		if existing, _ := app.FindRecordById("surmai_settings", "web_push"); existing == nil {
+			keys, err := push.GenerateVAPIDKeys()
+			if err != nil {
+				return err
+			}
+			settingCollection, err := app.FindCollectionByNameOrId("surmai_settings")
+			if err != nil {
+				return err
+			}
+			record := core.NewRecord(settingCollection)
+			record.Set("id", "web_push")
+			record.Set("value", keys)
+			if err := app.Save(record); err != nil {
+				return err
+			}
+		}
+
+		existing, _ := app.FindCollectionByNameOrId("push_subscriptions")
+		if existing != nil {
+			return nil
+		}
+
+		// the devices and services a user gets pushes on, managed through the
+		// push routes so there are no API rules
+		subscriptions := core.NewBaseCollection("push_subscriptions")
+		subscriptions.Fields.Add(
+			&core.RelationField{
+				Name:          "user",
+				CollectionId:  users.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			&core.SelectField{
+				Name:      "kind",
+				Required:  true,
+				MaxSelect: 1,
+				Values:    []string{"webpush", "ntfy", "gotify"},
+			},
+			// a name for the device, e.g. "Phone"
+			&core.TextField{
+				Name: "name",
+				Max:  100,
+			},
+			// the push service URL of a browser or the ntfy or Gotify server
+			&core.URLField{
+				Name:     "endpoint",
+				Required: true,
+			},
+			&core.TextField{
+				Name: "topic",
+				Max:  200,
+			},
+			&core.TextField{
+				Name:   "token",
+				Max:    500,
+				Hidden: true,
+			},
+			&core.TextField{
+				Name: "p256dh",
+				Max:  200,
+			},
+			&core.TextField{
+				Name:   "auth",
+				Max:    100,
+				Hidden: true,
+			},
+			&core.DateField{
+				Name: "lastUsedAt",
+			},
+			&core.TextField{
+				Name: "lastError",
+				Max:  1000,
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+
+		subscriptions.AddIndex("idx_push_subscriptions_user", false, "user", "")
+
+		return app.Save(subscriptions)
+	}, func(app core.App) error {
+		if subscriptions, _ := app.FindCollectionByNameOrId("push_subscriptions"); subscriptions != nil {
+			if err := app.Delete(subscriptions); err != nil {
+				return err
+			}
+		}
+		if record, _ := app.FindRecordById("surmai_settings", "web_push"); record != nil {
+			if err := app.Delete(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
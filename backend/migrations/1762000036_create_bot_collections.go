@@ -0,0 +1,121 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		existing, _ := app.FindCollectionByNameOrId("bot_chats")
+		if existing != nil {
+			return nil
+		}
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// group chats and channels linked to a trip, managed through the bot
+		// routes so neither collection has API rules
+		chats := core.NewBaseCollection("bot_chats")
+		chats.Fields.Add(
+			&core.SelectField{
+				Name:      "platform",
+				Required:  true,
+				MaxSelect: 1,
+				Values:    []string{"telegram", "discord"},
+			},
+			&core.TextField{
+				Name:     "chatId",
+				Required: true,
+				Max:      100,
+			},
+			&core.RelationField{
+				Name:          "trip",
+				CollectionId:  trips.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			&core.RelationField{
+				Name:         "linkedBy",
+				CollectionId: users.Id,
+				MaxSelect:    1,
+			},
+			&core.TextField{
+				Name: "title",
+				Max:  200,
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+		chats.AddIndex("idx_bot_chats_platform_chat", true, "platform, chatId", "")
+		chats.AddIndex("idx_bot_chats_trip", false, "trip", "")
+		if err := app.Save(chats); err != nil {
+			return err
+		}
+
+		// the chat accounts of the users, their approvals and questions in a
+		// chat count as theirs
+		accounts := core.NewBaseCollection("bot_accounts")
+		accounts.Fields.Add(
+			&core.SelectField{
+				Name:      "platform",
+				Required:  true,
+				MaxSelect: 1,
+				Values:    []string{"telegram", "discord"},
+			},
+			&core.TextField{
+				Name:     "externalId",
+				Required: true,
+				Max:      100,
+			},
+			&core.RelationField{
+				Name:          "user",
+				CollectionId:  users.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			&core.TextField{
+				Name: "username",
+				Max:  200,
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+		accounts.AddIndex("idx_bot_accounts_platform_external", true, "platform, externalId", "")
+		return app.Save(accounts)
+	}, func(app core.App) error {
+		for _, name := range []string{"bot_accounts", "bot_chats"} {
+			if collection, _ := app.FindCollectionByNameOrId(name); collection != nil {
+				if err := app.Delete(collection); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
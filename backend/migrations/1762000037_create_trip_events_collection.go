@@ -0,0 +1,94 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		existing, _ := app.FindCollectionByNameOrId("trip_events")
+		if existing != nil {
+			return nil
+		}
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// who changed what on a trip, written by the record hooks and read
+		// through the activity route so there are no API rules
+		events := core.NewBaseCollection("trip_events")
+		events.Fields.Add(
+			&core.RelationField{
+				Name:          "trip",
+				CollectionId:  trips.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			// empty for changes the server made, like the assistant applying
+			// an approved proposal or a job
+			&core.RelationField{
+				Name:         "actor",
+				CollectionId: users.Id,
+				MaxSelect:    1,
+			},
+			&core.SelectField{
+				Name:      "action",
+				Required:  true,
+				MaxSelect: 1,
+				Values:    []string{"create", "update", "delete"},
+			},
+			&core.TextField{
+				Name:     "collection",
+				Required: true,
+				Max:      100,
+			},
+			&core.TextField{
+				Name:     "recordId",
+				Required: true,
+				Max:      50,
+			},
+			&core.TextField{
+				Name: "label",
+				Max:  500,
+			},
+			// [{"field": "startDate", "from": "2025-06-02 10:00:00.000Z", "to": "2025-06-02 11:00:00.000Z"}]
+			&core.JSONField{
+				Name:    "changes",
+				MaxSize: 200000,
+			},
+			// the privacy of the item when it changed, the changes of private
+			// items and fields are only shown to the owner
+			&core.BoolField{
+				Name: "private",
+			},
+			&core.JSONField{
+				Name:    "privateFields",
+				MaxSize: 1000,
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+		)
+
+		events.AddIndex("idx_trip_events_trip_created", false, "trip, created", "")
+		events.AddIndex("idx_trip_events_record", false, "collection, recordId", "")
+
+		return app.Save(events)
+	}, func(app core.App) error {
+		events, err := app.FindCollectionByNameOrId("trip_events")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(events)
+	})
+}
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		events, err := app.FindCollectionByNameOrId("trip_events")
+		if err != nil {
+			return err
+		}
+
+		// the updated time of the record after the change, the changes made
+		// since a version a client read are the events of later versions
+		if events.Fields.GetByName("version") == nil {
+			events.Fields.Add(&core.TextField{
+				Name: "version",
+				Max:  50,
+			})
+			events.AddIndex("idx_trip_events_version", false, "collection, recordId, version", "")
+		}
+
+		return app.Save(events)
+	}, func(app core.App) error {
+		events, err := app.FindCollectionByNameOrId("trip_events")
+		if err != nil {
+			return err
+		}
+		events.RemoveIndex("idx_trip_events_version")
+		events.Fields.RemoveByName("version")
+		return app.Save(events)
+	})
+}
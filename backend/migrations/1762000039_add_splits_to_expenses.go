@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		expenses, err := app.FindCollectionByNameOrId("trip_expenses")
+		if err != nil {
+			return err
+		}
+
+		// the participant who paid, expenses without one are not shared
+		if expenses.Fields.GetByName("paidBy") == nil {
+			expenses.Fields.Add(&core.TextField{
+				Name: "paidBy",
+				Max:  200,
+			})
+		}
+
+		// [{"participant": "Ana", "shares": 2}, {"participant": "Ben", "amount": 12.5}],
+		// empty to split equally between all participants
+		if expenses.Fields.GetByName("splitAmong") == nil {
+			expenses.Fields.Add(&core.JSONField{
+				Name:    "splitAmong",
+				MaxSize: 20000,
+			})
+		}
+
+		return app.Save(expenses)
+	}, func(app core.App) error {
+		expenses, err := app.FindCollectionByNameOrId("trip_expenses")
+		if err != nil {
+			return err
+		}
+		expenses.Fields.RemoveByName("paidBy")
+		expenses.Fields.RemoveByName("splitAmong")
+		return app.Save(expenses)
+	})
+}
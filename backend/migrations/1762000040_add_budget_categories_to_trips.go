@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+
+		// what is set aside for each part of the trip, in the currency of
+		// the budget: {"lodging": 1200, "transport": 600, "food": 400}
+		if trips.Fields.GetByName("budgetCategories") == nil {
+			trips.Fields.Add(&core.JSONField{
+				Name:    "budgetCategories",
+				MaxSize: 2000,
+			})
+		}
+
+		return app.Save(trips)
+	}, func(app core.App) error {
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		trips.Fields.RemoveByName("budgetCategories")
+		return app.Save(trips)
+	})
+}
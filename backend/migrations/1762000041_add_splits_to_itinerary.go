@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// the itinerary items that can say who paid for them, like expenses do
+var splitItineraryCollections = []string{"activities", "lodgings", "transportations"}
+
+func init() {
+	m.Register(func(app core.App) error {
+		for _, name := range splitItineraryCollections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+
+			if collection.Fields.GetByName("paidBy") == nil {
+				collection.Fields.Add(&core.TextField{
+					Name: "paidBy",
+					Max:  200,
+				})
+			}
+			if collection.Fields.GetByName("splitAmong") == nil {
+				collection.Fields.Add(&core.JSONField{
+					Name:    "splitAmong",
+					MaxSize: 20000,
+				})
+			}
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		for _, name := range splitItineraryCollections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			collection.Fields.RemoveByName("paidBy")
+			collection.Fields.RemoveByName("splitAmong")
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,138 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		existing, _ := app.FindCollectionByNameOrId("documents")
+		if existing != nil {
+			return nil
+		}
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// the document vault of a trip: passports, visas, insurance policies
+		// and vouchers, each kept by the member who added it
+		documents := core.NewBaseCollection("documents")
+		documents.Fields.Add(
+			&core.RelationField{
+				Name:          "trip",
+				CollectionId:  trips.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			// the member who added the document, only they may change it
+			&core.RelationField{
+				Name:          "owner",
+				CollectionId:  users.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			&core.TextField{
+				Name:     "name",
+				Required: true,
+				Max:      200,
+			},
+			&core.SelectField{
+				Name:      "kind",
+				Required:  true,
+				MaxSelect: 1,
+				Values:    []string{"passport", "visa", "id_card", "insurance", "voucher", "ticket", "vaccination", "license", "other"},
+			},
+			// the participant the document belongs to
+			&core.TextField{
+				Name: "holder",
+				Max:  200,
+			},
+			&core.TextField{
+				Name: "number",
+				Max:  100,
+			},
+			// files are only served with a file token, like the API rules
+			// they need the member to see the document
+			&core.FileField{
+				Name:      "file",
+				MaxSize:   10485760,
+				MaxSelect: 10,
+				Protected: true,
+				MimeTypes: []string{
+					"application/pdf",
+					"image/png",
+					"image/jpeg",
+					"image/gif",
+					"image/webp",
+					"image/heic"},
+			},
+			&core.DateField{
+				Name: "issuedOn",
+			},
+			&core.DateField{
+				Name: "expiresOn",
+			},
+			// ["family", "originals"]
+			&core.JSONField{
+				Name:    "tags",
+				MaxSize: 2000,
+			},
+			// the members who see the document besides its owner, every
+			// member of the trip when empty
+			&core.RelationField{
+				Name:         "visibleTo",
+				CollectionId: users.Id,
+				MaxSelect:    100,
+			},
+			&core.TextField{
+				Name: "notes",
+				Max:  5000,
+			},
+			// the expiry date the owner was last reminded of, see
+			// DocumentExpiryJob
+			&core.DateField{
+				Name: "expiryReminded",
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+			&core.AutodateField{
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+
+		member := "(trip.ownerId = @request.auth.id || trip.collaborators.id ?= @request.auth.id)"
+		visible := member + " && (owner = @request.auth.id || visibleTo:length = 0 || visibleTo.id ?= @request.auth.id)"
+		documents.ListRule = types.Pointer(visible)
+		documents.ViewRule = types.Pointer(visible)
+		documents.CreateRule = types.Pointer(member + " && @request.body.owner = @request.auth.id")
+		// the owner cannot hand the document to someone else
+		documents.UpdateRule = types.Pointer(member + " && owner = @request.auth.id && (@request.body.owner:isset = false || @request.body.owner = @request.auth.id)")
+		documents.DeleteRule = types.Pointer(member + " && owner = @request.auth.id")
+
+		documents.AddIndex("idx_documents_trip", false, "trip", "")
+		documents.AddIndex("idx_documents_expires", false, "expiresOn", "")
+
+		return app.Save(documents)
+	}, func(app core.App) error {
+		documents, err := app.FindCollectionByNameOrId("documents")
+		if err != nil {
+			return err
+		}
+		return app.Delete(documents)
+	})
+}
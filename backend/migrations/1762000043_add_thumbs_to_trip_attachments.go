@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// photos of tickets and bookings taken with a phone are often larger than
+// 5 MB, images get thumbnails for the lists of attachments
+func init() {
+	m.Register(func(app core.App) error {
+
+		attachments, err := app.FindCollectionByNameOrId("trip_attachments")
+		if err != nil {
+			return err
+		}
+
+		file := attachments.Fields.GetByName("file").(*core.FileField)
+		file.MaxSize = 10485760
+		file.Thumbs = []string{"100x100", "480x0"}
+		return app.Save(attachments)
+	}, func(app core.App) error {
+
+		attachments, err := app.FindCollectionByNameOrId("trip_attachments")
+		if err != nil {
+			return err
+		}
+
+		file := attachments.Fields.GetByName("file").(*core.FileField)
+		file.MaxSize = 5242880
+		file.Thumbs = nil
+		return app.Save(attachments)
+	})
+}
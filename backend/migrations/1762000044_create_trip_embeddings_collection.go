@@ -0,0 +1,84 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		existing, _ := app.FindCollectionByNameOrId("trip_embeddings")
+		if existing != nil {
+			return nil
+		}
+
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+
+		// the snippets of the notes, descriptions and documents of a trip
+		// with their vectors, searched by the assistant. The rows are made
+		// again from the trip whenever it is searched, see
+		// tripcontext.SearchPassages, and only the server reads them.
+		embeddings := core.NewBaseCollection("trip_embeddings")
+		embeddings.Fields.Add(
+			&core.RelationField{
+				Name:          "trip",
+				CollectionId:  trips.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			// where the snippet comes from: trips notes, activities
+			// description, trip_attachments text...
+			&core.TextField{
+				Name:     "source",
+				Required: true,
+				Max:      50,
+			},
+			&core.TextField{
+				Name:     "recordId",
+				Required: true,
+				Max:      50,
+			},
+			&core.TextField{
+				Name:     "field",
+				Required: true,
+				Max:      50,
+			},
+			// sha256 of the model and the text, a changed text or model
+			// makes a new row
+			&core.TextField{
+				Name:     "hash",
+				Required: true,
+				Max:      64,
+			},
+			&core.TextField{
+				Name: "text",
+				Max:  5000,
+			},
+			// the vector as base64 of its float32 values, see embeddings.Encode
+			&core.TextField{
+				Name:     "vector",
+				Required: true,
+				Max:      100000,
+			},
+			&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+				OnUpdate: false,
+			},
+		)
+
+		embeddings.AddIndex("idx_trip_embeddings_trip", false, "trip", "")
+
+		return app.Save(embeddings)
+	}, func(app core.App) error {
+		embeddings, err := app.FindCollectionByNameOrId("trip_embeddings")
+		if err != nil {
+			return err
+		}
+		return app.Delete(embeddings)
+	})
+}
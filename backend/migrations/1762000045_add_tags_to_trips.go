@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	collections := []string{"trips", "transportations", "lodgings", "activities", "car_rentals", "dining", "trip_expenses"}
+
+	m.Register(func(app core.App) error {
+		for _, name := range collections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+
+			// ["kid-friendly", "rainy-day"], lower case, see trips.CleanTags
+			if collection.Fields.GetByName("tags") == nil {
+				collection.Fields.Add(&core.JSONField{
+					Name:    "tags",
+					MaxSize: 2000,
+				})
+			}
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		for _, name := range collections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+
+			collection.Fields.RemoveByName("tags")
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
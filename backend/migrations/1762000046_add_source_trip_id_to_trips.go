@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+
+		// id of the trip on the instance it was migrated from, so running
+		// migrate-instance again skips it
+		if trips.Fields.GetByName("sourceTripId") == nil {
+			trips.Fields.Add(&core.TextField{
+				Name: "sourceTripId",
+			})
+		}
+
+		return app.Save(trips)
+
+	}, func(app core.App) error {
+		trips, err := app.FindCollectionByNameOrId("trips")
+		if err != nil {
+			return err
+		}
+		trips.Fields.RemoveByName("sourceTripId")
+		return app.Save(trips)
+	})
+}
@@ -0,0 +1,74 @@
+package notifications
+
+import (
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+)
+
+// MailClient returns the client surmai sends its emails with. Setting
+// SURMAI_SMTP_HOST sends them through that server instead of the one in the
+// PocketBase settings, SURMAI_SMTP_PORT, SURMAI_SMTP_USERNAME,
+// SURMAI_SMTP_PASSWORD and SURMAI_SMTP_TLS complete it. Either way the mail
+// goes through the OnMailerSend hooks of the app.
+func MailClient(app core.App) mailer.Mailer {
+	host := strings.TrimSpace(os.Getenv("SURMAI_SMTP_HOST"))
+	if host == "" {
+		return app.NewMailClient()
+	}
+
+	port, err := strconv.Atoi(strings.TrimSpace(os.Getenv("SURMAI_SMTP_PORT")))
+	if err != nil || port <= 0 {
+		port = 587
+	}
+	useTLS, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv("SURMAI_SMTP_TLS")))
+
+	client := &mailer.SMTPClient{
+		Host:       host,
+		Port:       port,
+		Username:   os.Getenv("SURMAI_SMTP_USERNAME"),
+		Password:   os.Getenv("SURMAI_SMTP_PASSWORD"),
+		TLS:        useTLS,
+		AuthMethod: strings.ToUpper(strings.TrimSpace(os.Getenv("SURMAI_SMTP_AUTH_METHOD"))),
+	}
+	client.OnSend().Bind(&hook.Handler[*mailer.SendEvent]{
+		Func: func(e *mailer.SendEvent) error {
+			return app.OnMailerSend().Trigger(&core.MailerEvent{App: app, Mailer: client, Message: e.Message}, func(me *core.MailerEvent) error {
+				e.Message = me.Message
+				return e.Next()
+			})
+		},
+	})
+	return client
+}
+
+// Sender is the address the emails come from, SURMAI_SMTP_SENDER_ADDRESS and
+// SURMAI_SMTP_SENDER_NAME override the PocketBase settings
+func Sender(app core.App) mail.Address {
+	sender := mail.Address{
+		Address: app.Settings().Meta.SenderAddress,
+		Name:    app.Settings().Meta.SenderName,
+	}
+	if address := strings.TrimSpace(os.Getenv("SURMAI_SMTP_SENDER_ADDRESS")); address != "" {
+		sender.Address = address
+	}
+	if name := strings.TrimSpace(os.Getenv("SURMAI_SMTP_SENDER_NAME")); name != "" {
+		sender.Name = name
+	}
+	return sender
+}
+
+// SendEmail sends an HTML email to one address
+func SendEmail(app core.App, to string, subject string, html string) error {
+	return MailClient(app).Send(&mailer.Message{
+		From:    Sender(app),
+		To:      []mail.Address{{Address: to}},
+		Subject: subject,
+		HTML:    html,
+	})
+}
@@ -0,0 +1,94 @@
+package notifications
+
+import (
+	"backend/push"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Notification is something a user is told about, kept in the notifications
+// collection where the app lists it until it is read
+type Notification struct {
+	UserId  string
+	TripId  string
+	Kind    string
+	Title   string
+	Message string
+	Link    string
+	Data    map[string]any
+}
+
+// Send tells the user about the notification the way they prefer for its
+// kind. It is stored for the app unless the user turned the kind off, and
+// emailed or pushed as well when they asked for it.
+func Send(app core.App, notification Notification) error {
+	user, err := app.FindRecordById("users", notification.UserId)
+	if err != nil {
+		return err
+	}
+	channel := Channel(user, notification.Kind)
+	if channel == ChannelOff {
+		return nil
+	}
+
+	collection, err := app.FindCollectionByNameOrId("notifications")
+	if err != nil {
+		return err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("user", notification.UserId)
+	record.Set("trip", notification.TripId)
+	record.Set("kind", notification.Kind)
+	record.Set("title", notification.Title)
+	record.Set("message", notification.Message)
+	record.Set("link", notification.Link)
+	if notification.Data != nil {
+		record.Set("data", notification.Data)
+	}
+	if err := app.Save(record); err != nil {
+		return err
+	}
+
+	switch channel {
+	case ChannelEmail:
+		if user.Email() == "" {
+			return nil
+		}
+		subject, html, err := RenderEmail(app, user, notification)
+		if err != nil {
+			return err
+		}
+		return SendEmail(app, user.Email(), subject, html)
+	case ChannelPush:
+		return push.SendToUser(app, user.Id, pushMessage(app, notification))
+	}
+	return nil
+}
+
+// urgentKinds are pushed with a high priority, they are about to matter
+var urgentKinds = map[string]bool{
+	KindFlightChanged: true,
+	KindTripStarting:  true,
+}
+
+func pushMessage(app core.App, notification Notification) push.Message {
+	return push.Message{
+		Title:  notification.Title,
+		Body:   notification.Message,
+		Link:   strings.TrimSuffix(app.Settings().Meta.AppURL, "/") + notification.Link,
+		Tag:    notification.Kind,
+		Urgent: urgentKinds[notification.Kind],
+	}
+}
+
+// SendAll sends the notifications, one that cannot be sent does not keep
+// the others from going out
+func SendAll(app core.App, notifications []Notification) {
+	for _, notification := range notifications {
+		if err := Send(app, notification); err != nil {
+			app.Logger().Warn("Could not send the notification", "error", err, "kind", notification.Kind, "userId", notification.UserId)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package notifications
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	KindTripStarting     = "trip_starting"
+	KindCheckIn          = "check_in"
+	KindFlightChanged    = "flight_changed"
+	KindProposalPending  = "proposal_pending"
+	KindTripJoined       = "trip_joined"
+	KindCommentMention   = "comment_mention"
+	KindCommentReply     = "comment_reply"
+	KindPollCreated      = "poll_created"
+	KindPollDecided      = "poll_decided"
+	KindDocumentExpiring = "document_expiring"
+)
+
+// Kinds describes every kind of notification, in the order the preferences
+// list them
+var Kinds = []struct {
+	Kind  string `json:"kind"`
+	Label string `json:"label"`
+}{
+	{KindTripStarting, "A trip starts in a few days"},
+	{KindCheckIn, "The assistant checks in before a trip"},
+	{KindFlightChanged, "The time of a flight changed"},
+	{KindProposalPending, "A suggested change awaits approval"},
+	{KindTripJoined, "You were added to a trip"},
+	{KindCommentMention, "You were mentioned in a comment"},
+	{KindCommentReply, "Someone commented on an item you discussed"},
+	{KindPollCreated, "A poll was opened"},
+	{KindPollDecided, "A poll was decided"},
+	{KindDocumentExpiring, "A travel document expires too soon"},
+}
+
+const (
+	// ChannelApp lists the notification in the app only
+	ChannelApp = "app"
+	// ChannelEmail lists it in the app and emails it too
+	ChannelEmail = "email"
+	// ChannelPush lists it in the app and pushes it to the devices of the
+	// user
+	ChannelPush = "push"
+	// ChannelOff drops it
+	ChannelOff = "off"
+)
+
+func knownKind(kind string) bool {
+	for _, known := range Kinds {
+		if known.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Preferences returns the channel of every kind of notification for the
+// user. Kinds the user did not choose for follow notificationChannel, the
+// one channel there was before preferences.
+func Preferences(user *core.Record) map[string]string {
+	fallback := ChannelApp
+	switch user.GetString("notificationChannel") {
+	case ChannelEmail, ChannelPush:
+		fallback = user.GetString("notificationChannel")
+	}
+
+	chosen := map[string]string{}
+	_ = user.UnmarshalJSONField("notificationPreferences", &chosen)
+
+	preferences := make(map[string]string, len(Kinds))
+	for _, kind := range Kinds {
+		preferences[kind.Kind] = fallback
+		if channel, ok := chosen[kind.Kind]; ok {
+			preferences[kind.Kind] = channel
+		}
+	}
+	return preferences
+}
+
+// Channel returns how the user wants to be told about the kind of
+// notification
+func Channel(user *core.Record, kind string) string {
+	if channel, ok := Preferences(user)[kind]; ok {
+		return channel
+	}
+	switch user.GetString("notificationChannel") {
+	case ChannelEmail, ChannelPush:
+		return user.GetString("notificationChannel")
+	}
+	return ChannelApp
+}
+
+// SetPreferences changes the channels of the given kinds, the others keep
+// theirs
+func SetPreferences(user *core.Record, changes map[string]string) error {
+	chosen := map[string]string{}
+	_ = user.UnmarshalJSONField("notificationPreferences", &chosen)
+
+	for kind, channel := range changes {
+		if !knownKind(kind) {
+			return fmt.Errorf("unknown notification kind %q", kind)
+		}
+		switch channel {
+		case ChannelApp, ChannelEmail, ChannelPush, ChannelOff:
+			chosen[kind] = channel
+		default:
+			return fmt.Errorf("unknown channel %q for %s", channel, kind)
+		}
+	}
+	user.Set("notificationPreferences", chosen)
+	return nil
+}
@@ -0,0 +1,143 @@
+package notifications
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// emailLayout wraps the content of every notification email, it looks like
+// the invitation email
+const emailLayout = `
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org=/TR/xhtml1/DTD/xhtml1-strict.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+	<meta http-equiv="Content-Type" content="text/html; charset=utf-8" />
+	<meta name="viewport" content="width=device-width, initial-scale=1" />
+    <style>
+        body, html {
+            padding: 0;
+            margin: 0;
+            border: 0;
+            color: #16161a;
+            background: #fff;
+            font-size: 14px;
+            line-height: 20px;
+            font-weight: normal;
+            font-family: Source Sans Pro, sans-serif, emoji;
+        }
+        body {
+            padding: 20px 30px;
+        }
+        p {
+            display: block;
+            margin: 10px 0;
+            font-family: inherit;
+        }
+        small {
+            font-size: 12px;
+            line-height: 16px;
+        }
+        a {
+            color: inherit;
+        }
+        .btn {
+            display: inline-block;
+            vertical-align: top;
+            border: 0;
+            cursor: pointer;
+            color: #fff !important;
+            background: #16161a !important;
+            text-decoration: none !important;
+            line-height: 40px;
+            width: auto;
+            min-width: 150px;
+            text-align: center;
+            padding: 0 20px;
+            margin: 5px 0;
+            font-family: Source Sans Pro, sans-serif, emoji;
+            font-size: 14px;
+            font-weight: bold;
+            border-radius: 6px;
+            box-sizing: border-box;
+        }
+    </style>
+</head>
+<body>
+<p>Hello{{ if .name }} {{ .name }}{{ end }},</p>
+{{ template "content" . }}
+<p>
+  Thanks,<br/>
+  Surmai team
+</p>
+<p><small>You can choose which notifications are emailed to you in <a href="{{ .applicationUrl }}/settings" target="_blank">your settings</a>.</small></p>
+</body>
+</html>
+`
+
+// emailContents are the bodies of the notification emails by kind, kinds
+// without one get the default
+var emailContents = map[string]string{
+	KindTripStarting: `
+<p>{{ .message }}</p>
+<p>Have a look at the itinerary and make sure nothing is missing.</p>
+<a class="btn" href="{{ .link }}" target="_blank">Open the itinerary</a>`,
+	KindCheckIn: `
+<p>{{ range .lines }}{{ . }}<br/>{{ end }}</p>
+<a class="btn" href="{{ .link }}" target="_blank">Open the trip</a>`,
+	KindFlightChanged: `
+<p>{{ .message }}</p>
+{{ if .data.changes }}<ul>{{ range .data.changes }}<li>{{ .field }}: {{ if .from }}{{ .from }} &rarr; {{ end }}{{ .to }}</li>{{ end }}</ul>{{ end }}
+<a class="btn" href="{{ .link }}" target="_blank">Open the trip</a>`,
+	KindProposalPending: `
+<p>The assistant suggests a change to "{{ .data.tripName }}" and waits for your approval:</p>
+<p style="border:1px solid #ccc; padding: 5px 5px 5px 5px">{{ .message }}</p>
+<a class="btn" href="{{ .link }}" target="_blank">Review the suggestion</a>`,
+	KindTripJoined: `
+<p>You were added to "{{ .data.tripName }}" as {{ .data.role }}.</p>
+<a class="btn" href="{{ .link }}" target="_blank">Open the trip</a>`,
+	"": `
+<p>{{ .message }}</p>
+<a class="btn" href="{{ .link }}" target="_blank">Open in surmai</a>`,
+}
+
+var emailTemplates = func() map[string]*template.Template {
+	layout := template.Must(template.New("NotificationEmail").Parse(emailLayout))
+	templates := make(map[string]*template.Template, len(emailContents))
+	for kind, content := range emailContents {
+		templates[kind] = template.Must(template.Must(layout.Clone()).New("content").Parse(content))
+	}
+	return templates
+}()
+
+// RenderEmail writes the notification as the subject and HTML body of an
+// email to the user
+func RenderEmail(app core.App, user *core.Record, notification Notification) (string, string, error) {
+	emailTemplate, ok := emailTemplates[notification.Kind]
+	if !ok {
+		emailTemplate = emailTemplates[""]
+	}
+
+	applicationUrl := strings.TrimSuffix(app.Settings().Meta.AppURL, "/")
+	link := applicationUrl + notification.Link
+	if notification.Link == "" {
+		link = applicationUrl
+	}
+
+	var contents bytes.Buffer
+	err := emailTemplate.ExecuteTemplate(&contents, "NotificationEmail", map[string]interface{}{
+		"name":           user.GetString("name"),
+		"title":          notification.Title,
+		"message":        notification.Message,
+		"lines":          strings.Split(notification.Message, "\n"),
+		"link":           link,
+		"applicationUrl": applicationUrl,
+		"data":           notification.Data,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return "[surmai] " + notification.Title, contents.String(), nil
+}
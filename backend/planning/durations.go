@@ -0,0 +1,64 @@
+package planning
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultActivityDurations is how long an activity of each category usually
+// takes. Deployments can override or extend it through the assistant_config
+// setting.
+var DefaultActivityDurations = map[string]time.Duration{
+	"museum":    2 * time.Hour,
+	"dinner":    90 * time.Minute,
+	"lunch":     time.Hour,
+	"breakfast": 45 * time.Minute,
+	"hike":      4 * time.Hour,
+	"tour":      3 * time.Hour,
+	"show":      150 * time.Minute,
+	"spa":       2 * time.Hour,
+}
+
+// other words that put an activity in a category, the category name itself
+// always matches
+var durationKeywords = map[string][]string{
+	"museum":    {"gallery", "exhibition"},
+	"dinner":    {"restaurant", "supper"},
+	"breakfast": {"brunch"},
+	"hike":      {"hiking", "trek", "trail"},
+	"show":      {"concert", "theatre", "theater", "opera", "musical"},
+	"spa":       {"massage", "hammam", "onsen"},
+}
+
+// EstimateDuration finds the category of an activity from its name,
+// description and category, and returns how long it takes. Categories are
+// tried longest name first, then alphabetically, so the result does not
+// depend on map order.
+func EstimateDuration(durations map[string]time.Duration, texts ...string) (string, time.Duration, bool) {
+	combined := strings.ToLower(strings.Join(texts, " "))
+	if strings.TrimSpace(combined) == "" {
+		return "", 0, false
+	}
+
+	categories := make([]string, 0, len(durations))
+	for category := range durations {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if len(categories[i]) != len(categories[j]) {
+			return len(categories[i]) > len(categories[j])
+		}
+		return categories[i] < categories[j]
+	})
+
+	for _, category := range categories {
+		keywords := append([]string{category}, durationKeywords[category]...)
+		for _, keyword := range keywords {
+			if strings.Contains(combined, keyword) {
+				return category, durations[category], true
+			}
+		}
+	}
+	return "", 0, false
+}
@@ -0,0 +1,92 @@
+package planning
+
+import (
+	"strings"
+	"unicode"
+)
+
+type Setting string
+
+const (
+	Outdoor Setting = "outdoor"
+	Indoor  Setting = "indoor"
+	Unknown Setting = "unknown"
+)
+
+func (s Setting) String() string {
+	return string(s)
+}
+
+// rain above this probability makes an outdoor plan a poor fit for the day
+const RainConflictThreshold = 90.0
+
+var outdoorKeywords = []string{
+	"hike", "hiking", "trail", "beach", "park", "garden", "picnic", "zoo", "safari",
+	"boat", "cruise", "kayak", "snorkel", "dive", "diving", "surf", "swim", "bike",
+	"cycling", "walking tour", "walk", "market", "outdoor", "climb", "ski", "viewpoint",
+	"lookout", "waterfall", "lake", "mountain", "camping", "golf", "festival",
+}
+
+var indoorKeywords = []string{
+	"museum", "gallery", "exhibition", "theatre", "theater", "cinema", "movie",
+	"concert hall", "opera", "aquarium", "spa", "shopping mall", "mall", "restaurant",
+	"dinner", "lunch", "brunch", "cafe", "bar", "cooking class", "workshop", "indoor",
+	"library", "escape room", "bowling", "church", "cathedral", "temple", "castle tour",
+}
+
+// ClassifyActivity guesses whether an activity happens outdoors from its name,
+// description and category. Keywords only match whole words, so "Barcelona"
+// is not a bar, and the address should not be passed since street and place
+// names say nothing about the activity. Indoor keywords win over outdoor ones
+// since "museum in the park" is still a museum.
+func ClassifyActivity(texts ...string) Setting {
+	words := strings.FieldsFunc(strings.ToLower(strings.Join(texts, " ")), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return Unknown
+	}
+
+	for _, keyword := range indoorKeywords {
+		if containsPhrase(words, keyword) {
+			return Indoor
+		}
+	}
+	for _, keyword := range outdoorKeywords {
+		if containsPhrase(words, keyword) {
+			return Outdoor
+		}
+	}
+	return Unknown
+}
+
+// containsPhrase reports whether the words of the phrase appear one after the
+// other in words. The last word may also be in the plural, "museums" and
+// "walking tours" count.
+func containsPhrase(words []string, phrase string) bool {
+	parts := strings.Fields(phrase)
+	for i := 0; i+len(parts) <= len(words); i++ {
+		matched := true
+		for j, part := range parts {
+			word := words[i+j]
+			if word == part {
+				continue
+			}
+			if j == len(parts)-1 && (word == part+"s" || word == part+"es") {
+				continue
+			}
+			matched = false
+			break
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// WeatherConflict reports whether an activity with the given setting is a bad
+// fit for a day with the given chance of rain
+func WeatherConflict(setting Setting, precipitationProbability float64) bool {
+	return setting == Outdoor && precipitationProbability >= RainConflictThreshold
+}
@@ -0,0 +1,220 @@
+package planning
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Suggestion is a place the assistant found for the travelers, such as a
+// restaurant or a hotel, as it describes it to the ranker
+type Suggestion struct {
+	Name          string   `json:"name"`
+	Category      string   `json:"category,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+	Latitude      *float64 `json:"latitude,omitempty"`
+	Longitude     *float64 `json:"longitude,omitempty"`
+	PriceLevel    int      `json:"priceLevel,omitempty"`
+	EstimatedCost float64  `json:"estimatedCost,omitempty"`
+	Currency      string   `json:"currency,omitempty"`
+	Rating        float64  `json:"rating,omitempty"`
+}
+
+// RankedSuggestion is a suggestion with its score and the reasons behind it.
+// Position is where the assistant had put it.
+type RankedSuggestion struct {
+	Suggestion
+	Position int      `json:"position"`
+	Score    float64  `json:"score"`
+	Reasons  []string `json:"reasons,omitempty"`
+}
+
+// Anchor is a place the travelers come back to, their lodging
+type Anchor struct {
+	Name      string
+	Latitude  float64
+	Longitude float64
+}
+
+// RankingSignals is what is known about the travelers when ranking. The
+// accepted and dismissed maps count the words of suggestions approved or
+// declined before.
+type RankingSignals struct {
+	Anchors     []Anchor
+	DailyBudget float64
+	// Convert turns a cost into the budget currency
+	Convert   func(value float64, from string) (float64, bool)
+	Likes     []string
+	Avoids    []string
+	Accepted  map[string]int
+	Dismissed map[string]int
+	// names of suggestions declined before, folded with SuggestionWords
+	DismissedNames map[string]bool
+}
+
+// SuggestionRanker orders the suggestions, best first
+type SuggestionRanker interface {
+	Rank(suggestions []Suggestion, signals RankingSignals) []RankedSuggestion
+}
+
+// SuggestionRankers are the rankers deployments can choose from
+var SuggestionRankers = map[string]SuggestionRanker{
+	"local": LocalRanker{},
+	"none":  ModelOrder{},
+}
+
+// ModelOrder keeps the order of the assistant
+type ModelOrder struct{}
+
+func (ModelOrder) Rank(suggestions []Suggestion, signals RankingSignals) []RankedSuggestion {
+	ranked := make([]RankedSuggestion, 0, len(suggestions))
+	for i, suggestion := range suggestions {
+		ranked = append(ranked, RankedSuggestion{Suggestion: suggestion, Position: i + 1})
+	}
+	return ranked
+}
+
+// LocalRanker scores suggestions on the traveler's likes and dislikes, the
+// distance from the nearest lodging, how the cost fits the daily budget and
+// what was accepted or dismissed before. The rating and the order of the
+// assistant only break close calls.
+type LocalRanker struct{}
+
+const (
+	// distances beyond this cost no more than this
+	rankingMaxDistanceKm = 20.0
+	rankingNearbyKm      = 1.5
+)
+
+func (LocalRanker) Rank(suggestions []Suggestion, signals RankingSignals) []RankedSuggestion {
+	ranked := make([]RankedSuggestion, 0, len(suggestions))
+	for i, suggestion := range suggestions {
+		r := RankedSuggestion{Suggestion: suggestion, Position: i + 1, Reasons: make([]string, 0)}
+		words := SuggestionWords(append([]string{suggestion.Name, suggestion.Category}, suggestion.Tags...)...)
+
+		r.Score += suggestion.Rating*0.4 - float64(i)*0.05
+
+		if liked := matchingWords(words, signals.Likes); len(liked) > 0 {
+			r.Score += float64(len(liked))
+			r.Reasons = append(r.Reasons, "matches what you like: "+strings.Join(liked, ", "))
+		}
+		if avoided := matchingWords(words, signals.Avoids); len(avoided) > 0 {
+			r.Score -= 2 * float64(len(avoided))
+			r.Reasons = append(r.Reasons, "is something you avoid: "+strings.Join(avoided, ", "))
+		}
+
+		if anchor, km, ok := nearestAnchor(suggestion, signals.Anchors); ok {
+			r.Score -= math.Min(km, rankingMaxDistanceKm) * 0.15
+			if km <= rankingNearbyKm {
+				r.Reasons = append(r.Reasons, fmt.Sprintf("%.1f km from %s", km, anchor.Name))
+			} else if km >= rankingMaxDistanceKm/2 {
+				r.Reasons = append(r.Reasons, fmt.Sprintf("%.0f km from %s", km, anchor.Name))
+			}
+		}
+
+		if signals.DailyBudget > 0 && suggestion.EstimatedCost == 0 {
+			// without a cost, expensive places lose a little on a budget
+			r.Score -= float64(max(suggestion.PriceLevel-2, 0)) * 0.25
+		} else if signals.DailyBudget > 0 && signals.Convert != nil {
+			if cost, ok := signals.Convert(suggestion.EstimatedCost, suggestion.Currency); ok {
+				if cost > signals.DailyBudget {
+					r.Score -= 1.5
+					r.Reasons = append(r.Reasons, "costs more than the daily budget left")
+				} else {
+					r.Score += 0.5
+					r.Reasons = append(r.Reasons, "fits the daily budget")
+				}
+			}
+		}
+
+		if signals.DismissedNames[strings.Join(SuggestionWords(suggestion.Name), " ")] {
+			r.Score -= 3
+			r.Reasons = append(r.Reasons, "was turned down before")
+		} else {
+			accepted, dismissed := 0, 0
+			for _, word := range words {
+				accepted += signals.Accepted[word]
+				dismissed += signals.Dismissed[word]
+			}
+			r.Score += math.Min(float64(accepted)*0.3, 1) - math.Min(float64(dismissed)*0.3, 1)
+			if accepted > dismissed {
+				r.Reasons = append(r.Reasons, "is like places you accepted before")
+			}
+		}
+
+		ranked = append(ranked, r)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+	return ranked
+}
+
+// SuggestionWords splits texts into lower case words, leaving out the ones
+// too short to mean anything
+func SuggestionWords(texts ...string) []string {
+	words := make([]string, 0)
+	seen := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(strings.Join(texts, " ")), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) > 2 && !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// matchingWords returns the preferences found among the words, a
+// preference of several words matches when all of them are there
+func matchingWords(words []string, preferences []string) []string {
+	present := make(map[string]bool, len(words))
+	for _, word := range words {
+		present[word] = true
+	}
+
+	matched := make([]string, 0)
+	for _, preference := range preferences {
+		parts := SuggestionWords(preference)
+		if len(parts) == 0 {
+			continue
+		}
+		all := true
+		for _, part := range parts {
+			all = all && present[part]
+		}
+		if all {
+			matched = append(matched, strings.TrimSpace(preference))
+		}
+	}
+	return matched
+}
+
+func nearestAnchor(suggestion Suggestion, anchors []Anchor) (Anchor, float64, bool) {
+	if suggestion.Latitude == nil || suggestion.Longitude == nil || len(anchors) == 0 {
+		return Anchor{}, 0, false
+	}
+	nearest, best := anchors[0], math.Inf(1)
+	for _, anchor := range anchors {
+		if km := distanceKm(*suggestion.Latitude, *suggestion.Longitude, anchor.Latitude, anchor.Longitude); km < best {
+			nearest, best = anchor, km
+		}
+	}
+	return nearest, best, true
+}
+
+// distanceKm is the great-circle distance between two points
+func distanceKm(fromLat, fromLng, toLat, toLng float64) float64 {
+	const earthRadiusKm = 6371.0
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRadians(toLat - fromLat)
+	dLng := toRadians(toLng - fromLng)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(fromLat))*math.Cos(toRadians(toLat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
@@ -0,0 +1,23 @@
+package planning
+
+import "time"
+
+// RentalReturnMargin is how long before a departure rented gear should be
+// back at the shop, to leave time to get to the station or the airport
+const RentalReturnMargin = 2 * time.Hour
+
+// LateReturn reports whether gear rented from pickup to returnTime is still
+// out, or due back too late, when a departure leaves. Without a pickup time
+// only departures in the day before the return are considered.
+func LateReturn(pickup time.Time, returnTime time.Time, departure time.Time) bool {
+	if returnTime.IsZero() || departure.IsZero() {
+		return false
+	}
+	if pickup.IsZero() {
+		pickup = returnTime.AddDate(0, 0, -1)
+	}
+	if departure.Before(pickup) {
+		return false
+	}
+	return returnTime.After(departure.Add(-RentalReturnMargin))
+}
@@ -0,0 +1,122 @@
+package opentripmap
+
+import (
+	"backend/cache"
+	"backend/poi"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the OpenTripMap kinds of each category
+var categoryKinds = map[string]string{
+	poi.CategoryAttraction: "interesting_places",
+	poi.CategoryMuseum:     "museums",
+	poi.CategoryRestaurant: "restaurants",
+	poi.CategoryCafe:       "cafes",
+	poi.CategoryBar:        "bars,pubs",
+	poi.CategoryPark:       "gardens_and_parks",
+	poi.CategoryViewpoint:  "view_points",
+}
+
+type feature struct {
+	Xid   string  `json:"xid"`
+	Name  string  `json:"name"`
+	Kinds string  `json:"kinds"`
+	Rate  float64 `json:"rate"`
+	Point struct {
+		Lon float64 `json:"lon"`
+		Lat float64 `json:"lat"`
+	} `json:"point"`
+}
+
+// OpenTripMap is a database of attractions built from OpenStreetMap and
+// Wikidata, it needs a free api key
+type OpenTripMap struct {
+	ApiKey string
+}
+
+func (o OpenTripMap) Search(search poi.Search) ([]poi.Place, error) {
+	if o.ApiKey == "" {
+		return nil, errors.New("the OpenTripMap api key is not configured")
+	}
+
+	categories := search.Categories
+	if len(categories) == 0 {
+		categories = poi.Categories
+	}
+	kinds := make([]string, 0, len(categories))
+	for _, category := range categories {
+		kinds = append(kinds, categoryKinds[category])
+	}
+
+	language := strings.ToLower(strings.SplitN(search.Language, "-", 2)[0])
+	if language != "ru" {
+		language = "en"
+	}
+
+	params := url.Values{}
+	params.Set("radius", strconv.Itoa(search.RadiusMeters))
+	params.Set("lat", strconv.FormatFloat(search.Latitude, 'f', 6, 64))
+	params.Set("lon", strconv.FormatFloat(search.Longitude, 'f', 6, 64))
+	params.Set("kinds", strings.Join(kinds, ","))
+	params.Set("limit", strconv.Itoa(max(search.Limit*4, 50)))
+	params.Set("format", "json")
+	if len(strings.TrimSpace(search.Query)) >= 3 {
+		params.Set("name", strings.TrimSpace(search.Query))
+	}
+
+	cacheKey := "opentripmap-" + language + "-" + params.Encode()
+	if val, found := cache.Get(cacheKey); found {
+		return val.([]poi.Place), nil
+	}
+	params.Set("apikey", o.ApiKey)
+
+	client := &http.Client{Timeout: 20 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("https://api.opentripmap.com/0.1/%s/places/radius?%s", language, params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("opentripmap returned %s", resp.Status)
+	}
+
+	var features []feature
+	if err := json.NewDecoder(resp.Body).Decode(&features); err != nil {
+		return nil, err
+	}
+
+	places := make([]poi.Place, 0, len(features))
+	for _, f := range features {
+		places = append(places, poi.Place{
+			Id:        "otm:" + f.Xid,
+			Name:      f.Name,
+			Category:  category(f.Kinds),
+			Latitude:  f.Point.Lat,
+			Longitude: f.Point.Lon,
+			Source:    "opentripmap",
+		})
+	}
+
+	places = poi.Nearest(places, search.Latitude, search.Longitude, 0)
+	cache.Set(cacheKey, places, 24*time.Hour)
+	return places, nil
+}
+
+func category(kinds string) string {
+	for _, kind := range strings.Split(kinds, ",") {
+		for category, known := range categoryKinds {
+			if category != poi.CategoryAttraction && strings.Contains(","+known+",", ","+kind+",") {
+				return category
+			}
+		}
+	}
+	return poi.CategoryAttraction
+}
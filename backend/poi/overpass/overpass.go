@@ -0,0 +1,173 @@
+package overpass
+
+import (
+	"backend/cache"
+	"backend/poi"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const DefaultURL = "https://overpass-api.de/api/interpreter"
+
+// the OpenStreetMap tags of each category
+var categoryTags = map[string][]string{
+	poi.CategoryAttraction: {`["tourism"~"^(attraction|theme_park|zoo|aquarium)$"]`, `["historic"~"^(monument|castle|memorial|ruins)$"]`},
+	poi.CategoryMuseum:     {`["tourism"~"^(museum|gallery)$"]`},
+	poi.CategoryRestaurant: {`["amenity"="restaurant"]`},
+	poi.CategoryCafe:       {`["amenity"="cafe"]`},
+	poi.CategoryBar:        {`["amenity"~"^(bar|pub)$"]`},
+	poi.CategoryPark:       {`["leisure"~"^(park|garden)$"]`},
+	poi.CategoryViewpoint:  {`["tourism"="viewpoint"]`},
+}
+
+type response struct {
+	Elements []element `json:"elements"`
+}
+
+type element struct {
+	Type   string  `json:"type"`
+	Id     int64   `json:"id"`
+	Lat    float64 `json:"lat"`
+	Lon    float64 `json:"lon"`
+	Center *struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	} `json:"center"`
+	Tags map[string]string `json:"tags"`
+}
+
+// Overpass queries OpenStreetMap directly, which needs no api key. The public
+// server is shared, so answers are cached for a day.
+type Overpass struct {
+	URL string
+}
+
+func (o Overpass) Search(search poi.Search) ([]poi.Place, error) {
+	categories := search.Categories
+	if len(categories) == 0 {
+		categories = poi.Categories
+	}
+
+	cacheKey := fmt.Sprintf("overpass-%.3f-%.3f-%d-%s-%s", search.Latitude, search.Longitude, search.RadiusMeters,
+		strings.Join(categories, ","), strings.ToLower(search.Query))
+	if val, found := cache.Get(cacheKey); found {
+		return val.([]poi.Place), nil
+	}
+
+	name := ""
+	if query := strings.TrimSpace(search.Query); query != "" {
+		name = fmt.Sprintf(`["name"~"%s",i]`, strings.ReplaceAll(regexp.QuoteMeta(query), `"`, `\"`))
+	}
+	var q strings.Builder
+	q.WriteString("[out:json][timeout:20];(")
+	for _, category := range categories {
+		for _, tags := range categoryTags[category] {
+			fmt.Fprintf(&q, `nwr%s["name"]%s(around:%d,%.6f,%.6f);`, tags, name, search.RadiusMeters, search.Latitude, search.Longitude)
+		}
+	}
+	// more than asked for, the nearest ones are picked afterwards
+	fmt.Fprintf(&q, ");out center %d;", max(search.Limit*4, 50))
+
+	endpoint := o.URL
+	if endpoint == "" {
+		endpoint = DefaultURL
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(url.Values{"data": {q.String()}}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "surmai")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("overpass returned %s", resp.Status)
+	}
+
+	var data response
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	places := make([]poi.Place, 0, len(data.Elements))
+	for _, el := range data.Elements {
+		lat, lon := el.Lat, el.Lon
+		if el.Center != nil {
+			lat, lon = el.Center.Lat, el.Center.Lon
+		}
+		places = append(places, poi.Place{
+			Id:           fmt.Sprintf("osm:%s/%d", el.Type, el.Id),
+			Name:         localName(el.Tags, search.Language),
+			Category:     category(el.Tags),
+			Latitude:     lat,
+			Longitude:    lon,
+			Address:      address(el.Tags),
+			Cuisine:      el.Tags["cuisine"],
+			OpeningHours: el.Tags["opening_hours"],
+			Website:      firstNonEmpty(el.Tags["website"], el.Tags["contact:website"]),
+			Source:       "openstreetmap",
+		})
+	}
+
+	places = poi.Nearest(places, search.Latitude, search.Longitude, 0)
+	cache.Set(cacheKey, places, 24*time.Hour)
+	return places, nil
+}
+
+func localName(tags map[string]string, language string) string {
+	language = strings.ToLower(strings.SplitN(language, "-", 2)[0])
+	if name := tags["name:"+language]; language != "" && name != "" {
+		return name
+	}
+	return tags["name"]
+}
+
+func category(tags map[string]string) string {
+	switch {
+	case tags["tourism"] == "museum" || tags["tourism"] == "gallery":
+		return poi.CategoryMuseum
+	case tags["tourism"] == "viewpoint":
+		return poi.CategoryViewpoint
+	case tags["amenity"] == "restaurant":
+		return poi.CategoryRestaurant
+	case tags["amenity"] == "cafe":
+		return poi.CategoryCafe
+	case tags["amenity"] == "bar" || tags["amenity"] == "pub":
+		return poi.CategoryBar
+	case tags["leisure"] == "park" || tags["leisure"] == "garden":
+		return poi.CategoryPark
+	default:
+		return poi.CategoryAttraction
+	}
+}
+
+func address(tags map[string]string) string {
+	street := strings.TrimSpace(tags["addr:street"] + " " + tags["addr:housenumber"])
+	city := strings.TrimSpace(tags["addr:postcode"] + " " + tags["addr:city"])
+	if street == "" {
+		return city
+	}
+	if city == "" {
+		return street
+	}
+	return street + ", " + city
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package poi
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Categories the providers can search for
+const (
+	CategoryAttraction = "attraction"
+	CategoryMuseum     = "museum"
+	CategoryRestaurant = "restaurant"
+	CategoryCafe       = "cafe"
+	CategoryBar        = "bar"
+	CategoryPark       = "park"
+	CategoryViewpoint  = "viewpoint"
+)
+
+var Categories = []string{CategoryAttraction, CategoryMuseum, CategoryRestaurant, CategoryCafe, CategoryBar, CategoryPark, CategoryViewpoint}
+
+// Place is a point of interest found near a trip destination
+type Place struct {
+	Id           string  `json:"id"`
+	Name         string  `json:"name"`
+	Category     string  `json:"category"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	DistanceKm   float64 `json:"distanceKm"`
+	Address      string  `json:"address,omitempty"`
+	Cuisine      string  `json:"cuisine,omitempty"`
+	OpeningHours string  `json:"openingHours,omitempty"`
+	Website      string  `json:"website,omitempty"`
+	Source       string  `json:"source"`
+}
+
+// Search is what to look for: places of the categories, all of them when
+// empty, whose name matches the query, within the radius of a point
+type Search struct {
+	Query        string
+	Categories   []string
+	Latitude     float64
+	Longitude    float64
+	RadiusMeters int
+	Limit        int
+	Language     string
+}
+
+type DataProvider interface {
+	Search(search Search) ([]Place, error)
+}
+
+// IsCategory reports whether the category is one the providers know
+func IsCategory(category string) bool {
+	for _, known := range Categories {
+		if known == category {
+			return true
+		}
+	}
+	return false
+}
+
+// Nearest sets the distance of each place from the point, keeps the places
+// with a name once and returns the closest first, at most limit of them
+func Nearest(places []Place, latitude float64, longitude float64, limit int) []Place {
+	seen := map[string]bool{}
+	kept := make([]Place, 0, len(places))
+	for _, place := range places {
+		key := strings.ToLower(strings.TrimSpace(place.Name))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		place.DistanceKm = math.Round(DistanceKm(latitude, longitude, place.Latitude, place.Longitude)*100) / 100
+		kept = append(kept, place)
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].DistanceKm < kept[j].DistanceKm
+	})
+	if limit > 0 && len(kept) > limit {
+		kept = kept[:limit]
+	}
+	return kept
+}
+
+// DistanceKm is the great-circle distance between two points
+func DistanceKm(fromLat, fromLng, toLat, toLng float64) float64 {
+	const earthRadiusKm = 6371.0
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRadians(toLat - fromLat)
+	dLng := toRadians(toLng - fromLng)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(fromLat))*math.Cos(toRadians(toLat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
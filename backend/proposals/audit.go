@@ -0,0 +1,109 @@
+package proposals
+
+import (
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	StatusProposed = "proposed"
+	StatusApproved = "approved"
+	StatusDeclined = "declined"
+	StatusTimeout  = "timeout"
+	StatusFailed   = "failed"
+)
+
+// RecordIssued adds the proposal to the assistant_actions audit log.
+// requestedBy is empty for proposals created by background jobs.
+func RecordIssued(app core.App, proposal *Proposal, requestedBy string) {
+	// duplicates of a pending proposal share its audit entry
+	if existing, _ := app.FindFirstRecordByFilter("assistant_actions", "proposalId = {:id}", dbx.Params{"id": proposal.ID}); existing != nil {
+		return
+	}
+
+	collection, err := app.FindCollectionByNameOrId("assistant_actions")
+	if err != nil {
+		app.Logger().Error("Unable to record assistant action", "error", err, "proposalId", proposal.ID)
+		return
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("trip", proposal.TripID)
+	record.Set("proposalId", proposal.ID)
+	record.Set("tool", proposal.Tool)
+	record.Set("arguments", proposal.Arguments)
+	record.Set("summary", proposal.Summary)
+	record.Set("status", StatusProposed)
+	record.Set("requestedBy", requestedBy)
+	record.Set("assumptions", proposal.Assumptions)
+	record.Set("schemaVersion", proposal.SchemaVersion)
+	record.Set("expiresAt", proposal.ExpiresAt)
+	if !proposal.ContextAt.IsZero() {
+		record.Set("contextAt", proposal.ContextAt)
+	}
+
+	if err := app.Save(record); err != nil {
+		app.Logger().Error("Unable to record assistant action", "error", err, "proposalId", proposal.ID)
+	}
+}
+
+// RecordDecision stores the outcome of a proposal in the audit log, creating
+// the entry if the proposal was never recorded when it was issued
+func RecordDecision(app core.App, proposal *Proposal, status string, decidedBy string, resultRecordId string, message string) {
+	record, err := app.FindFirstRecordByFilter("assistant_actions", "proposalId = {:id}", dbx.Params{"id": proposal.ID})
+	if err != nil {
+		RecordIssued(app, proposal, "")
+		record, err = app.FindFirstRecordByFilter("assistant_actions", "proposalId = {:id}", dbx.Params{"id": proposal.ID})
+		if err != nil {
+			return
+		}
+	}
+
+	// keep the arguments as they were applied, after validation and
+	// timezone normalization
+	record.Set("arguments", proposal.Arguments)
+	record.Set("schemaVersion", proposal.SchemaVersion)
+	record.Set("status", status)
+	record.Set("decidedBy", decidedBy)
+	record.Set("resultRecordId", resultRecordId)
+	record.Set("message", message)
+
+	if err := app.Save(record); err != nil {
+		app.Logger().Error("Unable to record assistant decision", "error", err, "proposalId", proposal.ID)
+	}
+}
+
+// Pending rebuilds the proposals still waiting for a decision from the audit
+// log, so they survive a restart of the server. Entries recorded before
+// proposals kept their expiry are left out.
+func Pending(app core.App) ([]*Proposal, error) {
+	now := time.Now().UTC()
+	records, err := app.FindRecordsByFilter("assistant_actions", "status = {:status} && expiresAt > {:now}", "created", 0, 0,
+		dbx.Params{"status": StatusProposed, "now": now.Format("2006-01-02 15:04:05.000Z")})
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]*Proposal, 0, len(records))
+	for _, record := range records {
+		proposal := &Proposal{
+			ID:            record.GetString("proposalId"),
+			TripID:        record.GetString("trip"),
+			Tool:          record.GetString("tool"),
+			Summary:       record.GetString("summary"),
+			RequestedBy:   record.GetString("requestedBy"),
+			CreatedAt:     record.GetDateTime("created").Time(),
+			ExpiresAt:     record.GetDateTime("expiresAt").Time(),
+			ContextAt:     record.GetDateTime("contextAt").Time(),
+			SchemaVersion: record.GetInt("schemaVersion"),
+		}
+		if err := record.UnmarshalJSONField("arguments", &proposal.Arguments); err != nil || proposal.Arguments == nil {
+			continue
+		}
+		_ = record.UnmarshalJSONField("assumptions", &proposal.Assumptions)
+		pending = append(pending, proposal)
+	}
+	return pending, nil
+}
@@ -0,0 +1,234 @@
+package proposals
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SchemaVersion is the version of the assistant tool schemas new proposals
+// follow. Bump it when the arguments of a tool change shape and add a shim
+// upgrading the older arguments to routes/proposal_schema.go, so proposals
+// still pending or restored from the audit log can be applied.
+const SchemaVersion = 1
+
+// Proposal is a change suggested by the assistant (or a background job) that
+// is kept in memory until the traveler approves or declines it
+type Proposal struct {
+	ID        string
+	TripID    string
+	Tool      string
+	Arguments map[string]interface{}
+	Summary   string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	// RequestedBy is the user whose chat produced the proposal, empty for
+	// proposals made by background jobs
+	RequestedBy string
+	// Assumptions are details the server filled in that the traveler did
+	// not give, shown with the proposal so they can be corrected
+	Assumptions []string
+	// ContextAt is when the trip was read to make the proposal. Updating or
+	// deleting a record changed after that is refused, a zero time skips
+	// the check.
+	ContextAt time.Time
+	// SchemaVersion is the version of the tool schemas the arguments
+	// follow, zero for proposals made before they were versioned
+	SchemaVersion int
+
+	// hash of the arguments when the proposal was stored, they are
+	// normalized in place before being applied
+	hash string
+}
+
+func (p *Proposal) Expired() bool {
+	return time.Now().UTC().After(p.ExpiresAt)
+}
+
+var store = struct {
+	sync.RWMutex
+	items    map[string]*Proposal
+	byHash   map[string]string
+	claimed  map[string]bool
+	outcomes map[string]Outcome
+}{
+	items:    make(map[string]*Proposal),
+	byHash:   make(map[string]string),
+	claimed:  make(map[string]bool),
+	outcomes: make(map[string]Outcome),
+}
+
+// Outcome is remembered for a while after a proposal was decided so a
+// collaborator deciding on the same proposal learns what happened to it
+type Outcome struct {
+	TripID    string    `json:"-"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message"`
+	DecidedAt time.Time `json:"decidedAt"`
+}
+
+const outcomeTTL = 10 * time.Minute
+
+// Hash identifies proposals that would make the same change to the same trip.
+// String arguments are compared ignoring case and surrounding whitespace.
+func (p *Proposal) Hash() string {
+	normalized := make(map[string]interface{}, len(p.Arguments))
+	for key, value := range p.Arguments {
+		if text, ok := value.(string); ok {
+			value = strings.ToLower(strings.TrimSpace(text))
+		}
+		normalized[key] = value
+	}
+
+	// map keys are sorted by encoding/json, which keeps the hash stable
+	args, _ := json.Marshal(normalized)
+	hash := sha256.New()
+	hash.Write([]byte(p.TripID + "|" + p.Tool + "|"))
+	hash.Write(args)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// stamp marks a new proposal with the current schema version
+func stamp(proposal *Proposal) {
+	if proposal.SchemaVersion == 0 {
+		proposal.SchemaVersion = SchemaVersion
+	}
+}
+
+func Store(proposal *Proposal) {
+	store.Lock()
+	defer store.Unlock()
+	stamp(proposal)
+	proposal.hash = proposal.Hash()
+	store.items[proposal.ID] = proposal
+	store.byHash[proposal.hash] = proposal.ID
+}
+
+// StoreUnique stores the proposal unless an equivalent one is still pending
+// for the trip. It returns the proposal clients should act on and whether it
+// was newly created.
+func StoreUnique(proposal *Proposal) (*Proposal, bool) {
+	store.Lock()
+	defer store.Unlock()
+
+	hash := proposal.Hash()
+	if id, ok := store.byHash[hash]; ok {
+		if existing, found := store.items[id]; found && !existing.Expired() {
+			return existing, false
+		}
+	}
+
+	stamp(proposal)
+	proposal.hash = hash
+	store.items[proposal.ID] = proposal
+	store.byHash[hash] = proposal.ID
+	return proposal, true
+}
+
+func Pop(id string) (*Proposal, bool) {
+	store.Lock()
+	defer store.Unlock()
+	proposal, ok := store.items[id]
+	if ok {
+		remove(proposal)
+	}
+	return proposal, ok
+}
+
+func Get(id string) (*Proposal, bool) {
+	store.RLock()
+	defer store.RUnlock()
+	proposal, ok := store.items[id]
+	return proposal, ok
+}
+
+// Claim marks the proposal as being applied. It fails when the proposal is
+// gone or someone else is already applying it, which prevents an approval
+// from two clients from creating the same record twice.
+func Claim(id string) (*Proposal, bool) {
+	store.Lock()
+	defer store.Unlock()
+	proposal, ok := store.items[id]
+	if !ok || store.claimed[id] {
+		return nil, false
+	}
+	store.claimed[id] = true
+	return proposal, true
+}
+
+// Release gives up a claim, e.g. when applying the proposal failed
+func Release(id string) {
+	store.Lock()
+	defer store.Unlock()
+	delete(store.claimed, id)
+}
+
+// Decide removes a pending proposal and remembers its outcome
+func Decide(id string, status string, message string) {
+	store.Lock()
+	defer store.Unlock()
+
+	proposal, ok := store.items[id]
+	if !ok {
+		return
+	}
+	remove(proposal)
+	store.outcomes[id] = Outcome{TripID: proposal.TripID, Status: status, Message: message, DecidedAt: time.Now().UTC()}
+
+	for key, outcome := range store.outcomes {
+		if time.Since(outcome.DecidedAt) > outcomeTTL {
+			delete(store.outcomes, key)
+		}
+	}
+}
+
+// DecidedOutcome returns the outcome of a recently decided proposal
+func DecidedOutcome(id string) (Outcome, bool) {
+	store.RLock()
+	defer store.RUnlock()
+	outcome, ok := store.outcomes[id]
+	if !ok || time.Since(outcome.DecidedAt) > outcomeTTL {
+		return Outcome{}, false
+	}
+	return outcome, true
+}
+
+// remove expects the store to be locked
+func remove(proposal *Proposal) {
+	delete(store.items, proposal.ID)
+	delete(store.claimed, proposal.ID)
+	if store.byHash[proposal.hash] == proposal.ID {
+		delete(store.byHash, proposal.hash)
+	}
+}
+
+// ListForTrip returns the proposals of a trip that have not expired yet,
+// oldest first. Expired proposals found along the way are dropped.
+func ListForTrip(tripID string) []*Proposal {
+	store.Lock()
+	defer store.Unlock()
+
+	pending := make([]*Proposal, 0)
+	for _, proposal := range store.items {
+		if proposal.Expired() {
+			remove(proposal)
+			continue
+		}
+		if proposal.TripID == tripID {
+			pending = append(pending, proposal)
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+	return pending
+}
+
+// ToolSwapActivities exchanges the days of two activities. It is proposed by
+// the assistant as well as by the weather reshuffle job.
+const ToolSwapActivities = "swap_activities"
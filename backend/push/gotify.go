@@ -0,0 +1,58 @@
+package push
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Gotify posts to a Gotify server with the token of an application created
+// for surmai
+type Gotify struct{}
+
+const (
+	gotifyPriority       = 5
+	gotifyUrgentPriority = 8
+)
+
+func (Gotify) Send(subscription Subscription, message Message) error {
+	priority := gotifyPriority
+	if message.Urgent {
+		priority = gotifyUrgentPriority
+	}
+	payload := map[string]interface{}{
+		"title":    message.Title,
+		"message":  message.Body,
+		"priority": priority,
+	}
+	if message.Link != "" {
+		payload["extras"] = map[string]interface{}{
+			"client::notification": map[string]interface{}{
+				"click": map[string]string{"url": message.Link},
+			},
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(subscription.Endpoint, "/")+"/message", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", subscription.Token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("gotify answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package push
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Ntfy publishes to a topic of an ntfy server, https://ntfy.sh or a self
+// hosted one
+type Ntfy struct{}
+
+func (Ntfy) Send(subscription Subscription, message Message) error {
+	url := strings.TrimSuffix(subscription.Endpoint, "/") + "/" + subscription.Topic
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(message.Body))
+	if err != nil {
+		return err
+	}
+	// headers are ASCII, ntfy decodes encoded words
+	req.Header.Set("Title", mime.QEncoding.Encode("utf-8", message.Title))
+	if message.Link != "" {
+		req.Header.Set("Click", message.Link)
+	}
+	if message.Tag != "" {
+		req.Header.Set("Tags", message.Tag)
+	}
+	if message.Urgent {
+		req.Header.Set("Priority", "high")
+	}
+	if subscription.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+subscription.Token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("ntfy answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package push
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// KindWebPush is a browser subscribed through the Push API
+	KindWebPush = "webpush"
+	// KindNtfy is a topic on an ntfy server
+	KindNtfy = "ntfy"
+	// KindGotify is an application on a Gotify server
+	KindGotify = "gotify"
+)
+
+// Kinds lists the supported kinds of subscriptions
+var Kinds = []string{KindWebPush, KindNtfy, KindGotify}
+
+// ErrSubscriptionGone is returned when the push service no longer knows the
+// subscription, it is dropped
+var ErrSubscriptionGone = errors.New("the push subscription is gone")
+
+const sendTimeout = 10 * time.Second
+
+var client = &http.Client{Timeout: sendTimeout}
+
+// Message is what shows on the device, Link is an absolute URL opened when
+// the notification is tapped
+type Message struct {
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	Link   string `json:"link,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+	Urgent bool   `json:"urgent,omitempty"`
+}
+
+// Subscription is one place a user gets pushes. Endpoint is the push
+// service URL of a browser or the ntfy or Gotify server. Token is the
+// Gotify application token or an ntfy access token.
+type Subscription struct {
+	Kind     string
+	Endpoint string
+	Topic    string
+	Token    string
+	P256dh   string
+	Auth     string
+}
+
+// Adapter delivers a message to subscriptions of one kind
+type Adapter interface {
+	Send(subscription Subscription, message Message) error
+}
+
+// SubscriptionFromRecord reads a push_subscriptions record
+func SubscriptionFromRecord(record *core.Record) Subscription {
+	return Subscription{
+		Kind:     record.GetString("kind"),
+		Endpoint: record.GetString("endpoint"),
+		Topic:    record.GetString("topic"),
+		Token:    record.GetString("token"),
+		P256dh:   record.GetString("p256dh"),
+		Auth:     record.GetString("auth"),
+	}
+}
+
+func adapterFor(app core.App, kind string) (Adapter, error) {
+	switch kind {
+	case KindWebPush:
+		keys, err := LoadVAPIDKeys(app)
+		if err != nil {
+			return nil, err
+		}
+		return WebPush{Keys: keys}, nil
+	case KindNtfy:
+		return Ntfy{}, nil
+	case KindGotify:
+		return Gotify{}, nil
+	}
+	return nil, fmt.Errorf("unknown push subscription kind %q", kind)
+}
+
+// Deliver sends the message to one subscription and keeps track of how it
+// went on the record. A subscription the push service dropped is deleted.
+func Deliver(app core.App, record *core.Record, message Message) error {
+	adapter, err := adapterFor(app, record.GetString("kind"))
+	if err != nil {
+		return err
+	}
+
+	err = adapter.Send(SubscriptionFromRecord(record), message)
+	if errors.Is(err, ErrSubscriptionGone) {
+		if deleteErr := app.Delete(record); deleteErr != nil {
+			app.Logger().Warn("Could not delete a gone push subscription", "error", deleteErr, "subscriptionId", record.Id)
+		}
+		return err
+	}
+
+	if err != nil {
+		record.Set("lastError", err.Error())
+	} else {
+		record.Set("lastError", "")
+		record.Set("lastUsedAt", types.NowDateTime())
+	}
+	if saveErr := app.Save(record); saveErr != nil {
+		app.Logger().Warn("Could not update the push subscription", "error", saveErr, "subscriptionId", record.Id)
+	}
+	return err
+}
+
+// SendToUser pushes the message to every subscription of the user, a user
+// without subscriptions gets nothing
+func SendToUser(app core.App, userId string, message Message) error {
+	subscriptions, err := app.FindAllRecords("push_subscriptions", dbx.HashExp{"user": userId})
+	if err != nil {
+		return err
+	}
+
+	failures := make([]error, 0)
+	for _, subscription := range subscriptions {
+		if err := Deliver(app, subscription, message); err != nil && !errors.Is(err, ErrSubscriptionGone) {
+			failures = append(failures, err)
+		}
+	}
+	return errors.Join(failures...)
+}
@@ -0,0 +1,94 @@
+package push
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// VAPIDKeys identify this server to the web push services, the keys are
+// the base64url encoded P-256 public point and private scalar every web
+// push library uses
+type VAPIDKeys struct {
+	PublicKey  string `json:"publicKey"`
+	PrivateKey string `json:"privateKey"`
+	Subject    string `json:"subject,omitempty"`
+}
+
+var ErrVAPIDKeys = errors.New("the VAPID keys are not valid")
+
+// GenerateVAPIDKeys makes a new pair of keys
+func GenerateVAPIDKeys() (VAPIDKeys, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return VAPIDKeys{}, err
+	}
+	return VAPIDKeys{
+		PublicKey:  base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		PrivateKey: base64.RawURLEncoding.EncodeToString(key.Bytes()),
+	}, nil
+}
+
+// LoadVAPIDKeys reads the keys from SURMAI_VAPID_PUBLIC_KEY and
+// SURMAI_VAPID_PRIVATE_KEY, or the ones generated for the instance in
+// surmai_settings. SURMAI_VAPID_SUBJECT is the contact the push services
+// see, the sender address of the emails by default.
+func LoadVAPIDKeys(app core.App) (VAPIDKeys, error) {
+	keys := VAPIDKeys{
+		PublicKey:  strings.TrimSpace(os.Getenv("SURMAI_VAPID_PUBLIC_KEY")),
+		PrivateKey: strings.TrimSpace(os.Getenv("SURMAI_VAPID_PRIVATE_KEY")),
+	}
+	if keys.PublicKey == "" || keys.PrivateKey == "" {
+		record, err := app.FindRecordById("surmai_settings", "web_push")
+		if err != nil {
+			return keys, err
+		}
+		if err := json.Unmarshal([]byte(record.GetString("value")), &keys); err != nil {
+			return keys, err
+		}
+	}
+
+	if subject := strings.TrimSpace(os.Getenv("SURMAI_VAPID_SUBJECT")); subject != "" {
+		keys.Subject = subject
+	}
+	if keys.Subject == "" {
+		if sender := app.Settings().Meta.SenderAddress; sender != "" {
+			keys.Subject = "mailto:" + sender
+		} else {
+			keys.Subject = app.Settings().Meta.AppURL
+		}
+	}
+	return keys, nil
+}
+
+// signingKey turns the private scalar into the key the VAPID tokens are
+// signed with
+func (keys VAPIDKeys) signingKey() (*ecdsa.PrivateKey, error) {
+	scalar, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(keys.PrivateKey, "="))
+	if err != nil {
+		return nil, ErrVAPIDKeys
+	}
+	private, err := ecdh.P256().NewPrivateKey(scalar)
+	if err != nil {
+		return nil, ErrVAPIDKeys
+	}
+	// the uncompressed point is 0x04 followed by X and Y
+	point := private.PublicKey().Bytes()
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(point[1:33]),
+			Y:     new(big.Int).SetBytes(point[33:]),
+		},
+		D: new(big.Int).SetBytes(scalar),
+	}, nil
+}
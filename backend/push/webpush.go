@@ -0,0 +1,172 @@
+package push
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// WebPush sends to browsers that subscribed with the Push API. The payload
+// is encrypted for the browser (RFC 8291) and the request is signed with
+// the VAPID keys of the server (RFC 8292).
+type WebPush struct {
+	Keys VAPIDKeys
+}
+
+const (
+	webPushTTL         = 24 * time.Hour
+	webPushTokenExpiry = 12 * time.Hour
+	webPushRecordSize  = 4096
+	// push services take 4096 bytes, less the header, the tag and the
+	// delimiter of the record
+	webPushMaxPayload = webPushRecordSize - 86 - 16 - 1
+)
+
+func (w WebPush) Send(subscription Subscription, message Message) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	for len(payload) > webPushMaxPayload && message.Body != "" {
+		body := []rune(message.Body)
+		message.Body = string(body[:len(body)*3/4]) + "…"
+		if payload, err = json.Marshal(message); err != nil {
+			return err
+		}
+	}
+	body, err := encryptWebPush(subscription, payload)
+	if err != nil {
+		return err
+	}
+	authorization, err := w.authorization(subscription.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", fmt.Sprint(int(webPushTTL.Seconds())))
+	req.Header.Set("Authorization", authorization)
+	if message.Urgent {
+		req.Header.Set("Urgency", "high")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrSubscriptionGone
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("the push service answered %s", resp.Status)
+	}
+	return nil
+}
+
+// authorization signs a token for the origin of the push service
+func (w WebPush) authorization(endpoint string) (string, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	key, err := w.Keys.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": parsed.Scheme + "://" + parsed.Host,
+		"exp": time.Now().Add(webPushTokenExpiry).Unix(),
+		"sub": w.Keys.Subject,
+	}).SignedString(key)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("vapid t=%s, k=%s", token, w.Keys.PublicKey), nil
+}
+
+// encryptWebPush encrypts the payload for the keys of the subscription as a
+// single aes128gcm record
+func encryptWebPush(subscription Subscription, payload []byte) ([]byte, error) {
+	decode := func(value string) ([]byte, error) {
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	}
+	userAgentKey, err := decode(subscription.P256dh)
+	if err != nil {
+		return nil, err
+	}
+	authSecret, err := decode(subscription.Auth)
+	if err != nil {
+		return nil, err
+	}
+	userAgentPublic, err := ecdh.P256().NewPublicKey(userAgentKey)
+	if err != nil {
+		return nil, err
+	}
+
+	serverKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := serverKey.ECDH(userAgentPublic)
+	if err != nil {
+		return nil, err
+	}
+	serverPublic := serverKey.PublicKey().Bytes()
+
+	keyInfo := "WebPush: info\x00" + string(userAgentKey) + string(serverPublic)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	contentKey, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// 0x02 marks the last and only record
+	ciphertext := gcm.Seal(nil, nonce, append(payload, 0x02), nil)
+
+	header := make([]byte, 0, 16+4+1+len(serverPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(serverPublic)))
+	header = append(header, serverPublic...)
+	return append(header, ciphertext...), nil
+}
@@ -0,0 +1,92 @@
+package qrcode
+
+// penalty scores how hard the modules are to read, the mask giving the
+// lowest score is kept: long runs of one color, 2x2 blocks, patterns that
+// look like finders and an uneven share of dark modules
+func (c *Code) penalty() int {
+	result := 0
+
+	for y := 0; y < c.Size; y++ {
+		result += c.linePenalty(func(i int) bool { return c.modules[y][i] })
+	}
+	for x := 0; x < c.Size; x++ {
+		result += c.linePenalty(func(i int) bool { return c.modules[i][x] })
+	}
+
+	for y := 0; y < c.Size-1; y++ {
+		for x := 0; x < c.Size-1; x++ {
+			color := c.modules[y][x]
+			if color == c.modules[y][x+1] && color == c.modules[y+1][x] && color == c.modules[y+1][x+1] {
+				result += 3
+			}
+		}
+	}
+
+	dark := 0
+	for _, row := range c.modules {
+		for _, module := range row {
+			if module {
+				dark++
+			}
+		}
+	}
+	total := c.Size * c.Size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	result += k * 10
+
+	return result
+}
+
+func (c *Code) linePenalty(module func(int) bool) int {
+	result := 0
+	runColor, runLength := false, 0
+	var history [7]int
+	for i := 0; i < c.Size; i++ {
+		if module(i) == runColor {
+			runLength++
+			if runLength == 5 {
+				result += 3
+			} else if runLength > 5 {
+				result++
+			}
+			continue
+		}
+		c.addRun(runLength, &history)
+		if !runColor {
+			result += finderPatterns(history) * 40
+		}
+		runColor, runLength = module(i), 1
+	}
+
+	// the light border closes the line
+	if runColor {
+		c.addRun(runLength, &history)
+		runLength = 0
+	}
+	c.addRun(runLength+c.Size, &history)
+	return result + finderPatterns(history)*40
+}
+
+func (c *Code) addRun(length int, history *[7]int) {
+	if history[0] == 0 {
+		// the light border opens the line
+		length += c.Size
+	}
+	copy(history[1:], history[:6])
+	history[0] = length
+}
+
+// finderPatterns counts the dark-light-dark-dark-dark-light-dark runs, in
+// the 1:1:3:1:1 proportions of a finder, with light space on one side
+func finderPatterns(history [7]int) int {
+	n := history[1]
+	core := n > 0 && history[2] == n && history[3] == n*3 && history[4] == n && history[5] == n
+	count := 0
+	if core && history[0] >= n*4 && history[6] >= n {
+		count++
+	}
+	if core && history[6] >= n*4 && history[0] >= n {
+		count++
+	}
+	return count
+}
@@ -0,0 +1,130 @@
+package routes
+
+import (
+	"backend/planning"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const aiConfigBundleVersion = 1
+
+// aiConfigBundle is the portable form of the assistant settings. The OpenAI
+// key is read from the environment and is never part of it.
+type aiConfigBundle struct {
+	Version    int               `json:"version"`
+	ExportedAt string            `json:"exportedAt"`
+	Provider   string            `json:"provider"`
+	Assistant  assistantSettings `json:"assistant"`
+}
+
+func ExportAIConfig(e *core.RequestEvent) error {
+
+	settings := assistantSettings{}
+	if record, err := e.App.FindRecordById("surmai_settings", "assistant_config"); err == nil {
+		_ = json.Unmarshal([]byte(record.GetString("value")), &settings)
+	}
+	if settings.DisabledTools == nil {
+		settings.DisabledTools = []string{}
+	}
+
+	return e.JSON(http.StatusOK, aiConfigBundle{
+		Version:    aiConfigBundleVersion,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Provider:   "openai",
+		Assistant:  settings,
+	})
+}
+
+func ImportAIConfig(e *core.RequestEvent) error {
+
+	var bundle aiConfigBundle
+	if err := json.NewDecoder(e.Request.Body).Decode(&bundle); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid configuration bundle"})
+	}
+	if bundle.Version != aiConfigBundleVersion {
+		return e.JSON(http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("unsupported bundle version %d", bundle.Version),
+		})
+	}
+
+	settings := bundle.Assistant
+	if err := validateAssistantSettings(settings); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	collection, err := e.App.FindCollectionByNameOrId("surmai_settings")
+	if err != nil {
+		return err
+	}
+	record, err := e.App.FindRecordById("surmai_settings", "assistant_config")
+	if err != nil {
+		record = core.NewRecord(collection)
+		record.Set("id", "assistant_config")
+	}
+	record.Set("value", settings)
+	if err := e.App.Save(record); err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"status":    "imported",
+		"assistant": settings,
+	})
+}
+
+// validateAssistantSettings rejects values loadAssistantConfig would
+// otherwise silently ignore, so a bad bundle fails loudly on import
+func validateAssistantSettings(settings assistantSettings) error {
+	durations := map[string]string{
+		"proposalTtl":       settings.ProposalTTL,
+		"requestTimeout":    settings.RequestTimeout,
+		"idleTimeout":       settings.IdleTimeout,
+		"streamTimeout":     settings.StreamTimeout,
+		"heartbeatInterval": settings.HeartbeatInterval,
+	}
+	for name, value := range durations {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		if _, ok := parsePositiveDuration(value); !ok {
+			return fmt.Errorf("%s must be a positive duration such as 30s or 2m", name)
+		}
+	}
+
+	for category, value := range settings.ActivityDurations {
+		if _, ok := parsePositiveDuration(value); !ok {
+			return fmt.Errorf("activityDurations.%s must be a positive duration such as 90m", category)
+		}
+	}
+
+	if settings.MaxStreamsPerUser < 0 {
+		return fmt.Errorf("maxStreamsPerUser must not be negative")
+	}
+	if settings.StreamPadding < 0 || settings.StreamPadding > maxStreamPadding {
+		return fmt.Errorf("streamPadding must be between 0 and %d bytes", maxStreamPadding)
+	}
+	if settings.MaxEventBytes < 0 || settings.MaxEventBytes > maxStreamEventBytes {
+		return fmt.Errorf("maxEventBytes must be between 0 and %d bytes", maxStreamEventBytes)
+	}
+
+	if ranker := strings.TrimSpace(settings.SuggestionRanker); ranker != "" && planning.SuggestionRankers[ranker] == nil {
+		return fmt.Errorf("unknown suggestionRanker %q", ranker)
+	}
+
+	known := map[string]bool{}
+	for _, tool := range buildAssistantTools(assistantConfig{}) {
+		known[assistantToolName(tool)] = true
+	}
+	for _, tool := range settings.DisabledTools {
+		if !known[tool] {
+			return fmt.Errorf("unknown tool %q in disabledTools", tool)
+		}
+	}
+
+	return nil
+}
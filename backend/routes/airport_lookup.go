@@ -0,0 +1,64 @@
+package routes
+
+import (
+	"backend/datasets"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultLookupLimit = 10
+	maxLookupLimit     = 50
+)
+
+// SearchAirports autocompletes airports by IATA or ICAO code, name or city
+func SearchAirports(e *core.RequestEvent) error {
+	limit, err := lookupLimit(e)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return e.JSON(http.StatusOK, datasets.SearchAirports(e.Request.URL.Query().Get("q"), limit))
+}
+
+// GetAirport resolves an IATA or ICAO code, "SFO" or "KSFO", to the airport
+// with its coordinates and timezone
+func GetAirport(e *core.RequestEvent) error {
+	airport, found := datasets.FindAirport(e.Request.PathValue("code"))
+	if !found {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "unknown airport code"})
+	}
+	return e.JSON(http.StatusOK, airport)
+}
+
+// SearchAirlines autocompletes airlines by code or name
+func SearchAirlines(e *core.RequestEvent) error {
+	limit, err := lookupLimit(e)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return e.JSON(http.StatusOK, datasets.SearchAirlines(e.Request.URL.Query().Get("q"), limit))
+}
+
+// GetAirline resolves an airline code, "LH", to the airline
+func GetAirline(e *core.RequestEvent) error {
+	airline, found := datasets.FindAirline(e.Request.PathValue("code"))
+	if !found {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "unknown airline code"})
+	}
+	return e.JSON(http.StatusOK, airline)
+}
+
+func lookupLimit(e *core.RequestEvent) (int, error) {
+	value := e.Request.URL.Query().Get("limit")
+	if value == "" {
+		return defaultLookupLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxLookupLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxLookupLimit)
+	}
+	return limit, nil
+}
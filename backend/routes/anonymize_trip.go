@@ -0,0 +1,44 @@
+package routes
+
+import (
+	"backend/trips"
+	"github.com/pocketbase/pocketbase/core"
+	"net/http"
+)
+
+func AnonymizeTrip(e *core.RequestEvent) error {
+
+	info, err := e.RequestInfo()
+	if err != nil {
+		return err
+	}
+
+	tripId, _ := info.Body["tripId"].(string)
+	trip, err := e.App.FindRecordById("trips", tripId)
+	if err != nil {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "trip not found"})
+	}
+
+	// the copy goes to the original owner unless another user is given
+	ownerId, _ := info.Body["ownerId"].(string)
+	if ownerId == "" {
+		ownerId = trip.GetString("ownerId")
+	}
+	if _, err := e.App.FindRecordById("users", ownerId); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "owner not found"})
+	}
+
+	shiftDays := 0
+	if val, ok := info.Body["shiftDays"].(float64); ok {
+		shiftDays = int(val)
+	}
+
+	cloneId, err := trips.CloneAnonymizedTrip(e.App, trip, ownerId, shiftDays)
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, map[string]string{
+		"tripId": cloneId,
+	})
+}
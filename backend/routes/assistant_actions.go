@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"backend/trips"
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const maxAssistantActions = 200
+
+type assistantAction struct {
+	Id             string                 `json:"id"`
+	ProposalId     string                 `json:"proposalId"`
+	Tool           string                 `json:"tool"`
+	Arguments      map[string]interface{} `json:"arguments"`
+	Summary        string                 `json:"summary"`
+	Status         string                 `json:"status"`
+	RequestedBy    string                 `json:"requestedBy,omitempty"`
+	DecidedBy      string                 `json:"decidedBy,omitempty"`
+	ResultRecordId string                 `json:"resultRecordId,omitempty"`
+	Message        string                 `json:"message,omitempty"`
+	Created        string                 `json:"created"`
+	Updated        string                 `json:"updated"`
+}
+
+// AssistantActions lists the changes the assistant proposed for the trip,
+// newest first, with who decided on them and what record was affected.
+// Viewers get them without prices and confirmation codes.
+func AssistantActions(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	limit := 50
+	if requested, err := strconv.Atoi(e.Request.URL.Query().Get("limit")); err == nil && requested > 0 {
+		limit = min(requested, maxAssistantActions)
+	}
+
+	records, err := e.App.FindRecordsByFilter("assistant_actions", "trip = {:tripId}", "-created", limit, 0, dbx.Params{"tripId": trip.Id})
+	if err != nil {
+		return err
+	}
+
+	userNames := assistantActionUserNames(e.App, records)
+	viewer := !trips.CanEdit(requestTripRole(e))
+	locale := loadAssistantLocale(e.Auth)
+
+	actions := make([]assistantAction, 0, len(records))
+	for _, record := range records {
+		var arguments map[string]interface{}
+		_ = record.UnmarshalJSONField("arguments", &arguments)
+		summary := record.GetString("summary")
+		if viewer {
+			arguments = viewerSafeArguments(arguments)
+			summary = summarizeProposal(record.GetString("tool"), arguments, locale)
+		}
+
+		actions = append(actions, assistantAction{
+			Id:             record.Id,
+			ProposalId:     record.GetString("proposalId"),
+			Tool:           record.GetString("tool"),
+			Arguments:      arguments,
+			Summary:        summary,
+			Status:         record.GetString("status"),
+			RequestedBy:    userNames[record.GetString("requestedBy")],
+			DecidedBy:      userNames[record.GetString("decidedBy")],
+			ResultRecordId: record.GetString("resultRecordId"),
+			Message:        record.GetString("message"),
+			Created:        record.GetDateTime("created").String(),
+			Updated:        record.GetDateTime("updated").String(),
+		})
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{"actions": actions})
+}
+
+func assistantActionUserNames(app core.App, records []*core.Record) map[string]string {
+	ids := make([]string, 0)
+	for _, record := range records {
+		for _, field := range []string{"requestedBy", "decidedBy"} {
+			if id := record.GetString(field); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	names := map[string]string{}
+	if len(ids) == 0 {
+		return names
+	}
+
+	users, err := app.FindRecordsByIds("users", ids)
+	if err != nil {
+		return names
+	}
+	for _, user := range users {
+		names[user.Id] = user.GetString("name")
+	}
+	return names
+}
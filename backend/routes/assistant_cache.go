@@ -0,0 +1,74 @@
+package routes
+
+import (
+	"backend/cache"
+	"backend/tripcontext"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const assistantCacheTTL = 5 * time.Minute
+
+// assistantCacheKey identifies an answer by the trip, the trip context it was
+// generated from, the whole conversation that led to it, the requested
+// verbosity and the locale the answer is written for. A follow-up like "yes"
+// only gets the cached answer of the same conversation.
+// GeneratedAt is left out of the hash, otherwise every request would produce
+// a different key.
+func assistantCacheKey(tripID string, ctx *tripcontext.Context, messages []assistantMessage, verbosity string, locale assistantLocale) (string, bool) {
+	if lastUserMessage(messages) == "" || hasAssistantImages(messages) {
+		return "", false
+	}
+
+	snapshot := *ctx
+	snapshot.GeneratedAt = ""
+	ctxJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", false
+	}
+
+	hash := sha256.New()
+	hash.Write(ctxJSON)
+	hash.Write([]byte{0})
+	for _, message := range messages {
+		hash.Write([]byte(message.Role))
+		hash.Write([]byte{0})
+		hash.Write([]byte(strings.ToLower(strings.TrimSpace(message.Content))))
+		hash.Write([]byte{0})
+	}
+	hash.Write([]byte(verbosity))
+	hash.Write([]byte{0})
+	hash.Write([]byte(locale.key()))
+
+	return cache.TripKey(tripID, "assistant", hex.EncodeToString(hash.Sum(nil))), true
+}
+
+func lastUserMessage(messages []assistantMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" && strings.TrimSpace(messages[i].Content) != "" {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
+func getCachedAssistantReply(key string) (*assistantReply, bool) {
+	val, found := cache.Get(key)
+	if !found {
+		return nil, false
+	}
+	reply, ok := val.(*assistantReply)
+	return reply, ok && reply != nil
+}
+
+// cacheAssistantReply keeps a finished reply, one that was cut short is not
+// handed out again as the answer
+func cacheAssistantReply(key string, reply *assistantReply) {
+	if reply == nil || reply.Truncated != "" || strings.TrimSpace(reply.Text) == "" {
+		return
+	}
+	cache.Set(key, reply, assistantCacheTTL)
+}
@@ -0,0 +1,149 @@
+package routes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	assistantToolCreateCarRental = "create_car_rental"
+	assistantToolUpdateCarRental = "update_car_rental"
+	assistantToolDeleteCarRental = "delete_car_rental"
+)
+
+func saveCarRentalProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
+	collection, err := app.FindCollectionByNameOrId("car_rentals")
+	if err != nil {
+		return "", "", err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("trip", tripID)
+	setCarRentalFields(record, args)
+	applyCostUpdate(record, args)
+
+	if err := app.Save(record); err != nil {
+		return "", "", err
+	}
+
+	return record.Id, fmt.Sprintf("Added %s picked up at %s on %s.", carRentalName(record), record.GetString("pickupLocation"), stringValue(args["pickup_time"])), nil
+}
+
+func updateCarRentalProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
+	record, err := ensureTripRecord(app, "car_rentals", stringValue(args["record_id"]), tripID)
+	if err != nil {
+		return "", "", err
+	}
+
+	setCarRentalFields(record, args)
+	applyCostUpdate(record, args)
+
+	if err := app.Save(record); err != nil {
+		return "", "", err
+	}
+
+	return record.Id, fmt.Sprintf("Updated %s.", carRentalName(record)), nil
+}
+
+func deleteCarRentalProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
+	record, err := ensureTripRecord(app, "car_rentals", stringValue(args["record_id"]), tripID)
+	if err != nil {
+		return "", "", err
+	}
+
+	name := carRentalName(record)
+	if err := app.Delete(record); err != nil {
+		return "", "", err
+	}
+
+	return record.Id, fmt.Sprintf("Removed %s.", name), nil
+}
+
+// setCarRentalFields copies the arguments that were given, so updates only
+// change what the model sent
+func setCarRentalFields(record *core.Record, args map[string]interface{}) {
+	fields := map[string]string{
+		"provider":         "provider",
+		"pickup_location":  "pickupLocation",
+		"dropoff_location": "dropoffLocation",
+		"pickup_time":      "pickupTime",
+		"dropoff_time":     "dropoffTime",
+		"confirmation":     "confirmationCode",
+		"vehicle_class":    "vehicleClass",
+		"notes":            "notes",
+	}
+	for arg, field := range fields {
+		if value := stringValue(args[arg]); value != "" {
+			record.Set(field, value)
+		}
+	}
+	setMetadataTimezone(record, "pickup", stringValue(args["pickup_timezone"]))
+	setMetadataTimezone(record, "dropoff", stringValue(args["dropoff_timezone"]))
+}
+
+func carRentalName(record *core.Record) string {
+	return strings.TrimSpace(fmt.Sprintf("%s car rental", record.GetString("provider")))
+}
+
+func assistantCarRentalTools() []map[string]interface{} {
+	carRentalProperties := func() map[string]interface{} {
+		return map[string]interface{}{
+			"provider":         map[string]interface{}{"type": "string", "description": "Rental company, e.g. Hertz"},
+			"pickup_location":  map[string]interface{}{"type": "string", "description": "Where the car is picked up, e.g. the airport or an address"},
+			"dropoff_location": map[string]interface{}{"type": "string", "description": "Where the car is returned, leave empty when it is the pickup location"},
+			"pickup_time":      map[string]interface{}{"type": "string", "description": "Pickup time in RFC3339"},
+			"dropoff_time":     map[string]interface{}{"type": "string", "description": "Return time in RFC3339"},
+			"pickup_timezone":  map[string]interface{}{"type": "string", "description": "IANA timezone of the pickup location"},
+			"dropoff_timezone": map[string]interface{}{"type": "string", "description": "IANA timezone of the dropoff location"},
+			"confirmation":     map[string]interface{}{"type": "string", "description": "Confirmation number or reservation code"},
+			"vehicle_class":    map[string]interface{}{"type": "string", "description": "Vehicle class or model, e.g. compact or Toyota Corolla"},
+			"cost_value":       map[string]interface{}{"type": "number"},
+			"cost_currency":    map[string]interface{}{"type": "string", "description": "ISO currency code, e.g. EUR"},
+			"notes":            map[string]interface{}{"type": "string"},
+		}
+	}
+
+	updateProperties := carRentalProperties()
+	updateProperties["record_id"] = map[string]interface{}{"type": "string"}
+
+	return []map[string]interface{}{
+		{
+			"type":        "function",
+			"name":        assistantToolCreateCarRental,
+			"description": "Propose adding a rented car to this trip, with where and when it is picked up and returned.",
+			"parameters": map[string]interface{}{
+				"type":                 "object",
+				"properties":           carRentalProperties(),
+				"required":             []string{"pickup_location", "pickup_time"},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"type":        "function",
+			"name":        assistantToolUpdateCarRental,
+			"description": "Update an existing car rental by record_id. Only include fields that change.",
+			"parameters": map[string]interface{}{
+				"type":                 "object",
+				"properties":           updateProperties,
+				"required":             []string{"record_id"},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"type":        "function",
+			"name":        assistantToolDeleteCarRental,
+			"description": "Delete an existing car rental by record_id.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"record_id": map[string]interface{}{"type": "string"},
+					"reason":    map[string]interface{}{"type": "string", "description": "Optional reason/reminder"},
+				},
+				"required":             []string{"record_id"},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
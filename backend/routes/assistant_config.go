@@ -0,0 +1,185 @@
+package routes
+
+import (
+	"backend/planning"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultProposalTTL    = 2 * time.Minute
+	defaultRequestTimeout = 45 * time.Second
+	defaultIdleTimeout    = 90 * time.Second
+	defaultStreamTimeout  = 10 * time.Minute
+	defaultMaxEventBytes  = 4 << 20
+	// a single event larger than this is a broken stream, not a big reply
+	maxStreamEventBytes      = 64 << 20
+	defaultHeartbeatInterval = 15 * time.Second
+	defaultMaxStreamsPerUser = 2
+	defaultSuggestionRanker  = "local"
+	// proxies that hold back small responses are usually satisfied by a few KB
+	maxStreamPadding = 64 << 10
+)
+
+// assistantConfig holds the deployment specific tuning of the assistant
+type assistantConfig struct {
+	Model       string
+	ProposalTTL time.Duration
+	// RequestTimeout bounds the wait for the headers of the model response
+	RequestTimeout time.Duration
+	// IdleTimeout ends a stream that sent nothing for that long and
+	// StreamTimeout one that runs longer than that in total
+	IdleTimeout   time.Duration
+	StreamTimeout time.Duration
+	// MaxEventBytes is the largest single event read from the stream, such
+	// as a web search with many sources
+	MaxEventBytes     int
+	HeartbeatInterval time.Duration
+	MaxStreamsPerUser int
+	// StreamPadding is the size in bytes of a comment sent first on every
+	// stream, for proxies that buffer a response until enough has arrived
+	StreamPadding int
+	// PromptInstructions are appended to the built-in system prompt
+	PromptInstructions string
+	DisabledTools      map[string]bool
+	// ActivityDurations fill in the end of new activities, see planning.EstimateDuration
+	ActivityDurations map[string]time.Duration
+	// SuggestionRanker orders the places found for the travelers, see
+	// planning.SuggestionRankers
+	SuggestionRanker string
+	// IncludeWeather adds the forecast of the trip days to the context
+	IncludeWeather bool
+}
+
+// assistantSettings is the value of the assistant_config record in
+// surmai_settings. Durations use Go syntax, e.g. "10m" or "30s".
+type assistantSettings struct {
+	Model              string   `json:"model"`
+	ProposalTTL        string   `json:"proposalTtl"`
+	RequestTimeout     string   `json:"requestTimeout"`
+	IdleTimeout        string   `json:"idleTimeout"`
+	StreamTimeout      string   `json:"streamTimeout"`
+	MaxEventBytes      int      `json:"maxEventBytes"`
+	HeartbeatInterval  string   `json:"heartbeatInterval"`
+	MaxStreamsPerUser  int      `json:"maxStreamsPerUser"`
+	StreamPadding      int      `json:"streamPadding"`
+	PromptInstructions string   `json:"promptInstructions"`
+	DisabledTools      []string `json:"disabledTools"`
+	// ActivityDurations maps a category to a duration, e.g. {"museum": "2h"}
+	ActivityDurations map[string]string `json:"activityDurations"`
+	SuggestionRanker  string            `json:"suggestionRanker"`
+	IncludeWeather    bool              `json:"includeWeather"`
+}
+
+// loadAssistantConfig starts from the built-in defaults, applies the
+// SURMAI_ASSISTANT_* environment variables and finally the assistant_config
+// setting, so administrators can adjust a running instance
+func loadAssistantConfig(app core.App) assistantConfig {
+	config := assistantConfig{
+		Model:             openAIModel,
+		ProposalTTL:       defaultProposalTTL,
+		RequestTimeout:    defaultRequestTimeout,
+		IdleTimeout:       defaultIdleTimeout,
+		StreamTimeout:     defaultStreamTimeout,
+		MaxEventBytes:     defaultMaxEventBytes,
+		HeartbeatInterval: defaultHeartbeatInterval,
+		MaxStreamsPerUser: defaultMaxStreamsPerUser,
+		SuggestionRanker:  defaultSuggestionRanker,
+		ActivityDurations: make(map[string]time.Duration, len(planning.DefaultActivityDurations)),
+	}
+	for category, duration := range planning.DefaultActivityDurations {
+		config.ActivityDurations[category] = duration
+	}
+
+	maxStreams, _ := strconv.Atoi(strings.TrimSpace(os.Getenv("SURMAI_ASSISTANT_MAX_STREAMS")))
+	padding, _ := strconv.Atoi(strings.TrimSpace(os.Getenv("SURMAI_ASSISTANT_STREAM_PADDING")))
+	maxEventBytes, _ := strconv.Atoi(strings.TrimSpace(os.Getenv("SURMAI_ASSISTANT_MAX_EVENT_BYTES")))
+
+	config.apply(assistantSettings{
+		Model:             os.Getenv("SURMAI_ASSISTANT_MODEL"),
+		ProposalTTL:       os.Getenv("SURMAI_ASSISTANT_PROPOSAL_TTL"),
+		RequestTimeout:    os.Getenv("SURMAI_ASSISTANT_REQUEST_TIMEOUT"),
+		IdleTimeout:       os.Getenv("SURMAI_ASSISTANT_IDLE_TIMEOUT"),
+		StreamTimeout:     os.Getenv("SURMAI_ASSISTANT_STREAM_TIMEOUT"),
+		MaxEventBytes:     maxEventBytes,
+		HeartbeatInterval: os.Getenv("SURMAI_ASSISTANT_HEARTBEAT_INTERVAL"),
+		MaxStreamsPerUser: maxStreams,
+		StreamPadding:     padding,
+		SuggestionRanker:  os.Getenv("SURMAI_ASSISTANT_SUGGESTION_RANKER"),
+		IncludeWeather:    os.Getenv("SURMAI_ASSISTANT_WEATHER") == "true",
+	})
+
+	if record, err := app.FindRecordById("surmai_settings", "assistant_config"); err == nil {
+		var settings assistantSettings
+		if err := json.Unmarshal([]byte(record.GetString("value")), &settings); err == nil {
+			config.apply(settings)
+		} else {
+			app.Logger().Warn("Ignoring invalid assistant_config setting", "error", err)
+		}
+	}
+
+	return config
+}
+
+func (c *assistantConfig) apply(settings assistantSettings) {
+	if model := strings.TrimSpace(settings.Model); model != "" {
+		c.Model = model
+	}
+	if ttl, ok := parsePositiveDuration(settings.ProposalTTL); ok {
+		c.ProposalTTL = ttl
+	}
+	if timeout, ok := parsePositiveDuration(settings.RequestTimeout); ok {
+		c.RequestTimeout = timeout
+	}
+	if timeout, ok := parsePositiveDuration(settings.IdleTimeout); ok {
+		c.IdleTimeout = timeout
+	}
+	if timeout, ok := parsePositiveDuration(settings.StreamTimeout); ok {
+		c.StreamTimeout = timeout
+	}
+	if settings.MaxEventBytes > 0 {
+		c.MaxEventBytes = min(settings.MaxEventBytes, maxStreamEventBytes)
+	}
+	if interval, ok := parsePositiveDuration(settings.HeartbeatInterval); ok {
+		c.HeartbeatInterval = interval
+	}
+	if settings.MaxStreamsPerUser > 0 {
+		c.MaxStreamsPerUser = settings.MaxStreamsPerUser
+	}
+	if settings.StreamPadding > 0 {
+		c.StreamPadding = min(settings.StreamPadding, maxStreamPadding)
+	}
+	if instructions := strings.TrimSpace(settings.PromptInstructions); instructions != "" {
+		c.PromptInstructions = instructions
+	}
+	for category, value := range settings.ActivityDurations {
+		if duration, ok := parsePositiveDuration(value); ok {
+			c.ActivityDurations[strings.ToLower(strings.TrimSpace(category))] = duration
+		}
+	}
+	if ranker := strings.TrimSpace(settings.SuggestionRanker); planning.SuggestionRankers[ranker] != nil {
+		c.SuggestionRanker = ranker
+	}
+	if settings.IncludeWeather {
+		c.IncludeWeather = true
+	}
+	if len(settings.DisabledTools) > 0 {
+		c.DisabledTools = make(map[string]bool, len(settings.DisabledTools))
+		for _, tool := range settings.DisabledTools {
+			c.DisabledTools[tool] = true
+		}
+	}
+}
+
+func parsePositiveDuration(value string) (time.Duration, bool) {
+	parsed, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil || parsed <= 0 {
+		return 0, false
+	}
+	return parsed, true
+}
@@ -0,0 +1,193 @@
+package routes
+
+import (
+	"backend/tripcontext"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	assistantContextCacheTTL      = 10 * time.Minute
+	defaultAssistantContextTokens = 12000
+	maxTripNotesChars             = 2000
+	maxRecordTextChars            = 500
+)
+
+// assistantContextTokenLimit reads SURMAI_ASSISTANT_CONTEXT_TOKENS, falling back
+// to a limit that leaves plenty of room for the conversation itself
+func assistantContextTokenLimit() int {
+	if limit, err := strconv.Atoi(strings.TrimSpace(os.Getenv("SURMAI_ASSISTANT_CONTEXT_TOKENS"))); err == nil && limit > 0 {
+		return limit
+	}
+	return defaultAssistantContextTokens
+}
+
+// estimateTokens uses the usual ~4 characters per token approximation on the
+// serialized value, which is close enough for budgeting purposes
+func estimateTokens(v interface{}) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(data)/4 + 1
+}
+
+func truncateText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "…"
+}
+
+type budgetedRecord struct {
+	kind     string
+	index    int
+	distance time.Duration
+	tokens   int
+}
+
+// applyContextBudget shrinks the context until its estimated size fits the
+// limit. Long text is truncated first, then metadata is dropped and finally
+// the records furthest away from now are left out.
+func applyContextBudget(ctx *tripcontext.Context, limit int, now time.Time) *tripcontext.Context {
+	if estimateTokens(ctx) <= limit {
+		return ctx
+	}
+
+	shortenContextText(ctx)
+	if estimateTokens(ctx) <= limit {
+		return ctx
+	}
+
+	ctx.RecentChanges = nil
+	for i := range ctx.Transportations {
+		ctx.Transportations[i].Metadata = nil
+	}
+	for i := range ctx.Lodgings {
+		ctx.Lodgings[i].Metadata = nil
+	}
+	for i := range ctx.Activities {
+		ctx.Activities[i].Metadata = nil
+	}
+	for i := range ctx.CarRentals {
+		ctx.CarRentals[i].Metadata = nil
+	}
+	for i := range ctx.Dining {
+		ctx.Dining[i].Metadata = nil
+	}
+
+	total := estimateTokens(ctx)
+	if total <= limit {
+		return ctx
+	}
+
+	candidates := make([]budgetedRecord, 0, len(ctx.Transportations)+len(ctx.Lodgings)+len(ctx.Activities)+len(ctx.Expenses)+len(ctx.Rentals)+len(ctx.CarRentals)+len(ctx.Dining)+len(ctx.Tickets))
+	for i, t := range ctx.Transportations {
+		candidates = append(candidates, budgetedRecord{"transportation", i, distanceFromNow(t.Departure, now), estimateTokens(t)})
+	}
+	for i, l := range ctx.Lodgings {
+		candidates = append(candidates, budgetedRecord{"lodging", i, distanceFromNow(l.CheckIn, now), estimateTokens(l)})
+	}
+	for i, a := range ctx.Activities {
+		candidates = append(candidates, budgetedRecord{"activity", i, distanceFromNow(a.Start, now), estimateTokens(a)})
+	}
+	for i, x := range ctx.Expenses {
+		candidates = append(candidates, budgetedRecord{"expense", i, distanceFromNow(x.OccurredOn, now), estimateTokens(x)})
+	}
+	for i, r := range ctx.Rentals {
+		candidates = append(candidates, budgetedRecord{"rental", i, distanceFromNow(r.Pickup, now), estimateTokens(r)})
+	}
+	for i, r := range ctx.CarRentals {
+		candidates = append(candidates, budgetedRecord{"car_rental", i, distanceFromNow(r.PickupTime, now), estimateTokens(r)})
+	}
+	for i, d := range ctx.Dining {
+		candidates = append(candidates, budgetedRecord{"dining", i, distanceFromNow(d.Time, now), estimateTokens(d)})
+	}
+	for i, t := range ctx.Tickets {
+		candidates = append(candidates, budgetedRecord{"ticket", i, distanceFromNow(t.EntryStart, now), estimateTokens(t)})
+	}
+
+	// furthest from now first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance > candidates[j].distance
+	})
+
+	dropped := map[string]map[int]bool{
+		"transportation": {},
+		"lodging":        {},
+		"activity":       {},
+		"expense":        {},
+		"rental":         {},
+		"car_rental":     {},
+		"dining":         {},
+		"ticket":         {},
+	}
+	for _, candidate := range candidates {
+		if total <= limit {
+			break
+		}
+		dropped[candidate.kind][candidate.index] = true
+		total -= candidate.tokens
+		ctx.OmittedRecords++
+	}
+
+	ctx.Transportations = keepRecords(ctx.Transportations, dropped["transportation"])
+	ctx.Lodgings = keepRecords(ctx.Lodgings, dropped["lodging"])
+	ctx.Activities = keepRecords(ctx.Activities, dropped["activity"])
+	ctx.Expenses = keepRecords(ctx.Expenses, dropped["expense"])
+	ctx.Rentals = keepRecords(ctx.Rentals, dropped["rental"])
+	ctx.CarRentals = keepRecords(ctx.CarRentals, dropped["car_rental"])
+	ctx.Dining = keepRecords(ctx.Dining, dropped["dining"])
+	ctx.Tickets = keepRecords(ctx.Tickets, dropped["ticket"])
+
+	return ctx
+}
+
+// shortenContextText truncates the notes and descriptions of the context,
+// the full texts stay in its passages
+func shortenContextText(ctx *tripcontext.Context) {
+	ctx.Notes = truncateText(ctx.Notes, maxTripNotesChars)
+	for i := range ctx.Transportations {
+		ctx.Transportations[i].Notes = truncateText(ctx.Transportations[i].Notes, maxRecordTextChars)
+	}
+	for i := range ctx.Activities {
+		ctx.Activities[i].Description = truncateText(ctx.Activities[i].Description, maxRecordTextChars)
+	}
+	for i := range ctx.Expenses {
+		ctx.Expenses[i].Notes = truncateText(ctx.Expenses[i].Notes, maxRecordTextChars)
+	}
+	for i := range ctx.Destinations {
+		ctx.Destinations[i].Description = truncateText(ctx.Destinations[i].Description, maxRecordTextChars)
+	}
+}
+
+func keepRecords[T any](records []T, dropped map[int]bool) []T {
+	if len(dropped) == 0 {
+		return records
+	}
+	kept := make([]T, 0, len(records)-len(dropped))
+	for i, record := range records {
+		if !dropped[i] {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
+
+func distanceFromNow(value string, now time.Time) time.Duration {
+	parsed, err := time.Parse("2006-01-02T15:04:05", value)
+	if err != nil {
+		// undated records are the least useful ones to keep
+		return time.Duration(1<<63 - 1)
+	}
+	distance := parsed.Sub(now)
+	if distance < 0 {
+		distance = -distance
+	}
+	return distance
+}
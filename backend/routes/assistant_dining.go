@@ -0,0 +1,142 @@
+package routes
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	assistantToolCreateDining = "create_dining"
+	assistantToolUpdateDining = "update_dining"
+	assistantToolDeleteDining = "delete_dining"
+)
+
+func saveDiningProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
+	collection, err := app.FindCollectionByNameOrId("dining")
+	if err != nil {
+		return "", "", err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("trip", tripID)
+	setDiningFields(record, args)
+	applyCostUpdate(record, args)
+
+	if err := app.Save(record); err != nil {
+		return "", "", err
+	}
+
+	return record.Id, fmt.Sprintf("Added a reservation at \"%s\" on %s.", record.GetString("name"), stringValue(args["time"])), nil
+}
+
+func updateDiningProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
+	record, err := ensureTripRecord(app, "dining", stringValue(args["record_id"]), tripID)
+	if err != nil {
+		return "", "", err
+	}
+
+	setDiningFields(record, args)
+	applyCostUpdate(record, args)
+
+	if err := app.Save(record); err != nil {
+		return "", "", err
+	}
+
+	return record.Id, fmt.Sprintf("Updated the reservation at \"%s\".", record.GetString("name")), nil
+}
+
+func deleteDiningProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
+	record, err := ensureTripRecord(app, "dining", stringValue(args["record_id"]), tripID)
+	if err != nil {
+		return "", "", err
+	}
+
+	name := record.GetString("name")
+	if err := app.Delete(record); err != nil {
+		return "", "", err
+	}
+
+	return record.Id, fmt.Sprintf("Removed the reservation at \"%s\".", name), nil
+}
+
+// setDiningFields copies the arguments that were given, so updates only
+// change what the model sent
+func setDiningFields(record *core.Record, args map[string]interface{}) {
+	fields := map[string]string{
+		"name":         "name",
+		"time":         "reservationTime",
+		"confirmation": "confirmationCode",
+		"cuisine":      "cuisine",
+		"address":      "address",
+		"notes":        "notes",
+	}
+	for arg, field := range fields {
+		if value := stringValue(args[arg]); value != "" {
+			record.Set(field, value)
+		}
+	}
+	if size := int(floatValue(args["party_size"])); size > 0 {
+		record.Set("partySize", size)
+	}
+	setMetadataTimezone(record, "place", stringValue(args["timezone"]))
+}
+
+func assistantDiningTools() []map[string]interface{} {
+	diningProperties := func() map[string]interface{} {
+		return map[string]interface{}{
+			"name":          map[string]interface{}{"type": "string", "description": "Restaurant name"},
+			"time":          map[string]interface{}{"type": "string", "description": "Reservation time in RFC3339"},
+			"timezone":      map[string]interface{}{"type": "string", "description": "IANA timezone of the restaurant (e.g. Europe/Paris)"},
+			"party_size":    map[string]interface{}{"type": "integer", "description": "Number of people at the table"},
+			"cuisine":       map[string]interface{}{"type": "string", "description": "Cuisine, e.g. Japanese or seafood"},
+			"address":       map[string]interface{}{"type": "string", "description": "Address of the restaurant"},
+			"confirmation":  map[string]interface{}{"type": "string", "description": "Confirmation number or reservation code"},
+			"cost_value":    map[string]interface{}{"type": "number", "description": "Deposit or prepaid amount, if any"},
+			"cost_currency": map[string]interface{}{"type": "string", "description": "ISO currency code, e.g. EUR"},
+			"notes":         map[string]interface{}{"type": "string"},
+		}
+	}
+
+	updateProperties := diningProperties()
+	updateProperties["record_id"] = map[string]interface{}{"type": "string"}
+
+	return []map[string]interface{}{
+		{
+			"type":        "function",
+			"name":        assistantToolCreateDining,
+			"description": "Propose adding a restaurant reservation to this trip. Use it rather than create_activity for meals booked at a restaurant.",
+			"parameters": map[string]interface{}{
+				"type":                 "object",
+				"properties":           diningProperties(),
+				"required":             []string{"name", "time"},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"type":        "function",
+			"name":        assistantToolUpdateDining,
+			"description": "Update an existing restaurant reservation by record_id. Only include fields that change.",
+			"parameters": map[string]interface{}{
+				"type":                 "object",
+				"properties":           updateProperties,
+				"required":             []string{"record_id"},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"type":        "function",
+			"name":        assistantToolDeleteDining,
+			"description": "Delete an existing restaurant reservation by record_id.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"record_id": map[string]interface{}{"type": "string"},
+					"reason":    map[string]interface{}{"type": "string", "description": "Optional reason/reminder"},
+				},
+				"required":             []string{"record_id"},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
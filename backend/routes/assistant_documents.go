@@ -0,0 +1,164 @@
+package routes
+
+import (
+	"backend/tripcontext"
+	"encoding/json"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	assistantToolFindDocument = "find_document"
+
+	maxDocumentMatches = 3
+	// characters of text returned around the best match of a document
+	documentExcerptLength = 800
+)
+
+func assistantDocumentTools() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"type":        "function",
+			"name":        assistantToolFindDocument,
+			"description": "Search the uploaded documents of this trip (booking confirmations, tickets, boarding passes, host emails) for details that are not in the trip context, such as a door code, Wi-Fi password or check-in instructions. Returns the matching documents with the fields read from them and an excerpt of their text.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"query": map[string]interface{}{
+						"type":        "string",
+						"description": "What to look for, for example 'airbnb door code' or 'hotel wifi password'.",
+					},
+					"record_id": map[string]interface{}{
+						"type":        "string",
+						"description": "Only search documents attached to this record from the trip context.",
+					},
+				},
+				"required": []string{"query"},
+			},
+		},
+	}
+}
+
+// answerDocumentLookup runs a find_document call against the documents of
+// the trip context and returns the output for the model
+func answerDocumentLookup(documents []tripcontext.Document, argsJSON string) string {
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+		return `{"error":"the arguments are not valid JSON"}`
+	}
+
+	matches := findDocuments(documents, stringValue(args["query"]), stringValue(args["record_id"]))
+	result := map[string]interface{}{"documents": matches}
+	if len(matches) == 0 {
+		result["message"] = "No uploaded document matches. Say so rather than guessing the value."
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return `{"documents":[]}`
+	}
+	return string(data)
+}
+
+// findDocuments ranks the documents by how many words of the query appear
+// in their name, fields and text. Documents without readable text are only
+// found by name.
+func findDocuments(documents []tripcontext.Document, query string, recordID string) []map[string]interface{} {
+	words := documentQueryWords(query)
+
+	type scored struct {
+		document tripcontext.Document
+		score    int
+	}
+	ranked := make([]scored, 0, len(documents))
+	for _, document := range documents {
+		if recordID != "" && !slices.Contains(document.RecordIds, recordID) {
+			continue
+		}
+
+		fields := make([]string, 0, len(document.Fields))
+		for label, value := range document.Fields {
+			fields = append(fields, label+" "+value)
+		}
+		name := strings.ToLower(document.Name + " " + document.Type)
+		labelled := strings.ToLower(strings.Join(fields, " "))
+		text := strings.ToLower(document.Text)
+
+		score := 0
+		for _, word := range words {
+			switch {
+			case strings.Contains(labelled, word):
+				score += 3
+			case strings.Contains(name, word):
+				score += 2
+			case strings.Contains(text, word):
+				score++
+			}
+		}
+		// a lookup by record lists its documents even when nothing matches
+		if score > 0 || recordID != "" || len(words) == 0 {
+			ranked = append(ranked, scored{document: document, score: score})
+		}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score > ranked[j].score
+	})
+	if len(ranked) > maxDocumentMatches {
+		ranked = ranked[:maxDocumentMatches]
+	}
+
+	matches := make([]map[string]interface{}, 0, len(ranked))
+	for _, match := range ranked {
+		entry := map[string]interface{}{
+			"id":   match.document.Id,
+			"name": match.document.Name,
+			"type": match.document.Type,
+		}
+		if len(match.document.RecordIds) > 0 {
+			entry["recordIds"] = match.document.RecordIds
+		}
+		if len(match.document.Fields) > 0 {
+			entry["fields"] = match.document.Fields
+		}
+		if excerpt := documentExcerpt(match.document.Text, words); excerpt != "" {
+			entry["excerpt"] = excerpt
+		}
+		matches = append(matches, entry)
+	}
+	return matches
+}
+
+// documentExcerpt is the part of the text around the first word of the
+// query found in it, or its beginning
+func documentExcerpt(text string, words []string) string {
+	if len(text) <= documentExcerptLength {
+		return text
+	}
+
+	lower := strings.ToLower(text)
+	start := 0
+	for _, word := range words {
+		if at := strings.Index(lower, word); at >= 0 {
+			start = max(at-documentExcerptLength/4, 0)
+			break
+		}
+	}
+	end := min(start+documentExcerptLength, len(text))
+	return strings.ToValidUTF8(text[start:end], "")
+}
+
+// documentQueryWords splits the query into lower case words, leaving out
+// the ones too short to tell documents apart
+func documentQueryWords(query string) []string {
+	words := make([]string, 0)
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) > 2 && !slices.Contains(words, word) {
+			words = append(words, word)
+		}
+	}
+	return words
+}
@@ -0,0 +1,125 @@
+package routes
+
+import (
+	"backend/proposals"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+var errProposalDryRun = errors.New("proposal dry run")
+
+// collection changed by each tool, used to load the would-be records
+var proposalCollections = map[string]string{
+	assistantToolCreateActivity:       "activities",
+	assistantToolUpdateActivity:       "activities",
+	assistantToolDeleteActivity:       "activities",
+	assistantToolSwapActivities:       "activities",
+	assistantToolCreateLodging:        "lodgings",
+	assistantToolUpdateLodging:        "lodgings",
+	assistantToolDeleteLodging:        "lodgings",
+	assistantToolCreateTransportation: "transportations",
+	assistantToolUpdateTransportation: "transportations",
+	assistantToolDeleteTransportation: "transportations",
+	assistantToolCreateCarRental:      "car_rentals",
+	assistantToolUpdateCarRental:      "car_rentals",
+	assistantToolDeleteCarRental:      "car_rentals",
+	assistantToolCreateDining:         "dining",
+	assistantToolUpdateDining:         "dining",
+	assistantToolDeleteDining:         "dining",
+	assistantToolCreateExpense:        "trip_expenses",
+	assistantToolUpdateExpense:        "trip_expenses",
+	assistantToolDeleteExpense:        "trip_expenses",
+	assistantToolCreatePoll:           "polls",
+}
+
+var proposalDeletes = map[string]bool{
+	assistantToolDeleteActivity:       true,
+	assistantToolDeleteLodging:        true,
+	assistantToolDeleteTransportation: true,
+	assistantToolDeleteCarRental:      true,
+	assistantToolDeleteDining:         true,
+	assistantToolDeleteExpense:        true,
+}
+
+// previewAssistantProposal applies the proposal inside a transaction that is
+// always rolled back, so the records go through the same validation and
+// normalization as a real approval without being saved. The stored proposal
+// is left untouched.
+func previewAssistantProposal(app core.App, trip *core.Record, proposal *proposals.Proposal) (string, []map[string]any, error) {
+	preview, err := cloneProposal(proposal)
+	if err != nil {
+		return "", nil, err
+	}
+
+	collection := proposalCollections[preview.Tool]
+	deleting := proposalDeletes[preview.Tool]
+
+	var message string
+	records := make([]map[string]any, 0)
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		var deleted *core.Record
+		if deleting {
+			deleted, _ = ensureTripRecord(txApp, collection, stringValue(preview.Arguments["record_id"]), trip.Id)
+		}
+
+		recordID, applied, err := applyAssistantProposal(txApp, trip, preview)
+		if err != nil {
+			return err
+		}
+		message = applied
+
+		ids := []string{recordID}
+		if preview.Tool == assistantToolSwapActivities {
+			ids = append(ids, stringValue(preview.Arguments["second_record_id"]))
+		}
+
+		for _, id := range ids {
+			record := deleted
+			if !deleting {
+				record, _ = txApp.FindRecordById(collection, id)
+			}
+			if record != nil {
+				records = append(records, record.PublicExport())
+			}
+		}
+
+		return errProposalDryRun
+	})
+	if err != nil && !errors.Is(err, errProposalDryRun) {
+		return "", nil, err
+	}
+
+	return message, records, nil
+}
+
+func cloneProposal(proposal *proposals.Proposal) (*proposals.Proposal, error) {
+	data, err := json.Marshal(proposal.Arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := *proposal
+	preview.Arguments = map[string]interface{}{}
+	if err := json.Unmarshal(data, &preview.Arguments); err != nil {
+		return nil, err
+	}
+	return &preview, nil
+}
+
+func proposalPreviewResponse(e *core.RequestEvent, trip *core.Record, proposal *proposals.Proposal) error {
+	message, records, err := previewAssistantProposal(e.App, trip, proposal)
+	if err != nil {
+		return proposalErrorResponse(e, err)
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"status":  "preview",
+		"message": message,
+		"deleted": proposalDeletes[proposal.Tool],
+		"records": records,
+	})
+}
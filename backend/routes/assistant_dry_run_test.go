@@ -0,0 +1,106 @@
+package routes
+
+import (
+	"backend/hooks"
+	_ "backend/migrations"
+	"backend/proposals"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+func newDryRunTestApp(t *testing.T) *tests.TestApp {
+	t.Setenv("SURMAI_ADMIN_EMAIL", "admin@example.com")
+	t.Setenv("SURMAI_ADMIN_PASSWORD", "admin-password-123")
+
+	app, err := tests.NewTestApp(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(app.Cleanup)
+	if err := app.RunAllMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	app.OnRecordAfterCreateSuccess("polls").BindFunc(hooks.NotifyPollCreated)
+	return app
+}
+
+func newDryRunTestUser(t *testing.T, app core.App, email string) *core.Record {
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := core.NewRecord(users)
+	user.Set("email", email)
+	user.Set("password", "user-password-123")
+	user.Set("name", email)
+	user.Set("notificationChannel", "email")
+	if err := app.Save(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestPollProposalDryRunNotifiesNobody(t *testing.T) {
+	app := newDryRunTestApp(t)
+	owner := newDryRunTestUser(t, app, "owner@example.com")
+	collaborator := newDryRunTestUser(t, app, "friend@example.com")
+
+	collection, err := app.FindCollectionByNameOrId("trips")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trip := core.NewRecord(collection)
+	trip.Set("name", "Lisbon")
+	trip.Set("ownerId", owner.Id)
+	trip.Set("collaborators", []string{collaborator.Id})
+	trip.Set("startDate", time.Now().UTC().AddDate(0, 0, 10))
+	trip.Set("endDate", time.Now().UTC().AddDate(0, 0, 14))
+	if err := app.Save(trip); err != nil {
+		t.Fatal(err)
+	}
+
+	arguments := map[string]interface{}{
+		"question": "Where do we eat on the last night?",
+		"options": []interface{}{
+			map[string]interface{}{"name": "Cervejaria Ramiro"},
+			map[string]interface{}{"name": "Taberna da Rua das Flores"},
+		},
+	}
+	proposal := &proposals.Proposal{
+		ID:        "dry-run-poll",
+		TripID:    trip.Id,
+		Tool:      assistantToolCreatePoll,
+		Arguments: arguments,
+	}
+
+	_, records, err := previewAssistantProposal(app, trip, proposal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected the previewed poll, got %d records", len(records))
+	}
+
+	if polls, _ := app.CountRecords("polls"); polls != 0 {
+		t.Fatalf("expected the preview to be rolled back, found %d polls", polls)
+	}
+	if sent, _ := app.CountRecords("notifications"); sent != 0 {
+		t.Fatalf("expected no notifications for a dry run, found %d", sent)
+	}
+	if app.TestMailer.TotalSend() != 0 {
+		t.Fatalf("expected no emails for a dry run, %d were sent", app.TestMailer.TotalSend())
+	}
+
+	if _, _, err := savePollProposal(app, trip, arguments); err != nil {
+		t.Fatal(err)
+	}
+	if sent, _ := app.CountRecords("notifications"); sent != 2 {
+		t.Fatalf("expected both members to be asked to vote, found %d notifications", sent)
+	}
+	if app.TestMailer.TotalSend() != 2 {
+		t.Fatalf("expected both members to be emailed, %d emails were sent", app.TestMailer.TotalSend())
+	}
+}
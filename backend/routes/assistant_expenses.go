@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	assistantToolCreateExpense = "create_expense"
+	assistantToolUpdateExpense = "update_expense"
+	assistantToolDeleteExpense = "delete_expense"
+)
+
+func saveExpenseProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
+	collection, err := app.FindCollectionByNameOrId("trip_expenses")
+	if err != nil {
+		return "", "", err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("trip", tripID)
+	record.Set("name", stringValue(args["name"]))
+	record.Set("category", stringValue(args["category"]))
+	record.Set("notes", stringValue(args["notes"]))
+	if occurredOn := stringValue(args["occurred_on"]); occurredOn != "" {
+		record.Set("occurredOn", occurredOn)
+	}
+	applyCostUpdate(record, args)
+
+	if err := app.Save(record); err != nil {
+		return "", "", err
+	}
+
+	if amount := proposalAmount(args); amount != "" {
+		return record.Id, fmt.Sprintf("Recorded expense \"%s\" of %s.", record.GetString("name"), amount), nil
+	}
+	return record.Id, fmt.Sprintf("Recorded expense \"%s\".", record.GetString("name")), nil
+}
+
+func updateExpenseProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
+	record, err := ensureTripRecord(app, "trip_expenses", stringValue(args["record_id"]), tripID)
+	if err != nil {
+		return "", "", err
+	}
+
+	if name := stringValue(args["name"]); name != "" {
+		record.Set("name", name)
+	}
+	if category := stringValue(args["category"]); category != "" {
+		record.Set("category", category)
+	}
+	if note := stringValue(args["notes"]); note != "" {
+		record.Set("notes", note)
+	}
+	if occurredOn := stringValue(args["occurred_on"]); occurredOn != "" {
+		record.Set("occurredOn", occurredOn)
+	}
+	applyCostUpdate(record, args)
+
+	if err := app.Save(record); err != nil {
+		return "", "", err
+	}
+
+	return record.Id, fmt.Sprintf("Updated expense \"%s\".", record.GetString("name")), nil
+}
+
+func deleteExpenseProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
+	record, err := ensureTripRecord(app, "trip_expenses", stringValue(args["record_id"]), tripID)
+	if err != nil {
+		return "", "", err
+	}
+
+	name := record.GetString("name")
+	if err := app.Delete(record); err != nil {
+		return "", "", err
+	}
+
+	return record.Id, fmt.Sprintf("Removed expense \"%s\".", name), nil
+}
+
+func assistantExpenseTools() []map[string]interface{} {
+	expenseProperties := func() map[string]interface{} {
+		return map[string]interface{}{
+			"name":          map[string]interface{}{"type": "string", "description": "What the money was spent on, e.g. Dinner at Chez Paul"},
+			"category":      map[string]interface{}{"type": "string", "description": "Optional category such as food, transport, lodging, activities or shopping"},
+			"occurred_on":   map[string]interface{}{"type": "string", "description": "Local date/time of the expense in ISO-8601, defaults to unset"},
+			"cost_value":    map[string]interface{}{"type": "number"},
+			"cost_currency": map[string]interface{}{"type": "string", "description": "ISO currency code, e.g. EUR"},
+			"notes":         map[string]interface{}{"type": "string"},
+		}
+	}
+
+	updateProperties := expenseProperties()
+	updateProperties["record_id"] = map[string]interface{}{"type": "string"}
+
+	return []map[string]interface{}{
+		{
+			"type":        "function",
+			"name":        assistantToolCreateExpense,
+			"description": "Record money the traveler spent on the trip, e.g. \"I spent 45 EUR on dinner\".",
+			"parameters": map[string]interface{}{
+				"type":                 "object",
+				"properties":           expenseProperties(),
+				"required":             []string{"name", "cost_value", "cost_currency"},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"type":        "function",
+			"name":        assistantToolUpdateExpense,
+			"description": "Update an existing expense by record_id. Only include fields that change.",
+			"parameters": map[string]interface{}{
+				"type":                 "object",
+				"properties":           updateProperties,
+				"required":             []string{"record_id"},
+				"additionalProperties": false,
+			},
+		},
+		{
+			"type":        "function",
+			"name":        assistantToolDeleteExpense,
+			"description": "Delete an existing expense by record_id when the traveler asks to remove it.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"record_id": map[string]interface{}{"type": "string"},
+					"reason":    map[string]interface{}{"type": "string", "description": "Optional reason/reminder"},
+				},
+				"required":             []string{"record_id"},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
@@ -0,0 +1,95 @@
+package routes
+
+import (
+	"backend/proposals"
+	"backend/trips"
+	bt "backend/types"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// staleProposalError is returned for a proposal that would change a record
+// someone edited after the assistant read the trip
+type staleProposalError struct {
+	Collection string
+	RecordId   string
+	Updated    time.Time
+	// Conflict sets the changes made since the context against the ones
+	// the proposal makes
+	Conflict *bt.RecordConflict
+}
+
+func (e *staleProposalError) Error() string {
+	return fmt.Sprintf("%s %s was changed at %s, after the assistant read the trip", e.Collection, e.RecordId, e.Updated.Format(time.RFC3339))
+}
+
+// checkProposalFreshness refuses updates and deletes of records changed after
+// the context the proposal was made from, so approving it cannot overwrite a
+// collaborator's edit the assistant never saw. The context time has whole
+// seconds, edits within the same second are let through. Missing records
+// are left for the proposal itself to report. The error carries the merged
+// diff of the stale record, redacted for the role.
+func checkProposalFreshness(app core.App, trip *core.Record, proposal *proposals.Proposal, role string) error {
+	if proposal.ContextAt.IsZero() {
+		return nil
+	}
+
+	collection, ok := proposalCollections[proposal.Tool]
+	if !ok {
+		return nil
+	}
+
+	for _, id := range proposalTargetIds(proposal) {
+		record, err := ensureTripRecord(app, collection, id, trip.Id)
+		if err != nil {
+			continue
+		}
+		updated := record.GetDateTime("updated").Time()
+		if updated.Truncate(time.Second).After(proposal.ContextAt) {
+			// versions have milliseconds, the context only whole seconds
+			since := proposal.ContextAt.Add(time.Second - time.Millisecond)
+			conflict := trips.RecordConflict(app, record, proposedRecord(app, trip, proposal, collection, record.Id), since, role)
+			return &staleProposalError{Collection: collection, RecordId: record.Id, Updated: updated, Conflict: conflict}
+		}
+	}
+	return nil
+}
+
+// proposedRecord is the record as approving the proposal would leave it,
+// applied in a transaction that is always rolled back like a dry run. It is
+// nil for deletes and proposals that cannot be applied.
+func proposedRecord(app core.App, trip *core.Record, proposal *proposals.Proposal, collection string, id string) *core.Record {
+	if proposalDeletes[proposal.Tool] {
+		return nil
+	}
+	preview, err := cloneProposal(proposal)
+	if err != nil {
+		return nil
+	}
+
+	var proposed *core.Record
+	_ = app.RunInTransaction(func(txApp core.App) error {
+		if _, _, err := applyAssistantProposal(txApp, trip, preview); err != nil {
+			return err
+		}
+		proposed, _ = txApp.FindRecordById(collection, id)
+		return errProposalDryRun
+	})
+	return proposed
+}
+
+// proposalTargetIds returns the existing records a proposal changes, none for
+// the ones that create a record
+func proposalTargetIds(proposal *proposals.Proposal) []string {
+	switch {
+	case proposal.Tool == assistantToolSwapActivities:
+		return []string{stringValue(proposal.Arguments["first_record_id"]), stringValue(proposal.Arguments["second_record_id"])}
+	case slices.Contains(proposalRequiredArgs[proposal.Tool], "record_id"):
+		return []string{stringValue(proposal.Arguments["record_id"])}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,137 @@
+package routes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	maxAssistantImages     = 4
+	maxAssistantImageBytes = 5 << 20
+)
+
+var assistantImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/webp": true,
+	"image/gif":  true,
+}
+
+// decodeAssistantRequest reads the assistant request either as JSON, where
+// images are data URLs on the messages, or as multipart form data with the
+// JSON in the "payload" field and the images as "images" files. Uploaded
+// files are attached to the last user message.
+func decodeAssistantRequest(e *core.RequestEvent) (tripAssistantRequest, error) {
+	var req tripAssistantRequest
+
+	if !strings.HasPrefix(e.Request.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+			return req, fmt.Errorf("invalid request body")
+		}
+		return req, validateAssistantImages(req.Messages)
+	}
+
+	if err := e.Request.ParseMultipartForm(maxAssistantImages * maxAssistantImageBytes); err != nil {
+		return req, fmt.Errorf("invalid multipart body")
+	}
+	if err := json.Unmarshal([]byte(e.Request.FormValue("payload")), &req); err != nil {
+		return req, fmt.Errorf("invalid request body")
+	}
+
+	last := -1
+	for i := range req.Messages {
+		if req.Messages[i].Role == "user" {
+			last = i
+		}
+	}
+
+	files := e.Request.MultipartForm.File["images"]
+	if len(files) > 0 && last < 0 {
+		return req, fmt.Errorf("images need a user message")
+	}
+
+	for _, header := range files {
+		if header.Size > maxAssistantImageBytes {
+			return req, fmt.Errorf("%s is larger than 5MB", header.Filename)
+		}
+		file, err := header.Open()
+		if err != nil {
+			return req, fmt.Errorf("unable to read %s", header.Filename)
+		}
+		data, err := io.ReadAll(file)
+		_ = file.Close()
+		if err != nil {
+			return req, fmt.Errorf("unable to read %s", header.Filename)
+		}
+
+		mimeType := http.DetectContentType(data)
+		req.Messages[last].Images = append(req.Messages[last].Images,
+			fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data)))
+	}
+
+	return req, validateAssistantImages(req.Messages)
+}
+
+// validateAssistantImages checks that images are data URLs of a supported
+// type and size, and that only user messages carry them
+func validateAssistantImages(messages []assistantMessage) error {
+	count := 0
+	for _, message := range messages {
+		if len(message.Images) > 0 && message.Role != "user" {
+			return fmt.Errorf("only user messages can include images")
+		}
+		for _, image := range message.Images {
+			count++
+			if count > maxAssistantImages {
+				return fmt.Errorf("at most %d images can be attached", maxAssistantImages)
+			}
+
+			header, data, found := strings.Cut(image, ",")
+			mimeType := strings.TrimSuffix(strings.TrimPrefix(header, "data:"), ";base64")
+			if !found || !strings.HasPrefix(header, "data:") || !assistantImageTypes[mimeType] {
+				return fmt.Errorf("images must be PNG, JPEG, WebP or GIF data URLs")
+			}
+			if base64.StdEncoding.DecodedLen(len(data)) > maxAssistantImageBytes {
+				return fmt.Errorf("images must be smaller than 5MB")
+			}
+		}
+	}
+	return nil
+}
+
+func hasAssistantImages(messages []assistantMessage) bool {
+	for _, message := range messages {
+		if len(message.Images) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// newResponsesImageBlock is a user message with its text and images
+func newResponsesImageBlock(message assistantMessage) map[string]interface{} {
+	content := make([]map[string]string, 0, len(message.Images)+1)
+	if message.Content != "" {
+		content = append(content, map[string]string{
+			"type": "input_text",
+			"text": message.Content,
+		})
+	}
+	for _, image := range message.Images {
+		content = append(content, map[string]string{
+			"type":      "input_image",
+			"image_url": image,
+		})
+	}
+
+	return map[string]interface{}{
+		"role":    message.Role,
+		"content": content,
+	}
+}
@@ -0,0 +1,112 @@
+package routes
+
+import (
+	"backend/tripcontext"
+	"backend/trips"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// rounds of local tool calls answered before the model has to reply
+const maxLocalToolRounds = 3
+
+// localTools answers the function calls the server runs itself instead of
+// turning them into proposals: find_document, search_trip_notes,
+// rank_suggestions, get_trip_risks, get_daily_spend, search_places,
+// search_lodging and get_travel_history
+type localTools struct {
+	app       core.App
+	trip      *core.Record
+	userId    string
+	role      string
+	ctx       *tripcontext.Context
+	documents []tripcontext.Document
+	ranking   *suggestionRanking
+	language  string
+}
+
+// localToolCall is a local tool call answered by the server, it is sent back
+// to the model as the output of the call
+type localToolCall struct {
+	CallID string
+	Output string
+}
+
+func newLocalTools(app core.App, trip *core.Record, user *core.Record, ctx *tripcontext.Context, config assistantConfig) *localTools {
+	role, userId := "", ""
+	if user != nil {
+		role, userId = trips.TripRole(trip, user.Id), user.Id
+	}
+	return &localTools{
+		app:       app,
+		trip:      trip,
+		userId:    userId,
+		role:      role,
+		ctx:       ctx,
+		documents: ctx.Documents,
+		ranking:   newSuggestionRanking(app, trip, user, ctx, config.SuggestionRanker),
+		language:  loadAssistantLocale(user).Tag,
+	}
+}
+
+func isLocalTool(name string) bool {
+	return name == assistantToolFindDocument || name == assistantToolSearchTripNotes || name == assistantToolRankSuggestions || name == assistantToolGetTripRisks ||
+		name == assistantToolGetDailySpend || name == assistantToolSearchPlaces || name == assistantToolSearchLodging ||
+		name == assistantToolGetTravelHistory
+}
+
+// answer runs a local tool call, requests without local tools get an empty
+// document list, no snippets, the suggestions in the order they came, no
+// risks, no spend, no places, no hotels and no travel history
+func (t *localTools) answer(name string, argsJSON string) string {
+	if t == nil {
+		t = &localTools{}
+	}
+	switch name {
+	case assistantToolSearchTripNotes:
+		return answerNotesSearch(t.app, t.ctx, argsJSON)
+	case assistantToolRankSuggestions:
+		return answerRankSuggestions(t.ranking, argsJSON)
+	case assistantToolGetTripRisks:
+		return answerTripRisks(t.app, t.ctx)
+	case assistantToolGetDailySpend:
+		return answerDailySpend(t.app, t.trip, t.role, argsJSON)
+	case assistantToolSearchPlaces:
+		return answerSearchPlaces(t.ctx, t.language, argsJSON)
+	case assistantToolSearchLodging:
+		return answerSearchLodging(t.ctx, t.language, argsJSON)
+	case assistantToolGetTravelHistory:
+		return answerTravelHistory(t.app, t.userId, argsJSON)
+	}
+	return answerDocumentLookup(t.documents, argsJSON)
+}
+
+// functionCallOutput is the input item that answers a function call
+func functionCallOutput(callID string, output string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":    "function_call_output",
+		"call_id": callID,
+		"output":  output,
+	}
+}
+
+// finalizeLocalCall answers the buffered call when it is a local tool call
+func (b *functionCallBuffer) finalizeLocalCall(event map[string]interface{}, tools *localTools) (localToolCall, bool) {
+	if !b.active || !isLocalTool(b.name) {
+		return localToolCall{}, false
+	}
+	itemID := stringValue(event["item_id"])
+	if itemID != "" && itemID != b.itemID {
+		return localToolCall{}, false
+	}
+
+	argsJSON := stringValue(event["arguments"])
+	if argsJSON == "" {
+		argsJSON = b.builder.String()
+	}
+	call := localToolCall{CallID: b.callID, Output: tools.answer(b.name, argsJSON)}
+	b.active = false
+	b.builder.Reset()
+	b.itemID = ""
+	return call, true
+}
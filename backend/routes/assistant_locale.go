@@ -0,0 +1,152 @@
+package routes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const defaultAssistantLocale = "en-US"
+
+// regions and languages that usually write times with AM/PM
+var twelveHourLocales = []string{
+	"en-US", "en-CA", "en-AU", "en-NZ", "en-IN", "en-PH", "hi", "ar", "bn", "ko", "ur",
+}
+
+// languages that write dates year first, e.g. 2026-10-17
+var yearFirstLocales = []string{"zh", "ja", "ko", "hu", "lt", "sv", "mn"}
+
+// assistantLocale decides how the assistant and the server write dates and
+// times for a user
+type assistantLocale struct {
+	Tag    string
+	Hour12 bool
+	// DateOrder is "mdy", "dmy" or "ymd"
+	DateOrder string
+	// Location is the user's home timezone, used to tell what "today" is
+	Location *time.Location
+}
+
+// loadAssistantLocale reads the locale and timeFormat preferences of the user,
+// falling back to en-US with a 12-hour clock
+func loadAssistantLocale(user *core.Record) assistantLocale {
+	tag := defaultAssistantLocale
+	timeFormat := ""
+	location := time.UTC
+	if user != nil {
+		if value := strings.TrimSpace(user.GetString("locale")); value != "" {
+			tag = strings.ReplaceAll(value, "_", "-")
+		}
+		timeFormat = user.GetString("timeFormat")
+		if loc, err := time.LoadLocation(user.GetString("timezone")); err == nil {
+			location = loc
+		}
+	}
+
+	locale := assistantLocale{
+		Tag:       tag,
+		Hour12:    matchesLocale(tag, twelveHourLocales),
+		DateOrder: "dmy",
+		Location:  location,
+	}
+	switch timeFormat {
+	case "12h":
+		locale.Hour12 = true
+	case "24h":
+		locale.Hour12 = false
+	}
+
+	switch {
+	case strings.EqualFold(tag, "en-US") || strings.EqualFold(tag, "en"):
+		locale.DateOrder = "mdy"
+	case matchesLocale(tag, yearFirstLocales):
+		locale.DateOrder = "ymd"
+	}
+
+	return locale
+}
+
+// matchesLocale accepts both exact tags and bare languages from the list
+func matchesLocale(tag string, locales []string) bool {
+	language := strings.SplitN(tag, "-", 2)[0]
+	for _, candidate := range locales {
+		if strings.EqualFold(candidate, tag) || strings.EqualFold(candidate, language) {
+			return true
+		}
+	}
+	return false
+}
+
+// now is the current wall clock time of the user
+func (l assistantLocale) now() time.Time {
+	location := l.Location
+	if location == nil {
+		location = time.UTC
+	}
+	local := time.Now().In(location)
+	return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), 0, 0, time.UTC)
+}
+
+func (l assistantLocale) dayFirst() bool {
+	return l.DateOrder != "mdy"
+}
+
+func (l assistantLocale) key() string {
+	return fmt.Sprintf("%s/%t/%s", l.Tag, l.Hour12, l.DateOrder)
+}
+
+// promptInstructions replaces the fixed formatting rules of the system prompt
+func (l assistantLocale) promptInstructions() string {
+	clock := "Use the 24-hour clock for times, e.g. 15:30."
+	if l.Hour12 {
+		clock = "Use the 12-hour clock with AM/PM for times, e.g. 3:30 PM."
+	}
+
+	date := "For dates use the day/month format, e.g. 17/10, and do not include the year."
+	switch l.DateOrder {
+	case "mdy":
+		date = "For dates use the format MM-DD, e.g. 10-17, and do not include the year."
+	case "ymd":
+		date = "For dates use the month/day format, e.g. 10/17, and do not include the year."
+	}
+
+	return fmt.Sprintf("The traveler's locale is %s; format numbers and amounts the way it expects. %s %s "+
+		"This applies to any times you see, edit, or add in the trip context or new entries.", l.Tag, clock, date)
+}
+
+// formatDateTime rewrites an ISO-8601 local time from a tool call for the
+// user, leaving anything it cannot parse untouched
+func (l assistantLocale) formatDateTime(value string) string {
+	value = strings.TrimSpace(value)
+	var parsed time.Time
+	var err error
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if parsed, err = time.Parse(layout, value); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return value
+	}
+
+	var date string
+	switch l.DateOrder {
+	case "mdy":
+		date = parsed.Format("Jan 2")
+	case "ymd":
+		date = parsed.Format("2006-01-02")
+	default:
+		date = parsed.Format("2 Jan")
+	}
+	if len(value) == len("2006-01-02") {
+		return date
+	}
+
+	clock := parsed.Format("15:04")
+	if l.Hour12 {
+		clock = parsed.Format("3:04 PM")
+	}
+	return date + " " + clock
+}
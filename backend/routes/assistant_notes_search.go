@@ -0,0 +1,110 @@
+package routes
+
+import (
+	"backend/embeddings"
+	"backend/embeddings/openai"
+	"backend/tripcontext"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	assistantToolSearchTripNotes = "search_trip_notes"
+
+	defaultNotesMatches = 5
+	maxNotesMatches     = 10
+	// bounds the embedding of new snippets and of the question
+	notesSearchTimeout = 60 * time.Second
+)
+
+// embeddingsProvider reads SURMAI_EMBEDDINGS_PROVIDER: openai, the default
+// when OPENAI_API_KEY is set, local for a server next to the instance that
+// speaks the OpenAI embeddings API at SURMAI_EMBEDDINGS_URL, or none.
+// SURMAI_EMBEDDINGS_MODEL picks the model. Without a provider the notes are
+// searched by their words.
+func embeddingsProvider() embeddings.DataProvider {
+	model := strings.TrimSpace(os.Getenv("SURMAI_EMBEDDINGS_MODEL"))
+	apiKey := strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("SURMAI_EMBEDDINGS_PROVIDER"))) {
+	case "none":
+		return nil
+	case "local":
+		url := strings.TrimSpace(os.Getenv("SURMAI_EMBEDDINGS_URL"))
+		if url == "" || model == "" {
+			return nil
+		}
+		return openai.OpenAI{URL: url, ModelName: model, APIKey: strings.TrimSpace(os.Getenv("SURMAI_EMBEDDINGS_API_KEY"))}
+	default:
+		if apiKey == "" {
+			return nil
+		}
+		return openai.OpenAI{URL: strings.TrimSpace(os.Getenv("SURMAI_EMBEDDINGS_URL")), ModelName: model, APIKey: apiKey}
+	}
+}
+
+func assistantNotesSearchTools() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"type":        "function",
+			"name":        assistantToolSearchTripNotes,
+			"description": "Search the notes of the trip, the notes of its bookings, the descriptions of its activities and the text of its uploaded documents by meaning. The context only holds the start of long texts, call this for anything that may be written further in them, such as what to pack, a meeting point or the tips saved for a place. Returns the best matching snippets with the record they come from.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"query": map[string]interface{}{
+						"type":        "string",
+						"description": "What to look for, as a question or a few words, for example 'where do we meet the guide' or 'rainy day ideas'.",
+					},
+					"limit": map[string]interface{}{
+						"type":        "integer",
+						"description": "How many snippets to return, 5 when left out, at most 10.",
+					},
+				},
+				"required": []string{"query"},
+			},
+		},
+	}
+}
+
+// answerNotesSearch runs a search_trip_notes call against the passages of
+// the trip context and returns the output for the model
+func answerNotesSearch(app core.App, ctx *tripcontext.Context, argsJSON string) string {
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+		return `{"error":"the arguments are not valid JSON"}`
+	}
+	if app == nil || ctx == nil {
+		return `{"snippets":[]}`
+	}
+
+	limit := defaultNotesMatches
+	if value := int(floatValue(args["limit"])); value > 0 {
+		limit = min(value, maxNotesMatches)
+	}
+
+	searchCtx, cancel := context.WithTimeout(context.Background(), notesSearchTimeout)
+	defer cancel()
+	snippets, err := tripcontext.SearchPassages(searchCtx, app, embeddingsProvider(), ctx.Trip.Id, ctx.Passages, stringValue(args["query"]), limit)
+	if err != nil {
+		app.Logger().Warn("Could not search the trip notes by meaning", "error", err, "tripId", ctx.Trip.Id)
+		// the words still find what the question names
+		if snippets, err = tripcontext.SearchPassages(searchCtx, app, nil, ctx.Trip.Id, ctx.Passages, stringValue(args["query"]), limit); err != nil {
+			return `{"snippets":[]}`
+		}
+	}
+
+	result := map[string]interface{}{"snippets": snippets}
+	if len(snippets) == 0 {
+		result["message"] = "Nothing in the notes, descriptions or documents matches. Say so rather than guessing."
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return `{"snippets":[]}`
+	}
+	return string(data)
+}
@@ -0,0 +1,290 @@
+package routes
+
+import (
+	"backend/tripcontext"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxHeldOutput bounds the text a stream keeps back while waiting for the
+// end of a link, tag or time, so a stray bracket cannot stall the reply
+const maxHeldOutput = 1024
+
+var (
+	// citation markers and control tokens some models leave in their text
+	providerArtifactPattern = regexp.MustCompile(`[ \t]*(?:【[^】]*†[^】]*】|\x{e200}[^\x{e201}]*\x{e201})|<\|[a-z_]+\|>`)
+	trackingParamPattern    = regexp.MustCompile(`[?&]utm_source=openai(&|\b)`)
+	scriptBlockPattern      = regexp.MustCompile(`(?is)<(script|style|iframe)\b.*?</(script|style|iframe)\s*>`)
+	htmlCommentPattern      = regexp.MustCompile(`(?s)<!--.*?-->`)
+	lineBreakTagPattern     = regexp.MustCompile(`(?i)<br\s*/?>`)
+	htmlTagPattern          = regexp.MustCompile(`</?[a-zA-Z][^<>]*>`)
+	unsafeLinkPattern       = regexp.MustCompile(`!?\[([^\]]*)\]\(\s*(?i:javascript|vbscript|data|file):[^()]*(?:\([^()]*\)[^()]*)*\)`)
+	linkOrUrlPattern        = regexp.MustCompile(`\[[^\]]*\]\([^)]*\)|https?://[^\s)]+`)
+	isoTimePattern          = regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}(?:[T ]\d{2}:\d{2}(?::\d{2})?(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2})?)?\b`)
+	recordIdPattern         = regexp.MustCompile(`\b[a-z0-9]{15}\b`)
+	trailingDatePattern     = regexp.MustCompile(`\d{4}-\d{2}-\d{2}$`)
+)
+
+// linkedRecord is a record of the trip context the reply may mention by id
+type linkedRecord struct {
+	collection string
+	label      string
+}
+
+// replyPostProcessor cleans up assistant replies before they reach the
+// traveler: model artifacts and tracking parameters are removed, HTML and
+// links with unsafe schemes are dropped, record ids from the trip context
+// become links to the record and ISO times are written the way the user
+// reads them. Code blocks are left alone apart from the artifacts. The
+// same processor serves the streamed and the complete replies.
+type replyPostProcessor struct {
+	tripID  string
+	locale  assistantLocale
+	records map[string]linkedRecord
+
+	// streaming state, see Write
+	held    strings.Builder
+	inFence bool
+}
+
+func newReplyPostProcessor(tripID string, ctx *tripcontext.Context, locale assistantLocale) *replyPostProcessor {
+	p := &replyPostProcessor{tripID: tripID, locale: locale, records: map[string]linkedRecord{}}
+	if ctx == nil {
+		return p
+	}
+
+	for _, t := range ctx.Transportations {
+		p.records[t.Id] = linkedRecord{"transportations", fmt.Sprintf("%s from %s to %s", t.Type, t.Origin, t.Destination)}
+	}
+	for _, l := range ctx.Lodgings {
+		p.records[l.Id] = linkedRecord{"lodgings", l.Name}
+	}
+	for _, a := range ctx.Activities {
+		p.records[a.Id] = linkedRecord{"activities", a.Name}
+	}
+	for _, c := range ctx.CarRentals {
+		p.records[c.Id] = linkedRecord{"car_rentals", strings.TrimSpace(c.Provider + " car rental")}
+	}
+	for _, d := range ctx.Dining {
+		p.records[d.Id] = linkedRecord{"dining", d.Name}
+	}
+	for _, x := range ctx.Expenses {
+		p.records[x.Id] = linkedRecord{"expenses", x.Name}
+	}
+	return p
+}
+
+// Process cleans a complete reply
+func (p *replyPostProcessor) Process(text string) string {
+	inFence := false
+	return p.process(text, &inFence)
+}
+
+// Write takes the next delta of a streamed reply and returns the part that
+// can be sent. Text that could still turn into a link, tag, code span or
+// time is held until a later delta completes it or Flush is called.
+func (p *replyPostProcessor) Write(delta string) string {
+	p.held.WriteString(delta)
+	pending := p.held.String()
+
+	cut := len(pending)
+	if len(pending) <= maxHeldOutput {
+		cut = safeOutputCut(pending)
+	}
+	if cut == 0 {
+		return ""
+	}
+
+	p.held.Reset()
+	p.held.WriteString(pending[cut:])
+	return p.process(pending[:cut], &p.inFence)
+}
+
+// Flush returns whatever the stream still holds
+func (p *replyPostProcessor) Flush() string {
+	pending := p.held.String()
+	p.held.Reset()
+	return p.process(pending, &p.inFence)
+}
+
+// process cleans text made of whole lines or words. Fenced code blocks may
+// span several calls, inFence carries the state between them.
+func (p *replyPostProcessor) process(text string, inFence *bool) string {
+	text = providerArtifactPattern.ReplaceAllString(text, "")
+
+	parts := strings.Split(text, "```")
+	for i := range parts {
+		if i > 0 {
+			*inFence = !*inFence
+		}
+		if !*inFence {
+			parts[i] = p.processProse(parts[i])
+		}
+	}
+	return strings.Join(parts, "```")
+}
+
+// processProse cleans text outside of code blocks, inline code spans keep
+// their content
+func (p *replyPostProcessor) processProse(text string) string {
+	spans := strings.Split(text, "`")
+	for i := 0; i < len(spans); i += 2 {
+		span := trackingParamPattern.ReplaceAllStringFunc(spans[i], func(match string) string {
+			if strings.HasSuffix(match, "&") {
+				return match[:1]
+			}
+			return ""
+		})
+		span = scriptBlockPattern.ReplaceAllString(span, "")
+		span = htmlCommentPattern.ReplaceAllString(span, "")
+		span = lineBreakTagPattern.ReplaceAllString(span, "\n")
+		span = htmlTagPattern.ReplaceAllString(span, "")
+		// links and images pointing at a script or an inline payload keep
+		// their label only
+		span = unsafeLinkPattern.ReplaceAllString(span, "$1")
+		spans[i] = outsideLinks(span, func(prose string) string {
+			prose = isoTimePattern.ReplaceAllStringFunc(prose, p.locale.formatDateTime)
+			return p.linkRecords(prose)
+		})
+	}
+	return strings.Join(spans, "`")
+}
+
+// outsideLinks rewrites the text between links and URLs, which keep their
+// targets untouched
+func outsideLinks(text string, rewrite func(string) string) string {
+	var out strings.Builder
+	last := 0
+	for _, loc := range linkOrUrlPattern.FindAllStringIndex(text, -1) {
+		out.WriteString(rewrite(text[last:loc[0]]))
+		out.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	out.WriteString(rewrite(text[last:]))
+	return out.String()
+}
+
+// linkRecords turns ids of the trip context that are not already part of a
+// link into a markdown link to the record on the trip page
+func (p *replyPostProcessor) linkRecords(text string) string {
+	if len(p.records) == 0 {
+		return text
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, loc := range recordIdPattern.FindAllStringIndex(text, -1) {
+		id := text[loc[0]:loc[1]]
+		record, ok := p.records[id]
+		if !ok || insideLink(text, loc[0], loc[1]) {
+			continue
+		}
+
+		label := record.label
+		if strings.TrimSpace(label) == "" {
+			label = id
+		}
+		label = strings.NewReplacer("[", "(", "]", ")").Replace(label)
+
+		out.WriteString(text[last:loc[0]])
+		out.WriteString(fmt.Sprintf("[%s](/trips/%s#%s-%s)", label, p.tripID, record.collection, id))
+		last = loc[1]
+	}
+	out.WriteString(text[last:])
+	return out.String()
+}
+
+// insideLink tells whether the text around an id already makes it a link
+// label or target
+func insideLink(text string, start int, end int) bool {
+	before, after := byte(0), byte(0)
+	if start > 0 {
+		before = text[start-1]
+	}
+	if end < len(text) {
+		after = text[end]
+	}
+	return strings.IndexByte("(/#-[", before) >= 0 || strings.IndexByte(")]", after) >= 0
+}
+
+// safeOutputCut is where pending stream text can be split: before the last
+// whitespace, which goes with the next word as a marker removed from there
+// takes the space in front of it along, before any link, tag, code span or citation still open, and
+// not between a date and its time
+func safeOutputCut(text string) int {
+	cut := wordEnd(text, len(text))
+	for cut > 0 && trailingDatePattern.MatchString(text[:cut]) {
+		cut = wordEnd(text, cut)
+	}
+
+	if start := openConstruct(text); start >= 0 && start < cut {
+		cut = start
+	}
+	if strings.Count(strings.ReplaceAll(text[:cut], "```", ""), "`")%2 == 1 {
+		cut = strings.LastIndex(text[:cut], "`")
+	}
+
+	lower := strings.ToLower(text[:cut])
+	for _, element := range []string{"script", "style", "iframe"} {
+		if start := strings.LastIndex(lower, "<"+element); start >= 0 && !strings.Contains(lower[start:], "</"+element) {
+			cut = start
+			lower = lower[:cut]
+		}
+	}
+	return cut
+}
+
+// openConstruct returns where the earliest tag, link or citation that is not
+// closed yet starts, -1 when everything is closed. A < that cannot start a
+// tag, as in "< 5 km", does not count.
+func openConstruct(text string) int {
+	earliest := -1
+	keep := func(start int) {
+		if start >= 0 && (earliest < 0 || start < earliest) {
+			earliest = start
+		}
+	}
+
+	if start := strings.LastIndex(text, "<"); start >= 0 && !strings.Contains(text[start:], ">") {
+		if start == len(text)-1 || strings.ContainsAny(text[start+1:start+2], "/!|") || unicode.IsLetter(rune(text[start+1])) {
+			keep(start)
+		}
+	}
+	if start := strings.LastIndex(text, "["); start >= 0 {
+		rest := text[start:]
+		closing := strings.Index(rest, "]")
+		switch {
+		case closing < 0:
+			keep(start)
+		case closing == len(rest)-1:
+			// the target may follow in the next delta
+			keep(start)
+		case rest[closing+1] == '(' && !strings.Contains(rest[closing:], ")"):
+			keep(start)
+		}
+	}
+	for _, pair := range [][2]string{{"【", "】"}, {"\ue200", "\ue201"}} {
+		if start := strings.LastIndex(text, pair[0]); start >= 0 && !strings.Contains(text[start:], pair[1]) {
+			keep(start)
+		}
+	}
+	return earliest
+}
+
+// wordEnd is where the whitespace in front of the last word before limit
+// starts, 0 when there is none
+func wordEnd(text string, limit int) int {
+	space := strings.LastIndexFunc(text[:limit], unicode.IsSpace)
+	if space < 0 {
+		return 0
+	}
+	end := strings.LastIndexFunc(text[:space], func(r rune) bool { return !unicode.IsSpace(r) })
+	if end < 0 {
+		return 0
+	}
+	_, size := utf8.DecodeRuneInString(text[end:])
+	return end + size
+}
@@ -0,0 +1,78 @@
+package routes
+
+import (
+	bt "backend/types"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const assistantToolCreatePoll = "create_poll"
+
+// savePollProposal asks the members to vote on the options the assistant
+// found, the poll counts as asked by the assistant
+func savePollProposal(app core.App, trip *core.Record, args map[string]interface{}) (string, string, error) {
+	req := tripPollRequest{
+		Question:     stringValue(args["question"]),
+		Quorum:       int(floatValue(args["quorum"])),
+		AutoSchedule: args["auto_schedule"] == true,
+	}
+	if list, ok := args["options"].([]interface{}); ok {
+		for _, item := range list {
+			option := mapValue(item)
+			req.Options = append(req.Options, bt.PollOption{
+				Name:        stringValue(option["name"]),
+				Description: stringValue(option["description"]),
+				Address:     stringValue(option["address"]),
+				StartTime:   stringValue(option["start_time"]),
+				EndTime:     stringValue(option["end_time"]),
+				Timezone:    stringValue(option["timezone"]),
+			})
+		}
+	}
+
+	poll, err := createPoll(app, trip, nil, req, time.Time{})
+	if err != nil {
+		return "", "", &proposalValidationError{Fields: map[string]string{"options": err.Error()}}
+	}
+	return poll.Id, fmt.Sprintf("Asked everyone to vote: %s", req.Question), nil
+}
+
+func assistantPollTools() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"type":        "function",
+			"name":        assistantToolCreatePoll,
+			"description": "Propose a poll so the travelers can vote between a few options, such as which museum to visit or where to eat on the last night. Give start times when the options are meant to be scheduled.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"question": map[string]interface{}{"type": "string", "description": "What the travelers vote on"},
+					"options": map[string]interface{}{
+						"type":     "array",
+						"minItems": 2,
+						"maxItems": 10,
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"name":        map[string]interface{}{"type": "string"},
+								"description": map[string]interface{}{"type": "string"},
+								"address":     map[string]interface{}{"type": "string"},
+								"start_time":  map[string]interface{}{"type": "string", "description": "Start time in RFC3339, if the option would be scheduled"},
+								"end_time":    map[string]interface{}{"type": "string", "description": "End time in RFC3339"},
+								"timezone":    map[string]interface{}{"type": "string", "description": "IANA timezone of the place"},
+							},
+							"required":             []string{"name"},
+							"additionalProperties": false,
+						},
+					},
+					"quorum":        map[string]interface{}{"type": "integer", "description": "Votes needed to decide, leave out for a majority of the travelers"},
+					"auto_schedule": map[string]interface{}{"type": "boolean", "description": "Add the winning option to the itinerary once decided"},
+				},
+				"required":             []string{"question", "options"},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// parsePartialArguments reads the top level fields that are already complete
+// in a function call's arguments while they are still being streamed, e.g.
+// `{"name":"Louvre","start_time":"2025-` gives {"name":"Louvre"}
+func parsePartialArguments(partial string) map[string]interface{} {
+	partial = strings.TrimSpace(partial)
+	if !strings.HasPrefix(partial, "{") {
+		return nil
+	}
+
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(partial+"}"), &args); err == nil {
+		return args
+	}
+
+	// cut at the last comma between top level fields
+	depth := 0
+	inString := false
+	escaped := false
+	lastComma := -1
+	for i, c := range partial {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+		case c == ',' && depth == 1:
+			lastComma = i
+		}
+	}
+	if lastComma < 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal([]byte(partial[:lastComma]+"}"), &args); err != nil {
+		return nil
+	}
+	return args
+}
+
+// draftEvent returns a proposal_draft event when more arguments are complete
+// than in the last draft sent for the current function call
+func (b *functionCallBuffer) draftEvent() (map[string]interface{}, bool) {
+	args := parsePartialArguments(b.builder.String())
+	if len(args) <= b.draftFields {
+		return nil, false
+	}
+	b.draftFields = len(args)
+
+	return map[string]interface{}{
+		"type":      "proposal_draft",
+		"itemId":    b.itemID,
+		"tool":      b.name,
+		"arguments": args,
+	}, true
+}
@@ -0,0 +1,214 @@
+package routes
+
+import (
+	"backend/planning"
+	"backend/validation"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// proposalValidationError lists the arguments of a proposal that cannot be
+// saved, in a shape the client can show or relay back to the assistant
+type proposalValidationError struct {
+	Fields map[string]string
+}
+
+func (e *proposalValidationError) Error() string {
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s %s", key, e.Fields[key]))
+	}
+	return "invalid proposal: " + strings.Join(parts, "; ")
+}
+
+var proposalRequiredArgs = map[string][]string{
+	assistantToolCreateActivity:       {"name", "address", "start_time"},
+	assistantToolCreateLodging:        {"name", "start_time", "end_time"},
+	assistantToolCreateTransportation: {"type", "origin", "departure_time"},
+	assistantToolUpdateActivity:       {"record_id"},
+	assistantToolUpdateLodging:        {"record_id"},
+	assistantToolUpdateTransportation: {"record_id"},
+	assistantToolDeleteActivity:       {"record_id"},
+	assistantToolDeleteLodging:        {"record_id"},
+	assistantToolDeleteTransportation: {"record_id"},
+	assistantToolSwapActivities:       {"first_record_id", "second_record_id"},
+	assistantToolCreateCarRental:      {"pickup_location", "pickup_time"},
+	assistantToolUpdateCarRental:      {"record_id"},
+	assistantToolDeleteCarRental:      {"record_id"},
+	assistantToolCreateDining:         {"name", "time"},
+	assistantToolUpdateDining:         {"record_id"},
+	assistantToolDeleteDining:         {"record_id"},
+	assistantToolCreateExpense:        {"name", "cost_value", "cost_currency"},
+	assistantToolUpdateExpense:        {"record_id"},
+	assistantToolDeleteExpense:        {"record_id"},
+	assistantToolCreatePoll:           {"question", "options"},
+}
+
+// start and end arguments of each tool
+var proposalTimeArgs = map[string][2]string{
+	assistantToolCreateActivity:       {"start_time", "end_time"},
+	assistantToolUpdateActivity:       {"start_time", "end_time"},
+	assistantToolCreateLodging:        {"start_time", "end_time"},
+	assistantToolUpdateLodging:        {"start_time", "end_time"},
+	assistantToolCreateTransportation: {"departure_time", "arrival_time"},
+	assistantToolUpdateTransportation: {"departure_time", "arrival_time"},
+	assistantToolCreateCarRental:      {"pickup_time", "dropoff_time"},
+	assistantToolUpdateCarRental:      {"pickup_time", "dropoff_time"},
+	assistantToolCreateDining:         {"time", ""},
+	assistantToolUpdateDining:         {"time", ""},
+	assistantToolCreateExpense:        {"occurred_on", ""},
+	assistantToolUpdateExpense:        {"occurred_on", ""},
+}
+
+// resolveNaturalTimes turns time arguments the model passed on as the
+// traveler wrote them ("next Friday 7pm", "14/03") into local ISO-8601 times,
+// reading numeric dates and relative days the way the user's locale does.
+// Arguments that cannot be read are left for validateProposalArguments to
+// reject.
+func resolveNaturalTimes(tool string, args map[string]interface{}, locale assistantLocale) {
+	for _, name := range proposalTimeArgs[tool] {
+		raw := strings.TrimSpace(stringValue(args[name]))
+		if raw == "" {
+			continue
+		}
+		if _, err := validation.ParseTimestamp(raw); err == nil {
+			continue
+		}
+		if parsed, err := validation.ParseNaturalTime(raw, locale.now(), locale.dayFirst()); err == nil {
+			args[name] = parsed.Format("2006-01-02T15:04:05")
+		}
+	}
+}
+
+// applyDefaultDuration sets the end of a new activity without one from the
+// duration of its category and returns the assumption made, if any
+func applyDefaultDuration(tool string, args map[string]interface{}, durations map[string]time.Duration) []string {
+	if tool != assistantToolCreateActivity || strings.TrimSpace(stringValue(args["end_time"])) != "" {
+		return nil
+	}
+
+	raw := strings.TrimSpace(stringValue(args["start_time"]))
+	start, err := validation.ParseTimestamp(raw)
+	if err != nil {
+		return nil
+	}
+
+	category, duration, ok := planning.EstimateDuration(durations,
+		stringValue(args["name"]), stringValue(args["description"]), stringValue(mapValue(args["destination"])["category"]))
+	if !ok {
+		return nil
+	}
+
+	layout := "2006-01-02T15:04:05"
+	if _, err := time.Parse(time.RFC3339, raw); err == nil {
+		layout = time.RFC3339
+	}
+	args["end_time"] = start.Add(duration).Format(layout)
+
+	return []string{fmt.Sprintf("No end time was given, so it assumes a %s takes %s.", category, formatDuration(duration))}
+}
+
+// formatDuration writes 1h30m0s as 1h30m
+func formatDuration(d time.Duration) string {
+	text := d.String()
+	text = strings.TrimSuffix(text, "0s")
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
+
+// validateProposalArguments checks the arguments produced by the model and
+// normalizes timestamps and currency codes in place
+func validateProposalArguments(tool string, args map[string]interface{}) error {
+	fields := map[string]string{}
+
+	for _, name := range proposalRequiredArgs[tool] {
+		if strings.TrimSpace(stringValue(args[name])) == "" {
+			fields[name] = "is required"
+		}
+	}
+
+	if timeArgs, ok := proposalTimeArgs[tool]; ok {
+		var times [2]time.Time
+		for i, name := range timeArgs {
+			raw := strings.TrimSpace(stringValue(args[name]))
+			if raw == "" {
+				continue
+			}
+			parsed, err := validation.ParseTimestamp(raw)
+			if err != nil {
+				fields[name] = "is not a valid date/time"
+				continue
+			}
+			times[i] = parsed
+			args[name] = parsed.Format(time.RFC3339)
+		}
+		if err := validation.ValidateRange(times[0], times[1]); err != nil {
+			fields[timeArgs[1]] = err.Error()
+		}
+	}
+
+	if _, hasCost := args["cost_value"]; hasCost {
+		currency, err := validation.NormalizeCost(floatValue(args["cost_value"]), stringValue(args["cost_currency"]))
+		if err != nil {
+			fields["cost_value"] = err.Error()
+		} else if currency != "" {
+			args["cost_currency"] = currency
+		}
+	}
+
+	if len(fields) > 0 {
+		return &proposalValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// proposalErrorResponse turns validation failures, either from the proposal
+// arguments or from the record validation on save, into a 422 response
+func proposalErrorResponse(e *core.RequestEvent, err error) error {
+	var proposalErr *proposalValidationError
+	if errors.As(err, &proposalErr) {
+		return e.JSON(http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":  proposalErr.Error(),
+			"code":   "invalid_proposal",
+			"fields": proposalErr.Fields,
+		})
+	}
+
+	var staleErr *staleProposalError
+	if errors.As(err, &staleErr) {
+		return e.JSON(http.StatusConflict, map[string]interface{}{
+			"error":    staleErr.Error(),
+			"code":     "stale_context",
+			"recordId": staleErr.RecordId,
+			"updated":  staleErr.Updated.Format(time.RFC3339),
+			"refresh":  true,
+			"hint":     "The trip changed after the assistant read it. Reload the trip and ask the assistant again so it works from the latest version.",
+			"conflict": staleErr.Conflict,
+		})
+	}
+
+	if fields := validation.FieldErrors(err); len(fields) > 0 {
+		recordErr := &proposalValidationError{Fields: fields}
+		return e.JSON(http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":  recordErr.Error(),
+			"code":   "invalid_proposal",
+			"fields": fields,
+		})
+	}
+
+	return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
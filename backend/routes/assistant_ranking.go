@@ -0,0 +1,334 @@
+package routes
+
+import (
+	"backend/currency"
+	"backend/planning"
+	"backend/proposals"
+	"backend/tripcontext"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// When a search turns up many restaurants or hotels the assistant hands them
+// to rank_suggestions, which orders them on what the server knows about the
+// travelers (their preferences, where they sleep, the budget left and the
+// suggestions they took or turned down before) and returns the top few for
+// the reply. The ranker is chosen with the suggestionRanker setting.
+
+const (
+	assistantToolRankSuggestions = "rank_suggestions"
+
+	defaultRankedSuggestions = 3
+	maxRankedSuggestions     = 10
+	maxRankingCandidates     = 30
+	// past decisions looked at for the accepted and dismissed signals
+	rankingFeedbackLimit = 200
+)
+
+func assistantRankingTools() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"type":        "function",
+			"name":        assistantToolRankSuggestions,
+			"description": "Rank places found for the traveler, such as restaurants, hotels or things to do, on their preferences, the distance from their lodging, the budget left and suggestions they accepted or turned down before. Call it whenever a search returns more candidates than you will present, passing all of them, and present the returned suggestions in the returned order.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"kind": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"restaurant", "lodging", "activity"},
+						"description": "What the candidates are.",
+					},
+					"date": map[string]interface{}{
+						"type":        "string",
+						"description": "The day the place is for, YYYY-MM-DD, to measure the distance from the lodging of that night.",
+					},
+					"top": map[string]interface{}{
+						"type":        "integer",
+						"description": "How many suggestions to present, 3 when not given.",
+					},
+					"suggestions": map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"name":           map[string]interface{}{"type": "string"},
+								"category":       map[string]interface{}{"type": "string", "description": "For example 'trattoria', 'boutique hotel' or 'museum'."},
+								"tags":           map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Words that describe the place, for example 'vegetarian' or 'rooftop'."},
+								"latitude":       map[string]interface{}{"type": "number"},
+								"longitude":      map[string]interface{}{"type": "number"},
+								"price_level":    map[string]interface{}{"type": "integer", "description": "1 (cheap) to 4 (expensive)."},
+								"estimated_cost": map[string]interface{}{"type": "number", "description": "Expected cost for the travelers."},
+								"currency":       map[string]interface{}{"type": "string"},
+								"rating":         map[string]interface{}{"type": "number", "description": "Review rating out of 5."},
+							},
+							"required": []string{"name"},
+						},
+					},
+				},
+				"required": []string{"suggestions"},
+			},
+		},
+	}
+}
+
+// suggestionRanking ranks suggestions for one traveler on one trip. The
+// signals are only read from the database when the assistant asks for a
+// ranking.
+type suggestionRanking struct {
+	app      core.App
+	trip     *core.Record
+	user     *core.Record
+	ctx      *tripcontext.Context
+	ranker   planning.SuggestionRanker
+	once     sync.Once
+	signals  planning.RankingSignals
+	lodgings []rankingLodging
+	// accepted and dismissed signals by the tool that proposed the place
+	feedback map[string]*planning.RankingSignals
+}
+
+// rankingLodging is a lodging with coordinates and the days it covers
+type rankingLodging struct {
+	anchor   planning.Anchor
+	checkIn  string
+	checkOut string
+}
+
+func newSuggestionRanking(app core.App, trip *core.Record, user *core.Record, ctx *tripcontext.Context, ranker string) *suggestionRanking {
+	if user == nil || planning.SuggestionRankers[ranker] == nil {
+		return nil
+	}
+	return &suggestionRanking{app: app, trip: trip, user: user, ctx: ctx, ranker: planning.SuggestionRankers[ranker]}
+}
+
+// answerRankSuggestions runs a rank_suggestions call and returns the output
+// for the model
+func answerRankSuggestions(ranking *suggestionRanking, argsJSON string) string {
+	var args struct {
+		Kind        string                   `json:"kind"`
+		Date        string                   `json:"date"`
+		Top         int                      `json:"top"`
+		Suggestions []map[string]interface{} `json:"suggestions"`
+	}
+	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+		return `{"error":"the arguments are not valid JSON"}`
+	}
+
+	suggestions := make([]planning.Suggestion, 0, len(args.Suggestions))
+	for _, raw := range args.Suggestions {
+		if suggestion, ok := parseSuggestion(raw); ok && len(suggestions) < maxRankingCandidates {
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+	top := args.Top
+	if top <= 0 {
+		top = defaultRankedSuggestions
+	}
+	top = min(top, maxRankedSuggestions, len(suggestions))
+
+	var ranked []planning.RankedSuggestion
+	if ranking == nil {
+		ranked = planning.ModelOrder{}.Rank(suggestions, planning.RankingSignals{})
+	} else {
+		ranked = ranking.ranker.Rank(suggestions, ranking.signalsFor(args.Kind, args.Date))
+	}
+
+	results := make([]map[string]interface{}, 0, top)
+	for _, r := range ranked[:top] {
+		result := map[string]interface{}{
+			"name":     r.Name,
+			"position": r.Position,
+		}
+		if len(r.Reasons) > 0 {
+			result["reasons"] = r.Reasons
+		}
+		results = append(results, result)
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"suggestions": results,
+		"left_out":    len(suggestions) - len(results),
+		"message":     "Present these suggestions in this order. Position is where you had put each one. Use the reasons when they help the traveler choose.",
+	})
+	if err != nil {
+		return `{"suggestions":[]}`
+	}
+	return string(data)
+}
+
+func parseSuggestion(raw map[string]interface{}) (planning.Suggestion, bool) {
+	suggestion := planning.Suggestion{
+		Name:          strings.TrimSpace(stringValue(raw["name"])),
+		Category:      stringValue(raw["category"]),
+		PriceLevel:    int(floatValue(raw["price_level"])),
+		EstimatedCost: floatValue(raw["estimated_cost"]),
+		Currency:      strings.ToUpper(strings.TrimSpace(stringValue(raw["currency"]))),
+		Rating:        floatValue(raw["rating"]),
+	}
+	if suggestion.Name == "" {
+		return suggestion, false
+	}
+	if tags, ok := raw["tags"].([]interface{}); ok {
+		for _, tag := range tags {
+			if value := stringValue(tag); value != "" {
+				suggestion.Tags = append(suggestion.Tags, value)
+			}
+		}
+	}
+	lat, latOk := raw["latitude"].(float64)
+	lng, lngOk := raw["longitude"].(float64)
+	if latOk && lngOk {
+		suggestion.Latitude, suggestion.Longitude = &lat, &lng
+	}
+	return suggestion, true
+}
+
+// signalsFor returns the signals with the lodgings of the date as anchors,
+// or every lodging of the trip when none covers it, and the feedback on
+// places of the same kind
+func (r *suggestionRanking) signalsFor(kind string, date string) planning.RankingSignals {
+	r.once.Do(r.load)
+
+	signals := r.signals
+	tool := assistantToolCreateActivity
+	if kind == "lodging" {
+		tool = assistantToolCreateLodging
+	}
+	if feedback := r.feedback[tool]; feedback != nil {
+		signals.Accepted = feedback.Accepted
+		signals.Dismissed = feedback.Dismissed
+		signals.DismissedNames = feedback.DismissedNames
+	}
+	signals.Anchors = make([]planning.Anchor, 0, len(r.lodgings))
+	if len(date) >= len(time.DateOnly) {
+		day := date[:len(time.DateOnly)]
+		for _, lodging := range r.lodgings {
+			if lodging.checkIn[:min(len(lodging.checkIn), len(day))] <= day && day <= lodging.checkOut {
+				signals.Anchors = append(signals.Anchors, lodging.anchor)
+			}
+		}
+	}
+	if len(signals.Anchors) == 0 {
+		for _, lodging := range r.lodgings {
+			signals.Anchors = append(signals.Anchors, lodging.anchor)
+		}
+	}
+	return signals
+}
+
+func (r *suggestionRanking) load() {
+	var preferences struct {
+		Likes []string `json:"likes"`
+		Avoid []string `json:"avoid"`
+	}
+	_ = r.user.UnmarshalJSONField("travelPreferences", &preferences)
+	r.signals.Likes = preferences.Likes
+	r.signals.Avoids = preferences.Avoid
+
+	for _, lodging := range r.ctx.Lodgings {
+		place := mapValue(lodging.Metadata["place"])
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(stringValue(place["latitude"])), 64)
+		lng, lngErr := strconv.ParseFloat(strings.TrimSpace(stringValue(place["longitude"])), 64)
+		if latErr != nil || lngErr != nil {
+			continue
+		}
+		r.lodgings = append(r.lodgings, rankingLodging{
+			anchor:   planning.Anchor{Name: lodging.Name, Latitude: lat, Longitude: lng},
+			checkIn:  lodging.CheckIn,
+			checkOut: lodging.CheckOut,
+		})
+	}
+
+	r.loadBudget()
+	r.loadFeedback()
+}
+
+// loadBudget spreads what is left of the budget over the days left
+func (r *suggestionRanking) loadBudget() {
+	budget := r.ctx.Budget
+	if budget == nil || budget.Value <= 0 || budget.Currency == "" {
+		return
+	}
+
+	rates := currency.LoadRates(r.app)
+	convert := func(value float64, from string) (float64, bool) {
+		if from == "" {
+			return value, true
+		}
+		return currency.Convert(value, from, budget.Currency, rates)
+	}
+
+	left := budget.Value
+	for _, expense := range r.ctx.Expenses {
+		if expense.Cost == nil {
+			continue
+		}
+		if spent, ok := convert(expense.Cost.Value, expense.Cost.Currency); ok {
+			left -= spent
+		}
+	}
+
+	start := r.trip.GetDateTime("startDate").Time()
+	end := r.trip.GetDateTime("endDate").Time()
+	if today := time.Now().UTC(); today.After(start) {
+		start = today
+	}
+	days := math.Max(math.Ceil(end.Sub(start).Hours()/24), 1)
+	if left <= 0 {
+		// anything costs more than nothing
+		left = 0.01
+	}
+
+	r.signals.DailyBudget = left / days
+	r.signals.Convert = convert
+}
+
+// loadFeedback counts the words of the places the traveler approved or
+// declined when the assistant proposed them, on any trip
+func (r *suggestionRanking) loadFeedback() {
+	r.feedback = map[string]*planning.RankingSignals{}
+
+	records, err := r.app.FindRecordsByFilter("assistant_actions",
+		"requestedBy = {:userId} && (tool = {:activity} || tool = {:lodging}) && (status = {:approved} || status = {:declined})",
+		"-created", rankingFeedbackLimit, 0, dbx.Params{
+			"userId":   r.user.Id,
+			"activity": assistantToolCreateActivity,
+			"lodging":  assistantToolCreateLodging,
+			"approved": proposals.StatusApproved,
+			"declined": proposals.StatusDeclined,
+		})
+	if err != nil {
+		return
+	}
+
+	for _, record := range records {
+		var args map[string]interface{}
+		_ = record.UnmarshalJSONField("arguments", &args)
+		name := stringValue(args["name"])
+		words := planning.SuggestionWords(name, stringValue(args["category"]), stringValue(args["type"]))
+
+		feedback := r.feedback[record.GetString("tool")]
+		if feedback == nil {
+			feedback = &planning.RankingSignals{Accepted: map[string]int{}, Dismissed: map[string]int{}, DismissedNames: map[string]bool{}}
+			r.feedback[record.GetString("tool")] = feedback
+		}
+		counts := feedback.Accepted
+		if record.GetString("status") == proposals.StatusDeclined {
+			counts = feedback.Dismissed
+			if folded := strings.Join(planning.SuggestionWords(name), " "); folded != "" {
+				feedback.DismissedNames[folded] = true
+			}
+		}
+		for _, word := range words {
+			counts[word]++
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package routes
+
+import (
+	"backend/proposals"
+	"backend/trips"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const readOnlyAssistantInstructions = "The traveler has view-only access to this trip. Answer questions and give suggestions, but do not offer to add, change or remove plans. Costs, the budget and confirmation codes are not shared with viewers; if asked, say they can get them from the trip owner."
+
+// proposal arguments that hold prices or booking references
+var costAndCodeArguments = []string{"cost_value", "cost_currency", "confirmation"}
+
+// requestTripRole is the role RequireTripAccess found for the current user
+func requestTripRole(e *core.RequestEvent) string {
+	role, _ := e.Get("tripRole").(string)
+	return role
+}
+
+// readOnlyAssistantConfig removes every tool that proposes changes, so
+// viewers can chat with the assistant without being offered edits
+func readOnlyAssistantConfig(config assistantConfig) assistantConfig {
+	disabled := make(map[string]bool, len(config.DisabledTools))
+	for tool := range config.DisabledTools {
+		disabled[tool] = true
+	}
+	for tool := range proposalRequiredArgs {
+		disabled[tool] = true
+	}
+	config.DisabledTools = disabled
+
+	if config.PromptInstructions != "" {
+		config.PromptInstructions += "\n\n"
+	}
+	config.PromptInstructions += readOnlyAssistantInstructions
+	return config
+}
+
+// checkProposalDecision answers with 403 when the role may not decide on the
+// proposal. Viewers cannot decide on anything. Editors can approve changes,
+// but removing records someone else asked for is left to the owner.
+func checkProposalDecision(e *core.RequestEvent, proposal *proposals.Proposal, decision string) (bool, error) {
+	if code, message := proposalDecisionRefusal(requestTripRole(e), e.Auth.Id, proposal, decision); code != "" {
+		return false, e.JSON(http.StatusForbidden, map[string]string{
+			"error": message,
+			"code":  code,
+		})
+	}
+	return true, nil
+}
+
+// proposalDecisionRefusal says why a member with the role may not make the
+// decision, the code is empty when they may
+func proposalDecisionRefusal(role string, userId string, proposal *proposals.Proposal, decision string) (string, string) {
+	if !trips.CanEdit(role) {
+		return "read_only", "viewers cannot approve or decline changes to this trip"
+	}
+	if decision == "approve" && role == trips.RoleEditor && proposalDeletes[proposal.Tool] && proposal.RequestedBy != userId {
+		return "owner_approval_required", "only the trip owner or the person who asked for it can approve this removal"
+	}
+	return "", ""
+}
+
+// viewerSafeArguments copies proposal arguments without prices and booking
+// references, including those of rooms, for showing them to viewers
+func viewerSafeArguments(args map[string]interface{}) map[string]interface{} {
+	safe := make(map[string]interface{}, len(args))
+	for key, value := range args {
+		safe[key] = value
+	}
+	for _, key := range costAndCodeArguments {
+		delete(safe, key)
+	}
+
+	if rooms, ok := safe["rooms"].([]interface{}); ok {
+		safeRooms := make([]interface{}, 0, len(rooms))
+		for _, room := range rooms {
+			if fields, ok := room.(map[string]interface{}); ok {
+				room = viewerSafeArguments(fields)
+			}
+			safeRooms = append(safeRooms, room)
+		}
+		safe["rooms"] = safeRooms
+	}
+	return safe
+}
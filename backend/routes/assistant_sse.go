@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sseStream serializes writes to an event stream so heartbeats sent from a
+// separate goroutine never interleave with events
+type sseStream struct {
+	http.ResponseWriter
+	flusher http.Flusher
+	mu      sync.Mutex
+}
+
+func newSSEStream(writer http.ResponseWriter, flusher http.Flusher) *sseStream {
+	return &sseStream{ResponseWriter: writer, flusher: flusher}
+}
+
+// sseFlusher finds the flusher of the response, looking through the writers
+// middleware wraps it in the way http.ResponseController does. Without one
+// the events still arrive, all at once when the reply is complete, which is
+// better than no answer behind a proxy or middleware that cannot stream.
+func sseFlusher(writer http.ResponseWriter) (http.Flusher, bool) {
+	for {
+		if flusher, ok := writer.(http.Flusher); ok {
+			return flusher, true
+		}
+		wrapper, ok := writer.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return bufferedFlusher{}, false
+		}
+		writer = wrapper.Unwrap()
+	}
+}
+
+// bufferedFlusher leaves the events to be sent in chunks by the server as
+// its buffer fills up and when the handler returns
+type bufferedFlusher struct{}
+
+func (bufferedFlusher) Flush() {}
+
+// setSSEHeaders marks the response as an event stream that proxies should
+// pass on as it is written. nginx buffers responses unless told otherwise
+// with X-Accel-Buffering, and no-transform stops Cloudflare and compressing
+// proxies from holding events back. Connection is not allowed on HTTP/2.
+func setSSEHeaders(writer http.ResponseWriter, request *http.Request) {
+	header := writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache, no-transform")
+	header.Set("X-Accel-Buffering", "no")
+	header.Del("Content-Length")
+	if request.ProtoMajor == 1 {
+		header.Set("Connection", "keep-alive")
+	}
+}
+
+// pad writes a comment of the given size and flushes it, pushing the stream
+// past proxies that wait for a minimum amount of data before forwarding
+func (s *sseStream) pad(size int) {
+	if size <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.ResponseWriter.Write([]byte(":" + strings.Repeat(" ", size) + "\n\n")); err == nil {
+		s.flusher.Flush()
+	}
+}
+
+func (s *sseStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ResponseWriter.Write(p)
+}
+
+func (s *sseStream) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flusher.Flush()
+}
+
+// startHeartbeat writes an SSE comment every interval so proxies keep idle
+// streams open. The returned function stops it.
+func (s *sseStream) startHeartbeat(interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.mu.Lock()
+				_, err := s.ResponseWriter.Write([]byte(": keepalive\n\n"))
+				if err == nil {
+					s.flusher.Flush()
+				}
+				s.mu.Unlock()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
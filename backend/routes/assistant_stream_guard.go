@@ -0,0 +1,142 @@
+package routes
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Reasons a reply stream is cut before the model finished, sent to the
+// client in a truncated event
+const (
+	truncatedIdle          = "idle_timeout"
+	truncatedStreamTimeout = "stream_timeout"
+	truncatedEventTooLarge = "event_too_large"
+	// the model stopped on its own, these are the incomplete_details
+	// reasons of the Responses API
+	truncatedMaxOutputTokens = "max_output_tokens"
+	truncatedContentFilter   = "content_filter"
+)
+
+var truncationMessages = map[string]string{
+	truncatedIdle:            "The assistant stopped answering, the reply is incomplete.",
+	truncatedStreamTimeout:   "The reply took too long and was cut short.",
+	truncatedEventTooLarge:   "Part of the reply was too large to read and the rest was cut short.",
+	truncatedMaxOutputTokens: "The reply reached its length limit and was cut short.",
+	truncatedContentFilter:   "The rest of the reply was withheld by the content filter.",
+}
+
+// truncationMessage explains the reason to the traveler, reasons the API adds
+// later get a generic message
+func truncationMessage(reason string) string {
+	if message, ok := truncationMessages[reason]; ok {
+		return message
+	}
+	return "The reply is incomplete."
+}
+
+// incompleteReason is why a response with the incomplete status stopped
+func incompleteReason(details map[string]interface{}) string {
+	if reason := stringValue(details["reason"]); reason != "" {
+		return reason
+	}
+	return "incomplete"
+}
+
+// streamTruncation ends the reading of a stream that was cut short
+type streamTruncation struct {
+	Reason string
+}
+
+func (t *streamTruncation) Error() string {
+	return fmt.Sprintf("assistant stream truncated: %s", t.Reason)
+}
+
+// truncatedEvent tells the client the reply it got is not the whole reply
+func truncatedEvent(t *streamTruncation, config assistantConfig) map[string]interface{} {
+	event := map[string]interface{}{
+		"type":    "truncated",
+		"reason":  t.Reason,
+		"message": truncationMessage(t.Reason),
+	}
+	if t.Reason == truncatedEventTooLarge {
+		event["limit"] = config.MaxEventBytes
+	}
+	return event
+}
+
+// idleReader cancels the request when the body sends nothing for the
+// timeout, a zero timeout never does
+type idleReader struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	fired   atomic.Bool
+}
+
+func newIdleReader(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleReader {
+	r := &idleReader{body: body, timeout: timeout}
+	if timeout > 0 {
+		r.timer = time.AfterFunc(timeout, func() {
+			r.fired.Store(true)
+			cancel()
+		})
+	}
+	return r
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 && r.timer != nil {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+func (r *idleReader) Close() error {
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	return r.body.Close()
+}
+
+// truncation tells whether reading the stream failed because of one of the
+// limits, rather than the traveler leaving or the network failing
+func truncation(err error, body *idleReader, streamCtx context.Context) error {
+	switch {
+	case errors.Is(err, bufio.ErrTooLong):
+		return &streamTruncation{Reason: truncatedEventTooLarge}
+	case body != nil && body.fired.Load():
+		return &streamTruncation{Reason: truncatedIdle}
+	case errors.Is(streamCtx.Err(), context.DeadlineExceeded):
+		return &streamTruncation{Reason: truncatedStreamTimeout}
+	}
+	return err
+}
+
+// endTruncatedStream finishes a stream cut short: the text received so far
+// and its sources are sent, then the truncated event. The reply has no text
+// so it is never cached.
+func endTruncatedStream(writer http.ResponseWriter, flusher http.Flusher, reply *assistantReply, citations []assistantSource, truncated *streamTruncation, config assistantConfig, output *replyPostProcessor) *assistantReply {
+	if text := output.Flush(); text != "" {
+		sendSSEEvent(writer, flusher, map[string]string{
+			"type": "delta",
+			"text": text,
+		})
+	}
+	reply.Truncated = truncated.Reason
+	reply.ToolResults = append(reply.ToolResults, citationResult(citations)...)
+	if sources, ok := sourcesEvent(reply.ToolResults); ok {
+		sendSSEEvent(writer, flusher, sources)
+	}
+	sendSSEEvent(writer, flusher, truncatedEvent(truncated, config))
+	sendSSEEvent(writer, flusher, map[string]string{
+		"type": "done",
+	})
+	return reply
+}
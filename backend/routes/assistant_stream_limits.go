@@ -0,0 +1,40 @@
+package routes
+
+import "sync"
+
+// activeStreams counts the assistant streams each user has open on this
+// instance
+var activeStreams = struct {
+	sync.Mutex
+	byUser map[string]int
+}{
+	byUser: make(map[string]int),
+}
+
+// acquireAssistantStream reserves one of the user's stream slots. It returns
+// the number of streams already open and false when the limit is reached,
+// otherwise a function that frees the slot again.
+func acquireAssistantStream(userId string, limit int) (func(), int, bool) {
+	activeStreams.Lock()
+	defer activeStreams.Unlock()
+
+	active := activeStreams.byUser[userId]
+	if limit > 0 && active >= limit {
+		return nil, active, false
+	}
+	activeStreams.byUser[userId] = active + 1
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			activeStreams.Lock()
+			defer activeStreams.Unlock()
+			if activeStreams.byUser[userId] <= 1 {
+				delete(activeStreams.byUser, userId)
+			} else {
+				activeStreams.byUser[userId]--
+			}
+		})
+	}
+	return release, active, true
+}
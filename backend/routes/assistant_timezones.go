@@ -0,0 +1,298 @@
+package routes
+
+import (
+	"backend/datasets"
+	"backend/proposals"
+	bt "backend/types"
+	"backend/validation"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	pbtypes "github.com/pocketbase/pocketbase/tools/types"
+)
+
+// a place written as an airport code, alone or in parentheses after a name
+var airportCodePattern = regexp.MustCompile(`(?:^|\()([A-Z]{3,4})\)?$`)
+
+// Itinerary times are stored as the local wall clock time of the place they
+// happen at (saved as if it were UTC), with the place's timezone kept in the
+// record metadata. The model sends RFC3339 timestamps that may carry any
+// offset, so they are converted into that representation before saving.
+
+// normalizeProposalTimes rewrites the time arguments of a proposal into local
+// wall clock times and fills in the timezone arguments when they can be
+// resolved from the proposal, the record being updated or the trip destinations
+func normalizeProposalTimes(app core.App, trip *core.Record, proposal *proposals.Proposal) {
+	args := proposal.Arguments
+	destinations := tripDestinationTimezones(trip)
+
+	switch proposal.Tool {
+	case assistantToolCreateActivity, assistantToolUpdateActivity:
+		tz := firstNonEmpty(
+			stringValue(mapValue(args["destination"])["timezone"]),
+			stringValue(args["timezone"]),
+			existingTimezone(app, proposal.Tool, args, "place"),
+			matchDestinationTimezone(destinations, stringValue(mapValue(args["destination"])["name"]), stringValue(args["address"])),
+		)
+		applyProposalTimezone(args, tz, "start_time", "end_time")
+	case assistantToolCreateLodging, assistantToolUpdateLodging:
+		tz := firstNonEmpty(
+			stringValue(args["timezone"]),
+			existingTimezone(app, proposal.Tool, args, "place"),
+			matchDestinationTimezone(destinations, stringValue(args["address"]), stringValue(args["name"])),
+		)
+		applyProposalTimezone(args, tz, "start_time", "end_time")
+	case assistantToolCreateTransportation, assistantToolUpdateTransportation:
+		originTz := firstNonEmpty(
+			stringValue(args["origin_timezone"]),
+			existingTimezone(app, proposal.Tool, args, "origin"),
+			matchDestinationTimezone(destinations, stringValue(args["origin"])),
+			airportTimezone(stringValue(args["origin"])),
+		)
+		destinationTz := firstNonEmpty(
+			stringValue(args["destination_timezone"]),
+			existingTimezone(app, proposal.Tool, args, "destination"),
+			matchDestinationTimezone(destinations, stringValue(args["destination"])),
+			airportTimezone(stringValue(args["destination"])),
+		)
+		applyTransportationTimezones(args, originTz, destinationTz)
+	case assistantToolCreateDining, assistantToolUpdateDining:
+		tz := firstNonEmpty(
+			stringValue(args["timezone"]),
+			existingTimezone(app, proposal.Tool, args, "place"),
+			matchDestinationTimezone(destinations, stringValue(args["address"]), stringValue(args["name"])),
+		)
+		applyProposalTimezone(args, tz, "time")
+	case assistantToolCreateCarRental, assistantToolUpdateCarRental:
+		pickupTz := firstNonEmpty(
+			stringValue(args["pickup_timezone"]),
+			existingTimezone(app, proposal.Tool, args, "pickup"),
+			matchDestinationTimezone(destinations, stringValue(args["pickup_location"])),
+			airportTimezone(stringValue(args["pickup_location"])),
+		)
+		dropoffTz := firstNonEmpty(
+			stringValue(args["dropoff_timezone"]),
+			existingTimezone(app, proposal.Tool, args, "dropoff"),
+			matchDestinationTimezone(destinations, stringValue(args["dropoff_location"])),
+			airportTimezone(stringValue(args["dropoff_location"])),
+			pickupTz,
+		)
+		if value := stringValue(args["pickup_time"]); value != "" {
+			args["pickup_time"] = toWallClock(value, pickupTz)
+		}
+		if value := stringValue(args["dropoff_time"]); value != "" {
+			args["dropoff_time"] = toWallClock(value, dropoffTz)
+		}
+		if pickupTz != "" {
+			args["pickup_timezone"] = pickupTz
+		}
+		if dropoffTz != "" {
+			args["dropoff_timezone"] = dropoffTz
+		}
+	}
+}
+
+func applyProposalTimezone(args map[string]interface{}, tz string, timeArgs ...string) {
+	if tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			tz = ""
+		}
+	}
+	for _, name := range timeArgs {
+		if value := stringValue(args[name]); value != "" {
+			args[name] = toWallClock(value, tz)
+		}
+	}
+	if tz != "" {
+		args["timezone"] = tz
+	}
+}
+
+func applyTransportationTimezones(args map[string]interface{}, originTz string, destinationTz string) {
+	if value := stringValue(args["departure_time"]); value != "" {
+		args["departure_time"] = toWallClock(value, originTz)
+	}
+	if value := stringValue(args["arrival_time"]); value != "" {
+		args["arrival_time"] = toWallClock(value, destinationTz)
+	}
+	if originTz != "" {
+		args["origin_timezone"] = originTz
+	}
+	if destinationTz != "" {
+		args["destination_timezone"] = destinationTz
+	}
+}
+
+// toWallClock returns the local time of the given timestamp in the place's
+// timezone. Timestamps without an explicit offset (or in UTC) are taken to
+// already be local, which is what the assistant is asked to send.
+func toWallClock(value string, tz string) string {
+	parsed, err := validation.ParseTimestamp(value)
+	if err != nil {
+		return value
+	}
+
+	if tz != "" && parsed.Location() != time.UTC {
+		if loc, locErr := time.LoadLocation(tz); locErr == nil {
+			parsed = parsed.In(loc)
+		}
+	}
+
+	wallClock := time.Date(parsed.Year(), parsed.Month(), parsed.Day(),
+		parsed.Hour(), parsed.Minute(), parsed.Second(), 0, time.UTC)
+	return wallClock.Format(pbtypes.DefaultDateLayout)
+}
+
+func tripDestinationTimezones(trip *core.Record) []bt.Destination {
+	var destinations []bt.Destination
+	_ = json.Unmarshal([]byte(trip.GetString("destinations")), &destinations)
+
+	withTimezone := make([]bt.Destination, 0, len(destinations))
+	for _, destination := range destinations {
+		if destination.TimeZone != "" {
+			withTimezone = append(withTimezone, destination)
+		}
+	}
+	return withTimezone
+}
+
+// matchDestinationTimezone finds the trip destination mentioned in one of the
+// given location strings. A trip with a single destination (or several sharing
+// one timezone) resolves to that timezone even without a match.
+func matchDestinationTimezone(destinations []bt.Destination, locations ...string) string {
+	for _, location := range locations {
+		location = strings.ToLower(location)
+		if location == "" {
+			continue
+		}
+		for _, destination := range destinations {
+			if destination.Name != "" && strings.Contains(location, strings.ToLower(destination.Name)) {
+				return destination.TimeZone
+			}
+		}
+	}
+
+	zones := map[string]bool{}
+	for _, destination := range destinations {
+		zones[destination.TimeZone] = true
+	}
+	if len(zones) == 1 {
+		return destinations[0].TimeZone
+	}
+	return ""
+}
+
+func existingTimezone(app core.App, tool string, args map[string]interface{}, metadataKey string) string {
+	recordID := stringValue(args["record_id"])
+	if recordID == "" {
+		return ""
+	}
+
+	collection := ""
+	switch tool {
+	case assistantToolUpdateActivity:
+		collection = "activities"
+	case assistantToolUpdateLodging:
+		collection = "lodgings"
+	case assistantToolUpdateTransportation:
+		collection = "transportations"
+	case assistantToolUpdateCarRental:
+		collection = "car_rentals"
+	case assistantToolUpdateDining:
+		collection = "dining"
+	default:
+		return ""
+	}
+
+	record, err := app.FindRecordById(collection, recordID)
+	if err != nil {
+		return ""
+	}
+
+	var metadata map[string]interface{}
+	_ = record.UnmarshalJSONField("metadata", &metadata)
+	return stringValue(mapValue(metadata[metadataKey])["timezone"])
+}
+
+// setMetadataTimezone records the timezone of a place in the record metadata,
+// keeping whatever else is already stored for it
+func setMetadataTimezone(record *core.Record, key string, tz string) {
+	if tz == "" {
+		return
+	}
+
+	metadata := map[string]interface{}{}
+	_ = record.UnmarshalJSONField("metadata", &metadata)
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+
+	place := mapValue(metadata[key])
+	if place == nil {
+		place = map[string]interface{}{}
+	}
+	place["timezone"] = tz
+	metadata[key] = place
+	record.Set("metadata", metadata)
+}
+
+// airportTimezone is the timezone of the airport when the place is written
+// as its code, "SFO" or "San Francisco (SFO)"
+func airportTimezone(place string) string {
+	if airport, found := placeAirport(place); found {
+		return airport.Timezone
+	}
+	return ""
+}
+
+func placeAirport(place string) (*bt.AirportDetails, bool) {
+	match := airportCodePattern.FindStringSubmatch(strings.TrimSpace(place))
+	if match == nil {
+		return nil, false
+	}
+	return datasets.FindAirport(match[1])
+}
+
+// setAirportPlace fills the place of the metadata from the airport the name
+// refers to, unless it already has coordinates
+func setAirportPlace(record *core.Record, key string, name string) {
+	airport, found := placeAirport(name)
+	if !found {
+		return
+	}
+
+	metadata := map[string]interface{}{}
+	_ = record.UnmarshalJSONField("metadata", &metadata)
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	place := mapValue(metadata[key])
+	if place == nil {
+		place = map[string]interface{}{}
+	}
+	if _, ok := place["latitude"]; ok {
+		return
+	}
+
+	place["name"] = firstNonEmpty(stringValue(place["name"]), name)
+	place["latitude"] = airport.Latitude
+	place["longitude"] = airport.Longitude
+	place["iataCode"] = airport.IataCode
+	if stringValue(place["timezone"]) == "" && airport.Timezone != "" {
+		place["timezone"] = airport.Timezone
+	}
+	metadata[key] = place
+	record.Set("metadata", metadata)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,218 @@
+package routes
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type assistantSource struct {
+	Url     string `json:"url"`
+	Title   string `json:"title,omitempty"`
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// assistantToolResult is what a tool call (web search, provider lookups)
+// returned while answering a turn, kept so the answer can be explained later
+type assistantToolResult struct {
+	Tool    string            `json:"tool"`
+	Query   string            `json:"query,omitempty"`
+	Sources []assistantSource `json:"sources"`
+}
+
+type assistantToolResultStore interface {
+	Save(app core.App, tripID string, turnID string, results []assistantToolResult) error
+	List(app core.App, tripID string, turnID string) ([]assistantToolResult, error)
+}
+
+// toolResultStore picks the storage backend from SURMAI_ASSISTANT_TOOL_RESULTS.
+// Results are stored in the assistant_tool_results collection unless it is set to "none".
+func toolResultStore() assistantToolResultStore {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("SURMAI_ASSISTANT_TOOL_RESULTS"))) {
+	case "none", "off", "false":
+		return noopToolResultStore{}
+	default:
+		return collectionToolResultStore{}
+	}
+}
+
+type collectionToolResultStore struct{}
+
+func (collectionToolResultStore) Save(app core.App, tripID string, turnID string, results []assistantToolResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	collection, err := app.FindCollectionByNameOrId("assistant_tool_results")
+	if err != nil {
+		return err
+	}
+
+	return app.RunInTransaction(func(txApp core.App) error {
+		for _, result := range results {
+			record := core.NewRecord(collection)
+			record.Set("trip", tripID)
+			record.Set("turnId", turnID)
+			record.Set("tool", result.Tool)
+			record.Set("query", result.Query)
+			record.Set("sources", result.Sources)
+			if err := txApp.Save(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (collectionToolResultStore) List(app core.App, tripID string, turnID string) ([]assistantToolResult, error) {
+	records, err := app.FindRecordsByFilter("assistant_tool_results",
+		"trip = {:tripId} && turnId = {:turnId}", "created", 0, 0,
+		dbx.Params{"tripId": tripID, "turnId": turnID})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]assistantToolResult, 0, len(records))
+	for _, record := range records {
+		result := assistantToolResult{
+			Tool:  record.GetString("tool"),
+			Query: record.GetString("query"),
+		}
+		_ = record.UnmarshalJSONField("sources", &result.Sources)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+type noopToolResultStore struct{}
+
+func (noopToolResultStore) Save(core.App, string, string, []assistantToolResult) error {
+	return nil
+}
+
+func (noopToolResultStore) List(core.App, string, string) ([]assistantToolResult, error) {
+	return []assistantToolResult{}, nil
+}
+
+func saveAssistantToolResults(app core.App, tripID string, turnID string, results []assistantToolResult) {
+	if err := toolResultStore().Save(app, tripID, turnID, results); err != nil {
+		app.Logger().Error("Unable to store assistant tool results", "error", err, "tripId", tripID, "turnId", turnID)
+	}
+}
+
+func AssistantTurnSources(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	turnID := e.Request.PathValue("turnId")
+
+	results, err := toolResultStore().List(e.App, trip.Id, turnID)
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"turnId":  turnID,
+		"results": results,
+	})
+}
+
+// parseWebSearchCall reads a web_search_call output item, which carries the
+// query and (with web_search_call.action.sources included) the consulted urls
+func parseWebSearchCall(item map[string]interface{}) (assistantToolResult, bool) {
+	if stringValue(item["type"]) != "web_search_call" {
+		return assistantToolResult{}, false
+	}
+
+	action := mapValue(item["action"])
+	result := assistantToolResult{
+		Tool:    "web_search",
+		Query:   stringValue(action["query"]),
+		Sources: make([]assistantSource, 0),
+	}
+
+	if rawSources, ok := action["sources"].([]interface{}); ok {
+		for _, raw := range rawSources {
+			source := mapValue(raw)
+			if url := stringValue(source["url"]); url != "" {
+				result.Sources = append(result.Sources, assistantSource{
+					Url:   url,
+					Title: stringValue(source["title"]),
+				})
+			}
+		}
+	}
+
+	return result, true
+}
+
+// parseUrlCitation turns an output_text annotation into a source, keeping the
+// part of the answer it supports as a snapshot
+func parseUrlCitation(annotation map[string]interface{}, text string) (assistantSource, bool) {
+	if stringValue(annotation["type"]) != "url_citation" {
+		return assistantSource{}, false
+	}
+	url := stringValue(annotation["url"])
+	if url == "" {
+		return assistantSource{}, false
+	}
+
+	source := assistantSource{
+		Url:   url,
+		Title: stringValue(annotation["title"]),
+	}
+
+	runes := []rune(text)
+	start := int(floatValue(annotation["start_index"]))
+	end := int(floatValue(annotation["end_index"]))
+	if start >= 0 && end > start && end <= len(runes) {
+		source.Snippet = string(runes[start:end])
+	}
+
+	return source, true
+}
+
+func citationResult(sources []assistantSource) []assistantToolResult {
+	if len(sources) == 0 {
+		return nil
+	}
+	return []assistantToolResult{{
+		Tool:    "citation",
+		Sources: sources,
+	}}
+}
+
+// sourcesEvent builds the "sources" SSE event from the tool results of a
+// turn. Cited sources are the ones linked from the answer, consulted sources
+// are everything the web search looked at. Both lists are de-duplicated.
+func sourcesEvent(results []assistantToolResult) (map[string]interface{}, bool) {
+	cited := make([]assistantSource, 0)
+	consulted := make([]assistantSource, 0)
+	seenCited := map[string]bool{}
+	seenConsulted := map[string]bool{}
+
+	for _, result := range results {
+		for _, source := range result.Sources {
+			if result.Tool == "citation" {
+				if !seenCited[source.Url] {
+					seenCited[source.Url] = true
+					cited = append(cited, source)
+				}
+			} else if !seenConsulted[source.Url] {
+				seenConsulted[source.Url] = true
+				consulted = append(consulted, assistantSource{Url: source.Url, Title: source.Title})
+			}
+		}
+	}
+
+	if len(cited) == 0 && len(consulted) == 0 {
+		return nil, false
+	}
+
+	return map[string]interface{}{
+		"type":      "sources",
+		"cited":     cited,
+		"consulted": consulted,
+	}, true
+}
@@ -0,0 +1,34 @@
+package routes
+
+import "strings"
+
+const defaultAssistantVerbosity = "low"
+
+// output token budget for each verbosity level. It includes the reasoning
+// tokens and the tool calls of every round, so it is far above the length of
+// the visible answer. The default level sets no budget at all, the text
+// verbosity already keeps those answers short.
+var assistantVerbosityTokens = map[string]int{
+	"low":    0,
+	"medium": 16384,
+	"high":   32768,
+}
+
+// setAssistantOutputTokens adds the budget of the verbosity level to the
+// request, a zero budget leaves max_output_tokens unset
+func setAssistantOutputTokens(payload map[string]interface{}, verbosity string) {
+	if tokens := assistantVerbosityTokens[verbosity]; tokens > 0 {
+		payload["max_output_tokens"] = tokens
+	}
+}
+
+// parseAssistantVerbosity maps the verbosity requested by the client to one of
+// the Responses API levels, an empty value means the default
+func parseAssistantVerbosity(value string) (string, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return defaultAssistantVerbosity, true
+	}
+	_, ok := assistantVerbosityTokens[value]
+	return value, ok
+}
@@ -0,0 +1,299 @@
+package routes
+
+import (
+	"backend/ingest"
+	"backend/trips"
+	bt "backend/types"
+	"backend/validation"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+const maxBoardingPassBytes = 5 << 20
+
+const boardingPassPrompt = "Read the boarding pass. carrier is the two letter airline code and flightNumber the number without it, origin and destination are IATA airport codes, date is the departure day as 2006-01-02 and boardingTime and departure are the times as printed. Leave fields empty when the pass does not show them."
+
+// UploadBoardingPass reads an Apple Wallet pass (.pkpass) or a boarding pass
+// PDF uploaded as "pass" and fills in the flight number, seat, gate, terminal
+// and booking reference of the transportation. The file is kept as an
+// attachment of the transportation.
+func UploadBoardingPass(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	if !trips.CanEdit(requestTripRole(e)) {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "viewers cannot change transportations"})
+	}
+
+	record, err := ensureTripRecord(e.App, "transportations", e.Request.PathValue("transportationId"), trip.Id)
+	if err != nil {
+		return e.NotFoundError("Transportation not found", err)
+	}
+
+	file, header, err := e.Request.FormFile("pass")
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "pass file is required"})
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBoardingPassBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxBoardingPassBytes {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "the pass must be smaller than 5 MB"})
+	}
+
+	pass, err := readBoardingPass(e.Request.Context(), loadAssistantConfig(e.App), data, record.GetDateTime("departureTime").Time())
+	if errors.Is(err, ingest.ErrNoBoardingPass) {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+
+	var participants []bt.Participant
+	_ = trip.UnmarshalJSONField("participants", &participants)
+	updated, warnings := applyBoardingPass(record, pass, participants)
+
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		attachment, err := saveTripAttachmentFile(txApp, trip.Id, header.Filename, data)
+		if err != nil {
+			return err
+		}
+		record.Set("attachmentReferences", append(record.GetStringSlice("attachmentReferences"), attachment.Id))
+		return txApp.Save(record)
+	})
+	if fields := validation.FieldErrors(err); len(fields) > 0 {
+		return e.JSON(http.StatusUnprocessableEntity, map[string]any{
+			"error":  "the boarding pass could not be saved on the transportation",
+			"fields": fields,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"transportation": record,
+		"boardingPass":   pass,
+		"updated":        updated,
+		"warnings":       warnings,
+	})
+}
+
+// readBoardingPass tells Wallet passes (zip archives) and PDFs apart. PDFs
+// whose text holds no flight number are read by the assistant.
+func readBoardingPass(ctx context.Context, config assistantConfig, data []byte, near time.Time) (*ingest.BoardingPass, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK")):
+		return ingest.ParsePKPass(data, near)
+	case bytes.HasPrefix(data, []byte("%PDF")):
+		if pass, ok := ingest.ParseBoardingPassText(ingest.PDFText(data), near); ok {
+			return pass, nil
+		}
+		return extractBoardingPassWithAssistant(ctx, config, data)
+	default:
+		return nil, ingest.ErrNoBoardingPass
+	}
+}
+
+// applyBoardingPass copies what the pass says onto the transportation and
+// returns the names of the changed fields. The seat goes to the participant
+// named on the pass; a pass for another flight is applied but warned about.
+func applyBoardingPass(record *core.Record, pass *ingest.BoardingPass, participants []bt.Participant) ([]string, []string) {
+	updated := make([]string, 0)
+	warnings := make([]string, 0)
+
+	metadata := map[string]interface{}{}
+	_ = record.UnmarshalJSONField("metadata", &metadata)
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+
+	if known := stringValue(metadata["flightNumber"]); known != "" && pass.FlightNumber != "" &&
+		!strings.EqualFold(strings.ReplaceAll(known, " ", ""), pass.Flight()) {
+		warnings = append(warnings, fmt.Sprintf("the pass is for flight %s, not %s", pass.Flight(), known))
+	}
+	if day := record.GetDateTime("departureTime"); !day.IsZero() && pass.Date != "" && day.Time().Format(time.DateOnly) != pass.Date {
+		warnings = append(warnings, fmt.Sprintf("the pass is for %s, the transportation departs on %s", pass.Date, day.Time().Format(time.DateOnly)))
+	}
+
+	setMetadata := func(key string, value string) {
+		if value != "" && stringValue(metadata[key]) != value {
+			metadata[key] = value
+			updated = append(updated, key)
+		}
+	}
+	if pass.FlightNumber != "" {
+		setMetadata("flightNumber", pass.Flight())
+	}
+	setMetadata("reservation", pass.Confirmation)
+	setMetadata("gate", pass.Gate)
+	setMetadata("terminal", pass.Terminal)
+	setMetadata("boardingTime", pass.BoardingTime)
+	if stringValue(metadata["provider"]) == "" {
+		setMetadata("provider", pass.Carrier)
+	}
+	record.Set("metadata", metadata)
+
+	if record.GetString("origin") == "" && pass.Origin != "" {
+		record.Set("origin", pass.Origin)
+		updated = append(updated, "origin")
+	}
+	if record.GetString("destination") == "" && pass.Destination != "" {
+		record.Set("destination", pass.Destination)
+		updated = append(updated, "destination")
+	}
+
+	if pass.Seat != "" {
+		participant := matchPassenger(pass.Passenger, participants)
+		if participant == "" {
+			warnings = append(warnings, fmt.Sprintf("%s is not a participant of the trip, seat %s was not assigned", firstNonEmpty(pass.Passenger, "the passenger"), pass.Seat))
+		} else {
+			var seats []bt.SeatAssignment
+			_ = record.UnmarshalJSONField("seats", &seats)
+			assigned := false
+			for i := range seats {
+				if strings.EqualFold(seats[i].Participant, participant) {
+					seats[i].Seat, seats[i].Kind, assigned = pass.Seat, "seat", true
+				}
+			}
+			if !assigned {
+				seats = append(seats, bt.SeatAssignment{Participant: participant, Seat: pass.Seat, Kind: "seat"})
+			}
+			record.Set("seats", seats)
+			updated = append(updated, "seats")
+		}
+	}
+
+	return updated, warnings
+}
+
+// matchPassenger finds the trip participant named on the pass, which has the
+// name as booked ("John Doe" for "DOE/JOHN MR"). Trips without participants
+// take the name from the pass.
+func matchPassenger(passenger string, participants []bt.Participant) string {
+	if len(participants) == 0 {
+		return passenger
+	}
+	passengerWords := strings.Fields(strings.ToLower(passenger))
+	for _, participant := range participants {
+		words := strings.Fields(strings.ToLower(participant.Name))
+		if len(words) == 0 || len(passengerWords) == 0 {
+			continue
+		}
+		if containsWords(passengerWords, words) || containsWords(words, passengerWords) {
+			return participant.Name
+		}
+	}
+	// a single participant is the traveler the pass was issued to
+	if len(participants) == 1 && passenger == "" {
+		return participants[0].Name
+	}
+	return ""
+}
+
+func containsWords(words []string, wanted []string) bool {
+	for _, w := range wanted {
+		if !slices.Contains(words, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// saveTripAttachmentFile keeps an uploaded file as an attachment of the trip
+func saveTripAttachmentFile(app core.App, tripId string, name string, data []byte) (*core.Record, error) {
+	collection, err := app.FindCollectionByNameOrId("trip_attachments")
+	if err != nil {
+		return nil, err
+	}
+	file, err := filesystem.NewFileFromBytes(data, name)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment := core.NewRecord(collection)
+	attachment.Set("name", name)
+	attachment.Set("file", file)
+	attachment.Set("trip", tripId)
+	return attachment, app.Save(attachment)
+}
+
+// extractBoardingPassWithAssistant sends the PDF to the model, for passes
+// whose text cannot be read or holds the details only in the barcode image
+func extractBoardingPassWithAssistant(ctx context.Context, config assistantConfig, pdf []byte) (*ingest.BoardingPass, error) {
+	apiKey := strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
+	if apiKey == "" {
+		return nil, ingest.ErrNoBoardingPass
+	}
+
+	fields := []string{"passenger", "carrier", "flightNumber", "origin", "destination", "date", "departure", "boardingTime", "seat", "gate", "terminal", "class", "confirmation"}
+	properties := map[string]interface{}{}
+	for _, field := range fields {
+		properties[field] = map[string]interface{}{"type": "string"}
+	}
+
+	payload := map[string]interface{}{
+		"model": config.Model,
+		"input": []map[string]interface{}{
+			newResponsesTextBlock("developer", boardingPassPrompt),
+			{
+				"role": "user",
+				"content": []map[string]string{
+					{
+						"type":      "input_file",
+						"filename":  "boarding-pass.pdf",
+						"file_data": "data:application/pdf;base64," + base64.StdEncoding.EncodeToString(pdf),
+					},
+				},
+			},
+		},
+		"reasoning": map[string]string{"effort": "low"},
+		"text": map[string]interface{}{
+			"format": map[string]interface{}{
+				"type":   "json_schema",
+				"name":   "boarding_pass",
+				"strict": true,
+				"schema": map[string]interface{}{
+					"type":                 "object",
+					"properties":           properties,
+					"required":             fields,
+					"additionalProperties": false,
+				},
+			},
+		},
+	}
+
+	response, err := postResponsesAPI(ctx, apiKey, payload, config.RequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimSpace(strings.Join(response.OutputText, ""))
+	if text == "" {
+		text = extractFallbackOutput(*response)
+	}
+
+	var pass ingest.BoardingPass
+	if err := json.Unmarshal([]byte(text), &pass); err != nil {
+		return nil, err
+	}
+	if pass.FlightNumber == "" {
+		return nil, ingest.ErrNoBoardingPass
+	}
+	pass.Carrier = strings.ToUpper(strings.TrimSpace(pass.Carrier))
+	return &pass, nil
+}
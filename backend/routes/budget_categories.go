@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"backend/currency"
+	"backend/trips"
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// TripBudgetCategories compares what the trip costs in lodging, transport,
+// food, activities and everything else with the budget set aside for each,
+// and flags the categories that went over. Costs count at the rates they
+// were booked at, in the currency of the budget.
+func TripBudgetCategories(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	role := requestTripRole(e)
+	if role == trips.RoleViewer {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "viewers do not see the costs of the trip"})
+	}
+
+	report, err := trips.SpendByCategory(e.App, trip, trips.SeesPrivate(role), currency.LoadRates(e.App))
+	if errors.Is(err, trips.ErrNoBudgetCurrency) {
+		return e.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"backend/currency"
+	"backend/trips"
+	bt "backend/types"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const assistantToolGetDailySpend = "get_daily_spend"
+
+func assistantDailySpendTools() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"type":        "function",
+			"name":        assistantToolGetDailySpend,
+			"description": "Get what the trip cost per calendar day in the currency of the budget, with the running total. Lodgings and rentals are spread over the nights and days they cover. Call it when the traveler asks how much was spent on a day, so far, this week or per day on average.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"from": map[string]interface{}{
+						"type":        "string",
+						"description": "The first day to list as 2006-01-02. Leave empty to start with the first day anything was spent.",
+					},
+					"to": map[string]interface{}{
+						"type":        "string",
+						"description": "The last day to list as 2006-01-02. Leave empty to end with the last day of the trip.",
+					},
+				},
+			},
+		},
+	}
+}
+
+// TripDailySpend returns what the trip cost on each day in the currency of
+// the budget, for charting how fast the budget goes
+func TripDailySpend(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	role := requestTripRole(e)
+	if role == trips.RoleViewer {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "viewers do not see the costs of the trip"})
+	}
+
+	report, err := trips.DailySpend(e.App, trip, trips.SeesPrivate(role), currency.LoadRates(e.App))
+	if errors.Is(err, trips.ErrNoBudgetCurrency) {
+		return e.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, report)
+}
+
+// answerDailySpend runs a get_daily_spend call and returns the output for
+// the model, the days between from and to and what was spent on them
+func answerDailySpend(app core.App, trip *core.Record, role string, argsJSON string) string {
+	if app == nil || trip == nil || !trips.CanEdit(role) {
+		return `{"error":"the costs of the trip are not shared with this traveler"}`
+	}
+
+	var args struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+		return `{"error":"the arguments are not valid JSON"}`
+	}
+	for _, day := range []string{args.From, args.To} {
+		if _, err := time.Parse(time.DateOnly, day); day != "" && err != nil {
+			return `{"error":"from and to must be days as 2006-01-02"}`
+		}
+	}
+
+	report, err := trips.DailySpend(app, trip, trips.SeesPrivate(role), currency.LoadRates(app))
+	if errors.Is(err, trips.ErrNoBudgetCurrency) {
+		return `{"error":"the trip has no budget currency to add the costs up in, ask the traveler to set a budget"}`
+	}
+	if err != nil {
+		return `{"error":"the costs of the trip could not be read"}`
+	}
+
+	days := make([]bt.DaySpend, 0, len(report.Days))
+	spent := bt.Cost{Currency: report.Currency}
+	for _, day := range report.Days {
+		if args.From != "" && day.Date < args.From || args.To != "" && day.Date > args.To {
+			continue
+		}
+		days = append(days, day)
+		spent.Value += day.Spent.Value
+	}
+	spent.Value = currency.Round(spent.Value, report.Currency)
+
+	data, err := json.Marshal(map[string]interface{}{
+		"today":         time.Now().UTC().Format(time.DateOnly),
+		"days":          days,
+		"spentInRange":  spent,
+		"tripTotal":     report.Total,
+		"averagePerDay": report.AveragePerDay,
+		"budget":        report.Budget,
+		"undated":       report.Undated,
+		"unconverted":   report.Unconverted,
+	})
+	if err != nil {
+		return `{"error":"the costs of the trip could not be read"}`
+	}
+	return string(data)
+}
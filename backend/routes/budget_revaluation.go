@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"backend/currency"
+	"backend/trips"
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// TripBudgetRevaluation values the costs of the trip at today's exchange
+// rates next to the rates they were booked at, to track the budget while
+// the currencies move. The locked rates are left as they are, the ones
+// locked for an earlier budget currency count as not locked.
+func TripBudgetRevaluation(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	role := requestTripRole(e)
+	if role == trips.RoleViewer {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "viewers do not see the costs of the trip"})
+	}
+
+	revaluation, err := trips.Revalue(e.App, trip, trips.SeesPrivate(role), currency.LoadRates(e.App))
+	if errors.Is(err, trips.ErrNoBudgetCurrency) {
+		return e.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, revaluation)
+}
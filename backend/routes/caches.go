@@ -0,0 +1,43 @@
+package routes
+
+import (
+	"backend/cache"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// GetCaches lists the in-memory caches with their entries and hit rates
+// since the server started
+func GetCaches(e *core.RequestEvent) error {
+	return e.JSON(http.StatusOK, map[string]interface{}{"caches": cache.Stats()})
+}
+
+// FlushCaches drops the entries of the caches named in ?name=, comma
+// separated or repeated. Without a name every cache is flushed but the ones
+// holding pending work, such as import reviews.
+func FlushCaches(e *core.RequestEvent) error {
+	names := make([]string, 0)
+	for _, value := range e.Request.URL.Query()["name"] {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if !cache.IsNamespace(name) {
+				return e.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("unknown cache %q", name)})
+			}
+			names = append(names, name)
+		}
+	}
+
+	dropped := cache.Flush(names...)
+	e.App.Logger().Info("Flushed caches", "caches", names, "entries", dropped)
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"flushed": dropped,
+		"caches":  cache.Stats(),
+	})
+}
@@ -0,0 +1,560 @@
+package routes
+
+import (
+	"backend/cache"
+	"backend/chatbots"
+	"backend/proposals"
+	"backend/trips"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/routine"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// The assistant also chats where the travelers already plan together. A
+// Telegram group or a Discord channel is linked to a trip with a code made
+// on the trip, the code also links the chat account of whoever sends it to
+// their Surmai account. Questions are answered with what the sender may see
+// and change, proposals are posted with approve and decline buttons that
+// only members who can edit the trip may press. SURMAI_TELEGRAM_BOT_TOKEN
+// turns on Telegram, SURMAI_DISCORD_APPLICATION_ID, SURMAI_DISCORD_PUBLIC_KEY
+// and SURMAI_DISCORD_BOT_TOKEN turn on Discord.
+
+var (
+	telegramBot *chatbots.Telegram
+	discordBot  *chatbots.Discord
+)
+
+const (
+	chatLinkCodeTTL = 15 * time.Minute
+	// codes are typed by hand, so letters and digits that look alike are left out
+	chatLinkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	chatHistoryTTL       = 6 * time.Hour
+	chatHistoryMessages  = 12
+)
+
+const chatBotHelp = `I am the Surmai trip assistant.
+
+/link CODE links this chat to a trip, make the code on the trip page
+/ask QUESTION asks about the linked trip, in a private chat just write
+/pending lists the changes waiting for approval
+/unlink unlinks this chat from its trip`
+
+// SetupChatBots reads the configuration of the bots when the server starts,
+// registers the Telegram webhook and the Discord commands
+func SetupChatBots(app core.App) {
+	telegramBot = chatbots.TelegramFromEnv()
+	discord, err := chatbots.DiscordFromEnv()
+	if err != nil {
+		app.Logger().Error("Discord bot is not set up", "error", err)
+	}
+	discordBot = discord
+
+	appURL := strings.TrimSuffix(app.Settings().Meta.AppURL, "/")
+	routine.FireAndForget(func() {
+		if telegramBot != nil {
+			if err := telegramBot.Setup(appURL + "/api/surmai/bots/telegram"); err != nil {
+				app.Logger().Error("Telegram bot setup failed", "error", err)
+			}
+		}
+		if discordBot != nil {
+			if err := discordBot.Setup(); err != nil {
+				app.Logger().Error("Discord bot setup failed", "error", err)
+			}
+		}
+	})
+}
+
+// TelegramWebhook receives the updates of the Telegram bot. They are handled
+// after the answer, Telegram sends an update again when it waits too long.
+func TelegramWebhook(e *core.RequestEvent) error {
+	if telegramBot == nil {
+		return e.NotFoundError("Telegram is not configured", nil)
+	}
+	update, err := telegramBot.ParseUpdate(e.Request)
+	if errors.Is(err, chatbots.ErrUnauthorized) {
+		return e.UnauthorizedError("Invalid Telegram secret", nil)
+	}
+	if err != nil {
+		return e.BadRequestError("Could not read the update", err)
+	}
+	if update != nil {
+		app := e.App
+		routine.FireAndForget(func() {
+			handleChatUpdate(app, telegramBot, update)
+		})
+	}
+	return e.NoContent(http.StatusOK)
+}
+
+// DiscordInteractions receives the slash commands and button presses of the
+// Discord bot. Discord wants an answer within three seconds, the reply is
+// posted as a follow up.
+func DiscordInteractions(e *core.RequestEvent) error {
+	if discordBot == nil {
+		return e.NotFoundError("Discord is not configured", nil)
+	}
+	update, response, err := discordBot.ParseInteraction(e.Request)
+	if errors.Is(err, chatbots.ErrUnauthorized) {
+		return e.UnauthorizedError("Invalid Discord signature", nil)
+	}
+	if err != nil {
+		return e.BadRequestError("Could not read the interaction", err)
+	}
+	if update != nil {
+		app := e.App
+		routine.FireAndForget(func() {
+			handleChatUpdate(app, discordBot, update)
+		})
+	}
+	return e.JSON(http.StatusOK, response)
+}
+
+func handleChatUpdate(app core.App, platform chatbots.Platform, update *chatbots.Update) {
+	if update.Data != "" {
+		reply, clear := decideChatProposal(app, platform, update)
+		if err := platform.Acknowledge(update, clear); err != nil {
+			app.Logger().Warn("Chat bot could not acknowledge a button", "error", err, "platform", platform.Name())
+		}
+		if err := platform.Reply(update, reply); err != nil {
+			app.Logger().Warn("Chat bot reply failed", "error", err, "platform", platform.Name())
+		}
+		return
+	}
+
+	reply, ok := chatCommandReply(app, platform, update)
+	if !ok {
+		return
+	}
+	if err := platform.Reply(update, reply); err != nil {
+		app.Logger().Warn("Chat bot reply failed", "error", err, "platform", platform.Name())
+	}
+}
+
+// chatCommandReply answers a message, ok is false for the group messages
+// that are not meant for the bot
+func chatCommandReply(app core.App, platform chatbots.Platform, update *chatbots.Update) (chatbots.Reply, bool) {
+	command, argument := update.Command()
+	switch command {
+	case "start", "help":
+		return chatbots.Reply{Text: chatBotHelp}, true
+	case "link":
+		return linkChat(app, platform, update, argument), true
+	case "unlink":
+		return unlinkChat(app, platform, update), true
+	case "pending":
+		return pendingChatProposals(app, platform, update), true
+	case "ask":
+		if argument == "" {
+			return chatbots.Reply{Text: "Ask a question after /ask."}, true
+		}
+		return askChatAssistant(app, platform, update, argument), true
+	case "":
+		if update.Private || update.Mentioned {
+			return askChatAssistant(app, platform, update, argument), true
+		}
+		return chatbots.Reply{}, false
+	}
+	// commands meant for other bots of a group are left alone
+	if update.Private {
+		return chatbots.Reply{Text: chatBotHelp}, true
+	}
+	return chatbots.Reply{}, false
+}
+
+// chatLinkCode is what a link code stands for
+type chatLinkCode struct {
+	UserId string
+	TripId string
+}
+
+func chatLinkKey(code string) string {
+	return fmt.Sprintf("chatbot-link-%s", strings.ToUpper(code))
+}
+
+func chatHistoryKey(platform string, chatId string) string {
+	return fmt.Sprintf("chatbot-chat-%s-%s", platform, chatId)
+}
+
+func linkChat(app core.App, platform chatbots.Platform, update *chatbots.Update, code string) chatbots.Reply {
+	if code == "" {
+		return chatbots.Reply{Text: "Send /link with the code shown on the trip page."}
+	}
+	value, found := cache.Get(chatLinkKey(code))
+	link, ok := value.(chatLinkCode)
+	if !found || !ok {
+		return chatbots.Reply{Text: "That code is unknown or expired, make a new one on the trip page."}
+	}
+	// a code is used once, it may have been seen by the whole group
+	cache.Delete(chatLinkKey(code))
+
+	trip, err := app.FindRecordById("trips", link.TripId)
+	if err != nil {
+		return chatbots.Reply{Text: "That trip no longer exists."}
+	}
+	role := trips.TripRole(trip, link.UserId)
+	if role == "" {
+		return chatbots.Reply{Text: "You are no longer a member of that trip."}
+	}
+
+	if err := saveChatAccount(app, platform.Name(), update, link.UserId); err != nil {
+		app.Logger().Error("Unable to link chat account", "error", err, "platform", platform.Name())
+		return chatbots.Reply{Text: "Something went wrong, try again."}
+	}
+
+	if !trips.CanEdit(role) {
+		return chatbots.Reply{Text: fmt.Sprintf("Your account is linked. Only the owner or an editor of %s can link this chat to it.", trip.GetString("name"))}
+	}
+
+	chat, _ := findBotChat(app, platform.Name(), update.ChatId)
+	if chat == nil {
+		collection, err := app.FindCollectionByNameOrId("bot_chats")
+		if err != nil {
+			return chatbots.Reply{Text: "Something went wrong, try again."}
+		}
+		chat = core.NewRecord(collection)
+		chat.Set("platform", platform.Name())
+		chat.Set("chatId", update.ChatId)
+	}
+	if chat.GetString("trip") != trip.Id {
+		// what was said about another trip would mislead the assistant
+		cache.Delete(chatHistoryKey(platform.Name(), update.ChatId))
+	}
+	title := update.ChatTitle
+	if title == "" {
+		title = update.SenderName
+	}
+	chat.Set("trip", trip.Id)
+	chat.Set("linkedBy", link.UserId)
+	chat.Set("title", title)
+	if err := app.Save(chat); err != nil {
+		app.Logger().Error("Unable to link chat", "error", err, "platform", platform.Name())
+		return chatbots.Reply{Text: "Something went wrong, try again."}
+	}
+
+	return chatbots.Reply{Text: fmt.Sprintf("This chat is now linked to %s. Ask me anything about the trip, changes I suggest wait for an approval here.", trip.GetString("name"))}
+}
+
+func saveChatAccount(app core.App, platform string, update *chatbots.Update, userId string) error {
+	account, _ := app.FindFirstRecordByFilter("bot_accounts", "platform = {:platform} && externalId = {:externalId}",
+		dbx.Params{"platform": platform, "externalId": update.SenderId})
+	if account == nil {
+		collection, err := app.FindCollectionByNameOrId("bot_accounts")
+		if err != nil {
+			return err
+		}
+		account = core.NewRecord(collection)
+		account.Set("platform", platform)
+		account.Set("externalId", update.SenderId)
+	}
+	account.Set("user", userId)
+	account.Set("username", update.SenderName)
+	return app.Save(account)
+}
+
+func unlinkChat(app core.App, platform chatbots.Platform, update *chatbots.Update) chatbots.Reply {
+	chat, trip, err := linkedChatTrip(app, platform.Name(), update.ChatId)
+	if err != nil {
+		return chatbots.Reply{Text: "This chat is not linked to a trip."}
+	}
+	if _, role := chatSender(app, platform.Name(), trip, update.SenderId); !trips.CanEdit(role) {
+		return chatbots.Reply{Text: "Only the owner or an editor of the trip can unlink this chat."}
+	}
+	if err := app.Delete(chat); err != nil {
+		app.Logger().Error("Unable to unlink chat", "error", err, "platform", platform.Name())
+		return chatbots.Reply{Text: "Something went wrong, try again."}
+	}
+	cache.Delete(chatHistoryKey(platform.Name(), update.ChatId))
+	return chatbots.Reply{Text: fmt.Sprintf("This chat is no longer linked to %s.", trip.GetString("name"))}
+}
+
+func pendingChatProposals(app core.App, platform chatbots.Platform, update *chatbots.Update) chatbots.Reply {
+	_, trip, err := linkedChatTrip(app, platform.Name(), update.ChatId)
+	if err != nil {
+		return chatbots.Reply{Text: "This chat is not linked to a trip yet, send /link with the code shown on the trip page."}
+	}
+	user, role := chatSender(app, platform.Name(), trip, update.SenderId)
+	locale := loadAssistantLocale(user)
+
+	pending := proposals.ListForTrip(trip.Id)
+	if len(pending) == 0 {
+		return chatbots.Reply{Text: "No change is waiting for approval."}
+	}
+
+	lines := []string{"Waiting for approval:"}
+	buttons := make([][]chatbots.Button, 0, len(pending))
+	for i, proposal := range pending {
+		summary := proposal.Summary
+		if !trips.CanEdit(role) {
+			summary = summarizeProposal(proposal.Tool, viewerSafeArguments(proposal.Arguments), locale)
+		}
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, summary))
+		buttons = append(buttons, proposalButtons(proposal, fmt.Sprintf(" %d", i+1)))
+	}
+	return chatbots.Reply{Text: strings.Join(lines, "\n"), Buttons: buttons}
+}
+
+func proposalButtons(proposal *proposals.Proposal, suffix string) []chatbots.Button {
+	return []chatbots.Button{
+		{Label: "Approve" + suffix, Data: "approve:" + proposal.ID},
+		{Label: "Decline" + suffix, Data: "decline:" + proposal.ID, Danger: true},
+	}
+}
+
+func askChatAssistant(app core.App, platform chatbots.Platform, update *chatbots.Update, question string) chatbots.Reply {
+	_, trip, err := linkedChatTrip(app, platform.Name(), update.ChatId)
+	if err != nil {
+		return chatbots.Reply{Text: "This chat is not linked to a trip yet, send /link with the code shown on the trip page."}
+	}
+	apiKey := strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
+	if apiKey == "" {
+		return chatbots.Reply{Text: "The assistant is not configured on this server."}
+	}
+
+	// members of the group without a linked account read the trip like a
+	// viewer would and cannot ask for changes
+	user, role := chatSender(app, platform.Name(), trip, update.SenderId)
+	userId := ""
+	if user != nil {
+		userId = user.Id
+	}
+	config := loadAssistantConfig(app)
+	if !trips.CanEdit(role) {
+		config = readOnlyAssistantConfig(config)
+	}
+	locale := loadAssistantLocale(user)
+
+	ctx, err := buildTripAssistantContext(app, trip, userId, role, config.IncludeWeather)
+	if err != nil {
+		app.Logger().Error("Chat bot build context error", "error", err, "tripId", trip.Id)
+		return chatbots.Reply{Text: "I could not load the trip, try again."}
+	}
+
+	content := question
+	if !update.Private {
+		content = fmt.Sprintf("%s: %s", update.SenderName, question)
+	}
+	historyKey := chatHistoryKey(platform.Name(), update.ChatId)
+	history, _ := cache.Get(historyKey)
+	messages, _ := history.([]assistantMessage)
+	messages = append(messages, assistantMessage{Role: "user", Content: content})
+
+	input, err := buildResponsesInput(messages, ctx, config, locale)
+	if err != nil {
+		app.Logger().Error("Chat bot failed to build input", "error", err, "tripId", trip.Id)
+		return chatbots.Reply{Text: "Something went wrong, try again."}
+	}
+	reply, err := invokeResponsesAPI(context.Background(), apiKey, input, config, "low", newLocalTools(app, trip, user, ctx, config))
+	if err != nil {
+		app.Logger().Error("Chat bot assistant call failed", "error", err, "tripId", trip.Id)
+		return chatbots.Reply{Text: "The assistant did not answer, try again in a moment."}
+	}
+	saveAssistantToolResults(app, trip.Id, uuid.NewString(), reply.ToolResults)
+
+	text := chatBotText(app, newReplyPostProcessor(trip.Id, ctx, locale).Process(reply.Text))
+	if reply.Truncated != "" {
+		text += "\n\n" + truncationMessage(reply.Truncated)
+	}
+	contextAt, _ := time.Parse(time.RFC3339, ctx.GeneratedAt)
+	buttons := make([][]chatbots.Button, 0)
+	for _, call := range reply.Calls {
+		if _, known := proposalRequiredArgs[call.Name]; !known || !trips.CanEdit(role) {
+			continue
+		}
+		proposal, ok := newAssistantProposal(call.Name, call.Arguments, trip.Id, userId, contextAt, config, locale)
+		if !ok {
+			continue
+		}
+		stored, created := proposals.StoreUnique(proposal)
+		if created {
+			proposals.RecordIssued(app, stored, userId)
+		}
+		text = strings.TrimSpace(text + "\n\nSuggested: " + stored.Summary)
+		suffix := ""
+		if len(reply.Calls) > 1 {
+			suffix = fmt.Sprintf(" %d", len(buttons)+1)
+		}
+		buttons = append(buttons, proposalButtons(stored, suffix))
+	}
+	if text == "" {
+		text = "I have nothing to add."
+	}
+
+	messages = append(messages, assistantMessage{Role: "assistant", Content: text})
+	if len(messages) > chatHistoryMessages {
+		messages = messages[len(messages)-chatHistoryMessages:]
+	}
+	cache.Set(historyKey, messages, chatHistoryTTL)
+
+	return chatbots.Reply{Text: text, Buttons: buttons}
+}
+
+var chatRecordLinkPattern = regexp.MustCompile(`\[([^\]]+)\]\((/[^)\s]+)\)`)
+
+// chatBotText writes the links to records of the trip out in full, chats do
+// not know where the instance is
+func chatBotText(app core.App, text string) string {
+	appURL := strings.TrimSuffix(app.Settings().Meta.AppURL, "/")
+	return chatRecordLinkPattern.ReplaceAllString(text, "$1 ("+appURL+"$2)")
+}
+
+// decideChatProposal approves or declines the proposal a button was pressed
+// for. clear is set when the proposal is no longer pending, so its buttons
+// can go.
+func decideChatProposal(app core.App, platform chatbots.Platform, update *chatbots.Update) (chatbots.Reply, bool) {
+	decision, proposalId, _ := strings.Cut(update.Data, ":")
+	if decision != "approve" && decision != "decline" {
+		return chatbots.Reply{Text: "I do not know that button."}, true
+	}
+
+	_, trip, err := linkedChatTrip(app, platform.Name(), update.ChatId)
+	if err != nil {
+		return chatbots.Reply{Text: "This chat is no longer linked to a trip."}, true
+	}
+
+	proposal, ok := proposals.Get(proposalId)
+	if !ok || proposal.TripID != trip.Id {
+		if outcome, decided := proposals.DecidedOutcome(proposalId); decided && outcome.TripID == trip.Id {
+			return chatbots.Reply{Text: fmt.Sprintf("That change was already %s.", outcome.Status)}, true
+		}
+		return chatbots.Reply{Text: "That change expired, ask again if you still want it."}, true
+	}
+	if proposal.Expired() {
+		proposals.Pop(proposalId)
+		proposals.RecordDecision(app, proposal, proposals.StatusTimeout, "", "", "")
+		return chatbots.Reply{Text: "That change expired, ask again if you still want it."}, true
+	}
+
+	user, role := chatSender(app, platform.Name(), trip, update.SenderId)
+	if user == nil {
+		return chatbots.Reply{Text: fmt.Sprintf("%s, link your account first: make a code on the trip page and send /link with it.", update.SenderName)}, false
+	}
+	if _, message := proposalDecisionRefusal(role, user.Id, proposal, decision); message != "" {
+		return chatbots.Reply{Text: fmt.Sprintf("%s, %s.", update.SenderName, message)}, false
+	}
+
+	if decision == "decline" {
+		proposals.Decide(proposalId, proposals.StatusDeclined, "")
+		proposals.RecordDecision(app, proposal, proposals.StatusDeclined, user.Id, "", "")
+		return chatbots.Reply{Text: fmt.Sprintf("%s declined: %s", update.SenderName, proposal.Summary)}, true
+	}
+
+	message, err := approveAssistantProposal(app, trip, proposal, user.Id)
+	_, pending := proposals.Get(proposalId)
+	if errors.Is(err, errProposalBeingApplied) {
+		return chatbots.Reply{Text: "That change is already being applied."}, false
+	}
+	var staleErr *staleProposalError
+	if errors.As(err, &staleErr) {
+		return chatbots.Reply{Text: "The trip changed after I suggested that, ask me again so I work from the latest plans."}, !pending
+	}
+	if err != nil {
+		return chatbots.Reply{Text: fmt.Sprintf("I could not apply that change: %s", err.Error())}, !pending
+	}
+	return chatbots.Reply{Text: fmt.Sprintf("%s approved: %s", update.SenderName, message)}, true
+}
+
+func findBotChat(app core.App, platform string, chatId string) (*core.Record, error) {
+	return app.FindFirstRecordByFilter("bot_chats", "platform = {:platform} && chatId = {:chatId}",
+		dbx.Params{"platform": platform, "chatId": chatId})
+}
+
+// linkedChatTrip finds the chat and the trip it is linked to
+func linkedChatTrip(app core.App, platform string, chatId string) (*core.Record, *core.Record, error) {
+	chat, err := findBotChat(app, platform, chatId)
+	if err != nil {
+		return nil, nil, err
+	}
+	trip, err := app.FindRecordById("trips", chat.GetString("trip"))
+	if err != nil {
+		return nil, nil, err
+	}
+	return chat, trip, nil
+}
+
+// chatSender finds the Surmai user behind a chat account and their role on
+// the trip. Anyone else in a linked chat sees the trip like a viewer.
+func chatSender(app core.App, platform string, trip *core.Record, externalId string) (*core.Record, string) {
+	account, err := app.FindFirstRecordByFilter("bot_accounts", "platform = {:platform} && externalId = {:externalId}",
+		dbx.Params{"platform": platform, "externalId": externalId})
+	if err != nil {
+		return nil, trips.RoleViewer
+	}
+	user, err := app.FindRecordById("users", account.GetString("user"))
+	if err != nil {
+		return nil, trips.RoleViewer
+	}
+	role := trips.TripRole(trip, user.Id)
+	if role == "" {
+		return nil, trips.RoleViewer
+	}
+	return user, role
+}
+
+// CreateChatLinkCode makes a code the member sends to the bot. It links
+// their chat account and, for members who can edit, the chat to the trip.
+func CreateChatLinkCode(e *core.RequestEvent) error {
+	if telegramBot == nil && discordBot == nil {
+		return e.JSON(http.StatusServiceUnavailable, map[string]string{"error": "no chat bot is configured"})
+	}
+	trip := e.Get("trip").(*core.Record)
+
+	code := security.RandomStringWithAlphabet(8, chatLinkCodeAlphabet)
+	cache.Set(chatLinkKey(code), chatLinkCode{UserId: e.Auth.Id, TripId: trip.Id}, chatLinkCodeTTL)
+
+	return e.JSON(http.StatusCreated, map[string]interface{}{
+		"code":      code,
+		"command":   "/link " + code,
+		"expiresAt": time.Now().UTC().Add(chatLinkCodeTTL).Format(time.RFC3339),
+		"platforms": chatBotPlatforms(),
+	})
+}
+
+func chatBotPlatforms() map[string]interface{} {
+	platforms := map[string]interface{}{}
+	if telegramBot != nil {
+		platforms[chatbots.PlatformTelegram] = map[string]string{"username": telegramBot.Username}
+	}
+	if discordBot != nil {
+		platforms[chatbots.PlatformDiscord] = map[string]string{"applicationId": discordBot.ApplicationId}
+	}
+	return platforms
+}
+
+// ListTripChats lists the chats linked to the trip
+func ListTripChats(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	chats, err := e.App.FindRecordsByFilter("bot_chats", "trip = {:trip}", "-created", 0, 0, dbx.Params{"trip": trip.Id})
+	if err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"chats":     chats,
+		"platforms": chatBotPlatforms(),
+	})
+}
+
+// UnlinkTripChat stops a chat from talking about the trip
+func UnlinkTripChat(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	chat, err := e.App.FindFirstRecordByFilter("bot_chats", "id = {:id} && trip = {:trip}",
+		dbx.Params{"id": e.Request.PathValue("chatId"), "trip": trip.Id})
+	if err != nil {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "chat not found"})
+	}
+	if err := e.App.Delete(chat); err != nil {
+		return err
+	}
+	cache.Delete(chatHistoryKey(chat.GetString("platform"), chat.GetString("chatId")))
+	return e.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,208 @@
+package routes
+
+import (
+	"backend/gallery"
+	"backend/trips"
+	bt "backend/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Sharing templates with other instances is off unless SURMAI_GALLERY_URL
+// points at a community gallery, with SURMAI_GALLERY_API_KEY when it needs
+// one. Only anonymized templates of finished trips are published, and
+// templates taken from the gallery are kept as templates of the user.
+
+const maxGalleryTags = 10
+
+// galleryClient returns the community gallery, or nil when the deployment
+// did not opt in
+func galleryClient() *gallery.Gallery {
+	url := strings.TrimSpace(os.Getenv("SURMAI_GALLERY_URL"))
+	if url == "" {
+		return nil
+	}
+	return &gallery.Gallery{URL: url, ApiKey: os.Getenv("SURMAI_GALLERY_API_KEY")}
+}
+
+// PublishTripToGallery submits an anonymized template of a finished trip to
+// the community gallery. Only the owner can publish it.
+func PublishTripToGallery(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	client := galleryClient()
+	if client == nil {
+		return e.JSON(http.StatusServiceUnavailable, map[string]string{"error": "the community gallery is turned off"})
+	}
+	if requestTripRole(e) != trips.RoleOwner {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "only the owner can publish the trip"})
+	}
+	if end := trip.GetDateTime("endDate"); end.IsZero() || end.Time().After(time.Now().UTC()) {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "only finished trips can be published"})
+	}
+
+	var req struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Tags        []string `json:"tags"`
+	}
+	if e.Request.ContentLength != 0 {
+		if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		}
+	}
+	tags := galleryTags(req.Tags)
+	if len(tags) > maxGalleryTags {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("a template can have up to %d tags", maxGalleryTags)})
+	}
+
+	// the name and description of the trip may be personal, only what the
+	// owner wrote for the gallery is sent
+	template := trips.CommunityTemplate(e.App, trip)
+	template.Name = strings.TrimSpace(req.Name)
+	if template.Name == "" {
+		template.Name = galleryTemplateName(template)
+	}
+	template.Description = strings.TrimSpace(req.Description)
+
+	listing, err := client.Publish(&gallery.Submission{
+		Name:        template.Name,
+		Description: template.Description,
+		Tags:        tags,
+		Template:    template,
+	})
+	if err != nil {
+		e.App.Logger().Warn("Could not publish to the community gallery", "error", err, "tripId", trip.Id)
+		return e.JSON(http.StatusBadGateway, map[string]string{"error": "the community gallery is not available"})
+	}
+
+	return e.JSON(http.StatusCreated, listing)
+}
+
+// BrowseGallery lists the templates of the community gallery matching q
+func BrowseGallery(e *core.RequestEvent) error {
+	client := galleryClient()
+	if client == nil {
+		return e.JSON(http.StatusServiceUnavailable, map[string]string{"error": "the community gallery is turned off"})
+	}
+
+	query := e.Request.URL.Query()
+	page := 1
+	if value := query.Get("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "page must be a positive number"})
+		}
+		page = parsed
+	}
+
+	listings, err := client.Browse(query.Get("q"), page)
+	if err != nil {
+		e.App.Logger().Warn("Could not browse the community gallery", "error", err)
+		return e.JSON(http.StatusBadGateway, map[string]string{"error": "the community gallery is not available"})
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{"items": listings, "page": page})
+}
+
+// GetGalleryTemplate shows a template of the community gallery with its
+// plans, before it is imported
+func GetGalleryTemplate(e *core.RequestEvent) error {
+	client := galleryClient()
+	if client == nil {
+		return e.JSON(http.StatusServiceUnavailable, map[string]string{"error": "the community gallery is turned off"})
+	}
+
+	entry, err := fetchGalleryEntry(e, client)
+	if entry == nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, entry)
+}
+
+// ImportGalleryTemplate keeps a template of the community gallery as a
+// template of the user, to start trips from like their own
+func ImportGalleryTemplate(e *core.RequestEvent) error {
+	client := galleryClient()
+	if client == nil {
+		return e.JSON(http.StatusServiceUnavailable, map[string]string{"error": "the community gallery is turned off"})
+	}
+
+	entry, err := fetchGalleryEntry(e, client)
+	if entry == nil {
+		return err
+	}
+	template := entry.Template
+	if template.Name == "" {
+		template.Name = entry.Name
+	}
+	if template.Name == "" {
+		template.Name = galleryTemplateName(template)
+	}
+
+	collection, err := e.App.FindCollectionByNameOrId("trip_templates")
+	if err != nil {
+		return err
+	}
+	record := core.NewRecord(collection)
+	record.Set("name", template.Name)
+	record.Set("ownerId", e.Auth.Id)
+	record.Set("galleryId", entry.Id)
+	record.Set("days", max(template.Days, 1))
+	record.Set("template", template)
+	if err := e.App.Save(record); err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusCreated, record)
+}
+
+// fetchGalleryEntry returns the template of the listingId path value, or
+// nil once the error response is written
+func fetchGalleryEntry(e *core.RequestEvent, client *gallery.Gallery) (*gallery.Entry, error) {
+	entry, err := client.Fetch(e.Request.PathValue("listingId"))
+	if errors.Is(err, gallery.ErrNotFound) {
+		return nil, e.JSON(http.StatusNotFound, map[string]string{"error": "template not found"})
+	}
+	if err != nil {
+		e.App.Logger().Warn("Could not fetch a community gallery template", "error", err)
+		return nil, e.JSON(http.StatusBadGateway, map[string]string{"error": "the community gallery is not available"})
+	}
+	return entry, nil
+}
+
+// galleryTags trims and lower cases the tags, dropping empty and repeated
+// ones
+func galleryTags(values []string) []string {
+	tags := make([]string, 0, len(values))
+	seen := map[string]bool{}
+	for _, value := range values {
+		tag := strings.ToLower(strings.TrimSpace(value))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// galleryTemplateName names a template by its length and first destination
+func galleryTemplateName(template *bt.TripTemplate) string {
+	days := max(template.Days, 1)
+	unit := "days"
+	if days == 1 {
+		unit = "day"
+	}
+	if len(template.Destinations) > 0 && template.Destinations[0].Name != "" {
+		return fmt.Sprintf("%d %s in %s", days, unit, template.Destinations[0].Name)
+	}
+	return fmt.Sprintf("%d %s trip", days, unit)
+}
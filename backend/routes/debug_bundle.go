@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"backend/trips"
+	"backend/types"
+	"bytes"
+	"encoding/base64"
+	"github.com/pocketbase/pocketbase/core"
+	"net/http"
+)
+
+func DebugBundle(e *core.RequestEvent, version types.VersionInfo) error {
+	trip := e.Get("trip").(*core.Record)
+
+	if trip.GetString("ownerId") != e.Auth.Id {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "only the trip owner can create a debug bundle"})
+	}
+
+	var bundle bytes.Buffer
+	if err := trips.WriteDebugBundle(e.App, trip, version, &bundle); err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, map[string]string{
+		"data": base64.StdEncoding.EncodeToString(bundle.Bytes()),
+	})
+}
@@ -0,0 +1,164 @@
+package routes
+
+import (
+	"backend/entry"
+	"backend/entry/remote"
+	"backend/entry/table"
+	"backend/tripcontext"
+	"backend/trips"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Entry requirements come from the service at SURMAI_ENTRY_REQUIREMENTS_URL
+// when it is set, with SURMAI_ENTRY_REQUIREMENTS_API_KEY, and otherwise from
+// the rules the admin keeps in the entry_requirements setting. Travelers
+// are matched by the nationality saved with each participant of the trip.
+
+// entryProvider returns the source of the entry requirements
+func entryProvider(app core.App) entry.DataProvider {
+	if url := strings.TrimSpace(os.Getenv("SURMAI_ENTRY_REQUIREMENTS_URL")); url != "" {
+		return remote.Remote{URL: url, ApiKey: os.Getenv("SURMAI_ENTRY_REQUIREMENTS_API_KEY")}
+	}
+	return table.Table{Rules: loadEntryRules(app)}
+}
+
+// entryCountry resolves a country name or code with the places dataset, the
+// value is kept as the name when the dataset does not know it
+func entryCountry(app core.App, value string) entry.Country {
+	value = strings.TrimSpace(value)
+	country := struct {
+		Code string `db:"countryCode"`
+		Name string `db:"countryName"`
+	}{}
+	err := app.DB().
+		Select("countryCode", "countryName").
+		From("places").
+		Where(dbx.NewExp("lower(countryName) = {:value} OR lower(countryCode) = {:value}", dbx.Params{"value": strings.ToLower(value)})).
+		Limit(1).
+		One(&country)
+	if err != nil || country.Name == "" {
+		return entry.Country{Name: value}
+	}
+	return entry.Country{Code: strings.ToUpper(country.Code), Name: country.Name}
+}
+
+// tripEntryRequirements looks up the requirements of the destinations for
+// the participants with a nationality, and names the ones without
+func tripEntryRequirements(app core.App, ctx *tripcontext.Context) ([]entry.Summary, []string, error) {
+	travelers := make([]entry.Traveler, 0)
+	missing := make([]string, 0)
+	for _, participant := range ctx.Participants {
+		if strings.TrimSpace(participant.Nationality) == "" {
+			missing = append(missing, participant.Name)
+			continue
+		}
+		travelers = append(travelers, entry.Traveler{Name: participant.Name, Nationality: entryCountry(app, participant.Nationality)})
+	}
+
+	destinations := make([]entry.Country, 0)
+	for _, destination := range ctx.Destinations {
+		if strings.TrimSpace(destination.Country) != "" {
+			destinations = append(destinations, entryCountry(app, destination.Country))
+		}
+	}
+
+	summaries, err := entry.ForTrip(entryProvider(app), travelers, destinations)
+	return summaries, missing, err
+}
+
+// TripEntryRequirements lists the visa, passport validity and vaccination
+// requirements of the destinations for each nationality of the travelers
+func TripEntryRequirements(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	ctx, err := tripcontext.Build(e.App, trip, trips.SeesPrivate(requestTripRole(e)))
+	if err != nil {
+		return err
+	}
+
+	requirements, missing, err := tripEntryRequirements(e.App, ctx)
+	if err != nil {
+		e.App.Logger().Warn("Could not look up entry requirements", "error", err, "tripId", trip.Id)
+		return e.JSON(http.StatusBadGateway, map[string]string{"error": "the entry requirements are not available"})
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"requirements":       requirements,
+		"missingNationality": missing,
+	})
+}
+
+// loadEntryRules reads the rules of the entry_requirements setting
+func loadEntryRules(app core.App) []entry.Requirement {
+	record, err := app.FindRecordById("surmai_settings", "entry_requirements")
+	if err != nil {
+		return nil
+	}
+	var value struct {
+		Rules []entry.Requirement `json:"rules"`
+	}
+	_ = json.Unmarshal([]byte(record.GetString("value")), &value)
+	return value.Rules
+}
+
+func GetEntryRequirements(e *core.RequestEvent) error {
+	rules := loadEntryRules(e.App)
+	if rules == nil {
+		rules = []entry.Requirement{}
+	}
+	return e.JSON(http.StatusOK, map[string]interface{}{"rules": rules})
+}
+
+// UpdateEntryRequirements replaces the rules. They are only used when no
+// entry requirements service is configured.
+func UpdateEntryRequirements(e *core.RequestEvent) error {
+	var body struct {
+		Rules []entry.Requirement `json:"rules"`
+	}
+	if err := json.NewDecoder(e.Request.Body).Decode(&body); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid entry requirements"})
+	}
+	for i, rule := range body.Rules {
+		if strings.TrimSpace(rule.Nationality) == "" || strings.TrimSpace(rule.Destination) == "" {
+			return e.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("rule %d needs a nationality, or *, and a destination", i+1),
+			})
+		}
+		if !entry.IsVisaKind(rule.Visa) {
+			return e.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("the visa of rule %d must be one of %s", i+1, strings.Join(entry.VisaKinds, ", ")),
+			})
+		}
+		if rule.MaxStayDays < 0 || rule.PassportValidityMonths < 0 {
+			return e.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("the stay and passport validity of rule %d cannot be negative", i+1),
+			})
+		}
+	}
+	if body.Rules == nil {
+		body.Rules = []entry.Requirement{}
+	}
+
+	collection, err := e.App.FindCollectionByNameOrId("surmai_settings")
+	if err != nil {
+		return err
+	}
+	record, err := e.App.FindRecordById("surmai_settings", "entry_requirements")
+	if err != nil {
+		record = core.NewRecord(collection)
+		record.Set("id", "entry_requirements")
+	}
+	record.Set("value", body)
+	if err := e.App.Save(record); err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{"rules": body.Rules})
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"backend/trips"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// RentalConflicts lists rented equipment that would still be out when the
+// travelers leave
+func RentalConflicts(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	return e.JSON(http.StatusOK, trips.RentalConflicts(e.App, trip))
+}
@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"backend/currency"
+	"backend/trips"
+	bt "backend/types"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// RerateExpense corrects the exchange rate locked on an expense. A positive
+// rate in the body ({"rate": 0.92}) is kept as given, for example the rate
+// on the card statement, otherwise the rate of the day is locked again.
+func RerateExpense(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	if !trips.CanEdit(requestTripRole(e)) {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "viewers cannot change expenses"})
+	}
+
+	record, err := ensureTripRecord(e.App, "trip_expenses", e.Request.PathValue("expenseId"), trip.Id)
+	if err != nil {
+		return e.NotFoundError("Expense not found", err)
+	}
+
+	var body struct {
+		Rate float64 `json:"rate"`
+	}
+	if e.Request.ContentLength != 0 {
+		if err := json.NewDecoder(e.Request.Body).Decode(&body); err != nil || body.Rate < 0 {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "rate must be a positive number"})
+		}
+	}
+
+	if body.Rate > 0 {
+		var budget, cost bt.Cost
+		_ = trip.UnmarshalJSONField("budget", &budget)
+		_ = record.UnmarshalJSONField("cost", &cost)
+		if budget.Currency == "" || cost.Currency == "" || cost.Currency == budget.Currency {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "only expenses in another currency than the trip budget have a rate"})
+		}
+		record.Set("exchangeRate", &bt.ExchangeRate{
+			From:      cost.Currency,
+			To:        budget.Currency,
+			Rate:      body.Rate,
+			Converted: currency.Round(cost.Value*body.Rate, budget.Currency),
+			Manual:    true,
+		})
+	} else if err := trips.LockExchangeRate(e.App, record); err != nil {
+		return err
+	}
+
+	if err := e.App.Save(record); err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, expenseRatePayload(trip, record, currency.LoadRates(e.App)))
+}
+
+// RerateTripExpenses locks the rates of all the expenses of the trip again,
+// after the budget currency changed. Rates corrected by hand are kept unless
+// they are for another currency.
+func RerateTripExpenses(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	if !trips.CanEdit(requestTripRole(e)) {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "viewers cannot change expenses"})
+	}
+
+	var budget bt.Cost
+	_ = trip.UnmarshalJSONField("budget", &budget)
+
+	records, err := e.App.FindAllRecords("trip_expenses", dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+	if err != nil {
+		return err
+	}
+
+	rates := currency.LoadRates(e.App)
+	expenses := make([]map[string]interface{}, 0, len(records))
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		for _, record := range records {
+			var locked *bt.ExchangeRate
+			_ = record.UnmarshalJSONField("exchangeRate", &locked)
+			if locked == nil || !locked.Manual || locked.To != budget.Currency {
+				if err := trips.LockExchangeRate(txApp, record); err != nil {
+					return err
+				}
+				if err := txApp.Save(record); err != nil {
+					return err
+				}
+			}
+			expenses = append(expenses, expenseRatePayload(trip, record, rates))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{"expenses": expenses})
+}
+
+// expenseRatePayload shows the expense in its own currency and in the
+// currency of the budget
+func expenseRatePayload(trip *core.Record, record *core.Record, rates map[string]float64) map[string]interface{} {
+	var budget bt.Cost
+	_ = trip.UnmarshalJSONField("budget", &budget)
+	var cost *bt.Cost
+	_ = record.UnmarshalJSONField("cost", &cost)
+	var locked *bt.ExchangeRate
+	_ = record.UnmarshalJSONField("exchangeRate", &locked)
+
+	payload := map[string]interface{}{
+		"expenseId":    record.Id,
+		"cost":         cost,
+		"exchangeRate": locked,
+	}
+	if converted, ok := trips.ConvertCost(cost, locked, budget.Currency, rates); ok {
+		payload["converted"] = converted
+	}
+	return payload
+}
@@ -0,0 +1,254 @@
+package routes
+
+import (
+	"backend/ingest"
+	"backend/trips"
+	bt "backend/types"
+	"backend/validation"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const maxReceiptBytes = 5 << 20
+
+const receiptPrompt = "Read the receipt. merchant is the name of the shop, restaurant or company, total is the amount paid including taxes and tip as a number, currency is the ISO 4217 code of the amount, date is the day of the purchase as 2006-01-02 and category the kind of expense. Leave fields empty, and total 0, when the receipt does not show them."
+
+// expenseCategories are the categories an expense can have in the app
+var expenseCategories = []string{"lodging", "transportation", "food", "entertainment", "shopping", "activities", "healthcare", "communication", "insurance", "visa_fees", "souvenirs", "tips", "other"}
+
+// ScanExpenseReceipt reads the merchant, total, currency and day of a receipt
+// uploaded as "receipt", a photo or a PDF, and keeps the file as an attachment
+// of the trip. Without an expense the reply is a draft for the user to check
+// and save; an existing expense gets the attachment and the fields it is
+// missing. Receipts that cannot be read still leave the attachment.
+func ScanExpenseReceipt(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	if !trips.CanEdit(requestTripRole(e)) {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "viewers cannot change expenses"})
+	}
+
+	var expense *core.Record
+	if expenseId := e.Request.PathValue("expenseId"); expenseId != "" {
+		record, err := ensureTripRecord(e.App, "trip_expenses", expenseId, trip.Id)
+		if err != nil {
+			return e.NotFoundError("Expense not found", err)
+		}
+		expense = record
+	}
+
+	file, header, err := e.Request.FormFile("receipt")
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "receipt file is required"})
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxReceiptBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxReceiptBytes {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "the receipt must be smaller than 5 MB"})
+	}
+	mimeType := http.DetectContentType(data)
+	if !assistantImageTypes[mimeType] && mimeType != "application/pdf" {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "the receipt must be a PNG, JPEG, WebP or GIF photo or a PDF"})
+	}
+
+	warnings := make([]string, 0)
+	receipt, err := readReceipt(e.Request.Context(), loadAssistantConfig(e.App), data, mimeType)
+	if err != nil {
+		if !errors.Is(err, ingest.ErrNoReceipt) {
+			e.App.Logger().Warn("unable to read receipt", "trip", trip.Id, "error", err)
+		}
+		receipt = nil
+		warnings = append(warnings, "the receipt could not be read, fill in the expense by hand")
+	}
+	draft := receiptExpense(receipt)
+
+	var attachment *core.Record
+	updated := make([]string, 0)
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		attachment, err = saveTripAttachmentFile(txApp, trip.Id, header.Filename, data)
+		if err != nil {
+			return err
+		}
+		if expense == nil {
+			return nil
+		}
+		updated, warnings = applyReceipt(expense, draft, warnings)
+		expense.Set("attachmentReferences", append(expense.GetStringSlice("attachmentReferences"), attachment.Id))
+		return txApp.Save(expense)
+	})
+	if fields := validation.FieldErrors(err); len(fields) > 0 {
+		return e.JSON(http.StatusUnprocessableEntity, map[string]any{
+			"error":  "the receipt could not be saved on the expense",
+			"fields": fields,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	if expense != nil {
+		return e.JSON(http.StatusOK, map[string]any{
+			"expense":  expense,
+			"receipt":  receipt,
+			"updated":  updated,
+			"warnings": warnings,
+		})
+	}
+	draft["trip"] = trip.Id
+	draft["attachmentReferences"] = []string{attachment.Id}
+	return e.JSON(http.StatusOK, map[string]any{
+		"draft":    draft,
+		"receipt":  receipt,
+		"warnings": warnings,
+	})
+}
+
+// readReceipt reads the text of PDFs first, photos and PDFs without a total
+// in their text are read by the assistant
+func readReceipt(ctx context.Context, config assistantConfig, data []byte, mimeType string) (*ingest.Receipt, error) {
+	if mimeType == "application/pdf" {
+		if receipt, ok := ingest.ParseReceiptText(ingest.PDFText(data)); ok {
+			return receipt, nil
+		}
+		return extractReceiptWithAssistant(ctx, config, map[string]string{
+			"type":      "input_file",
+			"filename":  "receipt.pdf",
+			"file_data": "data:application/pdf;base64," + base64.StdEncoding.EncodeToString(data),
+		})
+	}
+	return extractReceiptWithAssistant(ctx, config, map[string]string{
+		"type":      "input_image",
+		"image_url": fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data)),
+	})
+}
+
+// extractReceiptWithAssistant sends the receipt to the model, which reads
+// photos of paper receipts as well as it reads their text
+func extractReceiptWithAssistant(ctx context.Context, config assistantConfig, content map[string]string) (*ingest.Receipt, error) {
+	apiKey := strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
+	if apiKey == "" {
+		return nil, ingest.ErrNoReceipt
+	}
+
+	properties := map[string]interface{}{
+		"merchant": map[string]interface{}{"type": "string"},
+		"total":    map[string]interface{}{"type": "number"},
+		"currency": map[string]interface{}{"type": "string"},
+		"date":     map[string]interface{}{"type": "string"},
+		"category": map[string]interface{}{"type": "string", "enum": append(slices.Clone(expenseCategories), "")},
+	}
+	payload := map[string]interface{}{
+		"model": config.Model,
+		"input": []map[string]interface{}{
+			newResponsesTextBlock("developer", receiptPrompt),
+			{
+				"role":    "user",
+				"content": []map[string]string{content},
+			},
+		},
+		"reasoning": map[string]string{"effort": "low"},
+		"text": map[string]interface{}{
+			"format": map[string]interface{}{
+				"type":   "json_schema",
+				"name":   "receipt",
+				"strict": true,
+				"schema": map[string]interface{}{
+					"type":                 "object",
+					"properties":           properties,
+					"required":             []string{"merchant", "total", "currency", "date", "category"},
+					"additionalProperties": false,
+				},
+			},
+		},
+	}
+
+	response, err := postResponsesAPI(ctx, apiKey, payload, config.RequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimSpace(strings.Join(response.OutputText, ""))
+	if text == "" {
+		text = extractFallbackOutput(*response)
+	}
+
+	var receipt ingest.Receipt
+	if err := json.Unmarshal([]byte(text), &receipt); err != nil {
+		return nil, err
+	}
+	if receipt.Total <= 0 && receipt.Merchant == "" {
+		return nil, ingest.ErrNoReceipt
+	}
+	return &receipt, nil
+}
+
+// receiptExpense is the expense the receipt describes, the fields it does
+// not show are left out. Amounts that are not a usable cost are dropped.
+func receiptExpense(receipt *ingest.Receipt) map[string]any {
+	draft := map[string]any{}
+	if receipt == nil {
+		return draft
+	}
+	if name := strings.TrimSpace(receipt.Merchant); name != "" {
+		draft["name"] = name
+	}
+	if code, err := validation.NormalizeCost(receipt.Total, receipt.Currency); err == nil && receipt.Total > 0 {
+		draft["cost"] = bt.Cost{Value: receipt.Total, Currency: code}
+	}
+	if day, err := time.Parse(time.DateOnly, receipt.Date); err == nil {
+		occurredOn, _ := types.ParseDateTime(day)
+		draft["occurredOn"] = occurredOn
+	}
+	if slices.Contains(expenseCategories, receipt.Category) {
+		draft["category"] = receipt.Category
+	}
+	return draft
+}
+
+// applyReceipt fills in the fields the expense is missing from the receipt
+// and returns their names. Fields already set are kept, a different total or
+// currency is only warned about.
+func applyReceipt(expense *core.Record, draft map[string]any, warnings []string) ([]string, []string) {
+	updated := make([]string, 0)
+
+	if cost, ok := draft["cost"].(bt.Cost); ok {
+		var current *bt.Cost
+		_ = expense.UnmarshalJSONField("cost", &current)
+		switch {
+		case current == nil || current.Value == 0:
+			expense.Set("cost", cost)
+			updated = append(updated, "cost")
+		case !strings.EqualFold(current.Currency, cost.Currency) || math.Abs(current.Value-cost.Value) > 0.005:
+			warnings = append(warnings, fmt.Sprintf("the receipt is for %g %s, the expense is %g %s", cost.Value, cost.Currency, current.Value, current.Currency))
+		}
+	}
+	if occurredOn, ok := draft["occurredOn"].(types.DateTime); ok && expense.GetDateTime("occurredOn").IsZero() {
+		expense.Set("occurredOn", occurredOn)
+		updated = append(updated, "occurredOn")
+	}
+	if category, ok := draft["category"].(string); ok && expense.GetString("category") == "" {
+		expense.Set("category", category)
+		updated = append(updated, "category")
+	}
+	if name, ok := draft["name"].(string); ok && strings.TrimSpace(expense.GetString("name")) == "" {
+		expense.Set("name", name)
+		updated = append(updated, "name")
+	}
+	return updated, warnings
+}
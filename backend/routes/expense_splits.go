@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"backend/trips"
+	bt "backend/types"
+	"backend/validation"
+	"net/http"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ExpenseBalances returns what each participant paid for the expenses and
+// itinerary items of the trip, what their parts came to and the difference,
+// in ?currency or the currency of the budget
+func ExpenseBalances(e *core.RequestEvent) error {
+	balances, problem := tripExpenseBalances(e)
+	if problem != "" {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": problem})
+	}
+	return e.JSON(http.StatusOK, balances)
+}
+
+// ExpenseSettleUp returns the payments that even out the balances of the
+// participants, Splitwise style, without the balances themselves
+func ExpenseSettleUp(e *core.RequestEvent) error {
+	balances, problem := tripExpenseBalances(e)
+	if problem != "" {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": problem})
+	}
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"currency":    balances.Currency,
+		"settlements": balances.Settlements,
+		"skipped":     balances.Skipped,
+	})
+}
+
+// tripExpenseBalances works out the balances in the currency asked for,
+// the one of the budget, or the one all expenses are in when the trip has
+// no budget. Otherwise it returns what is wrong with the request.
+func tripExpenseBalances(e *core.RequestEvent) (*bt.ExpenseBalances, string) {
+	trip := e.Get("trip").(*core.Record)
+
+	target, err := validation.NormalizeCost(1, e.Request.URL.Query().Get("currency"))
+	if target != "" && err != nil {
+		return nil, err.Error()
+	}
+	if target == "" {
+		var budget bt.Cost
+		_ = trip.UnmarshalJSONField("budget", &budget)
+		target = strings.ToUpper(budget.Currency)
+	}
+	if target == "" {
+		target = singleExpenseCurrency(e.App, trip)
+	}
+	if target == "" {
+		return nil, "the expenses are in several currencies, set a budget currency or pass ?currency"
+	}
+
+	balances := trips.ExpenseBalances(e.App, trip, requestTripRole(e), target)
+	return &balances, ""
+}
+
+// singleExpenseCurrency is the currency of the shared costs, the expenses
+// and items that say who paid them, when they all share one, empty otherwise
+func singleExpenseCurrency(app core.App, trip *core.Record) string {
+	records := make([]*core.Record, 0)
+	for _, collection := range trips.SplitCollections {
+		found, err := app.FindAllRecords(collection, dbx.HashExp{"trip": trip.Id})
+		if err != nil {
+			return ""
+		}
+		records = append(records, found...)
+	}
+	found := ""
+	for _, record := range records {
+		if record.GetString("paidBy") == "" {
+			continue
+		}
+		var cost *bt.Cost
+		_ = record.UnmarshalJSONField("cost", &cost)
+		if cost == nil || cost.Value <= 0 {
+			continue
+		}
+		code := strings.ToUpper(cost.Currency)
+		if found != "" && code != found {
+			return ""
+		}
+		found = code
+	}
+	return found
+}
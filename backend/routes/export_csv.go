@@ -0,0 +1,57 @@
+package routes
+
+import (
+	"backend/trips"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ExportTripCSV serves the activities, lodgings, transportations or expenses
+// of a trip as a CSV file for spreadsheets. The optional columns parameter is
+// a comma separated list, from and to are inclusive dates (2006-01-02).
+func ExportTripCSV(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	query := e.Request.URL.Query()
+
+	export := trips.CSVExport{Kind: e.Request.PathValue("kind")}
+	for _, column := range strings.Split(query.Get("columns"), ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			export.Columns = append(export.Columns, column)
+		}
+	}
+
+	var err error
+	if export.From, err = parseCSVDate(query.Get("from")); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "from must be a date like 2006-01-02"})
+	}
+	if export.To, err = parseCSVDate(query.Get("to")); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "to must be a date like 2006-01-02"})
+	}
+	if !export.From.IsZero() && !export.To.IsZero() && export.To.Before(export.From) {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "to must not be before from"})
+	}
+
+	var out bytes.Buffer
+	if err := trips.WriteTripCSV(e.App, trip, requestTripRole(e), export, &out); err != nil {
+		if errors.Is(err, trips.ErrUnknownCSVKind) {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	e.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-%s.csv\"", trip.Id, export.Kind))
+	return e.Blob(http.StatusOK, "text/csv; charset=utf-8", out.Bytes())
+}
+
+func parseCSVDate(value string) (time.Time, error) {
+	if strings.TrimSpace(value) == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.DateOnly, strings.TrimSpace(value))
+}
@@ -18,7 +18,7 @@ func ExportTrip(e *core.RequestEvent) error {
 	}
 	defer tripExport.Close()
 
-	err = trips.ExportTripArchive(e.App, trip, tripExport)
+	err = trips.ExportTripArchive(e.App, trip, requestTripRole(e), tripExport)
 	if err != nil {
 		return err
 	}
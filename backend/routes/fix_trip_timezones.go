@@ -0,0 +1,43 @@
+package routes
+
+import (
+	"backend/trips"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/ringsaturn/tzf"
+)
+
+// FixTripTimezones derives the timezones of a trip's places again and, with
+// shiftTimes, converts times stored as UTC instants to local wall clock time.
+// It is a dry run that only lists the changes unless dryRun is false.
+func FixTripTimezones(e *core.RequestEvent, finder tzf.F) error {
+
+	info, err := e.RequestInfo()
+	if err != nil {
+		return err
+	}
+
+	tripId, _ := info.Body["tripId"].(string)
+	if tripId == "" {
+		return e.BadRequestError("tripId is required", nil)
+	}
+	trip, err := e.App.FindRecordById("trips", tripId)
+	if err != nil {
+		return e.NotFoundError("Trip not found", err)
+	}
+
+	// only save when explicitly asked to
+	dryRun := true
+	if val, ok := info.Body["dryRun"].(bool); ok {
+		dryRun = val
+	}
+	shiftTimes, _ := info.Body["shiftTimes"].(bool)
+
+	report, err := trips.FixTimezones(e.App, finder, trip, shiftTimes, dryRun)
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, report)
+}
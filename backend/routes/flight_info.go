@@ -4,8 +4,8 @@ import (
 	"backend/cache"
 	"backend/flights"
 	"backend/flights/adsdb"
+	"backend/flights/aerodatabox"
 	"backend/flights/flightaware"
-	"encoding/json"
 	"fmt"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/ringsaturn/tzf"
@@ -25,19 +25,8 @@ func GetFlightRoute(e *core.RequestEvent, finder tzf.F) error {
 		}
 	}
 
-	configRecord, configError := e.App.FindRecordById("surmai_settings", "flight_info_provider")
-	if configError != nil {
-		return e.JSON(http.StatusNotFound, "")
-	}
-
-	valueJson := configRecord.GetString("value")
-	var config flights.FlightInfoProviderConfig
-	configError = json.Unmarshal([]byte(valueJson), &config)
-	if configError != nil {
-		return e.JSON(http.StatusNotFound, "")
-	}
-
-	if !config.Enabled {
+	config, enabled := flights.LoadProviderConfig(e.App)
+	if !enabled {
 		return e.JSON(http.StatusNotFound, "")
 	}
 
@@ -47,6 +36,8 @@ func GetFlightRoute(e *core.RequestEvent, finder tzf.F) error {
 		flightsDataProvider = flightaware.FlightAware{}
 	} else if config.Provider == "adsbdb" {
 		flightsDataProvider = adsdb.AdsbDbCom{}
+	} else if config.Provider == "aerodatabox" {
+		flightsDataProvider = aerodatabox.AeroDataBox{}
 	} else {
 		return e.JSON(http.StatusNotFound, "")
 	}
@@ -1,11 +1,14 @@
 package routes
 
 import (
+	"backend/currency"
+	"backend/trips"
 	bt "backend/types"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +22,42 @@ func GenerateIcsData(e *core.RequestEvent) error {
 	// Get the trip record
 	tripRecord := e.Get("trip").(*core.Record)
 
+	cal, allTimezonesAvailable := buildTripCalendar(e, tripRecord)
+
+	base64Str := base64.StdEncoding.EncodeToString([]byte(cal.Serialize()))
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"data":                  base64Str,
+		"allTimezonesAvailable": allTimezonesAvailable,
+	})
+}
+
+// ExportTripCalendar serves the itinerary as a plain .ics file that calendar
+// apps can import or subscribe to
+func ExportTripCalendar(e *core.RequestEvent) error {
+	tripRecord := e.Get("trip").(*core.Record)
+
+	cal, allTimezonesAvailable := buildTripCalendar(e, tripRecord)
+	cal.SetXWRCalName(tripRecord.GetString("name"))
+	cal.SetRefreshInterval("PT1H")
+	cal.SetXPublishedTTL("PT1H")
+
+	fileName := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+		return r
+	}, tripRecord.GetString("name"))
+
+	e.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.ics\"", fileName))
+	e.Response.Header().Set("X-Surmai-All-Timezones-Available", strconv.FormatBool(allTimezonesAvailable))
+	return e.Blob(http.StatusOK, "text/calendar; charset=utf-8", []byte(cal.Serialize()))
+}
+
+// buildTripCalendar creates an event for the trip and each of its plans.
+// Times are converted from local wall clock time to the actual instant using
+// the timezone of each place, the boolean is false when some are missing.
+func buildTripCalendar(e *core.RequestEvent, tripRecord *core.Record) (*ics.Calendar, bool) {
+
 	// Convert the trip record to Trip type
 	trip := bt.Trip{
 		Id:           tripRecord.Id,
@@ -29,10 +68,20 @@ func GenerateIcsData(e *core.RequestEvent) error {
 		Destinations: getDestinations(tripRecord),
 	}
 
-	// Get transportations, lodgings, and activities
-	transportations := exportTransportations(e.App, tripRecord)
-	lodgings := exportLodgings(e.App, tripRecord)
-	activities := exportActivities(e.App, tripRecord)
+	// Get transportations, lodgings, activities and rentals, without what the
+	// owner keeps private when someone else exports the calendar
+	items := bt.ExportedTrip{
+		Transportations: exportTransportations(e.App, tripRecord),
+		Lodgings:        exportLodgings(e.App, tripRecord),
+		Activities:      exportActivities(e.App, tripRecord),
+		Rentals:         exportRentals(e.App, tripRecord),
+		CarRentals:      exportCarRentals(e.App, tripRecord),
+		Dining:          exportDining(e.App, tripRecord),
+	}
+	if !trips.SeesPrivate(requestTripRole(e)) {
+		trips.RedactExport(&items)
+	}
+	transportations, lodgings, activities := items.Transportations, items.Lodgings, items.Activities
 
 	allTimezonesAvailable := true
 
@@ -58,16 +107,58 @@ func GenerateIcsData(e *core.RequestEvent) error {
 
 	// Add activity events (1 hr with end date)
 	for _, activity := range activities {
+		if activity.StartDate.IsZero() {
+			// saved places that are not scheduled yet
+			continue
+		}
 		timezoneOk := createActivityEvent(cal, activity, &trip, e)
 		allTimezonesAvailable = allTimezonesAvailable && timezoneOk
 
 	}
 
-	base64Str := base64.StdEncoding.EncodeToString([]byte(cal.Serialize()))
-	return e.JSON(http.StatusOK, map[string]interface{}{
-		"data":                  base64Str,
-		"allTimezonesAvailable": allTimezonesAvailable,
-	})
+	// Add pickup and return of rented equipment, in the timezone of the activity
+	activityTimezones := map[string]string{}
+	for _, activity := range activities {
+		activityTimezones[activity.Id] = getTimezoneValue(activity.Metadata, "place")
+	}
+	for _, rental := range items.Rentals {
+		createRentalEvents(cal, rental, activityTimezones[rental.Activity], &trip, e)
+	}
+
+	// Add pickup and drop off of rented cars
+	for _, rental := range items.CarRentals {
+		timezoneOk := createCarRentalEvents(cal, rental, &trip, e)
+		allTimezonesAvailable = allTimezonesAvailable && timezoneOk
+	}
+
+	// Add restaurant reservations
+	for _, dining := range items.Dining {
+		timezoneOk := createDiningEvent(cal, dining, &trip, e)
+		allTimezonesAvailable = allTimezonesAvailable && timezoneOk
+	}
+
+	return cal, allTimezonesAvailable
+}
+
+// addReminder adds a notification the given time before the event starts
+func addReminder(event *ics.VEvent, before time.Duration, description string) {
+	alarm := event.AddAlarm()
+	alarm.SetAction(ics.ActionDisplay)
+	alarm.SetTrigger(fmt.Sprintf("-PT%dM", int(before.Minutes())))
+	alarm.SetProperty(ics.ComponentPropertyDescription, description)
+}
+
+// setPlaceGeo adds the coordinates of a place from the record metadata
+func setPlaceGeo(event *ics.VEvent, metadata map[string]interface{}, key string) {
+	place, ok := metadata[key].(map[string]interface{})
+	if !ok {
+		return
+	}
+	lat, latOk := place["latitude"]
+	lng, lngOk := place["longitude"]
+	if latOk && lngOk && lat != nil && lng != nil && lat != "" && lng != "" {
+		event.SetGeo(lat, lng)
+	}
 }
 
 func createActivityEvent(cal *ics.Calendar, activity *bt.Activity, trip *bt.Trip, e *core.RequestEvent) bool {
@@ -85,12 +176,14 @@ func createActivityEvent(cal *ics.Calendar, activity *bt.Activity, trip *bt.Trip
 	metadata := activity.Metadata
 	placeTz := getTimezoneValue(metadata, "place")
 
-	if placeTz != "" {
+	if placeTz == "" {
 		timezoneAvailable = false
 	}
+	setPlaceGeo(activityEvent, metadata, "place")
 
 	startDate := applyActualTimezone(activity.StartDate.Time(), placeTz)
 	activityEvent.SetStartAt(startDate)
+	addReminder(activityEvent, time.Hour, activity.Name)
 
 	if activity.EndDate.IsZero() {
 		activityEvent.SetEndAt(startDate.Add(1 * time.Hour))
@@ -102,6 +195,141 @@ func createActivityEvent(cal *ics.Calendar, activity *bt.Activity, trip *bt.Trip
 	return timezoneAvailable
 }
 
+// createDiningEvent adds a restaurant reservation, a table is usually kept
+// for a couple of hours
+func createDiningEvent(cal *ics.Calendar, dining *bt.Dining, trip *bt.Trip, e *core.RequestEvent) bool {
+
+	timezoneAvailable := true
+
+	diningEvent := cal.AddEvent(fmt.Sprintf("dining-%s@surmai.app", dining.Id))
+	diningEvent.SetCreatedTime(time.Now())
+	diningEvent.SetDtStampTime(time.Now())
+	diningEvent.SetSummary(fmt.Sprintf("Table at %s", dining.Name))
+	diningEvent.SetLocation(dining.Address)
+	diningEvent.SetURL(e.App.Settings().Meta.AppURL + "/trips/" + trip.Id)
+
+	description := make([]string, 0)
+	if dining.PartySize > 0 {
+		description = append(description, fmt.Sprintf("Party of %d", dining.PartySize))
+	}
+	if dining.Cuisine != "" {
+		description = append(description, fmt.Sprintf("Cuisine: %s", dining.Cuisine))
+	}
+	if dining.ConfirmationCode != "" {
+		description = append(description, fmt.Sprintf("Confirmation Code: %s", dining.ConfirmationCode))
+	}
+	diningEvent.SetDescription(strings.Join(description, "\n"))
+
+	placeTz := getTimezoneValue(dining.Metadata, "place")
+	if placeTz == "" {
+		timezoneAvailable = false
+	}
+	setPlaceGeo(diningEvent, dining.Metadata, "place")
+
+	reservationTime := applyActualTimezone(dining.ReservationTime.Time(), placeTz)
+	diningEvent.SetStartAt(reservationTime)
+	diningEvent.SetEndAt(reservationTime.Add(2 * time.Hour))
+	addReminder(diningEvent, time.Hour, dining.Name)
+
+	return timezoneAvailable
+}
+
+// createRentalEvents adds short events for picking up and returning rented
+// equipment, the return carries a reminder so the deposit is not lost
+func createRentalEvents(cal *ics.Calendar, rental *bt.EquipmentRental, placeTz string, trip *bt.Trip, e *core.RequestEvent) {
+
+	if !rental.PickupTime.IsZero() {
+		pickupEvent := cal.AddEvent(fmt.Sprintf("rental-pickup-%s@surmai.app", rental.Id))
+		pickupEvent.SetCreatedTime(time.Now())
+		pickupEvent.SetDtStampTime(time.Now())
+		pickupTime := applyActualTimezone(rental.PickupTime.Time(), placeTz)
+		pickupEvent.SetStartAt(pickupTime)
+		pickupEvent.SetEndAt(pickupTime.Add(30 * time.Minute))
+		pickupEvent.SetSummary(fmt.Sprintf("Pick up: %s", rental.Item))
+		pickupEvent.SetLocation(rental.Shop)
+		pickupEvent.SetURL(e.App.Settings().Meta.AppURL + "/trips/" + trip.Id)
+	}
+
+	if !rental.ReturnTime.IsZero() {
+		returnEvent := cal.AddEvent(fmt.Sprintf("rental-return-%s@surmai.app", rental.Id))
+		returnEvent.SetCreatedTime(time.Now())
+		returnEvent.SetDtStampTime(time.Now())
+		returnTime := applyActualTimezone(rental.ReturnTime.Time(), placeTz)
+		returnEvent.SetStartAt(returnTime)
+		returnEvent.SetEndAt(returnTime.Add(30 * time.Minute))
+		returnEvent.SetSummary(fmt.Sprintf("Return: %s", rental.Item))
+		returnEvent.SetLocation(rental.Shop)
+		if rental.Deposit != nil && rental.Deposit.Value > 0 {
+			returnEvent.SetDescription("Deposit: " + currency.Format(rental.Deposit.Value, rental.Deposit.Currency))
+		}
+		addReminder(returnEvent, 2*time.Hour, fmt.Sprintf("Return: %s", rental.Item))
+		returnEvent.SetURL(e.App.Settings().Meta.AppURL + "/trips/" + trip.Id)
+	}
+}
+
+// createCarRentalEvents adds short events for picking up and dropping off a
+// rented car, the drop off carries a reminder to leave time to refuel
+func createCarRentalEvents(cal *ics.Calendar, rental *bt.CarRental, trip *bt.Trip, e *core.RequestEvent) bool {
+
+	timezoneAvailable := true
+
+	name := "Car rental"
+	if rental.Provider != "" {
+		name = fmt.Sprintf("%s car rental", rental.Provider)
+	}
+	description := make([]string, 0)
+	if rental.VehicleClass != "" {
+		description = append(description, fmt.Sprintf("Vehicle: %s", rental.VehicleClass))
+	}
+	if rental.ConfirmationCode != "" {
+		description = append(description, fmt.Sprintf("Confirmation Code: %s", rental.ConfirmationCode))
+	}
+
+	pickupTz := getTimezoneValue(rental.Metadata, "pickup")
+	if pickupTz == "" {
+		timezoneAvailable = false
+	}
+	pickupEvent := cal.AddEvent(fmt.Sprintf("car-rental-pickup-%s@surmai.app", rental.Id))
+	pickupEvent.SetCreatedTime(time.Now())
+	pickupEvent.SetDtStampTime(time.Now())
+	pickupTime := applyActualTimezone(rental.PickupTime.Time(), pickupTz)
+	pickupEvent.SetStartAt(pickupTime)
+	pickupEvent.SetEndAt(pickupTime.Add(30 * time.Minute))
+	pickupEvent.SetSummary(fmt.Sprintf("Pick up: %s", name))
+	pickupEvent.SetLocation(rental.PickupLocation)
+	pickupEvent.SetDescription(strings.Join(description, "\n"))
+	setPlaceGeo(pickupEvent, rental.Metadata, "pickup")
+	addReminder(pickupEvent, time.Hour, fmt.Sprintf("Pick up: %s", name))
+	pickupEvent.SetURL(e.App.Settings().Meta.AppURL + "/trips/" + trip.Id)
+
+	if rental.DropoffTime.IsZero() {
+		return timezoneAvailable
+	}
+
+	dropoffLocation, dropoffKey := rental.DropoffLocation, "dropoff"
+	if dropoffLocation == "" {
+		dropoffLocation, dropoffKey = rental.PickupLocation, "pickup"
+	}
+	dropoffTz := getTimezoneValue(rental.Metadata, dropoffKey)
+	if dropoffTz == "" {
+		timezoneAvailable = false
+	}
+	dropoffEvent := cal.AddEvent(fmt.Sprintf("car-rental-dropoff-%s@surmai.app", rental.Id))
+	dropoffEvent.SetCreatedTime(time.Now())
+	dropoffEvent.SetDtStampTime(time.Now())
+	dropoffTime := applyActualTimezone(rental.DropoffTime.Time(), dropoffTz)
+	dropoffEvent.SetStartAt(dropoffTime)
+	dropoffEvent.SetEndAt(dropoffTime.Add(30 * time.Minute))
+	dropoffEvent.SetSummary(fmt.Sprintf("Drop off: %s", name))
+	dropoffEvent.SetLocation(dropoffLocation)
+	dropoffEvent.SetDescription(strings.Join(description, "\n"))
+	setPlaceGeo(dropoffEvent, rental.Metadata, dropoffKey)
+	addReminder(dropoffEvent, 2*time.Hour, fmt.Sprintf("Drop off: %s", name))
+	dropoffEvent.SetURL(e.App.Settings().Meta.AppURL + "/trips/" + trip.Id)
+
+	return timezoneAvailable
+}
+
 func createLodgingEvent(cal *ics.Calendar, lodging *bt.Lodging, trip *bt.Trip, e *core.RequestEvent) bool {
 
 	timezoneAvailable := true
@@ -124,6 +352,8 @@ func createLodgingEvent(cal *ics.Calendar, lodging *bt.Lodging, trip *bt.Trip, e
 	checkInEvent.SetEndAt(checkInTime.Add(30 * time.Minute))
 	checkInEvent.SetSummary(fmt.Sprintf("Check-in: %s", lodging.Name))
 	checkInEvent.SetLocation(lodging.Address)
+	setPlaceGeo(checkInEvent, metadata, "place")
+	addReminder(checkInEvent, 2*time.Hour, fmt.Sprintf("Check-in: %s", lodging.Name))
 
 	// Stay event (full day)
 	stayEvent := cal.AddEvent(fmt.Sprintf("lodging-stay-%s@surmai.app", lodging.Id))
@@ -146,6 +376,7 @@ func createLodgingEvent(cal *ics.Calendar, lodging *bt.Lodging, trip *bt.Trip, e
 	checkOutEvent.SetEndAt(checkOutTime.Add(30 * time.Minute))
 	checkOutEvent.SetSummary(fmt.Sprintf("Check-out: %s", lodging.Name))
 	checkOutEvent.SetLocation(lodging.Address)
+	addReminder(checkOutEvent, time.Hour, fmt.Sprintf("Check-out: %s", lodging.Name))
 	checkOutEvent.SetURL(e.App.Settings().Meta.AppURL + "/trips/" + trip.Id)
 
 	return timezoneAvailable
@@ -224,6 +455,8 @@ func addTransportationEvent(cal *ics.Calendar, transportation *bt.Transportation
 	} else {
 		summary := fmt.Sprintf("%s from %s to %s", lo.Capitalize(transportation.Type), transportation.Origin, transportation.Destination)
 		transportEvent.SetSummary(summary)
+		transportEvent.SetLocation(transportation.Origin)
+		setPlaceGeo(transportEvent, metadata, "origin")
 
 		if originAddress != nil {
 			eventDescription = append(eventDescription, fmt.Sprintf("Origin Address: %s", originAddress))
@@ -234,8 +467,19 @@ func addTransportationEvent(cal *ics.Calendar, transportation *bt.Transportation
 		}
 	}
 
+	if len(transportation.Seats) > 0 {
+		eventDescription = append(eventDescription, fmt.Sprintf("Seats: %s", trips.SeatSummary(transportation.Seats)))
+	}
+
 	transportEvent.SetDescription(strings.Join(eventDescription[:], "\n"))
 
+	// flights need the extra time for security and boarding
+	reminder := time.Hour
+	if transportation.Type == "flight" {
+		reminder = 3 * time.Hour
+	}
+	addReminder(transportEvent, reminder, transportation.Origin+" -> "+transportation.Destination)
+
 	return timezoneAvailable
 
 }
@@ -274,10 +518,12 @@ func exportActivities(e core.App, trip *core.Record) []*bt.Activity {
 			Description:      l.GetString("description"),
 			Address:          l.GetString("address"),
 			StartDate:        l.GetDateTime("startDate"),
-			ConfirmationCode: l.GetString("confirmationCode"),
+			EndDate:          l.GetDateTime("endDate"),
+			ConfirmationCode: trips.ConfirmationCode(l),
 		}
 		_ = l.UnmarshalJSONField("metadata", &ct.Metadata)
 		_ = l.UnmarshalJSONField("cost", &ct.Cost)
+		_ = l.UnmarshalJSONField("privacy", &ct.Privacy)
 		payload = append(payload, &ct)
 	}
 
@@ -296,11 +542,12 @@ func exportLodgings(e core.App, trip *core.Record) []*bt.Lodging {
 			Address:          l.GetString("address"),
 			StartDate:        l.GetDateTime("startDate"),
 			EndDate:          l.GetDateTime("endDate"),
-			ConfirmationCode: l.GetString("confirmationCode"),
+			ConfirmationCode: trips.ConfirmationCode(l),
 			Type:             l.GetString("type"),
 		}
 		_ = l.UnmarshalJSONField("metadata", &ct.Metadata)
 		_ = l.UnmarshalJSONField("cost", &ct.Cost)
+		_ = l.UnmarshalJSONField("privacy", &ct.Privacy)
 		payload = append(payload, &ct)
 	}
 
@@ -323,6 +570,77 @@ func exportTransportations(e core.App, trip *core.Record) []*bt.Transportation {
 		}
 		_ = l.UnmarshalJSONField("metadata", &ct.Metadata)
 		_ = l.UnmarshalJSONField("cost", &ct.Cost)
+		_ = l.UnmarshalJSONField("seats", &ct.Seats)
+		_ = l.UnmarshalJSONField("privacy", &ct.Privacy)
+		payload = append(payload, &ct)
+	}
+
+	return payload
+}
+
+func exportRentals(e core.App, trip *core.Record) []*bt.EquipmentRental {
+	rentals, _ := e.FindAllRecords("equipment_rentals",
+		dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+
+	var payload []*bt.EquipmentRental
+	for _, r := range rentals {
+		ct := bt.EquipmentRental{
+			Id:         r.Id,
+			Activity:   r.GetString("activity"),
+			Item:       r.GetString("item"),
+			Shop:       r.GetString("shop"),
+			PickupTime: r.GetDateTime("pickupTime"),
+			ReturnTime: r.GetDateTime("returnTime"),
+		}
+		_ = r.UnmarshalJSONField("deposit", &ct.Deposit)
+		_ = r.UnmarshalJSONField("privacy", &ct.Privacy)
+		payload = append(payload, &ct)
+	}
+
+	return payload
+}
+
+func exportCarRentals(e core.App, trip *core.Record) []*bt.CarRental {
+	rentals, _ := e.FindAllRecords("car_rentals",
+		dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+
+	var payload []*bt.CarRental
+	for _, r := range rentals {
+		ct := bt.CarRental{
+			Id:               r.Id,
+			Provider:         r.GetString("provider"),
+			PickupLocation:   r.GetString("pickupLocation"),
+			DropoffLocation:  r.GetString("dropoffLocation"),
+			PickupTime:       r.GetDateTime("pickupTime"),
+			DropoffTime:      r.GetDateTime("dropoffTime"),
+			ConfirmationCode: trips.ConfirmationCode(r),
+			VehicleClass:     r.GetString("vehicleClass"),
+		}
+		_ = r.UnmarshalJSONField("metadata", &ct.Metadata)
+		_ = r.UnmarshalJSONField("privacy", &ct.Privacy)
+		payload = append(payload, &ct)
+	}
+
+	return payload
+}
+
+func exportDining(e core.App, trip *core.Record) []*bt.Dining {
+	reservations, _ := e.FindAllRecords("dining",
+		dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+
+	var payload []*bt.Dining
+	for _, r := range reservations {
+		ct := bt.Dining{
+			Id:               r.Id,
+			Name:             r.GetString("name"),
+			ReservationTime:  r.GetDateTime("reservationTime"),
+			PartySize:        r.GetInt("partySize"),
+			ConfirmationCode: trips.ConfirmationCode(r),
+			Cuisine:          r.GetString("cuisine"),
+			Address:          r.GetString("address"),
+		}
+		_ = r.UnmarshalJSONField("metadata", &ct.Metadata)
+		_ = r.UnmarshalJSONField("privacy", &ct.Privacy)
 		payload = append(payload, &ct)
 	}
 
@@ -0,0 +1,139 @@
+package routes
+
+import (
+	"backend/geocoding"
+	"backend/geocoding/nominatim"
+	"backend/geocoding/photon"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/ringsaturn/tzf"
+)
+
+// Addresses are resolved on the server so the browser and the assistant use
+// one provider, its key and its request budget. SURMAI_GEOCODING_PROVIDER
+// picks nominatim (the default), photon or none, SURMAI_GEOCODING_URL points
+// at a self-hosted server and SURMAI_GEOCODING_INTERVAL spaces the requests,
+// one second by default as the public servers ask.
+
+// geocoder is set up with the timezone finder when the server starts, it is
+// nil when geocoding is turned off
+var geocoder *geocoding.Geocoder
+
+func SetupGeocoding(finder tzf.F) {
+	interval := time.Second
+	if value, ok := parsePositiveDuration(os.Getenv("SURMAI_GEOCODING_INTERVAL")); ok {
+		interval = value
+	}
+	limiter := geocoding.NewLimiter(interval)
+	baseURL := strings.TrimSpace(os.Getenv("SURMAI_GEOCODING_URL"))
+
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("SURMAI_GEOCODING_PROVIDER"))) {
+	case "none":
+		geocoder = nil
+	case "photon":
+		geocoder = &geocoding.Geocoder{Provider: photon.Photon{URL: baseURL, Limiter: limiter}, Finder: finder}
+	default:
+		geocoder = &geocoding.Geocoder{Provider: nominatim.Nominatim{URL: baseURL, Limiter: limiter}, Finder: finder}
+	}
+}
+
+// Geocode resolves a free-text address or place name to places with their
+// coordinates and timezone, best match first
+func Geocode(e *core.RequestEvent) error {
+	if geocoder == nil {
+		return e.JSON(http.StatusServiceUnavailable, map[string]string{"error": "geocoding is turned off"})
+	}
+	query := strings.TrimSpace(e.Request.URL.Query().Get("q"))
+	if len(query) < 3 {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "q must be at least 3 characters"})
+	}
+	limit, err := lookupLimit(e)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	places, err := geocoder.Search(query, limit, geocodingLanguage(e))
+	if err != nil {
+		return geocodingError(e, err)
+	}
+	return e.JSON(http.StatusOK, places)
+}
+
+// ReverseGeocode names the place at the given lat and lng
+func ReverseGeocode(e *core.RequestEvent) error {
+	if geocoder == nil {
+		return e.JSON(http.StatusServiceUnavailable, map[string]string{"error": "geocoding is turned off"})
+	}
+	lat, latErr := strconv.ParseFloat(e.Request.URL.Query().Get("lat"), 64)
+	lng, lngErr := strconv.ParseFloat(e.Request.URL.Query().Get("lng"), 64)
+	if latErr != nil || lngErr != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "lat and lng must be valid coordinates"})
+	}
+
+	place, err := geocoder.Reverse(lat, lng, geocodingLanguage(e))
+	if err != nil {
+		return geocodingError(e, err)
+	}
+	if place == nil {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "no place found at these coordinates"})
+	}
+	return e.JSON(http.StatusOK, place)
+}
+
+// geocodingLanguage is the lang parameter, or the locale of the traveler
+func geocodingLanguage(e *core.RequestEvent) string {
+	if lang := strings.TrimSpace(e.Request.URL.Query().Get("lang")); lang != "" {
+		return lang
+	}
+	return loadAssistantLocale(e.Auth).Tag
+}
+
+func geocodingError(e *core.RequestEvent, err error) error {
+	if errors.Is(err, geocoding.ErrRateLimited) {
+		return e.JSON(http.StatusTooManyRequests, map[string]string{"error": err.Error()})
+	}
+	e.App.Logger().Warn("Geocoding failed", "error", err)
+	return e.JSON(http.StatusBadGateway, map[string]string{"error": "the geocoding service is not available"})
+}
+
+// geocodeActivityPlace fills in the coordinates and timezone of the place of
+// a new activity from its address when the assistant did not know them
+func geocodeActivityPlace(args map[string]interface{}) {
+	if geocoder == nil {
+		return
+	}
+	place := mapValue(args["destination"])
+	if stringValue(place["latitude"]) != "" && stringValue(place["longitude"]) != "" {
+		return
+	}
+	address := strings.TrimSpace(stringValue(args["address"]))
+	if len(address) < 3 {
+		return
+	}
+
+	found, err := geocoder.Search(address, 1, "")
+	if err != nil || len(found) == 0 {
+		return
+	}
+	if place == nil {
+		place = map[string]interface{}{}
+	}
+	setIfEmpty := func(key string, value string) {
+		if stringValue(place[key]) == "" && value != "" {
+			place[key] = value
+		}
+	}
+	setIfEmpty("name", found[0].Name)
+	setIfEmpty("country", found[0].Country)
+	setIfEmpty("state", found[0].State)
+	setIfEmpty("timezone", found[0].Timezone)
+	place["latitude"] = strconv.FormatFloat(found[0].Latitude, 'f', -1, 64)
+	place["longitude"] = strconv.FormatFloat(found[0].Longitude, 'f', -1, 64)
+	args["destination"] = place
+}
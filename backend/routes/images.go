@@ -0,0 +1,74 @@
+package routes
+
+import (
+	"backend/images"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// ServeImageThumbnail serves a cover photo or an attached image resized to
+// the size asked for, made the first time it is asked for and kept. Like the
+// file API, the user is read from a file token in the token parameter, so
+// the URL works in an img tag, or from the auth header.
+func ServeImageThumbnail(e *core.RequestEvent) error {
+	collectionName := e.Request.PathValue("collection")
+	fieldName, ok := images.Fields[collectionName]
+	if !ok {
+		return e.NotFoundError("", nil)
+	}
+	record, err := e.App.FindRecordById(collectionName, e.Request.PathValue("recordId"))
+	if err != nil {
+		return e.NotFoundError("", err)
+	}
+	filename := e.Request.PathValue("filename")
+	if !slices.Contains(record.GetStringSlice(fieldName), filename) {
+		return e.NotFoundError("", nil)
+	}
+
+	info, err := e.RequestInfo()
+	if err != nil {
+		return err
+	}
+	if token := e.Request.URL.Query().Get("token"); token != "" {
+		if auth, err := e.App.FindAuthRecordByToken(token, core.TokenTypeFile); err == nil {
+			info.Auth = auth
+		}
+	}
+	if info.Auth == nil {
+		return e.NotFoundError("", nil)
+	}
+	if ok, _ := e.App.CanAccessRecord(record, info, record.Collection().ViewRule); !ok {
+		return e.NotFoundError("", nil)
+	}
+
+	field := record.Collection().Fields.GetByName(fieldName).(*core.FileField)
+	size := e.Request.URL.Query().Get("size")
+	if !slices.Contains(images.Sizes(field), size) {
+		return e.JSON(http.StatusBadRequest, map[string]any{
+			"error": "size must be one of the thumbnail sizes",
+			"sizes": images.Sizes(field),
+		})
+	}
+
+	fsys, err := e.App.NewFilesystem()
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+
+	err = images.Generate(fsys, record, filename, size)
+	if errors.Is(err, images.ErrNotImage) {
+		return e.JSON(http.StatusUnsupportedMediaType, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+
+	// the images of a trip are not for shared caches
+	e.Response.Header().Set("Cache-Control", "private, max-age=2592000")
+	e.Response.Header().Del("X-Frame-Options")
+	return fsys.Serve(e.Response, e.Request, images.ThumbKey(record, filename, size), size+"_"+filename)
+}
@@ -0,0 +1,152 @@
+package routes
+
+import (
+	"backend/ingest"
+	"backend/proposals"
+	"backend/trips"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/ringsaturn/tzf"
+)
+
+const maxConfirmationBytes = 10 << 20
+
+// minConfirmationLetters is the text a PDF needs for its text to be sent
+// instead of the file, scans and remapped fonts give little or none
+const minConfirmationLetters = 80
+
+const confirmationPrompt = `Extract the bookings from the confirmation PDF of a hotel, rental, flight, train, bus or car rental. kind is transportation for flights, trains, buses and rental cars, lodging for hotels and rentals. Times are the local time of the place as 2006-01-02T15:04:05, without an offset. costValue is the total price and costCurrency its ISO 4217 code. Leave fields empty when the confirmation does not say. Return an empty list when the PDF holds no booking.`
+
+// ImportConfirmation reads the lodgings and transportations of a booking
+// confirmation PDF uploaded as "file". The text of the PDF, or the PDF
+// itself when its text cannot be read, goes to the assistant with a strict
+// schema. Nothing is saved: each booking comes back as a proposal on the
+// trip for the traveler to approve, reviewed like an import.
+func ImportConfirmation(e *core.RequestEvent, finder tzf.F) error {
+	trip := e.Get("trip").(*core.Record)
+	if !trips.CanEdit(requestTripRole(e)) {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "viewers cannot import bookings"})
+	}
+
+	file, header, err := e.Request.FormFile("file")
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "file is required"})
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxConfirmationBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxConfirmationBytes {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "the confirmation must be smaller than 10 MB"})
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "the confirmation must be a PDF"})
+	}
+
+	reservations, err := extractConfirmationWithAssistant(e.Request.Context(), loadAssistantConfig(e.App), data)
+	if err != nil {
+		e.App.Logger().Warn("Could not read the confirmation", "error", err, "tripId", trip.Id)
+		return e.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "no booking could be read from the confirmation"})
+	}
+
+	locale := loadAssistantLocale(e.Auth)
+	created := make([]map[string]interface{}, 0)
+	unmatched := make([]ingest.Reservation, 0)
+	issued := make([]*proposals.Proposal, 0)
+	for _, reservation := range reservations {
+		tool, args := reservationProposal(reservation)
+		if tool != assistantToolCreateLodging && tool != assistantToolCreateTransportation {
+			unmatched = append(unmatched, reservation)
+			continue
+		}
+		resolveNaturalTimes(tool, args, locale)
+		if err := validateProposalArguments(tool, args); err != nil {
+			unmatched = append(unmatched, reservation)
+			continue
+		}
+
+		proposal := &proposals.Proposal{
+			ID:          uuid.NewString(),
+			TripID:      trip.Id,
+			Tool:        tool,
+			Arguments:   args,
+			Summary:     summarizeProposal(tool, args, locale),
+			Assumptions: []string{fmt.Sprintf("Read from the confirmation \"%s\".", header.Filename)},
+			RequestedBy: e.Auth.Id,
+			CreatedAt:   time.Now().UTC(),
+			ExpiresAt:   time.Now().UTC().Add(inboundEmailProposalTTL),
+		}
+		stored, isNew := proposals.StoreUnique(proposal)
+		if isNew {
+			proposals.RecordIssued(e.App, stored, e.Auth.Id)
+			issued = append(issued, stored)
+		}
+		created = append(created, proposalPayload(stored))
+	}
+
+	response := map[string]interface{}{
+		"status":    "processed",
+		"proposals": created,
+		"unmatched": unmatched,
+	}
+	if len(issued) > 0 {
+		response["review"] = startImportReview(e.App, trip, e.Auth, "confirmation", finder, nil, issued, true)
+	}
+	return e.JSON(http.StatusOK, response)
+}
+
+// extractConfirmationWithAssistant sends the text of the confirmation to the
+// model, or the PDF when there is too little text to go by
+func extractConfirmationWithAssistant(ctx context.Context, config assistantConfig, pdf []byte) ([]ingest.Reservation, error) {
+	apiKey := strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
+	if apiKey == "" {
+		return nil, errors.New("OPENAI_API_KEY is not configured")
+	}
+
+	content := map[string]string{
+		"type":      "input_file",
+		"filename":  "confirmation.pdf",
+		"file_data": "data:application/pdf;base64," + base64.StdEncoding.EncodeToString(pdf),
+	}
+	text := ingest.PDFText(pdf)
+	letters := 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if letters >= minConfirmationLetters {
+		if len(text) > 20000 {
+			text = text[:20000]
+		}
+		content = map[string]string{"type": "input_text", "text": text}
+	}
+
+	payload := map[string]interface{}{
+		"model": config.Model,
+		"input": []map[string]interface{}{
+			newResponsesTextBlock("developer", confirmationPrompt),
+			{
+				"role":    "user",
+				"content": []map[string]string{content},
+			},
+		},
+		"reasoning": map[string]string{"effort": "low"},
+		"text":      map[string]interface{}{"format": bookingsFormat(ingest.KindTransportation, ingest.KindLodging)},
+	}
+	return requestBookings(ctx, apiKey, config, payload)
+}
@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"backend/trips/import/external"
+	ji "backend/trips/import/json"
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/ringsaturn/tzf"
+)
+
+// ImportExternalTrip creates a trip from a TripIt or Wanderlog export. With
+// dryRun=true nothing is saved and the converted plans are returned so the
+// traveler can check them first. The imported trip gets an import review.
+func ImportExternalTrip(e *core.RequestEvent, finder tzf.F) error {
+
+	file, _, err := e.Request.FormFile("tripData")
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "tripData file is required"})
+	}
+	defer file.Close()
+
+	var buff bytes.Buffer
+	if _, err := buff.ReadFrom(file); err != nil {
+		return err
+	}
+
+	source := strings.ToLower(strings.TrimSpace(e.Request.FormValue("source")))
+	if source != "" && source != external.SourceTripIt && source != external.SourceWanderlog {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "source must be tripit or wanderlog"})
+	}
+
+	plan, err := external.Parse(buff.Bytes(), source)
+	if errors.Is(err, external.ErrUnknownFormat) {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+
+	if e.Request.URL.Query().Get("dryRun") == "true" {
+		return e.JSON(http.StatusOK, map[string]any{
+			"status":          "preview",
+			"source":          plan.Source,
+			"trip":            plan.Trip.Trip,
+			"transportations": plan.Trip.Transportations,
+			"lodgings":        plan.Trip.Lodgings,
+			"activities":      plan.Trip.Activities,
+			"warnings":        plan.Warnings,
+		})
+	}
+
+	var tripId string
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		var importErr error
+		tripId, importErr = ji.ImportExportedTrip(txApp, plan.Trip, e.Auth.Id)
+		return importErr
+	})
+	if err != nil {
+		return err
+	}
+
+	trip, err := e.App.FindRecordById("trips", tripId)
+	if err != nil {
+		return err
+	}
+	imported := make([]*core.Record, 0)
+	for _, collection := range []string{"transportations", "lodgings", "activities"} {
+		records, err := e.App.FindAllRecords(collection, dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": tripId}))
+		if err != nil {
+			return err
+		}
+		imported = append(imported, records...)
+	}
+	review := startImportReview(e.App, trip, e.Auth, plan.Source, finder, imported, nil, false)
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"tripId":   tripId,
+		"source":   plan.Source,
+		"warnings": plan.Warnings,
+		"review":   review,
+	})
+}
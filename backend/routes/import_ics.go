@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"backend/trips"
+	"backend/trips/import/calendar"
+	bt "backend/types"
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/ringsaturn/tzf"
+)
+
+// ImportTripCalendar adds the reservations of an uploaded .ics file, such as
+// a TripIt calendar or the attachment of a hotel confirmation, to the trip as
+// transportations, lodgings and activities. Events the trip already has are
+// skipped. With dryRun=true nothing is saved, otherwise the new records get
+// an import review.
+func ImportTripCalendar(e *core.RequestEvent, finder tzf.F) error {
+	trip := e.Get("trip").(*core.Record)
+	if !trips.CanEdit(requestTripRole(e)) {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "viewers cannot add reservations to the trip"})
+	}
+
+	file, _, err := e.Request.FormFile("calendar")
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "calendar file is required"})
+	}
+	defer file.Close()
+
+	var buff bytes.Buffer
+	if _, err := buff.ReadFrom(file); err != nil {
+		return err
+	}
+
+	plans, err := calendar.Parse(buff.Bytes(), finder, tripTimezone(trip))
+	if errors.Is(err, calendar.ErrUnknownFormat) {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+	if len(plans.Transportations)+len(plans.Lodgings)+len(plans.Activities) == 0 {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "the calendar has no events"})
+	}
+
+	if e.Request.URL.Query().Get("dryRun") == "true" {
+		return e.JSON(http.StatusOK, map[string]any{
+			"status":          "preview",
+			"transportations": plans.Transportations,
+			"lodgings":        plans.Lodgings,
+			"activities":      plans.Activities,
+			"warnings":        plans.Warnings,
+		})
+	}
+
+	var created []*core.Record
+	var skipped []string
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		var createErr error
+		created, skipped, createErr = calendar.CreatePlans(txApp, trip.Id, plans)
+		return createErr
+	})
+	if err != nil {
+		return err
+	}
+
+	ids := map[string][]string{"transportations": {}, "lodgings": {}, "activities": {}}
+	for _, record := range created {
+		name := record.Collection().Name
+		ids[name] = append(ids[name], record.Id)
+	}
+	response := map[string]any{
+		"created":  ids,
+		"warnings": append(plans.Warnings, skipped...),
+	}
+	if len(created) > 0 {
+		response["review"] = startImportReview(e.App, trip, e.Auth, "ics", finder, created, nil, false)
+	}
+	return e.JSON(http.StatusOK, response)
+}
+
+// tripTimezone is the timezone of the trip when all of its destinations share
+// one, used for calendar times that have no place
+func tripTimezone(trip *core.Record) string {
+	var destinations []bt.Destination
+	_ = trip.UnmarshalJSONField("destinations", &destinations)
+
+	timezone := ""
+	for _, destination := range destinations {
+		if destination.TimeZone == "" {
+			continue
+		}
+		if timezone != "" && timezone != destination.TimeZone {
+			return ""
+		}
+		timezone = destination.TimeZone
+	}
+	return timezone
+}
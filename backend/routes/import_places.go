@@ -0,0 +1,85 @@
+package routes
+
+import (
+	"backend/trips"
+	"backend/trips/import/places"
+	"bytes"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/ringsaturn/tzf"
+)
+
+// ImportTripPlaces adds the places of a saved Google Maps list (Takeout CSV
+// or GeoJSON) or a KML, KMZ or GeoJSON file to the trip as unscheduled
+// activities. The category form value is used for places without one and
+// defaults to the name of a CSV list. With dryRun=true nothing is saved,
+// otherwise the new activities get an import review.
+func ImportTripPlaces(e *core.RequestEvent, finder tzf.F) error {
+	trip := e.Get("trip").(*core.Record)
+	if !trips.CanEdit(requestTripRole(e)) {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "viewers cannot add places to the trip"})
+	}
+
+	file, header, err := e.Request.FormFile("places")
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "places file is required"})
+	}
+	defer file.Close()
+
+	var buff bytes.Buffer
+	if _, err := buff.ReadFrom(file); err != nil {
+		return err
+	}
+
+	saved, err := places.Parse(buff.Bytes())
+	if errors.Is(err, places.ErrUnknownFormat) {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+	if len(saved) == 0 {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "the file has no places"})
+	}
+
+	category := strings.TrimSpace(e.Request.FormValue("category"))
+	if category == "" && strings.EqualFold(filepath.Ext(header.Filename), ".csv") {
+		category = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+	}
+	activities := places.Activities(saved, category, finder)
+
+	if e.Request.URL.Query().Get("dryRun") == "true" {
+		return e.JSON(http.StatusOK, map[string]any{
+			"status":     "preview",
+			"activities": activities,
+		})
+	}
+
+	var created []*core.Record
+	var warnings []string
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		var createErr error
+		created, warnings, createErr = places.CreateActivities(txApp, trip.Id, activities)
+		return createErr
+	})
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(created))
+	for _, record := range created {
+		ids = append(ids, record.Id)
+	}
+	response := map[string]any{
+		"activityIds": ids,
+		"warnings":    warnings,
+	}
+	if len(created) > 0 {
+		response["review"] = startImportReview(e.App, trip, e.Auth, "places", finder, created, nil, false)
+	}
+	return e.JSON(http.StatusOK, response)
+}
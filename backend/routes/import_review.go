@@ -0,0 +1,493 @@
+package routes
+
+import (
+	"backend/cache"
+	"backend/proposals"
+	"backend/trips"
+	bt "backend/types"
+	"backend/validation"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/ringsaturn/tzf"
+)
+
+// Bulk imports (forwarded emails, TripIt and Wanderlog exports, saved place
+// lists) are followed by a review: the assistant sums up what came in, points
+// at plans that look doubtful and offers proposals to correct them, which the
+// traveler approves like any other. Reviews are kept in memory next to the
+// proposals until they are dismissed.
+
+// reviews live as long as the proposals made from forwarded emails
+const importReviewTTL = inboundEmailProposalTTL
+
+const importReviewPrompt = "Plans were just imported into the trip. Write a short message to the traveler, in plain text, that says what was imported and asks them to check the flagged plans, giving the reason for each. Mention that the suggested corrections are waiting for their approval when there are any. Use only the facts given and do not repeat ids."
+
+var importReviewsMutex sync.Mutex
+
+// importedPlan is the part of an imported record or proposal the review
+// looks at. Places maps the metadata key of each place to its timezone.
+type importedPlan struct {
+	collection    string
+	recordId      string
+	proposalId    string
+	name          string
+	start         time.Time
+	end           time.Time
+	places        map[string]string
+	metadata      map[string]any
+	lowConfidence bool
+}
+
+// startImportReview checks the imported records and pending proposals of a
+// trip, stores the correction proposals and the review, and returns it.
+// Records already on the trip before the import are used to spot copies.
+func startImportReview(app core.App, trip *core.Record, user *core.Record, source string, finder tzf.F, records []*core.Record, pending []*proposals.Proposal, lowConfidence bool) *bt.ImportReview {
+	config := loadAssistantConfig(app)
+	review := &bt.ImportReview{
+		Id:          uuid.NewString(),
+		TripId:      trip.Id,
+		Source:      source,
+		Imported:    map[string]int{},
+		Flags:       make([]*bt.ImportFlag, 0),
+		ProposalIds: make([]string, 0),
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	imported := map[string]bool{}
+	plans := make([]importedPlan, 0, len(records)+len(pending))
+	for _, record := range records {
+		if plan, ok := planFromRecord(record); ok {
+			plans = append(plans, plan)
+			imported[record.Id] = true
+		}
+	}
+	for _, proposal := range pending {
+		if plan, ok := planFromProposal(proposal); ok {
+			plan.lowConfidence = lowConfidence
+			plans = append(plans, plan)
+		}
+	}
+
+	destinations := tripDestinationTimezones(trip)
+	existing := existingPlans(app, trip, imported)
+	requestedBy := ""
+	if user != nil {
+		requestedBy = user.Id
+	}
+	review.RequestedBy = requestedBy
+
+	for _, plan := range plans {
+		review.Imported[plan.collection]++
+		for _, reason := range importedPlanProblems(trip, plan) {
+			review.Flags = append(review.Flags, importFlag(plan, reason))
+		}
+		if plan.recordId == "" {
+			continue
+		}
+
+		corrections := make([]*proposals.Proposal, 0)
+		if copyOf := findCopy(plan, existing); copyOf != "" {
+			review.Flags = append(review.Flags, importFlag(plan, fmt.Sprintf("looks like a copy of %s, already on the trip", copyOf)))
+			corrections = append(corrections, importCorrection(trip, deleteTool(plan.collection),
+				map[string]interface{}{"record_id": plan.recordId},
+				fmt.Sprintf("Remove the imported copy of %s?", plan.name)))
+		} else if args := timezoneCorrection(plan, finder, destinations); len(args) > 0 {
+			args["record_id"] = plan.recordId
+			corrections = append(corrections, importCorrection(trip, updateTool(plan.collection), args,
+				fmt.Sprintf("Set the timezone of %s to %s?", plan.name, strings.Join(uniqueValues(args), " and "))))
+		}
+
+		for _, correction := range corrections {
+			correction.RequestedBy = requestedBy
+			correction.ExpiresAt = correction.CreatedAt.Add(config.ProposalTTL)
+			stored, created := proposals.StoreUnique(correction)
+			if created {
+				proposals.RecordIssued(app, stored, requestedBy)
+			}
+			review.ProposalIds = append(review.ProposalIds, stored.ID)
+		}
+	}
+	for _, proposal := range pending {
+		review.ProposalIds = append(review.ProposalIds, proposal.ID)
+	}
+
+	review.Message = importReviewMessage(review)
+	if written, err := writeImportReviewMessage(app, config, user, review); err != nil {
+		app.Logger().Warn("Import review message failed", "error", err, "tripId", trip.Id)
+	} else if written != "" {
+		review.Message = written
+	}
+
+	storeImportReview(review)
+	return review
+}
+
+func planFromRecord(record *core.Record) (importedPlan, bool) {
+	plan := importedPlan{
+		collection: record.Collection().Name,
+		recordId:   record.Id,
+		places:     map[string]string{},
+	}
+	_ = record.UnmarshalJSONField("metadata", &plan.metadata)
+
+	var keys []string
+	switch plan.collection {
+	case "transportations":
+		plan.name = fmt.Sprintf("the %s from %s to %s", record.GetString("type"), record.GetString("origin"), record.GetString("destination"))
+		plan.start = record.GetDateTime("departureTime").Time()
+		plan.end = record.GetDateTime("arrivalTime").Time()
+		keys = []string{"origin", "destination"}
+	case "lodgings", "activities":
+		plan.name = fmt.Sprintf("\"%s\"", record.GetString("name"))
+		plan.start = record.GetDateTime("startDate").Time()
+		plan.end = record.GetDateTime("endDate").Time()
+		keys = []string{"place"}
+	default:
+		return plan, false
+	}
+
+	for _, key := range keys {
+		plan.places[key] = stringValue(mapValue(plan.metadata[key])["timezone"])
+	}
+	return plan, true
+}
+
+func planFromProposal(proposal *proposals.Proposal) (importedPlan, bool) {
+	args := proposal.Arguments
+	plan := importedPlan{proposalId: proposal.ID, places: map[string]string{}}
+
+	var start, end string
+	switch proposal.Tool {
+	case assistantToolCreateTransportation:
+		plan.collection = "transportations"
+		plan.name = fmt.Sprintf("the %s from %s to %s", stringValue(args["type"]), stringValue(args["origin"]), stringValue(args["destination"]))
+		start, end = stringValue(args["departure_time"]), stringValue(args["arrival_time"])
+		plan.places["origin"] = stringValue(args["origin_timezone"])
+		plan.places["destination"] = stringValue(args["destination_timezone"])
+	case assistantToolCreateLodging, assistantToolCreateActivity:
+		plan.collection = "activities"
+		if proposal.Tool == assistantToolCreateLodging {
+			plan.collection = "lodgings"
+		}
+		plan.name = fmt.Sprintf("\"%s\"", stringValue(args["name"]))
+		start, end = stringValue(args["start_time"]), stringValue(args["end_time"])
+		plan.places["place"] = stringValue(args["timezone"])
+	default:
+		return plan, false
+	}
+
+	plan.start, _ = validation.ParseTimestamp(start)
+	plan.end, _ = validation.ParseTimestamp(end)
+	return plan, true
+}
+
+// importedPlanProblems lists why a plan may have been read wrong. Activities
+// without a start are saved places waiting to be scheduled, not a problem.
+func importedPlanProblems(trip *core.Record, plan importedPlan) []string {
+	problems := make([]string, 0)
+	if plan.lowConfidence {
+		problems = append(problems, "was read by the assistant, check it against the booking")
+	}
+
+	keys := make([]string, 0, len(plan.places))
+	for key := range plan.places {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if plan.places[key] == "" {
+			problems = append(problems, fmt.Sprintf("has no timezone for its %s", key))
+		}
+	}
+
+	if plan.start.IsZero() {
+		if plan.collection != "activities" {
+			problems = append(problems, "has no date")
+		}
+		return problems
+	}
+
+	if plan.start.Hour() == 0 && plan.start.Minute() == 0 {
+		problems = append(problems, "has no start time, it was set to midnight")
+	}
+	if plan.end.IsZero() && plan.collection != "activities" {
+		problems = append(problems, "has no end time")
+	}
+	if plan.collection == "transportations" && !plan.end.IsZero() && plan.end.Sub(plan.start) > 36*time.Hour {
+		problems = append(problems, "takes more than a day and a half")
+	}
+
+	tripStart := trip.GetDateTime("startDate").Time()
+	tripEnd := trip.GetDateTime("endDate").Time()
+	if !tripStart.IsZero() && !tripEnd.IsZero() &&
+		(plan.start.Before(tripStart.AddDate(0, 0, -1)) || plan.start.After(tripEnd.AddDate(0, 0, 2))) {
+		problems = append(problems, "is outside the trip dates")
+	}
+
+	return problems
+}
+
+func importFlag(plan importedPlan, reason string) *bt.ImportFlag {
+	return &bt.ImportFlag{
+		Collection: plan.collection,
+		RecordId:   plan.recordId,
+		ProposalId: plan.proposalId,
+		Name:       strings.Trim(strings.TrimPrefix(plan.name, "the "), "\""),
+		Reason:     reason,
+	}
+}
+
+// existingPlans are the plans of the trip that were not part of the import
+func existingPlans(app core.App, trip *core.Record, imported map[string]bool) []importedPlan {
+	plans := make([]importedPlan, 0)
+	for _, collection := range []string{"transportations", "lodgings", "activities"} {
+		records, err := app.FindAllRecords(collection, dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+		if err != nil {
+			continue
+		}
+		for _, record := range records {
+			if imported[record.Id] {
+				continue
+			}
+			if plan, ok := planFromRecord(record); ok {
+				plans = append(plans, plan)
+			}
+		}
+	}
+	return plans
+}
+
+// findCopy returns the name of an existing plan of the same kind with the
+// same name on the same day
+func findCopy(plan importedPlan, existing []importedPlan) string {
+	for _, other := range existing {
+		if other.collection != plan.collection || !strings.EqualFold(other.name, plan.name) {
+			continue
+		}
+		if other.start.Format(time.DateOnly) == plan.start.Format(time.DateOnly) {
+			return other.name
+		}
+	}
+	return ""
+}
+
+// timezoneCorrection fills in the missing timezones of a plan from the
+// coordinates of its places, or from the trip destinations
+func timezoneCorrection(plan importedPlan, finder tzf.F, destinations []bt.Destination) map[string]interface{} {
+	args := map[string]interface{}{}
+	for key, tz := range plan.places {
+		if tz != "" {
+			continue
+		}
+		place := mapValue(plan.metadata[key])
+		tz = firstNonEmpty(
+			trips.DerivePlaceTimezone(finder, plan.metadata, key),
+			matchDestinationTimezone(destinations, stringValue(place["name"]), plan.name),
+		)
+		if tz == "" {
+			continue
+		}
+		switch key {
+		case "origin":
+			args["origin_timezone"] = tz
+		case "destination":
+			args["destination_timezone"] = tz
+		default:
+			args["timezone"] = tz
+		}
+	}
+	return args
+}
+
+func importCorrection(trip *core.Record, tool string, args map[string]interface{}, summary string) *proposals.Proposal {
+	return &proposals.Proposal{
+		ID:        uuid.NewString(),
+		TripID:    trip.Id,
+		Tool:      tool,
+		Arguments: args,
+		Summary:   summary,
+		ContextAt: time.Now().UTC(),
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+func updateTool(collection string) string {
+	switch collection {
+	case "transportations":
+		return assistantToolUpdateTransportation
+	case "lodgings":
+		return assistantToolUpdateLodging
+	default:
+		return assistantToolUpdateActivity
+	}
+}
+
+func deleteTool(collection string) string {
+	switch collection {
+	case "transportations":
+		return assistantToolDeleteTransportation
+	case "lodgings":
+		return assistantToolDeleteLodging
+	default:
+		return assistantToolDeleteActivity
+	}
+}
+
+func uniqueValues(args map[string]interface{}) []string {
+	seen := map[string]bool{}
+	values := make([]string, 0, len(args))
+	for _, key := range []string{"timezone", "origin_timezone", "destination_timezone"} {
+		if value := stringValue(args[key]); value != "" && !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// importReviewMessage is the review written without the assistant, used when
+// it is not configured or does not answer
+func importReviewMessage(review *bt.ImportReview) string {
+	counts := make([]string, 0, len(review.Imported))
+	for _, collection := range []string{"transportations", "lodgings", "activities"} {
+		if n := review.Imported[collection]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, pluralItem(collection, n)))
+		}
+	}
+	if len(counts) == 0 {
+		return "Nothing could be imported."
+	}
+
+	var b strings.Builder
+	switch review.Source {
+	case "email":
+		fmt.Fprintf(&b, "I found %s in the forwarded email.", strings.Join(counts, ", "))
+	case "confirmation":
+		fmt.Fprintf(&b, "I found %s in the confirmation.", strings.Join(counts, ", "))
+	default:
+		fmt.Fprintf(&b, "I imported %s.", strings.Join(counts, ", "))
+	}
+	if len(review.Flags) == 0 {
+		b.WriteString(" Everything looks complete.")
+	} else {
+		b.WriteString(" Please check these:")
+		for _, flag := range review.Flags {
+			fmt.Fprintf(&b, "\n- %s %s", flag.Name, flag.Reason)
+		}
+	}
+	if len(review.ProposalIds) > 0 {
+		b.WriteString("\nThe suggested changes are waiting for your approval.")
+	}
+	return b.String()
+}
+
+func pluralItem(collection string, n int) string {
+	names := map[string][2]string{
+		"transportations": {"transportation", "transportations"},
+		"lodgings":        {"stay", "stays"},
+		"activities":      {"activity", "activities"},
+	}
+	if n == 1 {
+		return names[collection][0]
+	}
+	return names[collection][1]
+}
+
+// writeImportReviewMessage lets the assistant word the review, in the
+// traveler's language. It returns an empty message when no API key is set.
+func writeImportReviewMessage(app core.App, config assistantConfig, user *core.Record, review *bt.ImportReview) (string, error) {
+	apiKey := strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
+	if apiKey == "" {
+		return "", nil
+	}
+
+	facts, err := json.Marshal(map[string]interface{}{
+		"source":            review.Source,
+		"imported":          review.Imported,
+		"flags":             review.Flags,
+		"pendingCorrection": len(review.ProposalIds) > 0,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// the review is only words, the corrections are already proposed
+	config.DisabledTools = map[string]bool{}
+	for _, tool := range buildAssistantTools(assistantConfig{}) {
+		config.DisabledTools[assistantToolName(tool)] = true
+	}
+
+	input := []map[string]interface{}{
+		newResponsesTextBlock("developer", importReviewPrompt+" "+loadAssistantLocale(user).promptInstructions()),
+		newResponsesTextBlock("developer", fmt.Sprintf("Import:\n%s", string(facts))),
+	}
+	reply, err := invokeResponsesAPI(context.Background(), apiKey, input, config, "low", nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(reply.Text), nil
+}
+
+func importReviewsKey(tripId string) string {
+	return fmt.Sprintf("import-reviews-%s", tripId)
+}
+
+func storeImportReview(review *bt.ImportReview) {
+	importReviewsMutex.Lock()
+	defer importReviewsMutex.Unlock()
+	reviews := listImportReviews(review.TripId)
+	cache.Set(importReviewsKey(review.TripId), append(reviews, review), importReviewTTL)
+}
+
+func listImportReviews(tripId string) []*bt.ImportReview {
+	if stored, found := cache.Get(importReviewsKey(tripId)); found {
+		if reviews, ok := stored.([]*bt.ImportReview); ok {
+			return reviews
+		}
+	}
+	return make([]*bt.ImportReview, 0)
+}
+
+// ImportReviews lists the reviews of recent imports that were not dismissed,
+// oldest first, for the assistant panel to show as messages
+func ImportReviews(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	return e.JSON(http.StatusOK, map[string]interface{}{"reviews": listImportReviews(trip.Id)})
+}
+
+// DismissImportReview removes a review once the traveler has read it, its
+// proposals stay pending
+func DismissImportReview(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	if !trips.CanEdit(requestTripRole(e)) {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "viewers cannot dismiss import reviews"})
+	}
+
+	reviewId := e.Request.PathValue("reviewId")
+	importReviewsMutex.Lock()
+	defer importReviewsMutex.Unlock()
+
+	reviews := listImportReviews(trip.Id)
+	kept := make([]*bt.ImportReview, 0, len(reviews))
+	for _, review := range reviews {
+		if review.Id != reviewId {
+			kept = append(kept, review)
+		}
+	}
+	if len(kept) == len(reviews) {
+		return e.NotFoundError("Import review not found", nil)
+	}
+	cache.Set(importReviewsKey(trip.Id), kept, importReviewTTL)
+	return e.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,366 @@
+package routes
+
+import (
+	"backend/ingest"
+	"backend/proposals"
+	"backend/trips"
+	bt "backend/types"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// forwarded bookings are often looked at days later, unlike chat proposals
+const inboundEmailProposalTTL = 7 * 24 * time.Hour
+
+const inboundEmailPrompt = `Extract every travel booking from the forwarded confirmation email. kind is transportation for flights, trains, buses and rental cars, lodging for hotels and rentals, activity for tours, events and restaurant bookings. Times are the local time of the place as 2006-01-02T15:04:05, without an offset. Leave fields empty when the email does not say. Return an empty list when the email holds no booking.`
+
+// InboundEmail receives booking confirmations that travelers forward to the
+// instance. The mail provider posts the message as JSON ({from, to, subject,
+// text, html}), as form fields with the same names or as a raw MIME message.
+// Bookings are read from the schema.org markup of the email, or by the
+// assistant when there is none, and become proposals on the matching trip
+// that the traveler approves like any other.
+func InboundEmail(e *core.RequestEvent) error {
+	secret := strings.TrimSpace(os.Getenv("SURMAI_INBOUND_EMAIL_SECRET"))
+	if secret == "" {
+		return e.NotFoundError("Inbound email is not configured", nil)
+	}
+	provided := e.Request.Header.Get("X-Surmai-Inbound-Secret")
+	if provided == "" {
+		provided = e.Request.URL.Query().Get("secret")
+	}
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(secret)) != 1 {
+		return e.UnauthorizedError("Invalid inbound email secret", nil)
+	}
+
+	msg, err := readInboundEmail(e.Request)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "could not read the email: " + err.Error()})
+	}
+
+	// only mail from a known traveler is read, anything else is ignored
+	user, err := e.App.FindAuthRecordByEmail("users", msg.SenderAddress())
+	if err != nil {
+		return e.JSON(http.StatusAccepted, map[string]interface{}{"status": "ignored", "reason": "unknown sender"})
+	}
+
+	source := "schema.org"
+	reservations := ingest.ExtractReservations(msg.HTML)
+	if len(reservations) == 0 {
+		source = "assistant"
+		reservations, err = extractReservationsWithAssistant(e.Request.Context(), loadAssistantConfig(e.App), inboundEmailPrompt, msg, nil)
+		if err != nil {
+			e.App.Logger().Warn("Could not read forwarded email", "error", err, "userId", user.Id)
+			return e.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "no booking could be read from the email"})
+		}
+	}
+
+	tag := msg.TripTag()
+	candidates, err := inboundEmailTrips(e.App, user, tag)
+	if err != nil {
+		return err
+	}
+
+	locale := loadAssistantLocale(user)
+	created := make([]map[string]interface{}, 0)
+	unmatched := make([]ingest.Reservation, 0)
+	tripsById := map[string]*core.Record{}
+	issued := map[string][]*proposals.Proposal{}
+	for _, reservation := range reservations {
+		tool, args := reservationProposal(reservation)
+		trip := matchInboundTrip(candidates, reservation.Start, tag != "")
+		if tool == "" || trip == nil {
+			unmatched = append(unmatched, reservation)
+			continue
+		}
+		resolveNaturalTimes(tool, args, locale)
+		if err := validateProposalArguments(tool, args); err != nil {
+			unmatched = append(unmatched, reservation)
+			continue
+		}
+
+		proposal := &proposals.Proposal{
+			ID:          uuid.NewString(),
+			TripID:      trip.Id,
+			Tool:        tool,
+			Arguments:   args,
+			Summary:     summarizeProposal(tool, args, locale),
+			Assumptions: []string{fmt.Sprintf("Read from the email \"%s\".", msg.Subject)},
+			RequestedBy: user.Id,
+			CreatedAt:   time.Now().UTC(),
+			ExpiresAt:   time.Now().UTC().Add(inboundEmailProposalTTL),
+		}
+		stored, isNew := proposals.StoreUnique(proposal)
+		if isNew {
+			proposals.RecordIssued(e.App, stored, user.Id)
+			tripsById[trip.Id] = trip
+			issued[trip.Id] = append(issued[trip.Id], stored)
+		}
+
+		payload := proposalPayload(stored)
+		payload["tripId"] = trip.Id
+		created = append(created, payload)
+	}
+
+	reviews := make([]*bt.ImportReview, 0, len(issued))
+	for tripId, pending := range issued {
+		reviews = append(reviews, startImportReview(e.App, tripsById[tripId], user, "email", nil, nil, pending, source == "assistant"))
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"status":    "processed",
+		"source":    source,
+		"proposals": created,
+		"unmatched": unmatched,
+		"reviews":   reviews,
+	})
+}
+
+func readInboundEmail(r *http.Request) (*ingest.Message, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "application/json":
+		var msg ingest.Message
+		if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 5<<20)).Decode(&msg); err != nil {
+			return nil, err
+		}
+		return &msg, nil
+	case "multipart/form-data", "application/x-www-form-urlencoded":
+		if err := r.ParseMultipartForm(5 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			return nil, err
+		}
+		return &ingest.Message{
+			From:    r.FormValue("from"),
+			To:      r.FormValue("to"),
+			Subject: r.FormValue("subject"),
+			Text:    r.FormValue("text"),
+			HTML:    r.FormValue("html"),
+		}, nil
+	default:
+		return ingest.ParseMIME(r.Body)
+	}
+}
+
+// inboundEmailTrips lists the trips the sender can add plans to. A plus
+// address (trips+<tripId>@...) narrows it down to that trip.
+func inboundEmailTrips(app core.App, user *core.Record, tag string) ([]*core.Record, error) {
+	records, err := app.FindRecordsByFilter("trips",
+		"ownerId = {:userId} || collaborators.id ?= {:userId}", "startDate", 0, 0,
+		dbx.Params{"userId": user.Id})
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]*core.Record, 0, len(records))
+	for _, trip := range records {
+		if !trips.CanEdit(trips.TripRole(trip, user.Id)) {
+			continue
+		}
+		if tag != "" && trip.Id != tag {
+			continue
+		}
+		candidates = append(candidates, trip)
+	}
+	return candidates, nil
+}
+
+// matchInboundTrip picks the trip whose dates, give or take a day, include
+// the booking. A single tagged trip is used whatever the dates, and so is the
+// only trip when the booking has no date.
+func matchInboundTrip(candidates []*core.Record, start string, tagged bool) *core.Record {
+	if len(candidates) == 1 && (tagged || start == "") {
+		return candidates[0]
+	}
+	at, err := time.Parse("2006-01-02T15:04:05", start)
+	if err != nil {
+		return nil
+	}
+
+	matches := make([]*core.Record, 0)
+	for _, trip := range candidates {
+		from := trip.GetDateTime("startDate").Time().AddDate(0, 0, -1)
+		to := trip.GetDateTime("endDate").Time().AddDate(0, 0, 2)
+		if !at.Before(from) && at.Before(to) {
+			matches = append(matches, trip)
+		}
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	// overlapping trips: the one starting closest to the booking
+	sort.Slice(matches, func(i, j int) bool {
+		return at.Sub(matches[i].GetDateTime("startDate").Time()).Abs() < at.Sub(matches[j].GetDateTime("startDate").Time()).Abs()
+	})
+	return matches[0]
+}
+
+// reservationProposal maps a booking onto the arguments of the matching
+// assistant tool
+func reservationProposal(reservation ingest.Reservation) (string, map[string]interface{}) {
+	args := map[string]interface{}{}
+	set := func(key string, value string) {
+		if strings.TrimSpace(value) != "" {
+			args[key] = strings.TrimSpace(value)
+		}
+	}
+
+	var tool string
+	switch reservation.Kind {
+	case ingest.KindTransportation:
+		tool = assistantToolCreateTransportation
+		set("type", firstNonEmpty(reservation.Type, "flight"))
+		set("provider", reservation.Provider)
+		set("origin", reservation.Origin)
+		set("destination", reservation.Destination)
+		set("departure_time", reservation.Start)
+		set("arrival_time", reservation.End)
+		notes := make([]string, 0)
+		if reservation.Name != "" {
+			notes = append(notes, reservation.Name)
+		}
+		if reservation.Confirmation != "" {
+			notes = append(notes, "Confirmation "+reservation.Confirmation)
+		}
+		if reservation.Notes != "" {
+			notes = append(notes, reservation.Notes)
+		}
+		set("notes", strings.Join(notes, ", "))
+	case ingest.KindLodging:
+		tool = assistantToolCreateLodging
+		set("name", reservation.Name)
+		set("type", firstNonEmpty(reservation.Type, "hotel"))
+		set("address", reservation.Address)
+		set("start_time", reservation.Start)
+		set("end_time", reservation.End)
+		set("confirmation", reservation.Confirmation)
+		set("notes", reservation.Notes)
+		if reservation.CostValue > 0 {
+			args["cost_value"] = reservation.CostValue
+			set("cost_currency", reservation.CostCurrency)
+		}
+	case ingest.KindActivity:
+		tool = assistantToolCreateActivity
+		set("name", reservation.Name)
+		set("address", firstNonEmpty(reservation.Address, reservation.Name))
+		set("start_time", reservation.Start)
+		set("end_time", reservation.End)
+		set("notes", strings.TrimSpace(reservation.Notes+" "+reservation.Confirmation))
+		if reservation.CostValue > 0 {
+			args["cost_value"] = reservation.CostValue
+			set("cost_currency", reservation.CostCurrency)
+		}
+	default:
+		return "", nil
+	}
+	return tool, args
+}
+
+// extractReservationsWithAssistant asks the model for the bookings of an
+// email or shared page without markup, and of the screenshots shared with
+// it, using a structured output schema
+func extractReservationsWithAssistant(ctx context.Context, config assistantConfig, prompt string, msg *ingest.Message, images []string) ([]ingest.Reservation, error) {
+	apiKey := strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
+	if apiKey == "" {
+		return nil, errors.New("there is no booking markup and OPENAI_API_KEY is not configured")
+	}
+
+	body := msg.PlainText()
+	if len(body) > 20000 {
+		body = body[:20000]
+	}
+
+	payload := map[string]interface{}{
+		"model": config.Model,
+		"input": []map[string]interface{}{
+			newResponsesTextBlock("developer", prompt),
+			newResponsesImageBlock(assistantMessage{
+				Role:    "user",
+				Content: fmt.Sprintf("Subject: %s\n\n%s", msg.Subject, body),
+				Images:  images,
+			}),
+		},
+		"reasoning": map[string]string{"effort": "low"},
+		"text":      map[string]interface{}{"format": bookingsFormat(ingest.KindTransportation, ingest.KindLodging, ingest.KindActivity)},
+	}
+	return requestBookings(ctx, apiKey, config, payload)
+}
+
+// bookingsFormat is the structured output the model fills with the bookings
+// it reads, of the given kinds
+func bookingsFormat(kinds ...string) map[string]interface{} {
+	stringField := map[string]interface{}{"type": "string"}
+	reservationSchema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"kind":         map[string]interface{}{"type": "string", "enum": kinds},
+			"type":         stringField,
+			"name":         stringField,
+			"provider":     stringField,
+			"origin":       stringField,
+			"destination":  stringField,
+			"address":      stringField,
+			"start":        stringField,
+			"end":          stringField,
+			"confirmation": stringField,
+			"costValue":    map[string]interface{}{"type": "number"},
+			"costCurrency": stringField,
+			"notes":        stringField,
+		},
+		"required":             []string{"kind", "type", "name", "provider", "origin", "destination", "address", "start", "end", "confirmation", "costValue", "costCurrency", "notes"},
+		"additionalProperties": false,
+	}
+
+	return map[string]interface{}{
+		"type":   "json_schema",
+		"name":   "bookings",
+		"strict": true,
+		"schema": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"reservations": map[string]interface{}{"type": "array", "items": reservationSchema},
+			},
+			"required":             []string{"reservations"},
+			"additionalProperties": false,
+		},
+	}
+}
+
+// requestBookings sends a request asking for bookings to the model and reads
+// them from its answer
+func requestBookings(ctx context.Context, apiKey string, config assistantConfig, payload map[string]interface{}) ([]ingest.Reservation, error) {
+	response, err := postResponsesAPI(ctx, apiKey, payload, config.RequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimSpace(strings.Join(response.OutputText, ""))
+	if text == "" {
+		text = extractFallbackOutput(*response)
+	}
+
+	var result struct {
+		Reservations []ingest.Reservation `json:"reservations"`
+	}
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
+		return nil, err
+	}
+	if len(result.Reservations) == 0 {
+		return nil, errors.New("no booking found")
+	}
+	return result.Reservations, nil
+}
@@ -0,0 +1,201 @@
+package routes
+
+import (
+	"backend/trips"
+	bt "backend/types"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// maxAttachmentsPerUpload caps the files sent in one upload
+const maxAttachmentsPerUpload = 10
+
+// thumbnailTypes are the images attachment thumbnails can be made of
+var thumbnailTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+// UploadItemAttachments keeps the files uploaded as "files", tickets,
+// confirmation PDFs or photos, as attachments of an activity, lodging or
+// transportation. Files too large or of a type attachments cannot have are
+// turned down one by one, the others are kept.
+func UploadItemAttachments(e *core.RequestEvent, collection string) error {
+	trip := e.Get("trip").(*core.Record)
+	if !trips.CanEdit(requestTripRole(e)) {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "viewers cannot change " + collection})
+	}
+
+	record, err := ensureTripRecord(e.App, collection, e.Request.PathValue("recordId"), trip.Id)
+	if err != nil || !trips.ItemVisible(collection, trips.ItemPrivacy(record).Item, requestTripRole(e)) {
+		return e.NotFoundError("Item not found", err)
+	}
+
+	attachments, err := e.App.FindCollectionByNameOrId("trip_attachments")
+	if err != nil {
+		return err
+	}
+	field := attachments.Fields.GetByName("file").(*core.FileField)
+
+	if err := e.Request.ParseMultipartForm(field.MaxSize); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "files are required"})
+	}
+	headers := e.Request.MultipartForm.File["files"]
+	if len(headers) == 0 {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "files are required"})
+	}
+	if len(headers) > maxAttachmentsPerUpload {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("upload at most %d files at once", maxAttachmentsPerUpload)})
+	}
+
+	type upload struct {
+		name     string
+		mimeType string
+		data     []byte
+	}
+	uploads := make([]upload, 0, len(headers))
+	rejected := make([]bt.RejectedFile, 0)
+	for _, header := range headers {
+		if header.Size > field.MaxSize {
+			rejected = append(rejected, bt.RejectedFile{Name: header.Filename, Reason: fmt.Sprintf("the file must be smaller than %d MB", field.MaxSize>>20)})
+			continue
+		}
+		file, err := header.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(io.LimitReader(file, field.MaxSize+1))
+		file.Close()
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) > field.MaxSize {
+			rejected = append(rejected, bt.RejectedFile{Name: header.Filename, Reason: fmt.Sprintf("the file must be smaller than %d MB", field.MaxSize>>20)})
+			continue
+		}
+		// the type is read from the content, like the file field does
+		detected := mimetype.Detect(data)
+		if !slices.ContainsFunc(field.MimeTypes, detected.Is) {
+			rejected = append(rejected, bt.RejectedFile{Name: header.Filename, Reason: fmt.Sprintf("%s files cannot be attached, use a PDF, an image, a text file or a wallet pass", detected.String())})
+			continue
+		}
+		uploads = append(uploads, upload{name: header.Filename, mimeType: detected.String(), data: data})
+	}
+	if len(uploads) == 0 {
+		return e.JSON(http.StatusUnprocessableEntity, map[string]any{
+			"error":    "none of the files can be attached",
+			"rejected": rejected,
+		})
+	}
+
+	saved := make([]bt.ItemAttachment, 0, len(uploads))
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		references := record.GetStringSlice("attachmentReferences")
+		for _, u := range uploads {
+			attachment, err := saveTripAttachmentFile(txApp, trip.Id, u.name, u.data)
+			if err != nil {
+				return err
+			}
+			references = append(references, attachment.Id)
+			saved = append(saved, itemAttachment(attachment, u.mimeType, len(u.data)))
+		}
+		record.Set("attachmentReferences", references)
+		return txApp.Save(record)
+	})
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusCreated, map[string]any{
+		"attachments": saved,
+		"rejected":    rejected,
+	})
+}
+
+// DetachItemAttachment takes an attachment off an activity, lodging or
+// transportation. The file is deleted once no other record of the trip
+// links to it.
+func DetachItemAttachment(e *core.RequestEvent, collection string) error {
+	trip := e.Get("trip").(*core.Record)
+	if !trips.CanEdit(requestTripRole(e)) {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "viewers cannot change " + collection})
+	}
+
+	record, err := ensureTripRecord(e.App, collection, e.Request.PathValue("recordId"), trip.Id)
+	if err != nil || !trips.ItemVisible(collection, trips.ItemPrivacy(record).Item, requestTripRole(e)) {
+		return e.NotFoundError("Item not found", err)
+	}
+	attachmentId := e.Request.PathValue("attachmentId")
+	references := record.GetStringSlice("attachmentReferences")
+	if !slices.Contains(references, attachmentId) {
+		return e.NotFoundError("Attachment not found", nil)
+	}
+
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		record.Set("attachmentReferences", slices.DeleteFunc(references, func(id string) bool {
+			return id == attachmentId
+		}))
+		if err := txApp.Save(record); err != nil {
+			return err
+		}
+
+		linked, err := attachmentLinked(txApp, trip.Id, attachmentId)
+		if err != nil || linked {
+			return err
+		}
+		attachment, err := ensureTripRecord(txApp, "trip_attachments", attachmentId, trip.Id)
+		if err != nil {
+			// the link pointed to a file that is gone already
+			return nil
+		}
+		return txApp.Delete(attachment)
+	})
+	if err != nil {
+		return err
+	}
+	return e.NoContent(http.StatusNoContent)
+}
+
+// attachmentLinked reports whether a record of the trip still links to the
+// attachment
+func attachmentLinked(app core.App, tripId string, attachmentId string) (bool, error) {
+	for _, collection := range trips.EventCollections {
+		c, err := app.FindCollectionByNameOrId(collection)
+		if err != nil {
+			return false, err
+		}
+		if c.Fields.GetByName("attachmentReferences") == nil {
+			continue
+		}
+		records, err := app.FindAllRecords(collection, dbx.HashExp{"trip": tripId})
+		if err != nil {
+			return false, err
+		}
+		for _, record := range records {
+			if slices.Contains(record.GetStringSlice("attachmentReferences"), attachmentId) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func itemAttachment(attachment *core.Record, mimeType string, size int) bt.ItemAttachment {
+	file := attachment.GetString("file")
+	result := bt.ItemAttachment{
+		Id:       attachment.Id,
+		Name:     attachment.GetString("name"),
+		File:     file,
+		MimeType: mimeType,
+		Size:     size,
+		Url:      fmt.Sprintf("/api/files/%s/%s/%s", attachment.Collection().Id, attachment.Id, file),
+	}
+	if slices.ContainsFunc(thumbnailTypes, func(t string) bool { return strings.HasPrefix(mimeType, t) }) {
+		result.Thumb = result.Url + "?thumb=100x100"
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"backend/trips"
+	bt "backend/types"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// LodgingShares returns what each participant owes for the lodgings, based
+// on who sleeps in which room. Costs the owner keeps private are left out for
+// everyone else.
+func LodgingShares(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	return e.JSON(http.StatusOK, trips.LodgingShares(e.App, trip, requestTripRole(e)))
+}
+
+// assistantRoomsSchema describes the rooms argument of the lodging tools. The
+// model always sends the whole list, which keeps "put the kids in the second
+// room" a single update.
+func assistantRoomsSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "array",
+		"description": "The complete list of rooms, replacing the current one. Keep unchanged rooms as they are. Occupants must be participant names.",
+		"items": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"name":          map[string]interface{}{"type": "string", "description": "Room name or number"},
+				"type":          map[string]interface{}{"type": "string", "description": "Room type, e.g. double, twin, suite"},
+				"capacity":      map[string]interface{}{"type": "integer", "description": "How many people the room sleeps"},
+				"occupants":     map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+				"confirmation":  map[string]interface{}{"type": "string"},
+				"cost_value":    map[string]interface{}{"type": "number"},
+				"cost_currency": map[string]interface{}{"type": "string"},
+			},
+			"required": []string{"name"},
+		},
+	}
+}
+
+// assistantRooms converts the rooms argument, the second value is false when
+// the proposal does not touch the rooms
+func assistantRooms(value interface{}) ([]bt.Room, bool) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	rooms := make([]bt.Room, 0, len(items))
+	for _, item := range items {
+		args := mapValue(item)
+		if args == nil {
+			continue
+		}
+		room := bt.Room{
+			Name:             strings.TrimSpace(stringValue(args["name"])),
+			Type:             stringValue(args["type"]),
+			Capacity:         int(floatValue(args["capacity"])),
+			ConfirmationCode: stringValue(args["confirmation"]),
+			Occupants:        make([]string, 0),
+		}
+		if occupants, ok := args["occupants"].([]interface{}); ok {
+			for _, occupant := range occupants {
+				if name := strings.TrimSpace(stringValue(occupant)); name != "" {
+					room.Occupants = append(room.Occupants, name)
+				}
+			}
+		}
+		if value := floatValue(args["cost_value"]); value > 0 {
+			room.Cost = &bt.Cost{Value: value, Currency: stringValue(args["cost_currency"])}
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, true
+}
+
+func summarizeRooms(rooms []bt.Room) string {
+	parts := make([]string, 0, len(rooms))
+	for _, room := range rooms {
+		if len(room.Occupants) == 0 {
+			parts = append(parts, room.Name+": nobody")
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s", room.Name, strings.Join(room.Occupants, ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
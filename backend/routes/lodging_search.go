@@ -0,0 +1,314 @@
+package routes
+
+import (
+	"backend/hotels"
+	"backend/hotels/amadeus"
+	"backend/hotels/booking"
+	"backend/tripcontext"
+	"backend/trips"
+	"backend/validation"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Hotels with free rooms and live prices come from a booking provider the
+// deployment signs up for. SURMAI_LODGING_PROVIDER=amadeus uses the Amadeus
+// Self-Service api with SURMAI_AMADEUS_CLIENT_ID and
+// SURMAI_AMADEUS_CLIENT_SECRET, SURMAI_AMADEUS_URL switching from the test
+// environment to production. SURMAI_LODGING_PROVIDER=booking uses the
+// Booking.com Demand api with SURMAI_BOOKING_AFFILIATE_ID and
+// SURMAI_BOOKING_API_TOKEN. The search is off without a provider.
+
+const (
+	assistantToolSearchLodging = "search_lodging"
+
+	defaultLodgingRadius = 5000
+	maxLodgingRadius     = 30000
+	maxLodgingNights     = 30
+	maxLodgingGuests     = 9
+)
+
+var (
+	errSeveralLodgingCenters = errors.New("the trip has several destinations, pass near")
+	errInvalidLodgingStay    = errors.New("the stay is not valid")
+)
+
+// lodgingStay is what a lodging search asks for, before it is resolved
+// against the trip
+type lodgingStay struct {
+	Near     string
+	CheckIn  string
+	CheckOut string
+	Adults   int
+	Rooms    int
+	Currency string
+	Radius   int
+	Limit    int
+	Language string
+}
+
+// lodgingProvider returns the lodging search provider, or nil when the
+// deployment has none
+func lodgingProvider() hotels.DataProvider {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("SURMAI_LODGING_PROVIDER"))) {
+	case "amadeus":
+		return amadeus.Amadeus{
+			URL:          strings.TrimSpace(os.Getenv("SURMAI_AMADEUS_URL")),
+			ClientId:     os.Getenv("SURMAI_AMADEUS_CLIENT_ID"),
+			ClientSecret: os.Getenv("SURMAI_AMADEUS_CLIENT_SECRET"),
+		}
+	case "booking":
+		return booking.Booking{
+			URL:         strings.TrimSpace(os.Getenv("SURMAI_BOOKING_URL")),
+			AffiliateId: os.Getenv("SURMAI_BOOKING_AFFILIATE_ID"),
+			Token:       os.Getenv("SURMAI_BOOKING_API_TOKEN"),
+		}
+	default:
+		return nil
+	}
+}
+
+func assistantLodgingSearchTools() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"type":        "function",
+			"name":        assistantToolSearchLodging,
+			"description": "Search hotels with free rooms for a stay near a trip destination, with the live total price, cheapest first. Use it instead of searching the web when suggesting where to stay; prices change quickly, so say when they were retrieved.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"near": map[string]interface{}{
+						"type":        "string",
+						"description": "A destination of the trip, an address or lat,lng to stay near. Leave empty when the trip has one destination.",
+					},
+					"check_in": map[string]interface{}{
+						"type":        "string",
+						"description": "Check-in day, YYYY-MM-DD. Leave empty for the first day of the trip.",
+					},
+					"check_out": map[string]interface{}{
+						"type":        "string",
+						"description": "Check-out day, YYYY-MM-DD. Leave empty for the last day of the trip.",
+					},
+					"adults": map[string]interface{}{
+						"type":        "integer",
+						"description": "Guests, the trip participants by default.",
+					},
+					"rooms": map[string]interface{}{
+						"type":        "integer",
+						"description": "Rooms, 1 by default.",
+					},
+					"radius_meters": map[string]interface{}{
+						"type":        "integer",
+						"description": "How far from the place to search, 5000 by default.",
+					},
+				},
+			},
+		},
+	}
+}
+
+// searchLodging resolves the stay against the trip and finds the cheapest
+// offers near it
+func searchLodging(provider hotels.DataProvider, ctx *tripcontext.Context, stay lodgingStay) ([]hotels.Offer, error) {
+	centers, err := placesCenters(ctx, stay.Near, stay.Language)
+	if err != nil {
+		return nil, err
+	}
+	if len(centers) > 1 {
+		return nil, errSeveralLodgingCenters
+	}
+
+	search := hotels.Search{
+		Latitude:     centers[0].Latitude,
+		Longitude:    centers[0].Longitude,
+		RadiusMeters: stay.Radius,
+		Adults:       stay.Adults,
+		Rooms:        max(stay.Rooms, 1),
+		Currency:     strings.ToUpper(strings.TrimSpace(stay.Currency)),
+		Limit:        stay.Limit,
+		Language:     stay.Language,
+	}
+	if search.RadiusMeters <= 0 {
+		search.RadiusMeters = defaultLodgingRadius
+	}
+	if search.Adults <= 0 {
+		search.Adults = max(len(ctx.Participants), 1)
+	}
+	if search.Currency == "" && ctx.Budget != nil {
+		search.Currency = ctx.Budget.Currency
+	}
+
+	if search.CheckIn, search.CheckOut, err = lodgingStayDays(ctx, stay.CheckIn, stay.CheckOut); err != nil {
+		return nil, err
+	}
+	if search.Adults > maxLodgingGuests || search.Rooms > search.Adults {
+		return nil, fmt.Errorf("%w: a search takes 1 to %d guests and at most one room each", errInvalidLodgingStay, maxLodgingGuests)
+	}
+
+	offers, err := provider.Search(search)
+	if err != nil {
+		return nil, err
+	}
+	return hotels.Cheapest(offers, search.Latitude, search.Longitude, search.Nights(), search.Limit), nil
+}
+
+// lodgingStayDays reads the check-in and check-out days, the trip days by
+// default
+func lodgingStayDays(ctx *tripcontext.Context, checkIn string, checkOut string) (time.Time, time.Time, error) {
+	if strings.TrimSpace(checkIn) == "" {
+		checkIn = ctx.Trip.StartDate
+	}
+	if strings.TrimSpace(checkOut) == "" {
+		checkOut = ctx.Trip.EndDate
+	}
+	if checkIn == "" || checkOut == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: pass check_in and check_out, the trip has no dates", errInvalidLodgingStay)
+	}
+
+	start, startOk := parseStayDay(checkIn)
+	end, endOk := parseStayDay(checkOut)
+	if !startOk || !endOk {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: check_in and check_out must be days as YYYY-MM-DD", errInvalidLodgingStay)
+	}
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: check_out must be after check_in", errInvalidLodgingStay)
+	}
+	if end.Sub(start) > maxLodgingNights*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: a stay is at most %d nights", errInvalidLodgingStay, maxLodgingNights)
+	}
+	if start.Before(dayOf(time.Now().UTC()).AddDate(0, 0, -1)) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: check_in is in the past", errInvalidLodgingStay)
+	}
+	return start, end, nil
+}
+
+// parseStayDay reads the day of a date or a local date and time
+func parseStayDay(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) > len(time.DateOnly) {
+		value = value[:len(time.DateOnly)]
+	}
+	day, err := time.Parse(time.DateOnly, value)
+	return day, err == nil
+}
+
+// isLodgingSearchError reports whether the search failed on what was asked
+// rather than on the provider
+func isLodgingSearchError(err error) bool {
+	return errors.Is(err, errNoPlacesCenter) || errors.Is(err, errUnknownPlacesCenter) ||
+		errors.Is(err, errSeveralLodgingCenters) || errors.Is(err, errInvalidLodgingStay)
+}
+
+// answerSearchLodging runs a search_lodging call and returns the output for
+// the model
+func answerSearchLodging(ctx *tripcontext.Context, language string, argsJSON string) string {
+	provider := lodgingProvider()
+	if provider == nil || ctx == nil {
+		return `{"error":"searching hotels is turned off, search the web instead"}`
+	}
+
+	var args struct {
+		Near         string `json:"near"`
+		CheckIn      string `json:"check_in"`
+		CheckOut     string `json:"check_out"`
+		Adults       int    `json:"adults"`
+		Rooms        int    `json:"rooms"`
+		RadiusMeters int    `json:"radius_meters"`
+	}
+	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+		return `{"error":"the arguments are not valid JSON"}`
+	}
+	radius := args.RadiusMeters
+	if radius <= 0 || radius > maxLodgingRadius {
+		radius = defaultLodgingRadius
+	}
+
+	offers, err := searchLodging(provider, ctx, lodgingStay{
+		Near:     args.Near,
+		CheckIn:  args.CheckIn,
+		CheckOut: args.CheckOut,
+		Adults:   args.Adults,
+		Rooms:    args.Rooms,
+		Radius:   radius,
+		Limit:    defaultLookupLimit,
+		Language: language,
+	})
+	if err != nil {
+		return placesToolError(err)
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"offers": offers})
+	if err != nil {
+		return `{"offers":[]}`
+	}
+	return string(data)
+}
+
+// SearchTripLodging finds hotels with free rooms and their live prices for
+// a stay near a trip destination, cheapest first. The stay defaults to the
+// trip days, its participants and the currency of its budget.
+func SearchTripLodging(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	provider := lodgingProvider()
+	if provider == nil {
+		return e.JSON(http.StatusServiceUnavailable, map[string]string{"error": "searching hotels is not configured"})
+	}
+
+	query := e.Request.URL.Query()
+	limit, err := lookupLimit(e)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	stay := lodgingStay{
+		Near:     query.Get("near"),
+		CheckIn:  query.Get("checkIn"),
+		CheckOut: query.Get("checkOut"),
+		Currency: query.Get("currency"),
+		Radius:   defaultLodgingRadius,
+		Limit:    limit,
+		Language: geocodingLanguage(e),
+	}
+	for name, target := range map[string]*int{"adults": &stay.Adults, "rooms": &stay.Rooms} {
+		if value := query.Get(name); value != "" {
+			if *target, err = strconv.Atoi(value); err != nil || *target < 1 {
+				return e.JSON(http.StatusBadRequest, map[string]string{"error": name + " must be a positive number"})
+			}
+		}
+	}
+	if stay.Currency != "" {
+		if stay.Currency, err = validation.NormalizeCost(1, stay.Currency); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+	if value := query.Get("radius"); value != "" {
+		stay.Radius, err = strconv.Atoi(value)
+		if err != nil || stay.Radius < 1 || stay.Radius > maxLodgingRadius {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("radius must be between 1 and %d meters", maxLodgingRadius)})
+		}
+	}
+
+	ctx, err := tripcontext.Build(e.App, trip, trips.SeesPrivate(requestTripRole(e)))
+	if err != nil {
+		return err
+	}
+
+	offers, err := searchLodging(provider, ctx, stay)
+	if isLodgingSearchError(err) {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		e.App.Logger().Warn("Could not search hotels", "error", err, "tripId", trip.Id)
+		return e.JSON(http.StatusBadGateway, map[string]string{"error": "the hotel search is not available"})
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{"offers": offers})
+}
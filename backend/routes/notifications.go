@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"backend/notifications"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const maxListedNotifications = 100
+
+// ListNotifications lists the latest notifications of the user, only the
+// unread ones with ?unread=true
+func ListNotifications(e *core.RequestEvent) error {
+	query := e.App.RecordQuery("notifications").
+		AndWhere(dbx.HashExp{"user": e.Auth.Id}).
+		OrderBy("created DESC").
+		Limit(maxListedNotifications)
+	if e.Request.URL.Query().Get("unread") == "true" {
+		query = query.AndWhere(dbx.NewExp("readAt = ''"))
+	}
+
+	records := make([]*core.Record, 0)
+	if err := query.All(&records); err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, records)
+}
+
+// MarkNotificationsRead marks the notifications with the given ids read, or
+// every notification of the user when there are none
+func MarkNotificationsRead(e *core.RequestEvent) error {
+	var req struct {
+		Ids []string `json:"ids"`
+	}
+	if e.Request.ContentLength != 0 {
+		if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		}
+	}
+
+	query := e.App.RecordQuery("notifications").
+		AndWhere(dbx.HashExp{"user": e.Auth.Id}).
+		AndWhere(dbx.NewExp("readAt = ''"))
+	if len(req.Ids) > 0 {
+		ids := make([]interface{}, 0, len(req.Ids))
+		for _, id := range req.Ids {
+			ids = append(ids, id)
+		}
+		query = query.AndWhere(dbx.In("id", ids...))
+	}
+	records := make([]*core.Record, 0)
+	if err := query.All(&records); err != nil {
+		return err
+	}
+
+	now := types.NowDateTime()
+	for _, record := range records {
+		record.Set("readAt", now)
+		if err := e.App.Save(record); err != nil {
+			return err
+		}
+	}
+	return e.JSON(http.StatusOK, map[string]int{"read": len(records)})
+}
+
+// NotificationPreferences lists every kind of notification with the channel
+// the user gets it on
+func NotificationPreferences(e *core.RequestEvent) error {
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"kinds":       notifications.Kinds,
+		"channels":    []string{notifications.ChannelApp, notifications.ChannelEmail, notifications.ChannelPush, notifications.ChannelOff},
+		"preferences": notifications.Preferences(e.Auth),
+	})
+}
+
+// UpdateNotificationPreferences changes the channels of the kinds given as
+// {"preferences": {"flight_changed": "email"}}
+func UpdateNotificationPreferences(e *core.RequestEvent) error {
+	var req struct {
+		Preferences map[string]string `json:"preferences"`
+	}
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	if err := notifications.SetPreferences(e.Auth, req.Preferences); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := e.App.Save(e.Auth); err != nil {
+		return err
+	}
+	return NotificationPreferences(e)
+}
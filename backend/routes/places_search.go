@@ -0,0 +1,310 @@
+package routes
+
+import (
+	"backend/poi"
+	"backend/poi/opentripmap"
+	"backend/poi/overpass"
+	"backend/tripcontext"
+	"backend/trips"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Places to go near the trip destinations come from OpenStreetMap through
+// Overpass by default. SURMAI_PLACES_PROVIDER=opentripmap uses OpenTripMap
+// with SURMAI_OPENTRIPMAP_API_KEY instead, none turns the search off, and
+// SURMAI_OVERPASS_URL points at a self-hosted Overpass server.
+
+const (
+	assistantToolSearchPlaces = "search_places"
+
+	defaultPlacesRadius = 2000
+	maxPlacesRadius     = 20000
+	// destinations searched when no place is given
+	maxPlacesCenters = 5
+)
+
+var (
+	errNoPlacesCenter      = errors.New("the trip has no destination with coordinates, pass near")
+	errUnknownPlacesCenter = errors.New("near is not a destination of the trip or a known place")
+)
+
+// placesCenter is a point the places are searched around
+type placesCenter struct {
+	Name      string
+	Latitude  float64
+	Longitude float64
+}
+
+// nearbyPlace is a place found with the destination it is near
+type nearbyPlace struct {
+	poi.Place
+	Near string `json:"near,omitempty"`
+}
+
+// placesProvider returns the places provider, or nil when the deployment
+// turned the search off
+func placesProvider() poi.DataProvider {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("SURMAI_PLACES_PROVIDER"))) {
+	case "none":
+		return nil
+	case "opentripmap":
+		return opentripmap.OpenTripMap{ApiKey: os.Getenv("SURMAI_OPENTRIPMAP_API_KEY")}
+	default:
+		return overpass.Overpass{URL: strings.TrimSpace(os.Getenv("SURMAI_OVERPASS_URL"))}
+	}
+}
+
+func assistantPlacesTools() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"type":        "function",
+			"name":        assistantToolSearchPlaces,
+			"description": "Search attractions, museums, restaurants, cafes, bars, parks and viewpoints near the trip destinations, nearest first, from map data. Prefer it over searching the web to find places to go; search the web for reviews, prices or opening times it does not have.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"query": map[string]interface{}{
+						"type":        "string",
+						"description": "Words in the name of the place, such as pizza or Louvre. Leave empty to list the places of the categories.",
+					},
+					"near": map[string]interface{}{
+						"type":        "string",
+						"description": "A destination of the trip, an address or lat,lng to search around. Leave empty to search around all the destinations.",
+					},
+					"categories": map[string]interface{}{
+						"type":  "array",
+						"items": map[string]interface{}{"type": "string", "enum": poi.Categories},
+					},
+					"radius_meters": map[string]interface{}{
+						"type":        "integer",
+						"description": "How far from the place to search, 2000 by default.",
+					},
+				},
+			},
+		},
+	}
+}
+
+// searchPlaces finds the places around near, or around the destinations of
+// the trip when it is empty, nearest first
+func searchPlaces(provider poi.DataProvider, ctx *tripcontext.Context, search poi.Search, near string) ([]nearbyPlace, error) {
+	centers, err := placesCenters(ctx, near, search.Language)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]nearbyPlace, 0)
+	seen := map[string]bool{}
+	for _, center := range centers {
+		search.Latitude, search.Longitude = center.Latitude, center.Longitude
+		places, err := provider.Search(search)
+		if err != nil {
+			return nil, err
+		}
+		for _, place := range poi.Nearest(places, center.Latitude, center.Longitude, search.Limit) {
+			if !seen[place.Id] {
+				seen[place.Id] = true
+				found = append(found, nearbyPlace{Place: place, Near: center.Name})
+			}
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].DistanceKm < found[j].DistanceKm
+	})
+	if search.Limit > 0 && len(found) > search.Limit {
+		found = found[:search.Limit]
+	}
+	return found, nil
+}
+
+// placesCenters resolves near from coordinates, a destination of the trip or
+// an address
+func placesCenters(ctx *tripcontext.Context, near string, language string) ([]placesCenter, error) {
+	near = strings.TrimSpace(near)
+	if near == "" {
+		centers := make([]placesCenter, 0)
+		for _, destination := range ctx.Destinations {
+			if center, ok := destinationCenter(destination); ok && len(centers) < maxPlacesCenters {
+				centers = append(centers, center)
+			}
+		}
+		if len(centers) == 0 {
+			return nil, errNoPlacesCenter
+		}
+		return centers, nil
+	}
+
+	if lat, lng, ok := parseLatLng(near); ok {
+		return []placesCenter{{Latitude: lat, Longitude: lng}}, nil
+	}
+	for _, destination := range ctx.Destinations {
+		if strings.EqualFold(strings.TrimSpace(destination.Name), near) {
+			if center, ok := destinationCenter(destination); ok {
+				return []placesCenter{center}, nil
+			}
+		}
+	}
+
+	if geocoder == nil {
+		return nil, errUnknownPlacesCenter
+	}
+	found, err := geocoder.Search(near, 1, language)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, errUnknownPlacesCenter
+	}
+	return []placesCenter{{Name: found[0].Name, Latitude: found[0].Latitude, Longitude: found[0].Longitude}}, nil
+}
+
+func destinationCenter(destination tripcontext.Destination) (placesCenter, bool) {
+	lat, latErr := strconv.ParseFloat(destination.Latitude, 64)
+	lng, lngErr := strconv.ParseFloat(destination.Longitude, 64)
+	if latErr != nil || lngErr != nil {
+		return placesCenter{}, false
+	}
+	return placesCenter{Name: destination.Name, Latitude: lat, Longitude: lng}, true
+}
+
+// parseLatLng reads "lat,lng"
+func parseLatLng(value string) (float64, float64, bool) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	lat, latErr := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	lng, lngErr := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if latErr != nil || lngErr != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return 0, 0, false
+	}
+	return lat, lng, true
+}
+
+// placesCategories reads the categories, comma separated or repeated
+func placesCategories(values []string) ([]string, error) {
+	categories := make([]string, 0)
+	for _, value := range values {
+		for _, category := range strings.Split(value, ",") {
+			category = strings.ToLower(strings.TrimSpace(category))
+			if category == "" {
+				continue
+			}
+			if !poi.IsCategory(category) {
+				return nil, fmt.Errorf("category must be one of %s", strings.Join(poi.Categories, ", "))
+			}
+			categories = append(categories, category)
+		}
+	}
+	return categories, nil
+}
+
+// answerSearchPlaces runs a search_places call and returns the output for
+// the model
+func answerSearchPlaces(ctx *tripcontext.Context, language string, argsJSON string) string {
+	provider := placesProvider()
+	if provider == nil || ctx == nil {
+		return `{"error":"searching places is turned off, search the web instead"}`
+	}
+
+	var args struct {
+		Query        string   `json:"query"`
+		Near         string   `json:"near"`
+		Categories   []string `json:"categories"`
+		RadiusMeters int      `json:"radius_meters"`
+	}
+	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+		return `{"error":"the arguments are not valid JSON"}`
+	}
+	categories, err := placesCategories(args.Categories)
+	if err != nil {
+		return placesToolError(err)
+	}
+	radius := args.RadiusMeters
+	if radius <= 0 || radius > maxPlacesRadius {
+		radius = defaultPlacesRadius
+	}
+
+	places, err := searchPlaces(provider, ctx, poi.Search{
+		Query:        args.Query,
+		Categories:   categories,
+		RadiusMeters: radius,
+		Limit:        defaultLookupLimit,
+		Language:     language,
+	}, args.Near)
+	if err != nil {
+		return placesToolError(err)
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"places": places})
+	if err != nil {
+		return `{"places":[]}`
+	}
+	return string(data)
+}
+
+func placesToolError(err error) string {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(data)
+}
+
+// SearchTripPlaces finds attractions, museums, restaurants and other places
+// to go near the trip destinations, or near the place given as near: a
+// destination name, an address or lat,lng
+func SearchTripPlaces(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	provider := placesProvider()
+	if provider == nil {
+		return e.JSON(http.StatusServiceUnavailable, map[string]string{"error": "searching places is turned off"})
+	}
+
+	query := e.Request.URL.Query()
+	categories, err := placesCategories(query["category"])
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	limit, err := lookupLimit(e)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	radius := defaultPlacesRadius
+	if value := query.Get("radius"); value != "" {
+		radius, err = strconv.Atoi(value)
+		if err != nil || radius < 1 || radius > maxPlacesRadius {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("radius must be between 1 and %d meters", maxPlacesRadius)})
+		}
+	}
+
+	ctx, err := tripcontext.Build(e.App, trip, trips.SeesPrivate(requestTripRole(e)))
+	if err != nil {
+		return err
+	}
+
+	places, err := searchPlaces(provider, ctx, poi.Search{
+		Query:        strings.TrimSpace(query.Get("q")),
+		Categories:   categories,
+		RadiusMeters: radius,
+		Limit:        limit,
+		Language:     geocodingLanguage(e),
+	}, query.Get("near"))
+	if errors.Is(err, errNoPlacesCenter) || errors.Is(err, errUnknownPlacesCenter) {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		e.App.Logger().Warn("Could not search places", "error", err, "tripId", trip.Id)
+		return e.JSON(http.StatusBadGateway, map[string]string{"error": "the places search is not available"})
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{"places": places})
+}
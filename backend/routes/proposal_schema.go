@@ -0,0 +1,88 @@
+package routes
+
+import (
+	"backend/proposals"
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// proposalShims upgrade the arguments of a proposal from the schema version
+// of the key to the next one. A shim may rename the tool as well.
+var proposalShims = map[int]func(tool string, args map[string]interface{}) (string, map[string]interface{}){
+	// proposals made before they were versioned may carry arguments the
+	// tools no longer take
+	0: func(tool string, args map[string]interface{}) (string, map[string]interface{}) {
+		return tool, dropUnknownArguments(tool, args)
+	},
+}
+
+// migrateProposal brings the arguments of a proposal made with older tool
+// schemas to the current ones. Proposals from a newer server cannot be
+// applied.
+func migrateProposal(proposal *proposals.Proposal) error {
+	if proposal.SchemaVersion > proposals.SchemaVersion {
+		return fmt.Errorf("the proposal was made by a newer version of surmai (schema %d)", proposal.SchemaVersion)
+	}
+	for proposal.SchemaVersion < proposals.SchemaVersion {
+		shim, ok := proposalShims[proposal.SchemaVersion]
+		if !ok {
+			return fmt.Errorf("proposals of schema %d can no longer be applied", proposal.SchemaVersion)
+		}
+		proposal.Tool, proposal.Arguments = shim(proposal.Tool, proposal.Arguments)
+		proposal.SchemaVersion++
+	}
+	return nil
+}
+
+// dropUnknownArguments keeps the arguments the current schema of the tool
+// declares, all of them for tools without a schema
+func dropUnknownArguments(tool string, args map[string]interface{}) map[string]interface{} {
+	properties := assistantToolProperties(tool)
+	if properties == nil {
+		return args
+	}
+	kept := make(map[string]interface{}, len(args))
+	for key, value := range args {
+		if _, ok := properties[key]; ok {
+			kept[key] = value
+		}
+	}
+	return kept
+}
+
+// assistantToolProperties is the properties of the parameters of a proposal
+// tool
+func assistantToolProperties(tool string) map[string]interface{} {
+	definitions := append(assistantFunctionTools(), assistantCarRentalTools()...)
+	definitions = append(definitions, assistantDiningTools()...)
+	definitions = append(definitions, assistantExpenseTools()...)
+	definitions = append(definitions, assistantPollTools()...)
+	for _, definition := range definitions {
+		if stringValue(definition["name"]) == tool {
+			if properties, ok := mapValue(definition["parameters"])["properties"].(map[string]interface{}); ok {
+				return properties
+			}
+		}
+	}
+	return nil
+}
+
+// RestorePendingProposals puts the proposals still waiting for a decision
+// back in the store when the server starts, upgraded to the current tool
+// schemas. The ones that cannot be upgraded are marked failed.
+func RestorePendingProposals(app core.App) {
+	pending, err := proposals.Pending(app)
+	if err != nil {
+		app.Logger().Warn("Could not restore pending proposals", "error", err)
+		return
+	}
+
+	for _, proposal := range pending {
+		if err := migrateProposal(proposal); err != nil {
+			proposals.RecordDecision(app, proposal, proposals.StatusFailed, "", "", err.Error())
+			continue
+		}
+		proposals.StoreUnique(proposal)
+	}
+}
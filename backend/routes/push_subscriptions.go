@@ -0,0 +1,160 @@
+package routes
+
+import (
+	"backend/push"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// pushSubscriptionRequest is a browser PushSubscription as its toJSON()
+// gives it for web push, or the server, topic and token of ntfy and Gotify
+type pushSubscriptionRequest struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+	Server string `json:"server"`
+	Topic  string `json:"topic"`
+	Token  string `json:"token"`
+}
+
+// PushConfig tells the clients what they need to subscribe, the public key
+// browsers subscribe with among it
+func PushConfig(e *core.RequestEvent) error {
+	config := map[string]interface{}{"kinds": push.Kinds}
+	if keys, err := push.LoadVAPIDKeys(e.App); err == nil {
+		config["webPushPublicKey"] = keys.PublicKey
+	}
+	return e.JSON(http.StatusOK, config)
+}
+
+// ListPushSubscriptions lists the subscriptions of the user
+func ListPushSubscriptions(e *core.RequestEvent) error {
+	records, err := e.App.FindRecordsByFilter("push_subscriptions", "user = {:user}", "-created", 0, 0, dbx.Params{"user": e.Auth.Id})
+	if err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, records)
+}
+
+// CreatePushSubscription adds a place the user gets pushes on. Subscribing
+// again to the same endpoint updates the subscription, the token is kept
+// when none is given.
+func CreatePushSubscription(e *core.RequestEvent) error {
+	var req pushSubscriptionRequest
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	endpoint, err := pushSubscriptionEndpoint(req)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	record, _ := e.App.FindFirstRecordByFilter("push_subscriptions",
+		"user = {:user} && kind = {:kind} && endpoint = {:endpoint} && topic = {:topic}",
+		dbx.Params{"user": e.Auth.Id, "kind": req.Kind, "endpoint": endpoint, "topic": strings.TrimSpace(req.Topic)})
+	status := http.StatusOK
+	if record == nil {
+		collection, err := e.App.FindCollectionByNameOrId("push_subscriptions")
+		if err != nil {
+			return err
+		}
+		record = core.NewRecord(collection)
+		record.Set("user", e.Auth.Id)
+		record.Set("kind", req.Kind)
+		record.Set("endpoint", endpoint)
+		record.Set("topic", strings.TrimSpace(req.Topic))
+		status = http.StatusCreated
+	}
+	record.Set("name", strings.TrimSpace(req.Name))
+	if token := strings.TrimSpace(req.Token); token != "" {
+		record.Set("token", token)
+	}
+	record.Set("p256dh", req.Keys.P256dh)
+	record.Set("auth", req.Keys.Auth)
+	record.Set("lastError", "")
+	if err := e.App.Save(record); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return e.JSON(status, record)
+}
+
+// pushSubscriptionEndpoint checks that the request has what its kind of
+// subscription needs and returns where the pushes go
+func pushSubscriptionEndpoint(req pushSubscriptionRequest) (string, error) {
+	endpoint := strings.TrimSpace(req.Endpoint)
+	switch req.Kind {
+	case push.KindWebPush:
+		if req.Keys.P256dh == "" || req.Keys.Auth == "" {
+			return "", errors.New("a web push subscription needs its keys")
+		}
+		if parsed, err := url.Parse(endpoint); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return "", errors.New("endpoint must be an https URL")
+		}
+		return endpoint, nil
+	case push.KindNtfy, push.KindGotify:
+		endpoint = strings.TrimSuffix(strings.TrimSpace(req.Server), "/")
+		// self hosted servers often live on the local network without TLS
+		if parsed, err := url.Parse(endpoint); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return "", errors.New("server must be an http or https URL")
+		}
+		if req.Kind == push.KindNtfy && strings.Trim(strings.TrimSpace(req.Topic), "/") == "" {
+			return "", errors.New("an ntfy subscription needs a topic")
+		}
+		if req.Kind == push.KindGotify && strings.TrimSpace(req.Token) == "" {
+			return "", errors.New("a Gotify subscription needs an application token")
+		}
+		return endpoint, nil
+	}
+	return "", errors.New("kind must be one of " + strings.Join(push.Kinds, ", "))
+}
+
+// DeletePushSubscription stops the pushes to one subscription of the user
+func DeletePushSubscription(e *core.RequestEvent) error {
+	record, err := findPushSubscription(e)
+	if err != nil {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "subscription not found"})
+	}
+	if err := e.App.Delete(record); err != nil {
+		return err
+	}
+	return e.NoContent(http.StatusNoContent)
+}
+
+// TestPushSubscription sends a test message, so the user sees that the
+// pushes reach the device
+func TestPushSubscription(e *core.RequestEvent) error {
+	record, err := findPushSubscription(e)
+	if err != nil {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "subscription not found"})
+	}
+
+	err = push.Deliver(e.App, record, push.Message{
+		Title: "Surmai",
+		Body:  "Notifications reach this device.",
+		Link:  strings.TrimSuffix(e.App.Settings().Meta.AppURL, "/"),
+		Tag:   "test",
+	})
+	if errors.Is(err, push.ErrSubscriptionGone) {
+		return e.JSON(http.StatusGone, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return e.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return e.JSON(http.StatusOK, map[string]bool{"sent": true})
+}
+
+func findPushSubscription(e *core.RequestEvent) (*core.Record, error) {
+	return e.App.FindFirstRecordByFilter("push_subscriptions", "id = {:id} && user = {:user}",
+		dbx.Params{"id": e.Request.PathValue("subscriptionId"), "user": e.Auth.Id})
+}
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"backend/trips"
+	"github.com/pocketbase/pocketbase/core"
+	"net/http"
+)
+
+func RepairTrips(e *core.RequestEvent) error {
+
+	info, err := e.RequestInfo()
+	if err != nil {
+		return err
+	}
+
+	tripId, _ := info.Body["tripId"].(string)
+
+	// only fix things when explicitly asked to
+	dryRun := true
+	if val, ok := info.Body["dryRun"].(bool); ok {
+		dryRun = val
+	}
+
+	report, err := trips.RepairTrips(e.App, tripId, dryRun)
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, report)
+}
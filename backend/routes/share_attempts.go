@@ -0,0 +1,64 @@
+package routes
+
+import (
+	"sync"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// wrong passwords a share link or an address may try before it is locked out
+// for shareAttemptsWindow, counted from the first wrong one
+const (
+	maxSharePasswordAttempts = 10
+	shareAttemptsWindow      = 15 * time.Minute
+)
+
+// shareAttempts counts the wrong passwords per share token and per client
+// address. It is kept apart from the shared cache so clearing that does not
+// lift a lockout.
+var shareAttempts = struct {
+	sync.Mutex
+	counts *gocache.Cache
+}{
+	counts: gocache.New(shareAttemptsWindow, time.Minute),
+}
+
+func shareAttemptKeys(token string, ip string) []string {
+	return []string{"token:" + token, "ip:" + ip}
+}
+
+// sharePasswordLocked reports whether the token or the address used up its
+// attempts, with how long until it may try again
+func sharePasswordLocked(token string, ip string) (bool, time.Duration) {
+	shareAttempts.Lock()
+	defer shareAttempts.Unlock()
+
+	for _, key := range shareAttemptKeys(token, ip) {
+		count, expiresAt, found := shareAttempts.counts.GetWithExpiration(key)
+		if found && count.(int) >= maxSharePasswordAttempts {
+			return true, time.Until(expiresAt)
+		}
+	}
+	return false, 0
+}
+
+func recordSharePasswordFailure(token string, ip string) {
+	shareAttempts.Lock()
+	defer shareAttempts.Unlock()
+
+	for _, key := range shareAttemptKeys(token, ip) {
+		if _, err := shareAttempts.counts.IncrementInt(key, 1); err != nil {
+			shareAttempts.counts.Set(key, 1, gocache.DefaultExpiration)
+		}
+	}
+}
+
+// clearSharePasswordFailures forgets the wrong passwords of the token once the
+// right one was given, the address keeps its count
+func clearSharePasswordFailures(token string) {
+	shareAttempts.Lock()
+	defer shareAttempts.Unlock()
+
+	shareAttempts.counts.Delete("token:" + token)
+}
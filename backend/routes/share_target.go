@@ -0,0 +1,256 @@
+package routes
+
+import (
+	"backend/ingest"
+	"backend/proposals"
+	"backend/trips/import/places"
+	bt "backend/types"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/ringsaturn/tzf"
+)
+
+const sharePrompt = `Extract the travel bookings and places to visit from what the traveler shared from their phone: a link with the text of the page, a note or screenshots. kind is transportation for flights, trains, buses and rental cars, lodging for hotels and rentals, activity for tours, events, restaurants and places to visit. Times are the local time of the place as 2006-01-02T15:04:05, without an offset. A place without a booking is an activity without times, with its address. Leave fields empty when nothing says. Return an empty list when nothing travel related was shared.`
+
+var shareURLPattern = regexp.MustCompile(`https?://\S+`)
+
+// ShareTarget receives what travelers share with the installed app from other
+// apps, following the Web Share Target form ({title, text, url} and "images"
+// files). A link is read like a forwarded email: from the schema.org markup
+// of the page, or by the assistant together with the text and screenshots.
+// Each booking goes to the trip whose dates include it, places without a date
+// to the trip at that destination or the one under way. Bookings become
+// proposals and places saved places, both reviewed like an import. A tripId
+// form value picks the trip.
+func ShareTarget(e *core.RequestEvent, finder tzf.F) error {
+	if err := e.Request.ParseMultipartForm(maxAssistantImages * maxAssistantImageBytes); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid share"})
+	}
+
+	msg := &ingest.Message{
+		Subject: strings.TrimSpace(e.Request.FormValue("title")),
+		Text:    strings.TrimSpace(e.Request.FormValue("text")),
+	}
+	// apps often put the link in the text instead of the url field
+	link := strings.TrimSpace(e.Request.FormValue("url"))
+	if link == "" {
+		link = shareURLPattern.FindString(msg.Text)
+	}
+
+	images, err := sharedImages(e)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if link == "" && msg.Text == "" && len(images) == 0 {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "nothing was shared"})
+	}
+
+	if link != "" {
+		page, err := ingest.FetchPage(e.Request.Context(), link)
+		if err != nil {
+			e.App.Logger().Warn("Could not read the shared page", "error", err, "userId", e.Auth.Id)
+		}
+		msg.HTML = page
+		if !strings.Contains(msg.Text, link) {
+			msg.Text = strings.TrimSpace(msg.Text + "\n" + link)
+		}
+		if page != "" {
+			msg.Text = strings.TrimSpace(msg.Text + "\n\n" + (&ingest.Message{HTML: page}).PlainText())
+		}
+	}
+
+	source := "schema.org"
+	reservations := ingest.ExtractReservations(msg.HTML)
+	if len(reservations) == 0 {
+		source = "assistant"
+		reservations, err = extractReservationsWithAssistant(e.Request.Context(), loadAssistantConfig(e.App), sharePrompt, msg, images)
+		if err != nil {
+			e.App.Logger().Warn("Could not read the share", "error", err, "userId", e.Auth.Id)
+			return e.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "nothing travel related could be read from the share"})
+		}
+	}
+
+	tag := strings.TrimSpace(e.Request.FormValue("tripId"))
+	candidates, err := inboundEmailTrips(e.App, e.Auth, tag)
+	if err != nil {
+		return err
+	}
+
+	locale := loadAssistantLocale(e.Auth)
+	created := make([]map[string]interface{}, 0)
+	saved := make([]map[string]interface{}, 0)
+	unmatched := make([]ingest.Reservation, 0)
+	tripsById := map[string]*core.Record{}
+	issued := map[string][]*proposals.Proposal{}
+	savedPlaces := map[string][]*bt.Activity{}
+	for _, reservation := range reservations {
+		trip := matchSharedTrip(candidates, reservation, tag != "", time.Now().UTC())
+		if trip == nil {
+			unmatched = append(unmatched, reservation)
+			continue
+		}
+
+		if reservation.Kind == ingest.KindActivity && reservation.Start == "" {
+			savedPlaces[trip.Id] = append(savedPlaces[trip.Id], places.Activities([]places.Place{{
+				Name:     reservation.Name,
+				Address:  reservation.Address,
+				Notes:    reservation.Notes,
+				Category: reservation.Type,
+				URL:      link,
+			}}, "", finder)...)
+			tripsById[trip.Id] = trip
+			continue
+		}
+
+		tool, args := reservationProposal(reservation)
+		if tool == "" {
+			unmatched = append(unmatched, reservation)
+			continue
+		}
+		resolveNaturalTimes(tool, args, locale)
+		if err := validateProposalArguments(tool, args); err != nil {
+			unmatched = append(unmatched, reservation)
+			continue
+		}
+
+		assumption := "Read from what you shared."
+		if msg.Subject != "" {
+			assumption = fmt.Sprintf("Read from \"%s\", which you shared.", msg.Subject)
+		}
+		proposal := &proposals.Proposal{
+			ID:          uuid.NewString(),
+			TripID:      trip.Id,
+			Tool:        tool,
+			Arguments:   args,
+			Summary:     summarizeProposal(tool, args, locale),
+			Assumptions: []string{assumption},
+			RequestedBy: e.Auth.Id,
+			CreatedAt:   time.Now().UTC(),
+			ExpiresAt:   time.Now().UTC().Add(inboundEmailProposalTTL),
+		}
+		stored, isNew := proposals.StoreUnique(proposal)
+		if isNew {
+			proposals.RecordIssued(e.App, stored, e.Auth.Id)
+			tripsById[trip.Id] = trip
+			issued[trip.Id] = append(issued[trip.Id], stored)
+		}
+
+		payload := proposalPayload(stored)
+		payload["tripId"] = trip.Id
+		created = append(created, payload)
+	}
+
+	reviews := make([]*bt.ImportReview, 0, len(tripsById))
+	for tripId, trip := range tripsById {
+		var records []*core.Record
+		if len(savedPlaces[tripId]) > 0 {
+			err := e.App.RunInTransaction(func(txApp core.App) error {
+				var createErr error
+				records, _, createErr = places.CreateActivities(txApp, tripId, savedPlaces[tripId])
+				return createErr
+			})
+			if err != nil {
+				return err
+			}
+			for _, record := range records {
+				saved = append(saved, map[string]interface{}{"tripId": tripId, "activityId": record.Id, "name": record.GetString("name")})
+			}
+		}
+		if len(records) > 0 || len(issued[tripId]) > 0 {
+			reviews = append(reviews, startImportReview(e.App, trip, e.Auth, "share", finder, records, issued[tripId], source == "assistant"))
+		}
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"status":    "processed",
+		"source":    source,
+		"proposals": created,
+		"places":    saved,
+		"unmatched": unmatched,
+		"reviews":   reviews,
+	})
+}
+
+// sharedImages reads the shared screenshots as data URLs
+func sharedImages(e *core.RequestEvent) ([]string, error) {
+	if e.Request.MultipartForm == nil {
+		return nil, nil
+	}
+
+	images := make([]string, 0)
+	for _, header := range e.Request.MultipartForm.File["images"] {
+		if len(images) == maxAssistantImages {
+			return nil, fmt.Errorf("at most %d images can be shared", maxAssistantImages)
+		}
+		if header.Size > maxAssistantImageBytes {
+			return nil, fmt.Errorf("%s is larger than 5MB", header.Filename)
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s", header.Filename)
+		}
+		data, err := io.ReadAll(file)
+		_ = file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s", header.Filename)
+		}
+
+		mimeType := http.DetectContentType(data)
+		if !assistantImageTypes[mimeType] {
+			return nil, fmt.Errorf("%s is not a PNG, JPEG, WebP or GIF image", header.Filename)
+		}
+		images = append(images, fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data)))
+	}
+	return images, nil
+}
+
+// matchSharedTrip picks the trip of a shared booking by its dates, like a
+// forwarded email. Without a date it looks for a trip not over yet with a
+// destination named in the place, soonest first, and falls back to the trip
+// under way. A trip chosen with the share is used whatever the dates.
+func matchSharedTrip(candidates []*core.Record, reservation ingest.Reservation, tagged bool, now time.Time) *core.Record {
+	if reservation.Start != "" || len(candidates) == 1 {
+		return matchInboundTrip(candidates, reservation.Start, tagged)
+	}
+
+	location := strings.ToLower(strings.Join([]string{reservation.Name, reservation.Address, reservation.Origin, reservation.Destination}, " "))
+	upcoming := make([]*core.Record, 0, len(candidates))
+	for _, trip := range candidates {
+		if !trip.GetDateTime("endDate").Time().Before(now.AddDate(0, 0, -1)) {
+			upcoming = append(upcoming, trip)
+		}
+	}
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return upcoming[i].GetDateTime("startDate").Time().Before(upcoming[j].GetDateTime("startDate").Time())
+	})
+
+	for _, trip := range upcoming {
+		var destinations []bt.Destination
+		_ = json.Unmarshal([]byte(trip.GetString("destinations")), &destinations)
+		for _, destination := range destinations {
+			for _, name := range []string{destination.Name, destination.StateName, destination.CountryName} {
+				if len(name) > 2 && strings.Contains(location, strings.ToLower(name)) {
+					return trip
+				}
+			}
+		}
+	}
+
+	for _, trip := range upcoming {
+		if !trip.GetDateTime("startDate").Time().After(now) {
+			return trip
+		}
+	}
+	return nil
+}
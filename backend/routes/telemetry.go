@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"backend/telemetry"
+	bt "backend/types"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// TelemetryStatus shows whether telemetry is on and the exact payload that
+// would be sent, so administrators can check it before opting in
+func TelemetryStatus(e *core.RequestEvent, version bt.VersionInfo) error {
+	_, settings, err := telemetry.LoadSettings(e.App)
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"enabled":            settings.Enabled,
+		"endpointConfigured": telemetry.Endpoint() != "",
+		"lastSentAt":         settings.LastSentAt,
+		"payload":            telemetry.BuildPayload(e.App, settings, version),
+	})
+}
+
+func UpdateTelemetry(e *core.RequestEvent, version bt.VersionInfo) error {
+	info, err := e.RequestInfo()
+	if err != nil {
+		return err
+	}
+
+	enabled, ok := info.Body["enabled"].(bool)
+	if !ok {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "enabled must be true or false"})
+	}
+
+	record, settings, err := telemetry.LoadSettings(e.App)
+	if err != nil {
+		return err
+	}
+	settings.Enabled = enabled
+	if err := telemetry.SaveSettings(e.App, record, settings); err != nil {
+		return err
+	}
+
+	return TelemetryStatus(e, version)
+}
@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"backend/qrcode"
+	"backend/trips"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultQRScale = 8
+	maxQRScale     = 32
+)
+
+// TicketQRCode draws the barcode of a ticket as a QR code PNG, to be saved
+// on the device and scanned at the venue without a connection. Only tickets
+// with a QR code can be drawn, the other formats would not scan.
+func TicketQRCode(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	ticket, err := ensureTripRecord(e.App, "tickets", e.Request.PathValue("ticketId"), trip.Id)
+	if err != nil {
+		return e.NotFoundError("Ticket not found", err)
+	}
+	payload := ticket.GetString("barcode")
+	if !trips.SeesPrivate(requestTripRole(e)) {
+		if !trips.RedactRecord(ticket) {
+			return e.NotFoundError("Ticket not found", nil)
+		}
+		if payload != "" && ticket.GetString("barcode") == "" {
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "the owner keeps the barcode of this ticket private"})
+		}
+	}
+	if payload == "" {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "the ticket has no barcode"})
+	}
+	if format := ticket.GetString("barcodeFormat"); format != "" && format != "qr" {
+		return e.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "only QR codes can be drawn, the ticket has a " + format + " barcode"})
+	}
+
+	scale := defaultQRScale
+	if raw := e.Request.URL.Query().Get("scale"); raw != "" {
+		scale, err = strconv.Atoi(raw)
+		if err != nil || scale < 1 || scale > maxQRScale {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "scale must be a number from 1 to 32"})
+		}
+	}
+
+	// venue scanners cope with smudged or cracked screens better with more
+	// redundancy, which long payloads cannot afford
+	code, err := qrcode.Encode(payload, qrcode.Quartile)
+	if errors.Is(err, qrcode.ErrTooLong) {
+		code, err = qrcode.Encode(payload, qrcode.Low)
+	}
+	if err != nil {
+		return e.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+
+	image, err := code.PNG(scale)
+	if err != nil {
+		return err
+	}
+
+	e.Response.Header().Set("Cache-Control", "private, max-age=86400")
+	return e.Blob(http.StatusOK, "image/png", image)
+}
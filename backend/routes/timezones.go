@@ -0,0 +1,54 @@
+package routes
+
+import (
+	"backend/trips"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/ringsaturn/tzf"
+)
+
+// LookupTimezone finds the IANA timezone at lat and lng with its UTC offset
+// now, or at the local wall clock time given as at, along with the instant
+// that time is in UTC
+func LookupTimezone(e *core.RequestEvent, finder tzf.F) error {
+	query := e.Request.URL.Query()
+	lat, latErr := strconv.ParseFloat(query.Get("lat"), 64)
+	lng, lngErr := strconv.ParseFloat(query.Get("lng"), 64)
+	if latErr != nil || lngErr != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "lat and lng must be valid coordinates"})
+	}
+	if finder == nil {
+		return e.JSON(http.StatusServiceUnavailable, map[string]string{"error": "the timezone database is not loaded"})
+	}
+
+	timezone := finder.GetTimezoneName(lng, lat)
+	loc, err := time.LoadLocation(timezone)
+	if timezone == "" || err != nil {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "no timezone is known at these coordinates"})
+	}
+
+	instant := time.Now().UTC()
+	if at := query.Get("at"); at != "" {
+		wallClock, err := types.ParseDateTime(at)
+		if err != nil || wallClock.IsZero() {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "at must be a date and time such as 2025-06-01 14:30:00"})
+		}
+		utc, _ := trips.UtcInstant(wallClock, timezone)
+		instant = utc.Time()
+	}
+
+	local := instant.In(loc)
+	abbreviation, offset := local.Zone()
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"timezone":      timezone,
+		"abbreviation":  abbreviation,
+		"offset":        local.Format("-07:00"),
+		"offsetSeconds": offset,
+		"utc":           instant.Format(time.RFC3339),
+		"local":         local.Format("2006-01-02T15:04:05"),
+	})
+}
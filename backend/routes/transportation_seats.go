@@ -0,0 +1,49 @@
+package routes
+
+import (
+	bt "backend/types"
+	"strings"
+)
+
+// assistantSeatsSchema describes the seats argument of the transportation
+// tools, the list replaces the current assignments
+func assistantSeatsSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "array",
+		"description": "The complete list of seat or berth assignments, replacing the current one. Participant must be a participant name.",
+		"items": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"participant": map[string]interface{}{"type": "string"},
+				"seat":        map[string]interface{}{"type": "string", "description": "Seat or berth number, e.g. 14C"},
+				"coach":       map[string]interface{}{"type": "string", "description": "Coach or car number on trains"},
+				"kind":        map[string]interface{}{"type": "string", "description": "seat, berth or cabin"},
+			},
+			"required": []string{"participant", "seat"},
+		},
+	}
+}
+
+// assistantSeats converts the seats argument, the second value is false when
+// the proposal does not touch the seats
+func assistantSeats(value interface{}) ([]bt.SeatAssignment, bool) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	seats := make([]bt.SeatAssignment, 0, len(items))
+	for _, item := range items {
+		args := mapValue(item)
+		if args == nil {
+			continue
+		}
+		seats = append(seats, bt.SeatAssignment{
+			Participant: strings.TrimSpace(stringValue(args["participant"])),
+			Seat:        strings.TrimSpace(stringValue(args["seat"])),
+			Coach:       strings.TrimSpace(stringValue(args["coach"])),
+			Kind:        strings.ToLower(strings.TrimSpace(stringValue(args["kind"]))),
+		})
+	}
+	return seats, true
+}
@@ -0,0 +1,234 @@
+package routes
+
+import (
+	"backend/tripcontext"
+	"backend/trips"
+	bt "backend/types"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	autocompleteLimit = 10
+	maxAssistantHints = 5
+	maxRouteHints     = 2
+
+	assistantToolGetTravelHistory = "get_travel_history"
+	// visits sent to the assistant, the most recent ones when there are more
+	maxAssistantVisits = 100
+)
+
+func AutocompleteRoutes(e *core.RequestEvent) error {
+	history, err := trips.TravelHistory(e.App, e.Auth.Id)
+	if err != nil {
+		return err
+	}
+
+	query := strings.ToLower(strings.TrimSpace(e.Request.URL.Query().Get("q")))
+	routeType := strings.TrimSpace(e.Request.URL.Query().Get("type"))
+
+	matches := make([]bt.FrequentRoute, 0)
+	for _, route := range history.Routes {
+		if routeType != "" && !strings.EqualFold(route.Type, routeType) {
+			continue
+		}
+		if query != "" &&
+			!strings.Contains(strings.ToLower(route.Origin), query) &&
+			!strings.Contains(strings.ToLower(route.Destination), query) {
+			continue
+		}
+		matches = append(matches, route)
+		if len(matches) == autocompleteLimit {
+			break
+		}
+	}
+
+	return e.JSON(http.StatusOK, matches)
+}
+
+func AutocompleteLodgings(e *core.RequestEvent) error {
+	history, err := trips.TravelHistory(e.App, e.Auth.Id)
+	if err != nil {
+		return err
+	}
+
+	query := strings.ToLower(strings.TrimSpace(e.Request.URL.Query().Get("q")))
+	city := strings.TrimSpace(e.Request.URL.Query().Get("city"))
+
+	matches := make([]bt.FrequentLodging, 0)
+	for _, lodging := range history.Lodgings {
+		if city != "" && !strings.EqualFold(lodging.City, city) {
+			continue
+		}
+		if query != "" &&
+			!strings.Contains(strings.ToLower(lodging.Name), query) &&
+			!strings.Contains(strings.ToLower(lodging.Address), query) {
+			continue
+		}
+		matches = append(matches, lodging)
+		if len(matches) == autocompleteLimit {
+			break
+		}
+	}
+
+	return e.JSON(http.StatusOK, matches)
+}
+
+// TravelLocations lists where the user was between ?from and ?to, dates or
+// times, as a timeline of the destinations and lodgings of their trips.
+// Without from it goes back to the first trip, without to it ends now.
+func TravelLocations(e *core.RequestEvent) error {
+	from, to, err := locationHistoryRange(e.Request.URL.Query().Get("from"), e.Request.URL.Query().Get("to"))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	history, err := trips.LocationHistory(e.App, e.Auth.Id, from, to)
+	if err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, history)
+}
+
+func locationHistoryRange(fromValue string, toValue string) (types.DateTime, types.DateTime, error) {
+	from := types.DateTime{}
+	to := types.NowDateTime()
+	var err error
+	if strings.TrimSpace(fromValue) != "" {
+		if from, err = parseRangeTime(strings.TrimSpace(fromValue), false); err != nil {
+			return from, to, fmt.Errorf("from must be a date or a time")
+		}
+	}
+	if strings.TrimSpace(toValue) != "" {
+		if to, err = parseRangeTime(strings.TrimSpace(toValue), true); err != nil {
+			return from, to, fmt.Errorf("to must be a date or a time")
+		}
+	}
+	if to.Before(from) {
+		return from, to, fmt.Errorf("from must come before to")
+	}
+	return from, to, nil
+}
+
+func assistantTravelHistoryTools() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"type":        "function",
+			"name":        assistantToolGetTravelHistory,
+			"description": "List where the traveler was on their trips in a period: the destinations of each trip over its dates and the lodgings they stayed at, oldest first, with the countries visited. Use it for questions about previous travel such as where they were last May, when they last went to Japan or where they stayed in Lisbon.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"from": map[string]interface{}{
+						"type":        "string",
+						"description": "First day of the period as 2006-01-02, leave out to start at the first trip.",
+					},
+					"to": map[string]interface{}{
+						"type":        "string",
+						"description": "Last day of the period as 2006-01-02, leave out to end today.",
+					},
+				},
+			},
+		},
+	}
+}
+
+// answerTravelHistory runs a get_travel_history call for the user asking
+// and returns the output for the model
+func answerTravelHistory(app core.App, userId string, argsJSON string) string {
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+		return `{"error":"the arguments are not valid JSON"}`
+	}
+	if app == nil || userId == "" {
+		return `{"visits":[]}`
+	}
+
+	from, to, err := locationHistoryRange(stringValue(args["from"]), stringValue(args["to"]))
+	if err != nil {
+		data, _ := json.Marshal(map[string]string{"error": err.Error()})
+		return string(data)
+	}
+	history, err := trips.LocationHistory(app, userId, from, to)
+	if err != nil {
+		app.Logger().Warn("Could not load the travel history", "error", err, "userId", userId)
+		return `{"visits":[]}`
+	}
+
+	result := map[string]interface{}{
+		"trips":     history.Trips,
+		"countries": history.Countries,
+	}
+	visits := make([]map[string]string, 0, len(history.Visits))
+	for _, visit := range history.Visits {
+		entry := map[string]string{
+			"trip": visit.TripName,
+			"kind": visit.Kind,
+			"name": visit.Name,
+			"from": visit.From.Time().Format(time.DateOnly),
+			"to":   visit.To.Time().Format(time.DateOnly),
+		}
+		if visit.City != "" && visit.City != visit.Name {
+			entry["city"] = visit.City
+		}
+		if visit.Country != "" {
+			entry["country"] = visit.Country
+		}
+		visits = append(visits, entry)
+	}
+	if len(visits) > maxAssistantVisits {
+		result["omittedVisits"] = len(visits) - maxAssistantVisits
+		visits = visits[len(visits)-maxAssistantVisits:]
+	}
+	result["visits"] = visits
+	if len(visits) == 0 {
+		result["message"] = "The traveler has no trip in this period."
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return `{"visits":[]}`
+	}
+	return string(data)
+}
+
+// travelHints turns the user's travel habits into short sentences the
+// assistant can use, favouring the ones about the trip's destinations
+func travelHints(app core.App, userId string, destinations []tripcontext.Destination) []string {
+	if userId == "" {
+		return nil
+	}
+
+	history, err := trips.TravelHistory(app, userId)
+	if err != nil {
+		app.Logger().Warn("Unable to load travel history", "error", err, "userId", userId)
+		return nil
+	}
+
+	hints := make([]string, 0)
+	for _, destination := range destinations {
+		for _, lodging := range history.Lodgings {
+			if lodging.City != "" && strings.EqualFold(lodging.City, destination.Name) {
+				hints = append(hints, fmt.Sprintf("You usually stay at %s in %s (%d stays).", lodging.Name, lodging.City, lodging.Count))
+				break
+			}
+		}
+	}
+
+	for i, route := range history.Routes {
+		if i == maxRouteHints {
+			break
+		}
+		hints = append(hints, fmt.Sprintf("You often take the %s from %s to %s (%d times).", route.Type, route.Origin, route.Destination, route.Count))
+	}
+
+	if len(hints) > maxAssistantHints {
+		hints = hints[:maxAssistantHints]
+	}
+	return hints
+}
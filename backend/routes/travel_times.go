@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"backend/routing"
+	"backend/routing/openrouteservice"
+	"backend/routing/osrm"
+	"backend/trips"
+	bt "backend/types"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// routingProvider returns the directions provider: OSRM by default,
+// openrouteservice with SURMAI_OPENROUTESERVICE_API_KEY, or nil when the
+// deployment turned routing off with SURMAI_ROUTING_PROVIDER=none.
+// SURMAI_ROUTING_URL points at a self-hosted server.
+func routingProvider() routing.DataProvider {
+	baseURL := strings.TrimSpace(os.Getenv("SURMAI_ROUTING_URL"))
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("SURMAI_ROUTING_PROVIDER"))) {
+	case "none":
+		return nil
+	case "openrouteservice":
+		return openrouteservice.OpenRouteService{URL: baseURL, ApiKey: os.Getenv("SURMAI_OPENROUTESERVICE_API_KEY")}
+	default:
+		return osrm.OSRM{URL: baseURL}
+	}
+}
+
+// TripTravelTimes routes the way between consecutive itinerary items by
+// ?mode= (driving, walking, cycling or transit, driving by default) and
+// warns when there is not enough time between them. ?date= limits it to the
+// legs of one day. Public transit is estimated from the roads.
+func TripTravelTimes(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	provider := routingProvider()
+	if provider == nil {
+		return e.JSON(http.StatusServiceUnavailable, map[string]string{"error": "routing is turned off"})
+	}
+
+	query := e.Request.URL.Query()
+	mode := strings.ToLower(strings.TrimSpace(query.Get("mode")))
+	if mode == "" {
+		mode = routing.ModeDriving
+	}
+	if !routing.IsMode(mode) {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "mode must be one of " + strings.Join(routing.Modes, ", ")})
+	}
+	date := strings.TrimSpace(query.Get("date"))
+	if date != "" {
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "date must be YYYY-MM-DD"})
+		}
+	}
+
+	itinerary := trips.BuildItinerary(e.App, trip, requestTripRole(e))
+	legs, err := trips.TravelLegs(itinerary, provider, mode, date)
+	if err != nil {
+		e.App.Logger().Warn("Could not route the itinerary", "error", err, "tripId", trip.Id)
+		return e.JSON(http.StatusBadGateway, map[string]string{"error": "the routing service is not available"})
+	}
+
+	warnings := make([]bt.TravelLeg, 0)
+	for _, leg := range legs {
+		if leg.Warning != "" {
+			warnings = append(warnings, leg)
+		}
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"mode":     mode,
+		"legs":     legs,
+		"warnings": warnings,
+	})
+}
@@ -0,0 +1,194 @@
+package routes
+
+import (
+	"backend/trips"
+	bt "backend/types"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	defaultActivityLimit = 50
+	maxActivityLimit     = 200
+)
+
+// TripActivity lists the changes made to the trip and its items, newest
+// first, with who made them and the fields before and after. ?collection
+// and ?recordId narrow it down to one kind of item or one item. Pages hold
+// limit events, the next one is read with the cursor returned as next.
+// Private items and fields are only shown to the owner, costs and codes are
+// not shown to viewers.
+func TripActivity(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	role := requestTripRole(e)
+	query := e.Request.URL.Query()
+
+	limit := defaultActivityLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxActivityLimit {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("limit must be between 1 and %d", maxActivityLimit)})
+		}
+		limit = parsed
+	}
+
+	filter := dbx.HashExp{"trip": trip.Id}
+	if collection := query.Get("collection"); collection != "" {
+		if !slices.Contains(trips.EventCollections, collection) {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "collection must be one of " + strings.Join(trips.EventCollections, ", ")})
+		}
+		filter["collection"] = collection
+	}
+	if recordId := query.Get("recordId"); recordId != "" {
+		filter["recordId"] = recordId
+	}
+
+	q := e.App.RecordQuery("trip_events").AndWhere(filter).OrderBy("created DESC", "id DESC")
+	if value := query.Get("cursor"); value != "" {
+		at, id, _ := strings.Cut(value, "|")
+		parsed, err := time.Parse(time.RFC3339Nano, at)
+		if err != nil || id == "" {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "cursor must be the next cursor of a previous page"})
+		}
+		created, _ := types.ParseDateTime(parsed)
+		q = q.AndWhere(dbx.NewExp("(created < {:at} OR (created = {:at} AND id < {:id}))", dbx.Params{"at": created.String(), "id": id}))
+	}
+
+	page, next, err := visibleTripEvents(e.App, q, role, limit)
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"events": tripEventViews(e.App, page, role),
+		"next":   next,
+	})
+}
+
+// visibleTripEvents reads the events the role may see until the page is
+// full, the ones it may not see are skipped without shortening the page
+func visibleTripEvents(app core.App, q *dbx.SelectQuery, role string, limit int) ([]*core.Record, string, error) {
+	page := make([]*core.Record, 0, limit)
+	offset := int64(0)
+	for {
+		batch := make([]*core.Record, 0)
+		if err := q.Limit(int64(limit) + 1).Offset(offset).All(&batch); err != nil {
+			return nil, "", err
+		}
+		for _, event := range batch {
+			if !trips.EventVisible(event, role) {
+				continue
+			}
+			if len(page) == limit {
+				last := page[len(page)-1]
+				return page, last.GetDateTime("created").Time().Format(time.RFC3339Nano) + "|" + last.Id, nil
+			}
+			page = append(page, event)
+		}
+		if len(batch) <= limit {
+			return page, "", nil
+		}
+		offset += int64(len(batch))
+	}
+}
+
+func tripEventViews(app core.App, events []*core.Record, role string) []bt.TripEvent {
+	ids := make([]string, 0, len(events))
+	for _, event := range events {
+		if actor := event.GetString("actor"); actor != "" && !slices.Contains(ids, actor) {
+			ids = append(ids, actor)
+		}
+	}
+	users := map[string]*core.Record{}
+	if records, err := app.FindRecordsByIds("users", ids); err == nil {
+		for _, record := range records {
+			users[record.Id] = record
+		}
+	}
+
+	views := make([]bt.TripEvent, 0, len(events))
+	for _, event := range events {
+		var changes []bt.FieldChange
+		_ = event.UnmarshalJSONField("changes", &changes)
+
+		actor := feedUser(users, event.GetString("actor"))
+		if actor == nil {
+			actor = &bt.FeedActor{Type: "system"}
+		}
+		views = append(views, bt.TripEvent{
+			Id:         event.Id,
+			At:         event.GetDateTime("created").Time(),
+			Actor:      actor,
+			Action:     event.GetString("action"),
+			Collection: event.GetString("collection"),
+			RecordId:   event.GetString("recordId"),
+			Label:      event.GetString("label"),
+			Changes:    trips.RedactEventChanges(event, role, changes),
+		})
+	}
+	return views
+}
+
+// recentTripChanges describes the latest changes for the assistant, so it
+// can answer "what changed?" and say who moved what
+func recentTripChanges(app core.App, trip *core.Record, role string) []string {
+	since := types.NowDateTime().AddDate(0, 0, -recentTripChangesDays)
+	q := app.RecordQuery("trip_events").
+		AndWhere(dbx.HashExp{"trip": trip.Id}).
+		AndWhere(dbx.NewExp("created >= {:since}", dbx.Params{"since": since.String()})).
+		OrderBy("created DESC", "id DESC")
+	events, _, err := visibleTripEvents(app, q, role, maxRecentTripChanges)
+	if err != nil {
+		return nil
+	}
+
+	changes := make([]string, 0, len(events))
+	for _, view := range tripEventViews(app, events, role) {
+		who := "the assistant or the server"
+		if view.Actor.Type == "user" && view.Actor.Name != "" {
+			who = view.Actor.Name
+		}
+		line := fmt.Sprintf("%s %s %sd %q (%s %s)", view.At.UTC().Format(time.RFC3339), who, view.Action, view.Label, view.Collection, view.RecordId)
+		if view.Action == trips.EventUpdated {
+			fields := make([]string, 0, len(view.Changes))
+			for _, change := range view.Changes {
+				fields = append(fields, describeFieldChange(change))
+			}
+			line += ": " + strings.Join(fields, "; ")
+		}
+		changes = append(changes, line)
+	}
+	return changes
+}
+
+const (
+	maxRecentTripChanges  = 15
+	recentTripChangesDays = 14
+	maxChangeValueChars   = 60
+)
+
+func describeFieldChange(change bt.FieldChange) string {
+	if change.Redacted {
+		return change.Field + " changed"
+	}
+	value := func(v any) string {
+		if v == nil {
+			return "(empty)"
+		}
+		if text, ok := v.(string); ok {
+			return truncateText(text, maxChangeValueChars)
+		}
+		data, _ := json.Marshal(v)
+		return truncateText(string(data), maxChangeValueChars)
+	}
+	return fmt.Sprintf("%s %s -> %s", change.Field, value(change.From), value(change.To))
+}
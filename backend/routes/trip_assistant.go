@@ -1,6 +1,11 @@
 package routes
 
 import (
+	"backend/cache"
+	"backend/currency"
+	"backend/proposals"
+	"backend/tripcontext"
+	"backend/trips"
 	"bufio"
 	"bytes"
 	"context"
@@ -10,125 +15,74 @@ import (
 	"io"
 	"net/http"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
-	pbtypes "github.com/pocketbase/pocketbase/tools/types"
 )
 
 type assistantMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// Images are data URLs, e.g. screenshots of a booking confirmation
+	Images []string `json:"images,omitempty"`
 }
 
 type tripAssistantRequest struct {
 	Messages []assistantMessage `json:"messages"`
+	// Verbosity is low (default), medium or high
+	Verbosity string `json:"verbosity"`
 }
 
 type tripAssistantResponse struct {
 	Message assistantMessage `json:"message"`
+	TurnID  string           `json:"turnId"`
+	// Truncated is why the reply was cut short, with the message to show
+	// for it, like the truncated event of the stream
+	Truncated        string `json:"truncated,omitempty"`
+	TruncatedMessage string `json:"truncatedMessage,omitempty"`
 }
 
-type tripAssistantContext struct {
-	Trip            basicTrip               `json:"trip"`
-	Notes           string                  `json:"notes,omitempty"`
-	Destinations    []tripDestination       `json:"destinations,omitempty"`
-	Participants    []tripParticipant       `json:"participants,omitempty"`
-	Budget          *costSummary            `json:"budget,omitempty"`
-	Transportations []transportationSummary `json:"transportations,omitempty"`
-	Lodgings        []lodgingSummary        `json:"lodgings,omitempty"`
-	Activities      []activitySummary       `json:"activities,omitempty"`
-	GeneratedAt     string                  `json:"generatedAt"`
-}
-
-type basicTrip struct {
-	Id          string `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	StartDate   string `json:"startDate"`
-	EndDate     string `json:"endDate"`
-}
-
-type tripDestination struct {
-	Name        string `json:"name"`
-	Country     string `json:"country,omitempty"`
-	State       string `json:"state,omitempty"`
-	Timezone    string `json:"timezone,omitempty"`
-	Latitude    string `json:"latitude,omitempty"`
-	Longitude   string `json:"longitude,omitempty"`
-	Category    string `json:"category,omitempty"`
-	Description string `json:"description,omitempty"`
-}
-
-type tripParticipant struct {
-	Name  string `json:"name"`
-	Email string `json:"email,omitempty"`
-}
-
-type costSummary struct {
-	Value    float64 `json:"value"`
-	Currency string  `json:"currency"`
-}
-
-type transportationSummary struct {
-	Id          string                 `json:"id"`
-	Type        string                 `json:"type"`
-	Origin      string                 `json:"origin"`
-	Destination string                 `json:"destination"`
-	Departure   string                 `json:"departure"`
-	Arrival     string                 `json:"arrival,omitempty"`
-	Cost        *costSummary           `json:"cost,omitempty"`
-	Metadata    map[string]interface{} `json:"metadata,omitempty"`
-	Notes       string                 `json:"notes,omitempty"`
-}
-
-type lodgingSummary struct {
-	Id            string                 `json:"id"`
-	Type          string                 `json:"type"`
-	Name          string                 `json:"name"`
-	Address       string                 `json:"address,omitempty"`
-	CheckIn       string                 `json:"checkIn"`
-	CheckOut      string                 `json:"checkOut"`
-	Confirmation  string                 `json:"confirmation,omitempty"`
-	Cost          *costSummary           `json:"cost,omitempty"`
-	Metadata      map[string]interface{} `json:"metadata,omitempty"`
-	ReservationBy string                 `json:"reservationBy,omitempty"`
-}
-
-type activitySummary struct {
-	Id          string                 `json:"id"`
-	Name        string                 `json:"name"`
-	Description string                 `json:"description,omitempty"`
-	Address     string                 `json:"address,omitempty"`
-	Start       string                 `json:"start"`
-	End         string                 `json:"end,omitempty"`
-	Cost        *costSummary           `json:"cost,omitempty"`
-	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+// assistantReply is the outcome of a single call to the Responses API
+type assistantReply struct {
+	Text        string
+	ToolResults []assistantToolResult
+	Proposal    *proposals.Proposal
+	// Calls are the proposal tools called in a reply that is not streamed,
+	// the caller turns them into proposals
+	Calls []responsesAPIMessage
+	// Truncated is why the reply was cut short, empty when it was not
+	Truncated string
 }
 
 type responsesAPIResponse struct {
+	Id         string                `json:"id"`
+	Status     string                `json:"status"`
 	OutputText []string              `json:"output_text"`
 	Output     []responsesAPIMessage `json:"output"`
+	// set when the status is incomplete
+	IncompleteDetails map[string]interface{} `json:"incomplete_details,omitempty"`
 }
 
 type responsesAPIMessage struct {
+	Type    string                     `json:"type"`
 	Role    string                     `json:"role"`
 	Content []responsesAPIContentBlock `json:"content"`
+	Action  map[string]interface{}     `json:"action,omitempty"`
+	// set on function_call items
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	CallId    string `json:"call_id,omitempty"`
 }
 
 type responsesAPIContentBlock struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type        string                   `json:"type"`
+	Text        string                   `json:"text"`
+	Annotations []map[string]interface{} `json:"annotations,omitempty"`
 }
 
-const proposalTTL = 2 * time.Minute
-
 const (
 	assistantToolCreateActivity       = "create_activity"
 	assistantToolCreateLodging        = "create_lodging"
@@ -141,29 +95,24 @@ const (
 	assistantToolDeleteActivity       = "delete_activity"
 	assistantToolDeleteLodging        = "delete_lodging"
 	assistantToolDeleteTransportation = "delete_transportation"
-)
 
-type assistantProposal struct {
-	ID        string
-	TripID    string
-	Tool      string
-	Arguments map[string]interface{}
-	ExpiresAt time.Time
-	CreatedAt time.Time
-}
-
-var proposalStore = struct {
-	sync.RWMutex
-	items map[string]*assistantProposal
-}{
-	items: make(map[string]*assistantProposal),
-}
+	assistantToolSwapActivities = proposals.ToolSwapActivities
+)
 
 const (
 	openAIResponsesEndpoint = "https://api.openai.com/v1/responses"
 	openAIModel             = "gpt-5-mini"
 )
 
+// assistantTransport is shared by the assistant streams, idle connections to
+// the responses endpoint are closed after a while instead of piling up
+var assistantTransport = &http.Transport{
+	Proxy:               http.ProxyFromEnvironment,
+	MaxIdleConnsPerHost: 4,
+	IdleConnTimeout:     90 * time.Second,
+	TLSHandshakeTimeout: 10 * time.Second,
+}
+
 func TripAssistant(e *core.RequestEvent) error {
 	apiKey := strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
 	if apiKey == "" {
@@ -172,10 +121,10 @@ func TripAssistant(e *core.RequestEvent) error {
 		})
 	}
 
-	var req tripAssistantRequest
-	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+	req, err := decodeAssistantRequest(e)
+	if err != nil {
 		return e.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid request body",
+			"error": err.Error(),
 		})
 	}
 
@@ -185,6 +134,19 @@ func TripAssistant(e *core.RequestEvent) error {
 		})
 	}
 
+	verbosity, ok := parseAssistantVerbosity(req.Verbosity)
+	if !ok {
+		return e.JSON(http.StatusBadRequest, map[string]string{
+			"error": "verbosity must be low, medium, or high",
+		})
+	}
+
+	config := loadAssistantConfig(e.App)
+	if !trips.CanEdit(requestTripRole(e)) {
+		config = readOnlyAssistantConfig(config)
+	}
+	locale := loadAssistantLocale(e.Auth)
+
 	tripVal := e.Get("trip")
 	if tripVal == nil {
 		return e.JSON(http.StatusBadRequest, map[string]string{
@@ -199,7 +161,7 @@ func TripAssistant(e *core.RequestEvent) error {
 		})
 	}
 
-	ctx, err := buildTripAssistantContext(e.App, tripRecord)
+	ctx, err := buildTripAssistantContext(e.App, tripRecord, e.Auth.Id, requestTripRole(e), config.IncludeWeather)
 	if err != nil {
 		e.App.Logger().Error("TripAssistant build context error", "error", err, "tripId", tripRecord.Id)
 		return e.JSON(http.StatusInternalServerError, map[string]string{
@@ -207,7 +169,7 @@ func TripAssistant(e *core.RequestEvent) error {
 		})
 	}
 
-	responseInput, err := buildResponsesInput(req.Messages, ctx)
+	responseInput, err := buildResponsesInput(req.Messages, ctx, config, locale)
 	if err != nil {
 		e.App.Logger().Error("TripAssistant failed to build input", "error", err, "tripId", tripRecord.Id)
 		return e.JSON(http.StatusInternalServerError, map[string]string{
@@ -215,7 +177,29 @@ func TripAssistant(e *core.RequestEvent) error {
 		})
 	}
 
-	reply, err := invokeResponsesAPI(e.Request.Context(), apiKey, responseInput)
+	turnID := uuid.NewString()
+	output := newReplyPostProcessor(tripRecord.Id, ctx, locale)
+
+	cacheKey, cacheable := assistantCacheKey(tripRecord.Id, ctx, req.Messages, verbosity, locale)
+	if cacheable {
+		if reply, found := getCachedAssistantReply(cacheKey); found {
+			saveAssistantToolResults(e.App, tripRecord.Id, turnID, reply.ToolResults)
+			return e.JSON(http.StatusOK, tripAssistantResponse{
+				Message: assistantMessage{
+					Role:    "assistant",
+					Content: output.Process(reply.Text),
+				},
+				TurnID: turnID,
+			})
+		}
+	}
+
+	reply, err := invokeResponsesAPI(e.Request.Context(), apiKey, responseInput, config, verbosity, newLocalTools(e.App, tripRecord, e.Auth, ctx, config))
+	if err == nil && reply.Text == "" {
+		// proposals are only offered on the stream, a reply of calls alone
+		// says nothing here
+		err = errors.New("assistant returned an empty message")
+	}
 	if err != nil {
 		e.App.Logger().Error("TripAssistant call failed", "error", err, "tripId", tripRecord.Id)
 		return e.JSON(http.StatusBadGateway, map[string]string{
@@ -223,12 +207,24 @@ func TripAssistant(e *core.RequestEvent) error {
 		})
 	}
 
-	return e.JSON(http.StatusOK, tripAssistantResponse{
+	saveAssistantToolResults(e.App, tripRecord.Id, turnID, reply.ToolResults)
+	if cacheable {
+		cacheAssistantReply(cacheKey, reply)
+	}
+
+	response := tripAssistantResponse{
 		Message: assistantMessage{
 			Role:    "assistant",
-			Content: reply,
+			Content: output.Process(reply.Text),
 		},
-	})
+		TurnID: turnID,
+	}
+	if reply.Truncated != "" {
+		e.App.Logger().Warn("TripAssistant reply truncated", "reason", reply.Truncated, "tripId", tripRecord.Id)
+		response.Truncated = reply.Truncated
+		response.TruncatedMessage = truncationMessage(reply.Truncated)
+	}
+	return e.JSON(http.StatusOK, response)
 }
 
 func TripAssistantStream(e *core.RequestEvent) error {
@@ -239,10 +235,10 @@ func TripAssistantStream(e *core.RequestEvent) error {
 		})
 	}
 
-	var req tripAssistantRequest
-	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+	req, err := decodeAssistantRequest(e)
+	if err != nil {
 		return e.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid request body",
+			"error": err.Error(),
 		})
 	}
 
@@ -252,6 +248,19 @@ func TripAssistantStream(e *core.RequestEvent) error {
 		})
 	}
 
+	verbosity, ok := parseAssistantVerbosity(req.Verbosity)
+	if !ok {
+		return e.JSON(http.StatusBadRequest, map[string]string{
+			"error": "verbosity must be low, medium, or high",
+		})
+	}
+
+	config := loadAssistantConfig(e.App)
+	if !trips.CanEdit(requestTripRole(e)) {
+		config = readOnlyAssistantConfig(config)
+	}
+	locale := loadAssistantLocale(e.Auth)
+
 	tripVal := e.Get("trip")
 	if tripVal == nil {
 		return e.JSON(http.StatusBadRequest, map[string]string{
@@ -266,7 +275,7 @@ func TripAssistantStream(e *core.RequestEvent) error {
 		})
 	}
 
-	ctx, err := buildTripAssistantContext(e.App, tripRecord)
+	ctx, err := buildTripAssistantContext(e.App, tripRecord, e.Auth.Id, requestTripRole(e), config.IncludeWeather)
 	if err != nil {
 		e.App.Logger().Error("TripAssistant stream build context error", "error", err, "tripId", tripRecord.Id)
 		return e.JSON(http.StatusInternalServerError, map[string]string{
@@ -274,7 +283,7 @@ func TripAssistantStream(e *core.RequestEvent) error {
 		})
 	}
 
-	responseInput, err := buildResponsesInput(req.Messages, ctx)
+	responseInput, err := buildResponsesInput(req.Messages, ctx, config, locale)
 	if err != nil {
 		e.App.Logger().Error("TripAssistant stream failed to build input", "error", err, "tripId", tripRecord.Id)
 		return e.JSON(http.StatusInternalServerError, map[string]string{
@@ -282,24 +291,81 @@ func TripAssistantStream(e *core.RequestEvent) error {
 		})
 	}
 
-	flusher, ok := e.Response.(http.Flusher)
-	if !ok {
-		return e.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "streaming is not supported on this server",
+	flusher, streaming := sseFlusher(e.Response)
+	if !streaming {
+		e.App.Logger().Warn("TripAssistant stream cannot be flushed, the reply is sent when complete", "tripId", tripRecord.Id)
+	}
+
+	release, active, acquired := acquireAssistantStream(e.Auth.Id, config.MaxStreamsPerUser)
+	if !acquired {
+		return e.JSON(http.StatusTooManyRequests, map[string]interface{}{
+			"error":  "too many assistant conversations are streaming at once, finish or close one and try again",
+			"code":   "too_many_streams",
+			"limit":  config.MaxStreamsPerUser,
+			"active": active,
 		})
 	}
+	defer release()
 
-	writer := e.Response
-	writer.Header().Set("Content-Type", "text/event-stream")
-	writer.Header().Set("Cache-Control", "no-cache")
-	writer.Header().Set("Connection", "keep-alive")
+	stream := newSSEStream(e.Response, flusher)
+	writer, flusher := http.ResponseWriter(stream), http.Flusher(stream)
+	setSSEHeaders(writer, e.Request)
 
-	if err := streamResponsesToClient(e.Request.Context(), writer, flusher, apiKey, tripRecord.Id, responseInput); err != nil {
+	// keepalives and padding only help a stream that reaches the client as
+	// it is written
+	if streaming {
+		stream.pad(config.StreamPadding)
+		stopHeartbeat := stream.startHeartbeat(config.HeartbeatInterval)
+		defer stopHeartbeat()
+	}
+
+	turnID := uuid.NewString()
+	output := newReplyPostProcessor(tripRecord.Id, ctx, locale)
+	sendSSEEvent(writer, flusher, map[string]string{
+		"type":   "turn",
+		"turnId": turnID,
+	})
+
+	cacheKey, cacheable := assistantCacheKey(tripRecord.Id, ctx, req.Messages, verbosity, locale)
+	if cacheable {
+		if reply, found := getCachedAssistantReply(cacheKey); found {
+			saveAssistantToolResults(e.App, tripRecord.Id, turnID, reply.ToolResults)
+			sendSSEEvent(writer, flusher, map[string]string{
+				"type": "delta",
+				"text": output.Process(reply.Text),
+			})
+			if sources, ok := sourcesEvent(reply.ToolResults); ok {
+				sendSSEEvent(writer, flusher, sources)
+			}
+			sendSSEEvent(writer, flusher, map[string]string{
+				"type": "done",
+			})
+			return nil
+		}
+	}
+
+	contextAt, _ := time.Parse(time.RFC3339, ctx.GeneratedAt)
+	reply, err := streamResponsesToClient(e.Request.Context(), writer, flusher, apiKey, tripRecord.Id, e.Auth.Id, contextAt, responseInput, config, verbosity, locale, output, newLocalTools(e.App, tripRecord, e.Auth, ctx, config))
+	if reply != nil {
+		if reply.Truncated != "" {
+			e.App.Logger().Warn("TripAssistant reply truncated", "reason", reply.Truncated, "tripId", tripRecord.Id)
+		}
+		saveAssistantToolResults(e.App, tripRecord.Id, turnID, reply.ToolResults)
+		if reply.Proposal != nil {
+			proposals.RecordIssued(e.App, reply.Proposal, e.Auth.Id)
+		}
+	}
+	if err != nil {
 		e.App.Logger().Error("TripAssistant stream failed", "error", err, "tripId", tripRecord.Id)
 		sendSSEEvent(writer, flusher, map[string]string{
 			"type":    "error",
 			"message": "assistant request failed",
 		})
+		return nil
+	}
+
+	if cacheable {
+		cacheAssistantReply(cacheKey, reply)
 	}
 
 	return nil
@@ -326,8 +392,16 @@ func AssistantProposalDecision(e *core.RequestEvent) error {
 		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid body"})
 	}
 
-	proposal, ok := getAssistantProposal(proposalID)
+	proposal, ok := proposals.Get(proposalID)
 	if !ok {
+		// someone else on the trip may have decided on it already
+		if outcome, decided := proposals.DecidedOutcome(proposalID); decided && outcome.TripID == tripRecord.Id {
+			return e.JSON(http.StatusConflict, map[string]string{
+				"error":   "proposal was already decided",
+				"status":  outcome.Status,
+				"message": outcome.Message,
+			})
+		}
 		return e.JSON(http.StatusGone, map[string]string{"error": "proposal expired"})
 	}
 
@@ -335,30 +409,47 @@ func AssistantProposalDecision(e *core.RequestEvent) error {
 		return e.JSON(http.StatusForbidden, map[string]string{"error": "proposal does not belong to this trip"})
 	}
 
-	if proposal.expired() {
-		popAssistantProposal(proposalID)
+	if proposal.Expired() {
+		proposals.Pop(proposalID)
+		proposals.RecordDecision(e.App, proposal, proposals.StatusTimeout, "", "", "")
 		return e.JSON(http.StatusGone, map[string]string{"error": "proposal timed out"})
 	}
 
-	switch strings.ToLower(req.Decision) {
+	decision := strings.ToLower(req.Decision)
+	if allowed, err := checkProposalDecision(e, proposal, decision); !allowed {
+		return err
+	}
+
+	switch decision {
 	case "approve":
-		message, err := applyAssistantProposal(e.App, tripRecord, proposal)
+		// ?dryRun=true shows what approving would save, without saving it
+		if dryRun, _ := strconv.ParseBool(e.Request.URL.Query().Get("dryRun")); dryRun {
+			if err := checkProposalFreshness(e.App, tripRecord, proposal, requestTripRole(e)); err != nil {
+				return proposalErrorResponse(e, err)
+			}
+			return proposalPreviewResponse(e, tripRecord, proposal)
+		}
+		message, err := approveAssistantProposal(e.App, tripRecord, proposal, e.Auth.Id)
+		if errors.Is(err, errProposalBeingApplied) {
+			return e.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
 		if err != nil {
-			return e.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return proposalErrorResponse(e, err)
 		}
-		popAssistantProposal(proposalID)
 		return e.JSON(http.StatusOK, map[string]string{
 			"status":  "approved",
 			"message": message,
 		})
 	case "decline":
-		popAssistantProposal(proposalID)
+		proposals.Decide(proposalID, proposals.StatusDeclined, "")
+		proposals.RecordDecision(e.App, proposal, proposals.StatusDeclined, e.Auth.Id, "", "")
 		return e.JSON(http.StatusOK, map[string]string{
 			"status":  "declined",
 			"message": "Okay, I will skip that change.",
 		})
 	case "timeout":
-		popAssistantProposal(proposalID)
+		proposals.Decide(proposalID, proposals.StatusTimeout, "")
+		proposals.RecordDecision(e.App, proposal, proposals.StatusTimeout, e.Auth.Id, "", "")
 		return e.JSON(http.StatusOK, map[string]string{
 			"status":  "timeout",
 			"message": "The request expired. Ask again if you'd like me to re-create it.",
@@ -368,7 +459,43 @@ func AssistantProposalDecision(e *core.RequestEvent) error {
 	}
 }
 
-func applyAssistantProposal(app core.App, trip *core.Record, proposal *assistantProposal) (string, error) {
+var errProposalBeingApplied = errors.New("proposal is already being applied")
+
+// approveAssistantProposal applies the proposal on behalf of the user and
+// records how it went. A proposal made from an outdated trip can never be
+// applied and fails for good, the assistant is asked for a new one.
+func approveAssistantProposal(app core.App, trip *core.Record, proposal *proposals.Proposal, userId string) (string, error) {
+	if err := checkProposalFreshness(app, trip, proposal, trips.TripRole(trip, userId)); err != nil {
+		proposals.Decide(proposal.ID, proposals.StatusFailed, err.Error())
+		proposals.RecordDecision(app, proposal, proposals.StatusFailed, userId, "", err.Error())
+		return "", err
+	}
+	if _, claimed := proposals.Claim(proposal.ID); !claimed {
+		return "", errProposalBeingApplied
+	}
+	recordID, message, err := applyAssistantProposal(app, trip, proposal)
+	if err != nil {
+		proposals.Release(proposal.ID)
+		proposals.RecordDecision(app, proposal, proposals.StatusFailed, userId, "", err.Error())
+		return "", err
+	}
+	proposals.Decide(proposal.ID, proposals.StatusApproved, message)
+	proposals.RecordDecision(app, proposal, proposals.StatusApproved, userId, recordID, message)
+	return message, nil
+}
+
+func applyAssistantProposal(app core.App, trip *core.Record, proposal *proposals.Proposal) (string, string, error) {
+	if err := migrateProposal(proposal); err != nil {
+		return "", "", err
+	}
+	if err := validateProposalArguments(proposal.Tool, proposal.Arguments); err != nil {
+		return "", "", err
+	}
+	if proposal.Tool == assistantToolCreateActivity {
+		geocodeActivityPlace(proposal.Arguments)
+	}
+	normalizeProposalTimes(app, trip, proposal)
+
 	switch proposal.Tool {
 	case assistantToolCreateActivity:
 		return saveActivityProposal(app, trip.Id, proposal.Arguments)
@@ -388,15 +515,37 @@ func applyAssistantProposal(app core.App, trip *core.Record, proposal *assistant
 		return updateTransportationProposal(app, trip.Id, proposal.Arguments)
 	case assistantToolDeleteTransportation:
 		return deleteTransportationProposal(app, trip.Id, proposal.Arguments)
+	case assistantToolSwapActivities:
+		return swapActivitiesProposal(app, trip.Id, proposal.Arguments)
+	case assistantToolCreateCarRental:
+		return saveCarRentalProposal(app, trip.Id, proposal.Arguments)
+	case assistantToolUpdateCarRental:
+		return updateCarRentalProposal(app, trip.Id, proposal.Arguments)
+	case assistantToolDeleteCarRental:
+		return deleteCarRentalProposal(app, trip.Id, proposal.Arguments)
+	case assistantToolCreateDining:
+		return saveDiningProposal(app, trip.Id, proposal.Arguments)
+	case assistantToolUpdateDining:
+		return updateDiningProposal(app, trip.Id, proposal.Arguments)
+	case assistantToolDeleteDining:
+		return deleteDiningProposal(app, trip.Id, proposal.Arguments)
+	case assistantToolCreateExpense:
+		return saveExpenseProposal(app, trip.Id, proposal.Arguments)
+	case assistantToolUpdateExpense:
+		return updateExpenseProposal(app, trip.Id, proposal.Arguments)
+	case assistantToolDeleteExpense:
+		return deleteExpenseProposal(app, trip.Id, proposal.Arguments)
+	case assistantToolCreatePoll:
+		return savePollProposal(app, trip, proposal.Arguments)
 	default:
-		return "", errors.New("unsupported proposal type")
+		return "", "", errors.New("unsupported proposal type")
 	}
 }
 
-func saveActivityProposal(app core.App, tripID string, args map[string]interface{}) (string, error) {
+func saveActivityProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
 	collection, err := app.FindCollectionByNameOrId("activities")
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	record := core.NewRecord(collection)
@@ -405,6 +554,9 @@ func saveActivityProposal(app core.App, tripID string, args map[string]interface
 	record.Set("description", stringValue(args["description"]))
 	record.Set("address", stringValue(args["address"]))
 	record.Set("notes", stringValue(args["notes"]))
+	if tags := stringsValue(args["tags"]); len(tags) > 0 {
+		record.Set("tags", tags)
+	}
 
 	if start := stringValue(args["start_time"]); start != "" {
 		record.Set("startDate", start)
@@ -426,18 +578,19 @@ func saveActivityProposal(app core.App, tripID string, args map[string]interface
 	if metadata := buildActivityMetadata(args); len(metadata) > 0 {
 		record.Set("metadata", metadata)
 	}
+	setMetadataTimezone(record, "place", stringValue(args["timezone"]))
 
 	if err := app.Save(record); err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return fmt.Sprintf("Added activity \"%s\" on %s.", stringValue(args["name"]), stringValue(args["start_time"])), nil
+	return record.Id, fmt.Sprintf("Added activity \"%s\" on %s.", stringValue(args["name"]), stringValue(args["start_time"])), nil
 }
 
-func updateActivityProposal(app core.App, tripID string, args map[string]interface{}) (string, error) {
+func updateActivityProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
 	record, err := ensureTripRecord(app, "activities", stringValue(args["record_id"]), tripID)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	if name := stringValue(args["name"]); name != "" {
@@ -452,6 +605,10 @@ func updateActivityProposal(app core.App, tripID string, args map[string]interfa
 	if note := stringValue(args["notes"]); note != "" {
 		record.Set("notes", note)
 	}
+	// the tags sent replace the ones of the activity, an empty list clears them
+	if tags, ok := args["tags"]; ok {
+		record.Set("tags", stringsValue(tags))
+	}
 	if start := stringValue(args["start_time"]); start != "" {
 		record.Set("startDate", start)
 	}
@@ -461,33 +618,76 @@ func updateActivityProposal(app core.App, tripID string, args map[string]interfa
 	if metadata := buildActivityMetadata(args); len(metadata) > 0 {
 		record.Set("metadata", metadata)
 	}
+	setMetadataTimezone(record, "place", stringValue(args["timezone"]))
 	applyCostUpdate(record, args)
 
 	if err := app.Save(record); err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return fmt.Sprintf("Updated activity \"%s\".", record.GetString("name")), nil
+	return record.Id, fmt.Sprintf("Updated activity \"%s\".", record.GetString("name")), nil
 }
 
-func deleteActivityProposal(app core.App, tripID string, args map[string]interface{}) (string, error) {
+func deleteActivityProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
 	record, err := ensureTripRecord(app, "activities", stringValue(args["record_id"]), tripID)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	name := record.GetString("name")
 	if err := app.Delete(record); err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return fmt.Sprintf("Removed activity \"%s\".", name), nil
+	return record.Id, fmt.Sprintf("Removed activity \"%s\".", name), nil
 }
 
-func saveLodgingProposal(app core.App, tripID string, args map[string]interface{}) (string, error) {
+// swapActivitiesProposal exchanges the days of two activities while each keeps
+// its own time of day and duration
+func swapActivitiesProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
+	first, err := ensureTripRecord(app, "activities", stringValue(args["first_record_id"]), tripID)
+	if err != nil {
+		return "", "", err
+	}
+	second, err := ensureTripRecord(app, "activities", stringValue(args["second_record_id"]), tripID)
+	if err != nil {
+		return "", "", err
+	}
+
+	firstStart := first.GetDateTime("startDate").Time()
+	secondStart := second.GetDateTime("startDate").Time()
+	firstDayShift := dayOf(secondStart).Sub(dayOf(firstStart))
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		shiftActivity(first, firstDayShift)
+		shiftActivity(second, -firstDayShift)
+		if err := txApp.Save(first); err != nil {
+			return err
+		}
+		return txApp.Save(second)
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return first.Id, fmt.Sprintf("Swapped \"%s\" and \"%s\".", first.GetString("name"), second.GetString("name")), nil
+}
+
+func shiftActivity(record *core.Record, shift time.Duration) {
+	record.Set("startDate", record.GetDateTime("startDate").Time().Add(shift))
+	if end := record.GetDateTime("endDate"); !end.IsZero() {
+		record.Set("endDate", end.Time().Add(shift))
+	}
+}
+
+func dayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func saveLodgingProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
 	collection, err := app.FindCollectionByNameOrId("lodgings")
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	record := core.NewRecord(collection)
@@ -503,18 +703,23 @@ func saveLodgingProposal(app core.App, tripID string, args map[string]interface{
 	if end := stringValue(args["end_time"]); end != "" {
 		record.Set("endDate", end)
 	}
+	if rooms, ok := assistantRooms(args["rooms"]); ok {
+		record.Set("rooms", rooms)
+	}
+	applyCostUpdate(record, args)
+	setMetadataTimezone(record, "place", stringValue(args["timezone"]))
 
 	if err := app.Save(record); err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return fmt.Sprintf("Added lodging \"%s\" for %s to %s.", stringValue(args["name"]), stringValue(args["start_time"]), stringValue(args["end_time"])), nil
+	return record.Id, fmt.Sprintf("Added lodging \"%s\" for %s to %s.", stringValue(args["name"]), stringValue(args["start_time"]), stringValue(args["end_time"])), nil
 }
 
-func saveTransportationProposal(app core.App, tripID string, args map[string]interface{}) (string, error) {
+func saveTransportationProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
 	collection, err := app.FindCollectionByNameOrId("transportations")
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	record := core.NewRecord(collection)
@@ -531,18 +736,25 @@ func saveTransportationProposal(app core.App, tripID string, args map[string]int
 	if arr := stringValue(args["arrival_time"]); arr != "" {
 		record.Set("arrivalTime", arr)
 	}
+	if seats, ok := assistantSeats(args["seats"]); ok {
+		record.Set("seats", seats)
+	}
+	setMetadataTimezone(record, "origin", stringValue(args["origin_timezone"]))
+	setMetadataTimezone(record, "destination", stringValue(args["destination_timezone"]))
+	setAirportPlace(record, "origin", stringValue(args["origin"]))
+	setAirportPlace(record, "destination", stringValue(args["destination"]))
 
 	if err := app.Save(record); err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return fmt.Sprintf("Added %s from %s to %s departing %s.", stringValue(args["type"]), stringValue(args["origin"]), stringValue(args["destination"]), stringValue(args["departure_time"])), nil
+	return record.Id, fmt.Sprintf("Added %s from %s to %s departing %s.", stringValue(args["type"]), stringValue(args["origin"]), stringValue(args["destination"]), stringValue(args["departure_time"])), nil
 }
 
-func updateLodgingProposal(app core.App, tripID string, args map[string]interface{}) (string, error) {
+func updateLodgingProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
 	record, err := ensureTripRecord(app, "lodgings", stringValue(args["record_id"]), tripID)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	if name := stringValue(args["name"]); name != "" {
@@ -566,30 +778,35 @@ func updateLodgingProposal(app core.App, tripID string, args map[string]interfac
 	if notes := stringValue(args["notes"]); notes != "" {
 		record.Set("notes", notes)
 	}
+	if rooms, ok := assistantRooms(args["rooms"]); ok {
+		record.Set("rooms", rooms)
+	}
+	applyCostUpdate(record, args)
+	setMetadataTimezone(record, "place", stringValue(args["timezone"]))
 
 	if err := app.Save(record); err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return fmt.Sprintf("Updated lodging \"%s\".", record.GetString("name")), nil
+	return record.Id, fmt.Sprintf("Updated lodging \"%s\".", record.GetString("name")), nil
 }
 
-func deleteLodgingProposal(app core.App, tripID string, args map[string]interface{}) (string, error) {
+func deleteLodgingProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
 	record, err := ensureTripRecord(app, "lodgings", stringValue(args["record_id"]), tripID)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	name := record.GetString("name")
 	if err := app.Delete(record); err != nil {
-		return "", err
+		return "", "", err
 	}
-	return fmt.Sprintf("Removed lodging \"%s\".", name), nil
+	return record.Id, fmt.Sprintf("Removed lodging \"%s\".", name), nil
 }
 
-func updateTransportationProposal(app core.App, tripID string, args map[string]interface{}) (string, error) {
+func updateTransportationProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
 	record, err := ensureTripRecord(app, "transportations", stringValue(args["record_id"]), tripID)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	if t := stringValue(args["type"]); t != "" {
@@ -613,24 +830,29 @@ func updateTransportationProposal(app core.App, tripID string, args map[string]i
 	if notes := stringValue(args["notes"]); notes != "" {
 		record.Set("notes", notes)
 	}
+	if seats, ok := assistantSeats(args["seats"]); ok {
+		record.Set("seats", seats)
+	}
+	setMetadataTimezone(record, "origin", stringValue(args["origin_timezone"]))
+	setMetadataTimezone(record, "destination", stringValue(args["destination_timezone"]))
 
 	if err := app.Save(record); err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	return fmt.Sprintf("Updated %s on %s.", record.GetString("type"), record.GetString("departureTime")), nil
+	return record.Id, fmt.Sprintf("Updated %s on %s.", record.GetString("type"), record.GetString("departureTime")), nil
 }
 
-func deleteTransportationProposal(app core.App, tripID string, args map[string]interface{}) (string, error) {
+func deleteTransportationProposal(app core.App, tripID string, args map[string]interface{}) (string, string, error) {
 	record, err := ensureTripRecord(app, "transportations", stringValue(args["record_id"]), tripID)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	label := fmt.Sprintf("%s from %s to %s", record.GetString("type"), record.GetString("origin"), record.GetString("destination"))
 	if err := app.Delete(record); err != nil {
-		return "", err
+		return "", "", err
 	}
-	return fmt.Sprintf("Removed %s.", label), nil
+	return record.Id, fmt.Sprintf("Removed %s.", label), nil
 }
 
 func buildActivityMetadata(args map[string]interface{}) map[string]interface{} {
@@ -672,230 +894,47 @@ func sanitizePlaceMetadata(raw map[string]interface{}) map[string]interface{} {
 	return place
 }
 
-func buildTripAssistantContext(app core.App, trip *core.Record) (*tripAssistantContext, error) {
-	destinations := parseDestinations(app, trip)
-	participants := parseParticipants(app, trip)
-
-	ctx := &tripAssistantContext{
-		Trip: basicTrip{
-			Id:          trip.Id,
-			Name:        trip.GetString("name"),
-			Description: trip.GetString("description"),
-			StartDate:   formatDate(trip.GetDateTime("startDate")),
-			EndDate:     formatDate(trip.GetDateTime("endDate")),
-		},
-		Notes:        trip.GetString("notes"),
-		Destinations: destinations,
-		Participants: participants,
-		GeneratedAt:  time.Now().UTC().Format(time.RFC3339),
-	}
-
-	if ctx.Notes == "" {
-		ctx.Notes = trip.GetString("description")
-	}
-
-	var budget costSummary
-	if err := trip.UnmarshalJSONField("budget", &budget); err == nil {
-		if budget.Value != 0 || budget.Currency != "" {
-			ctx.Budget = &budget
-		}
-	}
-
-	transportations, err := collectTransportations(app, trip)
-	if err != nil {
-		return nil, err
-	}
-	ctx.Transportations = transportations
-
-	lodgings, err := collectLodgings(app, trip)
-	if err != nil {
-		return nil, err
-	}
-	ctx.Lodgings = lodgings
-
-	activities, err := collectActivities(app, trip)
-	if err != nil {
-		return nil, err
-	}
-	ctx.Activities = activities
-
-	return ctx, nil
-}
-
-func collectTransportations(app core.App, trip *core.Record) ([]transportationSummary, error) {
-	records, err := app.FindAllRecords("transportations", dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
-	if err != nil {
-		return nil, err
-	}
-
-	sort.Slice(records, func(i, j int) bool {
-		return records[i].GetDateTime("departureTime").Time().Before(records[j].GetDateTime("departureTime").Time())
-	})
-
-	summaries := make([]transportationSummary, 0, len(records))
-	for _, record := range records {
-		var cost costSummary
-		var metadata map[string]interface{}
-
-		_ = record.UnmarshalJSONField("cost", &cost)
-		_ = record.UnmarshalJSONField("metadata", &metadata)
-
-		entry := transportationSummary{
-			Id:          record.Id,
-			Type:        record.GetString("type"),
-			Origin:      record.GetString("origin"),
-			Destination: record.GetString("destination"),
-			Departure:   formatDate(record.GetDateTime("departureTime")),
-			Arrival:     formatDate(record.GetDateTime("arrivalTime")),
-			Notes:       record.GetString("notes"),
-		}
-
-		if cost.Value != 0 || cost.Currency != "" {
-			entry.Cost = &cost
-		}
-		if len(metadata) > 0 {
-			entry.Metadata = metadata
-		}
-
-		summaries = append(summaries, entry)
-	}
-
-	return summaries, nil
-}
-
-func collectLodgings(app core.App, trip *core.Record) ([]lodgingSummary, error) {
-	records, err := app.FindAllRecords("lodgings", dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+// buildTripAssistantContext returns the trip context for the assistant. It is
+// cached per trip and user until one of the trip's records changes, see
+// hooks.InvalidateTripCaches. Only the owner's context holds private items,
+// and viewers get no costs or booking references at all. The forecast is
+// added when the deployment lets the assistant see the weather, and the
+// entry requirements when the participants have a nationality.
+func buildTripAssistantContext(app core.App, trip *core.Record, userId string, role string, includeWeather bool) (*tripcontext.Context, error) {
+	cacheKey := cache.TripKey(trip.Id, "assistant-context", userId)
+	if cached, found := cache.Get(cacheKey); found {
+		ctx := *cached.(*tripcontext.Context)
+		ctx.GeneratedAt = time.Now().UTC().Format(time.RFC3339)
+		return &ctx, nil
+	}
+
+	ctx, err := tripcontext.Build(app, trip, trips.SeesPrivate(role))
 	if err != nil {
 		return nil, err
 	}
-
-	sort.Slice(records, func(i, j int) bool {
-		return records[i].GetDateTime("startDate").Time().Before(records[j].GetDateTime("startDate").Time())
-	})
-
-	summaries := make([]lodgingSummary, 0, len(records))
-	for _, record := range records {
-		var cost costSummary
-		var metadata map[string]interface{}
-
-		_ = record.UnmarshalJSONField("cost", &cost)
-		_ = record.UnmarshalJSONField("metadata", &metadata)
-
-		entry := lodgingSummary{
-			Id:           record.Id,
-			Type:         record.GetString("type"),
-			Name:         record.GetString("name"),
-			Address:      record.GetString("address"),
-			CheckIn:      formatDate(record.GetDateTime("startDate")),
-			CheckOut:     formatDate(record.GetDateTime("endDate")),
-			Confirmation: record.GetString("confirmationCode"),
-		}
-
-		if resBy := record.GetString("reservationName"); resBy != "" {
-			entry.ReservationBy = resBy
-		}
-
-		if cost.Value != 0 || cost.Currency != "" {
-			entry.Cost = &cost
-		}
-		if len(metadata) > 0 {
-			entry.Metadata = metadata
-		}
-
-		summaries = append(summaries, entry)
+	if !trips.CanEdit(role) {
+		ctx.OmitCostsAndCodes()
 	}
-
-	return summaries, nil
-}
-
-func collectActivities(app core.App, trip *core.Record) ([]activitySummary, error) {
-	records, err := app.FindAllRecords("activities", dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
-	if err != nil {
-		return nil, err
-	}
-
-	sort.Slice(records, func(i, j int) bool {
-		return records[i].GetDateTime("startDate").Time().Before(records[j].GetDateTime("startDate").Time())
-	})
-
-	summaries := make([]activitySummary, 0, len(records))
-	for _, record := range records {
-		var cost costSummary
-		var metadata map[string]interface{}
-
-		_ = record.UnmarshalJSONField("cost", &cost)
-		_ = record.UnmarshalJSONField("metadata", &metadata)
-
-		entry := activitySummary{
-			Id:          record.Id,
-			Name:        record.GetString("name"),
-			Description: record.GetString("description"),
-			Address:     record.GetString("address"),
-			Start:       formatDate(record.GetDateTime("startDate")),
-			End:         formatDate(record.GetDateTime("endDate")),
-		}
-
-		if cost.Value != 0 || cost.Currency != "" {
-			entry.Cost = &cost
-		}
-		if len(metadata) > 0 {
-			entry.Metadata = metadata
+	ctx.Hints = travelHints(app, userId, ctx.Destinations)
+	ctx.RecentChanges = recentTripChanges(app, trip, role)
+	if provider := weatherProvider(); includeWeather && provider != nil {
+		if ctx.Weather, err = tripcontext.Forecast(ctx, provider); err != nil {
+			app.Logger().Warn("Could not add the forecast to the assistant context", "error", err, "tripId", trip.Id)
 		}
-
-		summaries = append(summaries, entry)
 	}
-
-	return summaries, nil
-}
-
-func parseDestinations(app core.App, trip *core.Record) []tripDestination {
-	data := trip.GetString("destinations")
-	if strings.TrimSpace(data) == "" {
-		return nil
+	if ctx.EntryRequirements, _, err = tripEntryRequirements(app, ctx); err != nil {
+		app.Logger().Warn("Could not add the entry requirements to the assistant context", "error", err, "tripId", trip.Id)
 	}
 
-	var raw []map[string]interface{}
-	if err := json.Unmarshal([]byte(data), &raw); err != nil {
-		app.Logger().Warn("Unable to parse trip destinations", "error", err, "tripId", trip.Id)
-		return nil
+	// the rest of long texts is found with search_trip_notes
+	if embeddingsProvider() != nil {
+		shortenContextText(ctx)
 	}
+	ctx = applyContextBudget(ctx, assistantContextTokenLimit(), time.Now().UTC())
+	cache.Set(cacheKey, ctx, assistantContextCacheTTL)
 
-	results := make([]tripDestination, 0, len(raw))
-	for _, d := range raw {
-		results = append(results, tripDestination{
-			Name:        stringValue(d["name"]),
-			Country:     stringValue(d["countryName"]),
-			State:       stringValue(d["stateName"]),
-			Timezone:    stringValue(d["timezone"]),
-			Latitude:    stringValue(d["latitude"]),
-			Longitude:   stringValue(d["longitude"]),
-			Category:    stringValue(d["category"]),
-			Description: stringValue(d["description"]),
-		})
-	}
-	return results
-}
-
-func parseParticipants(app core.App, trip *core.Record) []tripParticipant {
-	data := trip.GetString("participants")
-	if strings.TrimSpace(data) == "" {
-		return nil
-	}
-
-	var raw []map[string]interface{}
-	if err := json.Unmarshal([]byte(data), &raw); err != nil {
-		app.Logger().Warn("Unable to parse trip participants", "error", err, "tripId", trip.Id)
-		return nil
-	}
-
-	results := make([]tripParticipant, 0, len(raw))
-	for _, p := range raw {
-		results = append(results, tripParticipant{
-			Name:  stringValue(p["name"]),
-			Email: stringValue(p["email"]),
-		})
-	}
-	return results
+	copied := *ctx
+	return &copied, nil
 }
 
 func stringValue(v interface{}) string {
@@ -939,6 +978,22 @@ func mapValue(v interface{}) map[string]interface{} {
 	return nil
 }
 
+// stringsValue reads a list of strings, such as tags, leaving out the
+// values that are not strings
+func stringsValue(v interface{}) []string {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		if value, ok := item.(string); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func ensureTripRecord(app core.App, collection, recordID, tripID string) (*core.Record, error) {
 	if recordID == "" {
 		return nil, errors.New("missing record id")
@@ -972,21 +1027,21 @@ func applyCostUpdate(record *core.Record, args map[string]interface{}) bool {
 	return true
 }
 
-func formatDate(dt pbtypes.DateTime) string {
-	if dt.IsZero() {
-		return ""
-	}
-	return dt.Time().Format("2006-01-02T15:04:05")
-}
-
-func buildResponsesInput(messages []assistantMessage, ctx *tripAssistantContext) ([]map[string]interface{}, error) {
-	ctxJSON, err := json.MarshalIndent(ctx, "", "  ")
+func buildResponsesInput(messages []assistantMessage, ctx *tripcontext.Context, config assistantConfig, locale assistantLocale) ([]map[string]interface{}, error) {
+	ctxJSON, err := ctx.JSON()
 	if err != nil {
 		return nil, err
 	}
 
-	systemPrompt := "You are Surmai's AI-powered itinerary assistant. Use the trip context to answer questions, reference actual plans, and offer proactive suggestions when helpful. Keep answers concise, organized, and grounded in the provided data unless the user explicitly asks for speculation. Answers given should be easy to understand, instead of using 24hr time format, opt to use 12hr time format instead with AM/PM, any times you see, edit, or add in the trip context information or new entries will read as for the user. For dates use the format MM-DD and do not include the year. When the traveler asks you to add, adjust, or remove something, call the matching function (create/update/delete activity/lodging/transportation). Always include the record_id from the trip context when editing or deleting. Never assume the change is saved until the traveler approves it, and mention any assumptions you make when inferring missing details."
+	systemPrompt := "You are Surmai's AI-powered itinerary assistant. Use the trip context to answer questions, reference actual plans, and offer proactive suggestions when helpful. Keep answers concise, organized, and grounded in the provided data unless the user explicitly asks for speculation. Answers given should be easy to understand. %s When proposing changes, send times as the local time at the place where they happen and include the IANA timezone when you know it. If you are unsure how to convert a date the traveler wrote, such as next Friday 7pm or the 14th, pass their words unchanged and the server will resolve them. When the traveler asks you to add, adjust, or remove something, call the matching function (create/update/delete activity/lodging/transportation/car_rental/dining/expense). Restaurant reservations are dining, not activities. When the travelers cannot agree between a few options, call create_poll so everyone can vote. When the traveler mentions money they spent, record it as an expense. When the traveler shares a screenshot or photo of a booking confirmation or ticket, read the details from it and propose creating the matching lodging, transportation, car rental or restaurant reservation. Always include the record_id from the trip context when editing or deleting. Never assume the change is saved until the traveler approves it, and mention any assumptions you make when inferring missing details. If omittedRecords is present, some plans far from today were left out of the context, so say so instead of claiming they do not exist. Records may carry tags such as rainy-day, kid-friendly or must-do; when the traveler asks for the options with a tag, such as rainy-day options for Tuesday, pick them by their tags and suggest tagging an activity when it clearly fits one of the trip's tags. Hints describe the traveler's past trips; use them to suggest familiar options but do not treat them as plans. When the traveler asks where they were, when they last visited a place or which countries they have been to, call get_travel_history for the period instead of guessing from the hints. Documents lists the files uploaded to the trip with the records they belong to and the values read from them; when the traveler asks for a detail that is not in the context, such as a door code or Wi-Fi password, call find_document before saying it is unknown. Long notes, descriptions and document texts may be shortened in the context; call search_trip_notes to find what they say further on before saying the trip does not mention something. Weather, when present, is the forecast of the trip days where the travelers stay; use it to suggest plans that suit it. When a search finds more restaurants, hotels or things to do than you will suggest, pass them all to rank_suggestions and present the ones it returns in its order. When the traveler asks what could go wrong or wants to review the risks of the trip, call get_trip_risks and walk them through the risks one at a time, offering to fix them. When the traveler asks how much was spent on a day, so far or this week, call get_daily_spend instead of adding up the costs yourself. To find attractions, museums, restaurants or other places to go near the destinations, call search_places before searching the web, and search the web for what it does not know, such as reviews or prices. When search_lodging is available, use it to suggest hotels with their live prices, and propose the one the traveler picks with create_lodging including its price. EntryRequirements, when present, lists the visa, passport validity and vaccinations each nationality of the travelers needs for the destinations; point out the ones needing action before the trip and remind the traveler to confirm them with official sources. RecentChanges lists the latest changes to the trip with who made them; use it when asked what changed and to mention a recent change that affects a plan. Records carry the UTC time they were last updated; a change refused because the trip changed since the context was generated should be proposed again from the latest context."
+	systemPrompt = fmt.Sprintf(systemPrompt, locale.promptInstructions())
+	if config.PromptInstructions != "" {
+		systemPrompt += "\n\n" + config.PromptInstructions
+	}
 	contextPrompt := fmt.Sprintf("Latest trip context:\n%s", string(ctxJSON))
+	if ctx.Stats != nil {
+		contextPrompt = ctx.Stats.Header() + "\n" + contextPrompt
+	}
 
 	input := []map[string]interface{}{
 		newResponsesTextBlock("developer", systemPrompt),
@@ -994,13 +1049,17 @@ func buildResponsesInput(messages []assistantMessage, ctx *tripAssistantContext)
 	}
 
 	for _, message := range messages {
-		if message.Content == "" {
+		if message.Content == "" && len(message.Images) == 0 {
 			continue
 		}
 		role := message.Role
 		if role != "user" && role != "assistant" {
 			continue
 		}
+		if len(message.Images) > 0 {
+			input = append(input, newResponsesImageBlock(message))
+			continue
+		}
 		input = append(input, newResponsesTextBlock(role, message.Content))
 	}
 
@@ -1024,61 +1083,118 @@ func newResponsesTextBlock(role, text string) map[string]interface{} {
 	}
 }
 
-func invokeResponsesAPI(ctx context.Context, apiKey string, input []map[string]interface{}) (string, error) {
+// invokeResponsesAPI asks for a complete reply. Calls of the local tools are
+// answered by the server and the reply is requested again with the results.
+func invokeResponsesAPI(ctx context.Context, apiKey string, input []map[string]interface{}, config assistantConfig, verbosity string, local *localTools) (*assistantReply, error) {
 	payload := map[string]interface{}{
-		"model": openAIModel,
+		"model": config.Model,
 		"input": input,
 		"reasoning": map[string]string{
 			"effort": "low",
 		},
 		"text": map[string]string{
-			"verbosity": "low",
+			"verbosity": verbosity,
 		},
-		"tools":       buildAssistantTools(),
-		"tool_choice": "auto",
-		"include":     []string{"web_search_call.action.sources"},
+	}
+	setAssistantOutputTokens(payload, verbosity)
+	// requests like the trip report narrative run without any tools
+	if tools := buildAssistantTools(config); len(tools) > 0 {
+		payload["tools"] = tools
+		payload["tool_choice"] = "auto"
+		payload["include"] = []string{"web_search_call.action.sources"}
+	}
+
+	response, err := postResponsesAPI(ctx, apiKey, payload, config.RequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	toolResults := extractToolResults(*response)
+
+	for round := 1; round <= maxLocalToolRounds; round++ {
+		lookups := make([]map[string]interface{}, 0)
+		for _, item := range response.Output {
+			if item.Type == "function_call" && isLocalTool(item.Name) {
+				lookups = append(lookups, functionCallOutput(item.CallId, local.answer(item.Name, item.Arguments)))
+			}
+		}
+		if len(lookups) == 0 {
+			break
+		}
+
+		payload["previous_response_id"] = response.Id
+		payload["input"] = lookups
+		if round == maxLocalToolRounds {
+			payload["tool_choice"] = "none"
+		}
+		if response, err = postResponsesAPI(ctx, apiKey, payload, config.RequestTimeout); err != nil {
+			return nil, err
+		}
+		toolResults = append(toolResults, extractToolResults(*response)...)
+	}
+
+	calls := make([]responsesAPIMessage, 0)
+	for _, item := range response.Output {
+		if item.Type == "function_call" && !isLocalTool(item.Name) {
+			calls = append(calls, item)
+		}
 	}
 
+	text := strings.TrimSpace(strings.Join(response.OutputText, "\n"))
+	if text == "" {
+		text = extractFallbackOutput(*response)
+	}
+	truncated := ""
+	if response.Status == "incomplete" {
+		truncated = incompleteReason(response.IncompleteDetails)
+	}
+	if text == "" && len(calls) == 0 {
+		if truncated != "" {
+			return nil, fmt.Errorf("assistant reply was cut short: %s", truncated)
+		}
+		return nil, errors.New("assistant returned an empty message")
+	}
+
+	return &assistantReply{
+		Text:        text,
+		ToolResults: toolResults,
+		Calls:       calls,
+		Truncated:   truncated,
+	}, nil
+}
+
+// postResponsesAPI sends a non-streaming request to the Responses API
+func postResponsesAPI(ctx context.Context, apiKey string, payload map[string]interface{}, timeout time.Duration) (*responsesAPIResponse, error) {
 	body, err := json.Marshal(payload)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, openAIResponsesEndpoint, bytes.NewReader(body))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+apiKey)
 
 	client := &http.Client{
-		Timeout: 45 * time.Second,
+		Timeout: timeout,
 	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		return "", parseOpenAIError(resp)
+		return nil, parseOpenAIError(resp)
 	}
 
 	var response responsesAPIResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", err
-	}
-
-	text := strings.TrimSpace(strings.Join(response.OutputText, "\n"))
-	if text == "" {
-		text = extractFallbackOutput(response)
-	}
-	if text == "" {
-		return "", errors.New("assistant returned an empty message")
+		return nil, err
 	}
-
-	return text, nil
+	return &response, nil
 }
 
 func streamResponsesToClient(
@@ -1087,127 +1203,254 @@ func streamResponsesToClient(
 	flusher http.Flusher,
 	apiKey string,
 	tripID string,
+	userID string,
+	contextAt time.Time,
 	input []map[string]interface{},
-) error {
-	callBuffer := &functionCallBuffer{}
+	config assistantConfig,
+	verbosity string,
+	locale assistantLocale,
+	output *replyPostProcessor,
+	local *localTools,
+) (*assistantReply, error) {
+	callBuffer := &functionCallBuffer{locale: locale, requestedBy: userID, contextAt: contextAt}
 	proposalIssued := false
+	var replyText strings.Builder
+	reply := &assistantReply{}
+	citations := make([]assistantSource, 0)
 
 	payload := map[string]interface{}{
-		"model": openAIModel,
+		"model": config.Model,
 		"input": input,
 		"reasoning": map[string]string{
 			"effort": "low",
 		},
 		"text": map[string]string{
-			"verbosity": "low",
+			"verbosity": verbosity,
 		},
-		"tools":       buildAssistantTools(),
+		"tools":       buildAssistantTools(config),
 		"tool_choice": "auto",
 		"include":     []string{"web_search_call.action.sources"},
 		"stream":      true,
 	}
-
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return err
-	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, openAIResponsesEndpoint, bytes.NewReader(body))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	client := &http.Client{
-		Timeout: 0,
+	setAssistantOutputTokens(payload, verbosity)
+
+	// the stream itself can legitimately run for a long time, the client
+	// only bounds the wait for the first response and the idle and stream
+	// timeouts bound the rest. the clone of the shared transport takes the
+	// configured header timeout and its connections are closed with the stream
+	transport := assistantTransport.Clone()
+	transport.ResponseHeaderTimeout = config.RequestTimeout
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+
+	// the raw text is kept for the citation offsets, the client gets it
+	// cleaned up as far as it can be without the rest of the reply
+	sendText := func(text string) {
+		if text != "" {
+			sendSSEEvent(writer, flusher, map[string]string{
+				"type": "delta",
+				"text": text,
+			})
+		}
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+	completed := false
 
-	if resp.StatusCode >= 400 {
-		return parseOpenAIError(resp)
+	// the whole reply, local tool rounds included, is bounded by the stream
+	// timeout
+	streamCtx, cancelStream := context.WithCancel(ctx)
+	if config.StreamTimeout > 0 {
+		streamCtx, cancelStream = context.WithTimeout(ctx, config.StreamTimeout)
 	}
+	defer cancelStream()
 
-	scanner := bufio.NewScanner(resp.Body)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
-
-	completed := false
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" || !strings.HasPrefix(line, "data:") {
-			continue
+	// calls of the local tools are answered here and the reply continues in
+	// a new response that is given the results
+	for round := 0; ; round++ {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
 		}
 
-		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
-		if data == "[DONE]" {
-			break
+		requestCtx, cancelRequest := context.WithCancel(streamCtx)
+		req, err := http.NewRequestWithContext(requestCtx, http.MethodPost, openAIResponsesEndpoint, bytes.NewReader(body))
+		if err != nil {
+			cancelRequest()
+			return nil, err
 		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+apiKey)
 
-		var event map[string]interface{}
-		if err := json.Unmarshal([]byte(data), &event); err != nil {
-			continue
+		resp, err := client.Do(req)
+		if err != nil {
+			cancelRequest()
+			err = truncation(err, nil, streamCtx)
+			var truncated *streamTruncation
+			if errors.As(err, &truncated) {
+				return endTruncatedStream(writer, flusher, reply, citations, truncated, config, output), nil
+			}
+			return nil, err
+		}
+		if resp.StatusCode >= 400 {
+			defer cancelRequest()
+			defer resp.Body.Close()
+			return nil, parseOpenAIError(resp)
 		}
 
-		eventType, _ := event["type"].(string)
-		switch eventType {
-		case "response.output_item.added":
-			item, _ := event["item"].(map[string]interface{})
-			if item != nil {
-				callBuffer.handleOutputItemAdded(item)
-			}
-		case "response.function_call_arguments.delta":
-			callBuffer.handleArgumentsDelta(event)
-		case "response.function_call_arguments.done":
-			if proposalIssued {
-				continue
+		lookups := make([]map[string]interface{}, 0)
+		responseID := ""
+		proposal, err := func() (*proposals.Proposal, error) {
+			defer cancelRequest()
+			body := newIdleReader(resp.Body, config.IdleTimeout, cancelRequest)
+			defer body.Close()
+
+			scanner := bufio.NewScanner(body)
+			scanner.Buffer(make([]byte, 0, 64*1024), max(config.MaxEventBytes, 64*1024))
+
+			for scanner.Scan() {
+				line := scanner.Text()
+				if line == "" || !strings.HasPrefix(line, "data:") {
+					continue
+				}
+
+				data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+				if data == "[DONE]" {
+					break
+				}
+
+				var event map[string]interface{}
+				if err := json.Unmarshal([]byte(data), &event); err != nil {
+					continue
+				}
+
+				eventType, _ := event["type"].(string)
+				switch eventType {
+				case "response.output_item.added":
+					item, _ := event["item"].(map[string]interface{})
+					if item != nil {
+						callBuffer.handleOutputItemAdded(item)
+					}
+				case "response.output_item.done":
+					item, _ := event["item"].(map[string]interface{})
+					if result, ok := parseWebSearchCall(item); ok {
+						reply.ToolResults = append(reply.ToolResults, result)
+					}
+				case "response.output_text.annotation.added":
+					annotation, _ := event["annotation"].(map[string]interface{})
+					if source, ok := parseUrlCitation(annotation, replyText.String()); ok {
+						citations = append(citations, source)
+					}
+				case "response.function_call_arguments.delta":
+					if isLocalTool(callBuffer.name) {
+						callBuffer.handleArgumentsDelta(event)
+						continue
+					}
+					if draft, ok := callBuffer.handleArgumentsDelta(event); ok && !proposalIssued {
+						sendSSEEvent(writer, flusher, draft)
+					}
+				case "response.function_call_arguments.done":
+					if lookup, ok := callBuffer.finalizeLocalCall(event, local); ok {
+						lookups = append(lookups, functionCallOutput(lookup.CallID, lookup.Output))
+						continue
+					}
+					if proposalIssued {
+						continue
+					}
+					if proposal, ok := callBuffer.finalizeProposal(event, tripID, config); ok {
+						return proposal, nil
+					}
+				case "response.output_text.delta":
+					delta, _ := event["delta"].(string)
+					if delta != "" {
+						replyText.WriteString(delta)
+						sendText(output.Write(delta))
+					}
+				case "response.completed":
+					response, _ := event["response"].(map[string]interface{})
+					responseID = stringValue(response["id"])
+					if len(lookups) > 0 && round < maxLocalToolRounds && responseID != "" {
+						continue
+					}
+					sendText(output.Flush())
+					if sources, ok := sourcesEvent(append(reply.ToolResults, citationResult(citations)...)); ok {
+						sendSSEEvent(writer, flusher, sources)
+					}
+					sendSSEEvent(writer, flusher, map[string]string{
+						"type": "done",
+					})
+					completed = true
+				case "response.incomplete":
+					// the model stopped before finishing, usually at
+					// max_output_tokens, what was streamed is only part
+					// of the reply
+					response, _ := event["response"].(map[string]interface{})
+					details, _ := response["incomplete_details"].(map[string]interface{})
+					return nil, &streamTruncation{Reason: incompleteReason(details)}
+				case "response.error":
+					sendText(output.Flush())
+					message := stringValue(event["message"])
+					if message == "" {
+						message = "assistant request failed"
+					}
+					sendSSEEvent(writer, flusher, map[string]string{
+						"type":    "error",
+						"message": message,
+					})
+				}
 			}
-			if proposalPayload, ok := callBuffer.finalizeProposal(event, tripID); ok {
-				proposalIssued = true
-				sendSSEEvent(writer, flusher, proposalPayload)
-				return nil
-			}
-		case "response.output_text.delta":
-			delta, _ := event["delta"].(string)
-			if delta != "" {
-				sendSSEEvent(writer, flusher, map[string]string{
-					"type": "delta",
-					"text": delta,
-				})
+
+			if err := scanner.Err(); err != nil && !errors.Is(err, io.EOF) {
+				return nil, truncation(err, body, streamCtx)
 			}
-		case "response.completed":
-			sendSSEEvent(writer, flusher, map[string]string{
-				"type": "done",
+			return nil, nil
+		}()
+		var truncated *streamTruncation
+		if errors.As(err, &truncated) {
+			return endTruncatedStream(writer, flusher, reply, citations, truncated, config, output), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if proposal != nil {
+			proposalIssued = true
+			sendText(output.Flush())
+			reply.Proposal = proposal
+			sendSSEEvent(writer, flusher, map[string]interface{}{
+				"type":      "proposal",
+				"proposal":  proposalPayload(proposal),
+				"duplicate": callBuffer.reused,
 			})
-			completed = true
-		case "response.error":
-			message := stringValue(event["message"])
-			if message == "" {
-				message = "assistant request failed"
+			reply.ToolResults = append(reply.ToolResults, citationResult(citations)...)
+			if sources, ok := sourcesEvent(reply.ToolResults); ok {
+				sendSSEEvent(writer, flusher, sources)
 			}
-			sendSSEEvent(writer, flusher, map[string]string{
-				"type":    "error",
-				"message": message,
-			})
+			return reply, nil
 		}
-	}
 
-	if err := scanner.Err(); err != nil && !errors.Is(err, io.EOF) {
-		return err
+		if completed || len(lookups) == 0 || responseID == "" {
+			break
+		}
+		payload["previous_response_id"] = responseID
+		payload["input"] = lookups
+		if round+1 == maxLocalToolRounds {
+			payload["tool_choice"] = "none"
+		}
 	}
 
-	if !completed && !proposalIssued {
+	if !completed {
+		sendText(output.Flush())
 		sendSSEEvent(writer, flusher, map[string]string{
 			"type": "done",
 		})
 	}
 
-	return nil
+	reply.ToolResults = append(reply.ToolResults, citationResult(citations)...)
+	if completed {
+		reply.Text = replyText.String()
+	}
+
+	return reply, nil
 }
 
 func sendSSEEvent(writer http.ResponseWriter, flusher http.Flusher, payload interface{}) {
@@ -1216,20 +1459,50 @@ func sendSSEEvent(writer http.ResponseWriter, flusher http.Flusher, payload inte
 		return
 	}
 
-	_, _ = writer.Write([]byte("data: "))
-	_, _ = writer.Write(data)
-	_, _ = writer.Write([]byte("\n\n"))
+	// a single write keeps the event intact when heartbeats are interleaved
+	_, _ = writer.Write([]byte("data: " + string(data) + "\n\n"))
 	flusher.Flush()
 }
 
-func buildAssistantTools() []map[string]interface{} {
+func buildAssistantTools(config assistantConfig) []map[string]interface{} {
 	tools := []map[string]interface{}{
 		{
 			"type": "web_search",
 		},
 	}
 	tools = append(tools, assistantFunctionTools()...)
-	return tools
+	tools = append(tools, assistantCarRentalTools()...)
+	tools = append(tools, assistantDiningTools()...)
+	tools = append(tools, assistantExpenseTools()...)
+	tools = append(tools, assistantPollTools()...)
+	tools = append(tools, assistantDocumentTools()...)
+	tools = append(tools, assistantNotesSearchTools()...)
+	tools = append(tools, assistantRankingTools()...)
+	tools = append(tools, assistantRiskTools()...)
+	tools = append(tools, assistantDailySpendTools()...)
+	tools = append(tools, assistantPlacesTools()...)
+	tools = append(tools, assistantTravelHistoryTools()...)
+	// the hotel search needs an account with a provider, without one the
+	// model searches the web as before
+	if lodgingProvider() != nil {
+		tools = append(tools, assistantLodgingSearchTools()...)
+	}
+
+	enabled := make([]map[string]interface{}, 0, len(tools))
+	for _, tool := range tools {
+		if !config.DisabledTools[assistantToolName(tool)] {
+			enabled = append(enabled, tool)
+		}
+	}
+	return enabled
+}
+
+// assistantToolName is the function name, or the type for built-in tools
+func assistantToolName(tool map[string]interface{}) string {
+	if name := stringValue(tool["name"]); name != "" {
+		return name
+	}
+	return stringValue(tool["type"])
 }
 
 func assistantFunctionTools() []map[string]interface{} {
@@ -1266,7 +1539,13 @@ func assistantFunctionTools() []map[string]interface{} {
 						"type":        "string",
 						"description": "End time in RFC3339 format (local time).",
 					},
-					"notes":      map[string]interface{}{"type": "string", "description": "Internal notes/reminders"},
+					"timezone": map[string]interface{}{"type": "string", "description": "IANA timezone of the location (e.g. Europe/Paris)"},
+					"notes":    map[string]interface{}{"type": "string", "description": "Internal notes/reminders"},
+					"tags": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Short lower case tags such as rainy-day, kid-friendly or must-do, reusing the tags of the trip",
+					},
 					"cost_value": map[string]interface{}{"type": "number", "description": "Estimated cost numeric value"},
 					"cost_currency": map[string]interface{}{
 						"type":        "string",
@@ -1280,7 +1559,7 @@ func assistantFunctionTools() []map[string]interface{} {
 		{
 			"type":        "function",
 			"name":        assistantToolUpdateActivity,
-			"description": "Update an existing activity. Always include the record_id shown in the trip context and provide only the fields that should change. Mention assumptions if you infer details.",
+			"description": "Update an existing activity. Always include the record_id shown in the trip context and provide only the fields that should change. Saved places not scheduled yet are scheduled by setting their start_time. Mention assumptions if you infer details.",
 			"parameters": map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
@@ -1301,9 +1580,15 @@ func assistantFunctionTools() []map[string]interface{} {
 							"place_id":  map[string]interface{}{"type": "string"},
 						},
 					},
-					"start_time":    map[string]interface{}{"type": "string"},
-					"end_time":      map[string]interface{}{"type": "string"},
-					"notes":         map[string]interface{}{"type": "string"},
+					"start_time": map[string]interface{}{"type": "string"},
+					"end_time":   map[string]interface{}{"type": "string"},
+					"timezone":   map[string]interface{}{"type": "string"},
+					"notes":      map[string]interface{}{"type": "string"},
+					"tags": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "All the tags the activity should have, an empty list removes them",
+					},
 					"cost_value":    map[string]interface{}{"type": "number"},
 					"cost_currency": map[string]interface{}{"type": "string"},
 				},
@@ -1325,6 +1610,21 @@ func assistantFunctionTools() []map[string]interface{} {
 				"additionalProperties": false,
 			},
 		},
+		{
+			"type":        "function",
+			"name":        assistantToolSwapActivities,
+			"description": "Swap the days of two activities, e.g. to move an outdoor plan away from a rainy day. Each activity keeps its time of day.",
+			"parameters": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"first_record_id":  map[string]interface{}{"type": "string"},
+					"second_record_id": map[string]interface{}{"type": "string"},
+					"reason":           map[string]interface{}{"type": "string", "description": "Optional reason/reminder"},
+				},
+				"required":             []string{"first_record_id", "second_record_id"},
+				"additionalProperties": false,
+			},
+		},
 		{
 			"type":        "function",
 			"name":        assistantToolCreateLodging,
@@ -1337,11 +1637,15 @@ func assistantFunctionTools() []map[string]interface{} {
 					"address":    map[string]interface{}{"type": "string", "description": "Address or area"},
 					"start_time": map[string]interface{}{"type": "string", "description": "Check-in time/date in RFC3339"},
 					"end_time":   map[string]interface{}{"type": "string", "description": "Check-out time/date in RFC3339"},
+					"timezone":   map[string]interface{}{"type": "string", "description": "IANA timezone of the location (e.g. Europe/Paris)"},
 					"confirmation": map[string]interface{}{
 						"type":        "string",
 						"description": "Confirmation number or reservation code",
 					},
-					"notes": map[string]interface{}{"type": "string", "description": "Extra notes or reminders"},
+					"notes":         map[string]interface{}{"type": "string", "description": "Extra notes or reminders"},
+					"rooms":         assistantRoomsSchema(),
+					"cost_value":    map[string]interface{}{"type": "number", "description": "Total price of the stay"},
+					"cost_currency": map[string]interface{}{"type": "string", "description": "ISO currency code, e.g. EUR"},
 				},
 				"required":             []string{"name", "start_time", "end_time"},
 				"additionalProperties": false,
@@ -1350,18 +1654,22 @@ func assistantFunctionTools() []map[string]interface{} {
 		{
 			"type":        "function",
 			"name":        assistantToolUpdateLodging,
-			"description": "Update an existing lodging entry. Always include record_id.",
+			"description": "Update an existing lodging entry. Always include record_id. Use rooms to record who sleeps where.",
 			"parameters": map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"record_id":    map[string]interface{}{"type": "string"},
-					"name":         map[string]interface{}{"type": "string"},
-					"type":         map[string]interface{}{"type": "string"},
-					"address":      map[string]interface{}{"type": "string"},
-					"start_time":   map[string]interface{}{"type": "string"},
-					"end_time":     map[string]interface{}{"type": "string"},
-					"confirmation": map[string]interface{}{"type": "string"},
-					"notes":        map[string]interface{}{"type": "string"},
+					"record_id":     map[string]interface{}{"type": "string"},
+					"name":          map[string]interface{}{"type": "string"},
+					"type":          map[string]interface{}{"type": "string"},
+					"address":       map[string]interface{}{"type": "string"},
+					"start_time":    map[string]interface{}{"type": "string"},
+					"end_time":      map[string]interface{}{"type": "string"},
+					"timezone":      map[string]interface{}{"type": "string"},
+					"confirmation":  map[string]interface{}{"type": "string"},
+					"notes":         map[string]interface{}{"type": "string"},
+					"rooms":         assistantRoomsSchema(),
+					"cost_value":    map[string]interface{}{"type": "number"},
+					"cost_currency": map[string]interface{}{"type": "string"},
 				},
 				"required":             []string{"record_id"},
 				"additionalProperties": false,
@@ -1400,7 +1708,10 @@ func assistantFunctionTools() []map[string]interface{} {
 						"type":        "string",
 						"description": "Arrival time in RFC3339",
 					},
-					"notes": map[string]interface{}{"type": "string", "description": "Extra notes (confirmation, seats, etc.)"},
+					"origin_timezone":      map[string]interface{}{"type": "string", "description": "IANA timezone of the origin"},
+					"destination_timezone": map[string]interface{}{"type": "string", "description": "IANA timezone of the destination"},
+					"notes":                map[string]interface{}{"type": "string", "description": "Extra notes (confirmation, etc.)"},
+					"seats":                assistantSeatsSchema(),
 				},
 				"required":             []string{"type", "origin", "departure_time"},
 				"additionalProperties": false,
@@ -1413,14 +1724,17 @@ func assistantFunctionTools() []map[string]interface{} {
 			"parameters": map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"record_id":      map[string]interface{}{"type": "string"},
-					"type":           map[string]interface{}{"type": "string"},
-					"provider":       map[string]interface{}{"type": "string"},
-					"origin":         map[string]interface{}{"type": "string"},
-					"destination":    map[string]interface{}{"type": "string"},
-					"departure_time": map[string]interface{}{"type": "string"},
-					"arrival_time":   map[string]interface{}{"type": "string"},
-					"notes":          map[string]interface{}{"type": "string"},
+					"record_id":            map[string]interface{}{"type": "string"},
+					"type":                 map[string]interface{}{"type": "string"},
+					"provider":             map[string]interface{}{"type": "string"},
+					"origin":               map[string]interface{}{"type": "string"},
+					"destination":          map[string]interface{}{"type": "string"},
+					"departure_time":       map[string]interface{}{"type": "string"},
+					"arrival_time":         map[string]interface{}{"type": "string"},
+					"origin_timezone":      map[string]interface{}{"type": "string"},
+					"destination_timezone": map[string]interface{}{"type": "string"},
+					"notes":                map[string]interface{}{"type": "string"},
+					"seats":                assistantSeatsSchema(),
 				},
 				"required":             []string{"record_id"},
 				"additionalProperties": false,
@@ -1443,56 +1757,70 @@ func assistantFunctionTools() []map[string]interface{} {
 	}
 }
 
-func storeAssistantProposal(proposal *assistantProposal) {
-	proposalStore.Lock()
-	defer proposalStore.Unlock()
-	proposalStore.items[proposal.ID] = proposal
-}
-
-func popAssistantProposal(id string) (*assistantProposal, bool) {
-	proposalStore.Lock()
-	defer proposalStore.Unlock()
-	proposal, ok := proposalStore.items[id]
-	if ok {
-		delete(proposalStore.items, id)
-	}
-	return proposal, ok
-}
-
-func getAssistantProposal(id string) (*assistantProposal, bool) {
-	proposalStore.RLock()
-	defer proposalStore.RUnlock()
-	proposal, ok := proposalStore.items[id]
-	return proposal, ok
-}
-
-func summarizeProposal(tool string, args map[string]interface{}) string {
+func summarizeProposal(tool string, args map[string]interface{}, locale assistantLocale) string {
 	switch tool {
 	case assistantToolCreateActivity:
-		return fmt.Sprintf("I'll add an activity \"%s\" starting %s.", stringValue(args["name"]), stringValue(args["start_time"]))
+		return fmt.Sprintf("I'll add an activity \"%s\" starting %s.", stringValue(args["name"]), locale.formatDateTime(stringValue(args["start_time"])))
 	case assistantToolUpdateActivity:
 		return fmt.Sprintf("I'll update activity %s.", stringValue(args["record_id"]))
 	case assistantToolDeleteActivity:
 		return fmt.Sprintf("I'll delete activity %s.", stringValue(args["record_id"]))
 	case assistantToolCreateLodging:
-		return fmt.Sprintf("I'll add lodging \"%s\" from %s to %s.", stringValue(args["name"]), stringValue(args["start_time"]), stringValue(args["end_time"]))
+		return fmt.Sprintf("I'll add lodging \"%s\" from %s to %s.", stringValue(args["name"]), locale.formatDateTime(stringValue(args["start_time"])), locale.formatDateTime(stringValue(args["end_time"])))
 	case assistantToolUpdateLodging:
+		if rooms, ok := assistantRooms(args["rooms"]); ok {
+			return fmt.Sprintf("I'll update lodging %s with these rooms: %s.", stringValue(args["record_id"]), summarizeRooms(rooms))
+		}
 		return fmt.Sprintf("I'll update lodging %s.", stringValue(args["record_id"]))
 	case assistantToolDeleteLodging:
 		return fmt.Sprintf("I'll delete lodging %s.", stringValue(args["record_id"]))
 	case assistantToolCreateTransportation:
-		return fmt.Sprintf("I'll add %s from %s to %s departing %s.", stringValue(args["type"]), stringValue(args["origin"]), stringValue(args["destination"]), stringValue(args["departure_time"]))
+		return fmt.Sprintf("I'll add %s from %s to %s departing %s.", stringValue(args["type"]), stringValue(args["origin"]), stringValue(args["destination"]), locale.formatDateTime(stringValue(args["departure_time"])))
 	case assistantToolUpdateTransportation:
+		if seats, ok := assistantSeats(args["seats"]); ok {
+			return fmt.Sprintf("I'll update transportation %s with these seats: %s.", stringValue(args["record_id"]), trips.SeatSummary(seats))
+		}
 		return fmt.Sprintf("I'll update transportation %s.", stringValue(args["record_id"]))
 	case assistantToolDeleteTransportation:
 		return fmt.Sprintf("I'll delete transportation %s.", stringValue(args["record_id"]))
+	case assistantToolCreateCarRental:
+		return fmt.Sprintf("I'll add a car rental picked up at %s on %s.", stringValue(args["pickup_location"]), locale.formatDateTime(stringValue(args["pickup_time"])))
+	case assistantToolUpdateCarRental:
+		return fmt.Sprintf("I'll update car rental %s.", stringValue(args["record_id"]))
+	case assistantToolDeleteCarRental:
+		return fmt.Sprintf("I'll delete car rental %s.", stringValue(args["record_id"]))
+	case assistantToolCreateDining:
+		return fmt.Sprintf("I'll add a reservation at \"%s\" on %s.", stringValue(args["name"]), locale.formatDateTime(stringValue(args["time"])))
+	case assistantToolUpdateDining:
+		return fmt.Sprintf("I'll update reservation %s.", stringValue(args["record_id"]))
+	case assistantToolDeleteDining:
+		return fmt.Sprintf("I'll delete reservation %s.", stringValue(args["record_id"]))
+	case assistantToolCreateExpense:
+		if amount := proposalAmount(args); amount != "" {
+			return fmt.Sprintf("I'll record an expense \"%s\" of %s.", stringValue(args["name"]), amount)
+		}
+		return fmt.Sprintf("I'll record an expense \"%s\".", stringValue(args["name"]))
+	case assistantToolUpdateExpense:
+		return fmt.Sprintf("I'll update expense %s.", stringValue(args["record_id"]))
+	case assistantToolDeleteExpense:
+		return fmt.Sprintf("I'll delete expense %s.", stringValue(args["record_id"]))
+	case assistantToolCreatePoll:
+		return fmt.Sprintf("I'll ask everyone to vote: %s", stringValue(args["question"]))
+	case assistantToolSwapActivities:
+		return fmt.Sprintf("I'll swap the days of activities %s and %s.", stringValue(args["first_record_id"]), stringValue(args["second_record_id"]))
 	default:
 		return "I have a change ready to apply."
 	}
 }
 
-func (p *assistantProposal) expired() bool {
-	return time.Now().UTC().After(p.ExpiresAt)
+// proposalAmount formats the cost arguments of a proposal, or returns an
+// empty string when there are none
+func proposalAmount(args map[string]interface{}) string {
+	code := strings.ToUpper(stringValue(args["cost_currency"]))
+	if _, ok := args["cost_value"]; !ok || code == "" {
+		return ""
+	}
+	return currency.Format(floatValue(args["cost_value"]), code)
 }
 
 func parseOpenAIError(resp *http.Response) error {
@@ -1516,6 +1844,26 @@ func parseOpenAIError(resp *http.Response) error {
 	return fmt.Errorf("openai api error: %s", resp.Status)
 }
 
+func extractToolResults(response responsesAPIResponse) []assistantToolResult {
+	results := make([]assistantToolResult, 0)
+	citations := make([]assistantSource, 0)
+
+	for _, item := range response.Output {
+		if result, ok := parseWebSearchCall(map[string]interface{}{"type": item.Type, "action": item.Action}); ok {
+			results = append(results, result)
+		}
+		for _, block := range item.Content {
+			for _, annotation := range block.Annotations {
+				if source, ok := parseUrlCitation(annotation, block.Text); ok {
+					citations = append(citations, source)
+				}
+			}
+		}
+	}
+
+	return append(results, citationResult(citations)...)
+}
+
 func extractFallbackOutput(response responsesAPIResponse) string {
 	for _, message := range response.Output {
 		for _, block := range message.Content {
@@ -1531,8 +1879,19 @@ type functionCallBuffer struct {
 	active   bool
 	name     string
 	itemID   string
+	callID   string
 	builder  strings.Builder
-	proposal *assistantProposal
+	proposal *proposals.Proposal
+	// reused is set when the last finalized proposal was already pending
+	reused bool
+	// number of arguments in the last proposal_draft event
+	draftFields int
+	// used for the dates in proposal summaries
+	locale assistantLocale
+	// user whose chat is being streamed
+	requestedBy string
+	// when the trip context sent to the model was generated
+	contextAt time.Time
 }
 
 func (b *functionCallBuffer) handleOutputItemAdded(item map[string]interface{}) {
@@ -1543,24 +1902,28 @@ func (b *functionCallBuffer) handleOutputItemAdded(item map[string]interface{})
 	b.active = true
 	b.name = stringValue(item["name"])
 	b.itemID = stringValue(item["id"])
+	b.callID = stringValue(item["call_id"])
 	b.builder.Reset()
+	b.draftFields = 0
 }
 
-func (b *functionCallBuffer) handleArgumentsDelta(event map[string]interface{}) {
+func (b *functionCallBuffer) handleArgumentsDelta(event map[string]interface{}) (map[string]interface{}, bool) {
 	if !b.active {
-		return
+		return nil, false
 	}
 	itemID := stringValue(event["item_id"])
 	if itemID != "" && itemID != b.itemID {
-		return
+		return nil, false
 	}
 	delta, _ := event["delta"].(string)
-	if delta != "" {
-		b.builder.WriteString(delta)
+	if delta == "" {
+		return nil, false
 	}
+	b.builder.WriteString(delta)
+	return b.draftEvent()
 }
 
-func (b *functionCallBuffer) finalizeProposal(event map[string]interface{}, tripID string) (map[string]interface{}, bool) {
+func (b *functionCallBuffer) finalizeProposal(event map[string]interface{}, tripID string, config assistantConfig) (*proposals.Proposal, bool) {
 	if !b.active {
 		return nil, false
 	}
@@ -1574,33 +1937,76 @@ func (b *functionCallBuffer) finalizeProposal(event map[string]interface{}, trip
 		return nil, false
 	}
 
+	proposal, ok := newAssistantProposal(b.name, argsJSON, tripID, b.requestedBy, b.contextAt, config, b.locale)
+	if !ok {
+		return nil, false
+	}
+	// a retried stream or a collaborator asking for the same change gets the
+	// pending proposal instead of a second one
+	stored, created := proposals.StoreUnique(proposal)
+	b.reused = !created
+	b.active = false
+	b.builder.Reset()
+	b.itemID = ""
+
+	return stored, true
+}
+
+// newAssistantProposal makes the proposal for a call of a proposal tool,
+// the arguments are the JSON the model sent
+func newAssistantProposal(tool string, argsJSON string, tripID string, requestedBy string, contextAt time.Time, config assistantConfig, locale assistantLocale) (*proposals.Proposal, bool) {
 	var args map[string]interface{}
 	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
 		return nil, false
 	}
+	resolveNaturalTimes(tool, args, locale)
+	assumptions := applyDefaultDuration(tool, args, config.ActivityDurations)
+
+	return &proposals.Proposal{
+		ID:          uuid.NewString(),
+		TripID:      tripID,
+		Tool:        tool,
+		Arguments:   args,
+		Summary:     summarizeProposal(tool, args, locale),
+		Assumptions: assumptions,
+		RequestedBy: requestedBy,
+		ContextAt:   contextAt,
+		CreatedAt:   time.Now().UTC(),
+		ExpiresAt:   time.Now().UTC().Add(config.ProposalTTL),
+	}, true
+}
 
-	proposal := &assistantProposal{
-		ID:        uuid.NewString(),
-		TripID:    tripID,
-		Tool:      b.name,
-		Arguments: args,
-		CreatedAt: time.Now().UTC(),
-		ExpiresAt: time.Now().UTC().Add(proposalTTL),
+// PendingAssistantProposals lists the proposals of the trip that are still
+// waiting for a decision, including the ones created by background jobs
+func PendingAssistantProposals(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	viewer := !trips.CanEdit(requestTripRole(e))
+	locale := loadAssistantLocale(e.Auth)
+
+	pending := make([]map[string]interface{}, 0)
+	for _, proposal := range proposals.ListForTrip(trip.Id) {
+		payload := proposalPayload(proposal)
+		if viewer {
+			args := viewerSafeArguments(proposal.Arguments)
+			payload["arguments"] = args
+			payload["summary"] = summarizeProposal(proposal.Tool, args, locale)
+		}
+		pending = append(pending, payload)
 	}
-	storeAssistantProposal(proposal)
-	summary := summarizeProposal(proposal.Tool, proposal.Arguments)
-	b.active = false
-	b.builder.Reset()
-	b.itemID = ""
 
+	return e.JSON(http.StatusOK, map[string]interface{}{"proposals": pending})
+}
+
+func proposalPayload(proposal *proposals.Proposal) map[string]interface{} {
 	return map[string]interface{}{
-		"type": "proposal",
-		"proposal": map[string]interface{}{
-			"id":        proposal.ID,
-			"tool":      proposal.Tool,
-			"arguments": proposal.Arguments,
-			"summary":   summary,
-			"expiresAt": proposal.ExpiresAt.Format(time.RFC3339),
-		},
-	}, true
+		"id":            proposal.ID,
+		"tool":          proposal.Tool,
+		"arguments":     proposal.Arguments,
+		"summary":       proposal.Summary,
+		"assumptions":   proposal.Assumptions,
+		"requestedBy":   proposal.RequestedBy,
+		"expiresAt":     proposal.ExpiresAt.Format(time.RFC3339),
+		"schemaVersion": proposal.SchemaVersion,
+	}
 }
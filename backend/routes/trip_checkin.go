@@ -0,0 +1,189 @@
+package routes
+
+import (
+	"backend/notifications"
+	"backend/proposals"
+	"backend/trips"
+	bt "backend/types"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/ringsaturn/tzf"
+)
+
+// A week before departure the assistant checks in with the trip owner: it
+// runs the readiness check, proposes the fixes it can derive on its own and
+// writes a message that is kept in assistant_messages, where the assistant
+// panel shows it as the start of a conversation. The owner is notified as
+// well, by email or push when they chose to.
+
+const checkInPrompt = "The trip starts in about a week. Write a short, friendly message to the traveler, in plain text, that lists what is still missing from the trip and offers to help fill the gaps, for example by finding a place to stay or adding the missing details if they share them. Mention that the suggested corrections are waiting for their approval when there are any. When nothing is missing, say the trip looks ready. Use only the facts given and do not repeat ids."
+
+// PreTripCheckIn writes the pre-trip check-in message of a trip to its owner
+// and notifies them. The scheduled job makes sure it happens once per trip.
+func PreTripCheckIn(app core.App, trip *core.Record, finder tzf.F) error {
+	owner, err := app.FindRecordById("users", trip.GetString("ownerId"))
+	if err != nil {
+		return err
+	}
+
+	gaps, err := trips.CheckReadiness(app, trip)
+	if err != nil {
+		return err
+	}
+
+	config := loadAssistantConfig(app)
+	proposalIds := make([]string, 0)
+	destinations := tripDestinationTimezones(trip)
+	for _, gap := range gaps {
+		if gap.Kind != trips.GapMissingTimezone {
+			continue
+		}
+		record, err := app.FindRecordById(gap.Collection, gap.RecordId)
+		if err != nil {
+			continue
+		}
+		plan, ok := planFromRecord(record)
+		if !ok {
+			continue
+		}
+		args := timezoneCorrection(plan, finder, destinations)
+		if len(args) == 0 {
+			continue
+		}
+		args["record_id"] = plan.recordId
+		correction := importCorrection(trip, updateTool(plan.collection), args,
+			fmt.Sprintf("Set the timezone of %s to %s?", plan.name, strings.Join(uniqueValues(args), " and ")))
+		correction.ExpiresAt = correction.CreatedAt.Add(config.ProposalTTL)
+		stored, created := proposals.StoreUnique(correction)
+		if created {
+			proposals.RecordIssued(app, stored, "")
+		}
+		proposalIds = append(proposalIds, stored.ID)
+	}
+
+	message := checkInMessage(trip, gaps, proposalIds)
+	if written, err := writeCheckInMessage(app, config, owner, trip, gaps, proposalIds); err != nil {
+		app.Logger().Warn("Check-in message failed", "error", err, "tripId", trip.Id)
+	} else if written != "" {
+		message = written
+	}
+
+	collection, err := app.FindCollectionByNameOrId("assistant_messages")
+	if err != nil {
+		return err
+	}
+	record := core.NewRecord(collection)
+	record.Set("trip", trip.Id)
+	record.Set("user", owner.Id)
+	record.Set("kind", "check_in")
+	record.Set("message", message)
+	record.Set("gaps", gaps)
+	record.Set("proposalIds", proposalIds)
+	if err := app.Save(record); err != nil {
+		return err
+	}
+
+	err = notifications.Send(app, notifications.Notification{
+		UserId:  owner.Id,
+		TripId:  trip.Id,
+		Kind:    notifications.KindCheckIn,
+		Title:   fmt.Sprintf("%s is a week away", trip.GetString("name")),
+		Message: message,
+		Link:    "/trips/" + trip.Id,
+	})
+	if err != nil {
+		app.Logger().Warn("Could not send the check-in", "error", err, "tripId", trip.Id)
+	}
+	return nil
+}
+
+// checkInMessage is the check-in written without the assistant, used when it
+// is not configured or does not answer
+func checkInMessage(trip *core.Record, gaps []*bt.ReadinessGap, proposalIds []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s starts on %s.", trip.GetString("name"), trip.GetDateTime("startDate").Time().Format("January 2"))
+	if len(gaps) == 0 {
+		b.WriteString(" Everything looks ready, have a good trip!")
+		return b.String()
+	}
+	b.WriteString(" A few things are still missing:")
+	for _, gap := range gaps {
+		if gap.Name != "" {
+			fmt.Fprintf(&b, "\n- %s %s", gap.Name, gap.Detail)
+		} else {
+			fmt.Fprintf(&b, "\n- %s", gap.Detail)
+		}
+	}
+	if len(proposalIds) > 0 {
+		b.WriteString("\nThe suggested changes are waiting for your approval.")
+	}
+	b.WriteString("\nReply here and I can help fill the rest.")
+	return b.String()
+}
+
+// writeCheckInMessage lets the assistant word the check-in, in the owner's
+// language. It returns an empty message when no API key is set.
+func writeCheckInMessage(app core.App, config assistantConfig, owner *core.Record, trip *core.Record, gaps []*bt.ReadinessGap, proposalIds []string) (string, error) {
+	apiKey := strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
+	if apiKey == "" {
+		return "", nil
+	}
+
+	facts, err := json.Marshal(map[string]interface{}{
+		"trip":              trip.GetString("name"),
+		"startDate":         trip.GetDateTime("startDate").Time().Format("2006-01-02"),
+		"missing":           gaps,
+		"pendingCorrection": len(proposalIds) > 0,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// the check-in is only words, the corrections are already proposed
+	config.DisabledTools = map[string]bool{}
+	for _, tool := range buildAssistantTools(assistantConfig{}) {
+		config.DisabledTools[assistantToolName(tool)] = true
+	}
+
+	input := []map[string]interface{}{
+		newResponsesTextBlock("developer", checkInPrompt+" "+loadAssistantLocale(owner).promptInstructions()),
+		newResponsesTextBlock("developer", fmt.Sprintf("Readiness:\n%s", string(facts))),
+	}
+	reply, err := invokeResponsesAPI(context.Background(), apiKey, input, config, "low", nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(reply.Text), nil
+}
+
+// TripReadiness lists what is still missing from the trip. Viewers who do
+// not see private plans do not see their gaps either.
+func TripReadiness(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	gaps, err := trips.CheckReadiness(e.App, trip)
+	if err != nil {
+		return err
+	}
+	if !trips.SeesPrivate(requestTripRole(e)) {
+		visible := make([]*bt.ReadinessGap, 0, len(gaps))
+		for _, gap := range gaps {
+			if gap.RecordId != "" {
+				record, err := e.App.FindRecordById(gap.Collection, gap.RecordId)
+				if err != nil || trips.ItemPrivacy(record).Item {
+					continue
+				}
+			}
+			visible = append(visible, gap)
+		}
+		gaps = visible
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{"gaps": gaps})
+}
@@ -0,0 +1,273 @@
+package routes
+
+import (
+	"backend/notifications"
+	"backend/trips"
+	bt "backend/types"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const maxCommentLength = 5000
+
+type tripCommentRequest struct {
+	Collection string `json:"collection"`
+	RecordId   string `json:"recordId"`
+	Body       string `json:"body"`
+}
+
+// ListTripComments lists the comments of one item, given by collection and
+// recordId, or of every item of the trip the user may see, oldest first
+func ListTripComments(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	role := requestTripRole(e)
+	collection := e.Request.URL.Query().Get("collection")
+	recordId := e.Request.URL.Query().Get("recordId")
+
+	filter := dbx.HashExp{"trip": trip.Id}
+	if collection != "" || recordId != "" {
+		if _, ok := trips.CommentedItem(e.App, trip, collection, recordId, role); !ok {
+			return e.JSON(http.StatusNotFound, map[string]string{"error": "item not found"})
+		}
+		filter["collection"] = collection
+		filter["recordId"] = recordId
+	}
+
+	records := make([]*core.Record, 0)
+	err := e.App.RecordQuery("comments").AndWhere(filter).OrderBy("created ASC").All(&records)
+	if err != nil {
+		return err
+	}
+
+	// the comments of items that are private, or gone, are left out
+	visible := map[string]bool{}
+	comments := make([]*core.Record, 0, len(records))
+	for _, comment := range records {
+		key := comment.GetString("collection") + "/" + comment.GetString("recordId")
+		seen, checked := visible[key]
+		if !checked {
+			_, seen = trips.CommentedItem(e.App, trip, comment.GetString("collection"), comment.GetString("recordId"), role)
+			visible[key] = seen
+		}
+		if seen {
+			comments = append(comments, comment)
+		}
+	}
+
+	return e.JSON(http.StatusOK, commentViews(e.App, comments))
+}
+
+// CreateTripComment adds a comment to an item. Every member who sees the item
+// can take part, viewers too. The members @mentioned are notified, and so are
+// the ones who commented on the item before.
+func CreateTripComment(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	role := requestTripRole(e)
+
+	var req tripCommentRequest
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	body, ok := commentBody(req.Body)
+	if !ok {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("body must be between 1 and %d characters", maxCommentLength)})
+	}
+	item, ok := trips.CommentedItem(e.App, trip, req.Collection, req.RecordId, role)
+	if !ok {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "item not found"})
+	}
+
+	mentions, err := commentMentions(e.App, trip, item, body)
+	if err != nil {
+		return err
+	}
+	commenters, err := trips.ItemCommenters(e.App, item)
+	if err != nil {
+		return err
+	}
+
+	collection, err := e.App.FindCollectionByNameOrId("comments")
+	if err != nil {
+		return err
+	}
+	comment := core.NewRecord(collection)
+	comment.Set("trip", trip.Id)
+	comment.Set("collection", item.Collection().Name)
+	comment.Set("recordId", item.Id)
+	comment.Set("author", e.Auth.Id)
+	comment.Set("body", body)
+	comment.Set("mentions", mentions)
+	if err := e.App.Save(comment); err != nil {
+		return err
+	}
+
+	notifications.SendAll(e.App, commentNotifications(trip, item, comment, e.Auth, mentions, commenters))
+	return e.JSON(http.StatusCreated, trips.CommentView(comment, map[string]*core.Record{e.Auth.Id: e.Auth}))
+}
+
+// UpdateTripComment changes the text of a comment, only its author can.
+// Members who are newly @mentioned are notified.
+func UpdateTripComment(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	comment, item, ok := findTripComment(e, trip)
+	if !ok {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "comment not found"})
+	}
+	if comment.GetString("author") != e.Auth.Id {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "only the author can edit a comment"})
+	}
+
+	var req tripCommentRequest
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	body, ok := commentBody(req.Body)
+	if !ok {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("body must be between 1 and %d characters", maxCommentLength)})
+	}
+
+	mentions, err := commentMentions(e.App, trip, item, body)
+	if err != nil {
+		return err
+	}
+	before := map[string]bool{}
+	for _, id := range comment.GetStringSlice("mentions") {
+		before[id] = true
+	}
+	added := make([]string, 0)
+	for _, id := range mentions {
+		if !before[id] {
+			added = append(added, id)
+		}
+	}
+
+	comment.Set("body", body)
+	comment.Set("mentions", mentions)
+	comment.Set("editedAt", types.NowDateTime())
+	if err := e.App.Save(comment); err != nil {
+		return err
+	}
+
+	notifications.SendAll(e.App, commentNotifications(trip, item, comment, e.Auth, added, nil))
+	return e.JSON(http.StatusOK, trips.CommentView(comment, map[string]*core.Record{e.Auth.Id: e.Auth}))
+}
+
+// DeleteTripComment removes a comment, its author and the trip owner can
+func DeleteTripComment(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	comment, _, ok := findTripComment(e, trip)
+	if !ok {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "comment not found"})
+	}
+	if comment.GetString("author") != e.Auth.Id && requestTripRole(e) != trips.RoleOwner {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "only the author or the trip owner can delete a comment"})
+	}
+
+	if err := e.App.Delete(comment); err != nil {
+		return err
+	}
+	return e.NoContent(http.StatusNoContent)
+}
+
+// findTripComment returns the comment of the path with its item, when the
+// user may see the item
+func findTripComment(e *core.RequestEvent, trip *core.Record) (*core.Record, *core.Record, bool) {
+	comment, err := e.App.FindRecordById("comments", e.Request.PathValue("commentId"))
+	if err != nil || comment.GetString("trip") != trip.Id {
+		return nil, nil, false
+	}
+	item, ok := trips.CommentedItem(e.App, trip, comment.GetString("collection"), comment.GetString("recordId"), requestTripRole(e))
+	return comment, item, ok
+}
+
+func commentBody(body string) (string, bool) {
+	body = strings.TrimSpace(body)
+	return body, body != "" && len([]rune(body)) <= maxCommentLength
+}
+
+// commentMentions returns the members mentioned in the comment who can see
+// the item, private items are only seen by the owner
+func commentMentions(app core.App, trip *core.Record, item *core.Record, body string) ([]string, error) {
+	members, err := trips.TripMembers(app, trip)
+	if err != nil {
+		return nil, err
+	}
+	mentions := make([]string, 0)
+	for _, id := range trips.ParseMentions(body, members) {
+		if !trips.ItemPrivacy(item).Item || trips.SeesPrivate(trips.TripRole(trip, id)) {
+			mentions = append(mentions, id)
+		}
+	}
+	return mentions, nil
+}
+
+// commentNotifications tells the mentioned members they were mentioned and
+// the earlier commenters that the discussion went on, never the author
+func commentNotifications(trip *core.Record, item *core.Record, comment *core.Record, author *core.Record, mentions []string, commenters []string) []notifications.Notification {
+	label := trips.ItemLabel(item)
+	data := map[string]any{"collection": item.Collection().Name, "recordId": item.Id, "commentId": comment.Id}
+	link := fmt.Sprintf("/trips/%s", trip.Id)
+
+	notified := map[string]bool{author.Id: true}
+	result := make([]notifications.Notification, 0)
+	for _, id := range mentions {
+		if notified[id] {
+			continue
+		}
+		notified[id] = true
+		result = append(result, notifications.Notification{
+			UserId:  id,
+			TripId:  trip.Id,
+			Kind:    notifications.KindCommentMention,
+			Title:   fmt.Sprintf("%s mentioned you on %s", author.GetString("name"), label),
+			Message: comment.GetString("body"),
+			Link:    link,
+			Data:    data,
+		})
+	}
+	for _, id := range commenters {
+		// members who left the trip, or lost sight of the item, hear nothing
+		if notified[id] || trips.TripRole(trip, id) == "" || trips.ItemPrivacy(item).Item && !trips.SeesPrivate(trips.TripRole(trip, id)) {
+			continue
+		}
+		notified[id] = true
+		result = append(result, notifications.Notification{
+			UserId:  id,
+			TripId:  trip.Id,
+			Kind:    notifications.KindCommentReply,
+			Title:   fmt.Sprintf("%s commented on %s", author.GetString("name"), label),
+			Message: comment.GetString("body"),
+			Link:    link,
+			Data:    data,
+		})
+	}
+	return result
+}
+
+// commentViews shows the comments with the names of their authors
+func commentViews(app core.App, comments []*core.Record) []bt.Comment {
+	ids := make([]string, 0)
+	for _, comment := range comments {
+		ids = append(ids, comment.GetString("author"))
+	}
+	authors := map[string]*core.Record{}
+	if users, err := app.FindRecordsByIds("users", ids); err == nil {
+		for _, user := range users {
+			authors[user.Id] = user
+		}
+	}
+
+	views := make([]bt.Comment, 0, len(comments))
+	for _, comment := range comments {
+		views = append(views, trips.CommentView(comment, authors))
+	}
+	return views
+}
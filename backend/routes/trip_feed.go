@@ -0,0 +1,333 @@
+package routes
+
+import (
+	"backend/proposals"
+	"backend/trips"
+	bt "backend/types"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultFeedLimit = 50
+	maxFeedLimit     = 200
+)
+
+// feedCollections are the trip items whose changes show up in the feed
+var feedCollections = []string{"transportations", "lodgings", "activities", "trip_expenses", "equipment_rentals", "car_rentals", "dining"}
+
+// TripFeed lists what happened on a trip, newest first: plans added or
+// edited, assistant proposals and what became of them, changes to flights
+// and recent imports.
+// Changes made by approving a proposal appear once, as the decision.
+// Deleted plans are not listed, only the proposals that removed them.
+// Pages hold limit entries, the next one is read with the cursor returned
+// as next.
+func TripFeed(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	query := e.Request.URL.Query()
+
+	limit := defaultFeedLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxFeedLimit {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("limit must be between 1 and %d", maxFeedLimit)})
+		}
+		limit = parsed
+	}
+
+	var after *bt.FeedEntry
+	if value := query.Get("cursor"); value != "" {
+		at, id, _ := strings.Cut(value, "|")
+		parsed, err := time.Parse(time.RFC3339Nano, at)
+		if err != nil || id == "" {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "cursor must be the next cursor of a previous page"})
+		}
+		after = &bt.FeedEntry{At: parsed, Id: id}
+	}
+
+	entries, err := buildTripFeed(e.App, trip, requestTripRole(e))
+	if err != nil {
+		return err
+	}
+
+	page := make([]*bt.FeedEntry, 0, limit)
+	next := ""
+	for _, entry := range entries {
+		if after != nil && !feedEntryBefore(after, entry) {
+			continue
+		}
+		if len(page) == limit {
+			last := page[len(page)-1]
+			next = last.At.Format(time.RFC3339Nano) + "|" + last.Id
+			break
+		}
+		page = append(page, entry)
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"entries": page,
+		"next":    next,
+	})
+}
+
+// feedEntryBefore is the order of the feed, newest first. Entries of the same
+// time are ordered by id so pages do not skip or repeat them.
+func feedEntryBefore(a *bt.FeedEntry, b *bt.FeedEntry) bool {
+	if a.At.Equal(b.At) {
+		return a.Id > b.Id
+	}
+	return a.At.After(b.At)
+}
+
+func buildTripFeed(app core.App, trip *core.Record, role string) ([]*bt.FeedEntry, error) {
+	actions, err := app.FindAllRecords("assistant_actions", dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+	if err != nil {
+		return nil, err
+	}
+
+	flightUpdates, err := app.FindAllRecords("flight_updates", dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+	if err != nil {
+		return nil, err
+	}
+
+	// changes made by approving a proposal are described by the decision,
+	// the ones of the flight status job by the flight update
+	automatic := map[string]time.Time{}
+	for _, action := range actions {
+		if action.GetString("status") == proposals.StatusApproved && action.GetString("resultRecordId") != "" {
+			automatic[action.GetString("resultRecordId")] = action.GetDateTime("updated").Time()
+		}
+	}
+	for _, update := range flightUpdates {
+		automatic[update.GetString("transportation")] = update.GetDateTime("created").Time()
+	}
+
+	entries := make([]*bt.FeedEntry, 0)
+	hidden := map[string]bool{}
+	for _, collection := range feedCollections {
+		records, err := app.FindAllRecords(collection, dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			if !trips.SeesPrivate(role) && trips.ItemPrivacy(record).Item {
+				hidden[record.Id] = true
+				continue
+			}
+			for _, entry := range recordFeedEntries(record) {
+				if changedAt, ok := automatic[record.Id]; !ok || entry.At.Sub(changedAt).Abs() > 2*time.Second {
+					entries = append(entries, entry)
+				}
+			}
+		}
+	}
+
+	users := feedUsers(app, actions, listImportReviews(trip.Id))
+	for _, action := range actions {
+		if !actionHidden(action, hidden) {
+			entries = append(entries, actionFeedEntries(action, users)...)
+		}
+	}
+
+	for _, update := range flightUpdates {
+		if hidden[update.GetString("transportation")] {
+			continue
+		}
+		entries = append(entries, &bt.FeedEntry{
+			Id:         "flight:" + update.Id,
+			Kind:       "flight_update",
+			At:         update.GetDateTime("created").Time(),
+			Actor:      &bt.FeedActor{Type: "system"},
+			Collection: "transportations",
+			RecordId:   update.GetString("transportation"),
+			Summary:    update.GetString("summary"),
+			Status:     update.GetString("status"),
+		})
+	}
+
+	for _, review := range listImportReviews(trip.Id) {
+		entries = append(entries, &bt.FeedEntry{
+			Id:      "import:" + review.Id,
+			Kind:    "import",
+			At:      review.CreatedAt,
+			Actor:   feedUser(users, review.RequestedBy),
+			Summary: importFeedSummary(review),
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return feedEntryBefore(entries[i], entries[j])
+	})
+	return entries, nil
+}
+
+// recordFeedEntries describes when a plan was added and, if it was edited
+// since, its last edit. Records do not keep who changed them.
+func recordFeedEntries(record *core.Record) []*bt.FeedEntry {
+	collection := record.Collection().Name
+	summary := recordFeedSummary(record)
+	created := record.GetDateTime("created").Time()
+	updated := record.GetDateTime("updated").Time()
+
+	entries := []*bt.FeedEntry{{
+		Id:         "created:" + record.Id,
+		Kind:       "record_created",
+		At:         created,
+		Collection: collection,
+		RecordId:   record.Id,
+		Summary:    summary,
+	}}
+	if updated.Sub(created) >= time.Second {
+		entries = append(entries, &bt.FeedEntry{
+			Id:         "updated:" + record.Id,
+			Kind:       "record_updated",
+			At:         updated,
+			Collection: collection,
+			RecordId:   record.Id,
+			Summary:    summary,
+		})
+	}
+	return entries
+}
+
+func recordFeedSummary(record *core.Record) string {
+	switch record.Collection().Name {
+	case "transportations":
+		return fmt.Sprintf("%s from %s to %s", record.GetString("type"), record.GetString("origin"), record.GetString("destination"))
+	case "equipment_rentals":
+		return record.GetString("item")
+	case "car_rentals":
+		return strings.TrimSpace(fmt.Sprintf("%s car from %s", record.GetString("provider"), record.GetString("pickupLocation")))
+	default:
+		return record.GetString("name")
+	}
+}
+
+// actionFeedEntries describes an assistant proposal and, once decided, the
+// decision
+func actionFeedEntries(action *core.Record, users map[string]*core.Record) []*bt.FeedEntry {
+	collection := proposalCollections[action.GetString("tool")]
+	recordId := action.GetString("resultRecordId")
+	if recordId == "" {
+		recordId = stringValue(actionArguments(action)["record_id"])
+	}
+
+	assistant := &bt.FeedActor{Type: "assistant", Name: "Assistant"}
+	proposed := &bt.FeedEntry{
+		Id:         "proposal:" + action.Id,
+		Kind:       "proposal",
+		At:         action.GetDateTime("created").Time(),
+		Actor:      assistant,
+		Collection: collection,
+		RecordId:   recordId,
+		Summary:    action.GetString("summary"),
+		Status:     proposals.StatusProposed,
+	}
+	if requestedBy := action.GetString("requestedBy"); requestedBy != "" {
+		proposed.OnBehalfOf = feedUser(users, requestedBy)
+	}
+
+	status := action.GetString("status")
+	if status == proposals.StatusProposed {
+		return []*bt.FeedEntry{proposed}
+	}
+
+	decided := &bt.FeedEntry{
+		Id:         "decision:" + action.Id,
+		Kind:       "proposal_decided",
+		At:         action.GetDateTime("updated").Time(),
+		Actor:      feedUser(users, action.GetString("decidedBy")),
+		Collection: collection,
+		RecordId:   recordId,
+		Summary:    action.GetString("summary"),
+		Status:     status,
+	}
+	switch {
+	case status == proposals.StatusTimeout:
+		decided.Actor = &bt.FeedActor{Type: "system"}
+	case action.GetString("decidedBy") == "":
+		// applied by a background job
+		decided.Actor = assistant
+	}
+	if message := action.GetString("message"); message != "" && status != proposals.StatusApproved {
+		decided.Summary = fmt.Sprintf("%s (%s)", decided.Summary, message)
+	}
+	return []*bt.FeedEntry{proposed, decided}
+}
+
+// actionHidden tells whether a proposal touches an item the user may not see
+func actionHidden(action *core.Record, hidden map[string]bool) bool {
+	args := actionArguments(action)
+	for _, id := range []string{action.GetString("resultRecordId"), stringValue(args["record_id"]), stringValue(args["first_record_id"]), stringValue(args["second_record_id"])} {
+		if hidden[id] {
+			return true
+		}
+	}
+	return false
+}
+
+func actionArguments(action *core.Record) map[string]interface{} {
+	var args map[string]interface{}
+	_ = action.UnmarshalJSONField("arguments", &args)
+	return args
+}
+
+func importFeedSummary(review *bt.ImportReview) string {
+	collections := make([]string, 0, len(review.Imported))
+	for collection := range review.Imported {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+
+	counts := make([]string, 0, len(collections))
+	for _, collection := range collections {
+		counts = append(counts, fmt.Sprintf("%d %s", review.Imported[collection], collection))
+	}
+	if len(counts) == 0 {
+		return fmt.Sprintf("Imported from %s", review.Source)
+	}
+	return fmt.Sprintf("Imported %s from %s", strings.Join(counts, ", "), review.Source)
+}
+
+// feedUsers loads the users named by the entries at once
+func feedUsers(app core.App, actions []*core.Record, reviews []*bt.ImportReview) map[string]*core.Record {
+	ids := make([]string, 0)
+	for _, action := range actions {
+		ids = append(ids, action.GetString("requestedBy"), action.GetString("decidedBy"))
+	}
+	for _, review := range reviews {
+		ids = append(ids, review.RequestedBy)
+	}
+
+	ids = slices.DeleteFunc(slices.Compact(slices.Sorted(slices.Values(ids))), func(id string) bool { return id == "" })
+	users := map[string]*core.Record{}
+	records, err := app.FindRecordsByIds("users", ids)
+	if err != nil {
+		return users
+	}
+	for _, record := range records {
+		users[record.Id] = record
+	}
+	return users
+}
+
+// feedUser is the actor for a user id, users that were removed keep their id
+func feedUser(users map[string]*core.Record, id string) *bt.FeedActor {
+	if id == "" {
+		return nil
+	}
+	actor := &bt.FeedActor{Type: "user", Id: id}
+	if user, ok := users[id]; ok {
+		actor.Name = user.GetString("name")
+	}
+	return actor
+}
@@ -0,0 +1,50 @@
+package routes
+
+import (
+	"backend/trips"
+	"backend/validation"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type insuranceClaimRequest struct {
+	IncidentStart string `json:"incidentStart"`
+	IncidentEnd   string `json:"incidentEnd"`
+	Description   string `json:"description"`
+}
+
+func TripEmergencySheet(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	return e.JSON(http.StatusOK, trips.BuildEmergencySheet(e.App, trip))
+}
+
+func ExportInsuranceClaim(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	var req insuranceClaimRequest
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	incidentStart, err := validation.ParseTimestamp(strings.TrimSpace(req.IncidentStart))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "incidentStart must be a valid date/time"})
+	}
+
+	var incidentEnd time.Time
+	if strings.TrimSpace(req.IncidentEnd) != "" {
+		incidentEnd, err = validation.ParseTimestamp(strings.TrimSpace(req.IncidentEnd))
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "incidentEnd must be a valid date/time"})
+		}
+		if err := validation.ValidateRange(incidentStart, incidentEnd); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "incidentEnd " + err.Error()})
+		}
+	}
+
+	return e.JSON(http.StatusOK, trips.BuildInsuranceClaim(e.App, trip, incidentStart, incidentEnd, req.Description))
+}
@@ -0,0 +1,145 @@
+package routes
+
+import (
+	"backend/trips"
+	bt "backend/types"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type tripInvitationRequest struct {
+	Email   string `json:"email"`
+	Role    string `json:"role"`
+	Message string `json:"message"`
+}
+
+// CreateTripInvitation invites someone to the trip by email with a signed
+// link to accept it. Inviting the same address again reopens the earlier
+// invitation with the new role and a new link, the old link stops working.
+func CreateTripInvitation(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	var req tripInvitationRequest
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	address, err := mail.ParseAddress(strings.TrimSpace(req.Email))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "email must be a valid email address"})
+	}
+	email := strings.ToLower(address.Address)
+	if req.Role == "" {
+		req.Role = trips.RoleEditor
+	}
+	if req.Role != trips.RoleOwner && req.Role != trips.RoleEditor && req.Role != trips.RoleViewer {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "role must be owner, editor or viewer"})
+	}
+	if !trips.CanInvite(requestTripRole(e), req.Role) {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "you cannot invite others to this trip as " + req.Role})
+	}
+
+	member, err := e.App.FindAuthRecordByEmail("users", email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if member != nil && trips.TripRole(trip, member.Id) != "" {
+		return e.JSON(http.StatusConflict, map[string]string{"error": "this person is already on the trip"})
+	}
+
+	invitation, err := e.App.FindFirstRecordByFilter("invitations", "trip = {:tripId} && recipientEmail = {:email}",
+		dbx.Params{"tripId": trip.Id, "email": email})
+	if errors.Is(err, sql.ErrNoRows) {
+		collection, err := e.App.FindCollectionByNameOrId("invitations")
+		if err != nil {
+			return err
+		}
+		invitation = core.NewRecord(collection)
+		invitation.Set("recipientEmail", email)
+	} else if err != nil {
+		return err
+	}
+
+	invitation.Set("message", strings.TrimSpace(req.Message))
+	trips.OpenInvitation(invitation, trip, e.Auth, req.Role)
+	if err := e.App.Save(invitation); err != nil {
+		return err
+	}
+	if err := trips.SendInvitation(e.App, invitation, trip, e.Auth); err != nil {
+		e.App.Logger().Error("Could not send the trip invitation", "error", err, "invitationId", invitation.Id)
+		return e.JSON(http.StatusBadGateway, map[string]string{"error": "the invitation was saved but the email could not be sent"})
+	}
+
+	return e.JSON(http.StatusCreated, invitation)
+}
+
+// ListTripInvitations lists the invitations sent for the trip
+func ListTripInvitations(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	invitations, err := e.App.FindRecordsByFilter("invitations", "trip = {:tripId}", "-created", 0, 0,
+		dbx.Params{"tripId": trip.Id})
+	if err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, invitations)
+}
+
+// RevokeTripInvitation withdraws an invitation that was not answered yet.
+// Editors can only take back the ones they sent, the owner any of them.
+func RevokeTripInvitation(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	invitation, err := e.App.FindRecordById("invitations", e.Request.PathValue("invitationId"))
+	if err != nil || invitation.GetString("trip") != trip.Id {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "invitation not found"})
+	}
+	if requestTripRole(e) != trips.RoleOwner && invitation.GetString("from") != e.Auth.Id {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "only the owner can revoke invitations sent by others"})
+	}
+	if invitation.GetString("status") == bt.Accepted.String() {
+		return e.JSON(http.StatusConflict, map[string]string{"error": "the invitation was already accepted"})
+	}
+
+	if err := e.App.Delete(invitation); err != nil {
+		return err
+	}
+	return e.NoContent(http.StatusNoContent)
+}
+
+// AcceptTripInvitation accepts the invitation of the signed link from the
+// email, for the signed in user it was sent to
+func AcceptTripInvitation(e *core.RequestEvent) error {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil || req.Token == "" {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "token is required"})
+	}
+
+	invitation, err := trips.FindInvitationByToken(e.App, req.Token)
+	if err == nil {
+		err = trips.AcceptInvitation(e.App, invitation, e.Auth)
+	}
+	switch {
+	case errors.Is(err, trips.ErrInvalidInvitation):
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, trips.ErrInvitationRecipient):
+		return e.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, trips.ErrInvitationExpired), errors.Is(err, trips.ErrInvitationClosed), errors.Is(err, trips.ErrInviterNotOwner):
+		return e.JSON(http.StatusGone, map[string]string{"error": err.Error()})
+	case err != nil:
+		return err
+	}
+
+	return e.JSON(http.StatusOK, map[string]string{
+		"tripId": invitation.GetString("trip"),
+		"role":   trips.InvitationRole(invitation),
+	})
+}
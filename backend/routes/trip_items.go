@@ -0,0 +1,176 @@
+package routes
+
+import (
+	"backend/trips"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	defaultTripItemsLimit = 50
+	maxTripItemsLimit     = 200
+)
+
+// tripItemColumns are the columns each itinerary collection is filtered and
+// ordered by. Activities have no type of their own, the category an import
+// gave them stands in for it.
+type tripItemColumns struct {
+	start  string
+	end    string
+	kind   string
+	places []string
+}
+
+var tripItemCollections = map[string]tripItemColumns{
+	"transportations": {start: "departureTime", end: "arrivalTime", kind: "[[type]]", places: []string{"origin", "destination"}},
+	"lodgings":        {start: "startDate", end: "endDate", kind: "[[type]]", places: []string{"name", "address"}},
+	"activities":      {start: "startDate", end: "endDate", kind: "json_extract([[metadata]], '$.category')", places: []string{"name", "address"}},
+}
+
+// ListTripItems lists the transportations, lodgings or activities of the
+// trip in the order they happen, a page at a time, so that long trips are
+// not read whole. The page is narrowed down by:
+//   - from and to, dates or times, to the items that overlap them
+//   - type, one or more separated by commas
+//   - destination, matched against the places of the items
+//   - tag, one or more separated by commas, such as rainy-day
+//   - hasCost, true or false
+//
+// Pages hold limit items, the next one is read with the cursor returned as
+// next. Items private as a whole are only listed for the owner, the records
+// are sent the way the records API sends them.
+func ListTripItems(e *core.RequestEvent, collection string) error {
+	trip := e.Get("trip").(*core.Record)
+	role := requestTripRole(e)
+	columns := tripItemCollections[collection]
+	query := e.Request.URL.Query()
+
+	limit := defaultTripItemsLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxTripItemsLimit {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("limit must be between 1 and %d", maxTripItemsLimit)})
+		}
+		limit = parsed
+	}
+
+	start := "[[" + columns.start + "]]"
+	end := "COALESCE(NULLIF([[" + columns.end + "]], ''), " + start + ")"
+	q := e.App.RecordQuery(collection).
+		AndWhere(dbx.HashExp{"trip": trip.Id}).
+		OrderBy(columns.start+" ASC", "id ASC")
+
+	if value := query.Get("from"); value != "" {
+		from, err := parseRangeTime(value, false)
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "from must be a date or a time"})
+		}
+		q = q.AndWhere(dbx.NewExp(end+" >= {:from}", dbx.Params{"from": from.String()}))
+	}
+	if value := query.Get("to"); value != "" {
+		to, err := parseRangeTime(value, true)
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "to must be a date or a time"})
+		}
+		q = q.AndWhere(dbx.NewExp(start+" <= {:to}", dbx.Params{"to": to.String()}))
+	}
+	if value := query.Get("type"); value != "" {
+		kinds := make([]interface{}, 0)
+		for _, kind := range strings.Split(value, ",") {
+			if kind = strings.TrimSpace(kind); kind != "" {
+				kinds = append(kinds, kind)
+			}
+		}
+		q = q.AndWhere(dbx.In(columns.kind, kinds...))
+	}
+	if value := strings.TrimSpace(query.Get("destination")); value != "" {
+		matches := make([]dbx.Expression, 0, len(columns.places))
+		for _, place := range columns.places {
+			matches = append(matches, dbx.Like(place, value))
+		}
+		q = q.AndWhere(dbx.Or(matches...))
+	}
+	if value := query.Get("tag"); value != "" {
+		placeholders := make([]string, 0)
+		params := dbx.Params{}
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+				name := fmt.Sprintf("tag%d", len(placeholders))
+				placeholders = append(placeholders, "{:"+name+"}")
+				params[name] = tag
+			}
+		}
+		if len(placeholders) > 0 {
+			q = q.AndWhere(dbx.NewExp("EXISTS (SELECT 1 FROM json_each(COALESCE([[tags]], '[]')) WHERE value IN ("+strings.Join(placeholders, ", ")+"))", params))
+		}
+	}
+	if value := query.Get("hasCost"); value != "" {
+		hasCost, err := strconv.ParseBool(value)
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "hasCost must be true or false"})
+		}
+		// a private cost is no cost to the ones it is kept from
+		costed := "COALESCE(json_extract([[cost]], '$.value'), 0) > 0"
+		if !trips.SeesPrivate(role) {
+			costed += " AND NOT EXISTS (SELECT 1 FROM json_each(COALESCE(json_extract([[privacy]], '$.fields'), '[]')) WHERE value = '" + trips.PrivateCost + "')"
+		}
+		if hasCost {
+			q = q.AndWhere(dbx.NewExp(costed))
+		} else {
+			q = q.AndWhere(dbx.NewExp("NOT (" + costed + ")"))
+		}
+	}
+	if !trips.SeesPrivate(role) {
+		q = q.AndWhere(dbx.NewExp("COALESCE(json_extract([[privacy]], '$.item'), 0) = 0"))
+	}
+	if value := query.Get("cursor"); value != "" {
+		at, id, _ := strings.Cut(value, "|")
+		if id == "" {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "cursor must be the next cursor of a previous page"})
+		}
+		q = q.AndWhere(dbx.NewExp("("+start+" > {:at} OR ("+start+" = {:at} AND [[id]] > {:id}))", dbx.Params{"at": at, "id": id}))
+	}
+
+	records := make([]*core.Record, 0, limit+1)
+	if err := q.Limit(int64(limit) + 1).All(&records); err != nil {
+		return err
+	}
+	next := ""
+	if len(records) > limit {
+		records = records[:limit]
+		last := records[limit-1]
+		next = last.GetDateTime(columns.start).String() + "|" + last.Id
+	}
+
+	if err := apis.EnrichRecords(e, records); err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"items": records,
+		"next":  next,
+	})
+}
+
+// parseRangeTime reads a bound of a from/to range, a date alone as the
+// start of the day for from and its end for to
+func parseRangeTime(value string, endOfDay bool) (types.DateTime, error) {
+	if day, err := time.Parse(time.DateOnly, value); err == nil {
+		if endOfDay {
+			day = day.Add(24*time.Hour - time.Millisecond)
+		}
+		return types.ParseDateTime(day)
+	}
+	parsed, err := types.ParseDateTime(value)
+	if err != nil || parsed.IsZero() {
+		return types.DateTime{}, fmt.Errorf("invalid time %q", value)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"backend/trips"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// TripItinerary returns the transportations, lodgings and activities of the
+// trip as one chronological timeline with places, coordinates and costs
+func TripItinerary(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	return e.JSON(http.StatusOK, trips.BuildItinerary(e.App, trip, requestTripRole(e)))
+}
@@ -0,0 +1,306 @@
+package routes
+
+import (
+	"backend/notifications"
+	"backend/trips"
+	bt "backend/types"
+	"backend/validation"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type tripPollRequest struct {
+	Question     string          `json:"question"`
+	Options      []bt.PollOption `json:"options"`
+	Quorum       int             `json:"quorum"`
+	AutoSchedule bool            `json:"autoSchedule"`
+	ClosesAt     string          `json:"closesAt"`
+}
+
+// ListTripPolls lists the polls of the trip with their votes, newest first
+func ListTripPolls(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	records, err := e.App.FindRecordsByFilter("polls", "trip = {:tripId}", "-created", 0, 0, dbx.Params{"tripId": trip.Id})
+	if err != nil {
+		return err
+	}
+	polls := make([]bt.Poll, 0, len(records))
+	for _, poll := range records {
+		if _, err := trips.PollOpenForVotes(e.App, poll); err != nil {
+			return err
+		}
+		view, err := trips.PollView(e.App, poll, trip, e.Auth.Id)
+		if err != nil {
+			return err
+		}
+		polls = append(polls, view)
+	}
+	return e.JSON(http.StatusOK, polls)
+}
+
+// CreateTripPoll asks the members of the trip to vote between options
+func CreateTripPoll(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	var req tripPollRequest
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	var closesAt time.Time
+	if strings.TrimSpace(req.ClosesAt) != "" {
+		parsed, err := validation.ParseTimestamp(req.ClosesAt)
+		if err != nil || !parsed.After(time.Now()) {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "closesAt must be a date/time in the future"})
+		}
+		closesAt = parsed
+	}
+
+	poll, err := createPoll(e.App, trip, e.Auth, req, closesAt)
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	view, err := trips.PollView(e.App, poll, trip, e.Auth.Id)
+	if err != nil {
+		return err
+	}
+	return e.JSON(http.StatusCreated, view)
+}
+
+// VoteTripPoll records the vote of the member, viewers vote too. The poll
+// is decided as soon as it has its quorum.
+func VoteTripPoll(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	poll, ok := findTripPoll(e, trip)
+	if !ok {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "poll not found"})
+	}
+
+	var req struct {
+		Option string `json:"option"`
+	}
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	err := trips.CastPollVote(e.App, poll, e.Auth.Id, req.Option)
+	switch {
+	case errors.Is(err, trips.ErrUnknownPollOption):
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, trips.ErrPollClosed):
+		return e.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case err != nil:
+		return err
+	}
+
+	decided, err := trips.DecidePoll(e.App, poll, trip)
+	if err != nil {
+		return err
+	}
+	if decided {
+		notifyPollDecided(e.App, trip, poll, "")
+	}
+
+	view, err := trips.PollView(e.App, poll, trip, e.Auth.Id)
+	if err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, view)
+}
+
+// ScheduleTripPoll puts an option on the itinerary as an activity and closes
+// the poll, the leading option when none is given. A start time can be
+// given for options proposed without one.
+func ScheduleTripPoll(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	poll, ok := findTripPoll(e, trip)
+	if !ok {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "poll not found"})
+	}
+	if poll.GetString("status") == trips.PollScheduled {
+		return e.JSON(http.StatusConflict, map[string]string{"error": "the poll was already scheduled"})
+	}
+
+	var req struct {
+		Option    string `json:"option"`
+		StartTime string `json:"startTime"`
+		EndTime   string `json:"endTime"`
+		Timezone  string `json:"timezone"`
+	}
+	if e.Request.ContentLength != 0 {
+		if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		}
+	}
+
+	var option bt.PollOption
+	if req.Option != "" {
+		if option, ok = trips.FindPollOption(poll, req.Option); !ok {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": trips.ErrUnknownPollOption.Error()})
+		}
+	} else {
+		leader, leads, err := trips.PollLeader(e.App, poll, trip)
+		if err != nil {
+			return err
+		}
+		if !leads {
+			return e.JSON(http.StatusConflict, map[string]string{"error": "no option leads the poll, pick one"})
+		}
+		option = leader
+	}
+
+	if req.StartTime != "" {
+		option.StartTime, option.EndTime, option.Timezone = req.StartTime, req.EndTime, firstNonEmpty(req.Timezone, option.Timezone)
+		timed, err := trips.CheckPollOption(option)
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		option = timed
+	}
+
+	activity, err := trips.SchedulePollOption(e.App, poll, option)
+	if errors.Is(err, trips.ErrPollOptionUntimed) {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+	notifyPollDecided(e.App, trip, poll, e.Auth.Id)
+
+	return e.JSON(http.StatusOK, map[string]string{"pollId": poll.Id, "activityId": activity.Id, "winner": option.Id})
+}
+
+// CloseTripPoll stops the voting, the leading option, if any, wins
+func CloseTripPoll(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	poll, ok := findTripPoll(e, trip)
+	if !ok {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "poll not found"})
+	}
+	if poll.GetString("status") != trips.PollOpen {
+		return e.JSON(http.StatusConflict, map[string]string{"error": trips.ErrPollClosed.Error()})
+	}
+
+	leader, leads, err := trips.PollLeader(e.App, poll, trip)
+	if err != nil {
+		return err
+	}
+	if leads {
+		poll.Set("winner", leader.Id)
+	}
+	poll.Set("status", trips.PollClosed)
+	if err := e.App.Save(poll); err != nil {
+		return err
+	}
+
+	view, err := trips.PollView(e.App, poll, trip, e.Auth.Id)
+	if err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, view)
+}
+
+// DeleteTripPoll removes a poll with its votes, the one who asked and the
+// trip owner can. An activity it scheduled stays.
+func DeleteTripPoll(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	poll, ok := findTripPoll(e, trip)
+	if !ok {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "poll not found"})
+	}
+	if poll.GetString("createdBy") != e.Auth.Id && requestTripRole(e) != trips.RoleOwner {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "only the one who asked or the trip owner can delete a poll"})
+	}
+
+	if err := e.App.Delete(poll); err != nil {
+		return err
+	}
+	return e.NoContent(http.StatusNoContent)
+}
+
+func findTripPoll(e *core.RequestEvent, trip *core.Record) (*core.Record, bool) {
+	poll, err := e.App.FindRecordById("polls", e.Request.PathValue("pollId"))
+	if err != nil || poll.GetString("trip") != trip.Id {
+		return nil, false
+	}
+	return poll, true
+}
+
+// createPoll saves a new poll, the author is nil for the polls of the
+// assistant
+func createPoll(app core.App, trip *core.Record, author *core.Record, req tripPollRequest, closesAt time.Time) (*core.Record, error) {
+	question := strings.TrimSpace(req.Question)
+	if question == "" {
+		return nil, errors.New("question is required")
+	}
+	if req.Quorum < 0 {
+		return nil, errors.New("quorum cannot be negative")
+	}
+	options, err := trips.NewPollOptions(req.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := app.FindCollectionByNameOrId("polls")
+	if err != nil {
+		return nil, err
+	}
+	poll := core.NewRecord(collection)
+	poll.Set("trip", trip.Id)
+	poll.Set("question", question)
+	poll.Set("options", options)
+	poll.Set("quorum", req.Quorum)
+	poll.Set("autoSchedule", req.AutoSchedule)
+	poll.Set("status", trips.PollOpen)
+	if !closesAt.IsZero() {
+		poll.Set("closesAt", closesAt)
+	}
+	if author != nil {
+		poll.Set("createdBy", author.Id)
+	}
+	// the members are asked to vote by hooks.NotifyPollCreated once the poll
+	// is saved for good
+	if err := app.Save(poll); err != nil {
+		return nil, err
+	}
+	return poll, nil
+}
+
+// notifyPollDecided tells the members which option won
+func notifyPollDecided(app core.App, trip *core.Record, poll *core.Record, actorId string) {
+	option, ok := trips.FindPollOption(poll, poll.GetString("winner"))
+	if !ok {
+		return
+	}
+	title := fmt.Sprintf("\"%s\" won the poll: %s", option.Name, poll.GetString("question"))
+	if poll.GetString("status") == trips.PollScheduled {
+		title = fmt.Sprintf("\"%s\" won the poll and is on the itinerary", option.Name)
+	}
+	notifyPollMembers(app, trip, poll, notifications.KindPollDecided, title, actorId)
+}
+
+func notifyPollMembers(app core.App, trip *core.Record, poll *core.Record, kind string, title string, skipId string) {
+	members := append([]string{trip.GetString("ownerId")}, trip.GetStringSlice("collaborators")...)
+	sent := make([]notifications.Notification, 0, len(members))
+	for _, member := range members {
+		if member == skipId {
+			continue
+		}
+		sent = append(sent, notifications.Notification{
+			UserId: member,
+			TripId: trip.Id,
+			Kind:   kind,
+			Title:  title,
+			Link:   fmt.Sprintf("/trips/%s", trip.Id),
+			Data:   map[string]any{"pollId": poll.Id},
+		})
+	}
+	notifications.SendAll(app, sent)
+}
@@ -0,0 +1,353 @@
+package routes
+
+import (
+	"backend/trips"
+	bt "backend/types"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// presenceTimeout is how long a session stays present after its last
+	// heartbeat, clients send one about every 15 seconds
+	presenceTimeout       = 45 * time.Second
+	presenceSweepInterval = 15 * time.Second
+	presenceKeepalive     = 25 * time.Second
+	// maxPresenceSessions caps the tabs one user is shown with on a trip,
+	// the least recently seen is dropped for a new one
+	maxPresenceSessions = 8
+)
+
+var presenceSessionId = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// presenceSession is one tab of a collaborator with the trip open
+type presenceSession struct {
+	userId     string
+	sessionId  string
+	name       string
+	collection string
+	recordId   string
+	// private is set when the item being edited is private
+	private  bool
+	since    time.Time
+	lastSeen time.Time
+}
+
+// presenceSubscriber is a presence stream, it is told when the sessions of
+// its trip change and reads them again
+type presenceSubscriber struct {
+	role    string
+	changed chan struct{}
+}
+
+type tripPresence struct {
+	sessions    map[string]*presenceSession
+	subscribers map[*presenceSubscriber]bool
+}
+
+// presence holds who has each trip open on this instance. It lives in
+// memory: it is only worth anything for as long as the heartbeats keep
+// coming, and a restart is over before the clients notice.
+var presence = struct {
+	sync.Mutex
+	trips map[string]*tripPresence
+	sweep sync.Once
+}{
+	trips: make(map[string]*tripPresence),
+}
+
+type presenceHeartbeat struct {
+	SessionId  string `json:"sessionId"`
+	Collection string `json:"collection"`
+	RecordId   string `json:"recordId"`
+}
+
+// TripPresenceHeartbeat marks the user as having the trip open in the tab
+// of sessionId, editing the item of collection and recordId when they are
+// set. Sessions without a heartbeat for presenceTimeout are gone. The reply
+// lists everyone present, so an editor sees who else is on the same item.
+func TripPresenceHeartbeat(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	role := requestTripRole(e)
+
+	var req presenceHeartbeat
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if !presenceSessionId.MatchString(req.SessionId) {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "sessionId must be 1 to 64 letters, digits, - or _"})
+	}
+
+	session := &presenceSession{
+		userId:    e.Auth.Id,
+		sessionId: req.SessionId,
+		name:      e.Auth.GetString("name"),
+	}
+	if req.Collection != "" || req.RecordId != "" {
+		if !trips.CanEdit(role) {
+			return e.JSON(http.StatusForbidden, map[string]string{"error": "viewers cannot edit this trip"})
+		}
+		if !slices.Contains(trips.EventCollections, req.Collection) || req.RecordId == "" {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "collection must be one of " + strings.Join(trips.EventCollections, ", ") + " and recordId the item being edited"})
+		}
+		if req.Collection == "trips" {
+			if req.RecordId != trip.Id {
+				return e.JSON(http.StatusNotFound, map[string]string{"error": "item not found"})
+			}
+		} else {
+			record, err := ensureTripRecord(e.App, req.Collection, req.RecordId, trip.Id)
+			if err != nil {
+				return e.JSON(http.StatusNotFound, map[string]string{"error": "item not found"})
+			}
+			if slices.Contains(trips.PrivacyCollections, req.Collection) {
+				session.private = trips.ItemPrivacy(record).Item
+			}
+		}
+		session.collection, session.recordId = req.Collection, req.RecordId
+	}
+
+	sessions := updatePresence(trip.Id, session)
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"presence": presenceViews(sessions, role),
+	})
+}
+
+// LeaveTripPresence ends a session right away, for tabs that are closed
+func LeaveTripPresence(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	removePresence(trip.Id, e.Auth.Id, e.Request.PathValue("sessionId"))
+	return e.NoContent(http.StatusNoContent)
+}
+
+// TripPresenceStream sends who has the trip open as server sent events, once
+// when connected and again every time someone arrives, leaves or moves to
+// another item
+func TripPresenceStream(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	role := requestTripRole(e)
+
+	flusher, streaming := sseFlusher(e.Response)
+	if !streaming {
+		return e.JSON(http.StatusNotImplemented, map[string]string{"error": "the presence stream cannot be sent through this server"})
+	}
+
+	stream := newSSEStream(e.Response, flusher)
+	writer, flusher := http.ResponseWriter(stream), http.Flusher(stream)
+	setSSEHeaders(writer, e.Request)
+	stopHeartbeat := stream.startHeartbeat(presenceKeepalive)
+	defer stopHeartbeat()
+
+	subscriber := &presenceSubscriber{role: role, changed: make(chan struct{}, 1)}
+	sessions := subscribePresence(trip.Id, subscriber)
+	defer unsubscribePresence(trip.Id, subscriber)
+
+	for {
+		sendSSEEvent(writer, flusher, map[string]interface{}{
+			"type":     "presence",
+			"presence": presenceViews(sessions, role),
+		})
+
+		select {
+		case <-e.Request.Context().Done():
+			return nil
+		case <-subscriber.changed:
+			sessions = currentPresence(trip.Id)
+		}
+	}
+}
+
+// updatePresence records a heartbeat and returns the sessions of the trip.
+// Subscribers are only told when the session is new or moved to another
+// item, a heartbeat that changes nothing else is not news.
+func updatePresence(tripId string, session *presenceSession) []presenceSession {
+	presence.sweep.Do(func() {
+		go sweepPresence()
+	})
+
+	presence.Lock()
+	defer presence.Unlock()
+
+	now := time.Now()
+	tp := presence.trips[tripId]
+	if tp == nil {
+		tp = &tripPresence{sessions: map[string]*presenceSession{}, subscribers: map[*presenceSubscriber]bool{}}
+		presence.trips[tripId] = tp
+	}
+	expirePresence(tp, now)
+
+	key := session.userId + "/" + session.sessionId
+	existing := tp.sessions[key]
+	changed := existing == nil || existing.collection != session.collection || existing.recordId != session.recordId ||
+		existing.private != session.private || existing.name != session.name
+	session.since, session.lastSeen = now, now
+	if existing != nil && existing.collection == session.collection && existing.recordId == session.recordId {
+		session.since = existing.since
+	}
+	if existing == nil {
+		dropOldestPresence(tp, session.userId)
+	}
+	tp.sessions[key] = session
+
+	if changed {
+		notifyPresence(tp)
+	}
+	return presenceSnapshot(tp)
+}
+
+// dropOldestPresence makes room for another session of the user
+func dropOldestPresence(tp *tripPresence, userId string) {
+	var oldest string
+	count := 0
+	for key, session := range tp.sessions {
+		if session.userId != userId {
+			continue
+		}
+		count++
+		if oldest == "" || session.lastSeen.Before(tp.sessions[oldest].lastSeen) {
+			oldest = key
+		}
+	}
+	if count >= maxPresenceSessions {
+		delete(tp.sessions, oldest)
+	}
+}
+
+func removePresence(tripId string, userId string, sessionId string) {
+	presence.Lock()
+	defer presence.Unlock()
+
+	tp := presence.trips[tripId]
+	if tp == nil {
+		return
+	}
+	key := userId + "/" + sessionId
+	if _, ok := tp.sessions[key]; !ok {
+		return
+	}
+	delete(tp.sessions, key)
+	notifyPresence(tp)
+	forgetIdleTrip(tripId, tp)
+}
+
+func subscribePresence(tripId string, subscriber *presenceSubscriber) []presenceSession {
+	presence.Lock()
+	defer presence.Unlock()
+
+	tp := presence.trips[tripId]
+	if tp == nil {
+		tp = &tripPresence{sessions: map[string]*presenceSession{}, subscribers: map[*presenceSubscriber]bool{}}
+		presence.trips[tripId] = tp
+	}
+	tp.subscribers[subscriber] = true
+	return presenceSnapshot(tp)
+}
+
+func unsubscribePresence(tripId string, subscriber *presenceSubscriber) {
+	presence.Lock()
+	defer presence.Unlock()
+
+	if tp := presence.trips[tripId]; tp != nil {
+		delete(tp.subscribers, subscriber)
+		forgetIdleTrip(tripId, tp)
+	}
+}
+
+func currentPresence(tripId string) []presenceSession {
+	presence.Lock()
+	defer presence.Unlock()
+
+	if tp := presence.trips[tripId]; tp != nil {
+		return presenceSnapshot(tp)
+	}
+	return nil
+}
+
+// sweepPresence expires the sessions that stopped sending heartbeats, so
+// streams hear about tabs that were closed without saying goodbye
+func sweepPresence() {
+	ticker := time.NewTicker(presenceSweepInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		presence.Lock()
+		for tripId, tp := range presence.trips {
+			if expirePresence(tp, now) {
+				notifyPresence(tp)
+			}
+			forgetIdleTrip(tripId, tp)
+		}
+		presence.Unlock()
+	}
+}
+
+// expirePresence drops the sessions not seen within presenceTimeout and
+// tells whether there were any
+func expirePresence(tp *tripPresence, now time.Time) bool {
+	expired := false
+	for key, session := range tp.sessions {
+		if now.Sub(session.lastSeen) > presenceTimeout {
+			delete(tp.sessions, key)
+			expired = true
+		}
+	}
+	return expired
+}
+
+func forgetIdleTrip(tripId string, tp *tripPresence) {
+	if len(tp.sessions) == 0 && len(tp.subscribers) == 0 {
+		delete(presence.trips, tripId)
+	}
+}
+
+// notifyPresence wakes the streams of the trip. A stream that has not
+// caught up with the last change reads the sessions once for both.
+func notifyPresence(tp *tripPresence) {
+	for subscriber := range tp.subscribers {
+		select {
+		case subscriber.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func presenceSnapshot(tp *tripPresence) []presenceSession {
+	sessions := make([]presenceSession, 0, len(tp.sessions))
+	for _, session := range tp.sessions {
+		sessions = append(sessions, *session)
+	}
+	return sessions
+}
+
+// presenceViews shows the sessions as the role may see them: the item is
+// left out when the role may not see it, the collaborator is still shown
+func presenceViews(sessions []presenceSession, role string) []bt.Presence {
+	views := make([]bt.Presence, 0, len(sessions))
+	for _, session := range sessions {
+		view := bt.Presence{
+			User:     bt.FeedActor{Type: "user", Id: session.userId, Name: session.name},
+			Since:    session.since.UTC().Format(time.RFC3339),
+			LastSeen: session.lastSeen.UTC().Format(time.RFC3339),
+		}
+		if session.recordId != "" && trips.ItemVisible(session.collection, session.private, role) {
+			view.Collection, view.RecordId = session.collection, session.recordId
+		}
+		views = append(views, view)
+	}
+	slices.SortFunc(views, func(a, b bt.Presence) int {
+		if c := strings.Compare(a.User.Name, b.User.Name); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.User.Id, b.User.Id); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Since, b.Since)
+	})
+	return views
+}
@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"backend/trips"
+	bt "backend/types"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const reportNarrativePrompt = "Write a short, warm story of this finished trip for the travelers to keep, in two or three paragraphs of plain text. Use only the facts in the report, mention how the spending compared to the budget and any skipped activities without judging, and do not invent places or events."
+
+// TripReport returns the post-trip report stored on the trip, creating it
+// the first time it is asked for after the trip ended
+func TripReport(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	report, err := loadOrBuildTripReport(e.App, trip)
+	if errors.Is(err, trips.ErrTripNotEnded) {
+		return e.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, report)
+}
+
+// RegenerateTripReport rebuilds the report from the current records and,
+// when asked to, adds a narrative written by the assistant
+func RegenerateTripReport(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	if !trips.CanEdit(requestTripRole(e)) {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "viewers cannot change the trip report"})
+	}
+
+	var req struct {
+		Narrative bool `json:"narrative"`
+	}
+	if e.Request.ContentLength != 0 {
+		if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		}
+	}
+
+	report, err := trips.BuildTripReport(e.App, trip)
+	if errors.Is(err, trips.ErrTripNotEnded) {
+		return e.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+
+	if req.Narrative {
+		narrative, err := writeReportNarrative(e, report)
+		if err != nil {
+			e.App.Logger().Error("Trip report narrative failed", "error", err, "tripId", trip.Id)
+			return e.JSON(http.StatusBadGateway, map[string]string{
+				"error": fmt.Sprintf("assistant request failed: %s", err.Error()),
+			})
+		}
+		report.Narrative = narrative
+	}
+
+	if err := trips.SaveTripReport(e.App, trip, report); err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, report)
+}
+
+func ExportTripReportPDF(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	report, err := loadOrBuildTripReport(e.App, trip)
+	if errors.Is(err, trips.ErrTripNotEnded) {
+		return e.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+
+	var pdf bytes.Buffer
+	if err := trips.WriteTripReportPDF(report, &pdf); err != nil {
+		return err
+	}
+
+	e.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-report.pdf\"", trip.Id))
+	return e.Blob(http.StatusOK, "application/pdf", pdf.Bytes())
+}
+
+func loadOrBuildTripReport(app core.App, trip *core.Record) (*bt.TripReport, error) {
+	var stored bt.TripReport
+	if err := trip.UnmarshalJSONField("report", &stored); err == nil && stored.TripId != "" {
+		return &stored, nil
+	}
+
+	report, err := trips.BuildTripReport(app, trip)
+	if err != nil {
+		return nil, err
+	}
+	if err := trips.SaveTripReport(app, trip, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func writeReportNarrative(e *core.RequestEvent, report *bt.TripReport) (string, error) {
+	apiKey := strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
+	if apiKey == "" {
+		return "", errors.New("OPENAI_API_KEY is not configured on the server")
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	// the narrative only needs the report, so no tool is offered
+	config := loadAssistantConfig(e.App)
+	config.DisabledTools = map[string]bool{}
+	for _, tool := range buildAssistantTools(assistantConfig{}) {
+		config.DisabledTools[assistantToolName(tool)] = true
+	}
+
+	input := []map[string]interface{}{
+		newResponsesTextBlock("developer", reportNarrativePrompt+" "+loadAssistantLocale(e.Auth).promptInstructions()),
+		newResponsesTextBlock("developer", fmt.Sprintf("Trip report:\n%s", string(data))),
+	}
+
+	reply, err := invokeResponsesAPI(e.Request.Context(), apiKey, input, config, "medium", nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(reply.Text), nil
+}
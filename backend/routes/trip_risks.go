@@ -0,0 +1,126 @@
+package routes
+
+import (
+	"backend/tripcontext"
+	"backend/trips"
+	bt "backend/types"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// The risk dashboard gathers what may go wrong on a trip into one list, most
+// severe first. Travel advisories are not fetched from anywhere, the admin
+// keeps their levels in the travel_advisories setting.
+
+const assistantToolGetTripRisks = "get_trip_risks"
+
+func assistantRiskTools() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"type":        "function",
+			"name":        assistantToolGetTripRisks,
+			"description": "List what may go wrong on the trip, most severe first: tight connections, rain on outdoor plans, travel advisories, documents that expire too early and free cancellation or booking deadlines coming up. Call it when the traveler asks what could go wrong or wants to review the risks, then walk them through the list one risk at a time.",
+			"parameters": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
+	}
+}
+
+// tripRisks lists the risks of the trip with the records the context holds
+func tripRisks(app core.App, ctx *tripcontext.Context) []tripcontext.Risk {
+	return tripcontext.Risks(ctx, weatherProvider(), loadTravelAdvisories(app), time.Now().UTC())
+}
+
+// answerTripRisks runs a get_trip_risks call and returns the output for the
+// model
+func answerTripRisks(app core.App, ctx *tripcontext.Context) string {
+	if app == nil || ctx == nil {
+		return `{"risks":[]}`
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"risks":   tripRisks(app, ctx),
+		"message": "Walk the traveler through these risks, most severe first, and offer to fix the ones you can with the matching function.",
+	})
+	if err != nil {
+		return `{"risks":[]}`
+	}
+	return string(data)
+}
+
+// TripRisks lists the risks of the trip. Viewers who do not see private
+// plans do not see their risks either.
+func TripRisks(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	ctx, err := tripcontext.Build(e.App, trip, trips.SeesPrivate(requestTripRole(e)))
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{"risks": tripRisks(e.App, ctx)})
+}
+
+// loadTravelAdvisories reads the advisories keyed by lower case country
+func loadTravelAdvisories(app core.App) map[string]bt.TravelAdvisory {
+	advisories := map[string]bt.TravelAdvisory{}
+	record, err := app.FindRecordById("surmai_settings", "travel_advisories")
+	if err != nil {
+		return advisories
+	}
+	var value struct {
+		Countries map[string]bt.TravelAdvisory `json:"countries"`
+	}
+	_ = json.Unmarshal([]byte(record.GetString("value")), &value)
+	for country, advisory := range value.Countries {
+		advisories[strings.ToLower(strings.TrimSpace(country))] = advisory
+	}
+	return advisories
+}
+
+func GetTravelAdvisories(e *core.RequestEvent) error {
+	return e.JSON(http.StatusOK, map[string]interface{}{"countries": loadTravelAdvisories(e.App)})
+}
+
+// UpdateTravelAdvisories replaces the advisories, countries left out have
+// none
+func UpdateTravelAdvisories(e *core.RequestEvent) error {
+	var body struct {
+		Countries map[string]bt.TravelAdvisory `json:"countries"`
+	}
+	if err := json.NewDecoder(e.Request.Body).Decode(&body); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid travel advisories"})
+	}
+	for country, advisory := range body.Countries {
+		if strings.TrimSpace(country) == "" || advisory.Level < 1 || advisory.Level > 4 {
+			return e.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("the advisory for %q needs a level from 1 to 4", country),
+			})
+		}
+	}
+	if body.Countries == nil {
+		body.Countries = map[string]bt.TravelAdvisory{}
+	}
+
+	collection, err := e.App.FindCollectionByNameOrId("surmai_settings")
+	if err != nil {
+		return err
+	}
+	record, err := e.App.FindRecordById("surmai_settings", "travel_advisories")
+	if err != nil {
+		record = core.NewRecord(collection)
+		record.Set("id", "travel_advisories")
+	}
+	record.Set("value", body)
+	if err := e.App.Save(record); err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{"countries": body.Countries})
+}
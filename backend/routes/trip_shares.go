@@ -0,0 +1,148 @@
+package routes
+
+import (
+	"backend/trips"
+	bt "backend/types"
+	"backend/validation"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// the header a password protected share link is opened with
+const sharePasswordHeader = "X-Share-Password"
+
+type tripShareRequest struct {
+	Name                  string `json:"name"`
+	Password              string `json:"password"`
+	HideCosts             *bool  `json:"hideCosts"`
+	HideConfirmationCodes *bool  `json:"hideConfirmationCodes"`
+	ExpiresOn             string `json:"expiresOn"`
+}
+
+// CreateTripShare makes a public read-only link to the itinerary of the
+// trip. Costs and confirmation codes are hidden unless asked for.
+func CreateTripShare(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	var req tripShareRequest
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if len(req.Password) > 71 {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "password must be at most 71 characters"})
+	}
+
+	collection, err := e.App.FindCollectionByNameOrId("trip_shares")
+	if err != nil {
+		return err
+	}
+	share := core.NewRecord(collection)
+	share.Set("trip", trip.Id)
+	share.Set("createdBy", e.Auth.Id)
+	share.Set("name", strings.TrimSpace(req.Name))
+	share.Set("token", security.RandomString(32))
+	share.Set("hideCosts", req.HideCosts == nil || *req.HideCosts)
+	share.Set("hideConfirmationCodes", req.HideConfirmationCodes == nil || *req.HideConfirmationCodes)
+	if req.Password != "" {
+		share.Set("password", req.Password)
+	}
+	if strings.TrimSpace(req.ExpiresOn) != "" {
+		expiresOn, err := validation.ParseTimestamp(req.ExpiresOn)
+		if err != nil || !expiresOn.After(time.Now()) {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "expiresOn must be a date/time in the future"})
+		}
+		share.Set("expiresOn", expiresOn)
+	}
+
+	if err := e.App.Save(share); err != nil {
+		return err
+	}
+	return e.JSON(http.StatusCreated, trips.ShareSummary(e.App, share))
+}
+
+// ListTripShares lists the share links of the trip
+func ListTripShares(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	records, err := e.App.FindRecordsByFilter("trip_shares", "trip = {:tripId}", "-created", 0, 0,
+		dbx.Params{"tripId": trip.Id})
+	if err != nil {
+		return err
+	}
+	shares := make([]bt.TripShare, 0, len(records))
+	for _, share := range records {
+		shares = append(shares, trips.ShareSummary(e.App, share))
+	}
+	return e.JSON(http.StatusOK, shares)
+}
+
+// RevokeTripShare removes a share link, it stops working right away.
+// Editors can only revoke the links they made, the owner any of them.
+func RevokeTripShare(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	share, err := e.App.FindRecordById("trip_shares", e.Request.PathValue("shareId"))
+	if err != nil || share.GetString("trip") != trip.Id {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "share link not found"})
+	}
+	if requestTripRole(e) != trips.RoleOwner && share.GetString("createdBy") != e.Auth.Id {
+		return e.JSON(http.StatusForbidden, map[string]string{"error": "only the owner can revoke links made by others"})
+	}
+
+	if err := e.App.Delete(share); err != nil {
+		return err
+	}
+	return e.NoContent(http.StatusNoContent)
+}
+
+// ViewTripShare shows the itinerary of a share link to anyone who has it,
+// links with a password need it in the X-Share-Password header. Too many
+// wrong passwords for the link or from the address lock it out for a while.
+func ViewTripShare(e *core.RequestEvent) error {
+	token := e.Request.PathValue("token")
+	share, err := trips.FindShare(e.App, token)
+	switch {
+	case errors.Is(err, trips.ErrShareNotFound):
+		return e.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, trips.ErrShareExpired):
+		return e.JSON(http.StatusGone, map[string]string{"error": err.Error()})
+	case err != nil:
+		return err
+	}
+
+	if trips.ShareHasPassword(share) {
+		if locked, retryAfter := sharePasswordLocked(token, e.RealIP()); locked {
+			e.Response.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			return e.JSON(http.StatusTooManyRequests, map[string]string{"error": "too many wrong passwords, try again later"})
+		}
+		if !share.ValidatePassword(e.Request.Header.Get(sharePasswordHeader)) {
+			// opening the link without a password only asks for one
+			if e.Request.Header.Get(sharePasswordHeader) != "" {
+				recordSharePasswordFailure(token, e.RealIP())
+			}
+			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "this share link needs a password", "passwordRequired": true})
+		}
+		clearSharePasswordFailures(token)
+	}
+
+	itinerary, err := trips.ShareItinerary(e.App, share)
+	if errors.Is(err, trips.ErrShareNotFound) {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return err
+	}
+	trips.RecordShareView(e.App, share)
+
+	e.Response.Header().Set("Cache-Control", "no-store")
+	e.Response.Header().Set("X-Robots-Tag", "noindex")
+	return e.JSON(http.StatusOK, itinerary)
+}
@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"backend/trips"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type renameTagRequest struct {
+	Name string `json:"name"`
+}
+
+// ListTripTags lists the tags of the trip and its items with how many of
+// them carry each, for suggesting tags and filtering by them. Tags are set
+// on the records themselves, through the records API.
+func ListTripTags(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	tags, err := trips.TripTags(e.App, trip, requestTripRole(e))
+	if err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, map[string]interface{}{"tags": tags})
+}
+
+// RenameTripTag renames a tag on the trip and every item the user sees
+func RenameTripTag(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	tag := strings.ToLower(strings.TrimSpace(e.Request.PathValue("tag")))
+
+	var req renameTagRequest
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	cleaned, problems := trips.CleanTags([]string{req.Name})
+	if len(problems) > 0 {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": strings.Join(problems, "; ")})
+	}
+	if len(cleaned) == 0 {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "name is required"})
+	}
+
+	changed, err := trips.ReplaceTag(e.App, trip, requestTripRole(e), tag, cleaned[0])
+	if err != nil {
+		return err
+	}
+	if changed == 0 {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "no record has this tag"})
+	}
+	return e.JSON(http.StatusOK, map[string]interface{}{"tag": cleaned[0], "changed": changed})
+}
+
+// DeleteTripTag removes a tag from the trip and every item the user sees
+func DeleteTripTag(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+	tag := strings.ToLower(strings.TrimSpace(e.Request.PathValue("tag")))
+
+	changed, err := trips.ReplaceTag(e.App, trip, requestTripRole(e), tag, "")
+	if err != nil {
+		return err
+	}
+	if changed == 0 {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "no record has this tag"})
+	}
+	return e.JSON(http.StatusOK, map[string]interface{}{"changed": changed})
+}
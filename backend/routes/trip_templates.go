@@ -0,0 +1,88 @@
+package routes
+
+import (
+	"backend/trips"
+	ji "backend/trips/import/json"
+	bt "backend/types"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// SaveTripTemplate keeps the trip as a template of the user, with its plans
+// counted in days from the first day so it can be planned again later
+func SaveTripTemplate(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if e.Request.ContentLength != 0 {
+		if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		}
+	}
+
+	template := trips.BuildTripTemplate(e.App, trip, requestTripRole(e))
+	if name := strings.TrimSpace(req.Name); name != "" {
+		template.Name = name
+	}
+
+	collection, err := e.App.FindCollectionByNameOrId("trip_templates")
+	if err != nil {
+		return err
+	}
+	record := core.NewRecord(collection)
+	record.Set("name", template.Name)
+	record.Set("ownerId", e.Auth.Id)
+	record.Set("sourceTrip", trip.Id)
+	record.Set("days", template.Days)
+	record.Set("template", template)
+	if err := e.App.Save(record); err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusCreated, record)
+}
+
+// CreateTripFromTemplate starts a new trip of the user from one of their
+// templates, its first day being the startDate of the request
+func CreateTripFromTemplate(e *core.RequestEvent) error {
+	record, err := e.App.FindRecordById("trip_templates", e.Request.PathValue("templateId"))
+	if err != nil || record.GetString("ownerId") != e.Auth.Id {
+		return e.JSON(http.StatusNotFound, map[string]string{"error": "template not found"})
+	}
+
+	var req struct {
+		Name      string `json:"name"`
+		StartDate string `json:"startDate"`
+	}
+	if err := json.NewDecoder(e.Request.Body).Decode(&req); err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "invalid body"})
+	}
+	start, err := time.Parse(time.DateOnly, strings.TrimSpace(req.StartDate))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, map[string]string{"error": "startDate must be a date like 2006-01-02"})
+	}
+
+	var template bt.TripTemplate
+	if err := record.UnmarshalJSONField("template", &template); err != nil {
+		return err
+	}
+
+	data := trips.InstantiateTripTemplate(&template, strings.TrimSpace(req.Name), start)
+	var tripId string
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		var importErr error
+		tripId, importErr = ji.ImportExportedTrip(txApp, data, e.Auth.Id)
+		return importErr
+	})
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusCreated, map[string]any{"tripId": tripId})
+}
@@ -0,0 +1,47 @@
+package routes
+
+import (
+	"backend/tripcontext"
+	"backend/trips"
+	"backend/weather"
+	"backend/weather/openmeteo"
+	"net/http"
+	"os"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// weatherProvider returns the forecast provider, or nil when the deployment
+// turned weather off with SURMAI_WEATHER_PROVIDER=none
+func weatherProvider() weather.DataProvider {
+	if os.Getenv("SURMAI_WEATHER_PROVIDER") == "none" {
+		return nil
+	}
+	return openmeteo.OpenMeteo{}
+}
+
+// TripWeather returns the forecast of each day of the trip at the lodging of
+// the night, or at the destinations, for the days the provider forecasts
+func TripWeather(e *core.RequestEvent) error {
+	trip := e.Get("trip").(*core.Record)
+
+	provider := weatherProvider()
+	if provider == nil {
+		return e.JSON(http.StatusServiceUnavailable, map[string]string{"error": "weather forecasts are turned off"})
+	}
+
+	ctx, err := tripcontext.Build(e.App, trip, trips.SeesPrivate(requestTripRole(e)))
+	if err != nil {
+		return err
+	}
+	days, err := tripcontext.Forecast(ctx, provider)
+	if err != nil {
+		e.App.Logger().Warn("Could not get the weather forecast", "error", err, "tripId", trip.Id)
+		return e.JSON(http.StatusBadGateway, map[string]string{"error": "the weather forecast is not available"})
+	}
+	if days == nil {
+		days = make([]tripcontext.DayWeather, 0)
+	}
+
+	return e.JSON(http.StatusOK, map[string]interface{}{"days": days})
+}
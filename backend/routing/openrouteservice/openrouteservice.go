@@ -0,0 +1,105 @@
+package openrouteservice
+
+import (
+	"backend/cache"
+	"backend/routing"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const DefaultURL = "https://api.openrouteservice.org"
+
+var profiles = map[string]string{
+	routing.ModeDriving: "driving-car",
+	routing.ModeWalking: "foot-walking",
+	routing.ModeCycling: "cycling-regular",
+}
+
+type response struct {
+	Routes []struct {
+		Segments []struct {
+			Distance float64 `json:"distance"`
+			Duration float64 `json:"duration"`
+		} `json:"segments"`
+	} `json:"routes"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// OpenRouteService needs an api key on its public server, a self-hosted one
+// is used without
+type OpenRouteService struct {
+	URL    string
+	ApiKey string
+}
+
+func (o OpenRouteService) Route(mode string, points []routing.Point) ([]routing.Leg, error) {
+	profile, ok := profiles[mode]
+	if !ok {
+		return nil, fmt.Errorf("openrouteservice does not route %s", mode)
+	}
+	baseURL := strings.TrimRight(o.URL, "/")
+	if baseURL == "" {
+		if o.ApiKey == "" {
+			return nil, errors.New("the OpenRouteService api key is not configured")
+		}
+		baseURL = DefaultURL
+	}
+
+	cacheKey := routing.CacheKey("openrouteservice", mode, points)
+	if val, found := cache.Get(cacheKey); found {
+		return val.([]routing.Leg), nil
+	}
+
+	coordinates := make([][]float64, 0, len(points))
+	for _, point := range points {
+		coordinates = append(coordinates, []float64{point.Longitude, point.Latitude})
+	}
+	body, err := json.Marshal(map[string]interface{}{"coordinates": coordinates})
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 20 * time.Second}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/v2/directions/%s/json", baseURL, profile), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.ApiKey != "" {
+		req.Header.Set("Authorization", o.ApiKey)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var data response
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("openrouteservice returned %s", resp.Status)
+	}
+	if data.Error != nil {
+		return nil, fmt.Errorf("openrouteservice could not route: %s", data.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK || len(data.Routes) == 0 {
+		return nil, fmt.Errorf("openrouteservice returned %s", resp.Status)
+	}
+
+	legs := make([]routing.Leg, 0, len(data.Routes[0].Segments))
+	for _, segment := range data.Routes[0].Segments {
+		legs = append(legs, routing.Leg{
+			DistanceKm: segment.Distance / 1000,
+			Duration:   time.Duration(segment.Duration * float64(time.Second)),
+		})
+	}
+
+	cache.Set(cacheKey, legs, 24*time.Hour)
+	return legs, nil
+}
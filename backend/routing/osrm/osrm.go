@@ -0,0 +1,88 @@
+package osrm
+
+import (
+	"backend/cache"
+	"backend/routing"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultURL is the demo server of the project, it only routes cars.
+// Deployments wanting walking and cycling run their own.
+const DefaultURL = "https://router.project-osrm.org"
+
+var profiles = map[string]string{
+	routing.ModeDriving: "driving",
+	routing.ModeWalking: "foot",
+	routing.ModeCycling: "bike",
+}
+
+type response struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Routes  []struct {
+		Legs []struct {
+			Distance float64 `json:"distance"`
+			Duration float64 `json:"duration"`
+		} `json:"legs"`
+	} `json:"routes"`
+}
+
+type OSRM struct {
+	URL string
+}
+
+func (o OSRM) Route(mode string, points []routing.Point) ([]routing.Leg, error) {
+	profile, ok := profiles[mode]
+	if !ok {
+		return nil, fmt.Errorf("osrm does not route %s", mode)
+	}
+
+	cacheKey := routing.CacheKey("osrm", mode, points)
+	if val, found := cache.Get(cacheKey); found {
+		return val.([]routing.Leg), nil
+	}
+
+	coordinates := make([]string, 0, len(points))
+	for _, point := range points {
+		coordinates = append(coordinates, fmt.Sprintf("%.6f,%.6f", point.Longitude, point.Latitude))
+	}
+	baseURL := strings.TrimRight(o.URL, "/")
+	if baseURL == "" {
+		baseURL = DefaultURL
+	}
+
+	client := &http.Client{Timeout: 20 * time.Second}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/route/v1/%s/%s?overview=false", baseURL, profile, strings.Join(coordinates, ";")), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "surmai")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var data response
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("osrm returned %s", resp.Status)
+	}
+	if data.Code != "Ok" || len(data.Routes) == 0 {
+		return nil, fmt.Errorf("osrm could not route: %s %s", data.Code, data.Message)
+	}
+
+	legs := make([]routing.Leg, 0, len(data.Routes[0].Legs))
+	for _, leg := range data.Routes[0].Legs {
+		legs = append(legs, routing.Leg{
+			DistanceKm: leg.Distance / 1000,
+			Duration:   time.Duration(leg.Duration * float64(time.Second)),
+		})
+	}
+
+	cache.Set(cacheKey, legs, 24*time.Hour)
+	return legs, nil
+}
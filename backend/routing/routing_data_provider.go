@@ -0,0 +1,100 @@
+package routing
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Modes of travel between two places
+const (
+	ModeDriving = "driving"
+	ModeWalking = "walking"
+	ModeCycling = "cycling"
+	ModeTransit = "transit"
+)
+
+var Modes = []string{ModeDriving, ModeWalking, ModeCycling, ModeTransit}
+
+// Point is a place on the way
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Leg is the way from one point to the next
+type Leg struct {
+	DistanceKm float64       `json:"distanceKm"`
+	Duration   time.Duration `json:"-"`
+	// Estimated is set when the duration was not routed in that mode, such
+	// as public transit guessed from the roads
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+type DataProvider interface {
+	// Route returns the legs between each point and the next one in the
+	// mode, driving, walking or cycling
+	Route(mode string, points []Point) ([]Leg, error)
+}
+
+// providers route at most this many points at once
+const maxWaypoints = 25
+
+// public transit is not routed by the open providers, it is guessed from the
+// driving time with a wait for the first vehicle
+const (
+	transitSlowdown = 1.6
+	transitWait     = 10 * time.Minute
+)
+
+// Legs routes the points in the mode, in chunks the providers accept
+func Legs(provider DataProvider, mode string, points []Point) ([]Leg, error) {
+	if len(points) < 2 {
+		return nil, nil
+	}
+	routed := mode
+	if mode == ModeTransit {
+		routed = ModeDriving
+	}
+
+	legs := make([]Leg, 0, len(points)-1)
+	for start := 0; start < len(points)-1; start += maxWaypoints - 1 {
+		chunk := points[start:min(start+maxWaypoints, len(points))]
+		found, err := provider.Route(routed, chunk)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) != len(chunk)-1 {
+			return nil, fmt.Errorf("the route has %d legs instead of %d", len(found), len(chunk)-1)
+		}
+		legs = append(legs, found...)
+	}
+
+	if mode == ModeTransit {
+		for i := range legs {
+			legs[i].Duration = time.Duration(float64(legs[i].Duration)*transitSlowdown) + transitWait
+			legs[i].Estimated = true
+		}
+	}
+	return legs, nil
+}
+
+// IsMode reports whether the mode is one the providers know
+func IsMode(mode string) bool {
+	for _, known := range Modes {
+		if known == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheKey identifies a route for the caches of the providers
+func CacheKey(provider string, mode string, points []Point) string {
+	var key strings.Builder
+	key.WriteString(provider + "-" + mode)
+	for _, point := range points {
+		fmt.Fprintf(&key, "-%.5f,%.5f", point.Latitude, point.Longitude)
+	}
+	return key.String()
+}
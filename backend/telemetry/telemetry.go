@@ -0,0 +1,124 @@
+package telemetry
+
+import (
+	bt "backend/types"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Settings is the value of the telemetry record in surmai_settings
+type Settings struct {
+	Enabled    bool   `json:"enabled"`
+	InstanceId string `json:"instanceId"`
+	LastSentAt string `json:"lastSentAt,omitempty"`
+}
+
+// Payload is everything that is reported. Counts are rounded into ranges and
+// nothing about trips, users or places is included.
+type Payload struct {
+	InstanceId string          `json:"instanceId"`
+	Version    string          `json:"version"`
+	Trips      string          `json:"trips"`
+	Users      string          `json:"users"`
+	Features   map[string]bool `json:"features"`
+}
+
+const sendTimeout = 10 * time.Second
+
+// Endpoint is where reports are sent, telemetry stays off while it is unset
+func Endpoint() string {
+	return strings.TrimSpace(os.Getenv("SURMAI_TELEMETRY_ENDPOINT"))
+}
+
+func LoadSettings(app core.App) (*core.Record, Settings, error) {
+	var settings Settings
+	record, err := app.FindRecordById("surmai_settings", "telemetry")
+	if err != nil {
+		return nil, settings, err
+	}
+	err = json.Unmarshal([]byte(record.GetString("value")), &settings)
+	return record, settings, err
+}
+
+func SaveSettings(app core.App, record *core.Record, settings Settings) error {
+	record.Set("value", settings)
+	return app.Save(record)
+}
+
+func BuildPayload(app core.App, settings Settings, version bt.VersionInfo) Payload {
+	trips, _ := app.CountRecords("trips")
+	users, _ := app.CountRecords("users")
+
+	flightInfo := false
+	if record, err := app.FindRecordById("surmai_settings", "flight_info_provider"); err == nil {
+		var value struct {
+			Enabled bool `json:"enabled"`
+		}
+		_ = json.Unmarshal([]byte(record.GetString("value")), &value)
+		flightInfo = value.Enabled
+	}
+
+	return Payload{
+		InstanceId: settings.InstanceId,
+		Version:    version.Tag,
+		Trips:      bucket(trips),
+		Users:      bucket(users),
+		Features: map[string]bool{
+			"assistant":        strings.TrimSpace(os.Getenv("OPENAI_API_KEY")) != "",
+			"email":            app.Settings().SMTP.Enabled,
+			"flightInfo":       flightInfo,
+			"weatherReshuffle": os.Getenv("SURMAI_WEATHER_PROVIDER") != "none",
+		},
+	}
+}
+
+// bucket hides exact counts
+func bucket(count int64) string {
+	switch {
+	case count == 0:
+		return "0"
+	case count <= 10:
+		return "1-10"
+	case count <= 100:
+		return "11-100"
+	case count <= 1000:
+		return "101-1000"
+	default:
+		return "1000+"
+	}
+}
+
+func Send(ctx context.Context, endpoint string, payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("telemetry endpoint responded with %s", resp.Status)
+	}
+	return nil
+}
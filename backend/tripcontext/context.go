@@ -0,0 +1,685 @@
+package tripcontext
+
+import (
+	"backend/currency"
+	"backend/entry"
+	"backend/trips"
+	bt "backend/types"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"golang.org/x/sync/errgroup"
+)
+
+// Context is the canonical, read-only view of a trip shared by the assistant
+// and anything else that needs to describe a trip outside the UI. Times are
+// the local wall-clock time of the place, see FormatDate.
+type Context struct {
+	Trip            Trip             `json:"trip"`
+	Notes           string           `json:"notes,omitempty"`
+	Destinations    []Destination    `json:"destinations,omitempty"`
+	Participants    []Participant    `json:"participants,omitempty"`
+	Budget          *Cost            `json:"budget,omitempty"`
+	Transportations []Transportation `json:"transportations,omitempty"`
+	Lodgings        []Lodging        `json:"lodgings,omitempty"`
+	Activities      []Activity       `json:"activities,omitempty"`
+	Expenses        []Expense        `json:"expenses,omitempty"`
+	Rentals         []Rental         `json:"rentals,omitempty"`
+	CarRentals      []CarRental      `json:"carRentals,omitempty"`
+	Dining          []Dining         `json:"dining,omitempty"`
+	Tickets         []Ticket         `json:"tickets,omitempty"`
+	Documents       []Document       `json:"documents,omitempty"`
+	// Weather is only filled in when the assistant is set up to see it
+	Weather []DayWeather `json:"weather,omitempty"`
+	// EntryRequirements are filled in by the caller, see entry.ForTrip
+	EntryRequirements []entry.Summary `json:"entryRequirements,omitempty"`
+	Hints             []string        `json:"hints,omitempty"`
+	// RecentChanges are filled in by the caller from the trip_events log
+	RecentChanges  []string `json:"recentChanges,omitempty"`
+	OmittedRecords int      `json:"omittedRecords,omitempty"`
+	GeneratedAt    string   `json:"generatedAt"`
+	// Stats is rendered separately, see Stats.Header
+	Stats *Stats `json:"-"`
+	// Passages are the notes, descriptions and document texts in full, they
+	// are searched by the assistant, see SearchPassages
+	Passages []Passage `json:"-"`
+}
+
+type Trip struct {
+	Id          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	StartDate   string   `json:"startDate"`
+	EndDate     string   `json:"endDate"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+type Destination struct {
+	Name        string `json:"name"`
+	Country     string `json:"country,omitempty"`
+	State       string `json:"state,omitempty"`
+	Timezone    string `json:"timezone,omitempty"`
+	Latitude    string `json:"latitude,omitempty"`
+	Longitude   string `json:"longitude,omitempty"`
+	Category    string `json:"category,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type Participant struct {
+	Name        string `json:"name"`
+	Email       string `json:"email,omitempty"`
+	Nationality string `json:"nationality,omitempty"`
+}
+
+type Cost struct {
+	Value    float64 `json:"value"`
+	Currency string  `json:"currency"`
+}
+
+type Transportation struct {
+	Id           string                 `json:"id"`
+	Type         string                 `json:"type"`
+	Origin       string                 `json:"origin"`
+	Destination  string                 `json:"destination"`
+	Departure    string                 `json:"departure"`
+	Arrival      string                 `json:"arrival,omitempty"`
+	Confirmation string                 `json:"confirmation,omitempty"`
+	Cost         *Cost                  `json:"cost,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	Notes        string                 `json:"notes,omitempty"`
+	Seats        []Seat                 `json:"seats,omitempty"`
+	Tags         []string               `json:"tags,omitempty"`
+	Updated      string                 `json:"updated,omitempty"`
+}
+
+type Seat struct {
+	Participant string `json:"participant"`
+	Seat        string `json:"seat"`
+	Coach       string `json:"coach,omitempty"`
+	Kind        string `json:"kind,omitempty"`
+}
+
+type Lodging struct {
+	Id            string                 `json:"id"`
+	Type          string                 `json:"type"`
+	Name          string                 `json:"name"`
+	Address       string                 `json:"address,omitempty"`
+	CheckIn       string                 `json:"checkIn"`
+	CheckOut      string                 `json:"checkOut"`
+	Confirmation  string                 `json:"confirmation,omitempty"`
+	Cost          *Cost                  `json:"cost,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	ReservationBy string                 `json:"reservationBy,omitempty"`
+	Rooms         []Room                 `json:"rooms,omitempty"`
+	Tags          []string               `json:"tags,omitempty"`
+	Updated       string                 `json:"updated,omitempty"`
+}
+
+type Room struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type,omitempty"`
+	Occupants []string `json:"occupants,omitempty"`
+	Cost      *Cost    `json:"cost,omitempty"`
+}
+
+type Activity struct {
+	Id          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Address     string                 `json:"address,omitempty"`
+	Start       string                 `json:"start"`
+	End         string                 `json:"end,omitempty"`
+	Cost        *Cost                  `json:"cost,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Updated     string                 `json:"updated,omitempty"`
+}
+
+type Expense struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	Category   string `json:"category,omitempty"`
+	OccurredOn string `json:"occurredOn,omitempty"`
+	Cost       *Cost  `json:"cost,omitempty"`
+	// Converted is the cost in the budget currency at the rate locked when
+	// the expense was logged
+	Converted *Cost    `json:"converted,omitempty"`
+	Notes     string   `json:"notes,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Updated   string   `json:"updated,omitempty"`
+}
+
+// Rental is equipment rented for an activity, the deposit is refundable and
+// not counted in the totals
+type Rental struct {
+	Id         string `json:"id"`
+	ActivityId string `json:"activityId,omitempty"`
+	Item       string `json:"item"`
+	Shop       string `json:"shop,omitempty"`
+	Pickup     string `json:"pickup,omitempty"`
+	Return     string `json:"return,omitempty"`
+	Deposit    *Cost  `json:"deposit,omitempty"`
+	Cost       *Cost  `json:"cost,omitempty"`
+	Updated    string `json:"updated,omitempty"`
+}
+
+// Ticket is an entry ticket to an activity. What its barcode reads is left
+// out, HasBarcode only tells whether the ticket can be shown at the venue.
+type Ticket struct {
+	Id         string `json:"id"`
+	ActivityId string `json:"activityId"`
+	Holder     string `json:"holder,omitempty"`
+	Section    string `json:"section,omitempty"`
+	Row        string `json:"row,omitempty"`
+	Seat       string `json:"seat,omitempty"`
+	Gate       string `json:"gate,omitempty"`
+	EntryStart string `json:"entryStart,omitempty"`
+	EntryEnd   string `json:"entryEnd,omitempty"`
+	HasBarcode bool   `json:"hasBarcode,omitempty"`
+	Updated    string `json:"updated,omitempty"`
+}
+
+// CarRental is a car picked up at one place and dropped off at the same or
+// another one
+type CarRental struct {
+	Id           string                 `json:"id"`
+	Provider     string                 `json:"provider,omitempty"`
+	Pickup       string                 `json:"pickup"`
+	PickupTime   string                 `json:"pickupTime"`
+	Dropoff      string                 `json:"dropoff,omitempty"`
+	DropoffTime  string                 `json:"dropoffTime,omitempty"`
+	VehicleClass string                 `json:"vehicleClass,omitempty"`
+	Confirmation string                 `json:"confirmation,omitempty"`
+	Notes        string                 `json:"notes,omitempty"`
+	Cost         *Cost                  `json:"cost,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	Tags         []string               `json:"tags,omitempty"`
+	Updated      string                 `json:"updated,omitempty"`
+}
+
+// Dining is a table booked at a restaurant
+type Dining struct {
+	Id           string                 `json:"id"`
+	Name         string                 `json:"name"`
+	Time         string                 `json:"time"`
+	PartySize    int                    `json:"partySize,omitempty"`
+	Cuisine      string                 `json:"cuisine,omitempty"`
+	Address      string                 `json:"address,omitempty"`
+	Confirmation string                 `json:"confirmation,omitempty"`
+	Notes        string                 `json:"notes,omitempty"`
+	Cost         *Cost                  `json:"cost,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	Tags         []string               `json:"tags,omitempty"`
+	Updated      string                 `json:"updated,omitempty"`
+}
+
+// Build loads the trip and all of its records. The records are read
+// concurrently and each list is sorted by time. Unless includePrivate is set,
+// items and fields the owner keeps private are left out, see trips.RedactRecord.
+func Build(app core.App, trip *core.Record, includePrivate bool) (*Context, error) {
+	ctx := &Context{
+		Trip: Trip{
+			Id:          trip.Id,
+			Name:        trip.GetString("name"),
+			Description: trip.GetString("description"),
+			StartDate:   FormatDate(trip.GetDateTime("startDate")),
+			EndDate:     FormatDate(trip.GetDateTime("endDate")),
+			Tags:        trips.RecordTags(trip),
+		},
+		Notes:        trip.GetString("notes"),
+		Destinations: parseDestinations(app, trip),
+		Participants: parseParticipants(app, trip),
+		GeneratedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+
+	if ctx.Notes == "" {
+		ctx.Notes = trip.GetString("description")
+	}
+
+	var budget Cost
+	if err := trip.UnmarshalJSONField("budget", &budget); err == nil {
+		ctx.Budget = costOrNil(budget)
+	}
+
+	// each goroutine only writes its own field
+	var group errgroup.Group
+	group.Go(func() (err error) {
+		ctx.Transportations, err = collectTransportations(app, trip, includePrivate)
+		return err
+	})
+	group.Go(func() (err error) {
+		ctx.Lodgings, err = collectLodgings(app, trip, includePrivate)
+		return err
+	})
+	group.Go(func() (err error) {
+		ctx.Activities, err = collectActivities(app, trip, includePrivate)
+		return err
+	})
+	group.Go(func() (err error) {
+		ctx.Expenses, err = collectExpenses(app, trip, includePrivate)
+		return err
+	})
+	group.Go(func() (err error) {
+		ctx.Rentals, err = collectRentals(app, trip, includePrivate)
+		return err
+	})
+	group.Go(func() (err error) {
+		ctx.Tickets, err = collectTickets(app, trip, includePrivate)
+		return err
+	})
+	group.Go(func() (err error) {
+		ctx.CarRentals, err = collectCarRentals(app, trip, includePrivate)
+		return err
+	})
+	group.Go(func() (err error) {
+		ctx.Dining, err = collectDining(app, trip, includePrivate)
+		return err
+	})
+	group.Go(func() (err error) {
+		ctx.Documents, err = collectDocuments(app, trip, includePrivate)
+		return err
+	})
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	ctx.Passages = collectPassages(ctx)
+	rates := currency.LoadRates(app)
+	ctx.Stats = computeStats(ctx, rates)
+	if raw := trip.GetString("budgetCategories"); raw != "" && raw != "null" {
+		ctx.Stats.BudgetCategories = categoryBudgets(app, trip, includePrivate, rates)
+	}
+	return ctx, nil
+}
+
+// FormatDate renders a stored date as local wall-clock time without a zone
+func FormatDate(dt types.DateTime) string {
+	if dt.IsZero() {
+		return ""
+	}
+	return dt.Time().Format("2006-01-02T15:04:05")
+}
+
+// FormatUpdated renders when the record was last changed. Unlike the
+// itinerary times it is an instant, in UTC like GeneratedAt.
+func FormatUpdated(record *core.Record) string {
+	updated := record.GetDateTime("updated")
+	if updated.IsZero() {
+		return ""
+	}
+	return updated.Time().UTC().Format(time.RFC3339)
+}
+
+func findSorted(app core.App, collection string, trip *core.Record, dateField string, includePrivate bool) ([]*core.Record, error) {
+	records, err := app.FindAllRecords(collection, dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+	if err != nil {
+		return nil, err
+	}
+
+	if !includePrivate {
+		visible := records[:0]
+		for _, record := range records {
+			if trips.RedactRecord(record) {
+				visible = append(visible, record)
+			}
+		}
+		records = visible
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].GetDateTime(dateField).Time().Before(records[j].GetDateTime(dateField).Time())
+	})
+	return records, nil
+}
+
+func collectTransportations(app core.App, trip *core.Record, includePrivate bool) ([]Transportation, error) {
+	records, err := findSorted(app, "transportations", trip, "departureTime", includePrivate)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]Transportation, 0, len(records))
+	for _, record := range records {
+		summaries = append(summaries, Transportation{
+			Id:           record.Id,
+			Type:         record.GetString("type"),
+			Origin:       record.GetString("origin"),
+			Destination:  record.GetString("destination"),
+			Departure:    FormatDate(record.GetDateTime("departureTime")),
+			Arrival:      FormatDate(record.GetDateTime("arrivalTime")),
+			Confirmation: trips.ConfirmationCode(record),
+			Notes:        record.GetString("notes"),
+			Seats:        parseSeats(record),
+			Cost:         recordCost(record),
+			Metadata:     recordMetadata(record),
+			Tags:         trips.RecordTags(record),
+			Updated:      FormatUpdated(record),
+		})
+	}
+
+	return summaries, nil
+}
+
+func collectLodgings(app core.App, trip *core.Record, includePrivate bool) ([]Lodging, error) {
+	records, err := findSorted(app, "lodgings", trip, "startDate", includePrivate)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]Lodging, 0, len(records))
+	for _, record := range records {
+		summaries = append(summaries, Lodging{
+			Id:            record.Id,
+			Type:          record.GetString("type"),
+			Name:          record.GetString("name"),
+			Address:       record.GetString("address"),
+			CheckIn:       FormatDate(record.GetDateTime("startDate")),
+			CheckOut:      FormatDate(record.GetDateTime("endDate")),
+			Confirmation:  trips.ConfirmationCode(record),
+			ReservationBy: record.GetString("reservationName"),
+			Cost:          recordCost(record),
+			Metadata:      recordMetadata(record),
+			Rooms:         parseRooms(record),
+			Tags:          trips.RecordTags(record),
+			Updated:       FormatUpdated(record),
+		})
+	}
+
+	return summaries, nil
+}
+
+func collectActivities(app core.App, trip *core.Record, includePrivate bool) ([]Activity, error) {
+	records, err := findSorted(app, "activities", trip, "startDate", includePrivate)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]Activity, 0, len(records))
+	for _, record := range records {
+		summaries = append(summaries, Activity{
+			Id:          record.Id,
+			Name:        record.GetString("name"),
+			Description: record.GetString("description"),
+			Address:     record.GetString("address"),
+			Start:       FormatDate(record.GetDateTime("startDate")),
+			End:         FormatDate(record.GetDateTime("endDate")),
+			Cost:        recordCost(record),
+			Metadata:    recordMetadata(record),
+			Tags:        trips.RecordTags(record),
+			Updated:     FormatUpdated(record),
+		})
+	}
+
+	return summaries, nil
+}
+
+func collectExpenses(app core.App, trip *core.Record, includePrivate bool) ([]Expense, error) {
+	records, err := findSorted(app, "trip_expenses", trip, "occurredOn", includePrivate)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]Expense, 0, len(records))
+	for _, record := range records {
+		summaries = append(summaries, Expense{
+			Id:         record.Id,
+			Name:       record.GetString("name"),
+			Category:   record.GetString("category"),
+			OccurredOn: FormatDate(record.GetDateTime("occurredOn")),
+			Notes:      record.GetString("notes"),
+			Cost:       recordCost(record),
+			Converted:  lockedConversion(record),
+			Tags:       trips.RecordTags(record),
+			Updated:    FormatUpdated(record),
+		})
+	}
+
+	return summaries, nil
+}
+
+// lockedConversion is the cost of an expense at its locked exchange rate
+func lockedConversion(record *core.Record) *Cost {
+	cost := recordCost(record)
+	var locked bt.ExchangeRate
+	if cost == nil || record.UnmarshalJSONField("exchangeRate", &locked) != nil || locked.From != cost.Currency || locked.Rate <= 0 {
+		return nil
+	}
+	return &Cost{Value: currency.Round(cost.Value*locked.Rate, locked.To), Currency: locked.To}
+}
+
+func collectRentals(app core.App, trip *core.Record, includePrivate bool) ([]Rental, error) {
+	records, err := findSorted(app, "equipment_rentals", trip, "pickupTime", includePrivate)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]Rental, 0, len(records))
+	for _, record := range records {
+		var deposit Cost
+		_ = record.UnmarshalJSONField("deposit", &deposit)
+		summaries = append(summaries, Rental{
+			Id:         record.Id,
+			ActivityId: record.GetString("activity"),
+			Item:       record.GetString("item"),
+			Shop:       record.GetString("shop"),
+			Pickup:     FormatDate(record.GetDateTime("pickupTime")),
+			Return:     FormatDate(record.GetDateTime("returnTime")),
+			Deposit:    costOrNil(deposit),
+			Cost:       recordCost(record),
+			Updated:    FormatUpdated(record),
+		})
+	}
+
+	return summaries, nil
+}
+
+func collectTickets(app core.App, trip *core.Record, includePrivate bool) ([]Ticket, error) {
+	records, err := findSorted(app, "tickets", trip, "entryStart", includePrivate)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]Ticket, 0, len(records))
+	for _, record := range records {
+		summaries = append(summaries, Ticket{
+			Id:         record.Id,
+			ActivityId: record.GetString("activity"),
+			Holder:     record.GetString("holder"),
+			Section:    record.GetString("section"),
+			Row:        record.GetString("row"),
+			Seat:       record.GetString("seat"),
+			Gate:       record.GetString("gate"),
+			EntryStart: FormatDate(record.GetDateTime("entryStart")),
+			EntryEnd:   FormatDate(record.GetDateTime("entryEnd")),
+			HasBarcode: record.GetString("barcode") != "",
+			Updated:    FormatUpdated(record),
+		})
+	}
+
+	return summaries, nil
+}
+
+func collectCarRentals(app core.App, trip *core.Record, includePrivate bool) ([]CarRental, error) {
+	records, err := findSorted(app, "car_rentals", trip, "pickupTime", includePrivate)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]CarRental, 0, len(records))
+	for _, record := range records {
+		summaries = append(summaries, CarRental{
+			Id:           record.Id,
+			Provider:     record.GetString("provider"),
+			Pickup:       record.GetString("pickupLocation"),
+			PickupTime:   FormatDate(record.GetDateTime("pickupTime")),
+			Dropoff:      record.GetString("dropoffLocation"),
+			DropoffTime:  FormatDate(record.GetDateTime("dropoffTime")),
+			VehicleClass: record.GetString("vehicleClass"),
+			Confirmation: trips.ConfirmationCode(record),
+			Notes:        record.GetString("notes"),
+			Cost:         recordCost(record),
+			Metadata:     recordMetadata(record),
+			Tags:         trips.RecordTags(record),
+			Updated:      FormatUpdated(record),
+		})
+	}
+
+	return summaries, nil
+}
+
+func collectDining(app core.App, trip *core.Record, includePrivate bool) ([]Dining, error) {
+	records, err := findSorted(app, "dining", trip, "reservationTime", includePrivate)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]Dining, 0, len(records))
+	for _, record := range records {
+		summaries = append(summaries, Dining{
+			Id:           record.Id,
+			Name:         record.GetString("name"),
+			Time:         FormatDate(record.GetDateTime("reservationTime")),
+			PartySize:    record.GetInt("partySize"),
+			Cuisine:      record.GetString("cuisine"),
+			Address:      record.GetString("address"),
+			Confirmation: trips.ConfirmationCode(record),
+			Notes:        record.GetString("notes"),
+			Cost:         recordCost(record),
+			Metadata:     recordMetadata(record),
+			Tags:         trips.RecordTags(record),
+			Updated:      FormatUpdated(record),
+		})
+	}
+
+	return summaries, nil
+}
+
+func recordCost(record *core.Record) *Cost {
+	var cost Cost
+	_ = record.UnmarshalJSONField("cost", &cost)
+	return costOrNil(cost)
+}
+
+// categoryBudgets reads the spend per category of the budget, nothing when
+// the budget has no currency to add the costs up in
+func categoryBudgets(app core.App, trip *core.Record, includePrivate bool, rates map[string]float64) []CategoryBudget {
+	report, err := trips.SpendByCategory(app, trip, includePrivate, rates)
+	if err != nil {
+		return nil
+	}
+	categories := make([]CategoryBudget, 0, len(report.Categories))
+	for _, line := range report.Categories {
+		category := CategoryBudget{
+			Category: line.Category,
+			Spent:    Cost{Value: line.Spent.Value, Currency: line.Spent.Currency},
+			Overrun:  line.Overrun,
+		}
+		if line.Budget != nil {
+			category.Budget = &Cost{Value: line.Budget.Value, Currency: line.Budget.Currency}
+		}
+		categories = append(categories, category)
+	}
+	return categories
+}
+
+func costOrNil(cost Cost) *Cost {
+	if cost.Value == 0 && cost.Currency == "" {
+		return nil
+	}
+	return &cost
+}
+
+func parseSeats(record *core.Record) []Seat {
+	var seats []Seat
+	_ = record.UnmarshalJSONField("seats", &seats)
+	return seats
+}
+
+func parseRooms(record *core.Record) []Room {
+	var rooms []Room
+	_ = record.UnmarshalJSONField("rooms", &rooms)
+	for i := range rooms {
+		if rooms[i].Cost != nil {
+			rooms[i].Cost = costOrNil(*rooms[i].Cost)
+		}
+	}
+	return rooms
+}
+
+func recordMetadata(record *core.Record) map[string]interface{} {
+	var metadata map[string]interface{}
+	_ = record.UnmarshalJSONField("metadata", &metadata)
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
+
+func parseDestinations(app core.App, trip *core.Record) []Destination {
+	raw, ok := parseJSONList(app, trip, "destinations")
+	if !ok {
+		return nil
+	}
+
+	results := make([]Destination, 0, len(raw))
+	for _, d := range raw {
+		results = append(results, Destination{
+			Name:        stringValue(d["name"]),
+			Country:     stringValue(d["countryName"]),
+			State:       stringValue(d["stateName"]),
+			Timezone:    stringValue(d["timezone"]),
+			Latitude:    stringValue(d["latitude"]),
+			Longitude:   stringValue(d["longitude"]),
+			Category:    stringValue(d["category"]),
+			Description: stringValue(d["description"]),
+		})
+	}
+	return results
+}
+
+func parseParticipants(app core.App, trip *core.Record) []Participant {
+	raw, ok := parseJSONList(app, trip, "participants")
+	if !ok {
+		return nil
+	}
+
+	results := make([]Participant, 0, len(raw))
+	for _, p := range raw {
+		results = append(results, Participant{
+			Name:        stringValue(p["name"]),
+			Email:       stringValue(p["email"]),
+			Nationality: stringValue(p["nationality"]),
+		})
+	}
+	return results
+}
+
+func parseJSONList(app core.App, trip *core.Record, field string) ([]map[string]interface{}, bool) {
+	data := trip.GetString(field)
+	if strings.TrimSpace(data) == "" {
+		return nil, false
+	}
+
+	var raw []map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		app.Logger().Warn("Unable to parse trip "+field, "error", err, "tripId", trip.Id)
+		return nil, false
+	}
+	return raw, true
+}
+
+func stringValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,114 @@
+package tripcontext
+
+import (
+	"backend/ingest"
+	"backend/trips"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// larger files are listed without reading them
+	maxDocumentBytes = 10 << 20
+	maxDocumentText  = 20000
+)
+
+// collections whose records link attachments through attachmentReferences
+var documentCollections = []string{"transportations", "lodgings", "activities", "trip_expenses"}
+
+// Document is an uploaded file of the trip, the records it is attached to
+// and the labelled values read from it, such as a door code
+type Document struct {
+	Id        string            `json:"id"`
+	Name      string            `json:"name"`
+	Type      string            `json:"type"`
+	RecordIds []string          `json:"recordIds,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	// Text is what could be read from the file. It is searched by the
+	// find_document tool and not sent with the context.
+	Text string `json:"-"`
+}
+
+// collectDocuments lists the attachments of the trip. Without private
+// access, files attached only to private items are left out and files of
+// items with private notes or confirmation codes are listed without what
+// was read from them.
+func collectDocuments(app core.App, trip *core.Record, includePrivate bool) ([]Document, error) {
+	attachments, err := app.FindAllRecords("trip_attachments", dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 {
+		return nil, nil
+	}
+
+	linked := map[string][]string{}
+	hidden := map[string]bool{}
+	restricted := map[string]bool{}
+	for _, collection := range documentCollections {
+		records, err := app.FindAllRecords(collection, dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			privacy := trips.ItemPrivacy(record)
+			for _, ref := range record.GetStringSlice("attachmentReferences") {
+				switch {
+				case includePrivate:
+					linked[ref] = append(linked[ref], record.Id)
+				case privacy.Item:
+					hidden[ref] = true
+				default:
+					linked[ref] = append(linked[ref], record.Id)
+					if slices.Contains(privacy.Fields, trips.PrivateNotes) || slices.Contains(privacy.Fields, trips.PrivateConfirmationCode) {
+						restricted[ref] = true
+					}
+				}
+			}
+		}
+	}
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return nil, err
+	}
+	defer fsys.Close()
+
+	documents := make([]Document, 0, len(attachments))
+	for _, attachment := range attachments {
+		if hidden[attachment.Id] && len(linked[attachment.Id]) == 0 {
+			continue
+		}
+
+		document := Document{
+			Id:        attachment.Id,
+			Name:      attachment.GetString("name"),
+			Type:      ingest.DocumentKind(attachment.GetString("file")),
+			RecordIds: linked[attachment.Id],
+		}
+		if !restricted[attachment.Id] {
+			if reader, err := fsys.GetReader(attachment.BaseFilesPath() + "/" + attachment.GetString("file")); err == nil {
+				data, _ := io.ReadAll(io.LimitReader(reader, maxDocumentBytes))
+				reader.Close()
+				document.Text = ingest.DocumentText(attachment.GetString("file"), data)
+				if len(document.Text) > maxDocumentText {
+					document.Text = strings.ToValidUTF8(document.Text[:maxDocumentText], "")
+				}
+				if fields := ingest.DocumentFields(document.Text); len(fields) > 0 {
+					document.Fields = fields
+				}
+			}
+		}
+		documents = append(documents, document)
+	}
+
+	sort.Slice(documents, func(i, j int) bool {
+		return documents[i].Name < documents[j].Name
+	})
+	return documents, nil
+}
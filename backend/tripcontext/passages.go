@@ -0,0 +1,286 @@
+package tripcontext
+
+import (
+	"backend/embeddings"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// snippets less similar to the question than this are not worth reading
+const minPassageScore = 0.2
+
+// Passage is a free text of the trip the assistant searches rather than
+// reads whole: the notes and description of the trip, the notes of its
+// items, the descriptions of activities and the text of the documents.
+// Passages are taken from the context, so they hold what the user may see.
+type Passage struct {
+	// Source is the collection of the record the text is a field of
+	Source   string `json:"source"`
+	RecordId string `json:"recordId"`
+	Field    string `json:"field"`
+	Label    string `json:"label"`
+	Text     string `json:"-"`
+}
+
+// Snippet is the part of a passage that answers a search
+type Snippet struct {
+	Source   string  `json:"source"`
+	RecordId string  `json:"recordId"`
+	Label    string  `json:"label"`
+	Text     string  `json:"text"`
+	Score    float64 `json:"score"`
+}
+
+// collectPassages lists the texts of the context before the context budget
+// shortens them
+func collectPassages(c *Context) []Passage {
+	passages := make([]Passage, 0)
+	add := func(source string, id string, field string, label string, text string) {
+		if strings.TrimSpace(text) != "" {
+			passages = append(passages, Passage{Source: source, RecordId: id, Field: field, Label: label, Text: text})
+		}
+	}
+
+	add("trips", c.Trip.Id, "notes", c.Trip.Name, c.Notes)
+	if c.Trip.Description != c.Notes {
+		add("trips", c.Trip.Id, "description", c.Trip.Name, c.Trip.Description)
+	}
+	for _, t := range c.Transportations {
+		add("transportations", t.Id, "notes", t.Origin+" to "+t.Destination, t.Notes)
+	}
+	for _, a := range c.Activities {
+		add("activities", a.Id, "description", a.Name, a.Description)
+	}
+	for _, x := range c.Expenses {
+		add("trip_expenses", x.Id, "notes", x.Name, x.Notes)
+	}
+	for _, r := range c.CarRentals {
+		add("car_rentals", r.Id, "notes", r.Provider, r.Notes)
+	}
+	for _, d := range c.Dining {
+		add("dining", d.Id, "notes", d.Name, d.Notes)
+	}
+	for _, d := range c.Documents {
+		add("trip_attachments", d.Id, "text", d.Name, d.Text)
+	}
+	return passages
+}
+
+type passageChunk struct {
+	passage Passage
+	text    string
+	hash    string
+}
+
+func (p Passage) key() string {
+	return p.Source + "/" + p.RecordId + "/" + p.Field
+}
+
+// SearchPassages returns the snippets of the passages closest in meaning to
+// the query, best first. The index of the trip is brought up to date first:
+// snippets of changed texts are embedded again and the ones of texts that
+// are gone are deleted. Snippets of texts the user may not see stay in the
+// index but are never returned, the passages decide what is searched.
+// Without a provider the snippets are ranked on the words they share with
+// the query.
+func SearchPassages(ctx context.Context, app core.App, provider embeddings.DataProvider, tripId string, passages []Passage, query string, limit int) ([]Snippet, error) {
+	model := ""
+	if provider != nil {
+		model = provider.Model()
+	}
+	chunks := make([]passageChunk, 0, len(passages))
+	for _, passage := range passages {
+		for _, text := range embeddings.Chunk(passage.Text) {
+			sum := sha256.Sum256([]byte(model + "\x00" + passage.key() + "\x00" + text))
+			chunks = append(chunks, passageChunk{passage: passage, text: text, hash: hex.EncodeToString(sum[:])})
+		}
+	}
+	if len(chunks) == 0 || strings.TrimSpace(query) == "" {
+		return []Snippet{}, nil
+	}
+
+	scores := make([]float64, len(chunks))
+	if provider == nil {
+		words := queryWords(query)
+		for i, chunk := range chunks {
+			scores[i] = wordScore(chunk.passage.Label+" "+chunk.text, words)
+		}
+	} else {
+		vectors, err := syncPassageIndex(ctx, app, provider, tripId, chunks)
+		if err != nil {
+			return nil, err
+		}
+		queried, err := provider.Embed(ctx, []string{query})
+		if err != nil {
+			return nil, err
+		}
+		for i, chunk := range chunks {
+			scores[i] = embeddings.Cosine(queried[0], vectors[chunk.hash])
+		}
+	}
+
+	order := make([]int, len(chunks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+
+	snippets := make([]Snippet, 0, limit)
+	for _, i := range order {
+		if len(snippets) == limit || scores[i] < minPassageScore {
+			break
+		}
+		snippets = append(snippets, Snippet{
+			Source:   chunks[i].passage.Source,
+			RecordId: chunks[i].passage.RecordId,
+			Label:    chunks[i].passage.Label,
+			Text:     chunks[i].text,
+			Score:    float64(int(scores[i]*1000)) / 1000,
+		})
+	}
+	return snippets, nil
+}
+
+// syncPassageIndex embeds the chunks the index of the trip does not have
+// yet, deletes the rows no chunk needs anymore and returns the vectors of
+// the chunks by hash
+func syncPassageIndex(ctx context.Context, app core.App, provider embeddings.DataProvider, tripId string, chunks []passageChunk) (map[string][]float32, error) {
+	rows, err := app.FindAllRecords("trip_embeddings", dbx.HashExp{"trip": tripId})
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := map[string]bool{}
+	searched := map[string]bool{}
+	for _, chunk := range chunks {
+		wanted[chunk.hash] = true
+		searched[chunk.passage.key()] = true
+	}
+
+	vectors := map[string][]float32{}
+	stale := make([]*core.Record, 0)
+	gone := map[string]bool{}
+	for _, row := range rows {
+		hash := row.GetString("hash")
+		if _, ok := vectors[hash]; ok || !wanted[hash] && rowSourceGone(app, row, searched, gone) {
+			stale = append(stale, row)
+			continue
+		}
+		if !wanted[hash] {
+			continue
+		}
+		vector, err := embeddings.Decode(row.GetString("vector"))
+		if err != nil {
+			stale = append(stale, row)
+			continue
+		}
+		vectors[hash] = vector
+	}
+
+	missing := make([]passageChunk, 0)
+	for _, chunk := range chunks {
+		if _, ok := vectors[chunk.hash]; !ok && !slices.ContainsFunc(missing, func(c passageChunk) bool { return c.hash == chunk.hash }) {
+			missing = append(missing, chunk)
+		}
+	}
+	if len(missing) == 0 && len(stale) == 0 {
+		return vectors, nil
+	}
+
+	texts := make([]string, 0, len(missing))
+	for _, chunk := range missing {
+		texts = append(texts, chunk.passage.Label+"\n"+chunk.text)
+	}
+	embedded := make([][]float32, 0)
+	if len(texts) > 0 {
+		if embedded, err = provider.Embed(ctx, texts); err != nil {
+			return nil, err
+		}
+	}
+
+	collection, err := app.FindCollectionByNameOrId("trip_embeddings")
+	if err != nil {
+		return nil, err
+	}
+	err = app.RunInTransaction(func(txApp core.App) error {
+		for _, row := range stale {
+			if err := txApp.Delete(row); err != nil {
+				return err
+			}
+		}
+		for i, chunk := range missing {
+			row := core.NewRecord(collection)
+			row.Set("trip", tripId)
+			row.Set("source", chunk.passage.Source)
+			row.Set("recordId", chunk.passage.RecordId)
+			row.Set("field", chunk.passage.Field)
+			row.Set("hash", chunk.hash)
+			row.Set("text", chunk.text)
+			row.Set("vector", embeddings.Encode(embedded[i]))
+			if err := txApp.Save(row); err != nil {
+				return err
+			}
+			vectors[chunk.hash] = embedded[i]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+// rowSourceGone tells the rows of texts that changed, or of records that
+// were deleted, from the rows of texts kept from the user searching
+func rowSourceGone(app core.App, row *core.Record, searched map[string]bool, gone map[string]bool) bool {
+	source := row.GetString("source")
+	recordId := row.GetString("recordId")
+	if searched[source+"/"+recordId+"/"+row.GetString("field")] {
+		return true
+	}
+	key := source + "/" + recordId
+	if _, checked := gone[key]; !checked {
+		_, err := app.FindRecordById(source, recordId)
+		gone[key] = err != nil
+	}
+	return gone[key]
+}
+
+// wordScore is the share of the words of the query found in the text
+func wordScore(text string, words []string) float64 {
+	if len(words) == 0 {
+		return 0
+	}
+	text = strings.ToLower(text)
+	found := 0
+	for _, word := range words {
+		if strings.Contains(text, word) {
+			found++
+		}
+	}
+	return float64(found) / float64(len(words))
+}
+
+// queryWords splits the query into lower case words, leaving out the ones
+// too short to tell texts apart
+func queryWords(query string) []string {
+	words := make([]string, 0)
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) > 2 && !slices.Contains(words, word) {
+			words = append(words, word)
+		}
+	}
+	return words
+}
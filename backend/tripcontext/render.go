@@ -0,0 +1,239 @@
+package tripcontext
+
+import (
+	"backend/currency"
+	"backend/entry"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JSON renders the context as indented JSON, the format sent to the assistant
+func (c *Context) JSON() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// Text renders the context as a plain text itinerary, one line per record,
+// for places where a reader rather than a model consumes it
+func (c *Context) Text() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s (%s - %s)\n", c.Trip.Name, c.Trip.StartDate, c.Trip.EndDate)
+	if c.Trip.Description != "" && c.Trip.Description != c.Notes {
+		fmt.Fprintf(&b, "%s\n", c.Trip.Description)
+	}
+	if c.Notes != "" {
+		fmt.Fprintf(&b, "Notes: %s\n", c.Notes)
+	}
+
+	if len(c.Destinations) > 0 {
+		names := make([]string, 0, len(c.Destinations))
+		for _, d := range c.Destinations {
+			names = append(names, joinNonEmpty(", ", d.Name, d.State, d.Country))
+		}
+		fmt.Fprintf(&b, "Destinations: %s\n", strings.Join(names, "; "))
+	}
+	if len(c.Participants) > 0 {
+		names := make([]string, 0, len(c.Participants))
+		for _, p := range c.Participants {
+			names = append(names, p.Name)
+		}
+		fmt.Fprintf(&b, "Participants: %s\n", strings.Join(names, ", "))
+	}
+	if c.Budget != nil {
+		fmt.Fprintf(&b, "Budget: %s\n", c.Budget)
+	}
+
+	if len(c.Transportations) > 0 {
+		b.WriteString("\nTransportation\n")
+		for _, t := range c.Transportations {
+			fmt.Fprintf(&b, "- %s %s: %s -> %s%s\n", t.Departure, t.Type, t.Origin, t.Destination, costSuffix(t.Cost))
+			if len(t.Seats) > 0 {
+				seats := make([]string, 0, len(t.Seats))
+				for _, s := range t.Seats {
+					coach := ""
+					if s.Coach != "" {
+						coach = "coach " + s.Coach
+					}
+					seats = append(seats, joinNonEmpty(" ", s.Participant, coach, s.Kind, s.Seat))
+				}
+				fmt.Fprintf(&b, "  seats: %s\n", strings.Join(seats, ", "))
+			}
+		}
+	}
+	if len(c.Lodgings) > 0 {
+		b.WriteString("\nLodging\n")
+		for _, l := range c.Lodgings {
+			fmt.Fprintf(&b, "- %s to %s: %s%s\n", l.CheckIn, l.CheckOut, joinNonEmpty(", ", l.Name, l.Address), costSuffix(l.Cost))
+			for i, room := range l.Rooms {
+				fmt.Fprintf(&b, "  - room %d %s: %s%s\n", i+1, joinNonEmpty(", ", room.Name, room.Type), strings.Join(room.Occupants, ", "), costSuffix(room.Cost))
+			}
+		}
+	}
+	scheduled, unscheduled := splitUnscheduled(c.Activities)
+	if len(scheduled) > 0 {
+		b.WriteString("\nActivities\n")
+		for _, a := range scheduled {
+			fmt.Fprintf(&b, "- %s: %s%s%s\n", a.Start, joinNonEmpty(", ", a.Name, a.Address), costSuffix(a.Cost), tagsSuffix(a.Tags))
+		}
+	}
+	if len(unscheduled) > 0 {
+		b.WriteString("\nSaved places not scheduled yet (id: name)\n")
+		for _, a := range unscheduled {
+			category, _ := a.Metadata["category"].(string)
+			fmt.Fprintf(&b, "- %s: %s%s\n", a.Id, joinNonEmpty(", ", a.Name, category, a.Address), tagsSuffix(a.Tags))
+		}
+	}
+	if len(c.Tickets) > 0 {
+		activities := map[string]string{}
+		for _, a := range c.Activities {
+			activities[a.Id] = a.Name
+		}
+		b.WriteString("\nTickets\n")
+		for _, t := range c.Tickets {
+			seat := joinNonEmpty(" ", prefixed("section ", t.Section), prefixed("row ", t.Row), prefixed("seat ", t.Seat), prefixed("gate ", t.Gate))
+			fmt.Fprintf(&b, "- %s\n", joinNonEmpty(": ", joinNonEmpty(" to ", t.EntryStart, t.EntryEnd), joinNonEmpty(", ", activities[t.ActivityId], t.Holder, seat)))
+		}
+	}
+	if len(c.Rentals) > 0 {
+		b.WriteString("\nEquipment rentals\n")
+		for _, r := range c.Rentals {
+			fmt.Fprintf(&b, "- %s to %s: %s%s\n", r.Pickup, r.Return, joinNonEmpty(", ", r.Item, r.Shop), costSuffix(r.Cost))
+		}
+	}
+	if len(c.CarRentals) > 0 {
+		b.WriteString("\nCar rentals\n")
+		for _, r := range c.CarRentals {
+			dropoff := r.Dropoff
+			if dropoff == "" {
+				dropoff = r.Pickup
+			}
+			fmt.Fprintf(&b, "- %s %s -> %s %s: %s%s\n", r.PickupTime, r.Pickup, r.DropoffTime, dropoff, joinNonEmpty(", ", r.Provider, r.VehicleClass), costSuffix(r.Cost))
+		}
+	}
+	if len(c.Dining) > 0 {
+		b.WriteString("\nDining\n")
+		for _, d := range c.Dining {
+			party := ""
+			if d.PartySize > 0 {
+				party = fmt.Sprintf("party of %d", d.PartySize)
+			}
+			fmt.Fprintf(&b, "- %s: %s%s\n", d.Time, joinNonEmpty(", ", d.Name, d.Cuisine, d.Address, party), costSuffix(d.Cost))
+		}
+	}
+	if len(c.Expenses) > 0 {
+		b.WriteString("\nExpenses\n")
+		for _, x := range c.Expenses {
+			fmt.Fprintf(&b, "- %s: %s%s", x.OccurredOn, x.Name, costSuffix(x.Cost))
+			if x.Converted != nil {
+				fmt.Fprintf(&b, " = %s", x.Converted.String())
+			}
+			b.WriteString("\n")
+		}
+	}
+	if len(c.Documents) > 0 {
+		b.WriteString("\nDocuments\n")
+		for _, d := range c.Documents {
+			fmt.Fprintf(&b, "- %s (%s)\n", d.Name, d.Type)
+		}
+	}
+	if len(c.Weather) > 0 {
+		b.WriteString("\nWeather\n")
+		for _, day := range c.Weather {
+			for _, f := range day.Forecasts {
+				fmt.Fprintf(&b, "- %s %s: %s\n", day.Date, f.Location, f.String())
+			}
+		}
+	}
+	if len(c.EntryRequirements) > 0 {
+		b.WriteString("\nEntry requirements\n")
+		for _, r := range c.EntryRequirements {
+			fmt.Fprintf(&b, "- %s for %s (%s): %s\n", r.Destination.Name, r.Nationality.Name, strings.Join(r.Travelers, ", "), entryRequirementText(r.Requirement))
+		}
+	}
+	if c.OmittedRecords > 0 {
+		fmt.Fprintf(&b, "\n%d more records are not shown\n", c.OmittedRecords)
+	}
+
+	return b.String()
+}
+
+// String writes the amount with its ISO code rather than a symbol, "kr" or
+// "$" alone would leave the model guessing the currency
+func (c *Cost) String() string {
+	return currency.FormatCode(c.Value, c.Currency)
+}
+
+func costSuffix(cost *Cost) string {
+	if cost == nil {
+		return ""
+	}
+	return " (" + cost.String() + ")"
+}
+
+func tagsSuffix(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return " #" + strings.Join(tags, " #")
+}
+
+var visaLabels = map[string]string{
+	entry.VisaNotRequired: "no visa needed",
+	entry.VisaOnArrival:   "visa on arrival",
+	entry.VisaElectronic:  "e-visa needed before the trip",
+	entry.VisaRequired:    "visa needed before the trip",
+}
+
+func entryRequirementText(r *entry.Requirement) string {
+	if r == nil {
+		return "unknown, check with the embassy"
+	}
+	parts := []string{visaLabels[r.Visa]}
+	if r.MaxStayDays > 0 {
+		parts = append(parts, fmt.Sprintf("up to %d days", r.MaxStayDays))
+	}
+	if r.PassportValidityMonths > 0 {
+		parts = append(parts, fmt.Sprintf("passport valid %d months after the stay", r.PassportValidityMonths))
+	}
+	if len(r.Vaccinations) > 0 {
+		parts = append(parts, "vaccinations: "+strings.Join(r.Vaccinations, ", "))
+	}
+	if r.Notes != "" {
+		parts = append(parts, r.Notes)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func joinNonEmpty(sep string, parts ...string) string {
+	kept := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if strings.TrimSpace(part) != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, sep)
+}
+
+// prefixed labels a value, or returns an empty string without one
+func prefixed(label string, value string) string {
+	if strings.TrimSpace(value) == "" {
+		return ""
+	}
+	return label + value
+}
+
+// splitUnscheduled separates activities without a start, such as places
+// imported from a saved list, which the traveler may want help scheduling
+func splitUnscheduled(activities []Activity) ([]Activity, []Activity) {
+	scheduled := make([]Activity, 0, len(activities))
+	unscheduled := make([]Activity, 0)
+	for _, a := range activities {
+		if a.Start == "" {
+			unscheduled = append(unscheduled, a)
+		} else {
+			scheduled = append(scheduled, a)
+		}
+	}
+	return scheduled, unscheduled
+}
@@ -0,0 +1,400 @@
+package tripcontext
+
+import (
+	"backend/planning"
+	bt "backend/types"
+	"backend/weather"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Risk is something that may go wrong on the trip, with links to the plans
+// it is about
+type Risk struct {
+	Kind     string       `json:"kind"`
+	Severity string       `json:"severity"`
+	Title    string       `json:"title"`
+	Detail   string       `json:"detail"`
+	Date     string       `json:"date,omitempty"`
+	Records  []RiskRecord `json:"records"`
+}
+
+type RiskRecord struct {
+	Collection string `json:"collection"`
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	Link       string `json:"link"`
+}
+
+const (
+	RiskHigh   = "high"
+	RiskMedium = "medium"
+	RiskLow    = "low"
+)
+
+var riskSeverityRank = map[string]int{RiskHigh: 0, RiskMedium: 1, RiskLow: 2}
+
+const (
+	// shortest time to change planes, or to get from any other arrival to
+	// the next departure
+	minFlightConnection = 60 * time.Minute
+	minConnection       = 20 * time.Minute
+	// a departure this long after an arrival is not a connection
+	maxConnection = 24 * time.Hour
+	// deadlines further away than this are not a risk yet
+	deadlineWarning = 14 * 24 * time.Hour
+	deadlineUrgent  = 3 * 24 * time.Hour
+	// many countries want a passport valid this long after the stay
+	passportValidity = 6
+)
+
+var (
+	expiryLabels        = []string{"expiry date", "expiration date", "date of expiry", "expires", "expires on", "valid until"}
+	cancellationLabels  = []string{"free cancellation until", "cancel by", "cancel before", "cancel deadline", "cancellation by", "cancellation before", "cancellation deadline"}
+	documentDateLayouts = []string{
+		"2006-01-02", "02.01.2006", "2 January 2006", "2 Jan 2006", "January 2, 2006", "Jan 2, 2006", "02 Jan 2006", "02 January 2006",
+	}
+)
+
+// Risks lists what may go wrong on the trip, most severe and soonest first:
+// connections too tight to make, outdoor plans on rainy days, travel
+// advisories for the destinations, documents that expire too early, and
+// free cancellation or booking deadlines coming up. The forecast is skipped
+// when provider is nil. Advisories are keyed by lower case country or place
+// name.
+func Risks(c *Context, provider weather.DataProvider, advisories map[string]bt.TravelAdvisory, now time.Time) []Risk {
+	risks := make([]Risk, 0)
+	risks = append(risks, connectionRisks(c)...)
+	if provider != nil {
+		risks = append(risks, weatherRisks(c, provider)...)
+	}
+	risks = append(risks, advisoryRisks(c, advisories)...)
+	risks = append(risks, documentRisks(c)...)
+	risks = append(risks, deadlineRisks(c, now)...)
+
+	sort.SliceStable(risks, func(i, j int) bool {
+		if riskSeverityRank[risks[i].Severity] != riskSeverityRank[risks[j].Severity] {
+			return riskSeverityRank[risks[i].Severity] < riskSeverityRank[risks[j].Severity]
+		}
+		return risks[i].Date < risks[j].Date
+	})
+	return risks
+}
+
+func connectionRisks(c *Context) []Risk {
+	risks := make([]Risk, 0)
+	legs := append([]Transportation(nil), c.Transportations...)
+	sort.SliceStable(legs, func(i, j int) bool { return legs[i].Departure < legs[j].Departure })
+
+	for i := 0; i+1 < len(legs); i++ {
+		arriving, leaving := legs[i], legs[i+1]
+		arrival, arrivalOk := parseContextTime(arriving.Arrival)
+		departure, departureOk := parseContextTime(leaving.Departure)
+		if !arrivalOk || !departureOk {
+			continue
+		}
+		gap := departure.Sub(arrival)
+		if gap > maxConnection {
+			continue
+		}
+		needed := minConnection
+		if arriving.Type == "flight" && leaving.Type == "flight" {
+			needed = minFlightConnection
+		}
+		if gap >= needed {
+			continue
+		}
+
+		risk := Risk{
+			Kind:     "tight_connection",
+			Severity: RiskMedium,
+			Title:    fmt.Sprintf("Tight connection in %s", arriving.Destination),
+			Detail:   fmt.Sprintf("%d minutes between the arrival from %s and the departure to %s, at least %d are needed", int(gap.Minutes()), arriving.Origin, leaving.Destination, int(needed.Minutes())),
+			Date:     arriving.Arrival,
+			Records: []RiskRecord{
+				c.riskRecord("transportations", arriving.Id, transportationName(arriving)),
+				c.riskRecord("transportations", leaving.Id, transportationName(leaving)),
+			},
+		}
+		if gap < 0 {
+			risk.Title = fmt.Sprintf("Overlapping transportation in %s", arriving.Destination)
+			risk.Detail = fmt.Sprintf("the departure to %s is before the arrival from %s", leaving.Destination, arriving.Origin)
+		}
+		if gap < needed/2 {
+			risk.Severity = RiskHigh
+		}
+		risks = append(risks, risk)
+	}
+	return risks
+}
+
+func weatherRisks(c *Context, provider weather.DataProvider) []Risk {
+	days, err := Forecast(c, provider)
+	if err != nil || len(days) == 0 {
+		return nil
+	}
+	rain := make(map[string]float64, len(days))
+	for _, day := range days {
+		for _, forecast := range day.Forecasts {
+			rain[day.Date] = math.Max(rain[day.Date], forecast.PrecipitationProbability)
+		}
+	}
+
+	risks := make([]Risk, 0)
+	for _, a := range c.Activities {
+		if len(a.Start) < len(time.DateOnly) {
+			continue
+		}
+		date := a.Start[:len(time.DateOnly)]
+		chance, ok := rain[date]
+		if !ok {
+			continue
+		}
+		category, _ := a.Metadata["category"].(string)
+		setting := planning.ClassifyActivity(a.Name, a.Description, category)
+		if !planning.WeatherConflict(setting, chance) {
+			continue
+		}
+		risks = append(risks, Risk{
+			Kind:     "weather",
+			Severity: RiskMedium,
+			Title:    fmt.Sprintf("Rain likely during %s", a.Name),
+			Detail:   fmt.Sprintf("%.0f%% chance of rain on %s for an outdoor plan", chance, date),
+			Date:     a.Start,
+			Records:  []RiskRecord{c.riskRecord("activities", a.Id, a.Name)},
+		})
+	}
+	return risks
+}
+
+func advisoryRisks(c *Context, advisories map[string]bt.TravelAdvisory) []Risk {
+	risks := make([]Risk, 0)
+	seen := map[string]bool{}
+	for _, d := range c.Destinations {
+		for _, key := range []string{d.Country, d.Name} {
+			key = strings.ToLower(strings.TrimSpace(key))
+			advisory, ok := advisories[key]
+			if key == "" || !ok || seen[key] || advisory.Level < 2 {
+				continue
+			}
+			seen[key] = true
+
+			severity := RiskMedium
+			if advisory.Level >= 3 {
+				severity = RiskHigh
+			}
+			detail := fmt.Sprintf("travel advisory level %d", advisory.Level)
+			if advisory.Summary != "" {
+				detail = fmt.Sprintf("%s: %s", detail, advisory.Summary)
+			}
+			risks = append(risks, Risk{
+				Kind:     "advisory",
+				Severity: severity,
+				Title:    fmt.Sprintf("Travel advisory for %s", destinationName(d)),
+				Detail:   detail,
+				Records:  make([]RiskRecord, 0),
+			})
+			break
+		}
+	}
+	return risks
+}
+
+// documentRisks looks for passports, visas and other documents that expire
+// before the trip ends or too soon after it
+func documentRisks(c *Context) []Risk {
+	start, startOk := parseContextTime(c.Trip.StartDate)
+	end, endOk := parseContextTime(c.Trip.EndDate)
+	if !startOk || !endOk {
+		return nil
+	}
+
+	risks := make([]Risk, 0)
+	for _, d := range c.Documents {
+		expires, ok := documentDate(d.Fields, expiryLabels)
+		if !ok || !expires.Before(end.AddDate(0, passportValidity, 0)) {
+			continue
+		}
+		risk := Risk{
+			Kind:     "expiring_document",
+			Severity: RiskHigh,
+			Title:    fmt.Sprintf("%s expires during the trip", d.Name),
+			Detail:   fmt.Sprintf("valid until %s, the trip ends %s", expires.Format(time.DateOnly), end.Format(time.DateOnly)),
+			Date:     expires.Format(time.DateOnly),
+			Records:  c.documentRecords(d),
+		}
+		switch {
+		case expires.Before(start):
+			risk.Title = fmt.Sprintf("%s expires before the trip", d.Name)
+		case !expires.Before(end):
+			risk.Severity = RiskMedium
+			risk.Title = fmt.Sprintf("%s expires soon after the trip", d.Name)
+			risk.Detail = fmt.Sprintf("valid until %s, some countries require %d months of validity after the stay", expires.Format(time.DateOnly), passportValidity)
+		}
+		risks = append(risks, risk)
+	}
+	return risks
+}
+
+// deadlineRisks are free cancellation deadlines, from the cancellationDeadline
+// metadata of a plan or its documents, and the bookBy deadlines of plans
+// that are not booked yet
+func deadlineRisks(c *Context, now time.Time) []Risk {
+	type plan struct {
+		record   RiskRecord
+		metadata map[string]interface{}
+		booked   bool
+	}
+	plans := make([]plan, 0)
+	for _, t := range c.Transportations {
+		plans = append(plans, plan{c.riskRecord("transportations", t.Id, transportationName(t)), t.Metadata, t.Confirmation != ""})
+	}
+	for _, l := range c.Lodgings {
+		plans = append(plans, plan{c.riskRecord("lodgings", l.Id, l.Name), l.Metadata, l.Confirmation != ""})
+	}
+	for _, a := range c.Activities {
+		plans = append(plans, plan{c.riskRecord("activities", a.Id, a.Name), a.Metadata, false})
+	}
+	for _, d := range c.Dining {
+		plans = append(plans, plan{c.riskRecord("dining", d.Id, d.Name), d.Metadata, d.Confirmation != ""})
+	}
+
+	cancellations := map[string]time.Time{}
+	for _, d := range c.Documents {
+		if deadline, ok := documentDate(d.Fields, cancellationLabels); ok {
+			for _, id := range d.RecordIds {
+				cancellations[id] = deadline
+			}
+		}
+	}
+
+	risks := make([]Risk, 0)
+	addDeadline := func(kind string, title string, record RiskRecord, deadline time.Time) {
+		left := deadline.Sub(now)
+		if left < 0 || left > deadlineWarning {
+			return
+		}
+		severity := RiskMedium
+		if left <= deadlineUrgent {
+			severity = RiskHigh
+		}
+		risks = append(risks, Risk{
+			Kind:     kind,
+			Severity: severity,
+			Title:    fmt.Sprintf(title, record.Name),
+			Detail:   fmt.Sprintf("by %s, in %d days", deadline.Format(time.DateOnly), int(math.Ceil(left.Hours()/24))),
+			Date:     deadline.Format("2006-01-02T15:04:05"),
+			Records:  []RiskRecord{record},
+		})
+	}
+
+	for _, p := range plans {
+		deadline, ok := parseContextTime(stringValue(p.metadata["cancellationDeadline"]))
+		if !ok {
+			deadline, ok = cancellations[p.record.Id]
+		}
+		if ok {
+			addDeadline("cancellation_deadline", "Free cancellation of %s ends soon", p.record, deadline)
+		}
+		if bookBy, ok := parseContextTime(stringValue(p.metadata["bookBy"])); ok && !p.booked {
+			addDeadline("booking_deadline", "Book %s soon", p.record, bookBy)
+		}
+	}
+	return risks
+}
+
+func (c *Context) riskRecord(collection string, id string, name string) RiskRecord {
+	return RiskRecord{
+		Collection: collection,
+		Id:         id,
+		Name:       name,
+		Link:       fmt.Sprintf("/trips/%s#%s-%s", c.Trip.Id, collection, id),
+	}
+}
+
+// documentRecords links the plans a document belongs to, or the document
+// itself when it belongs to the whole trip
+func (c *Context) documentRecords(d Document) []RiskRecord {
+	if len(d.RecordIds) == 0 {
+		return []RiskRecord{c.riskRecord("trip_attachments", d.Id, d.Name)}
+	}
+	records := make([]RiskRecord, 0, len(d.RecordIds))
+	for _, id := range d.RecordIds {
+		records = append(records, c.riskRecord(c.recordCollection(id), id, d.Name))
+	}
+	return records
+}
+
+func (c *Context) recordCollection(id string) string {
+	for _, t := range c.Transportations {
+		if t.Id == id {
+			return "transportations"
+		}
+	}
+	for _, l := range c.Lodgings {
+		if l.Id == id {
+			return "lodgings"
+		}
+	}
+	for _, e := range c.Expenses {
+		if e.Id == id {
+			return "expenses"
+		}
+	}
+	return "activities"
+}
+
+func destinationName(d Destination) string {
+	if d.Country == "" || d.Country == d.Name {
+		return d.Name
+	}
+	return fmt.Sprintf("%s, %s", d.Name, d.Country)
+}
+
+func transportationName(t Transportation) string {
+	return fmt.Sprintf("%s from %s to %s", t.Type, t.Origin, t.Destination)
+}
+
+// parseContextTime reads a time of the context, or just its date
+func parseContextTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{"2006-01-02T15:04:05", time.RFC3339, "2006-01-02 15:04:05", time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	if len(value) > len(time.DateOnly) {
+		if t, err := time.Parse(time.DateOnly, value[:len(time.DateOnly)]); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// documentDate reads the first date under one of the labels, written in
+// one of the usual ways
+func documentDate(fields map[string]string, labels []string) (time.Time, bool) {
+	for _, label := range labels {
+		value := strings.TrimSpace(fields[label])
+		if value == "" {
+			continue
+		}
+		for _, layout := range documentDateLayouts {
+			// the date may be followed by a time or a remark
+			for _, candidate := range []string{value, firstWords(value, strings.Count(layout, " ")+1)} {
+				if t, err := time.Parse(layout, strings.TrimRight(candidate, ".,;")); err == nil {
+					return t, true
+				}
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func firstWords(value string, n int) string {
+	words := strings.Fields(value)
+	return strings.Join(words[:min(n, len(words))], " ")
+}
@@ -0,0 +1,297 @@
+package tripcontext
+
+import (
+	"backend/currency"
+	"backend/planning"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const contextTimeLayout = "2006-01-02T15:04:05"
+
+// Stats are figures derived from the whole trip, computed before any records
+// are left out of the context so counts and totals stay exact
+type Stats struct {
+	Days             int      `json:"days"`
+	Nights           int      `json:"nights"`
+	Transportations  int      `json:"transportations"`
+	Lodgings         int      `json:"lodgings"`
+	Activities       int      `json:"activities"`
+	Expenses         int      `json:"expenses"`
+	NightsCovered    int      `json:"nightsCovered"`
+	Totals           []Cost   `json:"totals,omitempty"`
+	Budget           *Cost    `json:"budget,omitempty"`
+	BudgetSpent      *Cost    `json:"budgetSpent,omitempty"`
+	UnconvertedCosts int      `json:"unconvertedCosts,omitempty"`
+	Conflicts        []string `json:"conflicts,omitempty"`
+	// BudgetCategories is only set when the budget is split into categories
+	BudgetCategories []CategoryBudget `json:"budgetCategories,omitempty"`
+}
+
+// CategoryBudget is what one category of the budget was given and what
+// its items cost, see trips.SpendByCategory
+type CategoryBudget struct {
+	Category string `json:"category"`
+	Budget   *Cost  `json:"budget,omitempty"`
+	Spent    Cost   `json:"spent"`
+	Overrun  bool   `json:"overrun,omitempty"`
+}
+
+type interval struct {
+	label string
+	start time.Time
+	end   time.Time
+}
+
+// computeStats works on the context as loaded by Build. Rates are units per
+// USD as stored in currency_conversions.
+func computeStats(ctx *Context, rates map[string]float64) *Stats {
+	stats := &Stats{
+		Transportations: len(ctx.Transportations),
+		Lodgings:        len(ctx.Lodgings),
+		Activities:      len(ctx.Activities),
+		Expenses:        len(ctx.Expenses),
+		Budget:          ctx.Budget,
+	}
+
+	start, startOk := parseDay(ctx.Trip.StartDate)
+	end, endOk := parseDay(ctx.Trip.EndDate)
+	if startOk && endOk && !end.Before(start) {
+		stats.Nights = int(end.Sub(start).Hours() / 24)
+		stats.Days = stats.Nights + 1
+		stats.NightsCovered = coveredNights(ctx.Lodgings, start, stats.Nights)
+	}
+
+	costs := make([]*Cost, 0)
+	for _, t := range ctx.Transportations {
+		costs = append(costs, t.Cost)
+	}
+	for _, l := range ctx.Lodgings {
+		costs = append(costs, l.Cost)
+	}
+	for _, a := range ctx.Activities {
+		costs = append(costs, a.Cost)
+	}
+	for _, x := range ctx.Expenses {
+		costs = append(costs, x.Cost)
+	}
+	for _, r := range ctx.Rentals {
+		costs = append(costs, r.Cost)
+	}
+	for _, r := range ctx.CarRentals {
+		costs = append(costs, r.Cost)
+	}
+	for _, d := range ctx.Dining {
+		costs = append(costs, d.Cost)
+	}
+	stats.Totals = totalsByCurrency(costs)
+
+	if ctx.Budget != nil && ctx.Budget.Currency != "" {
+		spent := Cost{Currency: ctx.Budget.Currency}
+		for _, total := range stats.Totals {
+			if converted, ok := currency.Convert(total.Value, total.Currency, ctx.Budget.Currency, rates); ok {
+				spent.Value += converted
+			} else {
+				stats.UnconvertedCosts++
+			}
+		}
+		spent.Value = currency.Round(spent.Value, spent.Currency)
+		stats.BudgetSpent = &spent
+	}
+
+	stats.Conflicts = findConflicts(ctx)
+	return stats
+}
+
+func coveredNights(lodgings []Lodging, start time.Time, nights int) int {
+	covered := 0
+	for i := 0; i < nights; i++ {
+		night := start.AddDate(0, 0, i)
+		for _, l := range lodgings {
+			checkIn, inOk := parseDay(l.CheckIn)
+			checkOut, outOk := parseDay(l.CheckOut)
+			if inOk && outOk && !night.Before(checkIn) && night.Before(checkOut) {
+				covered++
+				break
+			}
+		}
+	}
+	return covered
+}
+
+func totalsByCurrency(costs []*Cost) []Cost {
+	sums := map[string]float64{}
+	for _, cost := range costs {
+		if cost == nil || cost.Currency == "" {
+			continue
+		}
+		sums[cost.Currency] += cost.Value
+	}
+
+	totals := make([]Cost, 0, len(sums))
+	for code, value := range sums {
+		totals = append(totals, Cost{Value: currency.Round(value, code), Currency: code})
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		return totals[i].Currency < totals[j].Currency
+	})
+	return totals
+}
+
+// findConflicts reports lodgings that overlap each other, timed plans
+// (transportation, activities and restaurant reservations) that overlap each other and rented
+// equipment or cars that are due back after a departure
+func findConflicts(ctx *Context) []string {
+	stays := make([]interval, 0, len(ctx.Lodgings))
+	for _, l := range ctx.Lodgings {
+		stays = appendInterval(stays, fmt.Sprintf("stay at %s", l.Name), l.CheckIn, l.CheckOut)
+	}
+
+	plans := make([]interval, 0, len(ctx.Transportations)+len(ctx.Activities)+len(ctx.Dining))
+	for _, t := range ctx.Transportations {
+		plans = appendInterval(plans, fmt.Sprintf("%s %s -> %s", t.Type, t.Origin, t.Destination), t.Departure, t.Arrival)
+	}
+	for _, a := range ctx.Activities {
+		plans = appendInterval(plans, fmt.Sprintf("activity %s", a.Name), a.Start, a.End)
+	}
+	for _, d := range ctx.Dining {
+		plans = appendInterval(plans, fmt.Sprintf("reservation at %s", d.Name), d.Time, "")
+	}
+
+	return append(append(overlaps(stays), overlaps(plans)...), lateReturns(ctx)...)
+}
+
+func lateReturns(ctx *Context) []string {
+	conflicts := make([]string, 0)
+	for _, r := range ctx.Rentals {
+		pickup, _ := time.Parse(contextTimeLayout, r.Pickup)
+		due, err := time.Parse(contextTimeLayout, r.Return)
+		if err != nil {
+			continue
+		}
+		for _, t := range ctx.Transportations {
+			departure, err := time.Parse(contextTimeLayout, t.Departure)
+			if err == nil && planning.LateReturn(pickup, due, departure) {
+				conflicts = append(conflicts, fmt.Sprintf("rental %s is due back %s, too close to %s %s -> %s at %s",
+					r.Item, r.Return, t.Type, t.Origin, t.Destination, t.Departure))
+			}
+		}
+	}
+	for _, r := range ctx.CarRentals {
+		pickup, _ := time.Parse(contextTimeLayout, r.PickupTime)
+		due, err := time.Parse(contextTimeLayout, r.DropoffTime)
+		if err != nil {
+			continue
+		}
+		for _, t := range ctx.Transportations {
+			departure, err := time.Parse(contextTimeLayout, t.Departure)
+			if err == nil && planning.LateReturn(pickup, due, departure) {
+				conflicts = append(conflicts, fmt.Sprintf("car rental from %s is due back %s, too close to %s %s -> %s at %s",
+					r.Pickup, r.DropoffTime, t.Type, t.Origin, t.Destination, t.Departure))
+			}
+		}
+	}
+	return conflicts
+}
+
+func appendInterval(intervals []interval, label, start, end string) []interval {
+	from, err := time.Parse(contextTimeLayout, start)
+	if err != nil {
+		return intervals
+	}
+	to, err := time.Parse(contextTimeLayout, end)
+	if err != nil || !to.After(from) {
+		// without an end the plan only occupies its start time
+		to = from
+	}
+	return append(intervals, interval{label: label, start: from, end: to})
+}
+
+func overlaps(intervals []interval) []string {
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].start.Before(intervals[j].start)
+	})
+
+	conflicts := make([]string, 0)
+	for i := range intervals {
+		for j := i + 1; j < len(intervals); j++ {
+			if !intervals[j].start.Before(intervals[i].end) {
+				break
+			}
+			conflicts = append(conflicts, fmt.Sprintf("%s overlaps %s on %s",
+				intervals[i].label, intervals[j].label, intervals[j].start.Format("2006-01-02")))
+		}
+	}
+	return conflicts
+}
+
+func parseDay(value string) (time.Time, bool) {
+	if len(value) < len("2006-01-02") {
+		return time.Time{}, false
+	}
+	day, err := time.Parse("2006-01-02", value[:10])
+	return day, err == nil
+}
+
+// Header renders the stats as a short block of plain text meant to sit in
+// front of the trip context
+func (s *Stats) Header() string {
+	var b strings.Builder
+
+	b.WriteString("Trip statistics (computed by the server, use these for counts and totals):\n")
+	if s.Days > 0 {
+		fmt.Fprintf(&b, "- Length: %d days, %d nights\n", s.Days, s.Nights)
+	}
+	fmt.Fprintf(&b, "- Items: %d transportation, %d lodging, %d activities, %d expenses\n",
+		s.Transportations, s.Lodgings, s.Activities, s.Expenses)
+	if s.Nights > 0 {
+		fmt.Fprintf(&b, "- Nights with lodging: %d of %d (%d%%)\n",
+			s.NightsCovered, s.Nights, percent(float64(s.NightsCovered), float64(s.Nights)))
+	}
+	if len(s.Totals) > 0 {
+		totals := make([]string, 0, len(s.Totals))
+		for _, total := range s.Totals {
+			totals = append(totals, total.String())
+		}
+		fmt.Fprintf(&b, "- Planned and spent costs: %s\n", strings.Join(totals, ", "))
+	}
+	if s.Budget != nil && s.BudgetSpent != nil {
+		fmt.Fprintf(&b, "- Budget used: %s of %s (%d%%)", s.BudgetSpent, s.Budget,
+			percent(s.BudgetSpent.Value, s.Budget.Value))
+		if s.UnconvertedCosts > 0 {
+			fmt.Fprintf(&b, ", %d currencies could not be converted and are not included", s.UnconvertedCosts)
+		}
+		b.WriteString("\n")
+	}
+	if len(s.BudgetCategories) > 0 {
+		categories := make([]string, 0, len(s.BudgetCategories))
+		for _, category := range s.BudgetCategories {
+			line := fmt.Sprintf("%s %s", category.Category, &category.Spent)
+			if category.Budget != nil {
+				line += fmt.Sprintf(" of %s", category.Budget)
+			}
+			if category.Overrun {
+				line += " (over budget)"
+			}
+			categories = append(categories, line)
+		}
+		fmt.Fprintf(&b, "- Budget by category: %s\n", strings.Join(categories, ", "))
+	}
+	if len(s.Conflicts) == 0 {
+		b.WriteString("- Open conflicts: none\n")
+	} else {
+		fmt.Fprintf(&b, "- Open conflicts: %s\n", strings.Join(s.Conflicts, "; "))
+	}
+
+	return b.String()
+}
+
+func percent(part, whole float64) int {
+	if whole <= 0 {
+		return 0
+	}
+	return int(math.Round(part / whole * 100))
+}
@@ -0,0 +1,75 @@
+package tripcontext
+
+// metadata entries that hold booking references
+var codeMetadataKeys = []string{"reservation", "confirmation", "confirmationCode", "bookingReference"}
+
+// OmitCostsAndCodes removes prices, the budget, the expenses, booking
+// references and what was read from documents from the context. It is what
+// viewers of a shared trip get, on top of leaving out what the owner keeps
+// private.
+func (c *Context) OmitCostsAndCodes() {
+	c.Budget = nil
+	c.Expenses = nil
+
+	for i := range c.Transportations {
+		c.Transportations[i].Cost = nil
+		c.Transportations[i].Metadata = withoutCodes(c.Transportations[i].Metadata)
+	}
+	for i := range c.Lodgings {
+		lodging := &c.Lodgings[i]
+		lodging.Cost = nil
+		lodging.Confirmation = ""
+		lodging.Metadata = withoutCodes(lodging.Metadata)
+		for j := range lodging.Rooms {
+			lodging.Rooms[j].Cost = nil
+		}
+	}
+	for i := range c.Activities {
+		c.Activities[i].Cost = nil
+		c.Activities[i].Metadata = withoutCodes(c.Activities[i].Metadata)
+	}
+	for i := range c.Rentals {
+		c.Rentals[i].Cost = nil
+		c.Rentals[i].Deposit = nil
+	}
+	for i := range c.CarRentals {
+		c.CarRentals[i].Cost = nil
+		c.CarRentals[i].Confirmation = ""
+		c.CarRentals[i].Metadata = withoutCodes(c.CarRentals[i].Metadata)
+	}
+	for i := range c.Dining {
+		c.Dining[i].Cost = nil
+		c.Dining[i].Confirmation = ""
+		c.Dining[i].Metadata = withoutCodes(c.Dining[i].Metadata)
+	}
+	for i := range c.Documents {
+		c.Documents[i].Fields = nil
+		c.Documents[i].Text = ""
+	}
+
+	if c.Stats != nil {
+		stats := *c.Stats
+		stats.Expenses = 0
+		stats.Totals = nil
+		stats.Budget = nil
+		stats.BudgetSpent = nil
+		stats.BudgetCategories = nil
+		stats.UnconvertedCosts = 0
+		c.Stats = &stats
+	}
+}
+
+// withoutCodes copies the metadata, records share their maps with the cache
+func withoutCodes(metadata map[string]interface{}) map[string]interface{} {
+	if metadata == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(metadata))
+	for key, value := range metadata {
+		copied[key] = value
+	}
+	for _, key := range codeMetadataKeys {
+		delete(copied, key)
+	}
+	return copied
+}
@@ -0,0 +1,167 @@
+package tripcontext
+
+import (
+	"backend/weather"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DayWeather is the forecast of one day of the trip at the places the
+// travelers are that day
+type DayWeather struct {
+	Date      string          `json:"date"`
+	Forecasts []PlaceForecast `json:"forecasts"`
+}
+
+type PlaceForecast struct {
+	Location                 string  `json:"location"`
+	TemperatureMax           float64 `json:"temperatureMax"`
+	TemperatureMin           float64 `json:"temperatureMin"`
+	PrecipitationProbability float64 `json:"precipitationProbability"`
+	Conditions               string  `json:"conditions,omitempty"`
+}
+
+// forecastPlace is somewhere with coordinates the forecast is asked for
+type forecastPlace struct {
+	name      string
+	latitude  float64
+	longitude float64
+}
+
+// Forecast returns the weather of each day of the trip that the provider
+// has a forecast for. A day is forecast where the travelers sleep that
+// night, the lodging they leave on the last day, and at every destination
+// when no lodging with coordinates covers it. Days further ahead than the
+// provider forecasts are left out.
+func Forecast(c *Context, provider weather.DataProvider) ([]DayWeather, error) {
+	start, startErr := time.Parse("2006-01-02T15:04:05", c.Trip.StartDate)
+	end, endErr := time.Parse("2006-01-02T15:04:05", c.Trip.EndDate)
+	if startErr != nil || endErr != nil {
+		return nil, nil
+	}
+
+	destinations := make([]forecastPlace, 0, len(c.Destinations))
+	for _, d := range c.Destinations {
+		if place, ok := newForecastPlace(d.Name, d.Latitude, d.Longitude); ok {
+			destinations = append(destinations, place)
+		}
+	}
+
+	forecasts := map[forecastPlace][]weather.DailyForecast{}
+	var failed error
+	days := make([]DayWeather, 0)
+	for day := start; day.Format(time.DateOnly) <= end.Format(time.DateOnly); day = day.AddDate(0, 0, 1) {
+		date := day.Format(time.DateOnly)
+		places := lodgingPlaces(c.Lodgings, date)
+		if len(places) == 0 {
+			places = destinations
+		}
+
+		entry := DayWeather{Date: date, Forecasts: make([]PlaceForecast, 0, len(places))}
+		for _, place := range places {
+			daily, fetched := forecasts[place]
+			if !fetched {
+				var err error
+				if daily, err = provider.GetDailyForecast(place.latitude, place.longitude); err != nil {
+					failed = err
+				}
+				forecasts[place] = daily
+			}
+			if forecast, ok := weather.ForecastFor(daily, date); ok {
+				entry.Forecasts = append(entry.Forecasts, PlaceForecast{
+					Location:                 place.name,
+					TemperatureMax:           forecast.TemperatureMax,
+					TemperatureMin:           forecast.TemperatureMin,
+					PrecipitationProbability: forecast.PrecipitationProbability,
+					Conditions:               weather.Conditions(forecast.WeatherCode),
+				})
+			}
+		}
+		if len(entry.Forecasts) > 0 {
+			days = append(days, entry)
+		}
+	}
+
+	// a provider that failed for every place is an error, a missing place is not
+	if len(days) == 0 && failed != nil {
+		return nil, failed
+	}
+	return days, nil
+}
+
+// lodgingPlaces are the lodgings with coordinates the travelers sleep in on
+// the date, or check out of when they sleep nowhere that night
+func lodgingPlaces(lodgings []Lodging, date string) []forecastPlace {
+	sleeping := make([]forecastPlace, 0)
+	leaving := make([]forecastPlace, 0)
+	for _, l := range lodgings {
+		if len(l.CheckIn) < len(time.DateOnly) || len(l.CheckOut) < len(time.DateOnly) {
+			continue
+		}
+		checkIn, checkOut := l.CheckIn[:len(time.DateOnly)], l.CheckOut[:len(time.DateOnly)]
+		if date < checkIn || date > checkOut {
+			continue
+		}
+		place, _ := l.Metadata["place"].(map[string]interface{})
+		name, _ := place["name"].(string)
+		lodging, ok := newForecastPlace(firstNonEmpty(name, l.Name), place["latitude"], place["longitude"])
+		if !ok {
+			continue
+		}
+		if date < checkOut {
+			sleeping = append(sleeping, lodging)
+		} else {
+			leaving = append(leaving, lodging)
+		}
+	}
+	if len(sleeping) > 0 {
+		return sleeping
+	}
+	return leaving
+}
+
+func newForecastPlace(name string, latitude interface{}, longitude interface{}) (forecastPlace, bool) {
+	lat, latOk := coordinateValue(latitude)
+	lng, lngOk := coordinateValue(longitude)
+	if !latOk || !lngOk {
+		return forecastPlace{}, false
+	}
+	// nearby places share a forecast
+	return forecastPlace{name: name, latitude: roundCoordinate(lat), longitude: roundCoordinate(lng)}, true
+}
+
+func coordinateValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return parsed, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func roundCoordinate(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// String reads like "12-21°C, rain, 70% chance of rain"
+func (f PlaceForecast) String() string {
+	return joinNonEmpty(", ",
+		fmt.Sprintf("%.0f-%.0f°C", f.TemperatureMin, f.TemperatureMax),
+		f.Conditions,
+		fmt.Sprintf("%.0f%% chance of rain", f.PrecipitationProbability))
+}
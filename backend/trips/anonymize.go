@@ -0,0 +1,236 @@
+package trips
+
+import (
+	tj "backend/trips/import/json"
+	bt "backend/types"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+var fakeTravelerNames = []string{
+	"Alex Morgan", "Sam Rivera", "Jordan Lee", "Taylor Brooks", "Casey Nguyen",
+	"Robin Fischer", "Jamie Santos", "Avery Kowalski", "Quinn Okafor", "Riley Haddad",
+}
+
+// metadata keys that usually hold personal or booking data
+var sensitiveMetadataKeys = []string{
+	"confirmation", "seat", "passenger", "email", "phone", "ticket",
+	"reservation", "loyalty", "membership", "booking", "pnr",
+}
+
+// TripSnapshot returns the trip and its records in the export format, without
+// any files, so it can be inspected or altered before being stored elsewhere
+func TripSnapshot(app core.App, trip *core.Record) *bt.ExportedTrip {
+	t := bt.Trip{
+		Id:           trip.Id,
+		Name:         trip.GetString("name"),
+		Description:  trip.GetString("description"),
+		StartDate:    trip.GetDateTime("startDate"),
+		EndDate:      trip.GetDateTime("endDate"),
+		Notes:        trip.GetString("notes"),
+		Destinations: make([]bt.Destination, 0),
+		Participants: make([]bt.Participant, 0),
+	}
+	_ = json.Unmarshal([]byte(trip.GetString("destinations")), &t.Destinations)
+	_ = json.Unmarshal([]byte(trip.GetString("participants")), &t.Participants)
+	_ = trip.UnmarshalJSONField("budget", &t.Budget)
+	_ = trip.UnmarshalJSONField("budgetCategories", &t.BudgetCategories)
+	_ = trip.UnmarshalJSONField("insurance", &t.Insurance)
+
+	return &bt.ExportedTrip{
+		Trip:            &t,
+		Transportations: exportTransportations(app, trip),
+		Lodgings:        exportLodgings(app, trip),
+		Activities:      exportActivities(app, trip),
+		Expenses:        exportExpenses(app, trip),
+		Rentals:         exportRentals(app, trip),
+		CarRentals:      exportCarRentals(app, trip),
+		Dining:          exportDining(app, trip),
+	}
+}
+
+// AnonymizeSnapshot replaces names, confirmation codes and other personal
+// details with realistic fakes and moves every date by shift. Places, types
+// and costs are kept so the trip still looks and behaves like the original.
+func AnonymizeSnapshot(snapshot *bt.ExportedTrip, shift time.Duration) {
+	t := snapshot.Trip
+	t.Name = fmt.Sprintf("Demo trip %s", fakeCode(t.Id, 4))
+	if len(t.Destinations) > 0 {
+		t.Name = fmt.Sprintf("Demo trip to %s", t.Destinations[0].Name)
+	}
+	t.Description = ""
+	t.Notes = ""
+	t.CoverImage = nil
+	t.CoverImageFileName = ""
+	t.StartDate = shiftDate(t.StartDate, shift)
+	t.EndDate = shiftDate(t.EndDate, shift)
+	fakeNames := make(map[string]string, len(t.Participants))
+	for i := range t.Participants {
+		fakeNames[t.Participants[i].Name] = fakeTravelerNames[i%len(fakeTravelerNames)]
+		t.Participants[i].Name = fakeTravelerNames[i%len(fakeTravelerNames)]
+	}
+	if t.Insurance != nil {
+		t.Insurance = &bt.Insurance{
+			Provider:       "Example Travel Insurance",
+			PolicyNumber:   "POL-" + fakeCode(t.Insurance.PolicyNumber, 8),
+			Coverage:       t.Insurance.Coverage,
+			EmergencyPhone: "+1 555 0100",
+		}
+	}
+
+	for _, tr := range snapshot.Transportations {
+		tr.Departure = shiftDate(tr.Departure, shift)
+		tr.Arrival = shiftDate(tr.Arrival, shift)
+		tr.Metadata = anonymizeMetadata(tr.Metadata)
+		anonymizeSplit(&tr.PaidBy, &tr.SplitAmong, fakeNames)
+		tr.Attachments = nil
+		tr.AttachmentReferences = nil
+	}
+	for _, l := range snapshot.Lodgings {
+		l.StartDate = shiftDate(l.StartDate, shift)
+		l.EndDate = shiftDate(l.EndDate, shift)
+		l.ConfirmationCode = anonymizeCode(l.ConfirmationCode)
+		l.Metadata = anonymizeMetadata(l.Metadata)
+		anonymizeSplit(&l.PaidBy, &l.SplitAmong, fakeNames)
+		l.Attachments = nil
+		l.AttachmentReferences = nil
+	}
+	for _, a := range snapshot.Activities {
+		a.StartDate = shiftDate(a.StartDate, shift)
+		a.EndDate = shiftDate(a.EndDate, shift)
+		a.ConfirmationCode = anonymizeCode(a.ConfirmationCode)
+		a.Metadata = anonymizeMetadata(a.Metadata)
+		anonymizeSplit(&a.PaidBy, &a.SplitAmong, fakeNames)
+		a.Attachments = nil
+		a.AttachmentReferences = nil
+	}
+	for _, r := range snapshot.Rentals {
+		r.PickupTime = shiftDate(r.PickupTime, shift)
+		r.ReturnTime = shiftDate(r.ReturnTime, shift)
+	}
+	for _, r := range snapshot.CarRentals {
+		r.PickupTime = shiftDate(r.PickupTime, shift)
+		r.DropoffTime = shiftDate(r.DropoffTime, shift)
+		r.ConfirmationCode = anonymizeCode(r.ConfirmationCode)
+		r.Metadata = anonymizeMetadata(r.Metadata)
+		r.Notes = ""
+		r.AttachmentReferences = nil
+	}
+	for _, d := range snapshot.Dining {
+		d.ReservationTime = shiftDate(d.ReservationTime, shift)
+		d.ConfirmationCode = anonymizeCode(d.ConfirmationCode)
+		d.Metadata = anonymizeMetadata(d.Metadata)
+		d.Notes = ""
+		d.AttachmentReferences = nil
+	}
+	for _, x := range snapshot.Expenses {
+		x.OccurredOn = shiftDate(x.OccurredOn, shift)
+		anonymizeSplit(&x.PaidBy, &x.SplitAmong, fakeNames)
+		x.Notes = ""
+		x.AttachmentReferences = nil
+	}
+	snapshot.Attachments = nil
+}
+
+// CloneAnonymizedTrip creates an anonymized copy of the trip owned by ownerId.
+// A zero shiftDays moves the copy to start 30 days from today.
+func CloneAnonymizedTrip(app core.App, trip *core.Record, ownerId string, shiftDays int) (string, error) {
+	snapshot := TripSnapshot(app, trip)
+
+	shift := time.Duration(shiftDays) * 24 * time.Hour
+	if shiftDays == 0 && !snapshot.Trip.StartDate.IsZero() {
+		target := time.Now().UTC().AddDate(0, 0, 30)
+		shift = target.Sub(snapshot.Trip.StartDate.Time()).Truncate(24 * time.Hour)
+	}
+
+	AnonymizeSnapshot(snapshot, shift)
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", err
+	}
+	return tj.ImportJsonFile(app, data, ownerId)
+}
+
+func shiftDate(date types.DateTime, shift time.Duration) types.DateTime {
+	if date.IsZero() {
+		return date
+	}
+	return date.Add(shift)
+}
+
+func anonymizeCode(code string) string {
+	if code == "" {
+		return ""
+	}
+	return fakeCode(code, 6)
+}
+
+// fakeCode derives an uppercase code from the original value so the same
+// input always maps to the same fake within a snapshot
+func fakeCode(seed string, length int) string {
+	const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(seed))
+	value := hash.Sum64()
+
+	code := make([]byte, length)
+	for i := range code {
+		code[i] = alphabet[value%uint64(len(alphabet))]
+		value = value/uint64(len(alphabet)) + uint64(i)*7919
+	}
+	return string(code)
+}
+
+func anonymizeMetadata(metadata map[string]any) map[string]any {
+	for key, value := range metadata {
+		if nested, ok := value.(map[string]any); ok {
+			metadata[key] = anonymizeMetadata(nested)
+			continue
+		}
+		if !isSensitiveKey(key) {
+			continue
+		}
+		if text, ok := value.(string); ok && text != "" {
+			metadata[key] = fakeCode(text, 6)
+		} else {
+			delete(metadata, key)
+		}
+	}
+	return metadata
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveMetadataKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// anonymizeSplit renames the payer and the parts of an expense or item like
+// the participants. Names that are not participants leave it unsplit.
+func anonymizeSplit(paidBy *string, splits *[]bt.ExpenseSplit, fakeNames map[string]string) {
+	if *paidBy == "" {
+		return
+	}
+	fake, ok := fakeNames[*paidBy]
+	for i := range *splits {
+		name, known := fakeNames[(*splits)[i].Participant]
+		ok = ok && known
+		(*splits)[i].Participant = name
+	}
+	if !ok {
+		*paidBy, *splits = "", nil
+		return
+	}
+	*paidBy = fake
+}
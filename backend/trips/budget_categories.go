@@ -0,0 +1,192 @@
+package trips
+
+import (
+	"backend/currency"
+	bt "backend/types"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Categories the budget of a trip can be split into
+const (
+	BudgetLodging    = "lodging"
+	BudgetTransport  = "transport"
+	BudgetFood       = "food"
+	BudgetActivities = "activities"
+	BudgetOther      = "other"
+)
+
+var BudgetCategories = []string{BudgetLodging, BudgetTransport, BudgetFood, BudgetActivities, BudgetOther}
+
+// the category the costs of each kind of item count towards, expenses go by
+// their own category
+var collectionBudgetCategories = map[string]string{
+	"transportations":   BudgetTransport,
+	"car_rentals":       BudgetTransport,
+	"lodgings":          BudgetLodging,
+	"dining":            BudgetFood,
+	"activities":        BudgetActivities,
+	"equipment_rentals": BudgetActivities,
+}
+
+// ExpenseBudgetCategory is the category of the budget an expense of the
+// given category counts towards
+func ExpenseBudgetCategory(category string) string {
+	switch strings.ToLower(strings.TrimSpace(category)) {
+	case "lodging":
+		return BudgetLodging
+	case "transportation", "transport":
+		return BudgetTransport
+	case "food":
+		return BudgetFood
+	case "activities", "entertainment":
+		return BudgetActivities
+	default:
+		return BudgetOther
+	}
+}
+
+// BudgetCategoryErrors checks the category budgets of a trip
+func BudgetCategoryErrors(categories map[string]float64) []string {
+	problems := make([]string, 0)
+	for _, category := range slices.Sorted(maps.Keys(categories)) {
+		amount := categories[category]
+		switch {
+		case !slices.Contains(BudgetCategories, category):
+			problems = append(problems, fmt.Sprintf("%s is not a budget category, use one of %s", category, strings.Join(BudgetCategories, ", ")))
+		case amount < 0 || math.IsNaN(amount) || math.IsInf(amount, 0):
+			problems = append(problems, fmt.Sprintf("the budget for %s cannot be negative", category))
+		}
+	}
+	return problems
+}
+
+// SpendByCategory adds up the costs of the trip per category of the budget,
+// in the budget currency at the rates locked when they were booked. Items
+// whose cost was moved to an expense count once, through the expense. Items
+// the user may not see are left out, as are the private costs, unless
+// includePrivate is set.
+func SpendByCategory(app core.App, trip *core.Record, includePrivate bool, rates map[string]float64) (*bt.BudgetCategories, error) {
+	var budget bt.Cost
+	_ = trip.UnmarshalJSONField("budget", &budget)
+	if budget.Currency == "" {
+		return nil, ErrNoBudgetCurrency
+	}
+	code := budget.Currency
+	var allocated map[string]float64
+	_ = trip.UnmarshalJSONField("budgetCategories", &allocated)
+
+	report := &bt.BudgetCategories{
+		TripId:     trip.Id,
+		Currency:   code,
+		Allocated:  bt.Cost{Currency: code},
+		Spent:      bt.Cost{Currency: code},
+		Categories: make([]bt.CategorySpend, 0, len(BudgetCategories)),
+		Overruns:   make([]string, 0),
+	}
+	if budget.Value > 0 {
+		report.Budget = &budget
+	}
+
+	spent := make(map[string]float64)
+	items := make(map[string]int)
+	unconverted, err := eachTripCost(app, trip, includePrivate, code, rates, func(record *core.Record, converted bt.Cost) {
+		collection := record.Collection().Name
+		category := collectionBudgetCategories[collection]
+		if collection == "trip_expenses" {
+			category = ExpenseBudgetCategory(record.GetString("category"))
+		}
+		if category == "" {
+			category = BudgetOther
+		}
+		spent[category] += converted.Value
+		items[category]++
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Unconverted = unconverted
+
+	for _, category := range BudgetCategories {
+		amount, budgeted := allocated[category]
+		if !budgeted && items[category] == 0 {
+			continue
+		}
+		line := bt.CategorySpend{
+			Category: category,
+			Spent:    bt.Cost{Value: currency.Round(spent[category], code), Currency: code},
+			Items:    items[category],
+		}
+		if budgeted {
+			line.Budget = &bt.Cost{Value: amount, Currency: code}
+			line.Remaining = &bt.Cost{Value: currency.Round(amount-line.Spent.Value, code), Currency: code}
+			if amount > 0 {
+				line.Percent = int(math.Round(line.Spent.Value / amount * 100))
+			}
+			line.Overrun = line.Spent.Value > amount
+			report.Allocated.Value += amount
+		}
+		if line.Overrun {
+			report.Overruns = append(report.Overruns, category)
+		}
+		report.Spent.Value += spent[category]
+		report.Categories = append(report.Categories, line)
+	}
+
+	report.Allocated.Value = currency.Round(report.Allocated.Value, code)
+	report.Spent.Value = currency.Round(report.Spent.Value, code)
+	if report.Budget != nil {
+		report.OverAllocated = report.Allocated.Value > report.Budget.Value
+		report.Overrun = report.Spent.Value > report.Budget.Value
+	}
+	return report, nil
+}
+
+// eachTripCost visits the records of the trip with a cost, converted to code
+// at the rate locked when they were booked, and returns how many could not
+// be converted. Items whose cost was moved to an expense are visited once,
+// through the expense. Items the user may not see are left out, as are the
+// private costs, unless includePrivate is set.
+func eachTripCost(app core.App, trip *core.Record, includePrivate bool, code string, rates map[string]float64, visit func(record *core.Record, converted bt.Cost)) (int, error) {
+	unconverted := 0
+	expenseIds := make(map[string]bool)
+	// the expenses go first, the items that point to one are skipped
+	collections := append([]string{"trip_expenses"}, slices.DeleteFunc(slices.Clone(CostCollections), func(collection string) bool {
+		return collection == "trip_expenses"
+	})...)
+	for _, collection := range collections {
+		records, err := app.FindAllRecords(collection, dbx.HashExp{"trip": trip.Id})
+		if err != nil {
+			return unconverted, err
+		}
+		for _, record := range records {
+			if collection == "trip_expenses" {
+				expenseIds[record.Id] = true
+			} else if expenseIds[record.GetString("expenseId")] {
+				continue
+			}
+			if !includePrivate && !RedactRecord(record) {
+				continue
+			}
+			var cost *bt.Cost
+			if record.UnmarshalJSONField("cost", &cost) != nil || cost == nil || cost.Currency == "" || cost.Value == 0 {
+				continue
+			}
+			var locked *bt.ExchangeRate
+			_ = record.UnmarshalJSONField("exchangeRate", &locked)
+			converted, ok := ConvertCost(cost, locked, code, rates)
+			if !ok {
+				unconverted++
+				continue
+			}
+			visit(record, *converted)
+		}
+	}
+	return unconverted, nil
+}
@@ -0,0 +1,125 @@
+package trips
+
+import (
+	bt "backend/types"
+	"regexp"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// CommentCollections are the trip items that can be discussed
+var CommentCollections = []string{"activities", "lodgings", "transportations"}
+
+// a mention is an @ at the start of a word followed by a name, or a full
+// email address
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@])@([\p{L}\p{N}_.+-]+(?:@[\p{L}\p{N}-]+(?:\.[\p{L}\p{N}-]+)+)?)`)
+
+// TripMembers returns the owner and the collaborators of the trip
+func TripMembers(app core.App, trip *core.Record) ([]*core.Record, error) {
+	ids := append([]string{trip.GetString("ownerId")}, trip.GetStringSlice("collaborators")...)
+	return app.FindRecordsByIds("users", ids)
+}
+
+// ParseMentions finds the members @mentioned in a comment. A mention is the
+// email address of a member, the part before the @, the name written without
+// spaces or the first name. When a first name is shared by several members
+// none of them is mentioned by it.
+func ParseMentions(body string, members []*core.Record) []string {
+	mentioned := make([]string, 0)
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		handle := strings.ToLower(strings.TrimRight(match[1], ".-"))
+		for _, member := range mentionedMembers(handle, members) {
+			if !seen[member.Id] {
+				seen[member.Id] = true
+				mentioned = append(mentioned, member.Id)
+			}
+		}
+	}
+	return mentioned
+}
+
+// mentionedMembers tries the ways to mention someone from the most to the
+// least precise, the first that matches only one member wins
+func mentionedMembers(handle string, members []*core.Record) []*core.Record {
+	handles := []func(member *core.Record) string{
+		func(member *core.Record) string { return strings.ToLower(member.Email()) },
+		func(member *core.Record) string {
+			local, _, _ := strings.Cut(strings.ToLower(member.Email()), "@")
+			return local
+		},
+		func(member *core.Record) string {
+			return strings.ToLower(strings.Join(strings.Fields(member.GetString("name")), ""))
+		},
+		func(member *core.Record) string {
+			fields := strings.Fields(strings.ToLower(member.GetString("name")))
+			if len(fields) == 0 {
+				return ""
+			}
+			return fields[0]
+		},
+	}
+	for _, memberHandle := range handles {
+		matches := make([]*core.Record, 0)
+		for _, member := range members {
+			if h := memberHandle(member); h != "" && h == handle {
+				matches = append(matches, member)
+			}
+		}
+		if len(matches) == 1 {
+			return matches
+		}
+	}
+	return nil
+}
+
+// CommentedItem returns the item a comment is about, when it belongs to the
+// trip and the role may see it
+func CommentedItem(app core.App, trip *core.Record, collection string, recordId string, role string) (*core.Record, bool) {
+	known := false
+	for _, name := range CommentCollections {
+		known = known || name == collection
+	}
+	if !known || recordId == "" {
+		return nil, false
+	}
+	item, err := app.FindRecordById(collection, recordId)
+	if err != nil || item.GetString("trip") != trip.Id {
+		return nil, false
+	}
+	if ItemPrivacy(item).Item && !SeesPrivate(role) {
+		return nil, false
+	}
+	return item, true
+}
+
+// ItemCommenters returns who already took part in the discussion of an item
+func ItemCommenters(app core.App, item *core.Record) ([]string, error) {
+	var authors []string
+	err := app.RecordQuery("comments").
+		Select("author").
+		Distinct(true).
+		AndWhere(dbx.HashExp{"trip": item.GetString("trip"), "collection": item.Collection().Name, "recordId": item.Id}).
+		Column(&authors)
+	return authors, err
+}
+
+// CommentView is the comment as the comment routes show it
+func CommentView(comment *core.Record, authors map[string]*core.Record) bt.Comment {
+	view := bt.Comment{
+		Id:         comment.Id,
+		Collection: comment.GetString("collection"),
+		RecordId:   comment.GetString("recordId"),
+		Author:     bt.CommentAuthor{Id: comment.GetString("author")},
+		Body:       comment.GetString("body"),
+		Mentions:   comment.GetStringSlice("mentions"),
+		Created:    comment.GetDateTime("created"),
+		EditedAt:   comment.GetDateTime("editedAt"),
+	}
+	if author, ok := authors[view.Author.Id]; ok {
+		view.Author.Name = author.GetString("name")
+	}
+	return view
+}
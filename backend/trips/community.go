@@ -0,0 +1,62 @@
+package trips
+
+import (
+	bt "backend/types"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// lodging types that are someone's home rather than a business, their name
+// and location stay on the instance
+var privateLodgingTypes = map[string]bool{
+	"home":            true,
+	"vacation_rental": true,
+}
+
+// CommunityTemplate turns a trip into a template fit to share with other
+// instances: private items, notes, room names and anything in the metadata
+// that looks like a booking or a traveler are left out, as are the address
+// and location of homes and rentals
+func CommunityTemplate(app core.App, trip *core.Record) *bt.TripTemplate {
+	template := BuildTripTemplate(app, trip, RoleViewer)
+	template.Notes = ""
+	for i := range template.Destinations {
+		template.Destinations[i].Id = ""
+	}
+
+	for _, t := range template.Transportations {
+		t.Metadata = withoutSensitiveMetadata(t.Metadata)
+	}
+	for _, l := range template.Lodgings {
+		l.Metadata = withoutSensitiveMetadata(l.Metadata)
+		for i := range l.Rooms {
+			l.Rooms[i].Name = ""
+		}
+		if privateLodgingTypes[l.Type] {
+			l.Address = ""
+			delete(l.Metadata, "place")
+			if l.Type == "home" {
+				l.Name = ""
+			}
+		}
+	}
+	for _, a := range template.Activities {
+		a.Metadata = withoutSensitiveMetadata(a.Metadata)
+	}
+	return template
+}
+
+// withoutSensitiveMetadata drops the metadata keys that usually hold
+// personal or booking data, at any depth
+func withoutSensitiveMetadata(metadata map[string]any) map[string]any {
+	for key, value := range metadata {
+		if isSensitiveKey(key) {
+			delete(metadata, key)
+			continue
+		}
+		if nested, ok := value.(map[string]any); ok {
+			metadata[key] = withoutSensitiveMetadata(nested)
+		}
+	}
+	return metadata
+}
@@ -0,0 +1,136 @@
+package trips
+
+import (
+	bt "backend/types"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// VersionedCollections are the items updates of which can name the version
+// they were made from, see CheckRecordVersion
+var VersionedCollections = []string{"activities", "lodgings", "transportations"}
+
+// RecordVersion is the version of a record, the time it was last updated
+func RecordVersion(record *core.Record) string {
+	return record.GetDateTime("updated").String()
+}
+
+// ETag is the entity tag of the version of a record. It is the quoted
+// updated time, so clients can send it in If-Match from the record alone.
+func ETag(record *core.Record) string {
+	return `"` + RecordVersion(record) + `"`
+}
+
+// MatchesETag tells whether an If-Match header names the current version
+// of the record. Weak tags and bare updated times are accepted as well.
+func MatchesETag(header string, record *core.Record) bool {
+	current := RecordVersion(record)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.Trim(strings.TrimPrefix(tag, "W/"), `"`) == current {
+			return true
+		}
+	}
+	return false
+}
+
+// ETagVersion reads the time of the version an If-Match header names, the
+// first one when it names several
+func ETagVersion(header string) (time.Time, bool) {
+	tag, _, _ := strings.Cut(header, ",")
+	tag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(tag), "W/"), `"`)
+	version, err := types.ParseDateTime(tag)
+	if err != nil || version.IsZero() {
+		return time.Time{}, false
+	}
+	return version.Time(), true
+}
+
+// RecordConflict compares the changes made to the stored record after the
+// version read at since with the ones proposed, nil for a delete. The
+// changes made since come from the activity log, redacted for the role.
+// When the log does not reach back that far every proposed field conflicts.
+func RecordConflict(app core.App, stored *core.Record, proposed *core.Record, since time.Time, role string) *bt.RecordConflict {
+	conflict := &bt.RecordConflict{
+		Collection: stored.Collection().Name,
+		RecordId:   stored.Id,
+		Version:    RecordVersion(stored),
+		ETag:       ETag(stored),
+		ChangedBy:  []bt.FeedActor{},
+		Theirs:     []bt.FieldChange{},
+		Yours:      []bt.FieldChange{},
+		Conflicts:  []string{},
+		Merged:     map[string]any{},
+	}
+
+	after, _ := types.ParseDateTime(since)
+	events, err := app.FindRecordsByFilter("trip_events", "collection = {:collection} && recordId = {:recordId} && version > {:after}",
+		"version", 0, 0, dbx.Params{"collection": conflict.Collection, "recordId": stored.Id, "after": after.String()})
+	if err != nil {
+		events = nil
+	}
+
+	actors := make([]string, 0)
+	theirs := make(map[string]int)
+	for _, event := range events {
+		if !EventVisible(event, role) {
+			continue
+		}
+		if actor := event.GetString("actor"); actor != "" && !slices.Contains(actors, actor) {
+			actors = append(actors, actor)
+		}
+		var changes []bt.FieldChange
+		_ = event.UnmarshalJSONField("changes", &changes)
+		for _, change := range RedactEventChanges(event, role, changes) {
+			// one change per field, from before the first to after the last
+			if i, ok := theirs[change.Field]; ok {
+				merged := &conflict.Theirs[i]
+				merged.To = change.To
+				merged.Truncated = merged.Truncated || change.Truncated
+				merged.Redacted = merged.Redacted || change.Redacted
+				continue
+			}
+			theirs[change.Field] = len(conflict.Theirs)
+			conflict.Theirs = append(conflict.Theirs, change)
+		}
+	}
+	if users, err := app.FindRecordsByIds("users", actors); err == nil {
+		for _, user := range users {
+			conflict.ChangedBy = append(conflict.ChangedBy, bt.FeedActor{Type: "user", Id: user.Id, Name: user.GetString("name")})
+		}
+	}
+
+	if proposed == nil {
+		return conflict
+	}
+	conflict.Yours = RecordChanges(stored, proposed)
+	for _, change := range conflict.Yours {
+		i, changed := theirs[change.Field]
+		if len(events) == 0 || changed && !sameChangeValue(conflict.Theirs[i], change) {
+			conflict.Conflicts = append(conflict.Conflicts, change.Field)
+			continue
+		}
+		conflict.Merged[change.Field] = proposed.Get(change.Field)
+	}
+	return conflict
+}
+
+// sameChangeValue tells whether both changes leave the field with the same
+// value, in which case they do not conflict
+func sameChangeValue(theirs bt.FieldChange, yours bt.FieldChange) bool {
+	if theirs.Truncated || theirs.Redacted || yours.Truncated {
+		return false
+	}
+	a, _ := json.Marshal(theirs.To)
+	b, _ := json.Marshal(yours.To)
+	return string(a) == string(b)
+}
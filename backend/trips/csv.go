@@ -0,0 +1,198 @@
+package trips
+
+import (
+	"backend/currency"
+	bt "backend/types"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const csvTimeLayout = "2006-01-02 15:04"
+
+var ErrUnknownCSVKind = errors.New("unknown export, use activities, lodgings, transportations or expenses")
+
+// CSVExport selects what goes into a CSV export. From and To are inclusive
+// days compared with the local start date of each item, zero means open.
+// No columns means all of them.
+type CSVExport struct {
+	Kind    string
+	Columns []string
+	From    time.Time
+	To      time.Time
+}
+
+type csvRow struct {
+	start  types.DateTime
+	values map[string]string
+}
+
+// CSVColumns lists the columns available for each kind of export, in the
+// order they are written by default
+var CSVColumns = map[string][]string{
+	"transportations": {"type", "provider", "origin", "destination", "departure", "arrival", "reservation", "cost", "currency"},
+	"lodgings":        {"type", "name", "address", "checkIn", "checkOut", "confirmationCode", "cost", "currency"},
+	"activities":      {"name", "address", "start", "end", "confirmationCode", "cost", "currency", "description"},
+	"expenses":        {"name", "category", "occurredOn", "cost", "currency", "convertedCost", "convertedCurrency", "exchangeRate", "notes"},
+}
+
+// WriteTripCSV writes one kind of trip item as CSV with a header row, sorted
+// by date. Private items and fields are left out unless the role is the owner.
+func WriteTripCSV(app core.App, trip *core.Record, role string, export CSVExport, out io.Writer) error {
+	available, ok := CSVColumns[export.Kind]
+	if !ok {
+		return ErrUnknownCSVKind
+	}
+
+	columns := export.Columns
+	if len(columns) == 0 {
+		columns = available
+	}
+	for _, column := range columns {
+		if !slices.Contains(available, column) {
+			return fmt.Errorf("unknown column %s, %s has %s", column, export.Kind, strings.Join(available, ", "))
+		}
+	}
+
+	items := bt.ExportedTrip{}
+	switch export.Kind {
+	case "transportations":
+		items.Transportations = exportTransportations(app, trip)
+	case "lodgings":
+		items.Lodgings = exportLodgings(app, trip)
+	case "activities":
+		items.Activities = exportActivities(app, trip)
+	case "expenses":
+		items.Expenses = exportExpenses(app, trip)
+	}
+	if !SeesPrivate(role) {
+		RedactExport(&items)
+	}
+
+	rows := make([]csvRow, 0)
+	for _, row := range csvRows(items) {
+		if inCSVRange(row.start, export.From, export.To) {
+			rows = append(rows, row)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].start.Time().Before(rows[j].start.Time())
+	})
+
+	writer := csv.NewWriter(out)
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := make([]string, 0, len(columns))
+		for _, column := range columns {
+			record = append(record, row.values[column])
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func csvRows(items bt.ExportedTrip) []csvRow {
+	rows := make([]csvRow, 0)
+	for _, t := range items.Transportations {
+		rows = append(rows, csvRow{start: t.Departure, values: withCost(map[string]string{
+			"type":        t.Type,
+			"provider":    metadataString(t.Metadata, "provider"),
+			"origin":      t.Origin,
+			"destination": t.Destination,
+			"departure":   csvTime(t.Departure),
+			"arrival":     csvTime(t.Arrival),
+			"reservation": metadataString(t.Metadata, "reservation"),
+		}, t.Cost)})
+	}
+	for _, l := range items.Lodgings {
+		rows = append(rows, csvRow{start: l.StartDate, values: withCost(map[string]string{
+			"type":             l.Type,
+			"name":             l.Name,
+			"address":          l.Address,
+			"checkIn":          csvTime(l.StartDate),
+			"checkOut":         csvTime(l.EndDate),
+			"confirmationCode": l.ConfirmationCode,
+		}, l.Cost)})
+	}
+	for _, a := range items.Activities {
+		rows = append(rows, csvRow{start: a.StartDate, values: withCost(map[string]string{
+			"name":             a.Name,
+			"address":          a.Address,
+			"start":            csvTime(a.StartDate),
+			"end":              csvTime(a.EndDate),
+			"confirmationCode": a.ConfirmationCode,
+			"description":      a.Description,
+		}, a.Cost)})
+	}
+	for _, x := range items.Expenses {
+		values := withCost(map[string]string{
+			"name":       x.Name,
+			"category":   x.Category,
+			"occurredOn": csvTime(x.OccurredOn),
+			"notes":      x.Notes,
+		}, x.Cost)
+		// the amount counted against the budget, at the rate locked for it
+		if x.Cost != nil && x.ExchangeRate != nil && x.ExchangeRate.From == x.Cost.Currency {
+			converted := currency.Round(x.Cost.Value*x.ExchangeRate.Rate, x.ExchangeRate.To)
+			values["convertedCost"] = strconv.FormatFloat(converted, 'f', currency.Decimals(x.ExchangeRate.To), 64)
+			values["convertedCurrency"] = x.ExchangeRate.To
+			values["exchangeRate"] = strconv.FormatFloat(x.ExchangeRate.Rate, 'f', -1, 64)
+		}
+		rows = append(rows, csvRow{start: x.OccurredOn, values: values})
+	}
+	return rows
+}
+
+// withCost adds the cost as a plain number so spreadsheets can sum it
+func withCost(values map[string]string, cost *bt.Cost) map[string]string {
+	if cost != nil && cost.Currency != "" {
+		values["cost"] = strconv.FormatFloat(currency.Round(cost.Value, cost.Currency), 'f', currency.Decimals(cost.Currency), 64)
+		values["currency"] = cost.Currency
+	}
+	return values
+}
+
+func csvTime(dt types.DateTime) string {
+	if dt.IsZero() {
+		return ""
+	}
+	return dt.Time().Format(csvTimeLayout)
+}
+
+func inCSVRange(start types.DateTime, from time.Time, to time.Time) bool {
+	if from.IsZero() && to.IsZero() {
+		return true
+	}
+	if start.IsZero() {
+		return false
+	}
+	day := start.Time().Format(time.DateOnly)
+	if !from.IsZero() && day < from.Format(time.DateOnly) {
+		return false
+	}
+	if !to.IsZero() && day > to.Format(time.DateOnly) {
+		return false
+	}
+	return true
+}
+
+func metadataString(metadata map[string]any, key string) string {
+	if value, ok := metadata[key].(string); ok {
+		return value
+	}
+	return ""
+}
@@ -0,0 +1,138 @@
+package trips
+
+import (
+	"backend/currency"
+	bt "backend/types"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// maxSpendDays caps the days of a trip listed one by one
+const maxSpendDays = 366
+
+// costDateFields are the fields the cost of each kind of item falls on. A
+// second field ends the nights or days a stay or a rental is spread over.
+var costDateFields = map[string][2]string{
+	"trip_expenses":     {"occurredOn", ""},
+	"transportations":   {"departureTime", ""},
+	"lodgings":          {"startDate", "endDate"},
+	"activities":        {"startDate", ""},
+	"dining":            {"reservationTime", ""},
+	"car_rentals":       {"pickupTime", "dropoffTime"},
+	"equipment_rentals": {"pickupTime", "returnTime"},
+}
+
+// DailySpend adds up the costs of the trip per calendar day, in the budget
+// currency at the rates locked when they were booked. Times are local wall
+// clock times, so the day is the one printed on the booking. Items whose cost
+// was moved to an expense count once, through the expense. Items the user
+// may not see are left out, as are the private costs, unless includePrivate
+// is set.
+func DailySpend(app core.App, trip *core.Record, includePrivate bool, rates map[string]float64) (*bt.DailySpend, error) {
+	var budget bt.Cost
+	_ = trip.UnmarshalJSONField("budget", &budget)
+	if budget.Currency == "" {
+		return nil, ErrNoBudgetCurrency
+	}
+	code := budget.Currency
+
+	spent := make(map[string]float64)
+	items := make(map[string]int)
+	undated := 0.0
+	unconverted, err := eachTripCost(app, trip, includePrivate, code, rates, func(record *core.Record, converted bt.Cost) {
+		days := costDays(record)
+		if len(days) == 0 {
+			undated += converted.Value
+			return
+		}
+		for _, day := range days {
+			spent[day] += converted.Value / float64(len(days))
+			items[day]++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tripDays := spanDays(trip.GetDateTime("startDate").Time(), trip.GetDateTime("endDate").Time(), true)
+	inTrip := make(map[string]bool, len(tripDays))
+	for _, day := range tripDays {
+		inTrip[day] = true
+		if _, ok := spent[day]; !ok {
+			spent[day] = 0
+		}
+	}
+
+	report := &bt.DailySpend{
+		TripId:      trip.Id,
+		Currency:    code,
+		Days:        make([]bt.DaySpend, 0, len(spent)),
+		Total:       bt.Cost{Currency: code},
+		Undated:     bt.Cost{Value: currency.Round(undated, code), Currency: code},
+		Unconverted: unconverted,
+	}
+	if budget.Value > 0 {
+		report.Budget = &budget
+	}
+
+	total, duringTrip := undated, 0.0
+	for _, day := range slices.Sorted(maps.Keys(spent)) {
+		total += spent[day]
+		if inTrip[day] {
+			duringTrip += spent[day]
+		}
+		report.Days = append(report.Days, bt.DaySpend{
+			Date:       day,
+			Spent:      bt.Cost{Value: currency.Round(spent[day], code), Currency: code},
+			Cumulative: bt.Cost{Value: currency.Round(total-undated, code), Currency: code},
+			Items:      items[day],
+			InTrip:     inTrip[day],
+		})
+	}
+	report.Total.Value = currency.Round(total, code)
+	if len(tripDays) > 0 {
+		report.AveragePerDay = &bt.Cost{Value: currency.Round(duringTrip/float64(len(tripDays)), code), Currency: code}
+	}
+	return report, nil
+}
+
+// costDays are the days the cost of a record falls on: the day it happens,
+// or the nights of a stay and the days of a rental, none without a date
+func costDays(record *core.Record) []string {
+	fields, ok := costDateFields[record.Collection().Name]
+	if !ok {
+		return nil
+	}
+	start := record.GetDateTime(fields[0])
+	if start.IsZero() {
+		return nil
+	}
+	if fields[1] == "" {
+		return []string{start.Time().Format(time.DateOnly)}
+	}
+	return spanDays(start.Time(), record.GetDateTime(fields[1]).Time(), false)
+}
+
+// spanDays lists the calendar days from start to end, including the last
+// one when inclusive. A missing or early end leaves the first day only.
+func spanDays(start time.Time, end time.Time, inclusive bool) []string {
+	if start.IsZero() {
+		return nil
+	}
+	first := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	days := []string{first.Format(time.DateOnly)}
+	if end.IsZero() {
+		return days
+	}
+	last := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+	if !inclusive {
+		last = last.AddDate(0, 0, -1)
+	}
+	for day := first.AddDate(0, 0, 1); !day.After(last) && len(days) < maxSpendDays; day = day.AddDate(0, 0, 1) {
+		days = append(days, day.Format(time.DateOnly))
+	}
+	return days
+}
@@ -0,0 +1,306 @@
+package trips
+
+import (
+	"archive/zip"
+	bt "backend/types"
+	"encoding/json"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	debugBundleTurns = 20
+	debugBundleLogs  = 200
+	debugBundleDays  = 3
+)
+
+type debugManifest struct {
+	Version     bt.VersionInfo `json:"version"`
+	TripId      string         `json:"tripId"`
+	GeneratedAt types.DateTime `json:"generatedAt"`
+	Files       []string       `json:"files"`
+}
+
+// WriteDebugBundle writes a zip archive with an anonymized snapshot of the
+// trip, its recent assistant turns and the server logs that mention it, so
+// users can attach it to bug reports without leaking personal details. The
+// turns get the same fake names and codes as the snapshot.
+func WriteDebugBundle(app core.App, trip *core.Record, version bt.VersionInfo, out io.Writer) error {
+
+	snapshot := TripSnapshot(app, trip)
+	redactor := newTextRedactor(app, trip, snapshot)
+	AnonymizeSnapshot(snapshot, 0)
+	redactor.replace(trip.GetString("name"), snapshot.Trip.Name)
+
+	files := map[string]interface{}{
+		"trip.json":              snapshot,
+		"assistant_actions.json": debugAssistantActions(app, trip, redactor),
+		"assistant_sources.json": debugAssistantSources(app, trip, redactor),
+		"logs.json":              debugLogs(app, trip),
+	}
+
+	manifest := debugManifest{
+		Version:     version,
+		TripId:      trip.Id,
+		GeneratedAt: types.NowDateTime(),
+		Files:       []string{"trip.json", "assistant_actions.json", "assistant_sources.json", "logs.json"},
+	}
+	files["manifest.json"] = manifest
+
+	zipWriter := zip.NewWriter(out)
+	for _, name := range append([]string{"manifest.json"}, manifest.Files...) {
+		data, err := json.MarshalIndent(files[name], "", " ")
+		if err != nil {
+			return err
+		}
+		entry, err := zipWriter.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return zipWriter.Close()
+}
+
+// debugAssistantActions returns the recent turns of the assistant that
+// proposed a change, with what it said about them
+func debugAssistantActions(app core.App, trip *core.Record, redactor *textRedactor) []map[string]any {
+	records, err := app.FindRecordsByFilter("assistant_actions", "trip = {:tripId}", "-created", debugBundleTurns, 0, dbx.Params{"tripId": trip.Id})
+	if err != nil {
+		return nil
+	}
+
+	actions := make([]map[string]any, 0, len(records))
+	for _, record := range records {
+		var arguments map[string]any
+		_ = record.UnmarshalJSONField("arguments", &arguments)
+
+		actions = append(actions, map[string]any{
+			"proposalId":     record.GetString("proposalId"),
+			"tool":           record.GetString("tool"),
+			"arguments":      redactor.value(anonymizeMetadata(arguments)),
+			"summary":        redactor.text(record.GetString("summary")),
+			"status":         record.GetString("status"),
+			"resultRecordId": record.GetString("resultRecordId"),
+			"message":        redactor.text(record.GetString("message")),
+			"created":        record.GetDateTime("created"),
+		})
+	}
+	return actions
+}
+
+// debugAssistantSources returns the recent turns of the assistant that
+// looked something up, with what it searched for
+func debugAssistantSources(app core.App, trip *core.Record, redactor *textRedactor) []map[string]any {
+	records, err := app.FindRecordsByFilter("assistant_tool_results", "trip = {:tripId}", "-created", debugBundleTurns, 0, dbx.Params{"tripId": trip.Id})
+	if err != nil {
+		return nil
+	}
+
+	results := make([]map[string]any, 0, len(records))
+	for _, record := range records {
+		var sources any
+		_ = record.UnmarshalJSONField("sources", &sources)
+
+		results = append(results, map[string]any{
+			"turnId":  record.GetString("turnId"),
+			"tool":    record.GetString("tool"),
+			"query":   redactor.text(record.GetString("query")),
+			"sources": sources,
+			"created": record.GetDateTime("created"),
+		})
+	}
+	return results
+}
+
+// debugLogs returns the recent logs of the trip with every text in their data
+// replaced by a fake code, error messages and record names can hold the
+// personal details the snapshot leaves out. The same text always maps to the
+// same code so related entries can still be matched up.
+func debugLogs(app core.App, trip *core.Record) []map[string]any {
+	logs := make([]*core.Log, 0)
+	since := time.Now().UTC().AddDate(0, 0, -debugBundleDays)
+
+	err := app.LogQuery().
+		AndWhere(dbx.NewExp("json_extract(data, '$.tripId') = {:tripId}", dbx.Params{"tripId": trip.Id})).
+		AndWhere(dbx.NewExp("created >= {:since}", dbx.Params{"since": since.Format(types.DefaultDateLayout)})).
+		OrderBy("created DESC").
+		Limit(debugBundleLogs).
+		All(&logs)
+	if err != nil {
+		app.Logger().Warn("Unable to read logs for debug bundle", "error", err, "tripId", trip.Id)
+	}
+
+	entries := make([]map[string]any, 0, len(logs))
+	for _, log := range logs {
+		entries = append(entries, map[string]any{
+			"level":   log.Level,
+			"message": log.Message,
+			"data":    anonymizeLogData(log.Data),
+			"created": log.Created,
+		})
+	}
+	return entries
+}
+
+func anonymizeLogData(data map[string]any) map[string]any {
+	anonymized := make(map[string]any, len(data))
+	for key, value := range data {
+		if text, ok := value.(string); ok && key == "tripId" {
+			anonymized[key] = text
+			continue
+		}
+		anonymized[key] = anonymizeLogValue(value)
+	}
+	return anonymized
+}
+
+func anonymizeLogValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		return anonymizeLogData(v)
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = anonymizeLogValue(item)
+		}
+		return items
+	case string:
+		if v == "" {
+			return v
+		}
+		return fakeCode(v, 8)
+	}
+	// numbers, booleans and nulls say nothing about the traveler
+	return value
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[\w.+-]+@[\w-]+(\.[\w-]+)+`)
+	// only international numbers, dates and times look like the others
+	phonePattern = regexp.MustCompile(`\+\d[\d ().-]{6,}\d`)
+)
+
+// textRedactor replaces the personal details of a trip in free text with the
+// fakes AnonymizeSnapshot puts in the snapshot, so the turns still read like
+// the trip in the bundle. Email addresses and phone numbers are replaced
+// whoever they belong to.
+type textRedactor struct {
+	replacements map[string]string
+}
+
+// newTextRedactor collects the details to replace from the snapshot before it
+// is anonymized and from the members of the trip
+func newTextRedactor(app core.App, trip *core.Record, snapshot *bt.ExportedTrip) *textRedactor {
+	r := &textRedactor{replacements: map[string]string{}}
+
+	t := snapshot.Trip
+	for i, participant := range t.Participants {
+		r.replace(participant.Name, fakeTravelerNames[i%len(fakeTravelerNames)])
+	}
+	if members, err := TripMembers(app, trip); err == nil {
+		for i, member := range members {
+			r.replace(member.GetString("name"), fakeTravelerNames[(len(t.Participants)+i)%len(fakeTravelerNames)])
+		}
+	}
+	if t.Insurance != nil {
+		r.replace(t.Insurance.PolicyNumber, "POL-"+fakeCode(t.Insurance.PolicyNumber, 8))
+	}
+	for _, l := range snapshot.Lodgings {
+		r.replace(l.ConfirmationCode, anonymizeCode(l.ConfirmationCode))
+	}
+	for _, a := range snapshot.Activities {
+		r.replace(a.ConfirmationCode, anonymizeCode(a.ConfirmationCode))
+	}
+	for _, c := range snapshot.CarRentals {
+		r.replace(c.ConfirmationCode, anonymizeCode(c.ConfirmationCode))
+	}
+	for _, d := range snapshot.Dining {
+		r.replace(d.ConfirmationCode, anonymizeCode(d.ConfirmationCode))
+	}
+	return r
+}
+
+func (r *textRedactor) replace(original string, fake string) {
+	original = strings.TrimSpace(original)
+	if original != "" {
+		r.replacements[original] = fake
+	}
+}
+
+func (r *textRedactor) text(text string) string {
+	if text == "" {
+		return text
+	}
+
+	// longest first, so "Ana Lima" is replaced before "Ana"
+	originals := make([]string, 0, len(r.replacements))
+	for original := range r.replacements {
+		originals = append(originals, original)
+	}
+	sort.Slice(originals, func(i, j int) bool { return len(originals[i]) > len(originals[j]) })
+	for _, original := range originals {
+		text = replaceWord(text, original, r.replacements[original])
+	}
+
+	text = emailPattern.ReplaceAllString(text, "traveler@example.com")
+	return phonePattern.ReplaceAllString(text, "+1 555 0100")
+}
+
+// replaceWord replaces the word where it is not part of a longer one, "Al"
+// in "Almond" stays
+func replaceWord(text string, word string, fake string) string {
+	var out strings.Builder
+	for {
+		i := strings.Index(text, word)
+		if i < 0 {
+			out.WriteString(text)
+			return out.String()
+		}
+		end := i + len(word)
+		before, _ := utf8.DecodeLastRuneInString(text[:i])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if (i > 0 && isWordRune(before)) || (end < len(text) && isWordRune(after)) {
+			out.WriteString(text[:end])
+		} else {
+			out.WriteString(text[:i])
+			out.WriteString(fake)
+		}
+		text = text[end:]
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// value redacts every text in decoded JSON
+func (r *textRedactor) value(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = r.value(item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = r.value(item)
+		}
+		return v
+	case string:
+		return r.text(v)
+	}
+	return value
+}
@@ -0,0 +1,99 @@
+package trips
+
+import (
+	"backend/encryption"
+	bt "backend/types"
+	"fmt"
+	"io"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// ConfirmationCodeCollections are the items with a confirmation code, kept
+// encrypted when the instance has an encryption key
+var ConfirmationCodeCollections = []string{"lodgings", "activities", "car_rentals", "dining"}
+
+// ConfirmationCode reads the confirmation code of an item, decrypted
+func ConfirmationCode(record *core.Record) string {
+	return encryption.RevealString(record.GetString("confirmationCode"))
+}
+
+// EncryptStoredSecrets encrypts the confirmation codes and the files of the
+// document vault saved before the instance had an encryption key
+func EncryptStoredSecrets(app core.App, dryRun bool) (*bt.EncryptionReport, error) {
+	if !encryption.Enabled() {
+		return nil, fmt.Errorf("set %s to the key file first", encryption.KeyFileEnv)
+	}
+	report := &bt.EncryptionReport{DryRun: dryRun, Codes: map[string]int{}}
+
+	for _, collection := range ConfirmationCodeCollections {
+		records, err := app.FindAllRecords(collection, dbx.NewExp("confirmationCode != ''"))
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			code := record.GetString("confirmationCode")
+			if encryption.IsSealedString(code) {
+				continue
+			}
+			report.Codes[collection]++
+			if dryRun {
+				continue
+			}
+			sealed, err := encryption.SealString(code)
+			if err != nil {
+				return nil, err
+			}
+			record.Set("confirmationCode", sealed)
+			// only the stored form changes, skip the itinerary hooks
+			if err := app.UnsafeWithoutHooks().Save(record); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", collection, record.Id, err)
+			}
+		}
+	}
+
+	documents, err := app.FindAllRecords("documents", dbx.NewExp("file != '[]' and file != ''"))
+	if err != nil {
+		return nil, err
+	}
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return nil, err
+	}
+	defer fsys.Close()
+	for _, document := range documents {
+		for _, name := range document.GetStringSlice("file") {
+			key := document.BaseFilesPath() + "/" + name
+			data, err := readStoredFile(fsys, key)
+			if err != nil {
+				return nil, fmt.Errorf("documents %s: %w", document.Id, err)
+			}
+			if encryption.IsSealed(data) {
+				continue
+			}
+			report.Files++
+			if dryRun {
+				continue
+			}
+			sealed, err := encryption.Seal(data)
+			if err != nil {
+				return nil, err
+			}
+			if err := fsys.Upload(sealed, key); err != nil {
+				return nil, fmt.Errorf("documents %s: %w", document.Id, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+func readStoredFile(fsys *filesystem.System, key string) ([]byte, error) {
+	r, err := fsys.GetReader(key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
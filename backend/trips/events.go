@@ -0,0 +1,186 @@
+package trips
+
+import (
+	"backend/encryption"
+	bt "backend/types"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Actions of the trip events
+const (
+	EventCreated = "create"
+	EventUpdated = "update"
+	EventDeleted = "delete"
+)
+
+// EventCollections are the trip and the items whose changes are kept in the
+// trip_events log
+var EventCollections = []string{"trips", "transportations", "lodgings", "activities", "trip_expenses", "equipment_rentals", "car_rentals", "dining", "tickets", "trip_attachments"}
+
+// the trip an item belongs to and the fields the server fills in itself, a
+// change to them is never news
+var skippedEventFields = []string{"trip", "exchangeRate"}
+
+const (
+	maxEventText  = 500
+	maxEventValue = 4000
+)
+
+// RecordChanges lists the fields that differ between the stored record and
+// the one being saved. Without a stored record every field that has a value
+// is listed as added, without a new one as removed.
+func RecordChanges(stored *core.Record, record *core.Record) []bt.FieldChange {
+	collection := record
+	if collection == nil {
+		collection = stored
+	}
+
+	changes := make([]bt.FieldChange, 0)
+	for _, field := range collection.Collection().Fields {
+		name := field.GetName()
+		if !eventField(collection, field) {
+			continue
+		}
+
+		var from, to any
+		if stored != nil {
+			from = stored.Get(name)
+		}
+		if record != nil {
+			to = record.Get(name)
+		}
+		sealed := false
+		if name == "confirmationCode" {
+			// the stored code may be encrypted, the saved one is not yet
+			fromCode, _ := from.(string)
+			toCode, _ := to.(string)
+			from, to = encryption.RevealString(fromCode), encryption.RevealString(toCode)
+			sealed = encryption.Enabled()
+		}
+		fromJSON, toJSON := eventValueJSON(from), eventValueJSON(to)
+		if fromJSON == toJSON {
+			continue
+		}
+
+		change := bt.FieldChange{Field: name}
+		if sealed {
+			// the log would keep in the clear what the instance encrypts
+			change.Redacted = true
+			changes = append(changes, change)
+			continue
+		}
+		change.From, change.Truncated = eventValue(fromJSON)
+		var truncated bool
+		change.To, truncated = eventValue(toJSON)
+		change.Truncated = change.Truncated || truncated
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// eventField tells whether changes to the field are worth keeping: not the
+// system fields, secrets or what the server derives from other fields
+func eventField(record *core.Record, field core.Field) bool {
+	name := field.GetName()
+	if field.GetSystem() || field.GetHidden() || slices.Contains(skippedEventFields, name) {
+		return false
+	}
+	switch field.Type() {
+	case core.FieldTypeAutodate, core.FieldTypePassword:
+		return false
+	}
+	// the instants and timezones kept next to the wall clock times, see
+	// StoreUtcInstants
+	for _, suffix := range []string{"Utc", "Timezone"} {
+		if base, ok := strings.CutSuffix(name, suffix); ok && base != "" && record.Collection().Fields.GetByName(base) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// eventValueJSON is the value as JSON, empty values of any kind are ""
+func eventValueJSON(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	switch string(data) {
+	case "null", `""`, "[]", "{}", "0", "false":
+		return ""
+	}
+	return string(data)
+}
+
+// eventValue is what the log keeps of a value: long texts are cut short,
+// large JSON values are left out
+func eventValue(valueJSON string) (any, bool) {
+	if valueJSON == "" {
+		return nil, false
+	}
+	var value any
+	if err := json.Unmarshal([]byte(valueJSON), &value); err != nil {
+		return nil, false
+	}
+	if text, ok := value.(string); ok {
+		runes := []rune(text)
+		if len(runes) > maxEventText {
+			return string(runes[:maxEventText]) + "…", true
+		}
+		return text, false
+	}
+	if len(valueJSON) > maxEventValue {
+		return nil, true
+	}
+	return value, false
+}
+
+// fields each part of an item that can be kept private is stored in
+var privateEventFields = map[string][]string{
+	PrivateCost:             {"cost", "exchangeRate", "deposit", "rooms"},
+	PrivateConfirmationCode: {"confirmationCode", "barcode", "metadata", "rooms"},
+	PrivateNotes:            {"notes", "description"},
+}
+
+// costAndCodeEventFields are kept from viewers, like the assistant keeps
+// costs and confirmation codes from them
+var costAndCodeEventFields = []string{"cost", "exchangeRate", "deposit", "budget", "budgetCategories", "confirmationCode", "barcode", "metadata", "rooms"}
+
+// EventVisible tells whether the role may see an event of an item
+func EventVisible(event *core.Record, role string) bool {
+	return ItemVisible(event.GetString("collection"), event.GetBool("private"), role)
+}
+
+// ItemVisible tells whether the role may see an item of the collection,
+// private items are the owner's alone and viewers do not see the expenses
+func ItemVisible(collection string, private bool, role string) bool {
+	if private && !SeesPrivate(role) {
+		return false
+	}
+	return CanEdit(role) || collection != "trip_expenses"
+}
+
+// RedactEventChanges hides the values of the changes the role may not see
+func RedactEventChanges(event *core.Record, role string, changes []bt.FieldChange) []bt.FieldChange {
+	hidden := make([]string, 0)
+	if !SeesPrivate(role) {
+		for _, part := range event.GetStringSlice("privateFields") {
+			hidden = append(hidden, privateEventFields[part]...)
+		}
+	}
+	if !CanEdit(role) {
+		hidden = append(hidden, costAndCodeEventFields...)
+	}
+	for i := range changes {
+		if slices.Contains(hidden, changes[i].Field) {
+			changes[i].From, changes[i].To = nil, nil
+			changes[i].Truncated = false
+			changes[i].Redacted = true
+		}
+	}
+	return changes
+}
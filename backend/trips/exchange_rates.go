@@ -0,0 +1,78 @@
+package trips
+
+import (
+	"backend/currency"
+	bt "backend/types"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// CostCollections are the trip items with a cost, each keeps the exchange
+// rate to the budget currency of when it was booked, or paid for expenses
+var CostCollections = []string{"transportations", "lodgings", "activities", "trip_expenses", "equipment_rentals", "car_rentals", "dining"}
+
+// LockExchangeRate stores on the item the rate from its currency to the
+// currency of the trip budget, with what the cost comes to at that rate.
+// Expenses take the rate of the day they were paid, other items the one of
+// the day they were booked, today for new ones. Items in the budget
+// currency, and trips without a budget, need no rate.
+func LockExchangeRate(app core.App, record *core.Record) error {
+	trip, err := app.FindRecordById("trips", record.GetString("trip"))
+	if err != nil {
+		return err
+	}
+
+	var budget bt.Cost
+	_ = trip.UnmarshalJSONField("budget", &budget)
+	var cost bt.Cost
+	_ = record.UnmarshalJSONField("cost", &cost)
+	if budget.Currency == "" || cost.Currency == "" || cost.Currency == budget.Currency {
+		record.Set("exchangeRate", nil)
+		return nil
+	}
+
+	rates, date := currency.RatesOn(app, exchangeRateDay(record))
+	rate, ok := currency.Convert(1, cost.Currency, budget.Currency, rates)
+	if !ok {
+		record.Set("exchangeRate", nil)
+		return nil
+	}
+
+	record.Set("exchangeRate", &bt.ExchangeRate{
+		From:      cost.Currency,
+		To:        budget.Currency,
+		Rate:      rate,
+		Converted: currency.Round(cost.Value*rate, budget.Currency),
+		RatesDate: date,
+	})
+	return nil
+}
+
+// exchangeRateDay is the day the rate of the item is locked for
+func exchangeRateDay(record *core.Record) time.Time {
+	day := record.GetDateTime("created").Time()
+	if record.Collection().Name == "trip_expenses" {
+		day = record.GetDateTime("occurredOn").Time()
+	}
+	if day.IsZero() {
+		day = time.Now()
+	}
+	return day
+}
+
+// ConvertCost converts a cost into the target currency at its locked rate,
+// or at today's rates when the rate was locked for another currency
+func ConvertCost(cost *bt.Cost, locked *bt.ExchangeRate, target string, rates map[string]float64) (*bt.Cost, bool) {
+	if cost == nil || cost.Currency == "" || target == "" {
+		return nil, false
+	}
+	if locked != nil && locked.From == cost.Currency && locked.To == target && locked.Rate > 0 {
+		return &bt.Cost{Value: currency.Round(cost.Value*locked.Rate, target), Currency: target}, true
+	}
+	value, ok := currency.Convert(cost.Value, cost.Currency, target, rates)
+	if !ok {
+		return nil, false
+	}
+	return &bt.Cost{Value: currency.Round(value, target), Currency: target}, true
+}
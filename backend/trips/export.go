@@ -12,7 +12,9 @@ import (
 	"os"
 )
 
-func ExportTripArchive(app core.App, trip *core.Record, tripExport *os.File) error {
+// ExportTripArchive writes the trip, its plans and attachments as a zip
+// archive. Private items and fields are left out unless the role is the owner.
+func ExportTripArchive(app core.App, trip *core.Record, role string, tripExport *os.File) error {
 
 	zipWriter := zip.NewWriter(tripExport)
 
@@ -21,6 +23,10 @@ func ExportTripArchive(app core.App, trip *core.Record, tripExport *os.File) err
 	lodgings := exportLodgings(app, trip)
 	activities := exportActivities(app, trip)
 	expenses := exportExpenses(app, trip)
+	rentals := exportRentals(app, trip)
+	carRentals := exportCarRentals(app, trip)
+	dining := exportDining(app, trip)
+	tickets := exportTickets(app, trip)
 	attachments, _ := writeAttachmentsWithMapping(app, trip, zipWriter)
 
 	exportedTrip := bt.ExportedTrip{
@@ -29,8 +35,15 @@ func ExportTripArchive(app core.App, trip *core.Record, tripExport *os.File) err
 		Lodgings:        lodgings,
 		Activities:      activities,
 		Expenses:        expenses,
+		Rentals:         rentals,
+		CarRentals:      carRentals,
+		Dining:          dining,
+		Tickets:         tickets,
 		Attachments:     attachments,
 	}
+	if !SeesPrivate(role) {
+		RedactExport(&exportedTrip)
+	}
 
 	exportedTripEntities, err := json.MarshalIndent(exportedTrip, "", " ")
 	tripJsonExport, _ := zipWriter.Create("trip.json")
@@ -55,6 +68,8 @@ func exportTrip(app core.App, trip *core.Record, zipWriter *zip.Writer) bt.Trip
 		Participants:       getParticipants(trip),
 	}
 	_ = trip.UnmarshalJSONField("budget", &t.Budget)
+	_ = trip.UnmarshalJSONField("budgetCategories", &t.BudgetCategories)
+	_ = trip.UnmarshalJSONField("insurance", &t.Insurance)
 
 	// add cover image
 	coverImageFileName := trip.GetString("coverImage")
@@ -123,11 +138,16 @@ func exportActivities(e core.App, trip *core.Record) []*bt.Activity {
 			Description:          l.GetString("description"),
 			Address:              l.GetString("address"),
 			StartDate:            l.GetDateTime("startDate"),
-			ConfirmationCode:     l.GetString("confirmationCode"),
+			EndDate:              l.GetDateTime("endDate"),
+			ConfirmationCode:     ConfirmationCode(l),
 			AttachmentReferences: l.GetStringSlice("attachmentReferences"),
+			PaidBy:               l.GetString("paidBy"),
 		}
 		_ = l.UnmarshalJSONField("metadata", &ct.Metadata)
 		_ = l.UnmarshalJSONField("cost", &ct.Cost)
+		_ = l.UnmarshalJSONField("exchangeRate", &ct.ExchangeRate)
+		_ = l.UnmarshalJSONField("splitAmong", &ct.SplitAmong)
+		_ = l.UnmarshalJSONField("privacy", &ct.Privacy)
 		payload = append(payload, &ct)
 		e.Logger().Debug("Exported Activity  data", "id", l.Id)
 
@@ -151,13 +171,18 @@ func exportLodgings(e core.App, trip *core.Record) []*bt.Lodging {
 			Address:              l.GetString("address"),
 			StartDate:            l.GetDateTime("startDate"),
 			EndDate:              l.GetDateTime("endDate"),
-			ConfirmationCode:     l.GetString("confirmationCode"),
+			ConfirmationCode:     ConfirmationCode(l),
 			Type:                 l.GetString("type"),
 			AttachmentReferences: l.GetStringSlice("attachmentReferences"),
+			PaidBy:               l.GetString("paidBy"),
 		}
 
 		_ = l.UnmarshalJSONField("metadata", &ct.Metadata)
 		_ = l.UnmarshalJSONField("cost", &ct.Cost)
+		_ = l.UnmarshalJSONField("exchangeRate", &ct.ExchangeRate)
+		_ = l.UnmarshalJSONField("splitAmong", &ct.SplitAmong)
+		_ = l.UnmarshalJSONField("rooms", &ct.Rooms)
+		_ = l.UnmarshalJSONField("privacy", &ct.Privacy)
 
 		payload = append(payload, &ct)
 		e.Logger().Debug("Exported Lodging  data", "id", l.Id)
@@ -183,9 +208,14 @@ func exportTransportations(e core.App, trip *core.Record) []*bt.Transportation {
 			Departure:            tr.GetDateTime("departureTime"),
 			Arrival:              tr.GetDateTime("arrivalTime"),
 			AttachmentReferences: tr.GetStringSlice("attachmentReferences"),
+			PaidBy:               tr.GetString("paidBy"),
 		}
 		_ = tr.UnmarshalJSONField("metadata", &ct.Metadata)
 		_ = tr.UnmarshalJSONField("cost", &ct.Cost)
+		_ = tr.UnmarshalJSONField("exchangeRate", &ct.ExchangeRate)
+		_ = tr.UnmarshalJSONField("splitAmong", &ct.SplitAmong)
+		_ = tr.UnmarshalJSONField("seats", &ct.Seats)
+		_ = tr.UnmarshalJSONField("privacy", &ct.Privacy)
 		payload = append(payload, &ct)
 		e.Logger().Debug("Exported Transportation  data", "id", tr.Id)
 	}
@@ -207,8 +237,12 @@ func exportExpenses(e core.App, trip *core.Record) []*bt.Expense {
 			Notes:                exp.GetString("notes"),
 			Category:             exp.GetString("category"),
 			AttachmentReferences: exp.GetStringSlice("attachmentReferences"),
+			PaidBy:               exp.GetString("paidBy"),
 		}
 		_ = exp.UnmarshalJSONField("cost", &ct.Cost)
+		_ = exp.UnmarshalJSONField("splitAmong", &ct.SplitAmong)
+		_ = exp.UnmarshalJSONField("privacy", &ct.Privacy)
+		_ = exp.UnmarshalJSONField("exchangeRate", &ct.ExchangeRate)
 		payload = append(payload, &ct)
 		e.Logger().Debug("Exported Expense data", "id", exp.Id)
 	}
@@ -216,6 +250,122 @@ func exportExpenses(e core.App, trip *core.Record) []*bt.Expense {
 	return payload
 }
 
+func exportRentals(e core.App, trip *core.Record) []*bt.EquipmentRental {
+
+	rentals, _ := e.FindAllRecords("equipment_rentals",
+		dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+
+	var payload []*bt.EquipmentRental
+	for _, r := range rentals {
+		ct := bt.EquipmentRental{
+			Id:         r.Id,
+			Activity:   r.GetString("activity"),
+			Item:       r.GetString("item"),
+			Shop:       r.GetString("shop"),
+			PickupTime: r.GetDateTime("pickupTime"),
+			ReturnTime: r.GetDateTime("returnTime"),
+			Notes:      r.GetString("notes"),
+		}
+		_ = r.UnmarshalJSONField("deposit", &ct.Deposit)
+		_ = r.UnmarshalJSONField("cost", &ct.Cost)
+		_ = r.UnmarshalJSONField("exchangeRate", &ct.ExchangeRate)
+		_ = r.UnmarshalJSONField("privacy", &ct.Privacy)
+		payload = append(payload, &ct)
+		e.Logger().Debug("Exported Rental data", "id", r.Id)
+	}
+
+	return payload
+}
+
+func exportCarRentals(e core.App, trip *core.Record) []*bt.CarRental {
+
+	rentals, _ := e.FindAllRecords("car_rentals",
+		dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+
+	var payload []*bt.CarRental
+	for _, r := range rentals {
+		ct := bt.CarRental{
+			Id:                   r.Id,
+			Provider:             r.GetString("provider"),
+			PickupLocation:       r.GetString("pickupLocation"),
+			DropoffLocation:      r.GetString("dropoffLocation"),
+			PickupTime:           r.GetDateTime("pickupTime"),
+			DropoffTime:          r.GetDateTime("dropoffTime"),
+			ConfirmationCode:     ConfirmationCode(r),
+			VehicleClass:         r.GetString("vehicleClass"),
+			Notes:                r.GetString("notes"),
+			AttachmentReferences: r.GetStringSlice("attachmentReferences"),
+		}
+		_ = r.UnmarshalJSONField("metadata", &ct.Metadata)
+		_ = r.UnmarshalJSONField("cost", &ct.Cost)
+		_ = r.UnmarshalJSONField("exchangeRate", &ct.ExchangeRate)
+		_ = r.UnmarshalJSONField("privacy", &ct.Privacy)
+		payload = append(payload, &ct)
+		e.Logger().Debug("Exported Car Rental data", "id", r.Id)
+	}
+
+	return payload
+}
+
+func exportTickets(e core.App, trip *core.Record) []*bt.Ticket {
+
+	tickets, _ := e.FindAllRecords("tickets",
+		dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+
+	var payload []*bt.Ticket
+	for _, r := range tickets {
+		ct := bt.Ticket{
+			Id:                   r.Id,
+			Activity:             r.GetString("activity"),
+			Holder:               r.GetString("holder"),
+			Barcode:              r.GetString("barcode"),
+			BarcodeFormat:        r.GetString("barcodeFormat"),
+			Section:              r.GetString("section"),
+			Row:                  r.GetString("row"),
+			Seat:                 r.GetString("seat"),
+			Gate:                 r.GetString("gate"),
+			EntryStart:           r.GetDateTime("entryStart"),
+			EntryEnd:             r.GetDateTime("entryEnd"),
+			Notes:                r.GetString("notes"),
+			AttachmentReferences: r.GetStringSlice("attachmentReferences"),
+		}
+		_ = r.UnmarshalJSONField("privacy", &ct.Privacy)
+		payload = append(payload, &ct)
+		e.Logger().Debug("Exported Ticket data", "id", r.Id)
+	}
+
+	return payload
+}
+
+func exportDining(e core.App, trip *core.Record) []*bt.Dining {
+
+	reservations, _ := e.FindAllRecords("dining",
+		dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+
+	var payload []*bt.Dining
+	for _, r := range reservations {
+		ct := bt.Dining{
+			Id:                   r.Id,
+			Name:                 r.GetString("name"),
+			ReservationTime:      r.GetDateTime("reservationTime"),
+			PartySize:            r.GetInt("partySize"),
+			ConfirmationCode:     ConfirmationCode(r),
+			Cuisine:              r.GetString("cuisine"),
+			Address:              r.GetString("address"),
+			Notes:                r.GetString("notes"),
+			AttachmentReferences: r.GetStringSlice("attachmentReferences"),
+		}
+		_ = r.UnmarshalJSONField("metadata", &ct.Metadata)
+		_ = r.UnmarshalJSONField("cost", &ct.Cost)
+		_ = r.UnmarshalJSONField("exchangeRate", &ct.ExchangeRate)
+		_ = r.UnmarshalJSONField("privacy", &ct.Privacy)
+		payload = append(payload, &ct)
+		e.Logger().Debug("Exported Dining data", "id", r.Id)
+	}
+
+	return payload
+}
+
 func getDestinations(trip *core.Record) []bt.Destination {
 	destinationsString := trip.GetString("destinations")
 	var payload []bt.Destination
@@ -0,0 +1,151 @@
+package trips
+
+import (
+	"backend/cache"
+	bt "backend/types"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/samber/lo"
+)
+
+// a route or hotel has to show up at least this many times to be considered
+// a habit rather than a one-off booking
+const frequentMinCount = 2
+
+const travelHistoryTTL = 10 * time.Minute
+
+// TravelHistory finds the transportation routes and lodgings that repeat across
+// all trips the user owns or collaborates on, most frequent first
+func TravelHistory(app core.App, userId string) (*bt.TravelHistory, error) {
+
+	cacheKey := fmt.Sprintf("travel-history-%s", userId)
+	if cached, found := cache.Get(cacheKey); found {
+		return cached.(*bt.TravelHistory), nil
+	}
+
+	userTrips, err := app.FindAllRecords("trips", dbx.Or(
+		dbx.HashExp{"ownerId": userId},
+		dbx.Like("collaborators", userId),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	history := &bt.TravelHistory{
+		Routes:   make([]bt.FrequentRoute, 0),
+		Lodgings: make([]bt.FrequentLodging, 0),
+	}
+	if len(userTrips) == 0 {
+		return history, nil
+	}
+
+	tripIds := lo.Map(userTrips, func(t *core.Record, _ int) interface{} { return t.Id })
+	destinationsByTrip := map[string][]bt.Destination{}
+	for _, trip := range userTrips {
+		var destinations []bt.Destination
+		_ = json.Unmarshal([]byte(trip.GetString("destinations")), &destinations)
+		destinationsByTrip[trip.Id] = destinations
+	}
+
+	transportations, err := app.FindAllRecords("transportations", dbx.In("trip", tripIds...))
+	if err != nil {
+		return nil, err
+	}
+
+	routes := map[string]*bt.FrequentRoute{}
+	for _, t := range transportations {
+		origin := strings.TrimSpace(t.GetString("origin"))
+		destination := strings.TrimSpace(t.GetString("destination"))
+		if origin == "" || destination == "" {
+			continue
+		}
+
+		key := strings.ToLower(strings.Join([]string{t.GetString("type"), origin, destination}, "|"))
+		route, ok := routes[key]
+		if !ok {
+			route = &bt.FrequentRoute{Type: t.GetString("type"), Origin: origin, Destination: destination}
+			routes[key] = route
+		}
+		route.Count++
+		if departure := t.GetDateTime("departureTime"); departure.After(route.LastUsed) {
+			route.LastUsed = departure
+		}
+	}
+
+	lodgings, err := app.FindAllRecords("lodgings", dbx.In("trip", tripIds...))
+	if err != nil {
+		return nil, err
+	}
+
+	stays := map[string]*bt.FrequentLodging{}
+	for _, l := range lodgings {
+		name := strings.TrimSpace(l.GetString("name"))
+		if name == "" {
+			continue
+		}
+
+		key := strings.ToLower(name + "|" + strings.TrimSpace(l.GetString("address")))
+		stay, ok := stays[key]
+		if !ok {
+			stay = &bt.FrequentLodging{
+				Name:    name,
+				Address: strings.TrimSpace(l.GetString("address")),
+				Type:    l.GetString("type"),
+				City:    lodgingCity(l, destinationsByTrip[l.GetString("trip")]),
+			}
+			stays[key] = stay
+		}
+		stay.Count++
+		if start := l.GetDateTime("startDate"); start.After(stay.LastUsed) {
+			stay.LastUsed = start
+		}
+	}
+
+	for _, route := range routes {
+		if route.Count >= frequentMinCount {
+			history.Routes = append(history.Routes, *route)
+		}
+	}
+	for _, stay := range stays {
+		if stay.Count >= frequentMinCount {
+			history.Lodgings = append(history.Lodgings, *stay)
+		}
+	}
+
+	sort.Slice(history.Routes, func(i, j int) bool {
+		if history.Routes[i].Count != history.Routes[j].Count {
+			return history.Routes[i].Count > history.Routes[j].Count
+		}
+		return history.Routes[i].LastUsed.After(history.Routes[j].LastUsed)
+	})
+	sort.Slice(history.Lodgings, func(i, j int) bool {
+		if history.Lodgings[i].Count != history.Lodgings[j].Count {
+			return history.Lodgings[i].Count > history.Lodgings[j].Count
+		}
+		return history.Lodgings[i].LastUsed.After(history.Lodgings[j].LastUsed)
+	})
+
+	cache.Set(cacheKey, history, travelHistoryTTL)
+	return history, nil
+}
+
+// lodgingCity picks the trip destination mentioned in the lodging address, or
+// the only destination of the trip when there is just one
+func lodgingCity(lodging *core.Record, destinations []bt.Destination) string {
+	address := strings.ToLower(lodging.GetString("address"))
+	for _, destination := range destinations {
+		if destination.Name != "" && strings.Contains(address, strings.ToLower(destination.Name)) {
+			return destination.Name
+		}
+	}
+	if len(destinations) == 1 {
+		return destinations[0].Name
+	}
+	return ""
+}
@@ -0,0 +1,467 @@
+package calendar
+
+import (
+	bt "backend/types"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/ringsaturn/tzf"
+)
+
+var ErrUnknownFormat = errors.New("the file is not an iCalendar (.ics) file")
+
+// Plans are the reservations read from a calendar, ready to be added to a
+// trip. Warnings list the events that were skipped or need a look.
+type Plans struct {
+	Transportations []*bt.Transportation `json:"transportations"`
+	Lodgings        []*bt.Lodging        `json:"lodgings"`
+	Activities      []*bt.Activity       `json:"activities"`
+	Warnings        []string             `json:"warnings"`
+}
+
+// Parse reads the events of an .ics file, such as a TripIt calendar, a hotel
+// confirmation attachment or a calendar exported from Surmai. Flights, trains
+// and other legs become transportations, stays and check-in/check-out pairs
+// become lodgings and everything else an activity. Times are turned into the
+// local wall clock time of the place: a TZID is used as is, UTC times are
+// converted with the timezone of the event's coordinates, or
+// defaultTimezone when there are none.
+func Parse(data []byte, finder tzf.F, defaultTimezone string) (*Plans, error) {
+	cal, err := ics.ParseCalendar(bytes.NewReader(data))
+	if err != nil || !bytes.Contains(data, []byte("BEGIN:VCALENDAR")) {
+		return nil, ErrUnknownFormat
+	}
+
+	if tz := calendarTimezone(cal); tz != "" {
+		defaultTimezone = tz
+	}
+
+	plans := &Plans{
+		Transportations: make([]*bt.Transportation, 0),
+		Lodgings:        make([]*bt.Lodging, 0),
+		Activities:      make([]*bt.Activity, 0),
+		Warnings:        make([]string, 0),
+	}
+	stays := map[string]*bt.Lodging{}
+
+	for _, event := range cal.Events() {
+		e := readEvent(event, finder, defaultTimezone)
+		if e.summary == "" || e.start.IsZero() {
+			continue
+		}
+		if strings.EqualFold(e.status, "CANCELLED") {
+			plans.Warnings = append(plans.Warnings, fmt.Sprintf("%s was cancelled and was skipped", e.summary))
+			continue
+		}
+		if ownEvent.MatchString(e.uid) && !ownPlan.MatchString(e.uid) {
+			// the trip itself and rental pickups of a Surmai export
+			continue
+		}
+		if e.timezone == "" && e.utc {
+			plans.Warnings = append(plans.Warnings, fmt.Sprintf("the time of %s is in UTC, the place has no timezone", e.summary))
+		}
+
+		if transportation, ok := e.transportation(); ok {
+			if e.endUTC && e.timezone != "" && transportation.Type != "rental_car" {
+				plans.Warnings = append(plans.Warnings, fmt.Sprintf("the arrival of %s is shown in the timezone of the departure", e.summary))
+			}
+			plans.Transportations = append(plans.Transportations, transportation)
+			continue
+		}
+		if name, kind, ok := e.lodging(); ok {
+			key := strings.ToLower(name)
+			lodging, found := stays[key]
+			if !found {
+				lodging = &bt.Lodging{
+					Type:             lodgingType(name + " " + e.description),
+					Name:             name,
+					Address:          e.location,
+					ConfirmationCode: e.confirmation(),
+					Metadata:         map[string]any{"place": e.place(name), "icsUid": e.uid},
+				}
+				stays[key] = lodging
+				plans.Lodgings = append(plans.Lodgings, lodging)
+			}
+			e.mergeStay(lodging, kind)
+			continue
+		}
+		plans.Activities = append(plans.Activities, e.activity())
+	}
+
+	for _, lodging := range plans.Lodgings {
+		if lodging.StartDate.IsZero() || lodging.EndDate.IsZero() {
+			plans.Warnings = append(plans.Warnings, fmt.Sprintf("only the check-in or check-out of %s is in the calendar", lodging.Name))
+		}
+	}
+	return plans, nil
+}
+
+var (
+	// UIDs of the events of a calendar exported by Surmai, the plans carry
+	// the id of their record
+	ownEvent = regexp.MustCompile(`^[a-z-]+-[a-z0-9]+@surmai\.app$`)
+	ownPlan  = regexp.MustCompile(`^(?:transport|activity|lodging-(?:checkin|stay|checkout))-([a-z0-9]+)@surmai\.app$`)
+)
+
+// RecordId returns the id of the Surmai record a calendar event was exported
+// from, or an empty string for events from anywhere else
+func RecordId(uid string) string {
+	if match := ownPlan.FindStringSubmatch(uid); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+func calendarTimezone(cal *ics.Calendar) string {
+	for _, property := range cal.CalendarProperties {
+		if property.IANAToken == string(ics.PropertyXWRTimezone) {
+			if _, err := time.LoadLocation(property.Value); err == nil {
+				return property.Value
+			}
+		}
+	}
+	return ""
+}
+
+type event struct {
+	uid         string
+	summary     string
+	description string
+	location    string
+	status      string
+	allDay      bool
+	utc         bool
+	endUTC      bool
+	start       time.Time
+	end         time.Time
+	timezone    string
+	endTimezone string
+	latitude    float64
+	longitude   float64
+	hasGeo      bool
+}
+
+func readEvent(v *ics.VEvent, finder tzf.F, defaultTimezone string) *event {
+	e := &event{
+		uid:         propertyValue(v, ics.ComponentPropertyUniqueId),
+		summary:     strings.TrimSpace(propertyValue(v, ics.ComponentPropertySummary)),
+		description: strings.TrimSpace(propertyValue(v, ics.ComponentPropertyDescription)),
+		location:    strings.TrimSpace(propertyValue(v, ics.ComponentPropertyLocation)),
+		status:      propertyValue(v, ics.ComponentPropertyStatus),
+	}
+
+	if lat, lng, ok := strings.Cut(propertyValue(v, ics.ComponentPropertyGeo), ";"); ok {
+		latitude, latErr := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+		longitude, lngErr := strconv.ParseFloat(strings.TrimSpace(lng), 64)
+		e.latitude, e.longitude, e.hasGeo = latitude, longitude, latErr == nil && lngErr == nil
+	}
+	placeTimezone := defaultTimezone
+	if e.hasGeo && finder != nil {
+		if tz := finder.GetTimezoneName(e.longitude, e.latitude); tz != "" {
+			placeTimezone = tz
+		}
+	}
+
+	e.start, e.timezone, e.allDay, e.utc = readTime(v.GetProperty(ics.ComponentPropertyDtStart), placeTimezone)
+	e.end, e.endTimezone, _, e.endUTC = readTime(v.GetProperty(ics.ComponentPropertyDtEnd), e.timezone)
+	if e.end.IsZero() && !e.start.IsZero() {
+		if duration, ok := parseDuration(propertyValue(v, ics.ComponentPropertyDuration)); ok {
+			e.end = e.start.Add(duration)
+			e.endTimezone = e.timezone
+		}
+	}
+	return e
+}
+
+func propertyValue(v *ics.VEvent, property ics.ComponentProperty) string {
+	if p := v.GetProperty(property); p != nil {
+		return p.Value
+	}
+	return ""
+}
+
+// readTime returns the local wall clock time of a DTSTART or DTEND, stored
+// as UTC like every time in Surmai, its timezone, whether it is a whole day
+// and whether it was a UTC time converted with fallbackTimezone
+func readTime(property *ics.IANAProperty, fallbackTimezone string) (time.Time, string, bool, bool) {
+	if property == nil {
+		return time.Time{}, "", false, false
+	}
+	value := strings.TrimSpace(property.Value)
+
+	if len(value) == 8 {
+		day, err := time.Parse("20060102", value)
+		if err != nil {
+			return time.Time{}, "", false, false
+		}
+		return day, fallbackTimezone, true, false
+	}
+
+	if tzid := property.ICalParameters[string(ics.ParameterTzid)]; len(tzid) > 0 {
+		if _, err := time.LoadLocation(tzid[0]); err == nil {
+			local, err := time.Parse("20060102T150405", strings.TrimSuffix(value, "Z"))
+			if err != nil {
+				return time.Time{}, "", false, false
+			}
+			return local, tzid[0], false, false
+		}
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		instant, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return time.Time{}, "", false, false
+		}
+		loc, err := time.LoadLocation(fallbackTimezone)
+		if fallbackTimezone == "" || err != nil {
+			return instant, "", false, true
+		}
+		local := instant.In(loc)
+		return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), 0, time.UTC), fallbackTimezone, false, true
+	}
+
+	// floating time, already the local time of wherever the event is
+	local, err := time.Parse("20060102T150405", value)
+	if err != nil {
+		return time.Time{}, "", false, false
+	}
+	return local, fallbackTimezone, false, false
+}
+
+var durationPattern = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseDuration reads the DURATION of an event, e.g. PT1H30M or P2D
+func parseDuration(value string) (time.Duration, bool) {
+	match := durationPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil || value == "P" {
+		return 0, false
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var duration time.Duration
+	for i, unit := range units {
+		if n, err := strconv.Atoi(match[i+1]); err == nil {
+			duration += time.Duration(n) * unit
+		}
+	}
+	return duration, duration > 0
+}
+
+var (
+	flightNumberPattern = regexp.MustCompile(`\b([A-Z][A-Z0-9]|[A-Z0-9][A-Z])\s?(\d{1,4})\b`)
+	airportPairPattern  = regexp.MustCompile(`\b([A-Z]{3})\s*(?:to|-|–|→|->|>)\s*([A-Z]{3})\b`)
+	legPattern          = regexp.MustCompile(`(?i)^(?:[^:]*?\b)?(flight|train|rail|bus|coach|boat|ferry)\b[^:]*?(?::|\bfrom\b)\s*(.+?)\s+(?:to|→|->)\s+(.+)$`)
+	carRentalPattern    = regexp.MustCompile(`(?i)\b(?:car rental|rental car|car hire)\b`)
+	confirmationPattern = regexp.MustCompile(`(?i:confirmation|booking|reservation|record locator|pnr)(?i:\s+(?:code|number|no\.?|#|reference))?\s*[:#]?\s*([A-Z0-9]{5,8})\b`)
+)
+
+func (e *event) transportation() (*bt.Transportation, bool) {
+	t := &bt.Transportation{
+		Seats:    make([]bt.SeatAssignment, 0),
+		Metadata: map[string]any{"icsUid": e.uid},
+	}
+
+	leg := legPattern.FindStringSubmatch(e.summary)
+	pair := airportPairPattern.FindStringSubmatch(e.summary)
+	switch {
+	case carRentalPattern.MatchString(e.summary):
+		t.Type = "rental_car"
+		t.Origin = firstNonEmpty(e.location, e.summary)
+		t.Destination = t.Origin
+		if provider := strings.TrimSpace(carRentalPattern.Split(e.summary, 2)[0]); provider != "" {
+			t.Metadata["provider"] = provider
+		}
+	case leg != nil:
+		t.Type = transportationType(leg[1])
+		t.Origin, t.Destination = strings.TrimSpace(leg[2]), strings.TrimSpace(leg[3])
+	case pair != nil:
+		// "UA 123 SFO to LAX", flights named by their airports
+		t.Type, t.Origin, t.Destination = "flight", pair[1], pair[2]
+	default:
+		return nil, false
+	}
+
+	if t.Type == "flight" {
+		rest := e.summary
+		if pair != nil {
+			rest = strings.Replace(rest, pair[0], "", 1)
+		}
+		if flight := flightNumberPattern.FindStringSubmatch(rest); flight != nil {
+			t.Metadata["flightNumber"] = flight[1] + flight[2]
+			t.Metadata["provider"] = flight[1]
+		}
+	}
+
+	if code := e.confirmation(); code != "" {
+		t.Metadata["reservation"] = code
+	}
+	origin := map[string]any{"name": t.Origin}
+	if e.timezone != "" {
+		origin["timezone"] = e.timezone
+	}
+	if e.hasGeo {
+		origin["latitude"], origin["longitude"] = e.latitude, e.longitude
+	}
+	t.Metadata["origin"] = origin
+	destination := map[string]any{"name": t.Destination}
+	// a UTC arrival was converted with the timezone of the departure, which
+	// is left for the traveler or the import review to correct
+	if e.endTimezone != "" && !e.endUTC {
+		destination["timezone"] = e.endTimezone
+	}
+	t.Metadata["destination"] = destination
+
+	t.Departure = dateTime(e.start)
+	t.Arrival = dateTime(e.end)
+	return t, true
+}
+
+func transportationType(word string) string {
+	switch strings.ToLower(word) {
+	case "flight":
+		return "flight"
+	case "train", "rail":
+		return "train"
+	case "bus", "coach":
+		return "bus"
+	default:
+		return "boat"
+	}
+}
+
+const (
+	stayCheckIn  = "checkin"
+	stayCheckOut = "checkout"
+	stayWhole    = "stay"
+)
+
+var (
+	stayPrefixPattern = regexp.MustCompile(`(?i)^(check[ -]?in|check[ -]?out|stay|hotel|lodging)\s*(?::|at\b|-)\s*(.+)$`)
+	lodgingPattern    = regexp.MustCompile(`(?i)\b(?:hotel|hostel|motel|inn|resort|airbnb|vrbo|guesthouse|guest house|b&b|apartment|lodge|ryokan)\b`)
+)
+
+// lodging tells whether the event is a stay, or its check-in or check-out,
+// and returns the name of the lodging
+func (e *event) lodging() (string, string, bool) {
+	if match := stayPrefixPattern.FindStringSubmatch(e.summary); match != nil {
+		name := strings.TrimSpace(match[2])
+		word := strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(match[1]))
+		switch word {
+		case "checkin":
+			return name, stayCheckIn, true
+		case "checkout":
+			return name, stayCheckOut, true
+		default:
+			return name, stayWhole, true
+		}
+	}
+
+	// a hotel booking spans the nights of the stay
+	nights := !e.end.IsZero() && e.end.Sub(e.start) >= 20*time.Hour
+	if lodgingPattern.MatchString(e.summary) && (nights || e.allDay) {
+		return e.summary, stayWhole, true
+	}
+	return "", "", false
+}
+
+// mergeStay fills the dates of the lodging from one of its events. The
+// check-in and check-out carry the times, a stay spanning whole days only
+// fills in what they leave out.
+func (e *event) mergeStay(lodging *bt.Lodging, kind string) {
+	switch kind {
+	case stayCheckIn:
+		lodging.StartDate = dateTime(e.start)
+	case stayCheckOut:
+		lodging.EndDate = dateTime(e.start)
+	default:
+		if lodging.StartDate.IsZero() {
+			lodging.StartDate = dateTime(e.start)
+		}
+		if lodging.EndDate.IsZero() {
+			lodging.EndDate = dateTime(e.end)
+		}
+	}
+
+	if lodging.Address == "" {
+		lodging.Address = e.location
+	}
+	if lodging.ConfirmationCode == "" {
+		lodging.ConfirmationCode = e.confirmation()
+	}
+	if place, ok := lodging.Metadata["place"].(map[string]any); ok && e.hasGeo {
+		if _, found := place["latitude"]; !found {
+			lodging.Metadata["place"] = e.place(lodging.Name)
+		}
+	}
+}
+
+func lodgingType(text string) string {
+	text = strings.ToLower(text)
+	switch {
+	case strings.Contains(text, "airbnb"), strings.Contains(text, "vrbo"), strings.Contains(text, "apartment"):
+		return "vacation_rental"
+	case strings.Contains(text, "camp"):
+		return "camp_site"
+	default:
+		return "hotel"
+	}
+}
+
+func (e *event) activity() *bt.Activity {
+	a := &bt.Activity{
+		Name:             e.summary,
+		Description:      e.description,
+		Address:          e.location,
+		ConfirmationCode: e.confirmation(),
+		StartDate:        dateTime(e.start),
+		Metadata:         map[string]any{"place": e.place(firstNonEmpty(e.location, e.summary)), "icsUid": e.uid},
+	}
+	// an all day event ends the next day, there is no end time to keep
+	if !e.allDay {
+		a.EndDate = dateTime(e.end)
+	}
+	return a
+}
+
+func (e *event) place(name string) map[string]any {
+	place := map[string]any{"name": name}
+	if e.timezone != "" {
+		place["timezone"] = e.timezone
+	}
+	if e.hasGeo {
+		place["latitude"], place["longitude"] = e.latitude, e.longitude
+	}
+	return place
+}
+
+func (e *event) confirmation() string {
+	for _, text := range []string{e.description, e.summary} {
+		if match := confirmationPattern.FindStringSubmatch(text); match != nil {
+			return match[1]
+		}
+	}
+	return ""
+}
+
+func dateTime(t time.Time) types.DateTime {
+	if t.IsZero() {
+		return types.DateTime{}
+	}
+	dt, _ := types.ParseDateTime(t)
+	return dt
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package calendar
+
+import (
+	ji "backend/trips/import/json"
+	bt "backend/types"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// CreatePlans saves the plans on the trip. Events the trip already has, by
+// their UID, the record they were exported from or the same name and time,
+// are skipped so a calendar can be imported again after it grew. The skipped
+// events are returned as warnings.
+func CreatePlans(app core.App, tripId string, plans *Plans) ([]*core.Record, []string, error) {
+	known := map[string]bool{}
+	for _, collection := range []string{"transportations", "lodgings", "activities"} {
+		records, err := app.FindAllRecords(collection, dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": tripId}))
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, record := range records {
+			var metadata map[string]any
+			_ = record.UnmarshalJSONField("metadata", &metadata)
+			known[record.Id] = true
+			if uid, _ := metadata["icsUid"].(string); uid != "" {
+				known[uid] = true
+			}
+			known[recordKey(record)] = true
+		}
+	}
+
+	warnings := make([]string, 0)
+	// isNew remembers the plan, a calendar may hold the same event twice
+	isNew := func(name string, uid string, key string) bool {
+		id := RecordId(uid)
+		if known[key] || (uid != "" && known[uid]) || (id != "" && known[id]) {
+			warnings = append(warnings, fmt.Sprintf("%s is already on the trip", name))
+			return false
+		}
+		known[key] = true
+		if uid != "" {
+			known[uid] = true
+		}
+		return true
+	}
+
+	data := &bt.ExportedTrip{
+		Transportations: make([]*bt.Transportation, 0),
+		Lodgings:        make([]*bt.Lodging, 0),
+		Activities:      make([]*bt.Activity, 0),
+	}
+	for _, t := range plans.Transportations {
+		name := fmt.Sprintf("%s from %s to %s", t.Type, t.Origin, t.Destination)
+		if isNew(name, uidOf(t.Metadata), transportationKey(t.Origin, t.Destination, t.Departure)) {
+			data.Transportations = append(data.Transportations, t)
+		}
+	}
+	for _, l := range plans.Lodgings {
+		if isNew(l.Name, uidOf(l.Metadata), planKey("lodgings", l.Name, l.StartDate, time.DateOnly)) {
+			data.Lodgings = append(data.Lodgings, l)
+		}
+	}
+	for _, a := range plans.Activities {
+		if isNew(a.Name, uidOf(a.Metadata), planKey("activities", a.Name, a.StartDate, "2006-01-02T15:04")) {
+			data.Activities = append(data.Activities, a)
+		}
+	}
+
+	records, err := ji.ImportPlans(app, tripId, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return records, warnings, nil
+}
+
+func uidOf(metadata map[string]any) string {
+	uid, _ := metadata["icsUid"].(string)
+	return uid
+}
+
+// recordKey is the key of a saved record, matching the key of the plan it
+// would have been imported from
+func recordKey(record *core.Record) string {
+	switch record.Collection().Name {
+	case "transportations":
+		return transportationKey(record.GetString("origin"), record.GetString("destination"), record.GetDateTime("departureTime"))
+	case "lodgings":
+		return planKey("lodgings", record.GetString("name"), record.GetDateTime("startDate"), time.DateOnly)
+	default:
+		return planKey("activities", record.GetString("name"), record.GetDateTime("startDate"), "2006-01-02T15:04")
+	}
+}
+
+func transportationKey(origin string, destination string, departure types.DateTime) string {
+	return planKey("transportations", origin+"|"+destination, departure, "2006-01-02T15:04")
+}
+
+func planKey(collection string, name string, start types.DateTime, layout string) string {
+	return collection + "|" + strings.ToLower(strings.TrimSpace(name)) + "|" + start.Time().Format(layout)
+}
@@ -0,0 +1,206 @@
+package external
+
+import (
+	bt "backend/types"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	SourceTripIt    = "tripit"
+	SourceWanderlog = "wanderlog"
+)
+
+var ErrUnknownFormat = errors.New("the file is not a TripIt or Wanderlog export")
+
+// Plan is a trip read from another planner, in the shape of a Surmai export
+// so it can go through the regular import. Warnings list what was skipped.
+type Plan struct {
+	Source   string           `json:"source"`
+	Trip     *bt.ExportedTrip `json:"trip"`
+	Warnings []string         `json:"warnings"`
+}
+
+// Parse reads a TripIt or Wanderlog JSON export. An empty source detects the
+// format from the content.
+func Parse(data []byte, source string) (*Plan, error) {
+	var root map[string]json.RawMessage
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, ErrUnknownFormat
+	}
+
+	if source == "" {
+		source = detect(root)
+	}
+
+	var plan *Plan
+	var err error
+	switch source {
+	case SourceTripIt:
+		plan, err = parseTripIt(root)
+	case SourceWanderlog:
+		plan, err = parseWanderlog(root)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fillTripDates(plan.Trip)
+	return plan, nil
+}
+
+func detect(root map[string]json.RawMessage) string {
+	if _, ok := root["Response"]; ok {
+		return SourceTripIt
+	}
+	for _, key := range []string{"Trip", "AirObject", "LodgingObject", "ActivityObject"} {
+		if _, ok := root[key]; ok {
+			return SourceTripIt
+		}
+	}
+	for _, key := range []string{"tripPlan", "itinerary"} {
+		if _, ok := root[key]; ok {
+			return SourceWanderlog
+		}
+	}
+	return ""
+}
+
+func newPlan(source string) *Plan {
+	return &Plan{
+		Source: source,
+		Trip: &bt.ExportedTrip{
+			Trip:            &bt.Trip{Destinations: []bt.Destination{}, Participants: []bt.Participant{}},
+			Transportations: make([]*bt.Transportation, 0),
+			Lodgings:        make([]*bt.Lodging, 0),
+			Activities:      make([]*bt.Activity, 0),
+		},
+		Warnings: make([]string, 0),
+	}
+}
+
+// fillTripDates uses the first and last plan when the export has no trip dates
+func fillTripDates(trip *bt.ExportedTrip) {
+	var first, last time.Time
+	track := func(dates ...types.DateTime) {
+		for _, d := range dates {
+			if d.IsZero() {
+				continue
+			}
+			if first.IsZero() || d.Time().Before(first) {
+				first = d.Time()
+			}
+			if last.IsZero() || d.Time().After(last) {
+				last = d.Time()
+			}
+		}
+	}
+	for _, t := range trip.Transportations {
+		track(t.Departure, t.Arrival)
+	}
+	for _, l := range trip.Lodgings {
+		track(l.StartDate, l.EndDate)
+	}
+	for _, a := range trip.Activities {
+		track(a.StartDate, a.EndDate)
+	}
+
+	if trip.Trip.StartDate.IsZero() && !first.IsZero() {
+		trip.Trip.StartDate, _ = types.ParseDateTime(dayOf(first))
+	}
+	if trip.Trip.EndDate.IsZero() && !last.IsZero() {
+		trip.Trip.EndDate, _ = types.ParseDateTime(dayOf(last))
+	}
+	if strings.TrimSpace(trip.Trip.Name) == "" {
+		trip.Trip.Name = "Imported trip"
+	}
+}
+
+func dayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// wallClock combines a date and an optional time of day into the local wall
+// clock time Surmai stores, ignoring any offset
+func wallClock(date string, clock string) types.DateTime {
+	date = strings.TrimSpace(date)
+	if len(date) > 10 {
+		clock = firstNonEmpty(clock, date[11:])
+		date = date[:10]
+	}
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return types.DateTime{}
+	}
+
+	clock = strings.TrimSpace(clock)
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if len(clock) >= len(layout) {
+			if parsed, err := time.Parse(layout, clock[:len(layout)]); err == nil {
+				day = day.Add(time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute)
+				break
+			}
+		}
+	}
+
+	dt, _ := types.ParseDateTime(day)
+	return dt
+}
+
+// optionalTime is wallClock for end times, which are left empty rather than
+// set to midnight when only the day is known
+func optionalTime(date string, clock string) types.DateTime {
+	if strings.TrimSpace(clock) == "" && len(strings.TrimSpace(date)) <= 10 {
+		return types.DateTime{}
+	}
+	return wallClock(date, clock)
+}
+
+func place(name string, timezone string, lat float64, lng float64) map[string]any {
+	p := map[string]any{"name": name}
+	if timezone != "" {
+		p["timezone"] = timezone
+	}
+	if lat != 0 || lng != 0 {
+		p["latitude"] = lat
+		p["longitude"] = lng
+	}
+	return p
+}
+
+func cost(value string, currency string) *bt.Cost {
+	value = strings.TrimLeft(strings.TrimSpace(value), "$€£¥")
+	var amount float64
+	if err := json.Unmarshal([]byte(strings.ReplaceAll(value, ",", "")), &amount); err != nil || amount <= 0 {
+		return nil
+	}
+	return &bt.Cost{Value: amount, Currency: strings.ToUpper(strings.TrimSpace(currency))}
+}
+
+// oneOrMany reads a value that the exporter writes as an object when there is
+// a single item and as an array otherwise
+func oneOrMany(raw json.RawMessage) []json.RawMessage {
+	if len(raw) == 0 {
+		return nil
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list
+	}
+	return []json.RawMessage{raw}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,219 @@
+package external
+
+import (
+	bt "backend/types"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TripIt exports follow its API: a Trip object and lists of AirObject,
+// RailObject, LodgingObject, ActivityObject and CarObject, optionally wrapped
+// in a Response object. Single items are written without the array.
+
+type tripItDateTime struct {
+	Date     string `json:"date"`
+	Time     string `json:"time"`
+	Timezone string `json:"timezone"`
+}
+
+type tripItAddress struct {
+	Address   string `json:"address"`
+	Latitude  string `json:"latitude"`
+	Longitude string `json:"longitude"`
+}
+
+type tripItTrip struct {
+	DisplayName     string `json:"display_name"`
+	StartDate       string `json:"start_date"`
+	EndDate         string `json:"end_date"`
+	PrimaryLocation string `json:"primary_location"`
+	Description     string `json:"description"`
+}
+
+type tripItSegment struct {
+	StartDateTime         tripItDateTime `json:"StartDateTime"`
+	EndDateTime           tripItDateTime `json:"EndDateTime"`
+	StartAirportCode      string         `json:"start_airport_code"`
+	EndAirportCode        string         `json:"end_airport_code"`
+	StartCityName         string         `json:"start_city_name"`
+	EndCityName           string         `json:"end_city_name"`
+	StartStationName      string         `json:"start_station_name"`
+	EndStationName        string         `json:"end_station_name"`
+	MarketingAirline      string         `json:"marketing_airline"`
+	MarketingFlightNumber string         `json:"marketing_flight_number"`
+	CarrierName           string         `json:"carrier_name"`
+	TrainNumber           string         `json:"train_number"`
+	Seats                 string         `json:"seats"`
+	ConfirmationNum       string         `json:"confirmation_num"`
+}
+
+type tripItReservation struct {
+	Segment         json.RawMessage `json:"Segment"`
+	SupplierName    string          `json:"supplier_name"`
+	SupplierConfNum string          `json:"supplier_conf_num"`
+	BookingConfNum  string          `json:"booking_site_conf_num"`
+	DisplayName     string          `json:"display_name"`
+	LocationName    string          `json:"location_name"`
+	StartDateTime   tripItDateTime  `json:"StartDateTime"`
+	EndDateTime     tripItDateTime  `json:"EndDateTime"`
+	Address         tripItAddress   `json:"Address"`
+	StartLocation   tripItAddress   `json:"StartLocationAddress"`
+	EndLocation     tripItAddress   `json:"EndLocationAddress"`
+	TotalCost       string          `json:"total_cost"`
+	Currency        string          `json:"currency"`
+	Notes           string          `json:"notes"`
+}
+
+func parseTripIt(root map[string]json.RawMessage) (*Plan, error) {
+	if wrapped, ok := root["Response"]; ok {
+		root = map[string]json.RawMessage{}
+		if err := json.Unmarshal(wrapped, &root); err != nil {
+			return nil, ErrUnknownFormat
+		}
+	}
+
+	plan := newPlan(SourceTripIt)
+
+	for _, raw := range oneOrMany(root["Trip"]) {
+		var trip tripItTrip
+		if err := json.Unmarshal(raw, &trip); err != nil {
+			continue
+		}
+		plan.Trip.Trip.Name = trip.DisplayName
+		plan.Trip.Trip.Description = trip.Description
+		plan.Trip.Trip.StartDate = wallClock(trip.StartDate, "")
+		plan.Trip.Trip.EndDate = wallClock(trip.EndDate, "")
+		if trip.PrimaryLocation != "" {
+			plan.Trip.Trip.Destinations = append(plan.Trip.Trip.Destinations, bt.Destination{Name: trip.PrimaryLocation})
+		}
+		break
+	}
+
+	for _, kind := range []string{"AirObject", "RailObject"} {
+		for _, reservation := range tripItReservations(root[kind], plan, kind) {
+			for _, raw := range oneOrMany(reservation.Segment) {
+				var segment tripItSegment
+				if err := json.Unmarshal(raw, &segment); err != nil {
+					plan.Warnings = append(plan.Warnings, fmt.Sprintf("skipped a %s segment that could not be read", kind))
+					continue
+				}
+				plan.Trip.Transportations = append(plan.Trip.Transportations, tripItTransportation(kind, reservation, segment))
+			}
+		}
+	}
+
+	for _, reservation := range tripItReservations(root["CarObject"], plan, "CarObject") {
+		plan.Trip.Transportations = append(plan.Trip.Transportations, &bt.Transportation{
+			Type:        "rental_car",
+			Origin:      firstNonEmpty(reservation.StartLocation.Address, reservation.LocationName),
+			Destination: firstNonEmpty(reservation.EndLocation.Address, reservation.StartLocation.Address),
+			Departure:   wallClock(reservation.StartDateTime.Date, reservation.StartDateTime.Time),
+			Arrival:     wallClock(reservation.EndDateTime.Date, reservation.EndDateTime.Time),
+			Cost:        cost(reservation.TotalCost, reservation.Currency),
+			Metadata: map[string]any{
+				"provider":           reservation.SupplierName,
+				"reservation":        firstNonEmpty(reservation.SupplierConfNum, reservation.BookingConfNum),
+				"originAddress":      reservation.StartLocation.Address,
+				"destinationAddress": reservation.EndLocation.Address,
+				"origin":             place(reservation.StartLocation.Address, reservation.StartDateTime.Timezone, 0, 0),
+				"destination":        place(reservation.EndLocation.Address, reservation.EndDateTime.Timezone, 0, 0),
+			},
+		})
+	}
+
+	for _, reservation := range tripItReservations(root["LodgingObject"], plan, "LodgingObject") {
+		lat, lng := tripItCoordinates(reservation.Address)
+		plan.Trip.Lodgings = append(plan.Trip.Lodgings, &bt.Lodging{
+			Type:             "hotel",
+			Name:             firstNonEmpty(reservation.SupplierName, reservation.DisplayName),
+			Address:          reservation.Address.Address,
+			ConfirmationCode: firstNonEmpty(reservation.SupplierConfNum, reservation.BookingConfNum),
+			StartDate:        wallClock(reservation.StartDateTime.Date, reservation.StartDateTime.Time),
+			EndDate:          wallClock(reservation.EndDateTime.Date, reservation.EndDateTime.Time),
+			Cost:             cost(reservation.TotalCost, reservation.Currency),
+			Metadata: map[string]any{
+				"place": place(firstNonEmpty(reservation.SupplierName, reservation.DisplayName), reservation.StartDateTime.Timezone, lat, lng),
+			},
+		})
+	}
+
+	for _, reservation := range tripItReservations(root["ActivityObject"], plan, "ActivityObject") {
+		lat, lng := tripItCoordinates(reservation.Address)
+		plan.Trip.Activities = append(plan.Trip.Activities, &bt.Activity{
+			Name:             firstNonEmpty(reservation.DisplayName, reservation.LocationName),
+			Description:      reservation.Notes,
+			Address:          firstNonEmpty(reservation.Address.Address, reservation.LocationName),
+			ConfirmationCode: firstNonEmpty(reservation.SupplierConfNum, reservation.BookingConfNum),
+			StartDate:        wallClock(reservation.StartDateTime.Date, reservation.StartDateTime.Time),
+			EndDate:          optionalTime(reservation.EndDateTime.Date, reservation.EndDateTime.Time),
+			Cost:             cost(reservation.TotalCost, reservation.Currency),
+			Metadata: map[string]any{
+				"place": place(firstNonEmpty(reservation.LocationName, reservation.Address.Address), reservation.StartDateTime.Timezone, lat, lng),
+			},
+		})
+	}
+
+	for _, kind := range []string{"CruiseObject", "TransportObject", "RestaurantObject", "MeetingObject", "NoteObject", "MapObject", "DirectionsObject", "ParkingObject"} {
+		if items := oneOrMany(root[kind]); len(items) > 0 {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("skipped %d %s items", len(items), kind))
+		}
+	}
+
+	return plan, nil
+}
+
+func tripItReservations(raw json.RawMessage, plan *Plan, kind string) []tripItReservation {
+	reservations := make([]tripItReservation, 0)
+	for _, item := range oneOrMany(raw) {
+		var reservation tripItReservation
+		if err := json.Unmarshal(item, &reservation); err != nil {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("skipped a %s that could not be read", kind))
+			continue
+		}
+		reservations = append(reservations, reservation)
+	}
+	return reservations
+}
+
+func tripItTransportation(kind string, reservation tripItReservation, segment tripItSegment) *bt.Transportation {
+	transportation := &bt.Transportation{
+		Type:      "flight",
+		Origin:    firstNonEmpty(segment.StartAirportCode, segment.StartCityName),
+		Departure: wallClock(segment.StartDateTime.Date, segment.StartDateTime.Time),
+		Arrival:   wallClock(segment.EndDateTime.Date, segment.EndDateTime.Time),
+		Cost:      cost(reservation.TotalCost, reservation.Currency),
+		Metadata: map[string]any{
+			"provider":     firstNonEmpty(segment.MarketingAirline, reservation.SupplierName),
+			"reservation":  firstNonEmpty(segment.ConfirmationNum, reservation.SupplierConfNum, reservation.BookingConfNum),
+			"flightNumber": strings.TrimSpace(segment.MarketingFlightNumber),
+		},
+	}
+	transportation.Destination = firstNonEmpty(segment.EndAirportCode, segment.EndCityName)
+
+	if kind == "RailObject" {
+		transportation.Type = "train"
+		transportation.Origin = firstNonEmpty(segment.StartStationName, segment.StartCityName)
+		transportation.Destination = firstNonEmpty(segment.EndStationName, segment.EndCityName)
+		transportation.Metadata["provider"] = firstNonEmpty(segment.CarrierName, reservation.SupplierName)
+		transportation.Metadata["trainNumber"] = segment.TrainNumber
+		delete(transportation.Metadata, "flightNumber")
+	}
+
+	transportation.Metadata["origin"] = place(transportation.Origin, segment.StartDateTime.Timezone, 0, 0)
+	transportation.Metadata["destination"] = place(transportation.Destination, segment.EndDateTime.Timezone, 0, 0)
+	if seats := strings.TrimSpace(segment.Seats); seats != "" {
+		transportation.Metadata["seats"] = seats
+	}
+	return transportation
+}
+
+func tripItCoordinates(address tripItAddress) (float64, float64) {
+	lat, latErr := strconv.ParseFloat(address.Latitude, 64)
+	lng, lngErr := strconv.ParseFloat(address.Longitude, 64)
+	if latErr != nil || lngErr != nil {
+		return 0, 0
+	}
+	return lat, lng
+}
@@ -0,0 +1,166 @@
+package external
+
+import (
+	bt "backend/types"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Wanderlog exports hold a tripPlan with the trip title and dates and an
+// itinerary split into sections, one per day or list. Each section has blocks
+// of type place, flight or hotel; notes and checklists are skipped.
+
+type wanderlogPlan struct {
+	Title     string `json:"title"`
+	StartDate string `json:"startDate"`
+	EndDate   string `json:"endDate"`
+	Itinerary struct {
+		Sections []wanderlogSection `json:"sections"`
+	} `json:"itinerary"`
+}
+
+type wanderlogSection struct {
+	Date    string           `json:"date"`
+	Heading string           `json:"heading"`
+	Blocks  []wanderlogBlock `json:"blocks"`
+}
+
+type wanderlogPlace struct {
+	Name             string `json:"name"`
+	FormattedAddress string `json:"formatted_address"`
+	Geometry         struct {
+		Location struct {
+			Lat float64 `json:"lat"`
+			Lng float64 `json:"lng"`
+		} `json:"location"`
+	} `json:"geometry"`
+}
+
+type wanderlogEndpoint struct {
+	Airport struct {
+		Iata     string `json:"iata"`
+		Name     string `json:"name"`
+		Timezone string `json:"timeZone"`
+	} `json:"airport"`
+	Date string `json:"date"`
+	Time string `json:"time"`
+}
+
+type wanderlogBlock struct {
+	Type       string         `json:"type"`
+	Place      wanderlogPlace `json:"place"`
+	Text       string         `json:"text"`
+	StartTime  string         `json:"startTime"`
+	EndTime    string         `json:"endTime"`
+	FlightInfo struct {
+		Airline struct {
+			Iata string `json:"iata"`
+			Name string `json:"name"`
+		} `json:"airline"`
+		FlightNumber string            `json:"flightNumber"`
+		Depart       wanderlogEndpoint `json:"depart"`
+		Arrive       wanderlogEndpoint `json:"arrive"`
+	} `json:"flightInfo"`
+	Hotel              wanderlogPlace `json:"hotel"`
+	CheckIn            string         `json:"checkIn"`
+	CheckOut           string         `json:"checkOut"`
+	ConfirmationNumber string         `json:"confirmationNumber"`
+	Cost               struct {
+		Amount   json.Number `json:"amount"`
+		Currency string      `json:"currencyCode"`
+	} `json:"cost"`
+}
+
+func parseWanderlog(root map[string]json.RawMessage) (*Plan, error) {
+	raw, ok := root["tripPlan"]
+	if !ok {
+		data, err := json.Marshal(root)
+		if err != nil {
+			return nil, ErrUnknownFormat
+		}
+		raw = data
+	}
+
+	var export wanderlogPlan
+	if err := json.Unmarshal(raw, &export); err != nil {
+		return nil, ErrUnknownFormat
+	}
+
+	plan := newPlan(SourceWanderlog)
+	plan.Trip.Trip.Name = export.Title
+	plan.Trip.Trip.StartDate = wallClock(export.StartDate, "")
+	plan.Trip.Trip.EndDate = wallClock(export.EndDate, "")
+
+	skipped := map[string]int{}
+	for _, section := range export.Itinerary.Sections {
+		for _, block := range section.Blocks {
+			switch block.Type {
+			case "place":
+				if block.Place.Name == "" {
+					skipped["place without a name"]++
+					continue
+				}
+				if section.Date == "" {
+					// saved places that are not on a day of the itinerary
+					skipped["unscheduled place"]++
+					continue
+				}
+				plan.Trip.Activities = append(plan.Trip.Activities, &bt.Activity{
+					Name:        block.Place.Name,
+					Description: block.Text,
+					Address:     block.Place.FormattedAddress,
+					StartDate:   wallClock(section.Date, block.StartTime),
+					EndDate:     optionalTime(section.Date, block.EndTime),
+					Cost:        cost(block.Cost.Amount.String(), block.Cost.Currency),
+					Metadata: map[string]any{
+						"place": place(block.Place.Name, "", block.Place.Geometry.Location.Lat, block.Place.Geometry.Location.Lng),
+					},
+				})
+			case "flight":
+				info := block.FlightInfo
+				plan.Trip.Transportations = append(plan.Trip.Transportations, &bt.Transportation{
+					Type:        "flight",
+					Origin:      firstNonEmpty(info.Depart.Airport.Iata, info.Depart.Airport.Name),
+					Destination: firstNonEmpty(info.Arrive.Airport.Iata, info.Arrive.Airport.Name),
+					Departure:   wallClock(firstNonEmpty(info.Depart.Date, section.Date), info.Depart.Time),
+					Arrival:     wallClock(firstNonEmpty(info.Arrive.Date, section.Date), info.Arrive.Time),
+					Cost:        cost(block.Cost.Amount.String(), block.Cost.Currency),
+					Metadata: map[string]any{
+						"provider":     info.Airline.Name,
+						"reservation":  block.ConfirmationNumber,
+						"flightNumber": strings.TrimSpace(info.Airline.Iata + info.FlightNumber),
+						"origin":       place(info.Depart.Airport.Name, info.Depart.Airport.Timezone, 0, 0),
+						"destination":  place(info.Arrive.Airport.Name, info.Arrive.Airport.Timezone, 0, 0),
+					},
+				})
+			case "hotel":
+				hotel := block.Hotel
+				if hotel.Name == "" {
+					hotel = block.Place
+				}
+				plan.Trip.Lodgings = append(plan.Trip.Lodgings, &bt.Lodging{
+					Type:             "hotel",
+					Name:             hotel.Name,
+					Address:          hotel.FormattedAddress,
+					ConfirmationCode: block.ConfirmationNumber,
+					StartDate:        wallClock(firstNonEmpty(block.CheckIn, section.Date), ""),
+					EndDate:          wallClock(block.CheckOut, ""),
+					Cost:             cost(block.Cost.Amount.String(), block.Cost.Currency),
+					Metadata: map[string]any{
+						"place": place(hotel.Name, "", hotel.Geometry.Location.Lat, hotel.Geometry.Location.Lng),
+					},
+				})
+			default:
+				skipped[firstNonEmpty(block.Type, "unknown")+" block"]++
+			}
+		}
+	}
+
+	for kind, count := range skipped {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("skipped %d %s items", count, kind))
+	}
+	sort.Strings(plan.Warnings)
+	return plan, nil
+}
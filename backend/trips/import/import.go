@@ -28,7 +28,12 @@ func Import(e core.App, file multipart.File, ownerId string) (string, error) {
 		return "", err
 	}
 
-	fileContents := buff.Bytes()
+	return ImportBytes(e, buff.Bytes(), ownerId)
+}
+
+// ImportBytes imports a trip from an already loaded zip archive or json export
+func ImportBytes(e core.App, fileContents []byte, ownerId string) (string, error) {
+
 	reader, zipErr := openZipFile(fileContents)
 	if zipErr != nil {
 		return ji.ImportJsonFile(e, fileContents, ownerId)
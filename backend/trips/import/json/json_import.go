@@ -16,22 +16,64 @@ func ImportJsonFile(e core.App, fileContents []byte, ownerId string) (string, er
 		return "", err
 	}
 
+	return ImportExportedTrip(e, &data, ownerId)
+}
+
+// ImportExportedTrip creates a trip and its plans from an already decoded
+// export, also used for trips converted from other planners
+func ImportExportedTrip(e core.App, data *bt.ExportedTrip, ownerId string) (string, error) {
+
 	if data.Trip == nil {
 		return "", t.Error{Msg: "Cannot parse trip data"}
 	}
 
-	trip, tripError := importBasicTripInfo(e, ownerId, &data)
+	trip, tripError := importBasicTripInfo(e, ownerId, data)
 	if tripError != nil {
 		return "", tripError
 	}
 
-	_, _ = createTransportations(e, trip.Id, &data)
-	_, _ = createLodgings(e, trip.Id, &data)
-	_, _ = createActivities(e, trip.Id, &data)
-	_, _ = createExpenses(e, trip.Id, &data)
+	_, _ = createTransportations(e, trip.Id, data)
+	_, _ = createLodgings(e, trip.Id, data)
+	activities, _ := createActivities(e, trip.Id, data)
+	_, _ = createRentals(e, trip.Id, data, activities)
+	_, _ = createTickets(e, trip.Id, data, activities)
+	_, _ = createCarRentals(e, trip.Id, data)
+	_, _ = createDining(e, trip.Id, data)
+	_, _ = createExpenses(e, trip.Id, data)
 	return trip.Id, nil
 }
 
+// ImportPlans adds transportations, lodgings, activities, car rentals and
+// restaurant reservations to an existing trip, e.g. the reservations of a
+// calendar file
+func ImportPlans(app core.App, tripId string, data *bt.ExportedTrip) ([]*core.Record, error) {
+	transportations, err := createTransportations(app, tripId, data)
+	if err != nil {
+		return nil, err
+	}
+	lodgings, err := createLodgings(app, tripId, data)
+	if err != nil {
+		return nil, err
+	}
+	activities, err := createActivities(app, tripId, data)
+	if err != nil {
+		return nil, err
+	}
+	carRentals, err := createCarRentals(app, tripId, data)
+	if err != nil {
+		return nil, err
+	}
+	dining, err := createDining(app, tripId, data)
+	if err != nil {
+		return nil, err
+	}
+
+	records := append(transportations, lodgings...)
+	records = append(records, activities...)
+	records = append(records, carRentals...)
+	return append(records, dining...), nil
+}
+
 func createTransportations(app core.App, tripId string, tripData *bt.ExportedTrip) ([]*core.Record, error) {
 
 	collection, _ := app.FindCollectionByNameOrId("transportations")
@@ -44,7 +86,11 @@ func createTransportations(app core.App, tripId string, tripData *bt.ExportedTri
 			record.Set("destination", tr.Destination)
 			record.Set("departureTime", tr.Departure)
 			record.Set("arrivalTime", tr.Arrival)
+			record.Set("seats", tr.Seats)
 			record.Set("cost", tr.Cost)
+			record.Set("privacy", tr.Privacy)
+			record.Set("paidBy", tr.PaidBy)
+			record.Set("splitAmong", tr.SplitAmong)
 			record.Set("metadata", tr.Metadata)
 			record.Set("trip", tripId)
 			if tr.Attachments != nil && len(tr.Attachments) > 0 {
@@ -77,6 +123,10 @@ func createLodgings(app core.App, tripId string, tripData *bt.ExportedTrip) ([]*
 			record.Set("startDate", l.StartDate)
 			record.Set("endDate", l.EndDate)
 			record.Set("cost", l.Cost)
+			record.Set("privacy", l.Privacy)
+			record.Set("paidBy", l.PaidBy)
+			record.Set("splitAmong", l.SplitAmong)
+			record.Set("rooms", l.Rooms)
 			record.Set("metadata", l.Metadata)
 			record.Set("trip", tripId)
 			if l.Attachments != nil && len(l.Attachments) > 0 {
@@ -108,7 +158,11 @@ func createActivities(app core.App, tripId string, tripData *bt.ExportedTrip) ([
 			record.Set("address", a.Address)
 			record.Set("confirmationCode", a.ConfirmationCode)
 			record.Set("startDate", a.StartDate)
+			record.Set("endDate", a.EndDate)
 			record.Set("cost", a.Cost)
+			record.Set("privacy", a.Privacy)
+			record.Set("paidBy", a.PaidBy)
+			record.Set("splitAmong", a.SplitAmong)
 			record.Set("metadata", a.Metadata)
 			record.Set("trip", tripId)
 			if a.Attachments != nil && len(a.Attachments) > 0 {
@@ -127,6 +181,137 @@ func createActivities(app core.App, tripId string, tripData *bt.ExportedTrip) ([
 	return records, nil
 }
 
+// createRentals links each rental to the new id of its activity, activities
+// are created in the order of the exported list
+func createRentals(app core.App, tripId string, tripData *bt.ExportedTrip, activities []*core.Record) ([]*core.Record, error) {
+
+	activityMapping := map[string]string{}
+	for i, record := range activities {
+		activityMapping[tripData.Activities[i].Id] = record.Id
+	}
+
+	collection, _ := app.FindCollectionByNameOrId("equipment_rentals")
+	records := make([]*core.Record, 0, len(tripData.Rentals))
+	for _, r := range tripData.Rentals {
+		record := core.NewRecord(collection)
+		record.Set("item", r.Item)
+		record.Set("shop", r.Shop)
+		record.Set("pickupTime", r.PickupTime)
+		record.Set("returnTime", r.ReturnTime)
+		record.Set("deposit", r.Deposit)
+		record.Set("cost", r.Cost)
+		record.Set("privacy", r.Privacy)
+		record.Set("notes", r.Notes)
+		record.Set("activity", activityMapping[r.Activity])
+		record.Set("trip", tripId)
+
+		err := app.Save(record)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// createTickets links each ticket to the new id of its activity, like
+// createRentals
+func createTickets(app core.App, tripId string, tripData *bt.ExportedTrip, activities []*core.Record) ([]*core.Record, error) {
+
+	activityMapping := map[string]string{}
+	for i, record := range activities {
+		activityMapping[tripData.Activities[i].Id] = record.Id
+	}
+
+	collection, _ := app.FindCollectionByNameOrId("tickets")
+	records := make([]*core.Record, 0, len(tripData.Tickets))
+	for _, t := range tripData.Tickets {
+		record := core.NewRecord(collection)
+		record.Set("holder", t.Holder)
+		record.Set("barcode", t.Barcode)
+		record.Set("barcodeFormat", t.BarcodeFormat)
+		record.Set("section", t.Section)
+		record.Set("row", t.Row)
+		record.Set("seat", t.Seat)
+		record.Set("gate", t.Gate)
+		record.Set("entryStart", t.EntryStart)
+		record.Set("entryEnd", t.EntryEnd)
+		record.Set("privacy", t.Privacy)
+		record.Set("notes", t.Notes)
+		record.Set("activity", activityMapping[t.Activity])
+		record.Set("trip", tripId)
+		record.Set("attachmentReferences", t.AttachmentReferences)
+
+		err := app.Save(record)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func createCarRentals(app core.App, tripId string, tripData *bt.ExportedTrip) ([]*core.Record, error) {
+
+	collection, _ := app.FindCollectionByNameOrId("car_rentals")
+	records := make([]*core.Record, 0, len(tripData.CarRentals))
+	for _, r := range tripData.CarRentals {
+		record := core.NewRecord(collection)
+		record.Set("provider", r.Provider)
+		record.Set("pickupLocation", r.PickupLocation)
+		record.Set("dropoffLocation", r.DropoffLocation)
+		record.Set("pickupTime", r.PickupTime)
+		record.Set("dropoffTime", r.DropoffTime)
+		record.Set("confirmationCode", r.ConfirmationCode)
+		record.Set("vehicleClass", r.VehicleClass)
+		record.Set("cost", r.Cost)
+		record.Set("privacy", r.Privacy)
+		record.Set("notes", r.Notes)
+		record.Set("metadata", r.Metadata)
+		record.Set("trip", tripId)
+		record.Set("attachmentReferences", r.AttachmentReferences)
+
+		err := app.Save(record)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func createDining(app core.App, tripId string, tripData *bt.ExportedTrip) ([]*core.Record, error) {
+
+	collection, _ := app.FindCollectionByNameOrId("dining")
+	records := make([]*core.Record, 0, len(tripData.Dining))
+	for _, d := range tripData.Dining {
+		record := core.NewRecord(collection)
+		record.Set("name", d.Name)
+		record.Set("reservationTime", d.ReservationTime)
+		record.Set("partySize", d.PartySize)
+		record.Set("confirmationCode", d.ConfirmationCode)
+		record.Set("cuisine", d.Cuisine)
+		record.Set("address", d.Address)
+		record.Set("cost", d.Cost)
+		record.Set("privacy", d.Privacy)
+		record.Set("notes", d.Notes)
+		record.Set("metadata", d.Metadata)
+		record.Set("trip", tripId)
+		record.Set("attachmentReferences", d.AttachmentReferences)
+
+		err := app.Save(record)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
 func createExpenses(app core.App, tripId string, tripData *bt.ExportedTrip) ([]*core.Record, error) {
 
 	collection, _ := app.FindCollectionByNameOrId("trip_expenses")
@@ -137,9 +322,12 @@ func createExpenses(app core.App, tripId string, tripData *bt.ExportedTrip) ([]*
 			record := core.NewRecord(collection)
 			record.Set("name", e.Name)
 			record.Set("cost", e.Cost)
+			record.Set("privacy", e.Privacy)
 			record.Set("occurredOn", e.OccurredOn)
 			record.Set("notes", e.Notes)
 			record.Set("category", e.Category)
+			record.Set("paidBy", e.PaidBy)
+			record.Set("splitAmong", e.SplitAmong)
 			record.Set("trip", tripId)
 			record.Set("attachmentReferences", e.AttachmentReferences)
 
@@ -168,6 +356,8 @@ func importBasicTripInfo(app core.App, userId string, data *bt.ExportedTrip) (*c
 	record.Set("ownerId", userId)
 	record.Set("notes", tripData.Notes)
 	record.Set("budget", tripData.Budget)
+	record.Set("budgetCategories", tripData.BudgetCategories)
+	record.Set("insurance", tripData.Insurance)
 
 	if tripData.CoverImage != nil {
 		file, fileErr := im.GetFile(tripData.CoverImage)
@@ -0,0 +1,87 @@
+package places
+
+import (
+	bt "backend/types"
+	"fmt"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/ringsaturn/tzf"
+)
+
+// Activities turns saved places into unscheduled activities, without a start
+// date, so they can be planned later by hand or with the assistant. The
+// category is kept in metadata, defaultCategory is used for places without one.
+func Activities(places []Place, defaultCategory string, finder tzf.F) []*bt.Activity {
+	activities := make([]*bt.Activity, 0, len(places))
+	for _, p := range places {
+		place := map[string]any{"name": p.Name}
+		if p.HasCoordinates {
+			place["latitude"] = p.Latitude
+			place["longitude"] = p.Longitude
+			if finder != nil {
+				if tz := finder.GetTimezoneName(p.Longitude, p.Latitude); tz != "" {
+					place["timezone"] = tz
+				}
+			}
+		}
+
+		metadata := map[string]any{"place": place}
+		if category := firstString(p.Category, defaultCategory); category != "" {
+			metadata["category"] = category
+		}
+		if p.URL != "" {
+			metadata["url"] = p.URL
+		}
+
+		activities = append(activities, &bt.Activity{
+			Name:        p.Name,
+			Description: p.Notes,
+			Address:     p.Address,
+			Metadata:    metadata,
+		})
+	}
+	return activities
+}
+
+// CreateActivities saves the activities on the trip, skipping places the
+// trip already has an activity for so a list can be imported again after it
+// grew. The skipped names are returned as warnings.
+func CreateActivities(app core.App, tripId string, activities []*bt.Activity) ([]*core.Record, []string, error) {
+	collection, err := app.FindCollectionByNameOrId("activities")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	existing, err := app.FindAllRecords("activities", dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": tripId}))
+	if err != nil {
+		return nil, nil, err
+	}
+	names := map[string]bool{}
+	for _, record := range existing {
+		names[strings.ToLower(record.GetString("name"))] = true
+	}
+
+	records := make([]*core.Record, 0, len(activities))
+	warnings := make([]string, 0)
+	for _, a := range activities {
+		if names[strings.ToLower(a.Name)] {
+			warnings = append(warnings, fmt.Sprintf("%s is already on the trip", a.Name))
+			continue
+		}
+		names[strings.ToLower(a.Name)] = true
+
+		record := core.NewRecord(collection)
+		record.Set("name", a.Name)
+		record.Set("description", a.Description)
+		record.Set("address", a.Address)
+		record.Set("metadata", a.Metadata)
+		record.Set("trip", tripId)
+		if err := app.Save(record); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", a.Name, err)
+		}
+		records = append(records, record)
+	}
+	return records, warnings, nil
+}
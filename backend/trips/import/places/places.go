@@ -0,0 +1,346 @@
+package places
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrUnknownFormat = errors.New("the file is not a Google Maps list, KML, KMZ or GeoJSON file")
+
+// Place is a saved place read from a list, without a date. Category is left
+// empty when the list does not have one.
+type Place struct {
+	Name           string  `json:"name"`
+	Address        string  `json:"address"`
+	Notes          string  `json:"notes"`
+	Category       string  `json:"category"`
+	URL            string  `json:"url"`
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	HasCoordinates bool    `json:"hasCoordinates"`
+}
+
+// Parse reads the places of a Google Takeout saved list (CSV) or saved places
+// file (GeoJSON), a My Maps export (KML or KMZ) or any GeoJSON or KML file
+// with points. Places without a name are skipped.
+func Parse(data []byte) ([]Place, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, ErrUnknownFormat
+	}
+
+	var places []Place
+	var err error
+	switch {
+	case bytes.HasPrefix(data, []byte("PK")):
+		places, err = parseKMZ(data)
+	case trimmed[0] == '{':
+		places, err = parseGeoJSON(trimmed)
+	case trimmed[0] == '<':
+		places, err = parseKML(trimmed)
+	default:
+		places, err = parseCSV(trimmed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	named := make([]Place, 0, len(places))
+	for _, p := range places {
+		p.Name = strings.TrimSpace(p.Name)
+		if p.Name == "" {
+			continue
+		}
+		p.Address = strings.TrimSpace(p.Address)
+		p.Notes = strings.TrimSpace(p.Notes)
+		p.Category = strings.TrimSpace(p.Category)
+		named = append(named, p)
+	}
+	return named, nil
+}
+
+type geoJSONFeature struct {
+	Geometry struct {
+		Type        string    `json:"type"`
+		Coordinates []float64 `json:"coordinates"`
+	} `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+// Google Takeout writes the name and address in a nested location object,
+// older exports capitalise the keys ("Title", "Location", "Business Name")
+func parseGeoJSON(data []byte) ([]Place, error) {
+	var collection struct {
+		Features []geoJSONFeature `json:"features"`
+	}
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, ErrUnknownFormat
+	}
+
+	places := make([]Place, 0, len(collection.Features))
+	for _, feature := range collection.Features {
+		props := lowerKeys(feature.Properties)
+		location := lowerKeys(asMap(props["location"]))
+
+		p := Place{
+			Name:     firstString(location["name"], location["business name"], props["name"], props["title"]),
+			Address:  firstString(location["address"], props["address"]),
+			Notes:    firstString(props["comment"], props["description"], props["note"], props["notes"]),
+			Category: firstString(props["category"], props["type"], props["tags"]),
+			URL:      firstString(props["google_maps_url"], props["google maps url"], props["url"]),
+		}
+
+		coordinates := feature.Geometry.Coordinates
+		if feature.Geometry.Type == "Point" && len(coordinates) >= 2 && (coordinates[0] != 0 || coordinates[1] != 0) {
+			p.Longitude, p.Latitude, p.HasCoordinates = coordinates[0], coordinates[1], true
+		} else if geo := lowerKeys(asMap(location["geo coordinates"])); geo != nil {
+			lat, latErr := strconv.ParseFloat(firstString(geo["latitude"]), 64)
+			lng, lngErr := strconv.ParseFloat(firstString(geo["longitude"]), 64)
+			if latErr == nil && lngErr == nil {
+				p.Latitude, p.Longitude, p.HasCoordinates = lat, lng, true
+			}
+		}
+		if !p.HasCoordinates {
+			p.Latitude, p.Longitude, p.HasCoordinates = coordinatesFromURL(p.URL)
+		}
+		places = append(places, p)
+	}
+	return places, nil
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlPlacemark struct {
+	Name        string    `xml:"name"`
+	Description string    `xml:"description"`
+	Address     string    `xml:"address"`
+	Data        []kmlData `xml:"ExtendedData>Data"`
+	Point       struct {
+		Coordinates string `xml:"coordinates"`
+	} `xml:"Point"`
+}
+
+type kmlFolder struct {
+	Name       string         `xml:"name"`
+	Folders    []kmlFolder    `xml:"Folder"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+// My Maps puts each layer in a folder, which is used as the category
+func parseKML(data []byte) ([]Place, error) {
+	var doc struct {
+		XMLName  xml.Name  `xml:"kml"`
+		Document kmlFolder `xml:"Document"`
+		Folder   kmlFolder `xml:"Folder"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, ErrUnknownFormat
+	}
+
+	places := make([]Place, 0)
+	places = appendKMLFolder(places, doc.Document, "")
+	places = appendKMLFolder(places, doc.Folder, "")
+	return places, nil
+}
+
+func appendKMLFolder(places []Place, folder kmlFolder, category string) []Place {
+	for _, placemark := range folder.Placemarks {
+		p := Place{
+			Name:     placemark.Name,
+			Address:  placemark.Address,
+			Notes:    stripTags(placemark.Description),
+			Category: category,
+		}
+		for _, data := range placemark.Data {
+			switch strings.ToLower(data.Name) {
+			case "category", "type":
+				p.Category = firstString(data.Value, p.Category)
+			case "address":
+				p.Address = firstString(p.Address, data.Value)
+			case "url", "google maps url":
+				p.URL = data.Value
+			}
+		}
+
+		// longitude,latitude[,altitude]
+		parts := strings.Split(strings.TrimSpace(placemark.Point.Coordinates), ",")
+		if len(parts) >= 2 {
+			lng, lngErr := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+			lat, latErr := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+			if lngErr == nil && latErr == nil {
+				p.Latitude, p.Longitude, p.HasCoordinates = lat, lng, true
+			}
+		}
+		places = append(places, p)
+	}
+	for _, sub := range folder.Folders {
+		places = appendKMLFolder(places, sub, firstString(sub.Name, category))
+	}
+	return places
+}
+
+// KMZ is a zip archive with the KML document, usually doc.kml, at its root
+func parseKMZ(data []byte) ([]Place, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrUnknownFormat
+	}
+	for _, file := range archive.File {
+		if !strings.EqualFold(path.Ext(file.Name), ".kml") {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		contents, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		return parseKML(bytes.TrimSpace(contents))
+	}
+	return nil, ErrUnknownFormat
+}
+
+// Google Takeout writes each saved list as a CSV file named after the list,
+// with Title, Note, URL and, in newer exports, Tags and Comment columns
+func parseCSV(data []byte) ([]Place, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil || len(rows) < 1 {
+		return nil, ErrUnknownFormat
+	}
+
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, ErrUnknownFormat
+	}
+	cell := func(row []string, names ...string) string {
+		for _, name := range names {
+			if i, ok := columns[name]; ok && i < len(row) && strings.TrimSpace(row[i]) != "" {
+				return row[i]
+			}
+		}
+		return ""
+	}
+
+	places := make([]Place, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		p := Place{
+			Name:     cell(row, "title"),
+			Address:  cell(row, "address"),
+			Notes:    strings.TrimSpace(cell(row, "note") + "\n" + cell(row, "comment")),
+			Category: cell(row, "tags", "category"),
+			URL:      cell(row, "url"),
+		}
+		p.Latitude, p.Longitude, p.HasCoordinates = coordinatesFromURL(p.URL)
+		places = append(places, p)
+	}
+	return places, nil
+}
+
+var (
+	atCoordinates   = regexp.MustCompile(`@(-?\d+\.\d+),(-?\d+\.\d+)`)
+	dataCoordinates = regexp.MustCompile(`!3d(-?\d+\.\d+)!4d(-?\d+\.\d+)`)
+	pairCoordinates = regexp.MustCompile(`^\s*(-?\d+\.\d+)\s*,\s*(-?\d+\.\d+)\s*$`)
+)
+
+// coordinatesFromURL reads the coordinates Google Maps links often carry,
+// either in the path (@48.85,2.29 or !3d48.85!4d2.29) or as the query
+func coordinatesFromURL(link string) (float64, float64, bool) {
+	if link == "" {
+		return 0, 0, false
+	}
+
+	var match []string
+	if match = dataCoordinates.FindStringSubmatch(link); match == nil {
+		match = atCoordinates.FindStringSubmatch(link)
+	}
+	if match == nil {
+		if parsed, err := url.Parse(link); err == nil {
+			for _, key := range []string{"query", "q", "ll"} {
+				if match = pairCoordinates.FindStringSubmatch(parsed.Query().Get(key)); match != nil {
+					break
+				}
+			}
+		}
+	}
+	if match == nil {
+		return 0, 0, false
+	}
+
+	lat, latErr := strconv.ParseFloat(match[1], 64)
+	lng, lngErr := strconv.ParseFloat(match[2], 64)
+	if latErr != nil || lngErr != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return 0, 0, false
+	}
+	return lat, lng, true
+}
+
+var htmlTags = regexp.MustCompile(`<[^>]*>`)
+
+// KML descriptions are often HTML
+func stripTags(value string) string {
+	value = strings.NewReplacer("<br>", "\n", "<br/>", "\n", "<br />", "\n").Replace(value)
+	return strings.TrimSpace(htmlTags.ReplaceAllString(value, ""))
+}
+
+func asMap(value any) map[string]any {
+	m, _ := value.(map[string]any)
+	return m
+}
+
+func lowerKeys(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	lowered := make(map[string]any, len(m))
+	for key, value := range m {
+		lowered[strings.ToLower(key)] = value
+	}
+	return lowered
+}
+
+// firstString returns the first non empty value, lists are joined
+func firstString(values ...any) string {
+	for _, value := range values {
+		switch v := value.(type) {
+		case string:
+			if strings.TrimSpace(v) != "" {
+				return strings.TrimSpace(v)
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case []any:
+			parts := make([]string, 0, len(v))
+			for _, item := range v {
+				if s := firstString(item); s != "" {
+					parts = append(parts, s)
+				}
+			}
+			if len(parts) > 0 {
+				return strings.Join(parts, ", ")
+			}
+		}
+	}
+	return ""
+}
@@ -39,8 +39,16 @@ func ImportZip(e core.App, zipReader *zip.Reader, ownerId string) (string, error
 	// create lodgings
 	importLodgings(e, attachmentReferenceMapping, data, tripId)
 
-	// create activities
-	importActivities(e, attachmentReferenceMapping, data, tripId)
+	// create activities with the equipment rented and the tickets for them
+	activityMapping := importActivities(e, attachmentReferenceMapping, data, tripId)
+	importRentals(e, activityMapping, data, tripId)
+	importTickets(e, activityMapping, attachmentReferenceMapping, data, tripId)
+
+	// create car rentals
+	importCarRentals(e, attachmentReferenceMapping, data, tripId)
+
+	// create restaurant reservations
+	importDining(e, attachmentReferenceMapping, data, tripId)
 
 	// create expenses
 	importExpenses(e, attachmentReferenceMapping, data, tripId)
@@ -48,8 +56,9 @@ func ImportZip(e core.App, zipReader *zip.Reader, ownerId string) (string, error
 	return tripId, nil
 }
 
-func importActivities(app core.App, mapping map[string]string, tripData bt.ExportedTrip, tripId string) {
+func importActivities(app core.App, mapping map[string]string, tripData bt.ExportedTrip, tripId string) map[string]string {
 
+	activityMapping := map[string]string{}
 	collection, _ := app.FindCollectionByNameOrId("activities")
 	if tripData.Activities != nil {
 		for _, a := range tripData.Activities {
@@ -59,13 +68,105 @@ func importActivities(app core.App, mapping map[string]string, tripData bt.Expor
 			record.Set("address", a.Address)
 			record.Set("confirmationCode", a.ConfirmationCode)
 			record.Set("startDate", a.StartDate)
+			record.Set("endDate", a.EndDate)
 			record.Set("cost", a.Cost)
+			record.Set("privacy", a.Privacy)
+			record.Set("paidBy", a.PaidBy)
+			record.Set("splitAmong", a.SplitAmong)
 			record.Set("metadata", a.Metadata)
 			record.Set("trip", tripId)
 			record.Set("attachmentReferences", getMappedAttachments(mapping, a.AttachmentReferences))
-			_ = app.Save(record)
+			if err := app.Save(record); err == nil {
+				activityMapping[a.Id] = record.Id
+			}
 		}
 	}
+	return activityMapping
+}
+
+func importRentals(app core.App, activityMapping map[string]string, tripData bt.ExportedTrip, tripId string) {
+
+	collection, _ := app.FindCollectionByNameOrId("equipment_rentals")
+	for _, r := range tripData.Rentals {
+		record := core.NewRecord(collection)
+		record.Set("item", r.Item)
+		record.Set("shop", r.Shop)
+		record.Set("pickupTime", r.PickupTime)
+		record.Set("returnTime", r.ReturnTime)
+		record.Set("deposit", r.Deposit)
+		record.Set("cost", r.Cost)
+		record.Set("privacy", r.Privacy)
+		record.Set("notes", r.Notes)
+		record.Set("activity", activityMapping[r.Activity])
+		record.Set("trip", tripId)
+		_ = app.Save(record)
+	}
+}
+
+func importTickets(app core.App, activityMapping map[string]string, mapping map[string]string, tripData bt.ExportedTrip, tripId string) {
+
+	collection, _ := app.FindCollectionByNameOrId("tickets")
+	for _, t := range tripData.Tickets {
+		record := core.NewRecord(collection)
+		record.Set("holder", t.Holder)
+		record.Set("barcode", t.Barcode)
+		record.Set("barcodeFormat", t.BarcodeFormat)
+		record.Set("section", t.Section)
+		record.Set("row", t.Row)
+		record.Set("seat", t.Seat)
+		record.Set("gate", t.Gate)
+		record.Set("entryStart", t.EntryStart)
+		record.Set("entryEnd", t.EntryEnd)
+		record.Set("privacy", t.Privacy)
+		record.Set("notes", t.Notes)
+		record.Set("activity", activityMapping[t.Activity])
+		record.Set("trip", tripId)
+		record.Set("attachmentReferences", getMappedAttachments(mapping, t.AttachmentReferences))
+		_ = app.Save(record)
+	}
+}
+
+func importCarRentals(app core.App, mapping map[string]string, tripData bt.ExportedTrip, tripId string) {
+
+	collection, _ := app.FindCollectionByNameOrId("car_rentals")
+	for _, r := range tripData.CarRentals {
+		record := core.NewRecord(collection)
+		record.Set("provider", r.Provider)
+		record.Set("pickupLocation", r.PickupLocation)
+		record.Set("dropoffLocation", r.DropoffLocation)
+		record.Set("pickupTime", r.PickupTime)
+		record.Set("dropoffTime", r.DropoffTime)
+		record.Set("confirmationCode", r.ConfirmationCode)
+		record.Set("vehicleClass", r.VehicleClass)
+		record.Set("cost", r.Cost)
+		record.Set("privacy", r.Privacy)
+		record.Set("notes", r.Notes)
+		record.Set("metadata", r.Metadata)
+		record.Set("trip", tripId)
+		record.Set("attachmentReferences", getMappedAttachments(mapping, r.AttachmentReferences))
+		_ = app.Save(record)
+	}
+}
+
+func importDining(app core.App, mapping map[string]string, tripData bt.ExportedTrip, tripId string) {
+
+	collection, _ := app.FindCollectionByNameOrId("dining")
+	for _, d := range tripData.Dining {
+		record := core.NewRecord(collection)
+		record.Set("name", d.Name)
+		record.Set("reservationTime", d.ReservationTime)
+		record.Set("partySize", d.PartySize)
+		record.Set("confirmationCode", d.ConfirmationCode)
+		record.Set("cuisine", d.Cuisine)
+		record.Set("address", d.Address)
+		record.Set("cost", d.Cost)
+		record.Set("privacy", d.Privacy)
+		record.Set("notes", d.Notes)
+		record.Set("metadata", d.Metadata)
+		record.Set("trip", tripId)
+		record.Set("attachmentReferences", getMappedAttachments(mapping, d.AttachmentReferences))
+		_ = app.Save(record)
+	}
 }
 
 func importExpenses(app core.App, mapping map[string]string, tripData bt.ExportedTrip, tripId string) {
@@ -76,9 +177,12 @@ func importExpenses(app core.App, mapping map[string]string, tripData bt.Exporte
 			record := core.NewRecord(collection)
 			record.Set("name", e.Name)
 			record.Set("cost", e.Cost)
+			record.Set("privacy", e.Privacy)
 			record.Set("occurredOn", e.OccurredOn)
 			record.Set("notes", e.Notes)
 			record.Set("category", e.Category)
+			record.Set("paidBy", e.PaidBy)
+			record.Set("splitAmong", e.SplitAmong)
 			record.Set("trip", tripId)
 			record.Set("attachmentReferences", getMappedAttachments(mapping, e.AttachmentReferences))
 			_ = app.Save(record)
@@ -100,6 +204,10 @@ func importLodgings(app core.App, mapping map[string]string, tripData bt.Exporte
 			record.Set("startDate", l.StartDate)
 			record.Set("endDate", l.EndDate)
 			record.Set("cost", l.Cost)
+			record.Set("privacy", l.Privacy)
+			record.Set("paidBy", l.PaidBy)
+			record.Set("splitAmong", l.SplitAmong)
+			record.Set("rooms", l.Rooms)
 			record.Set("metadata", l.Metadata)
 			record.Set("trip", tripId)
 			record.Set("attachmentReferences", getMappedAttachments(mapping, l.AttachmentReferences))
@@ -133,7 +241,11 @@ func importTransportations(e core.App, attachmentReferenceMapping map[string]str
 			record.Set("destination", tr.Destination)
 			record.Set("departureTime", tr.Departure)
 			record.Set("arrivalTime", tr.Arrival)
+			record.Set("seats", tr.Seats)
 			record.Set("cost", tr.Cost)
+			record.Set("privacy", tr.Privacy)
+			record.Set("paidBy", tr.PaidBy)
+			record.Set("splitAmong", tr.SplitAmong)
 			record.Set("metadata", tr.Metadata)
 			record.Set("trip", tripId)
 			record.Set("attachmentReferences", getMappedAttachments(attachmentReferenceMapping, tr.AttachmentReferences))
@@ -179,6 +291,8 @@ func importBasicTripInfo(app core.App, trip *bt.Trip, ownerId string, zipReader
 	record.Set("ownerId", ownerId)
 	record.Set("notes", trip.Notes)
 	record.Set("budget", trip.Budget)
+	record.Set("budgetCategories", trip.BudgetCategories)
+	record.Set("insurance", trip.Insurance)
 
 	if trip.CoverImageFileName != "" {
 		coverImageFile, readError := zipReader.Open(fmt.Sprintf("files/%s", trip.CoverImageFileName))
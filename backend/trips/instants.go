@@ -0,0 +1,158 @@
+package trips
+
+import (
+	bt "backend/types"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/ringsaturn/tzf"
+)
+
+// Itinerary times are stored as the local wall clock time of their place,
+// which alone does not say when they happen. Each of them is stored next to
+// the instant in UTC, in <field>Utc, and the timezone it was read in, in
+// <field>Timezone. The wall clock field stays the one edited.
+
+// InstantCollections are the collections with wall clock times
+var InstantCollections = []string{"transportations", "lodgings", "activities", "equipment_rentals", "car_rentals", "dining", "tickets"}
+
+// times of the records that happen at their activity
+var activityTimes = map[string][]string{
+	"equipment_rentals": {"pickupTime", "returnTime"},
+	"tickets":           {"entryStart", "entryEnd"},
+}
+
+// UtcInstant reads the wall clock time in the timezone. Times falling in a
+// daylight saving gap move forward, repeated times take the first one.
+func UtcInstant(wallClock types.DateTime, timezone string) (types.DateTime, bool) {
+	loc, err := time.LoadLocation(timezone)
+	if wallClock.IsZero() || timezone == "" || err != nil {
+		return types.DateTime{}, false
+	}
+	t := wallClock.Time()
+	local := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc)
+	instant, err := types.ParseDateTime(local.UTC())
+	return instant, err == nil
+}
+
+// StoreInstants fills the UTC instants and timezones of the times of the
+// record, and clears them for times it cannot place. It returns the times
+// with no timezone and whether anything changed.
+func StoreInstants(app core.App, finder tzf.F, record *core.Record) (unresolved []string, changed bool) {
+	for _, zoned := range recordTimezones(app, finder, record) {
+		for _, field := range zoned.fields {
+			utc, zone := types.DateTime{}, ""
+			if !record.GetDateTime(field).IsZero() {
+				var ok bool
+				if utc, ok = UtcInstant(record.GetDateTime(field), zoned.timezone); ok {
+					zone = zoned.timezone
+				} else {
+					unresolved = append(unresolved, fmt.Sprintf("%s/%s %s", record.Collection().Name, record.Id, field))
+				}
+			}
+
+			if !record.GetDateTime(field+"Utc").Equal(utc) || record.GetString(field+"Timezone") != zone {
+				record.Set(field+"Utc", utc)
+				record.Set(field+"Timezone", zone)
+				changed = true
+			}
+		}
+	}
+	return unresolved, changed
+}
+
+type zonedFields struct {
+	timezone string
+	fields   []string
+}
+
+// recordTimezones finds the timezone of each time of the record: the one of
+// its place, derived from the coordinates when missing, then the one all the
+// destinations of the trip share. Rentals and tickets take the timezone of
+// their activity.
+func recordTimezones(app core.App, finder tzf.F, record *core.Record) []zonedFields {
+	collection := record.Collection().Name
+	if times, ok := activityTimes[collection]; ok {
+		timezone := ""
+		if activity, err := app.FindRecordById("activities", record.GetString("activity")); err == nil {
+			timezone = recordTimezones(app, finder, activity)[0].timezone
+		}
+		if timezone == "" {
+			timezone = tripTimezone(app, record.GetString("trip"))
+		}
+		return []zonedFields{{timezone, times}}
+	}
+
+	var metadata map[string]any
+	_ = record.UnmarshalJSONField("metadata", &metadata)
+
+	zoned := make([]zonedFields, 0, len(timedPlaces[collection]))
+	for _, place := range timedPlaces[collection] {
+		timezone := ""
+		if value, ok := metadata[place.key].(map[string]any); ok {
+			timezone, _ = value["timezone"].(string)
+		}
+		if timezone == "" {
+			timezone = DerivePlaceTimezone(finder, metadata, place.key)
+		}
+		if timezone == "" {
+			timezone = tripTimezone(app, record.GetString("trip"))
+		}
+		zoned = append(zoned, zonedFields{timezone, place.fields})
+	}
+	return zoned
+}
+
+// tripTimezone is the timezone of the destinations of the trip when they all
+// have the same one
+func tripTimezone(app core.App, tripId string) string {
+	trip, err := app.FindRecordById("trips", tripId)
+	if err != nil {
+		return ""
+	}
+	var destinations []bt.Destination
+	_ = trip.UnmarshalJSONField("destinations", &destinations)
+
+	timezone := ""
+	for _, destination := range destinations {
+		if destination.TimeZone == "" || (timezone != "" && destination.TimeZone != timezone) {
+			return ""
+		}
+		timezone = destination.TimeZone
+	}
+	return timezone
+}
+
+// MigrateInstants stores the UTC instants of every itinerary record saved
+// before they were kept. Nothing is saved on a dry run.
+func MigrateInstants(app core.App, finder tzf.F, dryRun bool) (*bt.InstantReport, error) {
+	report := &bt.InstantReport{DryRun: dryRun, Unresolved: make([]string, 0)}
+
+	for _, collection := range InstantCollections {
+		records, err := app.FindAllRecords(collection, dbx.NewExp("1 = 1"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			report.Records++
+			unresolved, changed := StoreInstants(app, finder, record)
+			report.Unresolved = append(report.Unresolved, unresolved...)
+			if !changed {
+				continue
+			}
+			report.Updated++
+			if dryRun {
+				continue
+			}
+			// the wall clock times are unchanged, skip the itinerary hooks
+			if err := app.UnsafeWithoutHooks().Save(record); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", collection, record.Id, err)
+			}
+		}
+	}
+	return report, nil
+}
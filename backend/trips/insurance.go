@@ -0,0 +1,114 @@
+package trips
+
+import (
+	bt "backend/types"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// BuildEmergencySheet collects what a traveler needs at hand when something
+// goes wrong: the insurance policy, who is travelling and where they sleep
+func BuildEmergencySheet(app core.App, trip *core.Record) *bt.EmergencySheet {
+
+	sheet := &bt.EmergencySheet{
+		TripId:          trip.Id,
+		TripName:        trip.GetString("name"),
+		StartDate:       trip.GetDateTime("startDate"),
+		EndDate:         trip.GetDateTime("endDate"),
+		Participants:    getParticipants(trip),
+		Destinations:    getDestinations(trip),
+		Lodgings:        exportLodgings(app, trip),
+		Transportations: exportTransportations(app, trip),
+		GeneratedAt:     types.NowDateTime(),
+	}
+	_ = trip.UnmarshalJSONField("insurance", &sheet.Insurance)
+
+	sort.Slice(sheet.Lodgings, func(i, j int) bool {
+		return sheet.Lodgings[i].StartDate.Time().Before(sheet.Lodgings[j].StartDate.Time())
+	})
+	sort.Slice(sheet.Transportations, func(i, j int) bool {
+		return sheet.Transportations[i].Departure.Time().Before(sheet.Transportations[j].Departure.Time())
+	})
+
+	return sheet
+}
+
+// BuildInsuranceClaim compiles the bookings and expenses that overlap the
+// incident window so they can be handed over to the insurer. A zero end means
+// the incident lasted until the end of the trip.
+func BuildInsuranceClaim(app core.App, trip *core.Record, incidentStart time.Time, incidentEnd time.Time, description string) *bt.InsuranceClaim {
+
+	if incidentEnd.IsZero() {
+		incidentEnd = trip.GetDateTime("endDate").Time()
+	}
+
+	claim := &bt.InsuranceClaim{
+		TripId:          trip.Id,
+		TripName:        trip.GetString("name"),
+		Description:     description,
+		Transportations: make([]*bt.Transportation, 0),
+		Lodgings:        make([]*bt.Lodging, 0),
+		Activities:      make([]*bt.Activity, 0),
+		Expenses:        make([]*bt.Expense, 0),
+		GeneratedAt:     types.NowDateTime(),
+	}
+	_ = trip.UnmarshalJSONField("insurance", &claim.Insurance)
+	claim.IncidentStart, _ = types.ParseDateTime(incidentStart)
+	claim.IncidentEnd, _ = types.ParseDateTime(incidentEnd)
+
+	overlaps := func(start types.DateTime, end types.DateTime) bool {
+		if start.IsZero() {
+			return false
+		}
+		if end.IsZero() {
+			end = start
+		}
+		return !start.Time().After(incidentEnd) && !end.Time().Before(incidentStart)
+	}
+
+	totals := map[string]float64{}
+	addCost := func(cost *bt.Cost) {
+		if cost != nil && cost.Value > 0 {
+			totals[strings.ToUpper(cost.Currency)] += cost.Value
+		}
+	}
+
+	for _, t := range exportTransportations(app, trip) {
+		if overlaps(t.Departure, t.Arrival) {
+			claim.Transportations = append(claim.Transportations, t)
+			addCost(t.Cost)
+		}
+	}
+	for _, l := range exportLodgings(app, trip) {
+		if overlaps(l.StartDate, l.EndDate) {
+			claim.Lodgings = append(claim.Lodgings, l)
+			addCost(l.Cost)
+		}
+	}
+	for _, a := range exportActivities(app, trip) {
+		if overlaps(a.StartDate, a.EndDate) {
+			claim.Activities = append(claim.Activities, a)
+			addCost(a.Cost)
+		}
+	}
+	for _, x := range exportExpenses(app, trip) {
+		if overlaps(x.OccurredOn, x.OccurredOn) {
+			claim.Expenses = append(claim.Expenses, x)
+			addCost(x.Cost)
+		}
+	}
+
+	claim.Totals = make([]bt.Cost, 0, len(totals))
+	for currency, value := range totals {
+		claim.Totals = append(claim.Totals, bt.Cost{Value: value, Currency: currency})
+	}
+	sort.Slice(claim.Totals, func(i, j int) bool {
+		return claim.Totals[i].Currency < claim.Totals[j].Currency
+	})
+
+	return claim
+}
@@ -0,0 +1,315 @@
+package trips
+
+import (
+	"backend/notifications"
+	bt "backend/types"
+	"bytes"
+	"errors"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// InvitationLifetime is how long an invitation, and its accept link, stays open
+const InvitationLifetime = 7 * 24 * time.Hour
+
+var (
+	ErrInvitationClosed    = errors.New("the invitation is no longer open")
+	ErrInvitationExpired   = errors.New("the invitation has expired")
+	ErrInvitationRecipient = errors.New("the invitation was sent to another email address")
+	ErrInvalidInvitation   = errors.New("the invitation link is not valid")
+	ErrInviterNotOwner     = errors.New("the trip can only be handed over by its owner")
+)
+
+const InvitationEmail = `
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org=/TR/xhtml1/DTD/xhtml1-strict.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+	<meta http-equiv="Content-Type" content="text/html; charset=utf-8" />
+	<meta name="viewport" content="width=device-width, initial-scale=1" />
+    <style>
+        body, html {
+            padding: 0;
+            margin: 0;
+            border: 0;
+            color: #16161a;
+            background: #fff;
+            font-size: 14px;
+            line-height: 20px;
+            font-weight: normal;
+            font-family: Source Sans Pro, sans-serif, emoji;
+        }
+        body {
+            padding: 20px 30px;
+        }
+        strong {
+            font-weight: bold;
+        }
+        em, i {
+            font-style: italic;
+        }
+        p {
+            display: block;
+            margin: 10px 0;
+            font-family: inherit;
+        }
+        small {
+            font-size: 12px;
+            line-height: 16px;
+        }
+        hr {
+            display: block;
+            height: 1px;
+            border: 0;
+            width: 100%;
+            background: #e1e6ea;
+            margin: 10px 0;
+        }
+        a {
+            color: inherit;
+        }
+        .hidden {
+            display: none !important;
+        }
+        .btn {
+            display: inline-block;
+            vertical-align: top;
+            border: 0;
+            cursor: pointer;
+            color: #fff !important;
+            background: #16161a !important;
+            text-decoration: none !important;
+            line-height: 40px;
+            width: auto;
+            min-width: 150px;
+            text-align: center;
+            padding: 0 20px;
+            margin: 5px 0;
+            font-family: Source Sans Pro, sans-serif, emoji;;
+            font-size: 14px;
+            font-weight: bold;
+            border-radius: 6px;
+            box-sizing: border-box;
+        }
+    </style>
+</head>
+<body>
+<p>Hello,</p>
+<p>{{ .senderName }} has invited you to join "{{ .tripName }}" as {{ .role }}</p>
+<p>Invitation Message:</p>
+<p style="border:1px solid #ccc; padding: 5px 5px 5px 5px"> {{ .invitationMessage }}</p>
+<a class="btn" href="{{ .acceptUrl }}" target="_blank">Accept Invitation</a>
+<p>You can also find the invitation in <a href="{{ .applicationUrl }}/invitations" target="_blank">your invitations</a>.</p>
+<p>This invitation will expire in 1 week.</p>
+<p><i>If you do not have an account, you will have to create with this email address.</i></p>
+<p></p>
+<p>
+  Thanks,<br/>
+  Surmai team
+</p>
+</body>
+</html>
+`
+
+// InvitationRole is the role the recipient joins the trip with, invitations
+// sent before roles existed make editors
+func InvitationRole(invitation *core.Record) string {
+	if role := invitation.GetString("role"); role != "" {
+		return role
+	}
+	return RoleEditor
+}
+
+// OpenInvitation (re)opens the invitation for another week with a new
+// signing key, so the accept links sent before stop working
+func OpenInvitation(invitation *core.Record, trip *core.Record, sender *core.Record, role string) {
+	invitation.Set("trip", trip.Id)
+	invitation.Set("from", sender.Id)
+	invitation.Set("role", role)
+	invitation.Set("metadata", invitationMetadata(trip, sender))
+	invitation.Set("expiresOn", time.Now().Add(InvitationLifetime))
+	invitation.Set("status", bt.Open.String())
+	invitation.Set("tokenKey", security.RandomString(50))
+}
+
+func invitationMetadata(trip *core.Record, sender *core.Record) map[string]interface{} {
+	return map[string]interface{}{
+		"trip": map[string]interface{}{
+			"name":        trip.GetString("name"),
+			"description": trip.GetString("description"),
+			"startDate":   trip.GetDateTime("startDate"),
+			"endDate":     trip.GetDateTime("endDate"),
+		},
+		"sender": map[string]string{
+			"name": sender.GetString("name"),
+		},
+	}
+}
+
+// invitationSigningKey ties the accept link to the invitation's own key and
+// to the key of the users' auth tokens, rotating either revokes the link
+func invitationSigningKey(app core.App, invitation *core.Record) (string, error) {
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		return "", err
+	}
+	if invitation.GetString("tokenKey") == "" {
+		return "", ErrInvalidInvitation
+	}
+	return invitation.GetString("tokenKey") + users.AuthToken.Secret, nil
+}
+
+// NewInvitationToken signs the token of the accept link, it expires with the
+// invitation
+func NewInvitationToken(app core.App, invitation *core.Record) (string, error) {
+	key, err := invitationSigningKey(app, invitation)
+	if err != nil {
+		return "", err
+	}
+	claims := jwt.MapClaims{
+		"type":         "invitation",
+		"invitationId": invitation.Id,
+		"email":        invitation.GetString("recipientEmail"),
+	}
+	return security.NewJWT(claims, key, time.Until(invitation.GetDateTime("expiresOn").Time()))
+}
+
+// FindInvitationByToken returns the invitation the token of an accept link
+// was signed for
+func FindInvitationByToken(app core.App, token string) (*core.Record, error) {
+	unverified, err := security.ParseUnverifiedJWT(token)
+	if err != nil {
+		return nil, ErrInvalidInvitation
+	}
+	invitationId, _ := unverified["invitationId"].(string)
+	if unverified["type"] != "invitation" || invitationId == "" {
+		return nil, ErrInvalidInvitation
+	}
+
+	invitation, err := app.FindRecordById("invitations", invitationId)
+	if err != nil {
+		return nil, ErrInvalidInvitation
+	}
+	key, err := invitationSigningKey(app, invitation)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := security.ParseJWT(token, key)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrInvitationExpired
+	}
+	if err != nil || claims["email"] != invitation.GetString("recipientEmail") {
+		return nil, ErrInvalidInvitation
+	}
+	return invitation, nil
+}
+
+// SendInvitation emails the recipient a link to accept the invitation
+func SendInvitation(app core.App, invitation *core.Record, trip *core.Record, sender *core.Record) error {
+	token, err := NewInvitationToken(app, invitation)
+	if err != nil {
+		return err
+	}
+	applicationUrl := strings.TrimSuffix(app.Settings().Meta.AppURL, "/")
+
+	var emailContents bytes.Buffer
+	invitationEmailTemplate := template.Must(template.New("InvitationEmail").Parse(InvitationEmail))
+	err = invitationEmailTemplate.Execute(&emailContents, map[string]interface{}{
+		"senderName":        sender.GetString("name"),
+		"applicationUrl":    applicationUrl,
+		"acceptUrl":         applicationUrl + "/invitations/accept?token=" + url.QueryEscape(token),
+		"tripId":            trip.Id,
+		"tripName":          trip.GetString("name"),
+		"role":              InvitationRole(invitation),
+		"invitationMessage": invitation.GetString("message"),
+	})
+	if err != nil {
+		return err
+	}
+
+	return notifications.SendEmail(app, invitation.GetString("recipientEmail"), "[surmai] Invitation to collaborate", emailContents.String())
+}
+
+// CheckInvitationOpen reports why the invitation can no longer be accepted,
+// one found past its expiry is marked expired on the way
+func CheckInvitationOpen(app core.App, invitation *core.Record) error {
+	if invitation.GetString("status") != bt.Open.String() {
+		return ErrInvitationClosed
+	}
+	if invitation.GetDateTime("expiresOn").Time().Before(time.Now()) {
+		invitation.Set("status", bt.Expired.String())
+		if err := app.Save(invitation); err != nil {
+			return err
+		}
+		return ErrInvitationExpired
+	}
+	return nil
+}
+
+// AcceptInvitation adds the user to the trip with the role of the
+// invitation, the invitation must still be open and addressed to the user
+func AcceptInvitation(app core.App, invitation *core.Record, user *core.Record) error {
+	if err := CheckInvitationOpen(app, invitation); err != nil {
+		return err
+	}
+	if !strings.EqualFold(invitation.GetString("recipientEmail"), user.GetString("email")) {
+		return ErrInvitationRecipient
+	}
+
+	return app.RunInTransaction(func(txApp core.App) error {
+		trip, err := txApp.FindRecordById("trips", invitation.GetString("trip"))
+		if err != nil {
+			return err
+		}
+		if err := JoinTrip(txApp, trip, user.Id, InvitationRole(invitation), invitation.GetString("from")); err != nil {
+			return err
+		}
+		invitation.Set("status", bt.Accepted.String())
+		return txApp.Save(invitation)
+	})
+}
+
+// JoinTrip adds the user to the trip with the role. Editors and viewers
+// become collaborators, an owner takes the trip over from the one who
+// invited them, who stays on as an editor. Members keep their place when
+// they accept another invitation, only the role changes.
+func JoinTrip(app core.App, trip *core.Record, userId string, role string, invitedBy string) error {
+	if trip.GetString("ownerId") == userId {
+		return nil
+	}
+
+	roles := map[string]string{}
+	_ = trip.UnmarshalJSONField("collaboratorRoles", &roles)
+	collaborators := make([]string, 0)
+	for _, collaborator := range trip.GetStringSlice("collaborators") {
+		if collaborator != userId {
+			collaborators = append(collaborators, collaborator)
+		}
+	}
+
+	switch role {
+	case RoleOwner:
+		previousOwner := trip.GetString("ownerId")
+		if previousOwner != invitedBy {
+			return ErrInviterNotOwner
+		}
+		delete(roles, userId)
+		collaborators = append(collaborators, previousOwner)
+		roles[previousOwner] = RoleEditor
+		trip.Set("ownerId", userId)
+	case RoleEditor, RoleViewer:
+		collaborators = append(collaborators, userId)
+		roles[userId] = role
+	default:
+		return errors.New("unknown role " + role)
+	}
+
+	trip.Set("collaborators", collaborators)
+	trip.Set("collaboratorRoles", roles)
+	return app.Save(trip)
+}
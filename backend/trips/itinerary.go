@@ -0,0 +1,218 @@
+package trips
+
+import (
+	bt "backend/types"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// maxItineraryDaySpan keeps a record with a mistyped end date from filling
+// years of days
+const maxItineraryDaySpan = 90
+
+// itineraryTypeOrder sorts items starting at the same time: arriving first,
+// then checking in, then the activities
+var itineraryTypeOrder = map[string]int{"transportation": 0, "lodging": 1, "activity": 2}
+
+// BuildItinerary merges the transportations, lodgings and activities of a
+// trip into one timeline ordered by start time, the way the trip page shows
+// it, so clients do not have to read the three collections themselves.
+// Private items and fields are left out unless the role is the owner.
+// Activities without a start time are listed as unscheduled.
+func BuildItinerary(app core.App, trip *core.Record, role string) *bt.Itinerary {
+	data := &bt.ExportedTrip{
+		Transportations: exportTransportations(app, trip),
+		Lodgings:        exportLodgings(app, trip),
+		Activities:      exportActivities(app, trip),
+	}
+	if !SeesPrivate(role) {
+		RedactExport(data)
+	}
+
+	items := make([]*bt.ItineraryItem, 0)
+	for _, t := range data.Transportations {
+		items = append(items, transportationItem(t))
+	}
+	for _, l := range data.Lodgings {
+		items = append(items, lodgingItem(l))
+	}
+	for _, a := range data.Activities {
+		items = append(items, activityItem(a))
+	}
+
+	itinerary := &bt.Itinerary{
+		TripId:      trip.Id,
+		TripName:    trip.GetString("name"),
+		StartDate:   trip.GetDateTime("startDate"),
+		EndDate:     trip.GetDateTime("endDate"),
+		Items:       make([]*bt.ItineraryItem, 0, len(items)),
+		Days:        make([]bt.ItineraryDay, 0),
+		Unscheduled: make([]*bt.ItineraryItem, 0),
+		GeneratedAt: types.NowDateTime(),
+	}
+	for _, item := range items {
+		if item.Start.IsZero() {
+			itinerary.Unscheduled = append(itinerary.Unscheduled, item)
+		} else {
+			itinerary.Items = append(itinerary.Items, item)
+		}
+	}
+
+	sort.SliceStable(itinerary.Items, func(i, j int) bool {
+		a, b := itinerary.Items[i], itinerary.Items[j]
+		if !a.Start.Time().Equal(b.Start.Time()) {
+			return a.Start.Time().Before(b.Start.Time())
+		}
+		if a.Type != b.Type {
+			return itineraryTypeOrder[a.Type] < itineraryTypeOrder[b.Type]
+		}
+		return a.Title < b.Title
+	})
+	sort.SliceStable(itinerary.Unscheduled, func(i, j int) bool {
+		return itinerary.Unscheduled[i].Title < itinerary.Unscheduled[j].Title
+	})
+
+	itinerary.Days = itineraryDays(itinerary.Items)
+	return itinerary
+}
+
+func transportationItem(t *bt.Transportation) *bt.ItineraryItem {
+	item := &bt.ItineraryItem{
+		Type:  "transportation",
+		Id:    t.Id,
+		Kind:  t.Type,
+		Title: fmt.Sprintf("%s from %s to %s", capitalize(t.Type), t.Origin, t.Destination),
+		Start: t.Departure,
+		End:   t.Arrival,
+		From:  itineraryPlace(t.Metadata, "origin", t.Origin, ""),
+		To:    itineraryPlace(t.Metadata, "destination", t.Destination, ""),
+		Cost:  t.Cost,
+	}
+	item.ConfirmationCode, _ = t.Metadata["reservation"].(string)
+	setItineraryTimes(item)
+	return item
+}
+
+func lodgingItem(l *bt.Lodging) *bt.ItineraryItem {
+	place := itineraryPlace(l.Metadata, "place", l.Name, l.Address)
+	item := &bt.ItineraryItem{
+		Type:             "lodging",
+		Id:               l.Id,
+		Kind:             l.Type,
+		Title:            l.Name,
+		Start:            l.StartDate,
+		End:              l.EndDate,
+		From:             place,
+		To:               place,
+		Cost:             l.Cost,
+		ConfirmationCode: l.ConfirmationCode,
+	}
+	setItineraryTimes(item)
+	return item
+}
+
+func activityItem(a *bt.Activity) *bt.ItineraryItem {
+	place := itineraryPlace(a.Metadata, "place", a.Name, a.Address)
+	item := &bt.ItineraryItem{
+		Type:             "activity",
+		Id:               a.Id,
+		Title:            a.Name,
+		Description:      a.Description,
+		Start:            a.StartDate,
+		End:              a.EndDate,
+		From:             place,
+		To:               place,
+		Cost:             a.Cost,
+		ConfirmationCode: a.ConfirmationCode,
+	}
+	setItineraryTimes(item)
+	return item
+}
+
+// itineraryPlace reads the place kept under the key of the metadata, the
+// name and address of the record are used when the place has none
+func itineraryPlace(metadata map[string]any, key string, name string, address string) *bt.ItineraryPlace {
+	place := &bt.ItineraryPlace{Name: name, Address: address}
+	stored, _ := metadata[key].(map[string]any)
+	if stored == nil {
+		if name == "" && address == "" {
+			return nil
+		}
+		return place
+	}
+
+	if lat, lng, ok := placeCoordinates(metadata, key); ok {
+		place.Latitude, place.Longitude = &lat, &lng
+	}
+	place.Timezone, _ = stored["timezone"].(string)
+	if place.Name == "" {
+		place.Name, _ = stored["name"].(string)
+	}
+	if place.Address == "" {
+		place.Address, _ = stored["address"].(string)
+	}
+	return place
+}
+
+// setItineraryTimes fills the local date of the item and, when the timezone
+// of its places is known, the instants it starts and ends at
+func setItineraryTimes(item *bt.ItineraryItem) {
+	if item.Start.IsZero() {
+		return
+	}
+	item.Date = item.Start.Time().Format(time.DateOnly)
+	if item.From != nil {
+		item.StartsAt = wallClockInstant(item.Start, item.From.Timezone)
+	}
+	if item.To != nil && !item.End.IsZero() {
+		item.EndsAt = wallClockInstant(item.End, item.To.Timezone)
+	}
+}
+
+func wallClockInstant(value types.DateTime, timezone string) string {
+	location, err := time.LoadLocation(timezone)
+	if timezone == "" || err != nil {
+		return ""
+	}
+	t := value.Time()
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, location).Format(time.RFC3339)
+}
+
+// itineraryDays puts every item on each day from its start to its end date,
+// the days are the local dates of the items
+func itineraryDays(items []*bt.ItineraryItem) []bt.ItineraryDay {
+	byDate := map[string][]string{}
+	for _, item := range items {
+		day := item.Start.Time().Truncate(24 * time.Hour)
+		last := day
+		if !item.End.IsZero() && item.End.Time().After(item.Start.Time()) {
+			last = item.End.Time().Truncate(24 * time.Hour)
+		}
+		for n := 0; !day.After(last) && n < maxItineraryDaySpan; n++ {
+			date := day.Format(time.DateOnly)
+			byDate[date] = append(byDate[date], item.Id)
+			day = day.AddDate(0, 0, 1)
+		}
+	}
+
+	days := make([]bt.ItineraryDay, 0, len(byDate))
+	for date, ids := range byDate {
+		days = append(days, bt.ItineraryDay{Date: date, Items: ids})
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date < days[j].Date
+	})
+	return days
+}
+
+func capitalize(value string) string {
+	if value == "" {
+		return value
+	}
+	return strings.ToUpper(value[:1]) + value[1:]
+}
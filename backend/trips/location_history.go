@@ -0,0 +1,129 @@
+package trips
+
+import (
+	bt "backend/types"
+	"encoding/json"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/samber/lo"
+)
+
+// Kinds of LocationVisit
+const (
+	VisitDestination = "destination"
+	VisitLodging     = "lodging"
+)
+
+// LocationHistory lists where the user was between from and to, across the
+// trips they own or collaborate on that overlap the period: the destinations
+// of each trip over its dates and the lodgings over their nights. Lodgings
+// the owner of a trip keeps private are left out for everyone else.
+func LocationHistory(app core.App, userId string, from types.DateTime, to types.DateTime) (*bt.LocationHistory, error) {
+	history := &bt.LocationHistory{
+		From:      from,
+		To:        to,
+		Countries: make([]string, 0),
+		Visits:    make([]bt.LocationVisit, 0),
+	}
+
+	userTrips, err := app.FindAllRecords("trips",
+		dbx.Or(
+			dbx.HashExp{"ownerId": userId},
+			dbx.Like("collaborators", userId),
+		),
+		dbx.NewExp("startDate <= {:to} AND endDate >= {:from}", dbx.Params{"from": from.String(), "to": to.String()}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(userTrips) == 0 {
+		return history, nil
+	}
+	history.Trips = len(userTrips)
+
+	tripsById := map[string]*core.Record{}
+	destinationsByTrip := map[string][]bt.Destination{}
+	for _, trip := range userTrips {
+		tripsById[trip.Id] = trip
+		var destinations []bt.Destination
+		_ = json.Unmarshal([]byte(trip.GetString("destinations")), &destinations)
+		destinationsByTrip[trip.Id] = destinations
+
+		for _, destination := range destinations {
+			visit := bt.LocationVisit{
+				TripId:   trip.Id,
+				TripName: trip.GetString("name"),
+				Kind:     VisitDestination,
+				Name:     destination.Name,
+				City:     destination.Name,
+				Country:  destination.CountryName,
+				From:     trip.GetDateTime("startDate"),
+				To:       trip.GetDateTime("endDate"),
+			}
+			if lat, latOk := coordinate(destination.Latitude); latOk {
+				if lng, lngOk := coordinate(destination.Longitude); lngOk {
+					visit.Latitude, visit.Longitude = &lat, &lng
+				}
+			}
+			history.Visits = append(history.Visits, visit)
+		}
+	}
+
+	tripIds := lo.Map(userTrips, func(t *core.Record, _ int) interface{} { return t.Id })
+	lodgings, err := app.FindAllRecords("lodgings",
+		dbx.In("trip", tripIds...),
+		dbx.NewExp("startDate <= {:to} AND endDate >= {:from}", dbx.Params{"from": from.String(), "to": to.String()}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, lodging := range lodgings {
+		trip := tripsById[lodging.GetString("trip")]
+		if ItemPrivacy(lodging).Item && trip.GetString("ownerId") != userId {
+			continue
+		}
+
+		visit := bt.LocationVisit{
+			TripId:   trip.Id,
+			TripName: trip.GetString("name"),
+			Kind:     VisitLodging,
+			Name:     strings.TrimSpace(lodging.GetString("name")),
+			Address:  strings.TrimSpace(lodging.GetString("address")),
+			City:     lodgingCity(lodging, destinationsByTrip[trip.Id]),
+			From:     lodging.GetDateTime("startDate"),
+			To:       lodging.GetDateTime("endDate"),
+		}
+		for _, destination := range destinationsByTrip[trip.Id] {
+			if visit.City != "" && destination.Name == visit.City {
+				visit.Country = destination.CountryName
+			}
+		}
+		var metadata map[string]any
+		_ = lodging.UnmarshalJSONField("metadata", &metadata)
+		if lat, lng, ok := placeCoordinates(metadata, "place"); ok {
+			visit.Latitude, visit.Longitude = &lat, &lng
+		}
+		history.Visits = append(history.Visits, visit)
+	}
+
+	for _, visit := range history.Visits {
+		if visit.Country != "" && !slices.Contains(history.Countries, visit.Country) {
+			history.Countries = append(history.Countries, visit.Country)
+		}
+	}
+	sort.Strings(history.Countries)
+	// a trip comes before the lodgings of its first day
+	sort.SliceStable(history.Visits, func(i, j int) bool {
+		a, b := history.Visits[i], history.Visits[j]
+		if !a.From.Equal(b.From) {
+			return a.From.Before(b.From)
+		}
+		return a.Kind == VisitDestination && b.Kind != VisitDestination
+	})
+	return history, nil
+}
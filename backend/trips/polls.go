@@ -0,0 +1,282 @@
+package trips
+
+import (
+	bt "backend/types"
+	"backend/validation"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+const (
+	PollOpen      = "open"
+	PollClosed    = "closed"
+	PollScheduled = "scheduled"
+)
+
+const maxPollOptions = 10
+
+var (
+	ErrPollClosed        = errors.New("the poll is closed")
+	ErrUnknownPollOption = errors.New("the poll has no such option")
+	ErrPollOptionUntimed = errors.New("the option needs a start time to be scheduled")
+)
+
+// NewPollOptions checks the options of a new poll and gives them their ids.
+// A poll needs two options at least, each with a name, and the times that
+// are given must be valid.
+func NewPollOptions(options []bt.PollOption) ([]bt.PollOption, error) {
+	if len(options) < 2 || len(options) > maxPollOptions {
+		return nil, errors.New("a poll needs between 2 and 10 options")
+	}
+	checked := make([]bt.PollOption, 0, len(options))
+	for _, option := range options {
+		option.Id = security.RandomStringWithAlphabet(8, "abcdefghijklmnopqrstuvwxyz0123456789")
+		option, err := CheckPollOption(option)
+		if err != nil {
+			return nil, err
+		}
+		checked = append(checked, option)
+	}
+	return checked, nil
+}
+
+// CheckPollOption checks the name and the times of an option and writes the
+// times the way proposals do
+func CheckPollOption(option bt.PollOption) (bt.PollOption, error) {
+	option.Name = strings.TrimSpace(option.Name)
+	option.Votes = 0
+	if option.Name == "" {
+		return option, errors.New("every option needs a name")
+	}
+
+	var times [2]time.Time
+	for i, value := range []*string{&option.StartTime, &option.EndTime} {
+		if strings.TrimSpace(*value) == "" {
+			*value = ""
+			continue
+		}
+		parsed, err := validation.ParseTimestamp(*value)
+		if err != nil {
+			return option, errors.New("the times of \"" + option.Name + "\" must be valid date/times")
+		}
+		times[i] = parsed
+		*value = parsed.Format(time.RFC3339)
+	}
+	if option.EndTime != "" && option.StartTime == "" {
+		return option, errors.New("\"" + option.Name + "\" has an end time without a start time")
+	}
+	if err := validation.ValidateRange(times[0], times[1]); err != nil {
+		return option, errors.New("\"" + option.Name + "\": " + err.Error())
+	}
+	return option, nil
+}
+
+// PollOptions reads the options of a poll
+func PollOptions(poll *core.Record) []bt.PollOption {
+	options := make([]bt.PollOption, 0)
+	_ = poll.UnmarshalJSONField("options", &options)
+	return options
+}
+
+// PollQuorum is how many votes the poll needs before it is decided, a
+// majority of the members of the trip unless the poll set its own
+func PollQuorum(poll *core.Record, trip *core.Record) int {
+	if quorum := poll.GetInt("quorum"); quorum > 0 {
+		return quorum
+	}
+	members := 1 + len(trip.GetStringSlice("collaborators"))
+	return members/2 + 1
+}
+
+// pollVotes returns the option each member voted for
+func pollVotes(app core.App, poll *core.Record) (map[string]string, error) {
+	records, err := app.FindAllRecords("poll_votes", dbx.HashExp{"poll": poll.Id})
+	if err != nil {
+		return nil, err
+	}
+	votes := make(map[string]string, len(records))
+	for _, record := range records {
+		votes[record.GetString("user")] = record.GetString("option")
+	}
+	return votes, nil
+}
+
+// PollView counts the votes of the poll for the user. Votes of people who
+// left the trip no longer count.
+func PollView(app core.App, poll *core.Record, trip *core.Record, userId string) (bt.Poll, error) {
+	votes, err := pollVotes(app, poll)
+	if err != nil {
+		return bt.Poll{}, err
+	}
+
+	view := bt.Poll{
+		Id:           poll.Id,
+		Question:     poll.GetString("question"),
+		Options:      PollOptions(poll),
+		Status:       poll.GetString("status"),
+		Quorum:       PollQuorum(poll, trip),
+		Vote:         votes[userId],
+		Winner:       poll.GetString("winner"),
+		ActivityId:   poll.GetString("activity"),
+		AutoSchedule: poll.GetBool("autoSchedule"),
+		CreatedBy:    poll.GetString("createdBy"),
+		ClosesAt:     poll.GetDateTime("closesAt"),
+		Created:      poll.GetDateTime("created"),
+	}
+	counts := map[string]int{}
+	for voter, option := range votes {
+		if TripRole(trip, voter) != "" {
+			counts[option]++
+		}
+	}
+	for i := range view.Options {
+		view.Options[i].Votes = counts[view.Options[i].Id]
+		view.VotesCast += view.Options[i].Votes
+	}
+	return view, nil
+}
+
+// pollLeader is the option with the most votes, none when the first place is
+// shared
+func pollLeader(view bt.Poll) (bt.PollOption, bool) {
+	var leader bt.PollOption
+	tied := false
+	for _, option := range view.Options {
+		switch {
+		case option.Votes > leader.Votes:
+			leader, tied = option, false
+		case option.Votes == leader.Votes:
+			tied = true
+		}
+	}
+	return leader, leader.Votes > 0 && !tied
+}
+
+// PollOpenForVotes reports whether members can still vote, a poll past its
+// closing time is closed on the way
+func PollOpenForVotes(app core.App, poll *core.Record) (bool, error) {
+	if poll.GetString("status") != PollOpen {
+		return false, nil
+	}
+	if closesAt := poll.GetDateTime("closesAt"); !closesAt.IsZero() && closesAt.Time().Before(time.Now()) {
+		poll.Set("status", PollClosed)
+		return false, app.Save(poll)
+	}
+	return true, nil
+}
+
+// CastPollVote records the vote of the member, a second vote replaces the
+// first
+func CastPollVote(app core.App, poll *core.Record, userId string, optionId string) error {
+	open, err := PollOpenForVotes(app, poll)
+	if err != nil {
+		return err
+	}
+	if !open {
+		return ErrPollClosed
+	}
+	if _, ok := FindPollOption(poll, optionId); !ok {
+		return ErrUnknownPollOption
+	}
+
+	vote, err := app.FindFirstRecordByFilter("poll_votes", "poll = {:poll} && user = {:user}",
+		dbx.Params{"poll": poll.Id, "user": userId})
+	if err != nil {
+		collection, err := app.FindCollectionByNameOrId("poll_votes")
+		if err != nil {
+			return err
+		}
+		vote = core.NewRecord(collection)
+		vote.Set("poll", poll.Id)
+		vote.Set("user", userId)
+	}
+	vote.Set("option", optionId)
+	return app.Save(vote)
+}
+
+// DecidePoll closes the poll once it has its quorum and one option leads.
+// Polls set to schedule themselves put the winner on the itinerary when it
+// has a start time. It reports whether the poll was decided.
+func DecidePoll(app core.App, poll *core.Record, trip *core.Record) (bool, error) {
+	if poll.GetString("status") != PollOpen {
+		return false, nil
+	}
+	view, err := PollView(app, poll, trip, "")
+	if err != nil {
+		return false, err
+	}
+	winner, ok := pollLeader(view)
+	if view.VotesCast < view.Quorum || !ok {
+		return false, nil
+	}
+
+	if poll.GetBool("autoSchedule") && winner.StartTime != "" {
+		_, err := SchedulePollOption(app, poll, winner)
+		return err == nil, err
+	}
+	poll.Set("winner", winner.Id)
+	poll.Set("status", PollClosed)
+	return true, app.Save(poll)
+}
+
+// PollLeader is the option leading the poll, if one does
+func PollLeader(app core.App, poll *core.Record, trip *core.Record) (bt.PollOption, bool, error) {
+	view, err := PollView(app, poll, trip, "")
+	if err != nil {
+		return bt.PollOption{}, false, err
+	}
+	winner, ok := pollLeader(view)
+	return winner, ok, nil
+}
+
+// SchedulePollOption adds the option to the trip as an activity and closes
+// the poll with it as the winner
+func SchedulePollOption(app core.App, poll *core.Record, option bt.PollOption) (*core.Record, error) {
+	if option.StartTime == "" {
+		return nil, ErrPollOptionUntimed
+	}
+
+	var activity *core.Record
+	err := app.RunInTransaction(func(txApp core.App) error {
+		collection, err := txApp.FindCollectionByNameOrId("activities")
+		if err != nil {
+			return err
+		}
+		activity = core.NewRecord(collection)
+		activity.Set("trip", poll.GetString("trip"))
+		activity.Set("name", option.Name)
+		activity.Set("description", option.Description)
+		activity.Set("address", option.Address)
+		activity.Set("startDate", option.StartTime)
+		if option.EndTime != "" {
+			activity.Set("endDate", option.EndTime)
+		}
+		if option.Timezone != "" {
+			activity.Set("metadata", map[string]any{"place": map[string]any{"timezone": option.Timezone}})
+		}
+		if err := txApp.Save(activity); err != nil {
+			return err
+		}
+
+		poll.Set("winner", option.Id)
+		poll.Set("activity", activity.Id)
+		poll.Set("status", PollScheduled)
+		return txApp.Save(poll)
+	})
+	return activity, err
+}
+
+// FindPollOption returns the option of the poll with the id
+func FindPollOption(poll *core.Record, optionId string) (bt.PollOption, bool) {
+	for _, option := range PollOptions(poll) {
+		if option.Id == optionId {
+			return option, true
+		}
+	}
+	return bt.PollOption{}, false
+}
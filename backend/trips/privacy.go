@@ -0,0 +1,332 @@
+package trips
+
+import (
+	bt "backend/types"
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Parts of a trip item that can be kept private, see types.Privacy
+const (
+	PrivateCost             = "cost"
+	PrivateConfirmationCode = "confirmationCode"
+	PrivateNotes            = "notes"
+)
+
+// PrivacyCollections are the trip items that can be marked private
+var PrivacyCollections = []string{"transportations", "lodgings", "activities", "trip_expenses", "equipment_rentals", "car_rentals", "dining", "tickets"}
+
+var privateFieldNames = map[string]bool{
+	PrivateCost:             true,
+	PrivateConfirmationCode: true,
+	PrivateNotes:            true,
+}
+
+// SeesPrivate reports whether the role may see private items and fields.
+// Only the owner does, editors and viewers get the redacted version.
+func SeesPrivate(role string) bool {
+	return role == RoleOwner
+}
+
+// ItemPrivacy reads the privacy settings of a trip item
+func ItemPrivacy(record *core.Record) bt.Privacy {
+	var privacy bt.Privacy
+	_ = record.UnmarshalJSONField("privacy", &privacy)
+	return privacy
+}
+
+// PrivacyErrors lists the private fields that are not known
+func PrivacyErrors(privacy bt.Privacy) []string {
+	problems := make([]string, 0)
+	for _, field := range privacy.Fields {
+		if !privateFieldNames[field] {
+			problems = append(problems, fmt.Sprintf("%s cannot be made private, use cost, confirmationCode or notes", field))
+		}
+	}
+	return problems
+}
+
+// RedactRecord clears the private fields of a trip item in place, for someone
+// other than the owner. It returns false when the whole item is private and
+// should not be shown at all. Confirmation codes of transportations live in
+// metadata.reservation, the one of a ticket is its barcode, notes of
+// activities are in their description.
+func RedactRecord(record *core.Record) bool {
+	privacy := ItemPrivacy(record)
+	if privacy.Item {
+		return false
+	}
+
+	for _, field := range privacy.Fields {
+		switch field {
+		case PrivateCost:
+			setIfField(record, "cost", nil)
+			setIfField(record, "exchangeRate", nil)
+			setIfField(record, "deposit", nil)
+			redactRecordRooms(record, func(room *bt.Room) { room.Cost = nil })
+		case PrivateConfirmationCode:
+			setIfField(record, "confirmationCode", "")
+			setIfField(record, "barcode", "")
+			redactRecordRooms(record, func(room *bt.Room) { room.ConfirmationCode = "" })
+			var metadata map[string]any
+			if err := record.UnmarshalJSONField("metadata", &metadata); err == nil && metadata != nil {
+				delete(metadata, "reservation")
+				record.Set("metadata", metadata)
+			}
+		case PrivateNotes:
+			setIfField(record, "notes", "")
+			setIfField(record, "description", "")
+		}
+	}
+	return true
+}
+
+// KeepPrivateFields copies the private fields of the stored item back onto
+// an update made by someone other than the owner. They only ever saw the
+// redacted values, which would otherwise overwrite the real ones.
+func KeepPrivateFields(record *core.Record, original *core.Record) {
+	for _, field := range ItemPrivacy(original).Fields {
+		switch field {
+		case PrivateCost:
+			keepField(record, original, "cost")
+			keepField(record, original, "exchangeRate")
+			keepField(record, original, "deposit")
+			keepRecordRooms(record, original, func(room *bt.Room, stored bt.Room) { room.Cost = stored.Cost })
+		case PrivateConfirmationCode:
+			keepField(record, original, "confirmationCode")
+			keepField(record, original, "barcode")
+			keepRecordRooms(record, original, func(room *bt.Room, stored bt.Room) { room.ConfirmationCode = stored.ConfirmationCode })
+			var stored, metadata map[string]any
+			_ = original.UnmarshalJSONField("metadata", &stored)
+			if reservation, ok := stored["reservation"]; ok {
+				if err := record.UnmarshalJSONField("metadata", &metadata); err != nil || metadata == nil {
+					metadata = map[string]any{}
+				}
+				metadata["reservation"] = reservation
+				record.Set("metadata", metadata)
+			}
+		case PrivateNotes:
+			keepField(record, original, "notes")
+			keepField(record, original, "description")
+		}
+	}
+}
+
+// RedactExport removes private items and clears private fields of an
+// exported trip, for exports made by someone other than the owner
+func RedactExport(data *bt.ExportedTrip) {
+	transportations := make([]*bt.Transportation, 0, len(data.Transportations))
+	for _, t := range data.Transportations {
+		hidden, fields := privateFields(t.Privacy)
+		if hidden {
+			continue
+		}
+		if fields[PrivateCost] {
+			t.Cost = nil
+			t.ExchangeRate = nil
+		}
+		if fields[PrivateConfirmationCode] && t.Metadata != nil {
+			delete(t.Metadata, "reservation")
+		}
+		transportations = append(transportations, t)
+	}
+	data.Transportations = transportations
+
+	lodgings := make([]*bt.Lodging, 0, len(data.Lodgings))
+	for _, l := range data.Lodgings {
+		hidden, fields := privateFields(l.Privacy)
+		if hidden {
+			continue
+		}
+		for i := range l.Rooms {
+			if fields[PrivateCost] {
+				l.Rooms[i].Cost = nil
+			}
+			if fields[PrivateConfirmationCode] {
+				l.Rooms[i].ConfirmationCode = ""
+			}
+		}
+		if fields[PrivateCost] {
+			l.Cost = nil
+			l.ExchangeRate = nil
+		}
+		if fields[PrivateConfirmationCode] {
+			l.ConfirmationCode = ""
+		}
+		lodgings = append(lodgings, l)
+	}
+	data.Lodgings = lodgings
+
+	activities := make([]*bt.Activity, 0, len(data.Activities))
+	for _, a := range data.Activities {
+		hidden, fields := privateFields(a.Privacy)
+		if hidden {
+			continue
+		}
+		if fields[PrivateCost] {
+			a.Cost = nil
+			a.ExchangeRate = nil
+		}
+		if fields[PrivateConfirmationCode] {
+			a.ConfirmationCode = ""
+		}
+		if fields[PrivateNotes] {
+			a.Description = ""
+		}
+		activities = append(activities, a)
+	}
+	data.Activities = activities
+
+	expenses := make([]*bt.Expense, 0, len(data.Expenses))
+	for _, x := range data.Expenses {
+		hidden, fields := privateFields(x.Privacy)
+		if hidden {
+			continue
+		}
+		if fields[PrivateCost] {
+			x.Cost = nil
+			x.ExchangeRate = nil
+		}
+		if fields[PrivateNotes] {
+			x.Notes = ""
+		}
+		expenses = append(expenses, x)
+	}
+	data.Expenses = expenses
+
+	rentals := make([]*bt.EquipmentRental, 0, len(data.Rentals))
+	for _, r := range data.Rentals {
+		hidden, fields := privateFields(r.Privacy)
+		if hidden {
+			continue
+		}
+		if fields[PrivateCost] {
+			r.Cost = nil
+			r.ExchangeRate = nil
+			r.Deposit = nil
+		}
+		if fields[PrivateNotes] {
+			r.Notes = ""
+		}
+		rentals = append(rentals, r)
+	}
+	data.Rentals = rentals
+
+	carRentals := make([]*bt.CarRental, 0, len(data.CarRentals))
+	for _, r := range data.CarRentals {
+		hidden, fields := privateFields(r.Privacy)
+		if hidden {
+			continue
+		}
+		if fields[PrivateCost] {
+			r.Cost = nil
+			r.ExchangeRate = nil
+		}
+		if fields[PrivateConfirmationCode] {
+			r.ConfirmationCode = ""
+		}
+		if fields[PrivateNotes] {
+			r.Notes = ""
+		}
+		carRentals = append(carRentals, r)
+	}
+	data.CarRentals = carRentals
+
+	dining := make([]*bt.Dining, 0, len(data.Dining))
+	for _, d := range data.Dining {
+		hidden, fields := privateFields(d.Privacy)
+		if hidden {
+			continue
+		}
+		if fields[PrivateCost] {
+			d.Cost = nil
+			d.ExchangeRate = nil
+		}
+		if fields[PrivateConfirmationCode] {
+			d.ConfirmationCode = ""
+		}
+		if fields[PrivateNotes] {
+			d.Notes = ""
+		}
+		dining = append(dining, d)
+	}
+	data.Dining = dining
+
+	tickets := make([]*bt.Ticket, 0, len(data.Tickets))
+	for _, t := range data.Tickets {
+		hidden, fields := privateFields(t.Privacy)
+		if hidden {
+			continue
+		}
+		if fields[PrivateConfirmationCode] {
+			t.Barcode = ""
+		}
+		if fields[PrivateNotes] {
+			t.Notes = ""
+		}
+		tickets = append(tickets, t)
+	}
+	data.Tickets = tickets
+}
+
+func privateFields(privacy *bt.Privacy) (bool, map[string]bool) {
+	fields := map[string]bool{}
+	if privacy == nil {
+		return false, fields
+	}
+	for _, field := range privacy.Fields {
+		fields[field] = true
+	}
+	return privacy.Item, fields
+}
+
+func setIfField(record *core.Record, name string, value any) {
+	if record.Collection().Fields.GetByName(name) != nil {
+		record.Set(name, value)
+	}
+}
+
+func redactRecordRooms(record *core.Record, redact func(room *bt.Room)) {
+	if record.Collection().Fields.GetByName("rooms") == nil {
+		return
+	}
+	var rooms []bt.Room
+	if err := record.UnmarshalJSONField("rooms", &rooms); err != nil || len(rooms) == 0 {
+		return
+	}
+	for i := range rooms {
+		redact(&rooms[i])
+	}
+	record.Set("rooms", rooms)
+}
+
+func keepField(record *core.Record, original *core.Record, name string) {
+	if record.Collection().Fields.GetByName(name) != nil {
+		record.Set(name, original.Get(name))
+	}
+}
+
+// keepRecordRooms matches rooms by name, rooms added in the update have
+// nothing to keep
+func keepRecordRooms(record *core.Record, original *core.Record, keep func(room *bt.Room, stored bt.Room)) {
+	if record.Collection().Fields.GetByName("rooms") == nil {
+		return
+	}
+	var rooms, stored []bt.Room
+	if err := record.UnmarshalJSONField("rooms", &rooms); err != nil || len(rooms) == 0 {
+		return
+	}
+	_ = original.UnmarshalJSONField("rooms", &stored)
+
+	byName := make(map[string]bt.Room, len(stored))
+	for _, room := range stored {
+		byName[room.Name] = room
+	}
+	for i := range rooms {
+		if room, ok := byName[rooms[i].Name]; ok {
+			keep(&rooms[i], room)
+		}
+	}
+	record.Set("rooms", rooms)
+}
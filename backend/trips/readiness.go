@@ -0,0 +1,163 @@
+package trips
+
+import (
+	bt "backend/types"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Kinds of readiness gaps
+const (
+	GapNightsWithoutStay     = "nights_without_stay"
+	GapMissingTimezone       = "missing_timezone"
+	GapMissingArrival        = "missing_arrival"
+	GapMissingConfirmation   = "missing_confirmation"
+	GapUnscheduledActivities = "unscheduled_activities"
+	GapNoInsurance           = "no_insurance"
+)
+
+// CheckReadiness lists what is still missing from a trip before departure:
+// nights without a place to sleep, plans without a timezone, an arrival time
+// or a confirmation code, saved places not yet scheduled and the travel
+// insurance. Nights spent on an overnight transportation are covered.
+func CheckReadiness(app core.App, trip *core.Record) ([]*bt.ReadinessGap, error) {
+	gaps := make([]*bt.ReadinessGap, 0)
+	covered := map[string]bool{}
+
+	transportations, err := app.FindAllRecords("transportations", dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range transportations {
+		name := fmt.Sprintf("%s from %s to %s", record.GetString("type"), record.GetString("origin"), record.GetString("destination"))
+		coverNights(covered, record.GetDateTime("departureTime").Time(), record.GetDateTime("arrivalTime").Time())
+		gaps = append(gaps, missingTimezones(record, name, "origin", "destination")...)
+		if record.GetDateTime("arrivalTime").IsZero() {
+			gaps = append(gaps, readinessGap(GapMissingArrival, record, name, "has no arrival time"))
+		}
+		if strings.TrimSpace(ConfirmationCode(record)) == "" {
+			gaps = append(gaps, readinessGap(GapMissingConfirmation, record, name, "has no confirmation code"))
+		}
+	}
+
+	lodgings, err := app.FindAllRecords("lodgings", dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range lodgings {
+		name := record.GetString("name")
+		coverNights(covered, record.GetDateTime("startDate").Time(), record.GetDateTime("endDate").Time())
+		gaps = append(gaps, missingTimezones(record, name, "place")...)
+		if strings.TrimSpace(ConfirmationCode(record)) == "" {
+			gaps = append(gaps, readinessGap(GapMissingConfirmation, record, name, "has no confirmation code"))
+		}
+	}
+
+	activities, err := app.FindAllRecords("activities", dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+	if err != nil {
+		return nil, err
+	}
+	unscheduled := 0
+	for _, record := range activities {
+		if record.GetDateTime("startDate").IsZero() {
+			unscheduled++
+			continue
+		}
+		gaps = append(gaps, missingTimezones(record, record.GetString("name"), "place")...)
+	}
+
+	nights := make([]*bt.ReadinessGap, 0)
+	var first, last time.Time
+	addNights := func() {
+		if first.IsZero() {
+			return
+		}
+		detail := fmt.Sprintf("no place to stay the night of %s", first.Format(time.DateOnly))
+		if last.After(first) {
+			detail = fmt.Sprintf("no place to stay the nights of %s to %s", first.Format(time.DateOnly), last.Format(time.DateOnly))
+		}
+		nights = append(nights, &bt.ReadinessGap{Kind: GapNightsWithoutStay, Detail: detail})
+		first = time.Time{}
+	}
+	start := dateOnly(trip.GetDateTime("startDate").Time())
+	end := dateOnly(trip.GetDateTime("endDate").Time())
+	for night := start; !start.IsZero() && night.Before(end); night = night.AddDate(0, 0, 1) {
+		if covered[night.Format(time.DateOnly)] {
+			addNights()
+			continue
+		}
+		// consecutive nights make one gap
+		if first.IsZero() {
+			first = night
+		}
+		last = night
+	}
+	addNights()
+	gaps = append(nights, gaps...)
+
+	if unscheduled > 0 {
+		gaps = append(gaps, &bt.ReadinessGap{
+			Kind:       GapUnscheduledActivities,
+			Collection: "activities",
+			Detail:     fmt.Sprintf("%d saved places are not scheduled yet", unscheduled),
+		})
+	}
+
+	var insurance *bt.Insurance
+	_ = trip.UnmarshalJSONField("insurance", &insurance)
+	if insurance == nil || (insurance.Provider == "" && insurance.PolicyNumber == "") {
+		gaps = append(gaps, &bt.ReadinessGap{Kind: GapNoInsurance, Detail: "no travel insurance is recorded"})
+	}
+
+	return gaps, nil
+}
+
+func readinessGap(kind string, record *core.Record, name string, detail string) *bt.ReadinessGap {
+	return &bt.ReadinessGap{
+		Kind:       kind,
+		Collection: record.Collection().Name,
+		RecordId:   record.Id,
+		Name:       name,
+		Detail:     detail,
+	}
+}
+
+// missingTimezones flags the places of a scheduled plan that have no timezone,
+// at most once per plan
+func missingTimezones(record *core.Record, name string, keys ...string) []*bt.ReadinessGap {
+	var metadata map[string]any
+	_ = record.UnmarshalJSONField("metadata", &metadata)
+
+	missing := make([]string, 0, len(keys))
+	for _, key := range keys {
+		place, _ := metadata[key].(map[string]any)
+		if tz, _ := place["timezone"].(string); tz == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return []*bt.ReadinessGap{readinessGap(GapMissingTimezone, record, name, fmt.Sprintf("has no timezone for its %s", strings.Join(missing, " and ")))}
+}
+
+// coverNights marks the nights between the start and end days as covered
+func coverNights(covered map[string]bool, start time.Time, end time.Time) {
+	if start.IsZero() || end.IsZero() {
+		return
+	}
+	for night := dateOnly(start); night.Before(dateOnly(end)); night = night.AddDate(0, 0, 1) {
+		covered[night.Format(time.DateOnly)] = true
+	}
+}
+
+func dateOnly(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
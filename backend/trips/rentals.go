@@ -0,0 +1,40 @@
+package trips
+
+import (
+	"backend/planning"
+	bt "backend/types"
+	"fmt"
+	"sort"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// RentalConflicts lists rented equipment that is due back after, or too
+// close to, a departure of the same trip. Times are compared as wall clock
+// times like everywhere else in the itinerary.
+func RentalConflicts(app core.App, trip *core.Record) []bt.RentalConflict {
+	conflicts := make([]bt.RentalConflict, 0)
+	transportations := exportTransportations(app, trip)
+
+	for _, rental := range exportRentals(app, trip) {
+		for _, t := range transportations {
+			if !planning.LateReturn(rental.PickupTime.Time(), rental.ReturnTime.Time(), t.Departure.Time()) {
+				continue
+			}
+			conflicts = append(conflicts, bt.RentalConflict{
+				RentalId:         rental.Id,
+				Item:             rental.Item,
+				ReturnTime:       rental.ReturnTime,
+				TransportationId: t.Id,
+				Departure:        t.Departure,
+				Message: fmt.Sprintf("%s is due back at %s but the %s from %s leaves at %s",
+					rental.Item, rental.ReturnTime.Time().Format("Jan 2 15:04"), t.Type, t.Origin, t.Departure.Time().Format("Jan 2 15:04")),
+			})
+		}
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].ReturnTime.Time().Before(conflicts[j].ReturnTime.Time())
+	})
+	return conflicts
+}
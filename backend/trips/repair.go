@@ -0,0 +1,233 @@
+package trips
+
+import (
+	bt "backend/types"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	IssueOrphan       = "orphan"
+	IssueInvalidDates = "invalid_dates"
+	IssueMalformed    = "malformed_json"
+)
+
+var tripChildCollections = []string{"transportations", "lodgings", "activities", "trip_expenses", "equipment_rentals", "car_rentals", "dining", "tickets", "trip_attachments"}
+
+// date ranges checked on each collection, as start field -> end field
+var dateRanges = map[string][2]string{
+	"trips":             {"startDate", "endDate"},
+	"transportations":   {"departureTime", "arrivalTime"},
+	"lodgings":          {"startDate", "endDate"},
+	"activities":        {"startDate", "endDate"},
+	"equipment_rentals": {"pickupTime", "returnTime"},
+	"car_rentals":       {"pickupTime", "dropoffTime"},
+	"tickets":           {"entryStart", "entryEnd"},
+}
+
+// RepairTrips scans a single trip, or every trip when tripId is empty, for
+// data problems. When dryRun is false the fixable problems are corrected.
+func RepairTrips(app core.App, tripId string, dryRun bool) (*bt.RepairReport, error) {
+
+	report := &bt.RepairReport{
+		DryRun: dryRun,
+		Issues: make([]*bt.RepairIssue, 0),
+	}
+
+	var tripRecords []*core.Record
+	if tripId != "" {
+		trip, err := app.FindRecordById("trips", tripId)
+		if err != nil {
+			return nil, err
+		}
+		tripRecords = []*core.Record{trip}
+	} else {
+		all, err := app.FindAllRecords("trips")
+		if err != nil {
+			return nil, err
+		}
+		tripRecords = all
+
+		// orphans only exist when looking at the whole instance
+		orphans, err := findOrphans(app)
+		if err != nil {
+			return nil, err
+		}
+		report.Issues = append(report.Issues, orphans...)
+	}
+
+	for _, trip := range tripRecords {
+		report.TripsScanned++
+		report.Issues = append(report.Issues, checkJsonFields(trip)...)
+		report.Issues = append(report.Issues, checkDates(trip)...)
+
+		for collection := range dateRanges {
+			if collection == "trips" {
+				continue
+			}
+			children, err := app.FindAllRecords(collection, dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+			if err != nil {
+				return nil, err
+			}
+			for _, child := range children {
+				report.Issues = append(report.Issues, checkDates(child)...)
+			}
+		}
+	}
+
+	if !dryRun {
+		applyRepairs(app, report)
+	}
+
+	return report, nil
+}
+
+func findOrphans(app core.App) ([]*bt.RepairIssue, error) {
+	issues := make([]*bt.RepairIssue, 0)
+	for _, collection := range tripChildCollections {
+		records, err := app.FindAllRecords(collection,
+			dbx.NewExp("trip = '' OR trip NOT IN (SELECT id FROM trips)"))
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			issues = append(issues, &bt.RepairIssue{
+				Collection:  collection,
+				RecordId:    record.Id,
+				TripId:      record.GetString("trip"),
+				Kind:        IssueOrphan,
+				Description: "record references a trip that does not exist",
+				Fixable:     true,
+			})
+		}
+	}
+	return issues, nil
+}
+
+func checkJsonFields(trip *core.Record) []*bt.RepairIssue {
+	issues := make([]*bt.RepairIssue, 0)
+	for _, field := range []string{"destinations", "participants"} {
+		raw := strings.TrimSpace(trip.GetString(field))
+		if raw == "" || raw == "null" {
+			continue
+		}
+		var entries []map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &entries); err != nil {
+			issues = append(issues, &bt.RepairIssue{
+				Collection:  "trips",
+				RecordId:    trip.Id,
+				TripId:      trip.Id,
+				Kind:        IssueMalformed,
+				Description: fmt.Sprintf("%s is not a list of objects", field),
+				Fixable:     true,
+			})
+		}
+	}
+	return issues
+}
+
+func checkDates(record *core.Record) []*bt.RepairIssue {
+	collection := record.Collection().Name
+	fields, ok := dateRanges[collection]
+	if !ok {
+		return nil
+	}
+
+	tripId := record.GetString("trip")
+	if collection == "trips" {
+		tripId = record.Id
+	}
+
+	start := record.GetDateTime(fields[0])
+	end := record.GetDateTime(fields[1])
+
+	if start.IsZero() {
+		return []*bt.RepairIssue{{
+			Collection:  collection,
+			RecordId:    record.Id,
+			TripId:      tripId,
+			Kind:        IssueInvalidDates,
+			Description: fmt.Sprintf("%s is missing", fields[0]),
+			Fixable:     false,
+		}}
+	}
+
+	if !end.IsZero() && end.Time().Before(start.Time()) {
+		return []*bt.RepairIssue{{
+			Collection:  collection,
+			RecordId:    record.Id,
+			TripId:      tripId,
+			Kind:        IssueInvalidDates,
+			Description: fmt.Sprintf("%s is before %s", fields[1], fields[0]),
+			Fixable:     true,
+		}}
+	}
+
+	return nil
+}
+
+func applyRepairs(app core.App, report *bt.RepairReport) {
+	for _, issue := range report.Issues {
+		if !issue.Fixable {
+			continue
+		}
+
+		record, err := app.FindRecordById(issue.Collection, issue.RecordId)
+		if err != nil {
+			issue.Error = err.Error()
+			continue
+		}
+
+		switch issue.Kind {
+		case IssueOrphan:
+			err = app.Delete(record)
+		case IssueMalformed:
+			err = repairJsonFields(app, record)
+		case IssueInvalidDates:
+			err = repairDates(app, record)
+		}
+
+		if err != nil {
+			issue.Error = err.Error()
+		} else {
+			issue.Fixed = true
+		}
+	}
+}
+
+func repairJsonFields(app core.App, trip *core.Record) error {
+	for _, field := range []string{"destinations", "participants"} {
+		var entries []map[string]interface{}
+		if err := json.Unmarshal([]byte(trip.GetString(field)), &entries); err == nil {
+			continue
+		}
+
+		// a single object is kept by wrapping it in a list, anything else is dropped
+		var single map[string]interface{}
+		if err := json.Unmarshal([]byte(trip.GetString(field)), &single); err == nil && single != nil {
+			trip.Set(field, []map[string]interface{}{single})
+		} else {
+			trip.Set(field, []map[string]interface{}{})
+		}
+	}
+	return app.Save(trip)
+}
+
+func repairDates(app core.App, record *core.Record) error {
+	fields := dateRanges[record.Collection().Name]
+	start := record.GetDateTime(fields[0])
+	end := record.GetDateTime(fields[1])
+
+	if record.Collection().Name == "activities" {
+		// end date is optional for activities
+		record.Set(fields[1], nil)
+	} else {
+		record.Set(fields[0], end)
+		record.Set(fields[1], start)
+	}
+	return app.Save(record)
+}
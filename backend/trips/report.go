@@ -0,0 +1,254 @@
+package trips
+
+import (
+	"backend/currency"
+	bt "backend/types"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const maxPhotoHighlights = 6
+
+var ErrTripNotEnded = errors.New("the trip has not ended yet")
+
+var photoExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".webp": true, ".heic": true, ".gif": true,
+}
+
+// BuildTripReport summarizes a finished trip: what was spent compared to the
+// budget, which activities happened, how far the travelers went and a few
+// photos. Activities without a status count as completed once the trip is over.
+func BuildTripReport(app core.App, trip *core.Record) (*bt.TripReport, error) {
+	endDate := trip.GetDateTime("endDate")
+	if endDate.IsZero() || endDate.Time().After(time.Now().UTC()) {
+		return nil, ErrTripNotEnded
+	}
+
+	report := &bt.TripReport{
+		TripId:            trip.Id,
+		TripName:          trip.GetString("name"),
+		StartDate:         trip.GetDateTime("startDate"),
+		EndDate:           endDate,
+		SkippedActivities: make([]string, 0),
+		ExpenseAmounts:    make([]bt.ExpenseAmount, 0),
+		PhotoHighlights:   make([]bt.PhotoHighlight, 0),
+		GeneratedAt:       types.NowDateTime(),
+	}
+	_ = trip.UnmarshalJSONField("budget", &report.Budget)
+	if report.Budget != nil && report.Budget.Currency == "" {
+		report.Budget = nil
+	}
+
+	transportations := exportTransportations(app, trip)
+	booked := make([]*bt.Cost, 0)
+	for _, t := range transportations {
+		booked = append(booked, t.Cost)
+		if distance, ok := legDistance(t); ok {
+			report.DistanceKm += distance
+			report.Legs++
+		}
+	}
+	report.DistanceKm = math.Round(report.DistanceKm)
+	for _, l := range exportLodgings(app, trip) {
+		booked = append(booked, l.Cost)
+	}
+	for _, a := range exportActivities(app, trip) {
+		booked = append(booked, a.Cost)
+	}
+	expenses := make([]*bt.Cost, 0)
+	rates := currency.LoadRates(app)
+	for _, x := range exportExpenses(app, trip) {
+		expenses = append(expenses, x.Cost)
+		if x.Cost == nil || x.Cost.Currency == "" {
+			continue
+		}
+		amount := bt.ExpenseAmount{Id: x.Id, Name: x.Name, OccurredOn: x.OccurredOn, Original: *x.Cost, ExchangeRate: x.ExchangeRate}
+		if report.Budget != nil {
+			amount.Converted, _ = ConvertCost(x.Cost, x.ExchangeRate, report.Budget.Currency, rates)
+		}
+		report.ExpenseAmounts = append(report.ExpenseAmounts, amount)
+	}
+	sort.SliceStable(report.ExpenseAmounts, func(i, j int) bool {
+		return report.ExpenseAmounts[i].OccurredOn.Time().Before(report.ExpenseAmounts[j].OccurredOn.Time())
+	})
+
+	report.BookedCosts = sumByCurrency(booked)
+	report.Expenses = sumByCurrency(expenses)
+	report.ActualSpend, report.UnconvertedCosts = actualSpend(report, rates)
+
+	if err := countActivities(app, trip, report); err != nil {
+		return nil, err
+	}
+	report.PhotoHighlights = photoHighlights(app, trip)
+
+	return report, nil
+}
+
+// SaveTripReport stores the report on the trip so it stays available after
+// the plans are edited or removed
+func SaveTripReport(app core.App, trip *core.Record, report *bt.TripReport) error {
+	trip.Set("report", report)
+	return app.Save(trip)
+}
+
+func sumByCurrency(costs []*bt.Cost) []bt.Cost {
+	sums := map[string]float64{}
+	for _, cost := range costs {
+		if cost == nil || cost.Currency == "" {
+			continue
+		}
+		sums[cost.Currency] += cost.Value
+	}
+
+	totals := make([]bt.Cost, 0, len(sums))
+	for code, value := range sums {
+		totals = append(totals, bt.Cost{Value: currency.Round(value, code), Currency: code})
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		return totals[i].Currency < totals[j].Currency
+	})
+	return totals
+}
+
+// actualSpend adds booked costs and expenses in the budget currency, or in
+// the only currency used when there is no budget. Expenses count at the rate
+// locked when they were logged, booked costs at today's rates.
+func actualSpend(report *bt.TripReport, rates map[string]float64) (*bt.Cost, int) {
+	all := append(append([]bt.Cost{}, report.BookedCosts...), report.Expenses...)
+	if len(all) == 0 {
+		return nil, 0
+	}
+
+	target := ""
+	if report.Budget != nil {
+		target = report.Budget.Currency
+	} else {
+		target = all[0].Currency
+		for _, cost := range all {
+			if cost.Currency != target {
+				return nil, 0
+			}
+		}
+	}
+
+	spent := bt.Cost{Currency: target}
+	unconverted := 0
+	for _, cost := range report.BookedCosts {
+		if value, ok := currency.Convert(cost.Value, cost.Currency, target, rates); ok {
+			spent.Value += value
+		} else {
+			unconverted++
+		}
+	}
+	if report.Budget == nil {
+		// a single currency, nothing to convert
+		for _, cost := range report.Expenses {
+			spent.Value += cost.Value
+		}
+	} else {
+		for _, amount := range report.ExpenseAmounts {
+			if amount.Converted != nil {
+				spent.Value += amount.Converted.Value
+			} else {
+				unconverted++
+			}
+		}
+	}
+	spent.Value = currency.Round(spent.Value, target)
+	return &spent, unconverted
+}
+
+func countActivities(app core.App, trip *core.Record, report *bt.TripReport) error {
+	activities, err := app.FindAllRecords("activities",
+		dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+	if err != nil {
+		return err
+	}
+
+	for _, activity := range activities {
+		if activity.GetString("status") == "skipped" {
+			report.ActivitiesSkipped++
+			report.SkippedActivities = append(report.SkippedActivities, activity.GetString("name"))
+		} else {
+			report.ActivitiesCompleted++
+		}
+	}
+	sort.Strings(report.SkippedActivities)
+	return nil
+}
+
+// legDistance is the great-circle distance between the origin and the
+// destination of a transportation, when both places have coordinates
+func legDistance(t *bt.Transportation) (float64, bool) {
+	fromLat, fromLng, fromOk := placeCoordinates(t.Metadata, "origin")
+	toLat, toLng, toOk := placeCoordinates(t.Metadata, "destination")
+	if !fromOk || !toOk {
+		return 0, false
+	}
+
+	const earthRadiusKm = 6371.0
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRadians(toLat - fromLat)
+	dLng := toRadians(toLng - fromLng)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(fromLat))*math.Cos(toRadians(toLat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a)), true
+}
+
+func placeCoordinates(metadata map[string]any, key string) (float64, float64, bool) {
+	place, ok := metadata[key].(map[string]any)
+	if !ok {
+		return 0, 0, false
+	}
+	lat, latOk := coordinate(place["latitude"])
+	lng, lngOk := coordinate(place["longitude"])
+	return lat, lng, latOk && lngOk
+}
+
+func coordinate(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return parsed, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func photoHighlights(app core.App, trip *core.Record) []bt.PhotoHighlight {
+	attachments, err := app.FindAllRecords("trip_attachments",
+		dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+	if err != nil {
+		return []bt.PhotoHighlight{}
+	}
+
+	highlights := make([]bt.PhotoHighlight, 0, maxPhotoHighlights)
+	for _, attachment := range attachments {
+		file := attachment.GetString("file")
+		if !photoExtensions[strings.ToLower(filepath.Ext(file))] {
+			continue
+		}
+		highlights = append(highlights, bt.PhotoHighlight{
+			Id:   attachment.Id,
+			Name: attachment.GetString("name"),
+			Url:  fmt.Sprintf("/api/files/%s/%s/%s", attachment.Collection().Id, attachment.Id, file),
+		})
+		if len(highlights) == maxPhotoHighlights {
+			break
+		}
+	}
+	return highlights
+}
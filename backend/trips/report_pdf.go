@@ -0,0 +1,184 @@
+package trips
+
+import (
+	"backend/currency"
+	bt "backend/types"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	pdfPageWidth    = 595 // A4 in points
+	pdfPageHeight   = 842
+	pdfMargin       = 56
+	pdfLineHeight   = 15
+	pdfFontSize     = 11
+	pdfLineChars    = 90
+	pdfLinesPerPage = (pdfPageHeight - 2*pdfMargin) / pdfLineHeight
+)
+
+// WriteTripReportPDF renders the report as a plain text PDF. It only uses
+// the standard Helvetica font so no font files need to be embedded.
+func WriteTripReportPDF(report *bt.TripReport, out io.Writer) error {
+	return writeTextPDF(reportLines(report), out)
+}
+
+func reportLines(report *bt.TripReport) []string {
+	lines := []string{
+		report.TripName,
+		fmt.Sprintf("%s - %s", report.StartDate.Time().Format("Jan 2, 2006"), report.EndDate.Time().Format("Jan 2, 2006")),
+		"",
+		"Spending",
+	}
+
+	if report.Budget != nil {
+		lines = append(lines, fmt.Sprintf("  Budget: %s", formatCost(*report.Budget)))
+	}
+	lines = append(lines, fmt.Sprintf("  Booked: %s", formatCosts(report.BookedCosts)))
+	lines = append(lines, fmt.Sprintf("  Expenses: %s", formatCosts(report.Expenses)))
+	for _, amount := range report.ExpenseAmounts {
+		if amount.Converted != nil && amount.Converted.Currency != amount.Original.Currency {
+			lines = append(lines, fmt.Sprintf("    - %s: %s (%s)", amount.Name, formatCost(amount.Original), formatCost(*amount.Converted)))
+		}
+	}
+	if report.ActualSpend != nil {
+		lines = append(lines, fmt.Sprintf("  Actual spend: %s", formatCost(*report.ActualSpend)))
+	}
+	if report.UnconvertedCosts > 0 {
+		lines = append(lines, fmt.Sprintf("  %d amounts could not be converted and are not included", report.UnconvertedCosts))
+	}
+
+	lines = append(lines, "", "Activities",
+		fmt.Sprintf("  Completed: %d", report.ActivitiesCompleted),
+		fmt.Sprintf("  Skipped: %d", report.ActivitiesSkipped))
+	for _, name := range report.SkippedActivities {
+		lines = append(lines, "    - "+name)
+	}
+
+	lines = append(lines, "", "Travel",
+		fmt.Sprintf("  Distance: %.0f km over %d legs", report.DistanceKm, report.Legs))
+
+	if len(report.PhotoHighlights) > 0 {
+		lines = append(lines, "", "Photo highlights")
+		for _, photo := range report.PhotoHighlights {
+			lines = append(lines, "  - "+photo.Name)
+		}
+	}
+
+	if report.Narrative != "" {
+		lines = append(lines, "", "Trip story")
+		for _, paragraph := range strings.Split(report.Narrative, "\n") {
+			lines = append(lines, wrapLine(paragraph, pdfLineChars)...)
+		}
+	}
+
+	return lines
+}
+
+func formatCost(cost bt.Cost) string {
+	return currency.FormatCode(cost.Value, cost.Currency)
+}
+
+func formatCosts(costs []bt.Cost) string {
+	if len(costs) == 0 {
+		return "none"
+	}
+	parts := make([]string, 0, len(costs))
+	for _, cost := range costs {
+		parts = append(parts, formatCost(cost))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func wrapLine(text string, width int) []string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return []string{""}
+	}
+
+	lines := make([]string, 0)
+	current := words[0]
+	for _, word := range words[1:] {
+		if len(current)+1+len(word) > width {
+			lines = append(lines, current)
+			current = word
+			continue
+		}
+		current += " " + word
+	}
+	return append(lines, current)
+}
+
+// writeTextPDF lays the lines out top to bottom over as many pages as needed
+func writeTextPDF(lines []string, out io.Writer) error {
+	pages := make([][]string, 0)
+	for start := 0; start < len(lines) || start == 0; start += pdfLinesPerPage {
+		end := min(start+pdfLinesPerPage, len(lines))
+		pages = append(pages, lines[start:end])
+	}
+
+	// objects 1 and 2 are the catalog and the page tree, 3 is the font,
+	// then every page is followed by its content stream
+	objects := make([]string, 3, 3+2*len(pages))
+	kids := make([]string, 0, len(pages))
+	for i, page := range pages {
+		pageID := 4 + 2*i
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageID))
+
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", pdfFontSize, pdfLineHeight, pdfMargin, pdfPageHeight-pdfMargin)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) '\n", escapePDFText(line))
+		}
+		content.WriteString("ET")
+
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+				pdfPageWidth, pdfPageHeight, pageID+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		)
+	}
+	objects[0] = "<< /Type /Catalog /Pages 2 0 R >>"
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+	objects[2] = "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>"
+
+	var doc bytes.Buffer
+	doc.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = doc.Len()
+		fmt.Fprintf(&doc, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := doc.Len()
+	fmt.Fprintf(&doc, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&doc, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&doc, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err := out.Write(doc.Bytes())
+	return err
+}
+
+// escapePDFText escapes string delimiters and replaces characters Helvetica
+// cannot show with WinAnsiEncoding
+func escapePDFText(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r < 32:
+			b.WriteRune(' ')
+		case r > 255:
+			b.WriteRune('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
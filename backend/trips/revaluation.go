@@ -0,0 +1,109 @@
+package trips
+
+import (
+	"backend/currency"
+	bt "backend/types"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+var ErrNoBudgetCurrency = errors.New("the trip has no budget currency to value its costs in")
+
+// Revalue values every cost of the trip in the budget currency at the rate
+// it was booked at and at today's rates, to see how the exchange rates
+// moved the budget. Nothing is locked again. Items the user may not see are
+// left out, as are the private costs, unless includePrivate is set.
+func Revalue(app core.App, trip *core.Record, includePrivate bool, rates map[string]float64) (*bt.Revaluation, error) {
+	var budget bt.Cost
+	_ = trip.UnmarshalJSONField("budget", &budget)
+	if budget.Currency == "" {
+		return nil, ErrNoBudgetCurrency
+	}
+
+	revaluation := &bt.Revaluation{
+		TripId:     trip.Id,
+		Currency:   budget.Currency,
+		RatesDate:  time.Now().UTC().Format(time.DateOnly),
+		Items:      make([]bt.RevaluedCost, 0),
+		Booked:     bt.Cost{Currency: budget.Currency},
+		Current:    bt.Cost{Currency: budget.Currency},
+		Difference: bt.Cost{Currency: budget.Currency},
+	}
+
+	for _, collection := range CostCollections {
+		records, err := app.FindAllRecords(collection, dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			if !includePrivate && !RedactRecord(record) {
+				continue
+			}
+			var cost *bt.Cost
+			if record.UnmarshalJSONField("cost", &cost) != nil || cost == nil || cost.Currency == "" || cost.Value == 0 {
+				continue
+			}
+
+			current, ok := ConvertCost(cost, nil, budget.Currency, rates)
+			if !ok {
+				revaluation.Unconverted++
+				continue
+			}
+			var locked *bt.ExchangeRate
+			_ = record.UnmarshalJSONField("exchangeRate", &locked)
+
+			item := bt.RevaluedCost{
+				Collection:   collection,
+				Id:           record.Id,
+				Name:         ItemLabel(record),
+				Original:     *cost,
+				ExchangeRate: locked,
+				Locked:       cost.Currency == budget.Currency,
+				Booked:       *current,
+				Current:      *current,
+			}
+			if locked != nil && locked.From == cost.Currency && locked.To == budget.Currency && locked.Rate > 0 {
+				booked, _ := ConvertCost(cost, locked, budget.Currency, rates)
+				item.Booked = *booked
+				item.Locked = true
+			}
+			if !item.Locked {
+				revaluation.Unlocked++
+			}
+			item.Difference = currency.Round(item.Current.Value-item.Booked.Value, budget.Currency)
+
+			revaluation.Booked.Value += item.Booked.Value
+			revaluation.Current.Value += item.Current.Value
+			revaluation.Items = append(revaluation.Items, item)
+		}
+	}
+
+	revaluation.Booked.Value = currency.Round(revaluation.Booked.Value, budget.Currency)
+	revaluation.Current.Value = currency.Round(revaluation.Current.Value, budget.Currency)
+	revaluation.Difference.Value = currency.Round(revaluation.Current.Value-revaluation.Booked.Value, budget.Currency)
+	if budget.Value > 0 {
+		revaluation.Budget = &budget
+		revaluation.Remaining = &bt.Cost{Value: currency.Round(budget.Value-revaluation.Current.Value, budget.Currency), Currency: budget.Currency}
+	}
+	return revaluation, nil
+}
+
+// ItemLabel names a trip item, in costs, comments, notifications and the
+// activity log
+func ItemLabel(record *core.Record) string {
+	switch record.Collection().Name {
+	case "transportations":
+		return fmt.Sprintf("%s -> %s", record.GetString("origin"), record.GetString("destination"))
+	case "equipment_rentals":
+		return record.GetString("item")
+	case "car_rentals":
+		return strings.TrimSpace(record.GetString("provider") + " " + record.GetString("pickupLocation"))
+	default:
+		return record.GetString("name")
+	}
+}
@@ -0,0 +1,67 @@
+package trips
+
+import "github.com/pocketbase/pocketbase/core"
+
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// TripRole returns the role of the user on the trip, or an empty string when
+// the user is neither the owner nor a collaborator. Collaborators without an
+// entry in collaboratorRoles are editors, which is how every collaborator
+// worked before roles existed.
+func TripRole(trip *core.Record, userId string) string {
+	if userId == "" {
+		return ""
+	}
+	if trip.GetString("ownerId") == userId {
+		return RoleOwner
+	}
+
+	isCollaborator := false
+	for _, collaborator := range trip.GetStringSlice("collaborators") {
+		if collaborator == userId {
+			isCollaborator = true
+			break
+		}
+	}
+	if !isCollaborator {
+		return ""
+	}
+
+	roles := map[string]string{}
+	_ = trip.UnmarshalJSONField("collaboratorRoles", &roles)
+	if roles[userId] == RoleViewer {
+		return RoleViewer
+	}
+	return RoleEditor
+}
+
+// CanEdit reports whether the role may change the trip's plans
+func CanEdit(role string) bool {
+	return role == RoleOwner || role == RoleEditor
+}
+
+var roleRanks = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// HasRole reports whether the role is at least the minimum one, owners can do
+// what editors can and editors what viewers can
+func HasRole(role string, minimum string) bool {
+	return roleRanks[role] > 0 && roleRanks[role] >= roleRanks[minimum]
+}
+
+// CanInvite reports whether a member with the inviter's role may invite
+// someone with the given role. Only the owner may hand the trip over and
+// viewers may not invite at all.
+func CanInvite(inviterRole string, role string) bool {
+	switch role {
+	case RoleOwner:
+		return inviterRole == RoleOwner
+	case RoleEditor, RoleViewer:
+		return CanEdit(inviterRole)
+	default:
+		return false
+	}
+}
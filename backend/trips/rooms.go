@@ -0,0 +1,124 @@
+package trips
+
+import (
+	"backend/currency"
+	bt "backend/types"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// RoomErrors checks the rooms of a lodging against the participants of its
+// trip: every occupant must be a participant, nobody sleeps in two rooms and
+// a room holds no more people than its capacity. An empty participant list
+// accepts any occupant, older trips do not always name their travelers.
+func RoomErrors(rooms []bt.Room, participants []bt.Participant) []string {
+	known := map[string]bool{}
+	for _, p := range participants {
+		known[strings.ToLower(strings.TrimSpace(p.Name))] = true
+	}
+
+	problems := make([]string, 0)
+	assigned := map[string]string{}
+	for i, room := range rooms {
+		label := roomLabel(room, i)
+		if strings.TrimSpace(room.Name) == "" {
+			problems = append(problems, fmt.Sprintf("room %d needs a name", i+1))
+		}
+		if room.Capacity > 0 && len(room.Occupants) > room.Capacity {
+			problems = append(problems, fmt.Sprintf("%s has %d occupants but only sleeps %d", label, len(room.Occupants), room.Capacity))
+		}
+
+		for _, occupant := range room.Occupants {
+			key := strings.ToLower(strings.TrimSpace(occupant))
+			if len(known) > 0 && !known[key] {
+				problems = append(problems, fmt.Sprintf("%s is not a participant of this trip", occupant))
+				continue
+			}
+			if other, ok := assigned[key]; ok && other != label {
+				problems = append(problems, fmt.Sprintf("%s is already in %s", occupant, other))
+				continue
+			}
+			assigned[key] = label
+		}
+	}
+	return problems
+}
+
+func roomLabel(room bt.Room, index int) string {
+	if name := strings.TrimSpace(room.Name); name != "" {
+		return name
+	}
+	return fmt.Sprintf("room %d", index+1)
+}
+
+// LodgingShares splits the lodging costs of a trip between its participants.
+// Rooms with a cost are paid by their occupants. When no room of a lodging
+// has a cost, the lodging cost is split between everyone assigned to a room,
+// or between all participants when nobody is assigned yet.
+func LodgingShares(app core.App, trip *core.Record, role string) []bt.LodgingShare {
+	var participants []bt.Participant
+	_ = trip.UnmarshalJSONField("participants", &participants)
+
+	everyone := make([]string, 0, len(participants))
+	for _, p := range participants {
+		everyone = append(everyone, p.Name)
+	}
+
+	totals := map[string]map[string]float64{}
+	add := func(people []string, cost *bt.Cost) {
+		if cost == nil || cost.Value <= 0 || len(people) == 0 {
+			return
+		}
+		share := cost.Value / float64(len(people))
+		for _, person := range people {
+			if totals[person] == nil {
+				totals[person] = map[string]float64{}
+			}
+			totals[person][strings.ToUpper(cost.Currency)] += share
+		}
+	}
+
+	// private lodgings and costs only count for the owner
+	lodgings := bt.ExportedTrip{Lodgings: exportLodgings(app, trip)}
+	if !SeesPrivate(role) {
+		RedactExport(&lodgings)
+	}
+
+	for _, lodging := range lodgings.Lodgings {
+		pricedRooms := false
+		occupants := make([]string, 0)
+		for _, room := range lodging.Rooms {
+			if room.Cost != nil && room.Cost.Value > 0 {
+				pricedRooms = true
+				add(room.Occupants, room.Cost)
+			}
+			occupants = append(occupants, room.Occupants...)
+		}
+		if pricedRooms {
+			continue
+		}
+		if len(occupants) == 0 {
+			occupants = everyone
+		}
+		add(occupants, lodging.Cost)
+	}
+
+	shares := make([]bt.LodgingShare, 0, len(totals))
+	for person, byCurrency := range totals {
+		share := bt.LodgingShare{Participant: person, Costs: make([]bt.Cost, 0, len(byCurrency))}
+		for code, value := range byCurrency {
+			share.Costs = append(share.Costs, bt.Cost{Value: currency.Round(value, code), Currency: code})
+		}
+		sort.Slice(share.Costs, func(i, j int) bool {
+			return share.Costs[i].Currency < share.Costs[j].Currency
+		})
+		shares = append(shares, share)
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		return shares[i].Participant < shares[j].Participant
+	})
+	return shares
+}
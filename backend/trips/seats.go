@@ -0,0 +1,77 @@
+package trips
+
+import (
+	bt "backend/types"
+	"fmt"
+	"strings"
+)
+
+// SeatErrors checks the seat assignments of a transportation against the
+// participants of its trip: there are no more assignments than travelers,
+// every assignment names a participant, and nobody gets two places or shares
+// one. As with rooms, an empty participant list accepts any name.
+func SeatErrors(seats []bt.SeatAssignment, participants []bt.Participant) []string {
+	known := map[string]bool{}
+	for _, p := range participants {
+		known[strings.ToLower(strings.TrimSpace(p.Name))] = true
+	}
+
+	problems := make([]string, 0)
+	if len(known) > 0 && len(seats) > len(known) {
+		problems = append(problems, fmt.Sprintf("%d seats are assigned but the trip has %d participants", len(seats), len(known)))
+	}
+
+	seated := map[string]bool{}
+	taken := map[string]string{}
+	for i, assignment := range seats {
+		name := strings.TrimSpace(assignment.Participant)
+		key := strings.ToLower(name)
+		switch {
+		case name == "":
+			problems = append(problems, fmt.Sprintf("seat %d needs a participant", i+1))
+			continue
+		case len(known) > 0 && !known[key]:
+			problems = append(problems, fmt.Sprintf("%s is not a participant of this trip", name))
+			continue
+		case seated[key]:
+			problems = append(problems, fmt.Sprintf("%s has more than one seat", name))
+			continue
+		}
+		seated[key] = true
+
+		place := seatLabel(assignment)
+		if place == "" {
+			problems = append(problems, fmt.Sprintf("%s needs a seat", name))
+			continue
+		}
+		if other, ok := taken[strings.ToLower(place)]; ok {
+			problems = append(problems, fmt.Sprintf("%s and %s are both assigned %s", other, name, place))
+			continue
+		}
+		taken[strings.ToLower(place)] = name
+	}
+	return problems
+}
+
+// SeatSummary renders the assignments as "Ana 14C, Ben coach 5 berth 32"
+func SeatSummary(seats []bt.SeatAssignment) string {
+	parts := make([]string, 0, len(seats))
+	for _, assignment := range seats {
+		parts = append(parts, strings.TrimSpace(assignment.Participant+" "+seatLabel(assignment)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func seatLabel(assignment bt.SeatAssignment) string {
+	seat := strings.TrimSpace(assignment.Seat)
+	if seat == "" {
+		return ""
+	}
+	if kind := strings.TrimSpace(assignment.Kind); kind != "" && kind != "seat" {
+		seat = kind + " " + seat
+	}
+	if coach := strings.TrimSpace(assignment.Coach); coach != "" {
+		seat = "coach " + coach + " " + seat
+	}
+	return seat
+}
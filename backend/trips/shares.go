@@ -0,0 +1,92 @@
+package trips
+
+import (
+	bt "backend/types"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+var (
+	ErrShareNotFound = errors.New("this share link does not exist or was revoked")
+	ErrShareExpired  = errors.New("this share link has expired")
+)
+
+// FindShare returns the share link with the token, as long as it has not
+// expired
+func FindShare(app core.App, token string) (*core.Record, error) {
+	if token == "" {
+		return nil, ErrShareNotFound
+	}
+	share, err := app.FindFirstRecordByFilter("trip_shares", "token = {:token}", dbx.Params{"token": token})
+	if err != nil {
+		return nil, ErrShareNotFound
+	}
+	if expiresOn := share.GetDateTime("expiresOn"); !expiresOn.IsZero() && expiresOn.Time().Before(time.Now()) {
+		return nil, ErrShareExpired
+	}
+	return share, nil
+}
+
+// ShareHasPassword reports whether the link asks for a password
+func ShareHasPassword(share *core.Record) bool {
+	password, _ := share.GetRaw("password").(*core.PasswordFieldValue)
+	return password != nil && password.Hash != ""
+}
+
+// ShareItinerary builds the itinerary the link shows. Private items and
+// fields are never shared, costs and confirmation codes only when the link
+// was made with them.
+func ShareItinerary(app core.App, share *core.Record) (*bt.Itinerary, error) {
+	trip, err := app.FindRecordById("trips", share.GetString("trip"))
+	if err != nil {
+		return nil, ErrShareNotFound
+	}
+
+	itinerary := BuildItinerary(app, trip, RoleViewer)
+	hideCosts := share.GetBool("hideCosts")
+	hideCodes := share.GetBool("hideConfirmationCodes")
+	for _, items := range [][]*bt.ItineraryItem{itinerary.Items, itinerary.Unscheduled} {
+		for _, item := range items {
+			if hideCosts {
+				item.Cost = nil
+			}
+			if hideCodes {
+				item.ConfirmationCode = ""
+			}
+		}
+	}
+	return itinerary, nil
+}
+
+// RecordShareView counts a visit of the link
+func RecordShareView(app core.App, share *core.Record) {
+	share.Set("views", share.GetInt("views")+1)
+	share.Set("lastViewedAt", types.NowDateTime())
+	if err := app.Save(share); err != nil {
+		app.Logger().Warn("Could not count the share link view", "error", err, "shareId", share.Id)
+	}
+}
+
+// ShareSummary describes the link to the members of the trip
+func ShareSummary(app core.App, share *core.Record) bt.TripShare {
+	token := share.GetString("token")
+	return bt.TripShare{
+		Id:                    share.Id,
+		Name:                  share.GetString("name"),
+		Token:                 token,
+		Url:                   strings.TrimSuffix(app.Settings().Meta.AppURL, "/") + "/share/" + token,
+		HasPassword:           ShareHasPassword(share),
+		HideCosts:             share.GetBool("hideCosts"),
+		HideConfirmationCodes: share.GetBool("hideConfirmationCodes"),
+		ExpiresOn:             share.GetDateTime("expiresOn"),
+		Views:                 share.GetInt("views"),
+		LastViewedAt:          share.GetDateTime("lastViewedAt"),
+		CreatedBy:             share.GetString("createdBy"),
+		Created:               share.GetDateTime("created"),
+	}
+}
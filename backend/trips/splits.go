@@ -0,0 +1,306 @@
+package trips
+
+import (
+	"backend/currency"
+	bt "backend/types"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// splitTolerance absorbs the rounding of amounts typed in by hand
+const splitTolerance = 0.01
+
+// SplitCollections are the records that can say who paid for them and how
+// the cost is shared: the expenses and the itinerary items with a cost
+var SplitCollections = []string{"trip_expenses", "activities", "lodgings", "transportations"}
+
+// participantNames maps the lower cased names of the participants of a trip
+// to their names as written on the trip
+func participantNames(participants []bt.Participant) map[string]string {
+	names := make(map[string]string, len(participants))
+	for _, p := range participants {
+		if name := strings.TrimSpace(p.Name); name != "" {
+			names[strings.ToLower(name)] = name
+		}
+	}
+	return names
+}
+
+// SplitErrors checks who paid an expense and how it is split against the
+// participants of the trip, and writes their names the way the trip does.
+// Fixed amounts cannot come to more than the cost, or to less when every
+// part is fixed. An empty participant list accepts any name, like rooms do.
+func SplitErrors(paidBy *string, cost *bt.Cost, splits []bt.ExpenseSplit, participants []bt.Participant) []string {
+	known := participantNames(participants)
+	canonical := func(name string) (string, bool) {
+		name = strings.TrimSpace(name)
+		if len(known) == 0 {
+			return name, true
+		}
+		found, ok := known[strings.ToLower(name)]
+		return found, ok
+	}
+
+	problems := make([]string, 0)
+	if strings.TrimSpace(*paidBy) != "" {
+		if name, ok := canonical(*paidBy); ok {
+			*paidBy = name
+		} else {
+			problems = append(problems, fmt.Sprintf("%s is not a participant of this trip", strings.TrimSpace(*paidBy)))
+		}
+	} else if len(splits) > 0 {
+		problems = append(problems, "say who paid the expense to split it")
+	}
+
+	seen := map[string]bool{}
+	fixed, allFixed := 0.0, true
+	for i, split := range splits {
+		name, ok := canonical(split.Participant)
+		switch {
+		case name == "":
+			problems = append(problems, fmt.Sprintf("part %d needs a participant", i+1))
+			continue
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s is not a participant of this trip", strings.TrimSpace(split.Participant)))
+			continue
+		case seen[strings.ToLower(name)]:
+			problems = append(problems, fmt.Sprintf("%s has more than one part", name))
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		splits[i].Participant = name
+
+		if split.Shares < 0 {
+			problems = append(problems, fmt.Sprintf("the shares of %s cannot be negative", name))
+		}
+		if split.Amount == nil {
+			allFixed = false
+			continue
+		}
+		if *split.Amount < 0 {
+			problems = append(problems, fmt.Sprintf("the amount of %s cannot be negative", name))
+		}
+		fixed += *split.Amount
+	}
+
+	if len(splits) > 0 {
+		value := 0.0
+		if cost != nil {
+			value = cost.Value
+		}
+		if fixed > value+splitTolerance {
+			problems = append(problems, fmt.Sprintf("the fixed amounts come to %g, more than the cost of %g", fixed, value))
+		} else if allFixed && math.Abs(fixed-value) > splitTolerance {
+			problems = append(problems, fmt.Sprintf("the amounts come to %g but the cost is %g", fixed, value))
+		}
+	}
+	return problems
+}
+
+// SplitCost divides an amount between the parts of a split. The fixed
+// amounts, scaled by the same factor as the cost when it was converted, come
+// first and the rest is shared by the others in proportion to their shares.
+// An empty split shares the amount equally between everyone.
+func SplitCost(value float64, scale float64, splits []bt.ExpenseSplit, everyone []string) map[string]float64 {
+	parts := make(map[string]float64)
+	if len(splits) == 0 {
+		for _, name := range everyone {
+			parts[name] += value / float64(len(everyone))
+		}
+		return parts
+	}
+
+	rest, shares := value, 0.0
+	for _, split := range splits {
+		if split.Amount != nil {
+			parts[split.Participant] += *split.Amount * scale
+			rest -= *split.Amount * scale
+			continue
+		}
+		shares += splitShares(split)
+	}
+	if shares == 0 {
+		return parts
+	}
+	for _, split := range splits {
+		if split.Amount == nil {
+			parts[split.Participant] += rest * splitShares(split) / shares
+		}
+	}
+	return parts
+}
+
+func splitShares(split bt.ExpenseSplit) float64 {
+	if split.Shares > 0 {
+		return split.Shares
+	}
+	return 1
+}
+
+// ExpenseBalances adds up what each participant paid and owes for the
+// expenses and itinerary items of the trip that say who paid them, in the
+// target currency. An item whose cost was moved to an expense that says who
+// paid counts once, through the expense. Records the role may not see, or
+// whose cost is private to the owner, are left out as if they were not there.
+func ExpenseBalances(app core.App, trip *core.Record, role string, target string) bt.ExpenseBalances {
+	var participants []bt.Participant
+	_ = trip.UnmarshalJSONField("participants", &participants)
+	everyone := make([]string, 0, len(participants))
+	for _, p := range participants {
+		if name := strings.TrimSpace(p.Name); name != "" {
+			everyone = append(everyone, name)
+		}
+	}
+
+	result := bt.ExpenseBalances{
+		Currency:    target,
+		Balances:    make([]bt.Balance, 0),
+		Settlements: make([]bt.Settlement, 0),
+		Skipped:     make([]bt.SkippedExpense, 0),
+	}
+	paid := make(map[string]float64)
+	owed := make(map[string]float64)
+	for _, name := range everyone {
+		paid[name], owed[name] = 0, 0
+	}
+
+	records := make([]*core.Record, 0)
+	for _, collection := range SplitCollections {
+		found, _ := app.FindAllRecords(collection, dbx.HashExp{"trip": trip.Id})
+		records = append(records, found...)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].GetString("created") < records[j].GetString("created")
+	})
+	paidExpenses := make(map[string]bool)
+	for _, record := range records {
+		if record.Collection().Name == "trip_expenses" && record.GetString("paidBy") != "" {
+			paidExpenses[record.Id] = true
+		}
+	}
+
+	rates := currency.LoadRates(app)
+	for _, record := range records {
+		collection := record.Collection().Name
+		privacy := ItemPrivacy(record)
+		if !ItemVisible(collection, privacy.Item, role) || !SeesPrivate(role) && slices.Contains(privacy.Fields, PrivateCost) {
+			continue
+		}
+		paidBy := record.GetString("paidBy")
+		if paidBy == "" || collection != "trip_expenses" && paidExpenses[record.GetString("expenseId")] {
+			continue
+		}
+
+		var cost *bt.Cost
+		_ = record.UnmarshalJSONField("cost", &cost)
+		if cost == nil || cost.Value <= 0 {
+			continue
+		}
+		var locked *bt.ExchangeRate
+		_ = record.UnmarshalJSONField("exchangeRate", &locked)
+		converted, ok := ConvertCost(cost, locked, target, rates)
+		if !ok {
+			result.Skipped = append(result.Skipped, bt.SkippedExpense{
+				Collection: collection,
+				ExpenseId:  record.Id,
+				Name:       ItemLabel(record),
+				Reason:     fmt.Sprintf("no exchange rate from %s to %s", cost.Currency, target),
+			})
+			continue
+		}
+
+		var splits []bt.ExpenseSplit
+		_ = record.UnmarshalJSONField("splitAmong", &splits)
+		if len(splits) == 0 && len(everyone) == 0 {
+			result.Skipped = append(result.Skipped, bt.SkippedExpense{
+				Collection: collection,
+				ExpenseId:  record.Id,
+				Name:       ItemLabel(record),
+				Reason:     "the trip has no participants to split it between",
+			})
+			continue
+		}
+
+		paid[paidBy] += converted.Value
+		for name, part := range SplitCost(converted.Value, converted.Value/cost.Value, splits, everyone) {
+			owed[name] += part
+		}
+	}
+
+	names := make([]string, 0, len(paid))
+	for name := range paid {
+		names = append(names, name)
+	}
+	for name := range owed {
+		if _, ok := paid[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result.Balances = append(result.Balances, bt.Balance{
+			Participant: name,
+			Paid:        currency.Round(paid[name], target),
+			Owed:        currency.Round(owed[name], target),
+			Net:         currency.Round(paid[name]-owed[name], target),
+		})
+	}
+	result.Settlements = SettleUp(result.Balances, target)
+	return result
+}
+
+// SettleUp lists payments that bring every balance to zero: whoever owes the
+// most pays whoever is owed the most, until nobody owes anything. That takes
+// at most one payment less than there are participants with a balance.
+func SettleUp(balances []bt.Balance, code string) []bt.Settlement {
+	type position struct {
+		name   string
+		amount float64
+	}
+	creditors := make([]position, 0)
+	debtors := make([]position, 0)
+	for _, balance := range balances {
+		switch {
+		case balance.Net > 0:
+			creditors = append(creditors, position{balance.Participant, balance.Net})
+		case balance.Net < 0:
+			debtors = append(debtors, position{balance.Participant, -balance.Net})
+		}
+	}
+
+	settlements := make([]bt.Settlement, 0)
+	for len(creditors) > 0 && len(debtors) > 0 {
+		byAmount := func(a, b position) int {
+			if a.amount != b.amount {
+				if a.amount > b.amount {
+					return -1
+				}
+				return 1
+			}
+			return strings.Compare(a.name, b.name)
+		}
+		slices.SortFunc(creditors, byAmount)
+		slices.SortFunc(debtors, byAmount)
+
+		amount := currency.Round(math.Min(creditors[0].amount, debtors[0].amount), code)
+		if amount > 0 {
+			settlements = append(settlements, bt.Settlement{From: debtors[0].name, To: creditors[0].name, Amount: amount})
+		}
+		creditors[0].amount = currency.Round(creditors[0].amount-amount, code)
+		debtors[0].amount = currency.Round(debtors[0].amount-amount, code)
+		// what rounding leaves over is too small to pay
+		if creditors[0].amount <= 0 || amount == 0 {
+			creditors = creditors[1:]
+		}
+		if debtors[0].amount <= 0 || amount == 0 {
+			debtors = debtors[1:]
+		}
+	}
+	return settlements
+}
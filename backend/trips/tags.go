@@ -0,0 +1,125 @@
+package trips
+
+import (
+	bt "backend/types"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	maxTags      = 20
+	maxTagLength = 40
+)
+
+// TaggedCollections are the trips and the trip items that can be tagged,
+// e.g. kid-friendly, rainy-day or must-do
+var TaggedCollections = []string{"trips", "transportations", "lodgings", "activities", "car_rentals", "dining", "trip_expenses"}
+
+// CleanTags trims and lower cases the tags of a trip, a trip item or a vault
+// document and drops the empty and repeated ones
+func CleanTags(tags []string) ([]string, []string) {
+	cleaned := make([]string, 0, len(tags))
+	problems := make([]string, 0)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		switch {
+		case tag == "" || slices.Contains(cleaned, tag):
+			continue
+		case len(tag) > maxTagLength:
+			problems = append(problems, fmt.Sprintf("%s is longer than %d characters", tag, maxTagLength))
+			continue
+		}
+		cleaned = append(cleaned, tag)
+	}
+	if len(cleaned) > maxTags {
+		problems = append(problems, fmt.Sprintf("there can be at most %d tags", maxTags))
+	}
+	return cleaned, problems
+}
+
+// RecordTags reads the tags of a trip or a trip item
+func RecordTags(record *core.Record) []string {
+	var tags []string
+	_ = record.UnmarshalJSONField("tags", &tags)
+	return tags
+}
+
+// TripTags counts the trip and the items the role sees by tag, the most
+// used tags first
+func TripTags(app core.App, trip *core.Record, role string) ([]bt.TagCount, error) {
+	counts := map[string]int{}
+	err := eachTaggedRecord(app, trip, role, func(record *core.Record) error {
+		for _, tag := range RecordTags(record) {
+			counts[tag]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]bt.TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, bt.TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags, nil
+}
+
+// ReplaceTag renames a tag on the trip and the items the role sees, or
+// removes it when to is empty. Items that have both tags keep one. It
+// returns how many records changed.
+func ReplaceTag(app core.App, trip *core.Record, role string, from string, to string) (int, error) {
+	changed := 0
+	err := app.RunInTransaction(func(txApp core.App) error {
+		return eachTaggedRecord(txApp, trip, role, func(record *core.Record) error {
+			tags := RecordTags(record)
+			at := slices.Index(tags, from)
+			if at < 0 {
+				return nil
+			}
+			if to == "" || slices.Contains(tags, to) {
+				tags = slices.Delete(tags, at, at+1)
+			} else {
+				tags[at] = to
+			}
+			record.Set("tags", tags)
+			changed++
+			return txApp.Save(record)
+		})
+	})
+	return changed, err
+}
+
+// eachTaggedRecord calls fn with the trip and each of its tagged items the
+// role may see
+func eachTaggedRecord(app core.App, trip *core.Record, role string, fn func(record *core.Record) error) error {
+	if err := fn(trip); err != nil {
+		return err
+	}
+	for _, collection := range TaggedCollections[1:] {
+		records, err := app.FindAllRecords(collection, dbx.HashExp{"trip": trip.Id})
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if !ItemVisible(collection, ItemPrivacy(record).Item, role) {
+				continue
+			}
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package trips
+
+import (
+	bt "backend/types"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const templateClock = "15:04"
+
+// metadata entries that belong to one booking and are left out of templates
+var bookingMetadataKeys = []string{
+	"reservation", "confirmation", "confirmationCode", "bookingReference",
+	"icsUid", "gate", "terminal", "seats", "boardingPass",
+	"arrivalGate", "arrivalTerminal", "flightStatus",
+}
+
+// BuildTripTemplate turns a trip into a template, its times counted in days
+// from the first day of the trip. Private items and fields are left out
+// unless the role is the owner, as are booking references, travelers,
+// attachments, expenses and rentals.
+func BuildTripTemplate(app core.App, trip *core.Record, role string) *bt.TripTemplate {
+	data := &bt.ExportedTrip{
+		Transportations: exportTransportations(app, trip),
+		Lodgings:        exportLodgings(app, trip),
+		Activities:      exportActivities(app, trip),
+	}
+	if !SeesPrivate(role) {
+		RedactExport(data)
+	}
+
+	template := &bt.TripTemplate{
+		Name:            trip.GetString("name"),
+		Description:     trip.GetString("description"),
+		Destinations:    getDestinations(trip),
+		Notes:           trip.GetString("notes"),
+		Transportations: make([]*bt.TemplateTransportation, 0, len(data.Transportations)),
+		Lodgings:        make([]*bt.TemplateLodging, 0, len(data.Lodgings)),
+		Activities:      make([]*bt.TemplateActivity, 0, len(data.Activities)),
+	}
+	_ = trip.UnmarshalJSONField("budget", &template.Budget)
+	if template.Budget != nil && template.Budget.Currency == "" {
+		template.Budget = nil
+	}
+	_ = trip.UnmarshalJSONField("budgetCategories", &template.BudgetCategories)
+
+	first := templateFirstDay(trip, data)
+	toTemplateTime := func(value types.DateTime) *bt.TemplateTime {
+		if value.IsZero() {
+			return nil
+		}
+		day := value.Time().Truncate(24 * time.Hour)
+		return &bt.TemplateTime{
+			Day:  int(day.Sub(first).Hours() / 24),
+			Time: value.Time().Format(templateClock),
+		}
+	}
+
+	last := 0
+	keepLast := func(times ...*bt.TemplateTime) {
+		for _, t := range times {
+			if t != nil && t.Day > last {
+				last = t.Day
+			}
+		}
+	}
+	if end := trip.GetDateTime("endDate"); !end.IsZero() && !first.IsZero() {
+		keepLast(toTemplateTime(end))
+	}
+
+	for _, t := range data.Transportations {
+		item := &bt.TemplateTransportation{
+			Type:        t.Type,
+			Origin:      t.Origin,
+			Destination: t.Destination,
+			Departure:   toTemplateTime(t.Departure),
+			Arrival:     toTemplateTime(t.Arrival),
+			Cost:        t.Cost,
+			Metadata:    withoutBookingMetadata(t.Metadata),
+		}
+		keepLast(item.Departure, item.Arrival)
+		template.Transportations = append(template.Transportations, item)
+	}
+	for _, l := range data.Lodgings {
+		rooms := make([]bt.Room, 0, len(l.Rooms))
+		for _, room := range l.Rooms {
+			rooms = append(rooms, bt.Room{Name: room.Name, Type: room.Type, Capacity: room.Capacity, Cost: room.Cost, Occupants: []string{}})
+		}
+		item := &bt.TemplateLodging{
+			Type:     l.Type,
+			Name:     l.Name,
+			Address:  l.Address,
+			Start:    toTemplateTime(l.StartDate),
+			End:      toTemplateTime(l.EndDate),
+			Cost:     l.Cost,
+			Rooms:    rooms,
+			Metadata: withoutBookingMetadata(l.Metadata),
+		}
+		keepLast(item.Start, item.End)
+		template.Lodgings = append(template.Lodgings, item)
+	}
+	for _, a := range data.Activities {
+		item := &bt.TemplateActivity{
+			Name:        a.Name,
+			Description: a.Description,
+			Address:     a.Address,
+			Start:       toTemplateTime(a.StartDate),
+			End:         toTemplateTime(a.EndDate),
+			Cost:        a.Cost,
+			Metadata:    withoutBookingMetadata(a.Metadata),
+		}
+		keepLast(item.Start, item.End)
+		template.Activities = append(template.Activities, item)
+	}
+
+	template.Days = last + 1
+	return template
+}
+
+// InstantiateTripTemplate places a template on the calendar, the first day
+// of the trip being the date of start. The result can be imported like an
+// exported trip.
+func InstantiateTripTemplate(template *bt.TripTemplate, name string, start time.Time) *bt.ExportedTrip {
+	first := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	if name == "" {
+		name = template.Name
+	}
+
+	toDateTime := func(value *bt.TemplateTime) types.DateTime {
+		if value == nil {
+			return types.DateTime{}
+		}
+		clock, err := time.Parse(templateClock, value.Time)
+		if err != nil {
+			clock = time.Time{}
+		}
+		t := first.AddDate(0, 0, value.Day).Add(time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute)
+		dt, _ := types.ParseDateTime(t)
+		return dt
+	}
+
+	days := max(template.Days, 1)
+	startDate, _ := types.ParseDateTime(first)
+	endDate, _ := types.ParseDateTime(first.AddDate(0, 0, days-1))
+
+	data := &bt.ExportedTrip{
+		Trip: &bt.Trip{
+			Name:             name,
+			Description:      template.Description,
+			StartDate:        startDate,
+			EndDate:          endDate,
+			Destinations:     template.Destinations,
+			Participants:     []bt.Participant{},
+			Notes:            template.Notes,
+			Budget:           template.Budget,
+			BudgetCategories: template.BudgetCategories,
+		},
+		Transportations: make([]*bt.Transportation, 0, len(template.Transportations)),
+		Lodgings:        make([]*bt.Lodging, 0, len(template.Lodgings)),
+		Activities:      make([]*bt.Activity, 0, len(template.Activities)),
+	}
+	for _, t := range template.Transportations {
+		data.Transportations = append(data.Transportations, &bt.Transportation{
+			Type:        t.Type,
+			Origin:      t.Origin,
+			Destination: t.Destination,
+			Departure:   toDateTime(t.Departure),
+			Arrival:     toDateTime(t.Arrival),
+			Cost:        t.Cost,
+			Metadata:    t.Metadata,
+		})
+	}
+	for _, l := range template.Lodgings {
+		data.Lodgings = append(data.Lodgings, &bt.Lodging{
+			Type:      l.Type,
+			Name:      l.Name,
+			Address:   l.Address,
+			StartDate: toDateTime(l.Start),
+			EndDate:   toDateTime(l.End),
+			Cost:      l.Cost,
+			Rooms:     l.Rooms,
+			Metadata:  l.Metadata,
+		})
+	}
+	for _, a := range template.Activities {
+		data.Activities = append(data.Activities, &bt.Activity{
+			Name:        a.Name,
+			Description: a.Description,
+			Address:     a.Address,
+			StartDate:   toDateTime(a.Start),
+			EndDate:     toDateTime(a.End),
+			Cost:        a.Cost,
+			Metadata:    a.Metadata,
+		})
+	}
+	return data
+}
+
+// templateFirstDay is the first day of the trip, or of its earliest plan
+// when the trip has no dates
+func templateFirstDay(trip *core.Record, data *bt.ExportedTrip) time.Time {
+	if start := trip.GetDateTime("startDate"); !start.IsZero() {
+		return start.Time().Truncate(24 * time.Hour)
+	}
+
+	var first time.Time
+	keep := func(value types.DateTime) {
+		if !value.IsZero() && (first.IsZero() || value.Time().Before(first)) {
+			first = value.Time()
+		}
+	}
+	for _, t := range data.Transportations {
+		keep(t.Departure)
+	}
+	for _, l := range data.Lodgings {
+		keep(l.StartDate)
+	}
+	for _, a := range data.Activities {
+		keep(a.StartDate)
+	}
+	return first.Truncate(24 * time.Hour)
+}
+
+// withoutBookingMetadata copies the metadata without the entries of the
+// booking
+func withoutBookingMetadata(metadata map[string]any) map[string]any {
+	copied := make(map[string]any, len(metadata))
+	for key, value := range metadata {
+		copied[key] = value
+	}
+	for _, key := range bookingMetadataKeys {
+		delete(copied, key)
+	}
+	return copied
+}
@@ -0,0 +1,225 @@
+package trips
+
+import (
+	bt "backend/types"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/ringsaturn/tzf"
+)
+
+// timedPlace is a place kept in the metadata of a record and the time
+// fields that happen there
+type timedPlace struct {
+	key    string
+	fields []string
+}
+
+var timedPlaces = map[string][]timedPlace{
+	"transportations": {{"origin", []string{"departureTime"}}, {"destination", []string{"arrivalTime"}}},
+	"lodgings":        {{"place", []string{"startDate", "endDate"}}},
+	"activities":      {{"place", []string{"startDate", "endDate"}}},
+	"car_rentals":     {{"pickup", []string{"pickupTime"}}, {"dropoff", []string{"dropoffTime"}}},
+	"dining":          {{"place", []string{"reservationTime"}}},
+}
+
+// FixTimezones derives the timezone of every place of a trip again from its
+// coordinates. Times are stored as the local wall clock time of their place;
+// with shiftTimes they are taken to be UTC instants instead, as some trips
+// created before that were, and converted to the local time of the place.
+// Equipment rentals and tickets follow the timezone of their activity. Nothing is saved on a dry run.
+func FixTimezones(app core.App, finder tzf.F, trip *core.Record, shiftTimes bool, dryRun bool) (*bt.TimezoneReport, error) {
+	report := &bt.TimezoneReport{
+		TripId:     trip.Id,
+		DryRun:     dryRun,
+		ShiftTimes: shiftTimes,
+		Changes:    make([]*bt.TimezoneChange, 0),
+		Unresolved: make([]string, 0),
+	}
+
+	changed := make([]*core.Record, 0)
+	if fixDestinationTimezones(finder, trip, report) {
+		changed = append(changed, trip)
+	}
+
+	activityTimezones := map[string]string{}
+	for _, collection := range []string{"transportations", "lodgings", "activities", "car_rentals", "dining"} {
+		records, err := app.FindAllRecords(collection, dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			var metadata map[string]any
+			_ = record.UnmarshalJSONField("metadata", &metadata)
+
+			recordChanged := false
+			for _, place := range timedPlaces[collection] {
+				tz, placeChanged := fixPlaceTimezone(finder, record, metadata, place.key, report)
+				recordChanged = recordChanged || placeChanged
+				if collection == "activities" {
+					activityTimezones[record.Id] = tz
+				}
+				if shiftTimes && tz != "" {
+					for _, field := range place.fields {
+						recordChanged = shiftToWallClock(record, field, tz, report) || recordChanged
+					}
+				}
+			}
+
+			if recordChanged {
+				record.Set("metadata", metadata)
+				changed = append(changed, record)
+			}
+		}
+	}
+
+	if shiftTimes {
+		for _, collection := range []string{"equipment_rentals", "tickets"} {
+			times := activityTimes[collection]
+			records, err := app.FindAllRecords(collection, dbx.NewExp("trip = {:tripId}", dbx.Params{"tripId": trip.Id}))
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range records {
+				tz := activityTimezones[record.GetString("activity")]
+				if tz == "" {
+					continue
+				}
+				start := shiftToWallClock(record, times[0], tz, report)
+				if shiftToWallClock(record, times[1], tz, report) || start {
+					changed = append(changed, record)
+				}
+			}
+		}
+	}
+
+	if dryRun || len(changed) == 0 {
+		return report, nil
+	}
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		for _, record := range changed {
+			if err := txApp.Save(record); err != nil {
+				return fmt.Errorf("%s %s: %w", record.Collection().Name, record.Id, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func fixDestinationTimezones(finder tzf.F, trip *core.Record, report *bt.TimezoneReport) bool {
+	var destinations []bt.Destination
+	if err := trip.UnmarshalJSONField("destinations", &destinations); err != nil {
+		return false
+	}
+
+	changed := false
+	for i, destination := range destinations {
+		lat, latErr := strconv.ParseFloat(destination.Latitude, 64)
+		lng, lngErr := strconv.ParseFloat(destination.Longitude, 64)
+		if latErr != nil || lngErr != nil {
+			if destination.TimeZone == "" {
+				report.Unresolved = append(report.Unresolved, fmt.Sprintf("trips/%s destination %s", trip.Id, destination.Name))
+			}
+			continue
+		}
+
+		derived := finder.GetTimezoneName(lng, lat)
+		if derived == "" || derived == destination.TimeZone {
+			continue
+		}
+		report.Changes = append(report.Changes, &bt.TimezoneChange{
+			Collection: "trips",
+			RecordId:   trip.Id,
+			Field:      fmt.Sprintf("destinations.%d.timezone", i),
+			Before:     destination.TimeZone,
+			After:      derived,
+		})
+		destinations[i].TimeZone = derived
+		changed = true
+	}
+
+	if changed {
+		trip.Set("destinations", destinations)
+	}
+	return changed
+}
+
+// fixPlaceTimezone returns the timezone of the place after the fix-up and
+// whether it changed
+func fixPlaceTimezone(finder tzf.F, record *core.Record, metadata map[string]any, key string, report *bt.TimezoneReport) (string, bool) {
+	place, ok := metadata[key].(map[string]any)
+	if !ok {
+		return "", false
+	}
+	existing, _ := place["timezone"].(string)
+
+	lat, lng, ok := placeCoordinates(metadata, key)
+	if !ok {
+		if existing == "" {
+			report.Unresolved = append(report.Unresolved, fmt.Sprintf("%s/%s %s", record.Collection().Name, record.Id, key))
+		}
+		return existing, false
+	}
+
+	derived := finder.GetTimezoneName(lng, lat)
+	if derived == "" || derived == existing {
+		return existing, false
+	}
+
+	report.Changes = append(report.Changes, &bt.TimezoneChange{
+		Collection: record.Collection().Name,
+		RecordId:   record.Id,
+		Field:      fmt.Sprintf("metadata.%s.timezone", key),
+		Before:     existing,
+		After:      derived,
+	})
+	place["timezone"] = derived
+	return derived, true
+}
+
+// shiftToWallClock converts a time stored as a UTC instant into the local
+// wall clock time of the timezone
+func shiftToWallClock(record *core.Record, field string, tz string, report *bt.TimezoneReport) bool {
+	stored := record.GetDateTime(field)
+	loc, err := time.LoadLocation(tz)
+	if stored.IsZero() || err != nil {
+		return false
+	}
+
+	local := stored.Time().In(loc)
+	wallClock := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), 0, time.UTC)
+	if wallClock.Equal(stored.Time()) {
+		return false
+	}
+
+	shifted, _ := types.ParseDateTime(wallClock)
+	report.Changes = append(report.Changes, &bt.TimezoneChange{
+		Collection: record.Collection().Name,
+		RecordId:   record.Id,
+		Field:      field,
+		Before:     stored.String(),
+		After:      shifted.String(),
+	})
+	record.Set(field, shifted)
+	return true
+}
+
+// DerivePlaceTimezone looks up the timezone of a place in record metadata from
+// its coordinates, or returns an empty string when it has none
+func DerivePlaceTimezone(finder tzf.F, metadata map[string]any, key string) string {
+	lat, lng, ok := placeCoordinates(metadata, key)
+	if !ok || finder == nil {
+		return ""
+	}
+	return finder.GetTimezoneName(lng, lat)
+}
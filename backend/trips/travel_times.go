@@ -0,0 +1,173 @@
+package trips
+
+import (
+	"backend/routing"
+	bt "backend/types"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// items further apart than this are not reached one from the other
+	maxTravelGap = 12 * time.Hour
+	// places closer than this, in degrees, are the same place
+	samePlaceDegrees = 0.001
+)
+
+// travelStop is an item at the time it is reached and the time it is left.
+// A transportation is reached at its origin and left at its destination, a
+// lodging is a stop at check-in and another at check-out.
+type travelStop struct {
+	item   *bt.ItineraryItem
+	arrive types.DateTime
+	leave  types.DateTime
+	// the same times as instants with an offset, when the timezone is known
+	arriveAt string
+	leaveAt  string
+	at       *bt.ItineraryPlace
+	leaveBy  *bt.ItineraryPlace
+}
+
+type travelPair struct {
+	from travelStop
+	to   travelStop
+}
+
+// TravelLegs routes the way between each item of the itinerary and the next
+// one in the mode, and warns when the time between the end of one and the
+// start of the next is shorter than the way takes. Items without
+// coordinates, at the same place or more than 12 hours apart are skipped.
+// When date is set only the legs leaving on that day are routed.
+func TravelLegs(itinerary *bt.Itinerary, provider routing.DataProvider, mode string, date string) ([]bt.TravelLeg, error) {
+	stops := travelStops(itinerary.Items)
+
+	pairs := make([]travelPair, 0)
+	for i := 0; i+1 < len(stops); i++ {
+		from, to := stops[i], stops[i+1]
+		if date != "" && from.leave.Time().Format(time.DateOnly) != date {
+			continue
+		}
+		if travelled(from, to) {
+			pairs = append(pairs, travelPair{from: from, to: to})
+		}
+	}
+
+	// legs following each other through a place are routed in one request
+	legs := make([]bt.TravelLeg, 0, len(pairs))
+	for start := 0; start < len(pairs); {
+		end := start + 1
+		for end < len(pairs) && pairs[end-1].to.item == pairs[end].from.item && pairs[end].from.at == pairs[end].from.leaveBy {
+			end++
+		}
+
+		points := []routing.Point{travelPoint(pairs[start].from.leaveBy)}
+		for _, pair := range pairs[start:end] {
+			points = append(points, travelPoint(pair.to.at))
+		}
+		routed, err := routing.Legs(provider, mode, points)
+		if err != nil {
+			return nil, err
+		}
+		for i, pair := range pairs[start:end] {
+			legs = append(legs, travelLeg(pair, mode, routed[i]))
+		}
+		start = end
+	}
+	return legs, nil
+}
+
+func travelStops(items []*bt.ItineraryItem) []travelStop {
+	stops := make([]travelStop, 0, len(items))
+	for _, item := range items {
+		if item.Start.IsZero() {
+			continue
+		}
+		switch item.Type {
+		case "lodging":
+			stops = append(stops, travelStop{item: item, arrive: item.Start, leave: item.Start, arriveAt: item.StartsAt, leaveAt: item.StartsAt, at: item.From, leaveBy: item.From})
+			if !item.End.IsZero() {
+				stops = append(stops, travelStop{item: item, arrive: item.End, leave: item.End, arriveAt: item.EndsAt, leaveAt: item.EndsAt, at: item.To, leaveBy: item.To})
+			}
+		default:
+			stop := travelStop{item: item, arrive: item.Start, leave: item.End, arriveAt: item.StartsAt, leaveAt: item.EndsAt, at: item.From, leaveBy: item.To}
+			if item.End.IsZero() {
+				stop.leave, stop.leaveAt = item.Start, item.StartsAt
+			}
+			stops = append(stops, stop)
+		}
+	}
+
+	sort.SliceStable(stops, func(i, j int) bool {
+		return stops[i].arrive.Time().Before(stops[j].arrive.Time())
+	})
+	return stops
+}
+
+// travelled reports whether there is a way to route between the stops
+func travelled(from travelStop, to travelStop) bool {
+	if !hasCoordinates(from.leaveBy) || !hasCoordinates(to.at) {
+		return false
+	}
+	if math.Abs(*from.leaveBy.Latitude-*to.at.Latitude) < samePlaceDegrees && math.Abs(*from.leaveBy.Longitude-*to.at.Longitude) < samePlaceDegrees {
+		return false
+	}
+	return travelGap(from, to) <= maxTravelGap
+}
+
+// travelGap is the time between leaving a stop and reaching the next, as
+// instants when both timezones are known and as wall clock times otherwise
+func travelGap(from travelStop, to travelStop) time.Duration {
+	leaving, leaveErr := time.Parse(time.RFC3339, from.leaveAt)
+	arriving, arriveErr := time.Parse(time.RFC3339, to.arriveAt)
+	if leaveErr == nil && arriveErr == nil {
+		return arriving.Sub(leaving)
+	}
+	return to.arrive.Time().Sub(from.leave.Time())
+}
+
+func travelLeg(pair travelPair, mode string, routed routing.Leg) bt.TravelLeg {
+	gap := travelGap(pair.from, pair.to)
+	leg := bt.TravelLeg{
+		From:            bt.TravelStop{Type: pair.from.item.Type, Id: pair.from.item.Id, Title: pair.from.item.Title, Time: pair.from.leave, Place: pair.from.leaveBy},
+		To:              bt.TravelStop{Type: pair.to.item.Type, Id: pair.to.item.Id, Title: pair.to.item.Title, Time: pair.to.arrive, Place: pair.to.at},
+		Mode:            mode,
+		DistanceKm:      math.Round(routed.DistanceKm*10) / 10,
+		DurationMinutes: int(math.Ceil(routed.Duration.Minutes())),
+		Estimated:       routed.Estimated,
+		GapMinutes:      int(math.Floor(gap.Minutes())),
+	}
+
+	switch {
+	case gap < 0:
+		leg.Warning = fmt.Sprintf("%s starts before %s ends", pair.to.item.Title, pair.from.item.Title)
+	case routed.Duration > gap:
+		leg.Warning = fmt.Sprintf("%d minutes to get from %s to %s by %s, only %d between them",
+			leg.DurationMinutes, pair.from.item.Title, pair.to.item.Title, modeName(mode), leg.GapMinutes)
+	}
+	return leg
+}
+
+func travelPoint(place *bt.ItineraryPlace) routing.Point {
+	return routing.Point{Latitude: *place.Latitude, Longitude: *place.Longitude}
+}
+
+func hasCoordinates(place *bt.ItineraryPlace) bool {
+	return place != nil && place.Latitude != nil && place.Longitude != nil
+}
+
+func modeName(mode string) string {
+	switch mode {
+	case routing.ModeWalking:
+		return "foot"
+	case routing.ModeCycling:
+		return "bike"
+	case routing.ModeTransit:
+		return "public transit"
+	default:
+		return "car"
+	}
+}
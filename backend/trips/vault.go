@@ -0,0 +1,57 @@
+package trips
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	// many countries want a passport valid this long after the stay
+	documentValidityMonths = 6
+	// documents expiring this soon are reminded of even when the trip is
+	// long before
+	documentExpiryWarning = 60 * 24 * time.Hour
+)
+
+// DocumentVisible tells whether the member sees the vault document: its
+// owner does, and everyone else when it is not limited to some members
+func DocumentVisible(document *core.Record, userId string) bool {
+	visibleTo := document.GetStringSlice("visibleTo")
+	return document.GetString("owner") == userId || len(visibleTo) == 0 || slices.Contains(visibleTo, userId)
+}
+
+// DocumentExpiry tells whether the owner of the document should be reminded
+// that it expires, and why: it expires before the trip is over, too soon
+// after it for the countries that want six months of validity, or within
+// documentExpiryWarning. Documents of trips that are over are left alone.
+func DocumentExpiry(document *core.Record, trip *core.Record, now time.Time) (string, bool) {
+	expires := document.GetDateTime("expiresOn")
+	if expires.IsZero() {
+		return "", false
+	}
+	expiresOn := expires.Time()
+	start := trip.GetDateTime("startDate").Time()
+	end := trip.GetDateTime("endDate").Time()
+	if !end.IsZero() && end.Before(now) {
+		return "", false
+	}
+
+	name := document.GetString("name")
+	day := expiresOn.Format("January 2, 2006")
+	switch {
+	case expiresOn.Before(now):
+		return fmt.Sprintf("%s expired on %s", name, day), true
+	case !start.IsZero() && expiresOn.Before(start):
+		return fmt.Sprintf("%s expires on %s, before the trip", name, day), true
+	case !end.IsZero() && expiresOn.Before(end):
+		return fmt.Sprintf("%s expires on %s, during the trip", name, day), true
+	case !end.IsZero() && document.GetString("kind") == "passport" && expiresOn.Before(end.AddDate(0, documentValidityMonths, 0)):
+		return fmt.Sprintf("%s expires on %s, some countries want %d months of validity after the stay", name, day, documentValidityMonths), true
+	case expiresOn.Sub(now) < documentExpiryWarning:
+		return fmt.Sprintf("%s expires on %s", name, day), true
+	}
+	return "", false
+}
@@ -0,0 +1,37 @@
+package types
+
+// Balance is where a participant stands across the shared expenses of a
+// trip: what they paid, what their parts came to and the difference, which
+// is positive when they are owed money
+type Balance struct {
+	Participant string  `json:"participant"`
+	Paid        float64 `json:"paid"`
+	Owed        float64 `json:"owed"`
+	Net         float64 `json:"net"`
+}
+
+// Settlement is a payment from one participant to another that evens out
+// their balances
+type Settlement struct {
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Amount float64 `json:"amount"`
+}
+
+// SkippedExpense is an expense or itinerary item left out of the balances
+// and why, ExpenseId is the id of the record in its collection
+type SkippedExpense struct {
+	Collection string `json:"collection"`
+	ExpenseId  string `json:"expenseId"`
+	Name       string `json:"name"`
+	Reason     string `json:"reason"`
+}
+
+// ExpenseBalances are the balances of the participants of a trip in one
+// currency, with the fewest payments that settle them
+type ExpenseBalances struct {
+	Currency    string           `json:"currency"`
+	Balances    []Balance        `json:"balances"`
+	Settlements []Settlement     `json:"settlements"`
+	Skipped     []SkippedExpense `json:"skipped"`
+}
@@ -0,0 +1,20 @@
+package types
+
+import "github.com/pocketbase/pocketbase/tools/types"
+
+type CommentAuthor struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Comment is a message in the discussion of a trip item
+type Comment struct {
+	Id         string         `json:"id"`
+	Collection string         `json:"collection"`
+	RecordId   string         `json:"recordId"`
+	Author     CommentAuthor  `json:"author"`
+	Body       string         `json:"body"`
+	Mentions   []string       `json:"mentions"`
+	Created    types.DateTime `json:"created"`
+	EditedAt   types.DateTime `json:"editedAt"`
+}
@@ -0,0 +1,44 @@
+package types
+
+import "time"
+
+// FieldChange is a field of a trip item before and after a change. From is
+// empty for items added and To for items removed.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from,omitempty"`
+	To    any    `json:"to,omitempty"`
+	// Truncated is set when a long value was cut short
+	Truncated bool `json:"truncated,omitempty"`
+	// Redacted is set when the values are private to the trip owner
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// TripEvent is one change to a trip or one of its items, as the activity
+// log shows it
+type TripEvent struct {
+	Id         string        `json:"id"`
+	At         time.Time     `json:"at"`
+	Actor      *FeedActor    `json:"actor"`
+	Action     string        `json:"action"`
+	Collection string        `json:"collection"`
+	RecordId   string        `json:"recordId"`
+	Label      string        `json:"label"`
+	Changes    []FieldChange `json:"changes"`
+}
+
+// RecordConflict is an update refused because the record changed after the
+// version it was made from. Theirs are the changes made since and Yours the
+// refused ones. Conflicts are the fields both change, Merged holds your
+// values of the others, to send again with the new ETag.
+type RecordConflict struct {
+	Collection string         `json:"collection"`
+	RecordId   string         `json:"recordId"`
+	Version    string         `json:"version"`
+	ETag       string         `json:"etag"`
+	ChangedBy  []FeedActor    `json:"changedBy"`
+	Theirs     []FieldChange  `json:"theirs"`
+	Yours      []FieldChange  `json:"yours"`
+	Conflicts  []string       `json:"conflicts"`
+	Merged     map[string]any `json:"merged"`
+}
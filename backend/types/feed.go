@@ -0,0 +1,25 @@
+package types
+
+import "time"
+
+// FeedActor is who made a change: a user, the assistant or the server itself
+// for proposals that expired
+type FeedActor struct {
+	Type string `json:"type"`
+	Id   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// FeedEntry is one thing that happened on a trip. Proposals made by the
+// assistant name the user whose conversation they came from in onBehalfOf.
+type FeedEntry struct {
+	Id         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	At         time.Time  `json:"at"`
+	Actor      *FeedActor `json:"actor"`
+	OnBehalfOf *FeedActor `json:"onBehalfOf,omitempty"`
+	Collection string     `json:"collection,omitempty"`
+	RecordId   string     `json:"recordId,omitempty"`
+	Summary    string     `json:"summary"`
+	Status     string     `json:"status,omitempty"`
+}
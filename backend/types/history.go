@@ -0,0 +1,51 @@
+package types
+
+import "github.com/pocketbase/pocketbase/tools/types"
+
+type FrequentRoute struct {
+	Type        string         `json:"type"`
+	Origin      string         `json:"origin"`
+	Destination string         `json:"destination"`
+	Count       int            `json:"count"`
+	LastUsed    types.DateTime `json:"lastUsed"`
+}
+
+type FrequentLodging struct {
+	Name     string         `json:"name"`
+	Address  string         `json:"address"`
+	Type     string         `json:"type"`
+	City     string         `json:"city"`
+	Count    int            `json:"count"`
+	LastUsed types.DateTime `json:"lastUsed"`
+}
+
+type TravelHistory struct {
+	Routes   []FrequentRoute   `json:"routes"`
+	Lodgings []FrequentLodging `json:"lodgings"`
+}
+
+// LocationVisit is a place the user was on a trip: a destination of the
+// trip over its dates, or a lodging over the nights booked
+type LocationVisit struct {
+	TripId    string         `json:"tripId"`
+	TripName  string         `json:"tripName"`
+	Kind      string         `json:"kind"`
+	Name      string         `json:"name"`
+	Address   string         `json:"address,omitempty"`
+	City      string         `json:"city,omitempty"`
+	Country   string         `json:"country,omitempty"`
+	Latitude  *float64       `json:"latitude,omitempty"`
+	Longitude *float64       `json:"longitude,omitempty"`
+	From      types.DateTime `json:"from"`
+	To        types.DateTime `json:"to"`
+}
+
+// LocationHistory is the timeline of the places visited in a period, oldest
+// first, across all the trips of the user
+type LocationHistory struct {
+	From      types.DateTime  `json:"from"`
+	To        types.DateTime  `json:"to"`
+	Trips     int             `json:"trips"`
+	Countries []string        `json:"countries"`
+	Visits    []LocationVisit `json:"visits"`
+}
@@ -0,0 +1,27 @@
+package types
+
+import "time"
+
+// ImportFlag points at an imported plan that should be checked, either a
+// saved record or a proposal still waiting for approval
+type ImportFlag struct {
+	Collection string `json:"collection"`
+	RecordId   string `json:"recordId,omitempty"`
+	ProposalId string `json:"proposalId,omitempty"`
+	Name       string `json:"name"`
+	Reason     string `json:"reason"`
+}
+
+// ImportReview is the assistant message that follows a bulk import, with the
+// plans that look doubtful and the proposals offered to correct them
+type ImportReview struct {
+	Id          string         `json:"id"`
+	TripId      string         `json:"tripId"`
+	Source      string         `json:"source"`
+	RequestedBy string         `json:"requestedBy,omitempty"`
+	Imported    map[string]int `json:"imported"`
+	Message     string         `json:"message"`
+	Flags       []*ImportFlag  `json:"flags"`
+	ProposalIds []string       `json:"proposalIds"`
+	CreatedAt   time.Time      `json:"createdAt"`
+}
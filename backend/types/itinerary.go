@@ -0,0 +1,75 @@
+package types
+
+import "github.com/pocketbase/pocketbase/tools/types"
+
+// ItineraryPlace is where an itinerary item starts or ends. The coordinates
+// are left out when the place was never looked up.
+type ItineraryPlace struct {
+	Name      string   `json:"name"`
+	Address   string   `json:"address,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	Timezone  string   `json:"timezone,omitempty"`
+}
+
+// ItineraryItem is a transportation, lodging or activity on the timeline of
+// a trip. Start and end are the local wall clock times of their place, like
+// everywhere else; startsAt and endsAt are the same times as instants with
+// an offset when the timezone of the place is known.
+type ItineraryItem struct {
+	Type             string          `json:"type"`
+	Id               string          `json:"id"`
+	Kind             string          `json:"kind,omitempty"`
+	Title            string          `json:"title"`
+	Description      string          `json:"description,omitempty"`
+	Start            types.DateTime  `json:"start"`
+	End              types.DateTime  `json:"end"`
+	StartsAt         string          `json:"startsAt,omitempty"`
+	EndsAt           string          `json:"endsAt,omitempty"`
+	Date             string          `json:"date"`
+	From             *ItineraryPlace `json:"from,omitempty"`
+	To               *ItineraryPlace `json:"to,omitempty"`
+	Cost             *Cost           `json:"cost"`
+	ConfirmationCode string          `json:"confirmationCode,omitempty"`
+}
+
+// ItineraryDay lists the items happening on a day, a lodging or an overnight
+// leg is on every day it spans
+type ItineraryDay struct {
+	Date  string   `json:"date"`
+	Items []string `json:"items"`
+}
+
+type Itinerary struct {
+	TripId      string           `json:"tripId"`
+	TripName    string           `json:"tripName"`
+	StartDate   types.DateTime   `json:"startDate"`
+	EndDate     types.DateTime   `json:"endDate"`
+	Items       []*ItineraryItem `json:"items"`
+	Days        []ItineraryDay   `json:"days"`
+	Unscheduled []*ItineraryItem `json:"unscheduled"`
+	GeneratedAt types.DateTime   `json:"generatedAt"`
+}
+
+// TravelStop is an itinerary item at one end of a travel leg
+type TravelStop struct {
+	Type  string          `json:"type"`
+	Id    string          `json:"id"`
+	Title string          `json:"title"`
+	Time  types.DateTime  `json:"time"`
+	Place *ItineraryPlace `json:"place"`
+}
+
+// TravelLeg is the way from where an itinerary item ends to where the next
+// one starts. Warning is set when the time between them is shorter than
+// the way takes.
+type TravelLeg struct {
+	From            TravelStop `json:"from"`
+	To              TravelStop `json:"to"`
+	Mode            string     `json:"mode"`
+	DistanceKm      float64    `json:"distanceKm"`
+	DurationMinutes int        `json:"durationMinutes"`
+	Estimated       bool       `json:"estimated,omitempty"`
+	GapMinutes      int        `json:"gapMinutes"`
+	Warning         string     `json:"warning,omitempty"`
+}
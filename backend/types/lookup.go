@@ -0,0 +1,24 @@
+package types
+
+// AirportDetails is an airport of the bundled dataset, found by its IATA or
+// ICAO code or by name
+type AirportDetails struct {
+	Name         string  `json:"name"`
+	IataCode     string  `json:"iataCode,omitempty"`
+	IcaoCode     string  `json:"icaoCode,omitempty"`
+	Municipality string  `json:"municipality,omitempty"`
+	IsoCountry   string  `json:"isoCountry"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	Timezone     string  `json:"timezone,omitempty"`
+	Size         string  `json:"size"`
+}
+
+// AirlineDetails is an airline of the bundled dataset, Code is its IATA code
+// where it has one
+type AirlineDetails struct {
+	Code    string `json:"code"`
+	Name    string `json:"name"`
+	Logo    string `json:"logo,omitempty"`
+	LowCost bool   `json:"lowCost"`
+}
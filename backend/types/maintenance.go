@@ -0,0 +1,51 @@
+package types
+
+type RepairIssue struct {
+	Collection  string `json:"collection"`
+	RecordId    string `json:"recordId"`
+	TripId      string `json:"tripId"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	Fixable     bool   `json:"fixable"`
+	Fixed       bool   `json:"fixed"`
+	Error       string `json:"error,omitempty"`
+}
+
+type RepairReport struct {
+	DryRun       bool           `json:"dryRun"`
+	TripsScanned int            `json:"tripsScanned"`
+	Issues       []*RepairIssue `json:"issues"`
+}
+
+// TimezoneChange is one value changed by the timezone fix-up, Field is a
+// record field or a path into it such as metadata.origin.timezone
+type TimezoneChange struct {
+	Collection string `json:"collection"`
+	RecordId   string `json:"recordId"`
+	Field      string `json:"field"`
+	Before     string `json:"before"`
+	After      string `json:"after"`
+}
+
+type TimezoneReport struct {
+	TripId     string            `json:"tripId"`
+	DryRun     bool              `json:"dryRun"`
+	ShiftTimes bool              `json:"shiftTimes"`
+	Changes    []*TimezoneChange `json:"changes"`
+	Unresolved []string          `json:"unresolved"`
+}
+
+type InstantReport struct {
+	DryRun     bool     `json:"dryRun"`
+	Records    int      `json:"records"`
+	Updated    int      `json:"updated"`
+	Unresolved []string `json:"unresolved"`
+}
+
+// EncryptionReport counts the confirmation codes and document files saved
+// before the instance had a key, encrypted by the encrypt command
+type EncryptionReport struct {
+	DryRun bool           `json:"dryRun"`
+	Codes  map[string]int `json:"codes"`
+	Files  int            `json:"files"`
+}
@@ -0,0 +1,35 @@
+package types
+
+import "github.com/pocketbase/pocketbase/tools/types"
+
+// PollOption is one of the choices of a poll. The times are local wall clock
+// times at the place, like the ones of activities, and are needed to put the
+// option on the itinerary.
+type PollOption struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Address     string `json:"address,omitempty"`
+	StartTime   string `json:"startTime,omitempty"`
+	EndTime     string `json:"endTime,omitempty"`
+	Timezone    string `json:"timezone,omitempty"`
+	Votes       int    `json:"votes"`
+}
+
+// Poll is a poll with the votes counted, Vote is the option the user voted
+// for
+type Poll struct {
+	Id           string         `json:"id"`
+	Question     string         `json:"question"`
+	Options      []PollOption   `json:"options"`
+	Status       string         `json:"status"`
+	Quorum       int            `json:"quorum"`
+	VotesCast    int            `json:"votesCast"`
+	Vote         string         `json:"vote,omitempty"`
+	Winner       string         `json:"winner,omitempty"`
+	ActivityId   string         `json:"activityId,omitempty"`
+	AutoSchedule bool           `json:"autoSchedule"`
+	CreatedBy    string         `json:"createdBy,omitempty"`
+	ClosesAt     types.DateTime `json:"closesAt"`
+	Created      types.DateTime `json:"created"`
+}
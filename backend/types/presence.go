@@ -0,0 +1,12 @@
+package types
+
+// Presence is a collaborator who has the trip open, with the item they are
+// editing when they edit one. Since is when they opened the trip or started
+// editing the item.
+type Presence struct {
+	User       FeedActor `json:"user"`
+	Collection string    `json:"collection,omitempty"`
+	RecordId   string    `json:"recordId,omitempty"`
+	Since      string    `json:"since"`
+	LastSeen   string    `json:"lastSeen"`
+}
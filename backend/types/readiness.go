@@ -0,0 +1,18 @@
+package types
+
+// ReadinessGap is something still missing from a trip before departure,
+// about the whole trip or about one of its plans
+type ReadinessGap struct {
+	Kind       string `json:"kind"`
+	Collection string `json:"collection,omitempty"`
+	RecordId   string `json:"recordId,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Detail     string `json:"detail"`
+}
+
+// TravelAdvisory is the advice of the government for travel to a country,
+// from 1 (take normal precautions) to 4 (do not travel)
+type TravelAdvisory struct {
+	Level   int    `json:"level"`
+	Summary string `json:"summary,omitempty"`
+}
@@ -0,0 +1,126 @@
+package types
+
+import "github.com/pocketbase/pocketbase/tools/types"
+
+type PhotoHighlight struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	Url  string `json:"url"`
+}
+
+// ExpenseAmount is an expense as paid and as counted against the budget,
+// converted at the rate locked when it was logged
+type ExpenseAmount struct {
+	Id           string         `json:"id"`
+	Name         string         `json:"name"`
+	OccurredOn   types.DateTime `json:"occurredOn"`
+	Original     Cost           `json:"original"`
+	Converted    *Cost          `json:"converted,omitempty"`
+	ExchangeRate *ExchangeRate  `json:"exchangeRate,omitempty"`
+}
+
+type TripReport struct {
+	TripId              string           `json:"tripId"`
+	TripName            string           `json:"tripName"`
+	StartDate           types.DateTime   `json:"startDate"`
+	EndDate             types.DateTime   `json:"endDate"`
+	Budget              *Cost            `json:"budget"`
+	BookedCosts         []Cost           `json:"bookedCosts"`
+	Expenses            []Cost           `json:"expenses"`
+	ExpenseAmounts      []ExpenseAmount  `json:"expenseAmounts"`
+	ActualSpend         *Cost            `json:"actualSpend"`
+	UnconvertedCosts    int              `json:"unconvertedCosts"`
+	ActivitiesCompleted int              `json:"activitiesCompleted"`
+	ActivitiesSkipped   int              `json:"activitiesSkipped"`
+	SkippedActivities   []string         `json:"skippedActivities"`
+	DistanceKm          float64          `json:"distanceKm"`
+	Legs                int              `json:"legs"`
+	PhotoHighlights     []PhotoHighlight `json:"photoHighlights"`
+	Narrative           string           `json:"narrative,omitempty"`
+	GeneratedAt         types.DateTime   `json:"generatedAt"`
+}
+
+// RevaluedCost is a trip item valued in the budget currency twice: at the
+// rate locked when it was booked, or paid, and at today's rate. Items whose
+// rate was never locked are booked at today's rate.
+type RevaluedCost struct {
+	Collection   string        `json:"collection"`
+	Id           string        `json:"id"`
+	Name         string        `json:"name"`
+	Original     Cost          `json:"original"`
+	ExchangeRate *ExchangeRate `json:"exchangeRate,omitempty"`
+	Locked       bool          `json:"locked"`
+	Booked       Cost          `json:"booked"`
+	Current      Cost          `json:"current"`
+	Difference   float64       `json:"difference"`
+}
+
+// Revaluation is what the costs of a trip come to at today's rates compared
+// to the rates they were booked at. A positive difference means the trip got
+// more expensive. Remaining is what is left of the budget at today's rates.
+type Revaluation struct {
+	TripId      string         `json:"tripId"`
+	Currency    string         `json:"currency"`
+	RatesDate   string         `json:"ratesDate"`
+	Items       []RevaluedCost `json:"items"`
+	Booked      Cost           `json:"booked"`
+	Current     Cost           `json:"current"`
+	Difference  Cost           `json:"difference"`
+	Budget      *Cost          `json:"budget,omitempty"`
+	Remaining   *Cost          `json:"remaining,omitempty"`
+	Unlocked    int            `json:"unlocked"`
+	Unconverted int            `json:"unconverted"`
+}
+
+// CategorySpend is what the costs of one category of the budget come to,
+// against what was set aside for it when anything was
+type CategorySpend struct {
+	Category  string `json:"category"`
+	Budget    *Cost  `json:"budget,omitempty"`
+	Spent     Cost   `json:"spent"`
+	Remaining *Cost  `json:"remaining,omitempty"`
+	Percent   int    `json:"percent,omitempty"`
+	Overrun   bool   `json:"overrun"`
+	Items     int    `json:"items"`
+}
+
+// BudgetCategories compares the costs of a trip with its budget, category
+// by category. Allocated is what the category budgets add up to, which can
+// be more than the budget of the trip. Overruns lists the categories that
+// spent more than their budget.
+type BudgetCategories struct {
+	TripId        string          `json:"tripId"`
+	Currency      string          `json:"currency"`
+	Budget        *Cost           `json:"budget,omitempty"`
+	Allocated     Cost            `json:"allocated"`
+	OverAllocated bool            `json:"overAllocated"`
+	Spent         Cost            `json:"spent"`
+	Overrun       bool            `json:"overrun"`
+	Categories    []CategorySpend `json:"categories"`
+	Overruns      []string        `json:"overruns"`
+	Unconverted   int             `json:"unconverted"`
+}
+
+// DaySpend is what the trip cost on one calendar day. Lodgings and rentals
+// are spread over the nights and days they cover.
+type DaySpend struct {
+	Date       string `json:"date"`
+	Spent      Cost   `json:"spent"`
+	Cumulative Cost   `json:"cumulative"`
+	Items      int    `json:"items"`
+	InTrip     bool   `json:"inTrip"`
+}
+
+// DailySpend is the spend of a trip per day in the currency of the budget.
+// Every day of the trip is listed, days before or after it only when
+// something was spent on them. Undated holds the expenses without a day.
+type DailySpend struct {
+	TripId        string     `json:"tripId"`
+	Currency      string     `json:"currency"`
+	Budget        *Cost      `json:"budget"`
+	Days          []DaySpend `json:"days"`
+	Total         Cost       `json:"total"`
+	AveragePerDay *Cost      `json:"averagePerDay"`
+	Undated       Cost       `json:"undated"`
+	Unconverted   int        `json:"unconverted"`
+}
@@ -0,0 +1,20 @@
+package types
+
+import "github.com/pocketbase/pocketbase/tools/types"
+
+// TripShare is a public read-only link to the itinerary of a trip as its
+// members see it, the token is the secret part of the link
+type TripShare struct {
+	Id                    string         `json:"id"`
+	Name                  string         `json:"name"`
+	Token                 string         `json:"token"`
+	Url                   string         `json:"url"`
+	HasPassword           bool           `json:"hasPassword"`
+	HideCosts             bool           `json:"hideCosts"`
+	HideConfirmationCodes bool           `json:"hideConfirmationCodes"`
+	ExpiresOn             types.DateTime `json:"expiresOn"`
+	Views                 int            `json:"views"`
+	LastViewedAt          types.DateTime `json:"lastViewedAt"`
+	CreatedBy             string         `json:"createdBy"`
+	Created               types.DateTime `json:"created"`
+}
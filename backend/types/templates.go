@@ -0,0 +1,55 @@
+package types
+
+// TemplateTime is a time of a trip template, the day counted from the first
+// day of the trip (0) and the local wall clock time on that day
+type TemplateTime struct {
+	Day  int    `json:"day"`
+	Time string `json:"time"`
+}
+
+type TemplateTransportation struct {
+	Type        string         `json:"type"`
+	Origin      string         `json:"origin"`
+	Destination string         `json:"destination"`
+	Departure   *TemplateTime  `json:"departure"`
+	Arrival     *TemplateTime  `json:"arrival"`
+	Cost        *Cost          `json:"cost"`
+	Metadata    map[string]any `json:"metadata"`
+}
+
+type TemplateLodging struct {
+	Type     string         `json:"type"`
+	Name     string         `json:"name"`
+	Address  string         `json:"address"`
+	Start    *TemplateTime  `json:"start"`
+	End      *TemplateTime  `json:"end"`
+	Cost     *Cost          `json:"cost"`
+	Rooms    []Room         `json:"rooms"`
+	Metadata map[string]any `json:"metadata"`
+}
+
+type TemplateActivity struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Address     string         `json:"address"`
+	Start       *TemplateTime  `json:"start"`
+	End         *TemplateTime  `json:"end"`
+	Cost        *Cost          `json:"cost"`
+	Metadata    map[string]any `json:"metadata"`
+}
+
+// TripTemplate is a trip with its times kept relative to its first day, so
+// it can be planned again from another date. Bookings, travelers and what
+// was actually spent are not part of it.
+type TripTemplate struct {
+	Name             string                    `json:"name"`
+	Description      string                    `json:"description"`
+	Days             int                       `json:"days"`
+	Destinations     []Destination             `json:"destinations"`
+	Budget           *Cost                     `json:"budget"`
+	BudgetCategories map[string]float64        `json:"budgetCategories,omitempty"`
+	Notes            string                    `json:"notes"`
+	Transportations  []*TemplateTransportation `json:"transportations"`
+	Lodgings         []*TemplateLodging        `json:"lodgings"`
+	Activities       []*TemplateActivity       `json:"activities"`
+}
@@ -20,6 +20,25 @@ type Attachment struct {
 	File string `json:"file"`
 }
 
+// ItemAttachment is a file attached to an itinerary item. Thumb is set for
+// images, the sizes of the attachment thumbnails can be asked for with the
+// thumb query parameter of the file URL.
+type ItemAttachment struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	File     string `json:"file"`
+	MimeType string `json:"mimeType"`
+	Size     int    `json:"size"`
+	Url      string `json:"url"`
+	Thumb    string `json:"thumb,omitempty"`
+}
+
+// RejectedFile is an uploaded file that was not kept and why
+type RejectedFile struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
 type Destination struct {
 	Id          string `json:"id"`
 	Name        string `json:"name"`
@@ -32,6 +51,9 @@ type Destination struct {
 
 type Participant struct {
 	Name string `json:"name"`
+	// Nationality is a country name or ISO code, used to look up entry
+	// requirements
+	Nationality string `json:"nationality,omitempty"`
 }
 
 type Cost struct {
@@ -40,16 +62,30 @@ type Cost struct {
 }
 
 type Transportation struct {
-	Id                   string          `json:"id"`
-	Type                 string          `json:"type"`
-	Origin               string          `json:"origin"`
-	Destination          string          `json:"destination"`
-	Cost                 *Cost           `json:"cost"`
-	Departure            types.DateTime  `json:"departure"`
-	Arrival              types.DateTime  `json:"arrival"`
-	Attachments          []*UploadedFile `json:"attachments"`
-	AttachmentReferences []string        `json:"attachmentReferences"`
-	Metadata             map[string]any  `json:"metadata"`
+	Id                   string           `json:"id"`
+	Type                 string           `json:"type"`
+	Origin               string           `json:"origin"`
+	Destination          string           `json:"destination"`
+	Cost                 *Cost            `json:"cost"`
+	Departure            types.DateTime   `json:"departure"`
+	Arrival              types.DateTime   `json:"arrival"`
+	Seats                []SeatAssignment `json:"seats"`
+	Attachments          []*UploadedFile  `json:"attachments"`
+	AttachmentReferences []string         `json:"attachmentReferences"`
+	Metadata             map[string]any   `json:"metadata"`
+	Privacy              *Privacy         `json:"privacy,omitempty"`
+	ExchangeRate         *ExchangeRate    `json:"exchangeRate,omitempty"`
+	PaidBy               string           `json:"paidBy,omitempty"`
+	SplitAmong           []ExpenseSplit   `json:"splitAmong,omitempty"`
+}
+
+// SeatAssignment is where a participant sits or sleeps on a transportation,
+// e.g. seat 14C on a flight or berth 32 in coach 5 on a night train
+type SeatAssignment struct {
+	Participant string `json:"participant"`
+	Seat        string `json:"seat"`
+	Coach       string `json:"coach"`
+	Kind        string `json:"kind"`
 }
 
 type Lodging struct {
@@ -61,9 +97,31 @@ type Lodging struct {
 	Cost                 *Cost           `json:"cost"`
 	StartDate            types.DateTime  `json:"startDate"`
 	EndDate              types.DateTime  `json:"endDate"`
+	Rooms                []Room          `json:"rooms"`
 	Attachments          []*UploadedFile `json:"attachments"`
 	AttachmentReferences []string        `json:"attachmentReferences"`
 	Metadata             map[string]any  `json:"metadata"`
+	Privacy              *Privacy        `json:"privacy,omitempty"`
+	ExchangeRate         *ExchangeRate   `json:"exchangeRate,omitempty"`
+	PaidBy               string          `json:"paidBy,omitempty"`
+	SplitAmong           []ExpenseSplit  `json:"splitAmong,omitempty"`
+}
+
+// Room is one room of a lodging and the participants sleeping in it. The
+// cost is optional, when no room has one the cost of the lodging is shared.
+type Room struct {
+	Name             string   `json:"name"`
+	Type             string   `json:"type"`
+	Capacity         int      `json:"capacity"`
+	Occupants        []string `json:"occupants"`
+	ConfirmationCode string   `json:"confirmationCode"`
+	Cost             *Cost    `json:"cost"`
+}
+
+// LodgingShare is what a participant owes for the lodgings of a trip
+type LodgingShare struct {
+	Participant string `json:"participant"`
+	Costs       []Cost `json:"costs"`
 }
 
 type Activity struct {
@@ -78,6 +136,10 @@ type Activity struct {
 	Attachments          []*UploadedFile `json:"attachments"`
 	AttachmentReferences []string        `json:"attachmentReferences"`
 	Metadata             map[string]any  `json:"metadata"`
+	Privacy              *Privacy        `json:"privacy,omitempty"`
+	ExchangeRate         *ExchangeRate   `json:"exchangeRate,omitempty"`
+	PaidBy               string          `json:"paidBy,omitempty"`
+	SplitAmong           []ExpenseSplit  `json:"splitAmong,omitempty"`
 }
 
 type Expense struct {
@@ -88,6 +150,130 @@ type Expense struct {
 	Notes                string         `json:"notes"`
 	Category             string         `json:"category"`
 	AttachmentReferences []string       `json:"attachmentReferences"`
+	Privacy              *Privacy       `json:"privacy,omitempty"`
+	ExchangeRate         *ExchangeRate  `json:"exchangeRate,omitempty"`
+	PaidBy               string         `json:"paidBy,omitempty"`
+	SplitAmong           []ExpenseSplit `json:"splitAmong,omitempty"`
+}
+
+// ExpenseSplit is the part of an expense one participant owes. Amount is a
+// fixed part in the currency of the expense, what is left is divided between
+// the others in proportion to their Shares, one each when not given.
+type ExpenseSplit struct {
+	Participant string   `json:"participant"`
+	Shares      float64  `json:"shares,omitempty"`
+	Amount      *float64 `json:"amount,omitempty"`
+}
+
+// ExchangeRate is the rate locked in when an expense is logged or an item is
+// booked, so what it comes to in the currency of the trip budget does not
+// move with the market. Rate is the amount of To for one unit of From, as of
+// RatesDate, and Converted the cost in To at that rate.
+type ExchangeRate struct {
+	From      string  `json:"from"`
+	To        string  `json:"to"`
+	Rate      float64 `json:"rate"`
+	Converted float64 `json:"converted,omitempty"`
+	RatesDate string  `json:"ratesDate,omitempty"`
+	Manual    bool    `json:"manual,omitempty"`
+}
+
+// EquipmentRental is gear (skis, dive equipment, bikes) rented for an activity
+type EquipmentRental struct {
+	Id           string         `json:"id"`
+	Activity     string         `json:"activity"`
+	Item         string         `json:"item"`
+	Shop         string         `json:"shop"`
+	PickupTime   types.DateTime `json:"pickupTime"`
+	ReturnTime   types.DateTime `json:"returnTime"`
+	Deposit      *Cost          `json:"deposit"`
+	Cost         *Cost          `json:"cost"`
+	Notes        string         `json:"notes"`
+	Privacy      *Privacy       `json:"privacy,omitempty"`
+	ExchangeRate *ExchangeRate  `json:"exchangeRate,omitempty"`
+}
+
+// CarRental is a car picked up at one place and dropped off at the same or
+// another one. Metadata holds the pickup and dropoff places, with their
+// coordinates and timezone, like the origin and destination of a
+// transportation.
+type CarRental struct {
+	Id                   string         `json:"id"`
+	Provider             string         `json:"provider"`
+	PickupLocation       string         `json:"pickupLocation"`
+	DropoffLocation      string         `json:"dropoffLocation"`
+	PickupTime           types.DateTime `json:"pickupTime"`
+	DropoffTime          types.DateTime `json:"dropoffTime"`
+	ConfirmationCode     string         `json:"confirmationCode"`
+	VehicleClass         string         `json:"vehicleClass"`
+	Cost                 *Cost          `json:"cost"`
+	Notes                string         `json:"notes"`
+	AttachmentReferences []string       `json:"attachmentReferences"`
+	Metadata             map[string]any `json:"metadata"`
+	Privacy              *Privacy       `json:"privacy,omitempty"`
+	ExchangeRate         *ExchangeRate  `json:"exchangeRate,omitempty"`
+}
+
+// Ticket is an entry ticket to an activity (a concert, a museum, a tour) for
+// one participant. Barcode is what its barcode reads, BarcodeFormat one of
+// qr, aztec, pdf417, code128 or other.
+type Ticket struct {
+	Id                   string         `json:"id"`
+	Activity             string         `json:"activity"`
+	Holder               string         `json:"holder"`
+	Barcode              string         `json:"barcode"`
+	BarcodeFormat        string         `json:"barcodeFormat"`
+	Section              string         `json:"section"`
+	Row                  string         `json:"row"`
+	Seat                 string         `json:"seat"`
+	Gate                 string         `json:"gate"`
+	EntryStart           types.DateTime `json:"entryStart"`
+	EntryEnd             types.DateTime `json:"entryEnd"`
+	Notes                string         `json:"notes"`
+	AttachmentReferences []string       `json:"attachmentReferences"`
+	Privacy              *Privacy       `json:"privacy,omitempty"`
+}
+
+// Dining is a table booked at a restaurant. Metadata holds the place of the
+// restaurant, with its coordinates and timezone, like the place of an
+// activity.
+type Dining struct {
+	Id                   string         `json:"id"`
+	Name                 string         `json:"name"`
+	ReservationTime      types.DateTime `json:"reservationTime"`
+	PartySize            int            `json:"partySize"`
+	ConfirmationCode     string         `json:"confirmationCode"`
+	Cuisine              string         `json:"cuisine"`
+	Address              string         `json:"address"`
+	Cost                 *Cost          `json:"cost"`
+	Notes                string         `json:"notes"`
+	AttachmentReferences []string       `json:"attachmentReferences"`
+	Metadata             map[string]any `json:"metadata"`
+	Privacy              *Privacy       `json:"privacy,omitempty"`
+	ExchangeRate         *ExchangeRate  `json:"exchangeRate,omitempty"`
+}
+
+// RentalConflict is a rental that is due back after the travelers leave
+type RentalConflict struct {
+	RentalId         string         `json:"rentalId"`
+	Item             string         `json:"item"`
+	ReturnTime       types.DateTime `json:"returnTime"`
+	TransportationId string         `json:"transportationId"`
+	Departure        types.DateTime `json:"departure"`
+	Message          string         `json:"message"`
+}
+
+// TagCount is a tag and how many records of a trip carry it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// Privacy keeps a trip item, or some of its fields, visible to the trip
+// owner only. Fields are cost, confirmationCode and notes.
+type Privacy struct {
+	Item   bool     `json:"item,omitempty"`
+	Fields []string `json:"fields,omitempty"`
 }
 
 type Trip struct {
@@ -102,15 +288,58 @@ type Trip struct {
 	CoverImageFileName string         `json:"coverImageFileName"`
 	Notes              string         `json:"notes"`
 	Budget             *Cost          `json:"budget"`
+	// BudgetCategories split the budget, see trips.BudgetCategories
+	BudgetCategories map[string]float64 `json:"budgetCategories,omitempty"`
+	Insurance        *Insurance         `json:"insurance"`
+}
+
+type Insurance struct {
+	Provider       string `json:"provider"`
+	PolicyNumber   string `json:"policyNumber"`
+	Coverage       string `json:"coverage"`
+	EmergencyPhone string `json:"emergencyPhone"`
+	Notes          string `json:"notes"`
 }
 
 type ExportedTrip struct {
-	Trip            *Trip             `json:"trip"`
+	Trip            *Trip              `json:"trip"`
+	Transportations []*Transportation  `json:"transportations"`
+	Lodgings        []*Lodging         `json:"lodgings"`
+	Activities      []*Activity        `json:"activities"`
+	Expenses        []*Expense         `json:"expenses"`
+	Rentals         []*EquipmentRental `json:"rentals"`
+	CarRentals      []*CarRental       `json:"carRentals"`
+	Dining          []*Dining          `json:"dining"`
+	Tickets         []*Ticket          `json:"tickets"`
+	Attachments     []*Attachment      `json:"attachments"`
+}
+
+type EmergencySheet struct {
+	TripId          string            `json:"tripId"`
+	TripName        string            `json:"tripName"`
+	StartDate       types.DateTime    `json:"startDate"`
+	EndDate         types.DateTime    `json:"endDate"`
+	Insurance       *Insurance        `json:"insurance"`
+	Participants    []Participant     `json:"participants"`
+	Destinations    []Destination     `json:"destinations"`
+	Lodgings        []*Lodging        `json:"lodgings"`
+	Transportations []*Transportation `json:"transportations"`
+	GeneratedAt     types.DateTime    `json:"generatedAt"`
+}
+
+type InsuranceClaim struct {
+	TripId          string            `json:"tripId"`
+	TripName        string            `json:"tripName"`
+	Insurance       *Insurance        `json:"insurance"`
+	IncidentStart   types.DateTime    `json:"incidentStart"`
+	IncidentEnd     types.DateTime    `json:"incidentEnd"`
+	Description     string            `json:"description"`
 	Transportations []*Transportation `json:"transportations"`
 	Lodgings        []*Lodging        `json:"lodgings"`
 	Activities      []*Activity       `json:"activities"`
 	Expenses        []*Expense        `json:"expenses"`
-	Attachments     []*Attachment     `json:"attachments"`
+	Totals          []Cost            `json:"totals"`
+	GeneratedAt     types.DateTime    `json:"generatedAt"`
 }
 
 type Airport struct {
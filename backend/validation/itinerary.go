@@ -0,0 +1,127 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	v "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// accepted timestamp layouts, most specific first
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02 15:04:05.000Z",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// date ranges of the itinerary collections, as start field -> end field
+var recordDateRanges = map[string][2]string{
+	"transportations":   {"departureTime", "arrivalTime"},
+	"lodgings":          {"startDate", "endDate"},
+	"activities":        {"startDate", "endDate"},
+	"equipment_rentals": {"pickupTime", "returnTime"},
+	"car_rentals":       {"pickupTime", "dropoffTime"},
+	"tickets":           {"entryStart", "entryEnd"},
+}
+
+// JSON fields holding a {value, currency} amount
+var recordCostFields = []string{"cost", "deposit"}
+
+func ParseTimestamp(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range timestampLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a valid date/time", value)
+}
+
+func ValidateRange(start time.Time, end time.Time) error {
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		return v.NewError("validation_end_before_start", "must not be before the start")
+	}
+	return nil
+}
+
+// NormalizeCost upper-cases the currency and checks that the amount is usable
+func NormalizeCost(value float64, currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if value < 0 {
+		return currency, v.NewError("validation_negative_cost", "cost cannot be negative")
+	}
+	if value > 0 && !currencyCodePattern.MatchString(currency) {
+		return currency, v.NewError("validation_invalid_currency", "currency must be a 3 letter ISO code")
+	}
+	return currency, nil
+}
+
+// ValidateItineraryRecord is bound to the record validation of the itinerary
+// collections, so it applies to regular API requests and to records created
+// by the assistant alike
+func ValidateItineraryRecord(e *core.RecordEvent) error {
+	if errs := ItineraryRecordErrors(e.Record); len(errs) > 0 {
+		return errs
+	}
+	return e.Next()
+}
+
+func ItineraryRecordErrors(record *core.Record) v.Errors {
+	errs := v.Errors{}
+
+	if fields, ok := recordDateRanges[record.Collection().Name]; ok {
+		start := record.GetDateTime(fields[0])
+		end := record.GetDateTime(fields[1])
+		if err := ValidateRange(start.Time(), end.Time()); err != nil {
+			errs[fields[1]] = err
+		}
+	}
+
+	for _, field := range recordCostFields {
+		var cost struct {
+			Value    float64 `json:"value"`
+			Currency string  `json:"currency"`
+		}
+		if record.Collection().Fields.GetByName(field) == nil {
+			continue
+		}
+		if err := record.UnmarshalJSONField(field, &cost); err == nil {
+			currency, costErr := NormalizeCost(cost.Value, cost.Currency)
+			if costErr != nil {
+				errs[field] = costErr
+			} else if currency != cost.Currency {
+				record.Set(field, map[string]interface{}{
+					"value":    cost.Value,
+					"currency": currency,
+				})
+			}
+		}
+	}
+
+	return errs
+}
+
+// FieldErrors flattens validation errors into field -> message pairs, which
+// is easier to relay back to the traveler (or the assistant) than nested data
+func FieldErrors(err error) map[string]string {
+	fields := map[string]string{}
+
+	var errs v.Errors
+	if errors.As(err, &errs) {
+		for field, fieldErr := range errs {
+			fields[field] = fieldErr.Error()
+		}
+	}
+	return fields
+}
@@ -0,0 +1,205 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	clockPattern      = regexp.MustCompile(`(?i)\b(?:at\s+)?(\d{1,2})(?:[:.](\d{2}))?\s*(am|pm|a\.m\.|p\.m\.)|\b(?:at\s+)?(\d{1,2}):(\d{2})\b|\b(noon|midday|midnight)\b`)
+	numericPattern    = regexp.MustCompile(`\b(\d{1,2})[/.](\d{1,2})(?:[/.](\d{2,4}))?\b`)
+	ordinalPattern    = regexp.MustCompile(`(?i)\b(?:the\s+)?(\d{1,2})(?:st|nd|rd|th)\b`)
+	dayMonthPattern   = regexp.MustCompile(`(?i)\b(\d{1,2})(?:st|nd|rd|th)?(?:\s+of)?\s+([a-z]{3,9})\b`)
+	monthDayPattern   = regexp.MustCompile(`(?i)\b([a-z]{3,9})\s+(\d{1,2})(?:st|nd|rd|th)?\b`)
+	relativeDayPhrase = regexp.MustCompile(`(?i)\b(today|tonight|tomorrow|day after tomorrow)\b`)
+	weekdayPhrase     = regexp.MustCompile(`(?i)\b(next|this|on)?\s*(monday|tuesday|wednesday|thursday|friday|saturday|sunday)\b`)
+)
+
+var monthNames = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October,
+	"nov": time.November, "dec": time.December,
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// ParseNaturalTime accepts everything ParseTimestamp does plus the phrases
+// travelers type in chat, e.g. "next Friday 7pm", "the 14th" or "14/03 19:30".
+// Relative dates are resolved against now, a wall clock time, and dates
+// without a year pick the first matching day on or after it. dayFirst decides
+// whether 03/04 is the 3rd of April or March 4th. The result is a wall clock
+// time in UTC, like every other itinerary time.
+func ParseNaturalTime(value string, now time.Time, dayFirst bool) (time.Time, error) {
+	if parsed, err := ParseTimestamp(value); err == nil {
+		return parsed, nil
+	}
+
+	text := strings.ToLower(strings.TrimSpace(value))
+	if text == "" {
+		return time.Time{}, fmt.Errorf("%q is not a valid date/time", value)
+	}
+
+	hour, minute, hasClock, text := extractClock(text)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	day, hasDay := resolveDay(text, today, dayFirst)
+	if !hasDay {
+		if !hasClock {
+			return time.Time{}, fmt.Errorf("%q is not a valid date/time", value)
+		}
+		day = today
+	}
+	if relativeDayPhrase.FindString(text) == "tonight" && !hasClock {
+		hour = 20
+	}
+
+	return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute), nil
+}
+
+// extractClock finds a time of day and returns the text without it, so the
+// digits of "7pm" are not mistaken for a day of the month
+func extractClock(text string) (int, int, bool, string) {
+	match := clockPattern.FindStringSubmatchIndex(text)
+	if match == nil {
+		return 0, 0, false, text
+	}
+	groups := clockPattern.FindStringSubmatch(text)
+	rest := text[:match[0]] + " " + text[match[1]:]
+
+	switch {
+	case groups[6] != "":
+		if groups[6] == "midnight" {
+			return 0, 0, true, rest
+		}
+		return 12, 0, true, rest
+	case groups[4] != "":
+		hour, _ := strconv.Atoi(groups[4])
+		minute, _ := strconv.Atoi(groups[5])
+		if hour > 23 || minute > 59 {
+			return 0, 0, false, text
+		}
+		return hour, minute, true, rest
+	default:
+		hour, _ := strconv.Atoi(groups[1])
+		minute, _ := strconv.Atoi(groups[2])
+		if hour < 1 || hour > 12 || minute > 59 {
+			return 0, 0, false, text
+		}
+		if strings.HasPrefix(groups[3], "p") && hour != 12 {
+			hour += 12
+		} else if strings.HasPrefix(groups[3], "a") && hour == 12 {
+			hour = 0
+		}
+		return hour, minute, true, rest
+	}
+}
+
+func resolveDay(text string, today time.Time, dayFirst bool) (time.Time, bool) {
+	if match := relativeDayPhrase.FindString(text); match != "" {
+		switch match {
+		case "tomorrow":
+			return today.AddDate(0, 0, 1), true
+		case "day after tomorrow":
+			return today.AddDate(0, 0, 2), true
+		default:
+			return today, true
+		}
+	}
+
+	if groups := weekdayPhrase.FindStringSubmatch(text); groups != nil {
+		target := weekdayNames[groups[2]]
+		offset := (int(target) - int(today.Weekday()) + 7) % 7
+		// "next Friday" said on a Friday means the one a week away
+		if offset == 0 && groups[1] == "next" {
+			offset = 7
+		}
+		return today.AddDate(0, 0, offset), true
+	}
+
+	if groups := numericPattern.FindStringSubmatch(text); groups != nil {
+		first, _ := strconv.Atoi(groups[1])
+		second, _ := strconv.Atoi(groups[2])
+		day, month := second, first
+		if dayFirst {
+			day, month = first, second
+		}
+		if groups[3] != "" {
+			year, _ := strconv.Atoi(groups[3])
+			if year < 100 {
+				year += 2000
+			}
+			return validDate(year, time.Month(month), day)
+		}
+		return nextDate(today, time.Month(month), day)
+	}
+
+	for _, groups := range dayMonthPattern.FindAllStringSubmatch(text, -1) {
+		if month, ok := lookupMonth(groups[2]); ok {
+			day, _ := strconv.Atoi(groups[1])
+			return nextDate(today, month, day)
+		}
+	}
+	for _, groups := range monthDayPattern.FindAllStringSubmatch(text, -1) {
+		if month, ok := lookupMonth(groups[1]); ok {
+			day, _ := strconv.Atoi(groups[2])
+			return nextDate(today, month, day)
+		}
+	}
+
+	if groups := ordinalPattern.FindStringSubmatch(text); groups != nil {
+		day, _ := strconv.Atoi(groups[1])
+		for i := 0; i < 12; i++ {
+			month := today.AddDate(0, i, 1-today.Day())
+			if date, ok := validDate(month.Year(), month.Month(), day); ok && !date.Before(today) {
+				return date, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// lookupMonth accepts full and abbreviated English month names
+func lookupMonth(name string) (time.Month, bool) {
+	month, ok := monthNames[name[:3]]
+	if !ok {
+		return 0, false
+	}
+	// "marvel" or "junk" are not months
+	full := strings.ToLower(month.String())
+	if !strings.HasPrefix(full, name) && name != "sept" {
+		return 0, false
+	}
+	return month, true
+}
+
+// nextDate returns the first occurrence of month/day on or after today
+func nextDate(today time.Time, month time.Month, day int) (time.Time, bool) {
+	date, ok := validDate(today.Year(), month, day)
+	if !ok {
+		return time.Time{}, false
+	}
+	if date.Before(today) {
+		return validDate(today.Year()+1, month, day)
+	}
+	return date, true
+}
+
+func validDate(year int, month time.Month, day int) (time.Time, bool) {
+	if month < time.January || month > time.December || day < 1 || day > 31 {
+		return time.Time{}, false
+	}
+	date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	// time.Date normalizes the 31st of April into May
+	if date.Month() != month {
+		return time.Time{}, false
+	}
+	return date, true
+}
@@ -0,0 +1,77 @@
+package openmeteo
+
+import (
+	"backend/cache"
+	"backend/weather"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type dailyResponse struct {
+	Time                        []string  `json:"time"`
+	TemperatureMax              []float64 `json:"temperature_2m_max"`
+	TemperatureMin              []float64 `json:"temperature_2m_min"`
+	PrecipitationProbabilityMax []float64 `json:"precipitation_probability_max"`
+	WeatherCode                 []int     `json:"weather_code"`
+}
+
+type forecastResponse struct {
+	Daily dailyResponse `json:"daily"`
+}
+
+// OpenMeteo uses the free open-meteo.com forecast api, which needs no api key.
+// Dates are returned in the local timezone of the requested coordinates.
+type OpenMeteo struct{}
+
+func (o OpenMeteo) GetDailyForecast(latitude float64, longitude float64) ([]weather.DailyForecast, error) {
+
+	// forecasts barely change within an hour and nearby places share them
+	cacheKey := fmt.Sprintf("weather-%.2f-%.2f", latitude, longitude)
+	if val, found := cache.Get(cacheKey); found {
+		return val.([]weather.DailyForecast), nil
+	}
+
+	url := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%.4f&longitude=%.4f"+
+		"&daily=temperature_2m_max,temperature_2m_min,precipitation_probability_max,weather_code"+
+		"&timezone=auto&forecast_days=16", latitude, longitude)
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("open-meteo returned %s", resp.Status)
+	}
+
+	var data forecastResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	daily := data.Daily
+	forecasts := make([]weather.DailyForecast, 0, len(daily.Time))
+	for i, date := range daily.Time {
+		forecast := weather.DailyForecast{Date: date}
+		if i < len(daily.TemperatureMax) {
+			forecast.TemperatureMax = daily.TemperatureMax[i]
+		}
+		if i < len(daily.TemperatureMin) {
+			forecast.TemperatureMin = daily.TemperatureMin[i]
+		}
+		if i < len(daily.PrecipitationProbabilityMax) {
+			forecast.PrecipitationProbability = daily.PrecipitationProbabilityMax[i]
+		}
+		if i < len(daily.WeatherCode) {
+			forecast.WeatherCode = daily.WeatherCode[i]
+		}
+		forecasts = append(forecasts, forecast)
+	}
+
+	cache.Set(cacheKey, forecasts, time.Hour)
+	return forecasts, nil
+}
@@ -0,0 +1,51 @@
+package weather
+
+type DailyForecast struct {
+	Date                     string  `json:"date"`
+	TemperatureMax           float64 `json:"temperatureMax"`
+	TemperatureMin           float64 `json:"temperatureMin"`
+	PrecipitationProbability float64 `json:"precipitationProbability"`
+	WeatherCode              int     `json:"weatherCode"`
+}
+
+type DataProvider interface {
+	GetDailyForecast(latitude float64, longitude float64) ([]DailyForecast, error)
+}
+
+// ForecastFor returns the forecast of the given day (formatted as 2006-01-02)
+func ForecastFor(forecasts []DailyForecast, date string) (DailyForecast, bool) {
+	for _, forecast := range forecasts {
+		if forecast.Date == date {
+			return forecast, true
+		}
+	}
+	return DailyForecast{}, false
+}
+
+// Conditions describes a WMO weather code in a few words
+func Conditions(code int) string {
+	switch {
+	case code == 0:
+		return "clear"
+	case code <= 2:
+		return "partly cloudy"
+	case code == 3:
+		return "overcast"
+	case code == 45 || code == 48:
+		return "fog"
+	case code >= 51 && code <= 57:
+		return "drizzle"
+	case code >= 61 && code <= 67:
+		return "rain"
+	case code >= 71 && code <= 77:
+		return "snow"
+	case code >= 80 && code <= 82:
+		return "rain showers"
+	case code == 85 || code == 86:
+		return "snow showers"
+	case code >= 95:
+		return "thunderstorm"
+	default:
+		return ""
+	}
+}